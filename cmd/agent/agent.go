@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"lemita/datn/pkg/config"
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/sink"
+)
+
+// runAgent collects the configured channels every interval and sends the new
+// events to the sink until stop is closed, then flushes the sink and saves the
+// checkpoints. A channel's checkpoint only advances once its events are queued
+// for the sink, which spools them while the destination is unreachable.
+func runAgent(opts agentOptions, out io.Writer, stop <-chan struct{}) int {
+	logf := func(format string, args ...any) {
+		fmt.Fprintf(out, "%s %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+	}
+
+	channels, err := config.LoadChannelConfigs(opts.channelsFile)
+	if err != nil {
+		logf("Error loading channels: %v", err)
+		return 2
+	}
+	// A second agent, or the collector in follow mode, on the same checkpoints
+	// would send every event twice
+	lock, err := eventlog.LockCheckpoints(opts.checkpointPath)
+	if err != nil {
+		logf("Error: another run is already using the checkpoints in %s: %v", opts.checkpointPath, err)
+		return 1
+	}
+	defer lock.Release()
+	checkpoints, err := eventlog.LoadCheckpoints(opts.checkpointPath)
+	if err != nil {
+		logf("Error loading checkpoints: %v", err)
+		return 1
+	}
+	eventSink, err := newSink(opts)
+	if err != nil {
+		logf("Error creating sink: %v", err)
+		return 2
+	}
+
+	logf("Agent %s started: %d channels every %v to %s (checkpoints: %s)", eventlog.CollectorVersion, len(channels), opts.interval, opts.sinkURL, opts.checkpointPath)
+	start := time.Now().Add(-opts.backfill)
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+
+	for {
+		sent := 0
+		for _, channelConfig := range channels {
+			if !channelConfig.Available {
+				continue
+			}
+			n, err := collectChannel(channelConfig, checkpoints, eventSink, start, logf)
+			if err != nil {
+				logf("Error collecting %s: %v", channelConfig.Name, err)
+			}
+			sent += n
+		}
+		if err := eventSink.Flush(); err != nil {
+			logf("Error flushing sink: %v", err)
+		}
+		if err := checkpoints.Save(); err != nil {
+			logf("Error saving checkpoints: %v", err)
+		}
+		if sent > 0 {
+			stats := eventSink.Stats()
+			logf("Sent %d new events (total sent %d, spooled %d, evicted %d)", sent, stats.Sent, stats.Spooled, stats.Evicted)
+		}
+
+		select {
+		case <-stop:
+			exitCode := 0
+			if err := eventSink.Close(); err != nil {
+				logf("Error flushing sink: %v", err)
+				exitCode = 1
+			}
+			logf("Agent stopped")
+			return exitCode
+		case <-ticker.C:
+		}
+	}
+}
+
+// collectChannel queues the events of a channel logged after its checkpoint for
+// the sink and advances the checkpoint. A channel without a checkpoint is read
+// from start, so a new agent doesn't send the whole history of the log.
+func collectChannel(channelConfig config.ChannelConfig, checkpoints *eventlog.Checkpoints, eventSink sink.Sink, start time.Time, logf func(string, ...any)) (int, error) {
+	opts := eventlog.CollectOptions{
+		EventIDs:    channelConfig.EventIDs,
+		AfterRecord: checkpoints.Get(channelConfig.Name),
+		MemoryLimit: eventlog.DefaultMemoryLimit,
+	}
+	if opts.AfterRecord == 0 {
+		opts.Since = start
+	}
+	result, err := eventlog.CollectWithOptions(channelConfig.Name, opts)
+	if result == nil {
+		return 0, err
+	}
+	defer result.Close()
+	if result.Reset {
+		logf("Warning: %s was cleared since its checkpoint at record %d; read it from the oldest record", channelConfig.Name, opts.AfterRecord)
+	}
+
+	var writeErr error
+	eachErr := result.Each(func(events []eventlog.EventLogData) {
+		if writeErr == nil {
+			writeErr = eventSink.Write(channelConfig.Name, events)
+		}
+	})
+	if writeErr != nil || eachErr != nil {
+		// Not advancing the checkpoint sends the events again on the next pass
+		return 0, fmt.Errorf("failed to queue events for the sink: %v", firstError(writeErr, eachErr))
+	}
+	checkpoints.Set(channelConfig.Name, result.LastRecord)
+	return result.Len(), err
+}
+
+// firstError returns the first non-nil error
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
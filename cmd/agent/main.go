@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+
+	"lemita/datn/pkg/config"
+	"lemita/datn/pkg/sink"
+)
+
+// serviceName is the Windows service the agent installs as; the MSI registers the
+// full collector as "datn", so both can be installed side by side
+const serviceName = "datn-agent"
+
+// agentOptions configures the agent
+type agentOptions struct {
+	sinkURL        string
+	interval       time.Duration
+	channelsFile   string
+	checkpointPath string
+	logPath        string
+	spoolDir       string
+	backfill       time.Duration
+}
+
+// agent is a lightweight monitoring agent: it runs as a Windows service and
+// periodically sends the events logged since its last pass to a network sink,
+// remembering the last record number of every channel between passes and restarts
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "install":
+			os.Exit(runInstall(os.Args[2:]))
+		case "uninstall":
+			os.Exit(runUninstall())
+		case "run":
+			opts, ok := parseOptions(os.Args[2:])
+			if !ok {
+				os.Exit(2)
+			}
+			os.Exit(runConsole(opts))
+		}
+	}
+
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		fmt.Printf("Failed to detect service mode: %v\n", err)
+		os.Exit(1)
+	}
+	if !isService {
+		fmt.Printf("Usage:\n  %s install [flags]   install and start the service\n  %s uninstall         stop and remove the service\n  %s run [flags]       run in the console until Ctrl+C\n\nFlags:\n", os.Args[0], os.Args[0], os.Args[0])
+		newFlagSet(&agentOptions{}).PrintDefaults()
+		os.Exit(2)
+	}
+
+	// The service control manager starts the agent with the flags given to install
+	opts, ok := parseOptions(os.Args[1:])
+	if !ok {
+		os.Exit(2)
+	}
+	if err := svc.Run(serviceName, &agentService{opts: opts}); err != nil {
+		os.Exit(1)
+	}
+}
+
+// dataDir is where the agent keeps its state by default: %ProgramData%\datn
+func dataDir() string {
+	programData := os.Getenv("ProgramData")
+	if programData == "" {
+		programData = `C:\ProgramData`
+	}
+	return filepath.Join(programData, "datn")
+}
+
+// newFlagSet returns the agent flags, bound to opts
+func newFlagSet(opts *agentOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+	fs.StringVar(&opts.sinkURL, "sink", "", "Network sink the events are sent to (http:// or https:// URL, required)")
+	fs.DurationVar(&opts.interval, "interval", time.Minute, "How often new events are collected")
+	fs.StringVar(&opts.channelsFile, "config", "", "YAML, JSON or TOML file of the channels to collect (default: the built-in channels)")
+	fs.StringVar(&opts.checkpointPath, "checkpoint", filepath.Join(dataDir(), "agent-checkpoints.json"), "File recording the last collected record per channel")
+	fs.StringVar(&opts.logPath, "log", filepath.Join(dataDir(), "agent.log"), "File the agent's status messages are appended to when running as a service")
+	fs.StringVar(&opts.spoolDir, "spool", filepath.Join(dataDir(), "agent-spool"), "Directory used to spool events while the sink is unreachable (empty disables spooling)")
+	fs.DurationVar(&opts.backfill, "backfill", 0, "On the first pass, also send the events of this period before the agent started (0 = only events logged from then on)")
+	return fs
+}
+
+// parseOptions parses and checks the agent flags
+func parseOptions(args []string) (agentOptions, bool) {
+	var opts agentOptions
+	if err := newFlagSet(&opts).Parse(args); err != nil {
+		return opts, false
+	}
+	if opts.sinkURL == "" {
+		fmt.Println("-sink is required")
+		return opts, false
+	}
+	if opts.interval <= 0 {
+		fmt.Println("-interval must be positive")
+		return opts, false
+	}
+	if opts.backfill < 0 {
+		fmt.Println("-backfill must not be negative")
+		return opts, false
+	}
+	if _, err := config.LoadChannelConfigs(opts.channelsFile); err != nil {
+		fmt.Printf("Error loading channels: %v\n", err)
+		return opts, false
+	}
+	return opts, true
+}
+
+// newSink creates the network sink of the agent
+func newSink(opts agentOptions) (sink.Sink, error) {
+	sinkOpts := sink.DefaultOptions()
+	sinkOpts.SpoolDir = opts.spoolDir
+	return sink.New(opts.sinkURL, sinkOpts)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// Recovery of the installed service: restart it after a crash
+const (
+	restartDelay = time.Minute
+	resetPeriod  = 24 * time.Hour
+)
+
+// agentService runs the agent under the service control manager
+type agentService struct {
+	opts agentOptions
+}
+
+// Execute implements svc.Handler: it runs the collection loop until the SCM asks
+// the service to stop
+func (s *agentService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	if err := os.MkdirAll(filepath.Dir(s.opts.logPath), 0700); err != nil {
+		return true, 1
+	}
+	logFile, err := os.OpenFile(s.opts.logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return true, 1
+	}
+	defer logFile.Close()
+
+	stop := make(chan struct{})
+	exitCode := make(chan int, 1)
+	go func() {
+		exitCode <- runAgent(s.opts, logFile, stop)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				close(stop)
+				return false, uint32(<-exitCode)
+			}
+		case code := <-exitCode:
+			// The agent stopped on its own, e.g. because the checkpoints could not be read
+			return code != 0, uint32(code)
+		}
+	}
+}
+
+// runConsole runs the agent in the console until Ctrl+C
+func runConsole(opts agentOptions) int {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	stop := make(chan struct{})
+	go func() {
+		<-interrupt
+		close(stop)
+	}()
+	return runAgent(opts, os.Stdout, stop)
+}
+
+// runInstall registers the agent as an automatically started service that runs
+// with the given flags, and starts it
+func runInstall(args []string) int {
+	if _, ok := parseOptions(args); !ok {
+		return 2
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Printf("Error locating the agent binary: %v\n", err)
+		return 1
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		fmt.Printf("Error connecting to the service control manager (run as administrator): %v\n", err)
+		return 1
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		fmt.Printf("Service %s is already installed; uninstall it first to change its flags\n", serviceName)
+		return 1
+	}
+
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName:      "datn event log agent",
+		Description:      "Periodically sends new Windows event log events to a network sink",
+		StartType:        mgr.StartAutomatic,
+		DelayedAutoStart: true,
+	}, args...)
+	if err != nil {
+		fmt.Printf("Error creating service %s: %v\n", serviceName, err)
+		return 1
+	}
+	defer s.Close()
+	recovery := []mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: restartDelay}}
+	if err := s.SetRecoveryActions(recovery, uint32(resetPeriod/time.Second)); err != nil {
+		fmt.Printf("Warning: failed to set the restart policy of %s: %v\n", serviceName, err)
+	}
+	if err := s.Start(); err != nil {
+		fmt.Printf("Service %s installed, but failed to start: %v\n", serviceName, err)
+		return 1
+	}
+	fmt.Printf("Service %s installed and started (%s)\n", serviceName, exe)
+	return 0
+}
+
+// runUninstall stops and removes the service
+func runUninstall() int {
+	m, err := mgr.Connect()
+	if err != nil {
+		fmt.Printf("Error connecting to the service control manager (run as administrator): %v\n", err)
+		return 1
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		fmt.Printf("Service %s is not installed\n", serviceName)
+		return 1
+	}
+	defer s.Close()
+
+	if status, err := s.Control(svc.Stop); err == nil {
+		deadline := time.Now().Add(30 * time.Second)
+		for status.State != svc.Stopped && time.Now().Before(deadline) {
+			time.Sleep(500 * time.Millisecond)
+			if status, err = s.Query(); err != nil {
+				break
+			}
+		}
+	}
+	if err := s.Delete(); err != nil {
+		fmt.Printf("Error removing service %s: %v\n", serviceName, err)
+		return 1
+	}
+	fmt.Printf("Service %s removed\n", serviceName)
+	return 0
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/fleet"
+)
+
+// runAggregate implements the aggregate subcommand: it merges saved fleet runs and
+// prints fleet-wide statistics
+func runAggregate(args []string) int {
+	fs := flag.NewFlagSet("aggregate", flag.ExitOnError)
+	top := fs.Int("top", 10, "Number of hosts listed in ranked tables")
+	rare := fs.Int("rare", 1, "List persistence binaries found on at most this many hosts (least-frequency stacking)")
+	timeline := fs.String("timeline", "", "Show when this hash, IP address or other value first appeared on each host")
+	lockouts := fs.Bool("lockouts", false, "Show the workstations and processes causing account lockouts (4740, 4625, 4767)")
+	account := fs.String("account", "", "Limit -lockouts to this account")
+	asJSON := fs.Bool("json", false, "Print the results as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s aggregate [flags] FLEET_DIR...\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	runs, err := fleet.FindRuns(fs.Args())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if len(runs) == 0 {
+		fmt.Println("No saved runs found")
+		return 1
+	}
+
+	if *lockouts || *account != "" {
+		results, err := fleet.Lockouts(runs, *account)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		if *asJSON {
+			return printJSON(results)
+		}
+		printLockouts(results)
+		return 0
+	}
+
+	if *timeline != "" {
+		sightings, err := fleet.Timeline(runs, *timeline)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		if *asJSON {
+			return printJSON(sightings)
+		}
+
+		fmt.Printf("Timeline of %q across %d runs\n\n", *timeline, len(runs))
+		if len(sightings) == 0 {
+			fmt.Println("Not seen on any host")
+			return 0
+		}
+		for _, s := range sightings {
+			fmt.Printf("  %s  %-30s last seen %s, %d events (%s)\n",
+				s.FirstSeen.Format(time.RFC3339), s.Host, s.LastSeen.Format(time.RFC3339), s.Events, strings.Join(s.Sources, ", "))
+		}
+		return 0
+	}
+
+	report, err := fleet.Aggregate(runs, *top, *rare)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if *asJSON {
+		return printJSON(report)
+	}
+
+	fmt.Printf("Fleet aggregation: %d runs from %d hosts, %d unique events\n", report.Runs, len(report.Hosts), report.Events)
+
+	fmt.Printf("\nHosts with most failed logons (4625):\n")
+	if len(report.FailedLogons) == 0 {
+		fmt.Println("  none")
+	}
+	for _, hc := range report.FailedLogons {
+		fmt.Printf("  %-30s %d\n", hc.Host, hc.Count)
+	}
+
+	fmt.Printf("\nPersistence binaries on at most %d hosts, rarest first (%d of %d hosts inventoried):\n", *rare, report.Inventoried, len(report.Hosts))
+	if report.Inventoried == 0 {
+		fmt.Println("  no inventories found (collect with -inventory)")
+	} else if len(report.LeastFrequent) == 0 {
+		fmt.Println("  none")
+	}
+	for _, entry := range report.LeastFrequent {
+		fmt.Printf("  %d/%d  %-8s %-30s %s\n", len(entry.Hosts), report.Inventoried, entry.Kind, strings.Join(entry.Names, ", "), entry.Path)
+		fmt.Printf("        %s on %s\n", entry.Hash, strings.Join(entry.Hosts, ", "))
+	}
+	return 0
+}
+
+// printLockouts prints the lockout root-cause analysis of each account
+func printLockouts(results []fleet.AccountLockouts) {
+	if len(results) == 0 {
+		fmt.Println("No account lockouts found")
+		return
+	}
+	for _, a := range results {
+		fmt.Printf("Account %s: %d lockouts", a.Account, a.Lockouts)
+		if a.Lockouts > 0 {
+			fmt.Printf(" between %s and %s", a.FirstLockout.Format(time.RFC3339), a.LastLockout.Format(time.RFC3339))
+		}
+		fmt.Println()
+
+		fmt.Println("  Caller computers (4740):")
+		if len(a.CallerComputers) == 0 {
+			fmt.Println("    none logged (collect the Security log of the domain controllers)")
+		}
+		for _, hc := range a.CallerComputers {
+			fmt.Printf("    %-30s %d\n", hc.Host, hc.Count)
+		}
+
+		fmt.Println("  Bad-password sources (4625):")
+		if len(a.Sources) == 0 {
+			fmt.Println("    none")
+		}
+		for _, s := range a.Sources {
+			fmt.Printf("    %5d  workstation %s, address %s, logon type %s, process %s\n", s.Count,
+				orDash(s.Workstation), orDash(s.IpAddress), orDash(s.LogonType), orDash(s.Process))
+			fmt.Printf("           last %s, logged by %s\n", s.LastSeen.Format(time.RFC3339), strings.Join(s.ReportedBy, ", "))
+		}
+
+		for _, u := range a.Unlocks {
+			fmt.Printf("  Unlocked %s by %s on %s\n", u.Time.Format(time.RFC3339), u.By, u.Host)
+		}
+		fmt.Println()
+	}
+}
+
+// orDash returns "-" for an empty field
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// printJSON prints v as indented JSON and returns the exit code
+func printJSON(v any) int {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Printf("Error encoding results: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(data))
+	return 0
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/store"
+)
+
+// runAnnotate implements the annotate subcommand: it attaches labels and a note to
+// an event of the store, identified by its UID, or lists the notes of the store
+func runAnnotate(args []string) int {
+	fs := flag.NewFlagSet("annotate", flag.ExitOnError)
+	storeDir := fs.String("store", defaultStoreDir, "Event store directory written by the collector")
+	uid := fs.String("uid", "", "UID of the event to annotate, as shown by query -output json")
+	labels := fs.String("label", "", "Comma-separated labels, e.g. benign or escalated,ticket-1234")
+	author := fs.String("author", "", "Name recorded with the note (default: the current Windows user)")
+	list := fs.Bool("list", false, "List the notes of the store, or of the -uid event, instead of adding one")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s annotate [flags] [note text]\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Example: %s annotate -uid 3f9c0d2a1b7e4c55 -label benign \"Scheduled backup job\"\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "         %s query label=benign\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if _, err := os.Stat(*storeDir); err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		return 2
+	}
+	s, err := store.Open(*storeDir)
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		return 2
+	}
+
+	if *list {
+		notes, err := s.Notes()
+		if err != nil {
+			fmt.Printf("Error reading notes: %v\n", err)
+			return 1
+		}
+		printNotes(notes, *uid)
+		return 0
+	}
+
+	if *uid == "" {
+		fmt.Println("-uid is required to add a note")
+		return 2
+	}
+	note := eventlog.Note{
+		Labels: strings.Split(*labels, ","),
+		Text:   strings.Join(fs.Args(), " "),
+		Author: *author,
+	}
+	if note.Author == "" {
+		if current, err := user.Current(); err == nil {
+			note.Author = current.Username
+		}
+	}
+	if err := s.AddNote(*uid, note); err != nil {
+		fmt.Printf("Error adding note: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Added note to event %s\n", *uid)
+	return 0
+}
+
+// printNotes lists the notes of one event, or of every event when uid is empty
+func printNotes(notes store.Notes, uid string) {
+	uids := []string{uid}
+	if uid == "" {
+		uids = uids[:0]
+		for id := range notes {
+			uids = append(uids, id)
+		}
+		sort.Strings(uids)
+	}
+	count := 0
+	for _, id := range uids {
+		for _, note := range notes[id] {
+			count++
+			fmt.Printf("%s  %s  %s", id, note.Time.Local().Format("2006-01-02 15:04:05"), note.Author)
+			if len(note.Labels) > 0 {
+				fmt.Printf("  [%s]", strings.Join(note.Labels, ", "))
+			}
+			fmt.Println()
+			if note.Text != "" {
+				fmt.Printf("    %s\n", note.Text)
+			}
+		}
+	}
+	fmt.Printf("\n%d notes\n", count)
+}
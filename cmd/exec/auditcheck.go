@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"lemita/datn/pkg/audit"
+	"lemita/datn/pkg/auditpolicy"
+	"lemita/datn/pkg/config"
+)
+
+// processCreationEventID is the Security event logged for every new process
+const processCreationEventID = 4688
+
+// collectsProcessCreation reports whether the channels include Security 4688
+func collectsProcessCreation(channels []config.ChannelConfig) bool {
+	for _, channelConfig := range channels {
+		if !strings.EqualFold(channelConfig.Name, "Security") {
+			continue
+		}
+		if len(channelConfig.EventIDs) == 0 {
+			return true
+		}
+		for _, id := range channelConfig.EventIDs {
+			if id == processCreationEventID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkProcessAuditing warns when the local computer doesn't log 4688 with command
+// lines, which leaves process creation events nearly useless for detection. With
+// enable set, the audit policy and command line setting are turned on.
+func (c *collector) checkProcessAuditing(enable bool) {
+	status, err := auditpolicy.CheckProcessCreation()
+	if err != nil {
+		c.output.WriteString(fmt.Sprintf("Could not check process creation auditing: %v\n", err))
+		return
+	}
+	if status.Complete() {
+		return
+	}
+
+	var missing []string
+	if !status.Audited {
+		missing = append(missing, "process creation auditing is off")
+	}
+	if !status.CommandLine {
+		missing = append(missing, "command lines are not included")
+	}
+	if !enable {
+		c.output.WriteString(fmt.Sprintf("Warning: 4688 events are incomplete (%s); rerun as administrator with -enable-cmdline-audit to fix\n",
+			strings.Join(missing, ", ")))
+		return
+	}
+
+	if err := auditpolicy.EnableProcessCreation(); err != nil {
+		c.output.WriteString(fmt.Sprintf("Error enabling process creation auditing: %v\n", err))
+		return
+	}
+	c.output.WriteString(fmt.Sprintf("Enabled process creation auditing with command lines (was: %s); a domain audit policy may override this\n",
+		strings.Join(missing, ", ")))
+	c.recordAudit(audit.ActionConfigChange, "enabled process creation auditing with command lines (was: %s)", strings.Join(missing, ", "))
+}
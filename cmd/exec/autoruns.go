@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"lemita/datn/pkg/autoruns"
+	"lemita/datn/pkg/eventlog"
+)
+
+// runAutoruns implements the autoruns subcommand: it dumps the Run and RunOnce
+// keys, Startup folders and Winlogon values of a computer with the SHA-256 of the
+// programs they start, for persistence hunting
+func runAutoruns(args []string) int {
+	fs := flag.NewFlagSet("autoruns", flag.ExitOnError)
+	server := fs.String("server", "", "List the autoruns of this remote computer (Remote Registry and admin share access)")
+	all := fs.Bool("all", false, "Also list the Winlogon values Windows ships with, such as Shell=explorer.exe")
+	asJSON := fs.Bool("json", false, "Print the entries as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s autoruns [flags]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	entries, err := autoruns.ListOn(*server)
+	if err != nil {
+		fmt.Printf("Error listing autoruns: %v\n", err)
+		return 1
+	}
+	if !*all {
+		kept := entries[:0]
+		for _, entry := range entries {
+			if !entry.Default {
+				kept = append(kept, entry)
+			}
+		}
+		entries = kept
+	}
+
+	if *asJSON {
+		return printJSON(entries)
+	}
+
+	host := *server
+	if host == "" {
+		host = eventlog.GetLocalComputerName()
+	}
+	fmt.Printf("Autoruns on %s: %d\n", host, len(entries))
+	location := ""
+	for _, entry := range entries {
+		if entry.Location != location {
+			location = entry.Location
+			fmt.Printf("\n  %s\n", location)
+		}
+		fmt.Printf("    %-24s %s\n", entry.Name, entry.Command)
+		if entry.Binary != entry.Command {
+			fmt.Printf("    %-24s %s\n", "", entry.Binary)
+		}
+		fmt.Printf("    %-24s sha256 %s\n", "", entry.Hash)
+	}
+	return 0
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+
+	"lemita/datn/pkg/benchmark"
+	"lemita/datn/pkg/eventlog"
+)
+
+// runBench implements the bench subcommand: it measures the record parser,
+// formatters and pipeline on synthetic events, and with -baseline fails when a
+// case got slower than a run saved with -save on the same machine
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	events := fs.Int("events", benchmark.DefaultEvents, "Synthetic events per operation")
+	run := fs.String("run", "", "Only run the cases matching this regular expression, e.g. ^format/")
+	evtxFile := fs.String("evtx", "", "Measure the .evtx reader on this file, e.g. a large log saved with wevtutil epl (default: a generated log of -events events)")
+	save := fs.String("save", "", "Save the results as a baseline to this file")
+	baselineFile := fs.String("baseline", "", "Compare the results with this saved baseline and exit 1 on regressions")
+	tolerance := fs.Float64("tolerance", 0.10, "Slowdown against the baseline tolerated before a case counts as a regression (0.10 = 10%)")
+	asJSON := fs.Bool("json", false, "Print the results as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s bench [flags]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *events <= 0 {
+		fmt.Println("-events must be positive")
+		return 2
+	}
+	var pattern *regexp.Regexp
+	if *run != "" {
+		var err error
+		if pattern, err = regexp.Compile(*run); err != nil {
+			fmt.Printf("Invalid -run: %v\n", err)
+			return 2
+		}
+	}
+	var baseline benchmark.Baseline
+	if *baselineFile != "" {
+		var err error
+		if baseline, err = benchmark.LoadBaseline(*baselineFile); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 2
+		}
+		if baseline.Events != *events {
+			fmt.Printf("Warning: The baseline was recorded with -events %d, not %d\n", baseline.Events, *events)
+		}
+	}
+
+	if *evtxFile == "" {
+		dir, err := os.MkdirTemp("", "datn-bench")
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		defer os.RemoveAll(dir)
+		*evtxFile = filepath.Join(dir, "Security.evtx")
+		if err := benchmark.WriteEvtx(*evtxFile, benchmark.Events(*events)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+	}
+
+	cases, err := benchmark.Cases(*events, *evtxFile)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	progress := func(r benchmark.Result) { fmt.Println(r) }
+	if *asJSON {
+		progress = nil
+	} else {
+		fmt.Printf("%d synthetic events per operation, %s, GOMAXPROCS %d\n\n", *events, runtime.Version(), runtime.GOMAXPROCS(0))
+	}
+	results := benchmark.Run(cases, pattern, progress)
+	if len(results) == 0 {
+		fmt.Println("No case matches -run")
+		return 2
+	}
+
+	current := benchmark.Baseline{
+		Host:    eventlog.GetLocalComputerName(),
+		Go:      runtime.Version(),
+		Events:  *events,
+		Results: results,
+	}
+	if *asJSON {
+		if code := printJSON(current); code != 0 {
+			return code
+		}
+	}
+	if *save != "" {
+		if err := benchmark.SaveBaseline(*save, current); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "Baseline saved to %s\n", *save)
+	}
+
+	if *baselineFile != "" {
+		if baseline.Host != current.Host {
+			fmt.Fprintf(os.Stderr, "Warning: The baseline was recorded on %s; timings of different machines don't compare\n", baseline.Host)
+		}
+		regressions := benchmark.Compare(results, baseline, *tolerance)
+		if len(regressions) > 0 {
+			fmt.Fprintf(os.Stderr, "\n%d regressions against %s:\n", len(regressions), *baselineFile)
+			for _, regression := range regressions {
+				fmt.Fprintf(os.Stderr, "  %s\n", regression)
+			}
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "\nNo regressions against %s (tolerance %.0f%%)\n", *baselineFile, *tolerance*100)
+	}
+	return 0
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"lemita/datn/pkg/allowlist"
+	"lemita/datn/pkg/audit"
+	"lemita/datn/pkg/config"
+	"lemita/datn/pkg/diag"
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/formatter"
+	"lemita/datn/pkg/iislog"
+	"lemita/datn/pkg/privacy"
+	"lemita/datn/pkg/sink"
+	"lemita/datn/pkg/telemetry"
+	"lemita/datn/pkg/trigger"
+)
+
+// collectFlags holds the flags of the collect and monitor commands. Flags a
+// command doesn't define keep their zero value, which turns their feature off.
+type collectFlags struct {
+	maxEvents          int
+	domainRows         int
+	sinceFlag          string
+	maxMemoryMB        int64
+	spillDir           string
+	flushInterval      time.Duration
+	auditLog           string
+	cacheDir           string
+	parallel           int
+	verbose            bool
+	outputFile         string
+	timeZone           string
+	aggregate          bool
+	typedFields        bool
+	messageDetail      string
+	encoding           string
+	appendOutput       bool
+	runDirName         string
+	maxOutputMB        int64
+	format             string
+	onlyAvailable      bool
+	channelsFile       string
+	specificChannel    string
+	levelList          string
+	privacyMode        string
+	privacyLength      int
+	rawBundle          string
+	caseID             string
+	analyst            string
+	caseNotes          string
+	vhdPath            string
+	tags               config.Tags
+	iisLogs            string
+	groupWatchlist     string
+	tagsFile           string
+	sinkURL            string
+	sinkSpool          string
+	sinkBatch          int
+	sinkGzip           bool
+	spoolEncrypt       bool
+	spoolMaxMB         int64
+	otlpEndpoint       string
+	otlpInterval       time.Duration
+	otlpHeadersFile    string
+	follow             bool
+	followInterval     time.Duration
+	checkpointFile     string
+	channelTimeout     time.Duration
+	runTimeout         time.Duration
+	force              bool
+	incremental        bool
+	drainTimeout       time.Duration
+	serviceDrift       time.Duration
+	healthFile         string
+	triggersFile       string
+	triggerOut         string
+	healthAddr         string
+	apiCert            string
+	apiKey             string
+	apiClientCA        string
+	apiTokens          string
+	apiPolicy          string
+	apiAllow           stringList
+	filterExprs        stringList
+	rulesFile          string
+	sigmaRules         string
+	sigmaOnly          bool
+	indexCrashes       bool
+	sarifFile          string
+	messageLocale      string
+	renderMessages     bool
+	fieldMap           string
+	sampleRules        stringList
+	storeDir           string
+	storeMaxDays       int
+	learnAllowlist     bool
+	allowlistBaseline  time.Duration
+	storeMaxMB         int64
+	diagDir            string
+	server             string
+	hostList           string
+	eventAPI           string
+	transport          string
+	outDir             string
+	inventory          bool
+	discoverOU         string
+	discoverDC         string
+	discoverTimeout    time.Duration
+	discoverParallel   int
+	runasAccount       string
+	skipSelfCheck      bool
+	enableCmdlineAudit bool
+	requireIntegrity   bool
+	interactive        bool
+}
+
+// newCollectFlags defines the flags of collect, or with monitor those of the
+// monitor command, which leaves out the flags of one-shot and fleet runs (-max,
+// -since, -hosts, -sarif, ...) because it always follows
+func newCollectFlags(name string, monitor bool) (*flag.FlagSet, *collectFlags) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	f := &collectFlags{tags: config.Tags{}}
+	fs.Int64Var(&f.maxMemoryMB, "max-memory-mb", eventlog.DefaultMemoryLimit>>20, "Spill a channel's events to a compressed temporary file beyond this many MB (0 = keep all in memory)")
+	fs.StringVar(&f.spillDir, "spill-dir", "", "Directory for spill files (default: the system temporary directory)")
+	fs.DurationVar(&f.flushInterval, "flush-interval", formatter.DefaultFlushInterval, "How often the buffered report is flushed and synced to disk (0 = after every write)")
+	fs.StringVar(&f.auditLog, "audit-log", audit.DefaultPath(), "Append-only, hash-chained log of the collector's own actions (empty disables it)")
+	fs.IntVar(&f.parallel, "parallel", 1, "Number of channels read concurrently; events are still written one channel at a time, in channel order")
+	fs.BoolVar(&f.verbose, "verbose", false, "Print the open, read, parse, format and write time of every channel")
+	fs.StringVar(&f.outputFile, "out", "", "Output file path, used as given (default: report.log in a new run directory below -outdir; 'console' for console output, '-' for only the report on stdout)")
+	fs.StringVar(&f.timeZone, "timezone", formatter.UTCTimeZone, "Time zone of event times in the report: utc, local, an offset such as +07:00, or an IANA name")
+	fs.BoolVar(&f.typedFields, "typed-fields", false, "Write the catalogued fields of JSON reports as numbers, booleans and RFC3339 times (ports, process IDs, flags, Sysmon UtcTime) instead of strings")
+	fs.StringVar(&f.messageDetail, "message-detail", formatter.MessageDetailBoth, "What the report shows of each event's description: message (the rendered text), strings (the raw insertion strings and fields) or both; events without a rendered message always show their strings")
+	fs.StringVar(&f.encoding, "encoding", formatter.UTF8Encoding, "Encoding of text and CSV report files: utf8, utf8-bom (for Excel) or utf16le (for older editors)")
+	fs.BoolVar(&f.appendOutput, "append", false, "Append to an existing output file, or to the report of the -run-name run directory, instead of refusing to overwrite it; implied by -follow with -out")
+	fs.StringVar(&f.runDirName, "run-name", "", "Name of the run directory (default: datn-<computer>-<timestamp>)")
+	fs.StringVar(&f.format, "format", formatter.TextFormat, "Format of the collected events: text, json (or jsonl) for newline-delimited JSON, csv for spreadsheets, or html for a standalone report with sortable tables (status messages then go to stderr)")
+	fs.BoolVar(&f.onlyAvailable, "available", true, "Only collect from channels expected to be available")
+	fs.StringVar(&f.channelsFile, "config", "", "YAML, JSON or TOML file listing the channels, purposes and event IDs to collect (default: the built-in channels)")
+	fs.StringVar(&f.specificChannel, "channel", "", "Collect from a specific channel only (leave empty for all channels)")
+	fs.StringVar(&f.levelList, "level", "", "Only collect events of these types, e.g. error,warning or audit-failure, in addition to the channels' event IDs (empty = all types)")
+	fs.StringVar(&f.privacyMode, "privacy", privacy.ModeOff, "Command-line privacy mode: off, truncate or hash")
+	fs.IntVar(&f.privacyLength, "privacy-length", privacy.DefaultTruncateLength, "Number of characters kept in truncate privacy mode")
+	fs.StringVar(&f.caseID, "case", "", "Incident or case identifier recorded in the report header, every event and the run summaries")
+	fs.StringVar(&f.analyst, "analyst", "", "Analyst running the collection, recorded with -case")
+	fs.StringVar(&f.caseNotes, "notes", "", "Free-text notes about the collection, recorded with -case")
+	fs.Var(f.tags, "tag", "Static key=value label attached to every event and report (repeatable)")
+	fs.StringVar(&f.iisLogs, "iis-logs", "", "Also read the IIS W3C request logs under this directory (e.g. "+iislog.DefaultDir+")")
+	fs.StringVar(&f.groupWatchlist, "group-watchlist", "", "File of additional group names or SIDs whose membership changes are flagged, one per line")
+	fs.StringVar(&f.tagsFile, "tags-file", "", "File of key=value lines with static labels (flags take precedence)")
+	fs.StringVar(&f.sinkURL, "sink", "", "Also send events to this network sink (http:// or https:// URL)")
+	fs.StringVar(&f.sinkSpool, "sink-spool", "", "Directory used to spool events while the sink is unreachable")
+	fs.IntVar(&f.sinkBatch, "sink-batch", sink.DefaultOptions().BatchSize, "Initial number of events per sink request")
+	fs.BoolVar(&f.sinkGzip, "sink-gzip", true, "Compress sink requests with gzip")
+	fs.BoolVar(&f.spoolEncrypt, "spool-encrypt", true, "Encrypt spooled events with the machine-bound DPAPI key")
+	fs.Int64Var(&f.spoolMaxMB, "spool-max-mb", sink.DefaultOptions().Spool.MaxBytes>>20, "Maximum spool size in MB; oldest batches are evicted first (0 = unlimited)")
+	fs.StringVar(&f.otlpEndpoint, "otlp-endpoint", "", "Export spans per channel collection and event, detection and error counters to this OTLP/HTTP receiver (e.g. http://otel-collector:4318)")
+	fs.DurationVar(&f.otlpInterval, "otlp-interval", telemetry.DefaultInterval, "How often telemetry is exported to -otlp-endpoint")
+	fs.StringVar(&f.otlpHeadersFile, "otlp-headers-file", "", "File of NAME=VALUE header lines sent with every -otlp-endpoint request, e.g. an API key; headers can also be set in DATN_OTLP_HEADERS as NAME=VALUE,NAME=VALUE")
+	fs.DurationVar(&f.followInterval, "interval", 30*time.Second, "Polling interval in follow mode")
+	fs.StringVar(&f.checkpointFile, "checkpoint", "datn-checkpoints.json", "Checkpoint file, or registry key such as HKLM\\SOFTWARE\\datn\\Checkpoints, recording the last collected record per channel in follow and -incremental mode")
+	fs.DurationVar(&f.channelTimeout, "channel-timeout", 0, "Longest a channel may be read before it is reported as partial with the events read so far; a channel's timeout in the -config file overrides it (0 = no limit)")
+	fs.BoolVar(&f.force, "force", false, "Run even when another follow or -incremental run uses the same -checkpoint")
+	fs.DurationVar(&f.drainTimeout, "drain-timeout", 15*time.Second, "Maximum time to flush the sink when follow mode is stopped")
+	fs.DurationVar(&f.serviceDrift, "service-drift", 0, "In follow mode, re-list the services this often and alert when a service's binary path or hash changes (0 = off)")
+	fs.StringVar(&f.healthFile, "health-file", defaultHealthFile, "Status file written in follow mode and read by the health command")
+	fs.StringVar(&f.triggersFile, "triggers", "", "File of \"name: expression => actions\" lines that snapshot services, tasks or autoruns, or hash a file named by the event, when a matching event arrives in follow mode")
+	fs.StringVar(&f.triggerOut, "trigger-out", trigger.DefaultOutput, "JSONL file the results of -triggers are appended to")
+	fs.StringVar(&f.healthAddr, "health-addr", "", "Serve /healthz, and /events from the -store, on this address in follow mode (e.g. 127.0.0.1:8089)")
+	fs.StringVar(&f.apiCert, "api-cert", "", "Serve the -health-addr listener over TLS with this certificate (PEM)")
+	fs.StringVar(&f.apiKey, "api-key", "", "Private key (PEM) of -api-cert")
+	fs.StringVar(&f.apiClientCA, "api-client-ca", "", "Require client certificates issued by this CA (PEM) on the -health-addr listener")
+	fs.StringVar(&f.apiTokens, "api-tokens", "", "File of API tokens accepted as \"Authorization: Bearer\" on the -health-addr listener, one per line")
+	fs.StringVar(&f.apiPolicy, "api-policy", "", "File of \"client certificate CN: operations\" lines restricting what each controller may invoke (requires -api-client-ca)")
+	fs.Var(&f.apiAllow, "api-allow", "Client IP address or CIDR range allowed to use the -health-addr listener (repeatable)")
+	fs.Var(&f.filterExprs, "filter", "Only keep events matching this expression, e.g. 'event.id == 4688 && event.data.CommandLine.contains(\"-enc\")' (repeatable)")
+	fs.StringVar(&f.rulesFile, "rules", "", "File of \"name: expression\" detection rules; matching events are marked in the output")
+	fs.StringVar(&f.sigmaRules, "sigma", "", "Sigma rule file (.yml) or directory of rules evaluated against every event; matching events are marked with the rule titles")
+	fs.BoolVar(&f.sigmaOnly, "sigma-only", false, "Only keep events matched by a -sigma rule")
+	fs.BoolVar(&f.indexCrashes, "crashes", false, "Index the crash dumps (Minidump, LiveKernelReports) and WER reports of the computer, list them in the summary and link them to Application Error 1000 events")
+	fs.StringVar(&f.messageLocale, "message-locale", "", "Render event messages in this locale (e.g. en-US or 1033) regardless of the OS language; empty renders them in the OS language with -messages")
+	fs.BoolVar(&f.renderMessages, "messages", true, "Render the description of local events from their sources' message files, like Event Viewer, when -message-locale is not set")
+	fs.StringVar(&f.fieldMap, "field-map", "", "File of \"channel event-id: name1, name2, ...\" lines naming the insertion strings of legacy providers")
+	fs.Var(&f.sampleRules, "sample", "Sampling rule CHANNEL[:EVENTID]=1/N (keep one in N) or CHANNEL[:EVENTID]=N/s|m|h (rate cap), e.g. 'Security:5156=1/50' (repeatable)")
+	fs.StringVar(&f.storeDir, "store", "", "Also save collected events to this local store directory for the query command")
+	fs.IntVar(&f.storeMaxDays, "store-max-days", 0, "Remove store segments older than this many days (0 = keep forever)")
+	fs.BoolVar(&f.learnAllowlist, "allowlist", false, "Learn the executables of process creation events (4688, Sysmon 1) into an allowlist in the -store, then flag those first seen after the baseline")
+	fs.DurationVar(&f.allowlistBaseline, "allowlist-baseline", allowlist.DefaultBaseline, "How long -allowlist learns before flagging new executables; set when the allowlist is created")
+	fs.Int64Var(&f.storeMaxMB, "store-max-mb", 0, "Keep the store below this size in MB by removing the oldest segments (0 = unlimited)")
+	fs.StringVar(&f.diagDir, "diag-dir", diag.DefaultDir(), "Directory where diagnostic bundles are written after a recovered crash")
+	fs.StringVar(&f.server, "server", "", "Collect from this remote computer instead of the local one")
+	fs.StringVar(&f.eventAPI, "api", eventlog.APIAuto, "Event log API: auto (legacy API for classic logs, wevtapi for manifest-based channels), or legacy or wevtapi to force one for debugging")
+	fs.StringVar(&f.transport, "transport", eventlog.TransportAuto, "Remote transport: rpc, winrm, or auto (RPC with WinRM fallback when RPC is blocked)")
+	fs.StringVar(&f.outDir, "outdir", "", "Directory run directories are created in (default: the current directory); fleet runs are laid out as <outdir>/<host>/<timestamp>/ (default: datn-fleet)")
+	fs.StringVar(&f.runasAccount, "runas", "", "Collect as DOMAIN\\user for remote calls (password from DATN_RUNAS_PASSWORD)")
+	fs.BoolVar(&f.skipSelfCheck, "skip-self-check", false, "Skip the startup integrity and permission checks")
+	fs.BoolVar(&f.enableCmdlineAudit, "enable-cmdline-audit", false, "Turn on process creation auditing with command lines (4688) when it is off")
+	fs.BoolVar(&f.requireIntegrity, "require-integrity", false, "Refuse to run unless the binary matches its signed manifest")
+	if !monitor {
+		fs.IntVar(&f.maxEvents, "max", 100, "Maximum number of events to collect per channel")
+		fs.IntVar(&f.domainRows, "domains", 25, "Rows of the queried-domains table built from DNS Client and Sysmon 22 events (0 = all)")
+		fs.StringVar(&f.sinceFlag, "since", "", "Only collect events from this far back, e.g. 36h or 7d; channels that retain less are reported")
+		fs.StringVar(&f.cacheDir, "cache", "", "Cache one-shot reads in this directory and reuse them when a later run's window overlaps (not with -privacy, as cached events are unredacted)")
+		fs.BoolVar(&f.aggregate, "aggregate", false, "Report identical events (same channel, event ID, source and message) once per channel with their count and first and last times; the sink and store still receive every event")
+		fs.Int64Var(&f.maxOutputMB, "max-output-size", defaultMaxOutputMB, "Estimated report size in MB above which collection asks for confirmation at a console, or fails when this flag is set (0 = no limit)")
+		fs.StringVar(&f.rawBundle, "raw-bundle", "", "Write unredacted events to this encrypted bundle file (requires DATN_RAW_KEY)")
+		fs.StringVar(&f.vhdPath, "vhd", "", "Also package the run directory into a fixed-size VHD at this path, for evidence procedures that require disk-image containers (requires administrator)")
+		fs.BoolVar(&f.follow, "follow", false, "Keep running and collect new events continuously (daemon mode)")
+		fs.DurationVar(&f.runTimeout, "timeout", 0, "Longest the run may spend reading channels; channels not read by then are reported as skipped (0 = no limit)")
+		fs.BoolVar(&f.incremental, "incremental", false, "Only collect the events logged since the previous -incremental run, as recorded in the -checkpoint file")
+		fs.StringVar(&f.sarifFile, "sarif", "", "Also write the detections of the run to this SARIF 2.1.0 file, with hosts as artifacts and detections as results")
+		fs.StringVar(&f.hostList, "hosts", "", "Collect from several remote computers in one run: comma-separated names or @FILE with one name per line")
+		fs.BoolVar(&f.inventory, "inventory", false, "In fleet runs, also save each host's services, scheduled tasks, autoruns, COM hijacks and IFEO debuggers with binary hashes for the aggregate command")
+		fs.StringVar(&f.discoverOU, "discover-ou", "", "Collect from the reachable enabled computers below this AD OU (e.g. \"OU=Servers,DC=corp,DC=example,DC=com\")")
+		fs.StringVar(&f.discoverDC, "discover-dc", "", "Domain controller queried by -discover-ou (default: any DC of the current domain)")
+		fs.DurationVar(&f.discoverTimeout, "discover-timeout", 2*time.Second, "Port check timeout for discovered computers")
+		fs.IntVar(&f.discoverParallel, "discover-parallel", 32, "Number of discovered computers port-checked concurrently")
+		fs.BoolVar(&f.interactive, "interactive", false, "List the channels with their record counts and prompt for the channels, time range, format and output file")
+	}
+
+	fs.Usage = func() {
+		if monitor {
+			fmt.Fprintf(fs.Output(), "Usage: %s monitor [flags]\n\n", os.Args[0])
+		} else {
+			fmt.Fprintf(fs.Output(), "Usage: %s [collect] [flags]\n\n", os.Args[0])
+		}
+		fs.PrintDefaults()
+	}
+	return fs, f
+}
+
+// flagSetting returns the value of a flag as recorded in the audit log and crash
+// bundles, with the user information of URLs masked
+func flagSetting(fl *flag.Flag) string {
+	value := fl.Value.String()
+	switch fl.Name {
+	case "sink", "otlp-endpoint":
+		// The user name of a URL is as often a token as the password
+		if u, err := url.Parse(value); err == nil && u.User != nil {
+			u.User = url.User("xxxxx")
+			return u.String()
+		}
+	}
+	return value
+}
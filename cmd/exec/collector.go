@@ -0,0 +1,739 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/allowlist"
+	"lemita/datn/pkg/audit"
+	"lemita/datn/pkg/boot"
+	"lemita/datn/pkg/cache"
+	"lemita/datn/pkg/config"
+	"lemita/datn/pkg/crashes"
+	"lemita/datn/pkg/dedup"
+	"lemita/datn/pkg/detect"
+	"lemita/datn/pkg/diag"
+	"lemita/datn/pkg/domains"
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/filter"
+	"lemita/datn/pkg/findings"
+	"lemita/datn/pkg/formatter"
+	"lemita/datn/pkg/groups"
+	"lemita/datn/pkg/iislog"
+	"lemita/datn/pkg/privacy"
+	"lemita/datn/pkg/privileges"
+	"lemita/datn/pkg/runas"
+	"lemita/datn/pkg/sampling"
+	"lemita/datn/pkg/sarif"
+	"lemita/datn/pkg/servicedrift"
+	"lemita/datn/pkg/sink"
+	"lemita/datn/pkg/store"
+	"lemita/datn/pkg/telemetry"
+	"lemita/datn/pkg/trigger"
+	"lemita/datn/pkg/wfp"
+)
+
+// abandonGrace is how long a channel read may run past its deadline before it is
+// abandoned as hung
+const abandonGrace = 10 * time.Second
+
+// errRunTimeout marks the channels not read because the run timeout was reached
+var errRunTimeout = errors.New("the run timeout was reached")
+
+// collector holds the state shared by one-shot and follow collection
+type collector struct {
+	output      io.StringWriter
+	tags        config.Tags
+	privacyOpts privacy.Options
+	bundle      *privacy.RawBundle // nil when no raw bundle is written
+	sink        sink.Sink          // nil when no network sink is configured
+	store       *store.Store       // nil when events are not saved locally
+	filters     []*filter.Expression
+	rules       []filter.Rule
+	sampler     *sampling.Sampler         // nil when no sampling rules are configured
+	domains     *domains.Table            // Unique domains of DNS query events; nil when not tracked
+	wfpFilters  *wfp.Resolver             // Resolves the filters of WFP drop events; nil when not resolved
+	blocked     *wfp.Report               // WFP drops by filter; nil when not tracked
+	boots       *boot.Timeline            // Startups, shutdowns and boot times; nil when not tracked
+	crashes     *crashes.Index            // Crash dumps and WER reports linked to crash events; nil when not indexed
+	groups      *groups.Tracker           // Membership changes of watched groups; nil when not tracked
+	privileged  *privileges.Tracker       // Special privileges and explicit credentials per account; nil when not tracked
+	findings    *findings.Collector       // Security-relevant configuration changes; nil when not analyzed
+	allowlist   *allowlist.List           // Executables learned from process creation events; nil without -allowlist
+	iis         *iislog.Reader            // Reads IIS request logs into the pipeline; nil when disabled
+	services    *servicedrift.Monitor     // Compares service snapshots in follow mode; nil when disabled
+	parallel    int                       // Channels read concurrently by collectChannels; 1 or less reads one at a time
+	cache       *cache.Cache              // Earlier one-shot reads reused by overlapping windows; nil when disabled
+	checkpoints *eventlog.Checkpoints     // Last record per channel of -incremental runs; nil when every run reads the whole window
+	locale      string                    // Locale event messages are rendered in; empty for insertion strings only
+	api         string                    // Event log API forced with -api; eventlog.APIAuto probes each channel
+	eventsOut   io.StringWriter           // Receives the events with -format json, csv or html; nil for the text report
+	format      string                    // Format written to eventsOut, formatter.JSONFormat, formatter.CSVFormat or formatter.HTMLFormat
+	html        *formatter.HTMLWriter     // Writes the sections of -format html to eventsOut; nil for other formats
+	triggers    *trigger.Runner           // Collects artifacts when matching events arrive in follow mode; nil when not configured
+	messages    *eventlog.MessageRenderer // Renders messages of RPC reads in locale; nil when not rendering
+	files       *eventlog.MessageFiles    // Renders messages of local reads from message files; nil when not rendering
+	render      bool                      // Render messages from message files when no locale is set
+	audit       *audit.Log                // Append-only log of the collector's own actions; nil when disabled
+	identity    *runas.Identity           // Credentials for remote calls; nil uses the current user
+	server      string                    // Remote computer to collect from (empty = local)
+	transport   string                    // Remote transport: auto, rpc or winrm
+	since       time.Time                 // Start of the one-shot collection window (zero = no limit)
+	memoryLimit int64                     // Bytes of events a read keeps in memory before spilling (0 = no limit)
+	spillDir    string                    // Directory of spill files (empty = the system temporary directory)
+
+	coverageGaps   []eventlog.Coverage     // Channels that no longer retain the start of the window
+	timedOut       []string                // Channels cut short by their timeout or the run timeout
+	aggregated     *dedup.Table            // Identical events grouped for -aggregate; nil when events are written one by one
+	channelTimeout time.Duration           // Default longest read of a channel (0 = no limit)
+	levels         []uint16                // Only collect events of these types (empty = all)
+	sigma          *detect.Engine          // Sigma rules marking matching events; nil when not loaded
+	sigmaOnly      bool                    // Drop the events no Sigma rule matched
+	sarif          *sarif.Report           // Detections exported with -sarif; nil when not exported
+	telemetry      *telemetry.Telemetry    // Spans and counters exported with -otlp-endpoint; nil when not instrumented
+	runSpan        *telemetry.Span         // Parent of the channel spans of a one-shot run; nil starts a trace per channel
+	caseInfo       *eventlog.Case          // Incident recorded on every event and summary; nil without -case
+	runDeadline    time.Time               // When the run stops reading channels (zero = no limit)
+	timings        []eventlog.StageTimings // Per-channel stage timings of the one-shot or fleet run
+	verbose        bool                    // Print the stage timings of every channel
+
+	// Per-host run outputs in fleet mode
+	events     *json.Encoder  // JSONL copy of the processed events; nil when not saved
+	detections map[string]int // Detection rule hit counts; nil when not counted
+
+	inventory bool // Save each fleet host's services, scheduled tasks and autoruns
+
+	// Crash diagnostics
+	diagDir     string
+	recentLines *diag.Ring
+	settings    map[string]string // Snapshot of the effective configuration
+}
+
+// guard runs fn and recovers from a panic so one malformed record can't take down
+// collection of the other channels. A diagnostic bundle is written for every panic.
+// It reports whether fn completed normally.
+func (c *collector) guard(context string, fn func()) bool {
+	return c.guardTo(context, c.output, fn)
+}
+
+// guardTo is guard writing the panic message to out, for goroutines that must not
+// write to the shared report
+func (c *collector) guardTo(context string, out io.StringWriter, fn func()) (ok bool) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		ok = false
+
+		var lines []string
+		if c.recentLines != nil {
+			lines = c.recentLines.Lines()
+		}
+		bundle := diag.NewBundle(context, recovered, c.settings, lines)
+		path, err := bundle.Write(c.diagDir)
+		if err != nil {
+			out.WriteString(fmt.Sprintf("Recovered from panic in %s: %v (failed to write diagnostic bundle: %v)\n", context, recovered, err))
+			return
+		}
+		out.WriteString(fmt.Sprintf("Recovered from panic in %s: %v (diagnostic bundle: %s)\n", context, recovered, path))
+	}()
+
+	fn()
+	return true
+}
+
+// collect reads a channel, impersonating the -runas identity for the duration of the call
+func (c *collector) collect(channel string, opts eventlog.CollectOptions) (*eventlog.CollectResult, error) {
+	if opts.Deadline.IsZero() {
+		return c.collectNow(channel, opts)
+	}
+
+	// The readers stop at the deadline with what they have, but a call that hangs,
+	// such as an RPC to an unresponsive host, never returns to check it. Such a
+	// read is abandoned and left to finish in the background. The read runs outside
+	// the caller's guard, so a panic in it is recovered here and returned as an error.
+	type collected struct {
+		result *eventlog.CollectResult
+		err    error
+	}
+	done := make(chan collected, 1)
+	go func() {
+		var read collected
+		var log strings.Builder
+		if !c.guardTo(channel, &log, func() {
+			read.result, read.err = c.collectNow(channel, opts)
+		}) {
+			read.err = errors.New(strings.TrimSpace(log.String()))
+		}
+		done <- read
+	}()
+	timer := time.NewTimer(time.Until(opts.Deadline) + abandonGrace)
+	defer timer.Stop()
+	select {
+	case read := <-done:
+		return read.result, read.err
+	case <-timer.C:
+		go func() {
+			if read := <-done; read.result != nil {
+				read.result.Close()
+			}
+		}()
+		return &eventlog.CollectResult{LastRecord: opts.AfterRecord, TimedOut: true}, fmt.Errorf("%s did not respond within its timeout; the read was abandoned", channel)
+	}
+}
+
+// channelDeadline returns when a read of a channel started now must stop: after
+// the channel's timeout, the default channel timeout, or at the end of the run,
+// whichever comes first (zero = no limit)
+func (c *collector) channelDeadline(channelConfig config.ChannelConfig) time.Time {
+	deadline := c.runDeadline
+	timeout := channelConfig.Timeout
+	if timeout == 0 {
+		timeout = c.channelTimeout
+	}
+	if timeout > 0 {
+		if channelEnd := time.Now().Add(timeout); deadline.IsZero() || channelEnd.Before(deadline) {
+			deadline = channelEnd
+		}
+	}
+	return deadline
+}
+
+// collectNow reads a channel through the configured transport
+func (c *collector) collectNow(channel string, opts eventlog.CollectOptions) (*eventlog.CollectResult, error) {
+	opts.MemoryLimit = c.memoryLimit
+	opts.SpillDir = c.spillDir
+	opts.Locale = c.locale
+	opts.API = c.api
+	if c.server == "" {
+		var result *eventlog.CollectResult
+		err := c.identity.Do(func() error {
+			var err error
+			result, err = eventlog.CollectWithOptions(channel, opts)
+			return err
+		})
+		return result, err
+	}
+
+	// WinRM runs in a PowerShell child process, which doesn't inherit thread
+	// impersonation, so the -runas account is passed as an explicit credential
+	var cred *eventlog.Credential
+	if c.identity != nil {
+		cred = &eventlog.Credential{User: c.identity.String(), Password: c.identity.Password()}
+	}
+
+	opts.Server = c.server
+	var result *eventlog.CollectResult
+	err := c.identity.Do(func() error {
+		var err error
+		result, err = eventlog.CollectRemote(channel, opts, c.transport, cred)
+		return err
+	})
+	return result, err
+}
+
+// collectCached reads a channel through the result cache: when an earlier run
+// cached the window and the log still holds the records it read, only the records
+// logged since are read and merged with the cached events. Cache messages go to out.
+func (c *collector) collectCached(channel string, opts eventlog.CollectOptions, out io.StringWriter) (*eventlog.CollectResult, error) {
+	if c.cache == nil {
+		return c.collect(channel, opts)
+	}
+	host := c.host()
+	entry, cached, err := c.cache.Load(host, channel, opts.EventIDs, opts.Since)
+	if err != nil {
+		out.WriteString(fmt.Sprintf("Cache: %v\n", err))
+	}
+	if entry != nil {
+		var state eventlog.LogState
+		err := c.identity.Do(func() error {
+			var err error
+			state, err = eventlog.ProbeLog(c.server, channel, entry.ProbeRecord)
+			return err
+		})
+		if err != nil || !entry.Valid(state) {
+			out.WriteString(fmt.Sprintf("Cache: %s changed since %s, reading it again\n", channel, entry.Saved.Format(time.RFC3339)))
+			entry = nil
+		}
+	}
+
+	if entry != nil {
+		incremental := opts
+		incremental.AfterRecord = entry.LastRecord
+		result, err := c.collect(channel, incremental)
+		if err != nil {
+			return result, err
+		}
+		if result.Spill == nil {
+			// Drop cached events that fall before this run's window
+			events := make([]eventlog.EventLogData, 0, len(cached)+len(result.Events))
+			for _, event := range cached {
+				if opts.Since.IsZero() || int64(event.TimeGenerated) >= opts.Since.Unix() {
+					events = append(events, event)
+				}
+			}
+			out.WriteString(fmt.Sprintf("Cache: reused %d events of %s, read %d new\n", len(events), channel, len(result.Events)))
+			result.Events = append(events, result.Events...)
+			if opts.MaxEvents > 0 && len(result.Events) > opts.MaxEvents {
+				result.Events = result.Events[:opts.MaxEvents]
+			} else if err := c.cache.Save(host, channel, opts.EventIDs, entry.Since, result.LastRecord, result.Events); err != nil {
+				out.WriteString(fmt.Sprintf("Cache: %v\n", err))
+			}
+			return result, nil
+		}
+		// Too many new events to merge in memory; read the whole window instead
+		result.Close()
+	}
+
+	result, err := c.collect(channel, opts)
+	if err != nil {
+		return result, err
+	}
+	// Reads cut short by -max or spilled to disk don't hold the whole window
+	if result.Spill == nil && (opts.MaxEvents == 0 || len(result.Events) < opts.MaxEvents) {
+		if err := c.cache.Save(host, channel, opts.EventIDs, opts.Since, result.LastRecord, result.Events); err != nil {
+			out.WriteString(fmt.Sprintf("Cache: %v\n", err))
+		}
+	}
+	return result, nil
+}
+
+// channelRead is the outcome of reading one channel, held until the channel's turn
+// to be handled
+type channelRead struct {
+	result *eventlog.CollectResult
+	err    error
+	log    strings.Builder // Messages of the read, written out with the channel's other output
+	ok     bool            // false when the read panicked
+}
+
+// readChannel reads one channel of a collection pass
+func (c *collector) readChannel(channelConfig config.ChannelConfig, maxEvents int) *channelRead {
+	read := &channelRead{}
+	if !c.runDeadline.IsZero() && time.Now().After(c.runDeadline) {
+		read.ok = true
+		read.err = errRunTimeout
+		return read
+	}
+	// Reads may run concurrently, so a panic is reported in the read's own log
+	read.ok = c.guardTo(channelConfig.Name, &read.log, func() {
+		read.result, read.err = c.collectCached(channelConfig.Name, eventlog.CollectOptions{
+			MaxEvents:   maxEvents,
+			EventIDs:    channelConfig.EventIDs,
+			Levels:      c.levels,
+			AfterRecord: c.checkpoints.Get(c.checkpointKey(channelConfig.Name)),
+			Since:       c.since,
+			Deadline:    c.channelDeadline(channelConfig),
+		}, &read.log)
+	})
+	return read
+}
+
+// readChannels starts reading the channels c.parallel at a time and returns the
+// reads in channel order. At most c.parallel reads are held at once: a channel is
+// only read once an earlier one has been handled and released with done, which
+// bounds the events kept in memory.
+func (c *collector) readChannels(channels []config.ChannelConfig, maxEvents int) (reads []chan *channelRead, done func()) {
+	reads = make([]chan *channelRead, len(channels))
+	for i := range reads {
+		reads[i] = make(chan *channelRead, 1)
+	}
+	slots := make(chan struct{}, c.parallel)
+	go func() {
+		for i, channelConfig := range channels {
+			slots <- struct{}{}
+			go func() {
+				reads[i] <- c.readChannel(channelConfig, maxEvents)
+			}()
+		}
+	}()
+	return reads, func() { <-slots }
+}
+
+// collectChannels runs one collection pass over the channels and returns the number
+// of events collected and of channels that failed. With c.parallel above 1, that
+// many channels are read concurrently while their events are still handled and
+// written one channel at a time, in channel order.
+func (c *collector) collectChannels(channels []config.ChannelConfig, maxEvents int) (collected, failed int) {
+	var reads []chan *channelRead
+	done := func() {}
+	if c.parallel > 1 {
+		reads, done = c.readChannels(channels, maxEvents)
+	}
+
+	for i, channelConfig := range channels {
+		var read *channelRead
+		if reads != nil {
+			read = <-reads[i]
+		}
+		span := c.telemetry.StartSpan("collect "+channelConfig.Name, c.runSpan)
+		span.SetAttribute("channel", channelConfig.Name)
+		span.SetAttribute("host", c.host())
+		// A panic while collecting one channel must not stop the others
+		ok := c.guard(channelConfig.Name, func() {
+			collectionMsg := fmt.Sprintf("\nCollecting logs from %s channel (Purpose: %s)...\n",
+				channelConfig.Name, channelConfig.Purpose)
+			c.output.WriteString(collectionMsg)
+
+			// Create event ID list string for display
+			eventIDStrings := make([]string, len(channelConfig.EventIDs))
+			for i, id := range channelConfig.EventIDs {
+				eventIDStrings[i] = strconv.FormatUint(uint64(id), 10)
+			}
+			eventIDsStr := strings.Join(eventIDStrings, ", ")
+			c.output.WriteString(fmt.Sprintf("Looking for Event IDs: %s\n", eventIDsStr))
+
+			// Collect logs, unless they were read in parallel
+			if read == nil {
+				read = c.readChannel(channelConfig, maxEvents)
+			}
+			c.output.WriteString(read.log.String())
+			if !read.ok {
+				span.SetError(fmt.Errorf("read panicked"))
+				failed++
+				return
+			}
+			result, err := read.result, read.err
+			span.SetError(err)
+
+			if errors.Is(err, errRunTimeout) {
+				c.output.WriteString(fmt.Sprintf("Skipped %s: %v\n", channelConfig.Name, err))
+				c.timedOut = append(c.timedOut, channelConfig.Name)
+				failed++
+				return
+			}
+			if result != nil && result.TimedOut {
+				c.timedOut = append(c.timedOut, channelConfig.Name)
+			}
+			if err != nil {
+				errMsg := fmt.Sprintf("Error collecting logs from %s: %v\n", channelConfig.Name, err)
+				c.output.WriteString(errMsg)
+				c.recordAudit(audit.ActionReadChannel, "%s on %s failed: %v", channelConfig.Name, c.host(), err)
+				c.telemetry.Add(telemetry.ChannelErrors, 1, "channel", channelConfig.Name)
+				failed++
+				return
+			}
+			c.warnReset(channelConfig.Name, c.checkpoints.Get(c.checkpointKey(channelConfig.Name)), result)
+			span.SetAttribute("events", result.Len())
+			span.SetAttribute("timed_out", result.TimedOut)
+			c.recordAudit(audit.ActionReadChannel, "%s on %s: %d events up to record %d", channelConfig.Name, c.host(), result.Len(), result.LastRecord)
+			// Report a log that rolled over inside the requested window instead of
+			// silently returning a shorter span
+			if coverage := result.Coverage(channelConfig.Name, c.since); coverage.Gap() {
+				c.output.WriteString(fmt.Sprintf("Coverage gap: %s\n", coverage))
+				c.coverageGaps = append(c.coverageGaps, coverage)
+			}
+
+			if result.TimedOut {
+				c.output.WriteString(fmt.Sprintf("Timed out: partial results of %d events up to record %d\n", result.Len(), result.LastRecord))
+			}
+			timings, err := c.handleResult(channelConfig.Name, result)
+			c.writeAggregated(channelConfig.Name)
+			c.timings = append(c.timings, timings)
+			c.printTimings(timings)
+			collected += result.Len()
+			// Not advancing the checkpoint reads undelivered events again next run
+			if err == nil {
+				c.checkpoints.Set(c.checkpointKey(channelConfig.Name), result.LastRecord)
+			}
+		})
+		done()
+		if !ok {
+			span.SetError(fmt.Errorf("collection panicked"))
+			failed++
+		}
+		span.End()
+	}
+	return collected, failed
+}
+
+// handleResult hands the events of a read to handleEvents, batch by batch when they
+// were spilled to disk, removes the spill file and returns the read's stage timings.
+// The error reports events that were not delivered, because the sink failed or a
+// spilled batch couldn't be read back; the checkpoint must not move past them.
+func (c *collector) handleResult(channel string, result *eventlog.CollectResult) (eventlog.StageTimings, error) {
+	defer result.Close()
+	if result.Spill != nil {
+		c.output.WriteString(fmt.Sprintf("%d events from %s exceeded the memory limit and were spilled to %s\n",
+			result.Len(), channel, result.Spill.Path()))
+	}
+
+	timings := result.Timings
+	var sinkErr error
+	err := result.Each(func(batch []eventlog.EventLogData) {
+		if c.messages != nil {
+			start := time.Now()
+			err := c.identity.Do(func() error {
+				return c.messages.Render(channel, batch)
+			})
+			if err != nil {
+				c.output.WriteString(fmt.Sprintf("Warning: failed to render messages from %s: %v\n", channel, err))
+			}
+			timings.Format += time.Since(start)
+		}
+		if c.files != nil {
+			start := time.Now()
+			c.files.Render(channel, batch)
+			timings.Format += time.Since(start)
+		}
+		handled, err := c.handleEvents(channel, batch)
+		timings.Format += handled.Format
+		timings.Write += handled.Write
+		if sinkErr == nil {
+			sinkErr = err
+		}
+	})
+	if err != nil {
+		c.output.WriteString(fmt.Sprintf("Error reading spilled events from %s: %v\n", channel, err))
+		return timings, err
+	}
+	return timings, sinkErr
+}
+
+// checkpointKey returns the checkpoint name of a channel of the computer being
+// collected from
+func (c *collector) checkpointKey(channel string) string {
+	return eventlog.CheckpointKey(c.server, channel)
+}
+
+// warnReset reports a read that found its channel cleared since the checkpoint
+func (c *collector) warnReset(channel string, afterRecord uint32, result *eventlog.CollectResult) {
+	if result != nil && result.Reset {
+		c.output.WriteString(fmt.Sprintf("Warning: %s was cleared since its checkpoint at record %d; read it from the oldest record\n", channel, afterRecord))
+	}
+}
+
+// host returns the computer being collected from
+func (c *collector) host() string {
+	if c.server != "" {
+		return c.server
+	}
+	return eventlog.GetLocalComputerName()
+}
+
+// runTriggers collects the artifacts the triggers ask for when events match them,
+// while the files the events refer to are most likely still in place
+func (c *collector) runTriggers(channel string, logs []eventlog.EventLogData) {
+	if c.triggers == nil {
+		return
+	}
+	var results []trigger.Result
+	err := c.identity.Do(func() error {
+		var err error
+		results, err = c.triggers.Run(c.server, channel, logs)
+		return err
+	})
+	for _, result := range results {
+		c.output.WriteString(result.String() + "\n")
+		c.recordAudit(audit.ActionInventory, "trigger %s ran %s on %s for %s record %d", result.Trigger, result.Action, c.host(), channel, result.RecordNumber)
+	}
+	if err != nil {
+		c.output.WriteString(fmt.Sprintf("Error running triggers for %s: %v\n", channel, err))
+	}
+}
+
+// openMessages starts rendering the messages of c.server's events in c.locale.
+// WinRM reads come back already rendered, so that transport needs no renderer.
+// Without a locale, the events of the local computer are rendered from their
+// sources' message files in its display language.
+func (c *collector) openMessages() error {
+	if c.locale == "" {
+		if c.render && c.server == "" {
+			c.files = eventlog.NewMessageFiles()
+		}
+		return nil
+	}
+	if c.transport == eventlog.TransportWinRM {
+		return nil
+	}
+	var err error
+	c.messages, err = eventlog.NewMessageRenderer(c.server, c.locale)
+	return err
+}
+
+// closeMessages stops rendering messages
+func (c *collector) closeMessages() {
+	c.messages.Close()
+	c.messages = nil
+	c.files.Close()
+	c.files = nil
+}
+
+// recordAudit appends an action to the audit log, reporting a failed write
+func (c *collector) recordAudit(action, format string, args ...any) {
+	if err := c.audit.Record(action, format, args...); err != nil {
+		c.output.WriteString(fmt.Sprintf("Error writing audit log: %v\n", err))
+	}
+}
+
+// printTimings writes a channel's stage timings in verbose mode
+func (c *collector) printTimings(timings eventlog.StageTimings) {
+	if c.verbose {
+		c.output.WriteString(fmt.Sprintf("Timings for %s: %s\n", timings.Channel, timings))
+	}
+}
+
+// handleEvents filters, tags, redacts, ships, saves and writes the events collected
+// from a channel, returning the time spent formatting and writing them and whether
+// the sink failed to take them, in which case they must be read again
+func (c *collector) handleEvents(channel string, logs []eventlog.EventLogData) (timings eventlog.StageTimings, sinkErr error) {
+	c.telemetry.Add(telemetry.EventsCollected, len(logs), "channel", channel)
+
+	// Custom filters and detections see the unredacted event
+	logs = filter.Apply(logs, c.filters, c.rules)
+	logs = c.sigma.Apply(logs, c.sigmaOnly)
+	c.runTriggers(channel, logs)
+	c.groups.Add(logs)
+	c.privileged.Add(logs)
+	c.findings.Add(logs)
+	c.boots.Add(logs)
+	if err := c.allowlist.Add(logs); err != nil {
+		c.output.WriteString(fmt.Sprintf("Error saving allowlist: %v\n", err))
+	}
+
+	// Thin out noisy event IDs before they reach the sink
+	logs = c.sampler.Apply(channel, logs)
+
+	// Query names are aggregated before privacy redaction
+	c.domains.Add(logs)
+
+	// Filter IDs are only meaningful while the policy that assigned them is loaded
+	if err := c.wfpFilters.Annotate(logs); err != nil {
+		c.output.WriteString(fmt.Sprintf("Warning: failed to resolve WFP filters in %s: %v\n", channel, err))
+	}
+	c.blocked.Add(logs)
+
+	// Report paths are linked before privacy redaction can rewrite the crash events
+	c.crashes.Correlate(logs)
+
+	// Attach the static tags and the case to every event
+	if len(c.tags) > 0 {
+		for i := range logs {
+			logs[i].Tags = c.tags
+		}
+	}
+	if c.caseInfo != nil {
+		for i := range logs {
+			logs[i].Case = c.caseInfo
+		}
+	}
+
+	// Keep the unredacted events only in the encrypted bundle
+	if c.bundle != nil {
+		c.bundle.Add(channel, logs)
+	}
+	logs = privacy.Apply(channel, logs, c.privacyOpts)
+
+	// Name the insertion strings after redaction so structured output never carries raw values
+	for i := range logs {
+		logs[i].Fields = eventlog.NamedData(channel, logs[i])
+	}
+
+	start := time.Now()
+	if c.sink != nil {
+		if sinkErr = c.sink.Write(channel, logs); sinkErr != nil {
+			c.output.WriteString(fmt.Sprintf("Error sending logs from %s to sink: %v\n", channel, sinkErr))
+			c.telemetry.Add(telemetry.SinkErrors, 1, "channel", channel)
+		}
+	}
+
+	if c.store != nil {
+		if err := c.store.Append(logs); err != nil {
+			c.output.WriteString(fmt.Sprintf("Error saving logs from %s to store: %v\n", channel, err))
+		}
+	}
+
+	if c.events != nil {
+		for _, event := range logs {
+			if err := c.events.Encode(event); err != nil {
+				c.output.WriteString(fmt.Sprintf("Error saving events from %s: %v\n", channel, err))
+				break
+			}
+		}
+	}
+	timings.Write = time.Since(start)
+	c.sarif.Add(c.host(), logs)
+	if c.telemetry != nil {
+		for _, event := range logs {
+			for _, name := range event.Detections {
+				c.telemetry.Add(telemetry.Detections, 1, "rule", name)
+			}
+		}
+	}
+	if c.detections != nil {
+		for _, event := range logs {
+			for _, name := range event.Detections {
+				c.detections[name]++
+			}
+		}
+	}
+
+	// In aggregate mode the groups are written once the whole channel has been read
+	if c.aggregated != nil {
+		start = time.Now()
+		c.aggregated.Add(logs)
+		timings.Format = time.Since(start)
+		return timings, sinkErr
+	}
+
+	// Stream the formatted logs to the report; time not spent in writes is formatting
+	start = time.Now()
+	report := &timedWriter{w: c.output}
+	write := formatter.WriteLogChannel
+	if c.eventsOut != nil {
+		report.w = c.eventsOut
+		write = formatter.WriteJSONChannel
+		if c.format == formatter.CSVFormat {
+			write = formatter.WriteCSVChannel
+		}
+		if c.html != nil {
+			write = c.html.WriteChannel
+		}
+	}
+	if err := write(report, channel, logs); err != nil {
+		fmt.Printf("Error writing logs from %s to the report: %v\n", channel, err)
+	}
+	timings.Format = time.Since(start) - report.elapsed
+	timings.Write += report.elapsed
+	return timings, sinkErr
+}
+
+// writeAggregated writes the groups of identical events of a channel in aggregate mode
+func (c *collector) writeAggregated(channel string) {
+	if c.aggregated == nil {
+		return
+	}
+	groups := c.aggregated.Take(channel)
+	var err error
+	switch {
+	case c.eventsOut == nil:
+		err = formatter.WriteAggregatedChannel(c.output, channel, groups)
+	case c.format == formatter.CSVFormat:
+		err = formatter.WriteAggregatedCSV(c.eventsOut, groups)
+	default:
+		err = formatter.WriteAggregatedJSON(c.eventsOut, groups)
+	}
+	if err != nil {
+		fmt.Printf("Error writing logs from %s to the report: %v\n", channel, err)
+	}
+}
+
+// timedWriter measures the time spent writing to the underlying writer
+type timedWriter struct {
+	w       io.StringWriter
+	elapsed time.Duration
+}
+
+// WriteString writes s and adds the time the write took
+func (t *timedWriter) WriteString(s string) (int, error) {
+	start := time.Now()
+	n, err := t.w.WriteString(s)
+	t.elapsed += time.Since(start)
+	return n, err
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// command is a subcommand of the CLI, e.g. datn tasks -json
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// commands are the subcommands in the order help lists them. It is filled in by
+// init because runHelp refers to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"collect", "Collect events into a report (the default when the first argument is a flag)", runCollect},
+		{"monitor", "Collect new events continuously, like collect -follow", runMonitor},
+		{"export", "Write events of the store to a JSON, CSV or HTML file", runExport},
+		{"query", "Filter and print events of the store", runQuery},
+		{"annotate", "Attach labels and notes to events of the store", runAnnotate},
+		{"prune", "Apply a retention policy to the store", runPrune},
+		{"replay", "Feed saved events back through filters, detections and sinks", runReplay},
+		{"services", "List the services with the SHA-256 of their binaries", runServices},
+		{"tasks", "List the scheduled tasks with their actions and triggers", runTasks},
+		{"autoruns", "List the Run keys, Startup folders and Winlogon values", runAutoruns},
+		{"usb", "Report the removable storage devices used", runUSB},
+		{"network", "Report the networks and VPNs connected to", runNetwork},
+		{"offline", "Read the event logs and services of a mounted Windows volume", runOffline},
+		{"triage", "Collect the key evidence of this computer into a ZIP", runTriage},
+		{"aggregate", "Merge saved fleet runs into fleet-wide statistics", runAggregate},
+		{"generate", "Write synthetic test events to a dedicated event log", runGenerate},
+		{"wef", "Set up a Windows Event Forwarding subscription", runWEF},
+		{"config", "Convert channels files or dump the built-in channels", runConfig},
+		{"health", "Check the status of a running collector", runHealth},
+		{"bench", "Measure parser, formatter and pipeline throughput against a baseline", runBench},
+		{"help", "List the commands, or show the flags of one", runHelp},
+	}
+}
+
+// runCommand routes the arguments to their command. Without a command, or when
+// the first argument is a flag, they go to collect, so invocations written before
+// the commands existed keep working.
+func runCommand(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runCollect(args)
+	}
+	if cmd := findCommand(args[0]); cmd != nil {
+		return cmd.run(args[1:])
+	}
+	fmt.Printf("Unknown command %q\n\n", args[0])
+	printCommands()
+	return 2
+}
+
+// findCommand returns the command of a name, or nil
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// runHelp implements the help command: the list of commands, or with a command
+// name the flags of that command
+func runHelp(args []string) int {
+	if len(args) == 0 {
+		printCommands()
+		return 0
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil || cmd.name == "help" {
+		fmt.Printf("Unknown command %q\n\n", args[0])
+		printCommands()
+		return 2
+	}
+	return cmd.run([]string{"-h"})
+}
+
+// printCommands prints the usage line and the commands with their summaries
+func printCommands() {
+	fmt.Printf("Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(table, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	table.Flush()
+	fmt.Printf("\nRun %s help <command> for the flags of a command.\n", os.Args[0])
+}
+
+// runMonitor implements the monitor command: collect -follow, with only the flags
+// continuous collection uses
+func runMonitor(args []string) int {
+	fs, f := newCollectFlags("monitor", true)
+	fs.Parse(args)
+	f.follow = true
+	return collect(fs, f)
+}
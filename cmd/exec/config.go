@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"lemita/datn/pkg/config"
+)
+
+// runConfig implements the config subcommand. "config convert" rewrites a
+// channels file in another format and "config dump-defaults" writes the built-in
+// channels as a starting point for a -config file.
+func runConfig(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "convert":
+			return runConfigConvert(args[1:])
+		case "dump-defaults":
+			return runConfigDumpDefaults(args[1:])
+		}
+	}
+	fmt.Printf("Usage: %s config convert|dump-defaults [flags]\n", os.Args[0])
+	return 2
+}
+
+// runConfigConvert implements config convert
+func runConfigConvert(args []string) int {
+	fs := flag.NewFlagSet("config convert", flag.ExitOnError)
+	in := fs.String("in", "", "Channels file to convert; its format is taken from the extension or content")
+	out := fs.String("out", "", "Write the converted file here (default: stdout)")
+	to := fs.String("to", "", "Format to write: yaml, json or toml (default: from the -out extension)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s config convert -in FILE [flags]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *in == "" {
+		fmt.Println("-in is required")
+		return 2
+	}
+	channels, err := config.LoadChannelConfigs(*in)
+	if err != nil {
+		fmt.Printf("Error loading channels: %v\n", err)
+		return 1
+	}
+	return writeChannels(channels, *out, *to)
+}
+
+// runConfigDumpDefaults implements config dump-defaults
+func runConfigDumpDefaults(args []string) int {
+	fs := flag.NewFlagSet("config dump-defaults", flag.ExitOnError)
+	out := fs.String("out", "", "Write the channels file here (default: stdout)")
+	to := fs.String("to", "", "Format to write: yaml, json or toml (default: from the -out extension, yaml on stdout)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s config dump-defaults [flags]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *out == "" && *to == "" {
+		*to = config.FormatYAML
+	}
+	return writeChannels(config.GetChannelConfigs(), *out, *to)
+}
+
+// writeChannels writes channels to path (empty = stdout) in format, which
+// defaults to the one of the path's extension
+func writeChannels(channels []config.ChannelConfig, path, format string) int {
+	if format == "" {
+		if path == "" {
+			fmt.Println("-to is required when writing to stdout")
+			return 2
+		}
+		format = config.DetectFormat(path, nil)
+	}
+	if !config.ValidFormat(format) {
+		fmt.Printf("Invalid -to %q (expected yaml, json or toml)\n", format)
+		return 2
+	}
+
+	data, err := config.EncodeChannels(channels, format)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if path == "" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		fmt.Printf("Error writing %s: %v\n", path, err)
+		return 1
+	}
+	fmt.Printf("Wrote %d channels to %s (%s)\n", len(channels), path, format)
+	return 0
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows"
+
+	"lemita/datn/pkg/config"
+	"lemita/datn/pkg/eventlog"
+)
+
+// defaultMaxOutputMB is the estimated report size that needs confirmation when
+// -max-output-size is not given
+const defaultMaxOutputMB = 1024
+
+// explicitFlag reports whether a flag of fs was set on the command line
+func explicitFlag(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// checkOutputSize estimates the report size from the record counts and average
+// record size of the channels, counted from their checkpoints (nil = whole window)
+// and scaled by their event ID filters, and reports whether collection should go
+// ahead. Above limitMB it fails when the limit was given explicitly, asks for
+// confirmation at a console, and only warns when nobody is there to answer.
+func checkOutputSize(server string, channels []config.ChannelConfig, since time.Time, maxEvents int, checkpoints *eventlog.Checkpoints, limitMB int64, explicit bool) bool {
+	if limitMB <= 0 {
+		return true
+	}
+
+	var total int64
+	var largest []string
+	for _, channelConfig := range channels {
+		estimate, err := eventlog.EstimateSize(channelConfig.Name, eventlog.CollectOptions{
+			Server:      server,
+			Since:       since,
+			AfterRecord: checkpoints.Get(eventlog.CheckpointKey(server, channelConfig.Name)),
+			EventIDs:    channelConfig.EventIDs,
+			MaxEvents:   maxEvents,
+		})
+		if err != nil {
+			continue // Unavailable channels are reported when they are collected
+		}
+		total += estimate.Bytes()
+		if estimate.Bytes() >= 100<<20 {
+			largest = append(largest, fmt.Sprintf("%s ~%d MB (%d records of ~%d bytes)",
+				estimate.Channel, estimate.Bytes()>>20, estimate.Records, estimate.AverageSize))
+		}
+	}
+	if total <= limitMB<<20 {
+		return true
+	}
+
+	fmt.Printf("The report is estimated at ~%d MB, above the %d MB limit\n", total>>20, limitMB)
+	for _, line := range largest {
+		fmt.Printf("  %s\n", line)
+	}
+	fmt.Println("Narrow it with -since, -max, -channel or -filter, or raise -max-output-size")
+	if explicit {
+		return false
+	}
+	// Scheduled tasks and services can't answer, and only an explicit limit fails them
+	if !consoleInput() {
+		fmt.Println("Continuing, as no console is attached; set -max-output-size to enforce the limit")
+		return true
+	}
+
+	fmt.Print("Continue anyway? [y/N]: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y")
+}
+
+// consoleInput reports whether standard input is an interactive console rather
+// than a pipe, file or the service control manager
+func consoleInput() bool {
+	var mode uint32
+	return windows.GetConsoleMode(windows.Handle(os.Stdin.Fd()), &mode) == nil
+}
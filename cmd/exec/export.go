@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/formatter"
+	"lemita/datn/pkg/query"
+	"lemita/datn/pkg/store"
+)
+
+// runExport implements the export subcommand: it writes the events of the store
+// (or any JSONL file of events) matching a query expression to a JSON, CSV or HTML
+// file, the structured report formats of collect, for sharing or loading into
+// other tools
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	storeDir := fs.String("store", defaultStoreDir, "Event store directory written by the collector")
+	file := fs.String("file", "", "Export this JSONL file of events instead of the store")
+	out := fs.String("out", "", "File to write (required)")
+	format := fs.String("format", "", "Output format: json, csv or html (default: from the -out extension)")
+	typedFields := fs.Bool("typed-fields", false, "Write the catalogued fields of JSON output as numbers, booleans and RFC3339 times")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s export -out FILE [flags] [expression]\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Example: %s export -out logons.csv channel=Security AND event_id=4624\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *out == "" {
+		fmt.Println("-out is required")
+		return 2
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*out)), ".")
+	}
+	if *format != formatter.JSONFormat && *format != formatter.CSVFormat && *format != formatter.HTMLFormat {
+		fmt.Printf("Invalid format %q (expected json, csv or html)\n", *format)
+		return 2
+	}
+	if *typedFields && *format != formatter.JSONFormat {
+		fmt.Println("-typed-fields only applies to -format json")
+		return 2
+	}
+	formatter.SetTypedFields(*typedFields)
+
+	q, err := query.Parse(strings.Join(fs.Args(), " "))
+	if err != nil {
+		fmt.Printf("Error in query: %v\n", err)
+		return 2
+	}
+	path := *storeDir
+	if *file != "" {
+		path = *file
+	}
+
+	output, err := os.Create(*out)
+	if err != nil {
+		fmt.Printf("Error creating %s: %v\n", *out, err)
+		return 1
+	}
+	defer output.Close()
+	w := bufio.NewWriter(output)
+
+	var html *formatter.HTMLWriter
+	switch *format {
+	case formatter.CSVFormat:
+		w.WriteString(formatter.CSVHeader())
+	case formatter.HTMLFormat:
+		html = formatter.NewHTMLWriter("Events exported from " + path)
+	}
+
+	exported := 0
+	err = store.ScanPath(path, func(event eventlog.EventLogData) error {
+		if !q.Match(event) {
+			return nil
+		}
+		exported++
+		logs := []eventlog.EventLogData{event}
+		switch *format {
+		case formatter.CSVFormat:
+			return formatter.WriteCSVChannel(w, event.Channel, logs)
+		case formatter.HTMLFormat:
+			return html.WriteChannel(w, event.Channel, logs)
+		}
+		return formatter.WriteJSONChannel(w, event.Channel, logs)
+	})
+	if err != nil {
+		fmt.Printf("Error exporting %s: %v\n", path, err)
+		return 1
+	}
+	if html != nil {
+		if err := html.Close(w); err != nil {
+			fmt.Printf("Error writing %s: %v\n", *out, err)
+			return 1
+		}
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Printf("Error writing %s: %v\n", *out, err)
+		return 1
+	}
+	if err := output.Close(); err != nil {
+		fmt.Printf("Error writing %s: %v\n", *out, err)
+		return 1
+	}
+	fmt.Printf("Exported %d events to %s\n", exported, *out)
+	return 0
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/audit"
+	"lemita/datn/pkg/autoruns"
+	"lemita/datn/pkg/config"
+	"lemita/datn/pkg/diag"
+	"lemita/datn/pkg/discovery"
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/filesenum"
+	"lemita/datn/pkg/fleet"
+	"lemita/datn/pkg/formatter"
+	"lemita/datn/pkg/runas"
+	"lemita/datn/pkg/tasksenum"
+)
+
+// fleetSummary is the top-level report of a fleet run
+type fleetSummary struct {
+	Case       *eventlog.Case      `json:"case,omitempty"`
+	Started    time.Time           `json:"started"`
+	Duration   time.Duration       `json:"duration"`
+	Hosts      []fleet.HostSummary `json:"hosts"`
+	Succeeded  int                 `json:"succeeded"`
+	Failed     int                 `json:"failed"`
+	Events     int                 `json:"events"`
+	Detections map[string]int      `json:"detections,omitempty"`
+}
+
+// discoverHosts lists the enabled computers below an AD OU and returns those that
+// accept connections on a collection port
+func discoverHosts(ou, dc string, identity *runas.Identity, timeout time.Duration, parallel int) ([]string, error) {
+	var computers []discovery.Computer
+	err := identity.Do(func() error {
+		var err error
+		computers, err = discovery.FindComputers(dc, ou)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Found %d enabled computers in %s\n", len(computers), ou)
+
+	names := make([]string, len(computers))
+	for i, computer := range computers {
+		names[i] = computer.Host()
+	}
+
+	var hosts []string
+	for _, result := range discovery.CheckReachable(names, discovery.DefaultPorts, timeout, parallel) {
+		if !result.Reachable() {
+			fmt.Printf("  %s: unreachable, skipped\n", result.Host)
+			continue
+		}
+		hosts = append(hosts, result.Host)
+	}
+	fmt.Printf("%d of %d computers are reachable\n", len(hosts), len(computers))
+
+	return hosts, nil
+}
+
+// parseHosts reads the -hosts list: comma-separated names, or @FILE with one name
+// per line where blank lines and lines starting with # are ignored. Duplicates are
+// dropped, ignoring case, and names that could be read as paths are rejected.
+func parseHosts(arg string) ([]string, error) {
+	var names []string
+	if path, ok := strings.CutPrefix(arg, "@"); ok {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open hosts file %s: %v", path, err)
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				names = append(names, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read hosts file %s: %v", path, err)
+		}
+	} else {
+		names = strings.Split(arg, ",")
+	}
+
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimPrefix(strings.TrimSpace(name), `\\`)
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		if strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+			return nil, fmt.Errorf("invalid host name %q", name)
+		}
+		seen[strings.ToLower(name)] = true
+		hosts = append(hosts, name)
+	}
+	return hosts, nil
+}
+
+// hostDirName makes a host name safe to use as a directory name
+func hostDirName(host string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*`, r) || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, strings.ToLower(host))
+	// Windows drops trailing dots and spaces, and "." or ".." would name the
+	// output directory itself or its parent
+	if name = strings.TrimRight(name, ". "); name == "" {
+		return "_"
+	}
+	return name
+}
+
+// collectHosts runs one collection pass against every host in turn. Each host gets
+// its own report, JSONL events and summary under <outDir>/<host>/<timestamp>/, and
+// a fleet summary is written to outDir.
+func (c *collector) collectHosts(hosts []string, channels []config.ChannelConfig, maxEvents int, outDir string) int {
+	summary := fleetSummary{Case: c.caseInfo, Started: time.Now(), Detections: map[string]int{}}
+	timestamp := summary.Started.Format(fleet.RunTimestampLayout)
+	runOutput := c.output
+
+	for i, host := range hosts {
+		runOutput.WriteString(fmt.Sprintf("\n=== Host %d/%d: %s ===\n", i+1, len(hosts), host))
+
+		result := c.collectHost(host, channels, maxEvents, filepath.Join(outDir, hostDirName(host), timestamp))
+		if result.Error != "" {
+			runOutput.WriteString(fmt.Sprintf("Error: %s\n", result.Error))
+		}
+		runOutput.WriteString(fmt.Sprintf("Collected %d events, %d of %d channels failed (%s)\n",
+			result.Events, result.ChannelsFailed, len(channels), result.Directory))
+
+		summary.Hosts = append(summary.Hosts, result)
+		summary.Events += result.Events
+		if result.Succeeded {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+		for name, n := range result.Detections {
+			summary.Detections[name] += n
+		}
+	}
+	summary.Duration = time.Since(summary.Started)
+
+	report := formatFleetSummary(summary)
+	runOutput.WriteString(report)
+	if err := writeFleetSummary(outDir, timestamp, summary, report); err != nil {
+		runOutput.WriteString(fmt.Sprintf("Error writing fleet summary: %v\n", err))
+	}
+
+	return summary.Events
+}
+
+// collectHost collects from one host with the collector's outputs redirected to the host's run directory
+func (c *collector) collectHost(host string, channels []config.ChannelConfig, maxEvents int, dir string) fleet.HostSummary {
+	summary := fleet.HostSummary{Host: host, Case: c.caseInfo, Started: time.Now(), Directory: dir}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		summary.Error = fmt.Sprintf("failed to create output directory: %v", err)
+		return summary
+	}
+
+	report, err := os.Create(filepath.Join(dir, fleet.ReportFile))
+	if err != nil {
+		summary.Error = fmt.Sprintf("failed to create report: %v", err)
+		return summary
+	}
+	defer report.Close()
+	eventsFile, err := os.Create(filepath.Join(dir, fleet.EventsFile))
+	if err != nil {
+		summary.Error = fmt.Sprintf("failed to create events file: %v", err)
+		return summary
+	}
+	defer eventsFile.Close()
+	eventsWriter := bufio.NewWriter(eventsFile)
+
+	runOutput := c.output
+	c.output = diag.NewTee(report, c.recentLines)
+	c.events = json.NewEncoder(eventsWriter)
+	c.detections = map[string]int{}
+	c.server = host
+	if err := c.openMessages(); err != nil {
+		c.output.WriteString(fmt.Sprintf("Warning: messages will not be rendered: %v\n", err))
+	}
+	defer func() {
+		c.output = runOutput
+		c.events = nil
+		c.detections = nil
+		c.server = ""
+		c.closeMessages()
+	}()
+
+	header := fmt.Sprintf("Windows Event Log Collection - %s - %s\n", host, summary.Started.Format(time.RFC1123))
+	c.output.WriteString(header + strings.Repeat("=", len(header)-1) + "\n")
+	c.output.WriteString(formatter.FormatCase(c.caseInfo))
+
+	gaps, timings := len(c.coverageGaps), len(c.timings)
+	summary.Events, summary.ChannelsFailed = c.collectChannels(channels, maxEvents)
+	for _, gap := range c.coverageGaps[gaps:] {
+		summary.CoverageGaps = append(summary.CoverageGaps, gap.String())
+	}
+	summary.Timings = c.timings[timings:]
+	if c.inventory {
+		summary.Services = c.inventoryHost(host, dir, "services", fleet.ServicesFile, filesenum.ListServicesOn)
+		summary.Tasks = c.inventoryHost(host, dir, "scheduled tasks", fleet.TasksFile, tasksenum.ListProgramsOn)
+		summary.Autoruns = c.inventoryHost(host, dir, "autoruns", fleet.AutorunsFile, autoruns.ListInventoryOn)
+		summary.COMHijacks = c.inventoryHost(host, dir, "COM servers in user-writable folders", fleet.COMFile, filesenum.ListCOMHijacksOn)
+		summary.IFEODebuggers = c.inventoryHost(host, dir, "IFEO debuggers", fleet.IFEOFile, filesenum.ListIFEODebuggersOn)
+	}
+	summary.Succeeded = summary.ChannelsFailed < len(channels)
+	summary.Duration = time.Since(summary.Started)
+	if len(c.detections) > 0 {
+		summary.Detections = c.detections
+	}
+	summary.Audit = c.audit.Head()
+
+	if err := eventsWriter.Flush(); err != nil {
+		summary.Error = fmt.Sprintf("failed to write events: %v", err)
+	}
+	if err := writeJSON(filepath.Join(dir, fleet.SummaryFile), summary); err != nil {
+		summary.Error = err.Error()
+	}
+	return summary
+}
+
+// inventoryHost saves one of the host's persistence inventories (services, scheduled
+// tasks, autoruns, COM servers or IFEO debuggers, with binary hashes) for fleet aggregation and returns the
+// number of entries
+func (c *collector) inventoryHost(host, dir, what, file string, list func(string) ([]filesenum.PEInfo, error)) int {
+	var items []filesenum.PEInfo
+	err := c.identity.Do(func() error {
+		var err error
+		items, err = list(host)
+		return err
+	})
+	if err != nil {
+		c.output.WriteString(fmt.Sprintf("Error listing %s on %s: %v\n", what, host, err))
+		c.recordAudit(audit.ActionInventory, "listing %s on %s failed: %v", what, host, err)
+		return 0
+	}
+	if err := writeJSON(filepath.Join(dir, file), items); err != nil {
+		c.output.WriteString(fmt.Sprintf("Error saving %s of %s: %v\n", what, host, err))
+		return 0
+	}
+	c.output.WriteString(fmt.Sprintf("\nInventoried %d %s\n", len(items), what))
+	c.recordAudit(audit.ActionInventory, "%d %s on %s, with file hashes, saved to %s", len(items), what, host, file)
+	return len(items)
+}
+
+// formatFleetSummary renders the fleet summary report
+func formatFleetSummary(summary fleetSummary) string {
+	var b strings.Builder
+	b.WriteString("\nFleet Summary\n-------------\n")
+	fmt.Fprintf(&b, "Hosts: %d succeeded, %d failed\n", summary.Succeeded, summary.Failed)
+	fmt.Fprintf(&b, "Total events collected: %d\n", summary.Events)
+	fmt.Fprintf(&b, "Duration: %v\n", summary.Duration)
+
+	for _, host := range summary.Hosts {
+		status := "ok"
+		if !host.Succeeded {
+			status = "FAILED"
+		}
+		fmt.Fprintf(&b, "  %-30s %-6s events: %d, failed channels: %d\n", host.Host, status, host.Events, host.ChannelsFailed)
+		for _, gap := range host.CoverageGaps {
+			fmt.Fprintf(&b, "    coverage gap: %s\n", gap)
+		}
+	}
+
+	if len(summary.Detections) > 0 {
+		names := make([]string, 0, len(summary.Detections))
+		for name := range summary.Detections {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if summary.Detections[names[i]] != summary.Detections[names[j]] {
+				return summary.Detections[names[i]] > summary.Detections[names[j]]
+			}
+			return names[i] < names[j]
+		})
+
+		b.WriteString("\nDetections across the fleet:\n")
+		for _, name := range names {
+			hostCount := 0
+			for _, host := range summary.Hosts {
+				if host.Detections[name] > 0 {
+					hostCount++
+				}
+			}
+			fmt.Fprintf(&b, "  %-30s %d events on %d hosts\n", name, summary.Detections[name], hostCount)
+		}
+	}
+	return b.String()
+}
+
+// writeFleetSummary writes the fleet summary as text and JSON to outDir
+func writeFleetSummary(outDir, timestamp string, summary fleetSummary, report string) error {
+	if err := os.MkdirAll(outDir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %v", outDir, err)
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "fleet-summary-"+timestamp+".txt"), []byte(report), 0600); err != nil {
+		return fmt.Errorf("failed to write fleet summary: %v", err)
+	}
+	return writeJSON(filepath.Join(outDir, "fleet-summary-"+timestamp+".json"), summary)
+}
+
+// writeJSON writes v as indented JSON to path
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %v", path, err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestHostDirName(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"WS01", "ws01"},
+		{"ws01.corp.example", "ws01.corp.example"},
+		{"fe80::1", "fe80__1"},
+		{"..", "_"},
+		{".", "_"},
+		{"../../etc", ".._.._etc"},
+		{`..\..\Windows`, ".._.._windows"},
+		{"ws01.", "ws01"},
+		{"ws01 ", "ws01"},
+	}
+	for _, tt := range tests {
+		if got := hostDirName(tt.host); got != tt.want {
+			t.Errorf("hostDirName(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestParseHostsRejectsPaths(t *testing.T) {
+	for _, arg := range []string{"ws01,..", "ws01,../ws02", `ws01,a\b`, "ws01/x"} {
+		if hosts, err := parseHosts(arg); err == nil {
+			t.Errorf("parseHosts(%q) = %q, want an error", arg, hosts)
+		}
+	}
+
+	hosts, err := parseHosts(`ws01, \\WS02,ws01.corp.example,WS01`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 3 || hosts[0] != "ws01" || hosts[1] != "WS02" || hosts[2] != "ws01.corp.example" {
+		t.Errorf("parseHosts = %q, want ws01, WS02 and ws01.corp.example", hosts)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"lemita/datn/pkg/api"
+	"lemita/datn/pkg/audit"
+	"lemita/datn/pkg/config"
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/health"
+	"lemita/datn/pkg/servicedrift"
+	"lemita/datn/pkg/store"
+	"lemita/datn/pkg/telemetry"
+)
+
+// followOptions configures continuous (daemon) collection
+type followOptions struct {
+	interval       time.Duration
+	checkpointPath string
+	drainTimeout   time.Duration
+	healthPath     string // Status file read by the health command
+	healthAddr     string // Listen address for the /healthz and /events endpoints (empty disables them)
+	apiAuth        api.AuthOptions
+	retention      store.Retention
+	serviceDrift   time.Duration  // How often services are compared with the previous snapshot (0 disables it)
+	stop           chan os.Signal // Stop requests from the service control manager (nil when not a service)
+}
+
+// runFollow polls the channels for new events until SIGINT/SIGTERM (or a console
+// close/shutdown event on Windows), then stops polling, flushes the sink within the
+// drain timeout, writes checkpoints and reports what happened to in-flight events
+func runFollow(c *collector, channels []config.ChannelConfig, opts followOptions) int {
+	checkpoints, err := eventlog.LoadCheckpoints(opts.checkpointPath)
+	if err != nil {
+		fmt.Printf("Error loading checkpoints: %v\n", err)
+		return 1
+	}
+
+	channelNames := make([]string, len(channels))
+	for i, channelConfig := range channels {
+		channelNames[i] = channelConfig.Name
+	}
+	monitor := health.NewMonitor(opts.healthPath, opts.interval, channelNames)
+
+	if opts.healthAddr != "" {
+		if err := serveAPI(c, monitor, opts); err != nil {
+			fmt.Printf("Error starting the HTTP listener: %v\n", err)
+			return 1
+		}
+	}
+
+	stop := opts.stop
+	if stop == nil {
+		stop = make(chan os.Signal, 1)
+	}
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	fmt.Printf("Following %d channels every %v (checkpoints: %s)\n", len(channels), opts.interval, opts.checkpointPath)
+
+	c.resumeIIS(checkpoints)
+	if opts.serviceDrift > 0 {
+		c.services = servicedrift.NewMonitor(c.host())
+	}
+
+	totalEvents := 0
+	var lastPrune, lastServiceCheck time.Time
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, channelConfig := range channels {
+			channelConfig := channelConfig
+			span := c.telemetry.StartSpan("collect "+channelConfig.Name, nil)
+			span.SetAttribute("channel", channelConfig.Name)
+			span.SetAttribute("host", c.host())
+			ok := c.guard(channelConfig.Name, func() {
+				afterRecord := checkpoints.Get(c.checkpointKey(channelConfig.Name))
+				result, err := c.collect(channelConfig.Name, eventlog.CollectOptions{
+					EventIDs:    channelConfig.EventIDs,
+					Levels:      c.levels,
+					AfterRecord: afterRecord,
+					Deadline:    c.channelDeadline(channelConfig),
+				})
+				c.warnReset(channelConfig.Name, afterRecord, result)
+				if err != nil {
+					c.output.WriteString(fmt.Sprintf("Error collecting logs from %s: %v\n", channelConfig.Name, err))
+					c.recordAudit(audit.ActionReadChannel, "%s on %s failed: %v", channelConfig.Name, c.host(), err)
+					monitor.RecordError(channelConfig.Name, err)
+					c.telemetry.Add(telemetry.ChannelErrors, 1, "channel", channelConfig.Name)
+					span.SetError(err)
+				}
+				if result == nil {
+					return
+				}
+				span.SetAttribute("events", result.Len())
+				if err == nil {
+					monitor.RecordSuccess(channelConfig.Name, result.Len())
+				}
+
+				if result.Len() > 0 {
+					c.recordAudit(audit.ActionReadChannel, "%s on %s: %d events up to record %d", channelConfig.Name, c.host(), result.Len(), result.LastRecord)
+					timings, err := c.handleResult(channelConfig.Name, result)
+					c.printTimings(timings)
+					totalEvents += result.Len()
+					if err != nil {
+						// Not advancing the checkpoint reads the events again on the next pass
+						monitor.RecordError(channelConfig.Name, err)
+						return
+					}
+				}
+				checkpoints.Set(c.checkpointKey(channelConfig.Name), result.LastRecord)
+			})
+			if !ok {
+				monitor.RecordError(channelConfig.Name, fmt.Errorf("collection panicked"))
+				span.SetError(fmt.Errorf("collection panicked"))
+			}
+			span.End()
+		}
+
+		totalEvents += c.collectIIS(time.Time{}, 0)
+		if c.services != nil && time.Since(lastServiceCheck) >= opts.serviceDrift {
+			totalEvents += c.checkServices()
+			lastServiceCheck = time.Now()
+		}
+		c.checkpointIIS(checkpoints)
+
+		if err := checkpoints.Save(); err != nil {
+			c.output.WriteString(fmt.Sprintf("Error saving checkpoints: %v\n", err))
+			monitor.RecordError("", err)
+		} else {
+			monitor.SetCheckpointUpdated(checkpoints.Updated)
+		}
+
+		// Keep the resident store bounded
+		if time.Since(lastPrune) >= pruneInterval {
+			c.applyRetention(opts.retention)
+			lastPrune = time.Now()
+		}
+
+		if c.sink != nil {
+			monitor.SetSinkStats(c.sink.Stats())
+		}
+		monitor.SetSampled(c.sampler.Dropped())
+		monitor.RecordPass()
+		if err := monitor.Save(); err != nil {
+			c.output.WriteString(fmt.Sprintf("Error saving health status: %v\n", err))
+		}
+
+		select {
+		case sig := <-stop:
+			fmt.Printf("Received %v, shutting down...\n", sig)
+			for _, name := range channelNames {
+				monitor.Unsubscribe(name)
+			}
+			monitor.Save()
+			return shutdown(c, checkpoints, totalEvents, opts.drainTimeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// serveAPI starts the HTTP listener serving /healthz and, with a store, /events,
+// behind the configured TLS, client certificate, token and address checks and the
+// per-certificate operation policy
+func serveAPI(c *collector, monitor *health.Monitor, opts followOptions) error {
+	tlsConfig, err := opts.apiAuth.TLSConfig()
+	if err != nil {
+		return err
+	}
+	auth, err := api.NewAuthenticator(opts.apiAuth)
+	if err != nil {
+		return err
+	}
+	policy, err := opts.apiAuth.Policy()
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", policy.Restrict(api.OpHealth, monitor.Handler()))
+	if c.store != nil {
+		mux.Handle("/events", policy.Restrict(api.OpEvents, api.EventsHandler(c.store)))
+		mux.Handle("/notes", policy.Restrict(api.OpAnnotate, api.NotesHandler(c.store)))
+	}
+	server := &http.Server{
+		Addr:              opts.healthAddr,
+		Handler:           api.Audited(c.audit, auth.Wrap(mux)),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		fmt.Printf("HTTP listener stopped: %v\n", err)
+	}()
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	fmt.Printf("Serving health status on %s://%s/healthz\n", scheme, opts.healthAddr)
+	if c.store != nil {
+		fmt.Printf("Serving stored events on %s://%s/events\n", scheme, opts.healthAddr)
+	}
+	if !opts.apiAuth.Enabled() {
+		fmt.Printf("Warning: the listener is unauthenticated; use -api-tokens, -api-client-ca or -api-allow outside of localhost\n")
+	}
+	return nil
+}
+
+// shutdown flushes the sink within the drain timeout, writes checkpoints and
+// reports how many in-flight events were persisted versus dropped
+func shutdown(c *collector, checkpoints *eventlog.Checkpoints, totalEvents int, drainTimeout time.Duration) int {
+	exitCode := 0
+
+	if c.sink != nil {
+		before := c.sink.Stats()
+
+		done := make(chan error, 1)
+		go func() {
+			done <- c.sink.Close()
+		}()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				fmt.Printf("Error flushing sink: %v\n", err)
+				exitCode = 1
+			}
+		case <-time.After(drainTimeout):
+			fmt.Printf("Sink did not drain within %v\n", drainTimeout)
+			exitCode = 1
+		}
+
+		after := c.sink.Stats()
+		// Deltas can include older spooled batches that were drained on the way
+		persisted := (after.Sent - before.Sent) + (after.Spooled - before.Spooled)
+		if persisted > before.Pending {
+			persisted = before.Pending
+		}
+		dropped := before.Pending - persisted
+		fmt.Printf("In-flight events at shutdown: %d (persisted: %d, dropped: %d)\n", before.Pending, persisted, dropped)
+		fmt.Printf("Sink totals: sent %d, spooled %d, evicted %d, quarantined %d batches\n", after.Sent, after.Spooled, after.Evicted, after.Quarantined)
+	}
+
+	if err := checkpoints.Save(); err != nil {
+		fmt.Printf("Error saving checkpoints: %v\n", err)
+		exitCode = 1
+	}
+
+	for channel, n := range c.sampler.Dropped() {
+		fmt.Printf("Sampled out %d events from %s\n", n, channel)
+	}
+	fmt.Printf("Follow mode stopped after collecting %d events.\n", totalEvents)
+	return exitCode
+}
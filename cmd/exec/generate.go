@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"lemita/datn/pkg/eventgen"
+)
+
+// runGenerate implements the generate subcommand: it writes synthetic test events,
+// from a built-in scenario or a saved corpus, to a dedicated event log so detection
+// rules and formatters can be exercised end-to-end on lab machines
+func runGenerate(args []string) int {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	scenario := fs.String("scenario", "", "Built-in scenario to write (see -list)")
+	corpus := fs.String("corpus", "", "Replay the events of this saved JSONL collection instead")
+	limit := fs.Int("limit", 0, "Maximum number of corpus events to replay (0 = all)")
+	count := fs.Int("count", 1, "Number of times the events are written")
+	interval := fs.Duration("interval", 0, "Pause between events")
+	logName := fs.String("log", eventgen.DefaultLog, "Event log the test source is registered in")
+	source := fs.String("source", eventgen.DefaultSource, "Event source of the generated events")
+	server := fs.String("server", "", "Write to this remote computer (the source must already be registered there)")
+	list := fs.Bool("list", false, "List the built-in scenarios")
+	remove := fs.Bool("remove", false, "Unregister the test source, and its log once empty, then exit")
+	fs.Parse(args)
+
+	if *list {
+		for _, s := range eventgen.Scenarios() {
+			fmt.Printf("  %-20s %s (%d events)\n", s.Name, s.Description, len(s.Events))
+		}
+		return 0
+	}
+	if *remove {
+		if err := eventgen.Uninstall(*logName, *source); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Removed event source %s from %s\n", *source, *logName)
+		return 0
+	}
+
+	var events []eventgen.Event
+	switch {
+	case *scenario != "" && *corpus != "":
+		fmt.Println("Error: -scenario and -corpus are mutually exclusive")
+		return 2
+	case *scenario != "":
+		s, err := eventgen.FindScenario(*scenario)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 2
+		}
+		events = s.Events
+	case *corpus != "":
+		var err error
+		events, err = eventgen.LoadCorpus(*corpus, *limit)
+		if err != nil {
+			fmt.Printf("Error loading corpus: %v\n", err)
+			return 1
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Usage: %s generate -scenario NAME | -corpus FILE [flags]\n\n", os.Args[0])
+		fs.PrintDefaults()
+		return 2
+	}
+
+	if *server == "" {
+		if err := eventgen.Install(*logName, *source); err != nil {
+			fmt.Printf("Error: %v (run as administrator)\n", err)
+			return 1
+		}
+	}
+	w, err := eventgen.Open(*server, *source)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer w.Close()
+
+	written := 0
+	for i := 0; i < *count; i++ {
+		for _, event := range events {
+			if err := w.Write(event); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return 1
+			}
+			written++
+			if *interval > 0 {
+				time.Sleep(*interval)
+			}
+		}
+	}
+
+	fmt.Printf("Wrote %d events to %s (source %s)\n", written, *logName, *source)
+	fmt.Printf("Collect them with: %s collect -channel %s -out console\n", os.Args[0], *logName)
+	return 0
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"lemita/datn/pkg/health"
+)
+
+// defaultHealthFile is where follow mode writes its status
+const defaultHealthFile = "datn-health.json"
+
+// runHealth implements the health subcommand: it reads the status written by a
+// running collector and exits non-zero when problems are detected
+func runHealth(args []string) int {
+	fs := flag.NewFlagSet("health", flag.ExitOnError)
+	statusFile := fs.String("health-file", defaultHealthFile, "Status file written by the collector in follow mode")
+	asJSON := fs.Bool("json", false, "Print the raw status as JSON")
+	fs.Parse(args)
+
+	status, err := health.Load(*statusFile)
+	if err != nil {
+		fmt.Printf("UNHEALTHY: %v\n", err)
+		return 2
+	}
+	problems := status.Problems(time.Now())
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(status, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		fmt.Printf("Collector PID %d, started %s, last update %s\n",
+			status.PID, status.StartedAt.Format(time.RFC3339), status.UpdatedAt.Format(time.RFC3339))
+
+		names := make([]string, 0, len(status.Channels))
+		for name := range status.Channels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Println("\nChannels:")
+		for _, name := range names {
+			ch := status.Channels[name]
+			state := "subscribed"
+			if !ch.Subscribed {
+				state = "stopped"
+			}
+			lastSuccess := "never"
+			if !ch.LastSuccess.IsZero() {
+				lastSuccess = ch.LastSuccess.Format(time.RFC3339)
+			}
+			fmt.Printf("  %s [%s] last success: %s, events: %d, sampled out: %d\n", name, state, lastSuccess, ch.EventsCollected, ch.EventsSampled)
+			if ch.LastError != "" {
+				fmt.Printf("    last error (%s): %s\n", ch.LastErrorTime.Format(time.RFC3339), ch.LastError)
+			}
+		}
+
+		if status.Sink != nil {
+			fmt.Printf("\nSink: sent %d, spooled %d, evicted %d, pending %d, spool backlog %d batches, quarantined %d batches\n",
+				status.Sink.Sent, status.Sink.Spooled, status.Sink.Evicted, status.Sink.Pending, status.Sink.Backlog, status.Sink.Quarantined)
+		}
+		if !status.CheckpointUpdated.IsZero() {
+			fmt.Printf("Checkpoint age: %v\n", time.Since(status.CheckpointUpdated).Round(time.Second))
+		}
+
+		if len(status.RecentErrors) > 0 {
+			fmt.Println("\nRecent errors:")
+			for _, e := range status.RecentErrors {
+				fmt.Printf("  %s %s %s\n", e.Time.Format(time.RFC3339), e.Channel, e.Message)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		fmt.Println("\nUNHEALTHY:")
+		for _, problem := range problems {
+			fmt.Printf("  - %s\n", problem)
+		}
+		return 1
+	}
+
+	fmt.Println("\nHEALTHY")
+	return 0
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/iislog"
+)
+
+// iisCheckpointPrefix keys the read offset of every IIS log file in the checkpoints
+const iisCheckpointPrefix = "IIS:"
+
+// collectIIS passes the requests logged since the last call through the pipeline
+// and returns their number
+func (c *collector) collectIIS(since time.Time, maxEvents int) int {
+	if c.iis == nil {
+		return 0
+	}
+	collected := 0
+	c.guard(iislog.Channel, func() {
+		events, err := c.iis.Read(since, maxEvents)
+		if err != nil {
+			c.output.WriteString(fmt.Sprintf("Error reading IIS logs: %v\n", err))
+		}
+		if len(events) > 0 {
+			c.handleEvents(iislog.Channel, events)
+			c.writeAggregated(iislog.Channel)
+			collected = len(events)
+		}
+	})
+	return collected
+}
+
+// resumeIIS positions the IIS reader at the offsets saved in the checkpoints
+func (c *collector) resumeIIS(checkpoints *eventlog.Checkpoints) {
+	if c.iis == nil {
+		return
+	}
+	paths, err := c.iis.Files()
+	if err != nil {
+		c.output.WriteString(fmt.Sprintf("Error reading IIS logs: %v\n", err))
+		return
+	}
+	for _, path := range paths {
+		if offset := checkpoints.Get(iisCheckpointPrefix + path); offset > 0 {
+			c.iis.Seek(path, int64(offset))
+		}
+	}
+}
+
+// checkpointIIS saves the IIS read offsets in the checkpoints
+func (c *collector) checkpointIIS(checkpoints *eventlog.Checkpoints) {
+	if c.iis == nil {
+		return
+	}
+	paths, err := c.iis.Files()
+	if err != nil {
+		return
+	}
+	for _, path := range paths {
+		if offset := c.iis.Offset(path); offset > 0 {
+			checkpoints.Set(iisCheckpointPrefix+path, uint32(offset))
+		}
+	}
+}
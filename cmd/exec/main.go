@@ -3,136 +3,995 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"lemita/datn/pkg/allowlist"
+	"lemita/datn/pkg/api"
+	"lemita/datn/pkg/audit"
+	"lemita/datn/pkg/boot"
+	"lemita/datn/pkg/cache"
 	"lemita/datn/pkg/config"
+	"lemita/datn/pkg/crashes"
+	"lemita/datn/pkg/dedup"
+	"lemita/datn/pkg/detect"
+	"lemita/datn/pkg/diag"
+	"lemita/datn/pkg/domains"
 	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/filter"
+	"lemita/datn/pkg/findings"
+	"lemita/datn/pkg/fleet"
 	"lemita/datn/pkg/formatter"
+	"lemita/datn/pkg/groups"
+	"lemita/datn/pkg/iislog"
+	"lemita/datn/pkg/privacy"
+	"lemita/datn/pkg/privileges"
+	"lemita/datn/pkg/runas"
+	"lemita/datn/pkg/sampling"
+	"lemita/datn/pkg/sarif"
+	"lemita/datn/pkg/sink"
+	"lemita/datn/pkg/store"
+	"lemita/datn/pkg/telemetry"
+	"lemita/datn/pkg/trigger"
+	"lemita/datn/pkg/vhd"
+	"lemita/datn/pkg/wfp"
 )
 
 func main() {
-	// Define command line flags
-	maxEvents := flag.Int("max", 100, "Maximum number of events to collect per channel")
-	outputFile := flag.String("out", "", "Output file path (leave empty for Desktop file, use 'console' for console output)")
-	onlyAvailable := flag.Bool("available", true, "Only collect from channels expected to be available")
-	specificChannel := flag.String("channel", "", "Collect from a specific channel only (leave empty for all channels)")
+	os.Exit(runCommand(os.Args[1:]))
+}
 
-	flag.Parse()
+// runCollect implements the collect command, the default when the first argument
+// is a flag: it reads the selected channels of the local computer, a remote one or
+// a fleet into a report, and with -follow keeps collecting as the monitor command
+func runCollect(args []string) int {
+	fs, f := newCollectFlags("collect", false)
+	fs.Parse(args)
+	return collect(fs, f)
+}
+
+// collect runs the collect or monitor command with the flags parsed into f: it
+// validates them, sets up the collector, its outputs and state, then follows or
+// reads the channels once and writes the summary
+func collect(fs *flag.FlagSet, f *collectFlags) int {
+	// With -out - the report is the only thing written to stdout, so it can be piped;
+	// every status message goes to stderr instead
+	stdout := os.Stdout
+	if f.outputFile == "-" {
+		os.Stdout = os.Stderr
+	}
+
+	// Under the service control manager the collector always runs in follow mode
+	service, err := startService()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	if service != nil {
+		f.follow = true
+	}
 
 	// Get the channel configurations
-	channelConfigs := config.GetChannelConfigs()
+	channelConfigs, err := config.LoadChannelConfigs(f.channelsFile)
+	if err != nil {
+		fmt.Printf("Error loading channels: %v\n", err)
+		return 2
+	}
+
+	// Prompt before any other flag is interpreted, so the answers are validated like flags
+	var picked []string
+	if f.interactive {
+		if f.follow {
+			fmt.Println("-interactive is not supported in follow mode")
+			return 2
+		}
+		if picked = runPicker(os.Stdin, os.Stdout, fs, f.server, channelConfigs); picked == nil {
+			fmt.Println("Cancelled")
+			return 1
+		}
+	}
+
+	// Verify the binary and warn about tamperable configuration and state before reading any of it
+	selfCheckWarnings, ok := f.selfCheck()
+	if !ok {
+		return 3
+	}
+
+	if err := f.validate(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	c, err := newCollector(fs, f)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	defer c.close()
 
-	// Get desktop path
-	homeDir, err := os.UserHomeDir()
+	// Log on the collection account; like the raw bundle key, the password only comes from the environment
+	if f.runasAccount != "" {
+		password, ok := os.LookupEnv("DATN_RUNAS_PASSWORD")
+		if !ok {
+			fmt.Println("DATN_RUNAS_PASSWORD must be set when -runas is used")
+			return 2
+		}
+		if c.identity, err = runas.Logon(f.runasAccount, password); err != nil {
+			fmt.Printf("Error logging on %s: %v\n", f.runasAccount, err)
+			return 2
+		}
+		defer c.identity.Close()
+	}
+
+	hosts, err := f.fleetHosts(c.identity)
 	if err != nil {
-		fmt.Printf("Error getting user home directory: %v\n", err)
-		homeDir = "."
-	}
-	desktopPath := filepath.Join(homeDir, "Desktop")
-
-	// Prepare output
-	var output *os.File
-	if *outputFile == "console" {
-		// Explicit console output requested
-		output = os.Stdout
-	} else if *outputFile == "" {
-		// Default to a file on the desktop when no output file is specified
-		timestamp := time.Now().Format("20060102-150405")
-		fileName := filepath.Join(desktopPath, fmt.Sprintf("WindowsEventLogs-%s.log", timestamp))
-		output, err = os.Create(fileName)
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	if f.discoverOU != "" && len(hosts) == 0 {
+		fmt.Println("No reachable computers found")
+		return 1
+	}
+
+	// Two runs resuming from the same checkpoints, such as a scheduled task and a
+	// manual run, would collect the same events twice and overwrite each other's state
+	if (f.follow || f.incremental) && !f.force {
+		lock, err := lockCheckpoints(f.checkpointFile)
 		if err != nil {
-			fmt.Printf("Error creating default output file on desktop: %v\nFalling back to console output.\n", err)
-			output = os.Stdout
-		} else {
-			defer output.Close()
-			fmt.Printf("Logging output to: %s\n", fileName)
-		}
-	} else if !filepath.IsAbs(*outputFile) {
-		// If a relative path is provided, put it on the desktop
-		timestamp := time.Now().Format("20060102-150405")
-		fileName := filepath.Join(desktopPath, fmt.Sprintf("%s-%s.log", strings.TrimSuffix(*outputFile, ".log"), timestamp))
-		output, err = os.Create(fileName)
+			fmt.Printf("Error: %v\n", err)
+			return 2
+		}
+		defer lock.Release()
+	}
+
+	if err := c.openDestinations(f); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	selectedChannels := f.selectChannels(channelConfigs, picked)
+
+	// Refuse or confirm a report that would fill the disk before any file is created
+	if !f.follow && len(hosts) == 0 && f.outputFile != "console" && f.outputFile != "-" {
+		var checkpoints *eventlog.Checkpoints
+		if f.incremental {
+			// Only a failure to read them is reported, when they are opened for the run
+			checkpoints, _ = eventlog.LoadCheckpoints(f.checkpointFile)
+		}
+		if !checkOutputSize(f.server, selectedChannels, c.since, f.maxEvents, checkpoints, f.maxOutputMB, explicitFlag(fs, "max-output-size")) {
+			return 2
+		}
+	}
+
+	output, runDir, appending, err := f.openOutput(stdout)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if output != stdout {
+		defer output.Close()
+	}
+
+	// Stream the report through a buffer flushed periodically, so partial results
+	// survive a crash without a write per line
+	report := formatter.NewStreamWriter(output, f.flushInterval)
+	defer report.Close()
+	if err := report.SetEncoding(f.encoding); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	// With JSON or CSV output only the events go to the report; status text goes to stderr
+	status := io.Writer(report)
+	if f.format != formatter.TextFormat {
+		status = os.Stderr
+	}
+	c.output = diag.NewTee(status, c.recentLines)
+
+	if err := c.openReport(f, report, appending, len(hosts) > 0); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	if err := c.openState(fs, f, len(hosts) > 0); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	c.writeHeader(f, selfCheckWarnings)
+
+	// 4688 without command lines is nearly useless, so check the local audit policy
+	if f.server == "" && len(hosts) == 0 && collectsProcessCreation(selectedChannels) {
+		c.checkProcessAuditing(f.enableCmdlineAudit)
+	}
+
+	if f.follow {
+		exitCode := runFollow(c, selectedChannels, f.followOptions(service))
+		c.recordAudit(audit.ActionStop, "follow mode exited with code %d", exitCode)
+		if err := c.telemetry.Close(); err != nil {
+			fmt.Printf("Error exporting telemetry: %v\n", err)
+		}
+		report.Close()
+		if output != stdout {
+			output.Close()
+		}
+		if service != nil {
+			service.finish(exitCode)
+		}
+		return exitCode
+	}
+
+	startTime := time.Now()
+	totalEventsCollected := c.collectOnce(f, hosts, selectedChannels, startTime)
+	duration := time.Since(startTime)
+	c.recordAudit(audit.ActionStop, "collected %d events in %v", totalEventsCollected, duration)
+	c.output.WriteString(c.summary(f, totalEventsCollected, duration))
+	c.writeArtifacts(f)
+
+	// Package the run directory for evidence handling once everything is written
+	if f.vhdPath != "" {
+		report.Close()
+		output.Close()
+		container, err := vhd.Create(f.vhdPath, runDir)
 		if err != nil {
-			fmt.Printf("Error creating output file on desktop: %v\nFalling back to console output.\n", err)
-			output = os.Stdout
+			fmt.Printf("Error writing VHD: %v\n", err)
 		} else {
-			defer output.Close()
-			fmt.Printf("Logging output to: %s\n", fileName)
+			fmt.Printf("Run directory packaged into %s (%d files, %d MB, sha256 %s)\n", container.Path, container.Files, container.Size>>20, container.SHA256)
 		}
-	} else {
-		// Absolute path was provided
-		timestamp := time.Now().Format("20060102-150405")
-		fileName := fmt.Sprintf("%s-%s.log", strings.TrimSuffix(*outputFile, ".log"), timestamp)
-		output, err = os.Create(fileName)
+	}
+
+	if f.outputFile != "" {
+		fmt.Printf("Collection complete. Collected %d events in %v.\n", totalEventsCollected, duration)
+	}
+	return 0
+}
+
+// selfCheck verifies the binary and the permissions of the configuration and state
+// files, returning the warnings to print in the report. It reports false when
+// -require-integrity is set and the binary couldn't be verified.
+func (f *collectFlags) selfCheck() (warnings []string, ok bool) {
+	if f.skipSelfCheck {
+		return nil, true
+	}
+	checkpointPath := f.checkpointFile
+	if eventlog.RegistryCheckpoints(checkpointPath) {
+		checkpointPath = "" // Registry keys have no file permissions to check
+	}
+	// A tokens file, client CA or policy a user can write to lets anyone in
+	warnings, verified := selfCheck([]string{f.tagsFile, f.channelsFile, f.rulesFile, f.sigmaRules, f.fieldMap, f.triggersFile, f.groupWatchlist, checkpointPath, f.storeDir, f.sinkSpool, f.healthFile, f.otlpHeadersFile,
+		f.apiTokens, f.apiCert, f.apiKey, f.apiClientCA, f.apiPolicy, f.auditLog})
+	if f.requireIntegrity && !verified {
+		for _, warning := range warnings {
+			fmt.Printf("Self-check: %s\n", warning)
+		}
+		fmt.Println("Refusing to run: binary integrity could not be verified")
+		return warnings, false
+	}
+	return warnings, true
+}
+
+// validate checks the flag values and combinations that need no file or system
+// access, and applies the report formatting flags
+func (f *collectFlags) validate() error {
+	if !privacy.ValidMode(f.privacyMode) {
+		return fmt.Errorf("invalid privacy mode %q (expected off, truncate or hash)", f.privacyMode)
+	}
+	// The raw bundle passphrase is read from the environment so it never appears in process listings
+	if f.rawBundle != "" && os.Getenv("DATN_RAW_KEY") == "" {
+		return fmt.Errorf("DATN_RAW_KEY must be set when -raw-bundle is used")
+	}
+	if f.rawBundle != "" && f.follow {
+		return fmt.Errorf("-raw-bundle is not supported in follow mode")
+	}
+	if f.vhdPath != "" && (f.follow || f.outputFile != "") {
+		return fmt.Errorf("-vhd packages the run directory and can't be combined with -follow or -out")
+	}
+	if !eventlog.ValidAPI(f.eventAPI) {
+		return fmt.Errorf("invalid -api %q (expected auto, legacy or wevtapi)", f.eventAPI)
+	}
+	if f.format == "jsonl" {
+		f.format = formatter.JSONFormat
+	}
+	if !formatter.ValidFormat(f.format) {
+		return fmt.Errorf("invalid format %q (expected text, json, csv or html)", f.format)
+	}
+	if f.format == formatter.HTMLFormat && (f.follow || f.appendOutput || f.aggregate) {
+		return fmt.Errorf("-format html writes a complete document per run and can't be combined with -follow, -append or -aggregate")
+	}
+	zone, err := formatter.ParseTimeZone(f.timeZone)
+	if err != nil {
+		return fmt.Errorf("invalid -timezone: %v", err)
+	}
+	formatter.SetTimeZone(zone)
+	if !formatter.ValidMessageDetail(f.messageDetail) {
+		return fmt.Errorf("invalid -message-detail %q (expected message, strings or both)", f.messageDetail)
+	}
+	formatter.SetMessageDetail(f.messageDetail)
+	if f.typedFields && f.format != formatter.JSONFormat {
+		return fmt.Errorf("-typed-fields only applies to -format json")
+	}
+	formatter.SetTypedFields(f.typedFields)
+	if !formatter.ValidEncoding(f.encoding) {
+		return fmt.Errorf("invalid encoding %q (expected utf8, utf8-bom or utf16le)", f.encoding)
+	}
+	if f.format == formatter.JSONFormat && f.encoding != formatter.UTF8Encoding {
+		return fmt.Errorf("JSON output is always UTF-8 without a byte order mark; -encoding only applies to text and CSV")
+	}
+	if f.format == formatter.HTMLFormat && f.encoding == formatter.UTF16LEEncoding {
+		return fmt.Errorf("HTML output declares UTF-8; -encoding utf16le only applies to text and CSV")
+	}
+	if f.triggersFile != "" && !f.follow {
+		return fmt.Errorf("-triggers requires -follow")
+	}
+	if f.parallel < 1 {
+		return fmt.Errorf("-parallel must be at least 1")
+	}
+	if f.serviceDrift > 0 && !f.follow {
+		return fmt.Errorf("-service-drift requires -follow")
+	}
+	if f.channelTimeout < 0 || f.runTimeout < 0 {
+		return fmt.Errorf("-channel-timeout and -timeout must not be negative")
+	}
+	if f.runTimeout > 0 && f.follow {
+		return fmt.Errorf("-timeout is not supported in follow mode; use -channel-timeout to bound each pass")
+	}
+	if f.sarifFile != "" && f.follow {
+		return fmt.Errorf("-sarif is not supported in follow mode; the log is written when the run ends")
+	}
+	if f.aggregate && f.follow {
+		return fmt.Errorf("-aggregate is not supported in follow mode")
+	}
+	if f.caseID == "" && (f.analyst != "" || f.caseNotes != "") {
+		return fmt.Errorf("-analyst and -notes require -case")
+	}
+	if f.levelList != "" && f.cacheDir != "" {
+		return fmt.Errorf("-level can't be combined with -cache, whose entries hold every event type")
+	}
+	if f.privacyMode != privacy.ModeOff && f.cacheDir != "" {
+		return fmt.Errorf("-cache can't be combined with -privacy %s: cache files hold the unredacted events in plain text", f.privacyMode)
+	}
+	if f.incremental && (f.follow || f.cacheDir != "") {
+		return fmt.Errorf("-incremental can't be combined with -follow, which always resumes from the checkpoints, or -cache")
+	}
+	if f.sigmaOnly && f.sigmaRules == "" {
+		return fmt.Errorf("-sigma-only requires -sigma")
+	}
+	if f.otlpHeadersFile != "" && f.otlpEndpoint == "" {
+		return fmt.Errorf("-otlp-headers-file requires -otlp-endpoint")
+	}
+	if f.learnAllowlist && f.storeDir == "" {
+		return fmt.Errorf("-allowlist requires -store")
+	}
+	if f.iisLogs != "" && (f.server != "" || f.hostList != "" || f.discoverOU != "") {
+		return fmt.Errorf("-iis-logs only reads the logs of the local computer")
+	}
+	if f.hostList != "" && (f.follow || f.server != "") {
+		return fmt.Errorf("-hosts can't be combined with -follow or -server")
+	}
+	if f.discoverOU != "" && f.follow {
+		return fmt.Errorf("-discover-ou is not supported in follow mode")
+	}
+	fleetRun := f.hostList != "" || f.discoverOU != ""
+	if f.vhdPath != "" && fleetRun {
+		return fmt.Errorf("-vhd is not supported for fleet collection")
+	}
+	if f.incremental && fleetRun {
+		return fmt.Errorf("-incremental is not supported for fleet collection")
+	}
+	if f.format != formatter.TextFormat && fleetRun {
+		return fmt.Errorf("-format %s is not supported with multiple hosts; each host's events are saved to %s", f.format, fleet.EventsFile)
+	}
+	if f.messageLocale != "" {
+		if _, err := eventlog.ParseLocale(f.messageLocale); err != nil {
+			return fmt.Errorf("invalid -message-locale: %v", err)
+		}
+	}
+	if !eventlog.ValidTransport(f.transport) {
+		return fmt.Errorf("invalid transport %q (expected auto, rpc or winrm)", f.transport)
+	}
+	return nil
+}
+
+// newCollector creates the collector of the flags and loads the files they name:
+// tags, field map, filters, detection rules, the group watchlist and sampling rules
+func newCollector(fs *flag.FlagSet, f *collectFlags) (*collector, error) {
+	var since time.Time
+	if f.sinceFlag != "" {
+		window, err := parseWindow(f.sinceFlag)
 		if err != nil {
-			fmt.Printf("Error creating output file: %v\nFalling back to console output.\n", err)
-			output = os.Stdout
-		} else {
-			defer output.Close()
-			fmt.Printf("Logging output to: %s\n", fileName)
+			return nil, fmt.Errorf("invalid -since: %v", err)
 		}
+		since = time.Now().Add(-window)
+	}
+	levels, err := eventlog.ParseLevels(f.levelList)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -level: %v", err)
+	}
+	var caseInfo *eventlog.Case
+	if f.caseID != "" {
+		caseInfo = &eventlog.Case{ID: f.caseID, Analyst: f.analyst, Notes: f.caseNotes}
 	}
+	settings := map[string]string{}
+	fs.VisitAll(func(fl *flag.Flag) {
+		settings[fl.Name] = flagSetting(fl)
+	})
 
-	// Print header
-	header := fmt.Sprintf("Windows Event Log Collection - %s\n", time.Now().Format(time.RFC1123))
-	underline := strings.Repeat("=", len(header)-1) + "\n\n"
-	output.WriteString(header + underline)
+	c := &collector{
+		tags:           f.tags,
+		privacyOpts:    privacy.Options{Mode: f.privacyMode, TruncateLength: f.privacyLength},
+		sigmaOnly:      f.sigmaOnly,
+		domains:        domains.NewTable(),
+		wfpFilters:     wfp.NewResolver(),
+		blocked:        wfp.NewReport(),
+		boots:          boot.NewTimeline(),
+		privileged:     privileges.NewTracker(),
+		findings:       findings.NewCollector(),
+		server:         f.server,
+		transport:      f.transport,
+		since:          since,
+		memoryLimit:    f.maxMemoryMB << 20,
+		spillDir:       f.spillDir,
+		verbose:        f.verbose,
+		locale:         f.messageLocale,
+		render:         f.renderMessages,
+		parallel:       f.parallel,
+		channelTimeout: f.channelTimeout,
+		levels:         levels,
+		caseInfo:       caseInfo,
+		api:            f.eventAPI,
 
-	totalEventsCollected := 0
-	startTime := time.Now()
+		inventory:   f.inventory,
+		diagDir:     f.diagDir,
+		recentLines: diag.NewRing(diag.DefaultLines), // The most recent output lines, for crash diagnostics
+		settings:    settings,
+	}
+
+	if f.tagsFile != "" {
+		if err := c.tags.LoadTagsFile(f.tagsFile); err != nil {
+			return nil, fmt.Errorf("failed to load tags: %v", err)
+		}
+	}
+	if f.fieldMap != "" {
+		if err := eventlog.LoadFieldMap(f.fieldMap); err != nil {
+			return nil, fmt.Errorf("failed to load field map: %v", err)
+		}
+	}
+
+	// Compile custom filters and detection rules
+	for _, source := range f.filterExprs {
+		expr, err := filter.Compile(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -filter: %v", err)
+		}
+		c.filters = append(c.filters, expr)
+	}
+	if f.rulesFile != "" {
+		if c.rules, err = filter.LoadRules(f.rulesFile); err != nil {
+			return nil, fmt.Errorf("failed to load rules: %v", err)
+		}
+	}
+	if f.sigmaRules != "" {
+		if c.sigma, err = detect.Load(f.sigmaRules); err != nil {
+			return nil, fmt.Errorf("failed to load Sigma rules: %v", err)
+		}
+	}
+
+	watchlist := groups.DefaultWatchlist()
+	if f.groupWatchlist != "" {
+		if err := watchlist.LoadWatchlist(f.groupWatchlist); err != nil {
+			return nil, fmt.Errorf("failed to load group watchlist: %v", err)
+		}
+	}
+	c.groups = groups.NewTracker(watchlist)
+
+	if len(f.sampleRules) > 0 {
+		var parsed []sampling.Rule
+		for _, spec := range f.sampleRules {
+			rule, err := sampling.ParseRule(spec)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -sample: %v", err)
+			}
+			parsed = append(parsed, rule)
+		}
+		c.sampler = sampling.NewSampler(parsed)
+	}
+	return c, nil
+}
+
+// close releases what the collector holds open: message renderers, the trigger
+// output, the audit log and the WFP engine handles
+func (c *collector) close() {
+	c.closeMessages()
+	c.triggers.Close()
+	c.audit.Close()
+	c.wfpFilters.Close()
+}
 
-	// Process channels
+// fleetHosts returns the computers of -hosts and those found below -discover-ou,
+// or nil when collecting from one computer
+func (f *collectFlags) fleetHosts(identity *runas.Identity) ([]string, error) {
+	var hosts []string
+	if f.hostList != "" {
+		var err error
+		if hosts, err = parseHosts(f.hostList); err != nil {
+			return nil, err
+		}
+	}
+	if f.discoverOU != "" {
+		discovered, err := discoverHosts(f.discoverOU, f.discoverDC, identity, f.discoverTimeout, f.discoverParallel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover computers: %v", err)
+		}
+		hosts = append(hosts, discovered...)
+	}
+	return hosts, nil
+}
+
+// openDestinations sets up where events go besides the report: the network sink,
+// the OpenTelemetry export, the local store and the allowlist kept in it
+func (c *collector) openDestinations(f *collectFlags) error {
+	var err error
+	if f.sinkURL != "" {
+		sinkOpts := sink.DefaultOptions()
+		sinkOpts.BatchSize = f.sinkBatch
+		sinkOpts.Gzip = f.sinkGzip
+		sinkOpts.SpoolDir = f.sinkSpool
+		sinkOpts.Spool.Encrypt = f.spoolEncrypt
+		sinkOpts.Spool.MaxBytes = f.spoolMaxMB << 20
+		if c.sink, err = sink.New(f.sinkURL, sinkOpts); err != nil {
+			return fmt.Errorf("failed to create sink: %v", err)
+		}
+	}
+
+	if f.otlpEndpoint != "" {
+		headers, err := otlpHeaders(f.otlpHeadersFile)
+		if err != nil {
+			return err
+		}
+		c.telemetry, err = telemetry.New(telemetry.Options{
+			Endpoint: f.otlpEndpoint,
+			Headers:  headers,
+			Interval: f.otlpInterval,
+			Resource: map[string]string{
+				"service.name":    "datn",
+				"service.version": eventlog.CollectorVersion,
+				"host.name":       c.host(),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set up telemetry: %v", err)
+		}
+	}
+
+	if f.storeDir != "" {
+		if c.store, err = store.Open(f.storeDir); err != nil {
+			return fmt.Errorf("failed to open store: %v", err)
+		}
+	}
+	if f.learnAllowlist {
+		if c.allowlist, err = allowlist.Open(f.storeDir, f.allowlistBaseline, time.Now()); err != nil {
+			return fmt.Errorf("failed to open allowlist: %v", err)
+		}
+		if c.allowlist.Learning(time.Now()) {
+			fmt.Printf("Allowlist: learning executables until %s\n", c.allowlist.LearnUntil().Local().Format(time.RFC1123))
+		}
+	}
+	return nil
+}
+
+// selectChannels returns the channels to collect from: those picked interactively,
+// or the catalogued channels filtered by -available and -channel
+func (f *collectFlags) selectChannels(channelConfigs []config.ChannelConfig, picked []string) []config.ChannelConfig {
+	var selectedChannels []config.ChannelConfig
 	for _, channelConfig := range channelConfigs {
+		// Channels picked interactively replace -available and -channel
+		if picked != nil {
+			if slices.ContainsFunc(picked, func(name string) bool { return strings.EqualFold(name, channelConfig.Name) }) {
+				selectedChannels = append(selectedChannels, channelConfig)
+			}
+			continue
+		}
+
 		// Skip if not available and we only want available channels
-		if *onlyAvailable && !channelConfig.Available {
+		if f.onlyAvailable && !channelConfig.Available {
 			continue
 		}
 
 		// Skip if we're looking for a specific channel and this isn't it
-		if *specificChannel != "" && !strings.EqualFold(channelConfig.Name, *specificChannel) {
+		if f.specificChannel != "" && !strings.EqualFold(channelConfig.Name, f.specificChannel) {
 			continue
 		}
 
-		collectionMsg := fmt.Sprintf("\nCollecting logs from %s channel (Purpose: %s)...\n",
-			channelConfig.Name, channelConfig.Purpose)
-		output.WriteString(collectionMsg)
+		selectedChannels = append(selectedChannels, channelConfig)
+	}
+	// Channels outside the catalog, such as the generate command's test log, are read in full
+	if picked == nil && f.specificChannel != "" && !catalogued(channelConfigs, f.specificChannel) {
+		selectedChannels = append(selectedChannels, config.ChannelConfig{
+			Name:      f.specificChannel,
+			Purpose:   "Requested channel",
+			Available: true,
+		})
+	}
+	return selectedChannels
+}
 
-		// Create event ID list string for display
-		eventIDStrings := make([]string, len(channelConfig.EventIDs))
-		for i, id := range channelConfig.EventIDs {
-			eventIDStrings[i] = strconv.FormatUint(uint64(id), 10)
-		}
-		eventIDsStr := strings.Join(eventIDStrings, ", ")
-		output.WriteString(fmt.Sprintf("Looking for Event IDs: %s\n", eventIDsStr))
+// openOutput opens the report file of -out, or one in a new run directory, and
+// returns it with the run directory and whether the report already has content.
+// With -out console or - the report goes to stdout and there is no run directory.
+func (f *collectFlags) openOutput(stdout *os.File) (output *os.File, runDir string, appending bool, err error) {
+	if f.outputFile == "console" || f.outputFile == "-" {
+		return stdout, "", false, nil
+	}
+	extension := ".log"
+	switch f.format {
+	case formatter.JSONFormat:
+		extension = ".jsonl"
+	case formatter.CSVFormat:
+		extension = ".csv"
+	case formatter.HTMLFormat:
+		extension = ".html"
+	}
+	file, fileName, err := openReport(f.outputFile, f.outDir, f.runDirName, extension, appendReport(f.appendOutput, f.follow, f.outputFile))
+	if err != nil {
+		return nil, "", false, err
+	}
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		appending = true
+	}
+	fmt.Printf("Logging output to: %s\n", fileName)
+	return file, filepath.Dir(fileName), appending, nil
+}
 
-		// Collect logs
-		logs, err := eventlog.CollectWindowsEventLogs(channelConfig.Name, *maxEvents, channelConfig.EventIDs)
+// openReport prepares the report for the -format, -aggregate and -sarif outputs
+func (c *collector) openReport(f *collectFlags, report *formatter.StreamWriter, appending, fleet bool) error {
+	if f.format != formatter.TextFormat {
+		c.eventsOut = report
+		c.format = f.format
+		if f.format == formatter.CSVFormat && !appending {
+			header := formatter.CSVHeader()
+			if f.aggregate {
+				header = formatter.AggregateCSVHeader()
+			}
+			report.WriteString(header)
+		}
+		if f.format == formatter.HTMLFormat {
+			c.html = formatter.NewHTMLWriter(fmt.Sprintf("Windows Event Log Collection - %s - %s", c.host(), time.Now().Format(time.RFC1123)))
+		}
+	}
+	if f.aggregate {
+		c.aggregated = dedup.NewTable()
+	}
+	if f.sarifFile != "" {
+		c.sarif = sarif.NewReport()
+		for _, rule := range c.sigma.Rules() {
+			c.sarif.Describe(sarif.Rule{Name: rule.Title, ID: rule.ID, Description: rule.Description, Level: rule.Level, Tags: rule.Tags})
+		}
+	}
+	if !fleet {
+		if err := c.openMessages(); err != nil {
+			return fmt.Errorf("failed to open message renderer: %v", err)
+		}
+	}
+	return nil
+}
 
+// openState opens what the run reads and records besides events: the crash index,
+// IIS logs, raw bundle, triggers, audit log, -incremental checkpoints and cache
+func (c *collector) openState(fs *flag.FlagSet, f *collectFlags, fleet bool) error {
+	var err error
+	if f.indexCrashes {
+		// Fleet hosts are indexed on their first crash event
+		c.crashes = crashes.NewIndex()
+		if !fleet {
+			c.crashes.Scan(f.server)
+		}
+	}
+	if f.iisLogs != "" {
+		c.iis = iislog.NewReader(f.iisLogs)
+	}
+	if f.rawBundle != "" {
+		c.bundle = &privacy.RawBundle{}
+	}
+	if f.triggersFile != "" {
+		triggers, err := trigger.Load(f.triggersFile)
 		if err != nil {
-			errMsg := fmt.Sprintf("Error collecting logs from %s: %v\n", channelConfig.Name, err)
-			output.WriteString(errMsg)
-			continue
+			return fmt.Errorf("failed to load triggers: %v", err)
+		}
+		if c.triggers, err = trigger.NewRunner(triggers, f.triggerOut); err != nil {
+			return fmt.Errorf("failed to open trigger output: %v", err)
+		}
+	}
+	if f.auditLog != "" {
+		var warnings []string
+		// Collection must not depend on the log, so a run that can't write it goes on without
+		if c.audit, warnings, err = audit.Open(f.auditLog); err != nil {
+			fmt.Printf("Warning: failed to open audit log, continuing without one: %v\n", err)
+			c.audit = nil
+		}
+		for _, warning := range warnings {
+			fmt.Printf("Warning: %s\n", warning)
 		}
+		var changed []string
+		fs.Visit(func(fl *flag.Flag) {
+			changed = append(changed, "-"+fl.Name+"="+flagSetting(fl))
+		})
+		account := "the current user"
+		if c.identity != nil {
+			account = c.identity.String()
+		}
+		c.recordAudit(audit.ActionStart, "version %s as %s, flags: %s", eventlog.CollectorVersion, account, strings.Join(changed, " "))
+	}
+	if f.incremental {
+		if c.checkpoints, err = eventlog.LoadCheckpoints(f.checkpointFile); err != nil {
+			return fmt.Errorf("failed to load checkpoints: %v", err)
+		}
+	}
+	if f.cacheDir != "" {
+		if c.cache, err = cache.Open(f.cacheDir); err != nil {
+			return fmt.Errorf("failed to open cache: %v", err)
+		}
+	}
+	return nil
+}
 
-		// Format and write the logs
-		formattedLogs := formatter.FormatLogChannel(channelConfig.Name, logs)
-		output.WriteString(formattedLogs)
+// writeHeader writes the report header: the time, tags, case, Sigma rules, remote
+// computer, self-check warnings and privacy mode
+func (c *collector) writeHeader(f *collectFlags, selfCheckWarnings []string) {
+	header := fmt.Sprintf("Windows Event Log Collection - %s\n", time.Now().Format(time.RFC1123))
+	underline := strings.Repeat("=", len(header)-1) + "\n\n"
+	c.output.WriteString(header + underline)
+	if len(c.tags) > 0 {
+		c.output.WriteString(fmt.Sprintf("Tags: %s\n", c.tags.String()))
+	}
+	c.output.WriteString(formatter.FormatCase(c.caseInfo))
+	if c.sigma != nil {
+		c.output.WriteString(fmt.Sprintf("Sigma rules: %d loaded, %d skipped\n", c.sigma.Len(), len(c.sigma.Skipped())))
+		if c.verbose {
+			for _, skipped := range c.sigma.Skipped() {
+				c.output.WriteString(fmt.Sprintf("  Skipped %s\n", skipped))
+			}
+		}
+	}
+	if c.server != "" {
+		c.output.WriteString(fmt.Sprintf("Remote computer: %s (transport: %s)\n", c.server, c.transport))
+	}
+	for _, warning := range selfCheckWarnings {
+		c.output.WriteString(fmt.Sprintf("Self-check warning: %s\n", warning))
+	}
+	if c.privacyOpts.Enabled() {
+		c.output.WriteString(fmt.Sprintf("Privacy mode: %s (command lines and script blocks are redacted)\n", c.privacyOpts.Mode))
+	}
+}
 
-		totalEventsCollected += len(logs)
+// followOptions returns the options of follow mode; service is nil unless running
+// under the service control manager
+func (f *collectFlags) followOptions(service *windowsService) followOptions {
+	var stop chan os.Signal
+	if service != nil {
+		stop = service.stop
+	}
+	return followOptions{
+		interval:       f.followInterval,
+		checkpointPath: f.checkpointFile,
+		drainTimeout:   f.drainTimeout,
+		healthPath:     f.healthFile,
+		healthAddr:     f.healthAddr,
+		apiAuth: api.AuthOptions{
+			CertFile:     f.apiCert,
+			KeyFile:      f.apiKey,
+			ClientCAFile: f.apiClientCA,
+			TokensFile:   f.apiTokens,
+			Allow:        f.apiAllow,
+			PolicyFile:   f.apiPolicy,
+		},
+		retention:    retentionPolicy(f.storeMaxDays, f.storeMaxMB),
+		serviceDrift: f.serviceDrift,
+		stop:         stop,
 	}
+}
 
-	// Write summary
-	duration := time.Since(startTime)
+// collectOnce reads the selected channels once, of every host in a fleet run,
+// delivers what is queued for the sink and applies the store retention. It
+// returns the number of events collected.
+func (c *collector) collectOnce(f *collectFlags, hosts []string, channels []config.ChannelConfig, startTime time.Time) int {
+	if f.runTimeout > 0 {
+		c.runDeadline = startTime.Add(f.runTimeout)
+	}
+
+	// Process channels, on every discovered host when running against a fleet
+	total := 0
+	c.runSpan = c.telemetry.StartSpan("run", nil)
+	if len(hosts) > 0 {
+		fleetDir := f.outDir
+		if fleetDir == "" {
+			fleetDir = defaultFleetDir
+		}
+		fmt.Printf("Writing per-host outputs to: %s\n", fleetDir)
+		total = c.collectHosts(hosts, channels, f.maxEvents, fleetDir)
+	} else {
+		total, _ = c.collectChannels(channels, f.maxEvents)
+		total += c.collectIIS(c.since, f.maxEvents)
+		if err := c.checkpoints.Save(); err != nil {
+			c.output.WriteString(fmt.Sprintf("Error saving checkpoints: %v\n", err))
+		}
+	}
+	if c.html != nil {
+		if err := c.html.Close(c.eventsOut); err != nil {
+			c.output.WriteString(fmt.Sprintf("Error writing the end of the HTML report: %v\n", err))
+		}
+	}
+
+	// Deliver anything still queued for the sink
+	if c.sink != nil {
+		if err := c.sink.Close(); err != nil {
+			c.output.WriteString(fmt.Sprintf("Error flushing sink: %v\n", err))
+		}
+	}
+
+	c.applyRetention(retentionPolicy(f.storeMaxDays, f.storeMaxMB))
+
+	// Export the run's span with the totals and whatever telemetry is still buffered
+	c.runSpan.SetAttribute("events", total)
+	c.runSpan.SetAttribute("channels", len(channels))
+	c.runSpan.SetAttribute("hosts", max(len(hosts), 1))
+	c.runSpan.End()
+	if err := c.telemetry.Close(); err != nil {
+		c.output.WriteString(fmt.Sprintf("Warning: %v\n", err))
+	}
+	return total
+}
+
+// summary formats the summary written at the end of a one-shot run
+func (c *collector) summary(f *collectFlags, totalEventsCollected int, duration time.Duration) string {
 	summary := fmt.Sprintf("\nSummary\n-------\n")
 	summary += fmt.Sprintf("Total events collected: %d\n", totalEventsCollected)
 	summary += fmt.Sprintf("Duration: %v\n", duration)
-	output.WriteString(summary)
+	for channel, n := range c.sampler.Dropped() {
+		summary += fmt.Sprintf("Sampled out from %s: %d\n", channel, n)
+	}
+	for _, gap := range c.coverageGaps {
+		summary += fmt.Sprintf("Coverage gap: %s\n", gap)
+	}
+	if len(c.timedOut) > 0 {
+		summary += fmt.Sprintf("Timed out (partial or skipped): %s\n", strings.Join(c.timedOut, ", "))
+	}
+	if len(c.tags) > 0 {
+		summary += fmt.Sprintf("Tags: %s\n", c.tags.String())
+	}
+	summary += formatter.FormatCase(c.caseInfo)
+	if c.findings.Len() > 0 {
+		summary += formatter.FormatFindings(c.findings.Findings())
+	}
+	if sightings := c.allowlist.Sightings(); len(sightings) > 0 {
+		summary += formatter.FormatFirstSeen(sightings)
+	}
+	if c.groups.Len() > 0 {
+		summary += formatter.FormatGroupChanges(c.groups.Changes())
+	}
+	if c.privileged.Len() > 0 {
+		summary += formatter.FormatPrivilegedAccounts(c.privileged.Accounts())
+	}
+	if c.blocked.Len() > 0 {
+		summary += formatter.FormatBlockedConnections(c.blocked.Blocks())
+	}
+	if c.boots.Len() > 0 {
+		summary += formatter.FormatBootTimeline(c.boots.Entries(), c.boots.Stats())
+	}
+	if c.crashes.Len() > 0 {
+		summary += formatter.FormatCrashes(c.crashes.Entries())
+	}
+	if c.domains.Len() > 0 {
+		summary += formatter.FormatDomainTable(c.domains.Domains(), f.domainRows)
+	}
+	if c.verbose && len(c.timings) > 0 {
+		summary += formatter.FormatTimings(c.timings)
+	}
+	if head := c.audit.Head(); head != nil {
+		summary += fmt.Sprintf("Audit log: %s (record %d, sha256 %s)\n", head.Path, head.Seq, head.Hash)
+	}
+	return summary
+}
 
-	if *outputFile != "" {
-		fmt.Printf("Collection complete. Collected %d events in %v.\n", totalEventsCollected, duration)
+// writeArtifacts writes the files of a one-shot run besides the report: the SARIF
+// log and the encrypted raw bundle
+func (c *collector) writeArtifacts(f *collectFlags) {
+	if c.sarif != nil {
+		if err := c.sarif.Write(f.sarifFile); err != nil {
+			fmt.Printf("Error writing SARIF log: %v\n", err)
+		} else {
+			fmt.Printf("Detections written to SARIF log: %s (%d results)\n", f.sarifFile, c.sarif.Len())
+		}
+	}
+
+	if c.bundle != nil {
+		if err := c.bundle.WriteEncrypted(f.rawBundle, os.Getenv("DATN_RAW_KEY")); err != nil {
+			fmt.Printf("Error writing raw bundle: %v\n", err)
+		} else {
+			fmt.Printf("Raw events written to encrypted bundle: %s\n", f.rawBundle)
+		}
+	}
+}
+
+// parseWindow parses a collection window: a Go duration or a number of days ("7d")
+func parseWindow(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
 	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("window must be positive")
+	}
+	return d, nil
+}
+
+// catalogued reports whether a channel is in the channel configuration
+func catalogued(channels []config.ChannelConfig, name string) bool {
+	for _, channelConfig := range channels {
+		if strings.EqualFold(channelConfig.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// otlpHeaders reads the headers sent to the OTLP receiver from DATN_OTLP_HEADERS,
+// NAME=VALUE pairs separated by commas, and from the NAME=VALUE lines of a file,
+// which take precedence. They often hold API keys, so they never come from flags.
+func otlpHeaders(path string) (map[string]string, error) {
+	headers := map[string]string{}
+	set := func(header string) error {
+		name, value, ok := strings.Cut(header, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("expected NAME=VALUE")
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		return nil
+	}
+
+	if env := os.Getenv("DATN_OTLP_HEADERS"); env != "" {
+		for _, header := range strings.Split(env, ",") {
+			if err := set(header); err != nil {
+				return nil, fmt.Errorf("invalid header in DATN_OTLP_HEADERS: %v", err)
+			}
+		}
+	}
+	if path == "" {
+		return headers, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OTLP headers file %s: %v", path, err)
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := set(line); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid header: %v", path, i+1, err)
+		}
+	}
+	return headers, nil
+}
+
+// stringList collects the values of a repeatable string flag
+type stringList []string
+
+// String returns the values joined with commas
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+// Set appends a value
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
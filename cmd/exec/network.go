@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/netprofile"
+	"lemita/datn/pkg/store"
+)
+
+// networkReport is the JSON output of the network subcommand
+type networkReport struct {
+	Profiles    []netprofile.Profile    `json:"profiles"`
+	VPNEntries  []netprofile.VPNEntry   `json:"vpn_entries"`
+	Connections []netprofile.Connection `json:"connections"`
+}
+
+// runNetwork implements the network subcommand: it reports the networks a computer
+// has connected to, from the network list and VPN phonebooks, and the WLAN and VPN
+// connection history of its event logs, for tracing where a laptop has been
+func runNetwork(args []string) int {
+	fs := flag.NewFlagSet("network", flag.ExitOnError)
+	server := fs.String("server", "", "Examine this remote computer (Remote Registry, admin share and remote event log access)")
+	var eventFiles stringList
+	fs.Var(&eventFiles, "events", "Also use the connection events of this saved JSONL file or store directory (repeatable)")
+	noEvents := fs.Bool("no-events", false, "Don't read the event logs of the computer")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s network [flags]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var report networkReport
+	exitCode := 0
+
+	var err error
+	report.Profiles, err = netprofile.ListProfilesOn(*server)
+	if err != nil {
+		fmt.Printf("Error reading network profiles: %v\n", err)
+		exitCode = 1
+	}
+	sort.Slice(report.Profiles, func(i, j int) bool {
+		return report.Profiles[i].LastConnected.After(report.Profiles[j].LastConnected)
+	})
+	report.VPNEntries, err = netprofile.ListVPNEntriesOn(*server)
+	if err != nil {
+		fmt.Printf("Error reading VPN phonebooks: %v\n", err)
+		exitCode = 1
+	}
+
+	var events []eventlog.EventLogData
+	if !*noEvents {
+		sources := []struct {
+			channel  string
+			eventIDs []uint32
+		}{
+			{netprofile.WLANChannel, []uint32{8001, 8002, 8003}},
+			{"Application", []uint32{20225, 20226, 20227}},
+		}
+		for _, source := range sources {
+			result, err := eventlog.CollectWithOptions(source.channel, eventlog.CollectOptions{
+				EventIDs: source.eventIDs,
+				Server:   *server,
+			})
+			if err != nil {
+				fmt.Printf("Error reading %s: %v\n", source.channel, err)
+				exitCode = 1
+				continue
+			}
+			events = append(events, result.Events...)
+		}
+	}
+	for _, path := range eventFiles {
+		err := store.ScanPath(path, func(event eventlog.EventLogData) error {
+			events = append(events, event)
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Error reading %s: %v\n", path, err)
+			exitCode = 1
+		}
+	}
+	report.Connections = netprofile.History(events, report.VPNEntries)
+
+	if *asJSON {
+		if code := printJSON(report); code != 0 {
+			return code
+		}
+		return exitCode
+	}
+
+	fmt.Printf("Known networks: %d\n", len(report.Profiles))
+	for _, p := range report.Profiles {
+		fmt.Printf("  %-16s %-32s created %s, last connected %s\n", p.Kind, p.Name,
+			formatReportTime(p.Created), formatReportTime(p.LastConnected))
+	}
+
+	fmt.Printf("\nVPN connections: %d\n", len(report.VPNEntries))
+	for _, e := range report.VPNEntries {
+		fmt.Printf("  %-32s %-30s %s\n", e.Name, e.Server, e.Phonebook)
+	}
+
+	fmt.Printf("\nConnection history: %d events\n", len(report.Connections))
+	for _, c := range report.Connections {
+		line := fmt.Sprintf("  %s  %-8s %-12s %s", formatReportTime(c.Time), c.Kind, c.Event, c.Name)
+		if c.Endpoint != "" {
+			line += " (" + c.Endpoint + ")"
+		}
+		if c.User != "" {
+			line += " by " + c.User
+		}
+		if c.Detail != "" {
+			line += ", reason " + c.Detail
+		}
+		fmt.Println(line)
+	}
+	return exitCode
+}
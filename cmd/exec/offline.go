@@ -0,0 +1,229 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/config"
+	"lemita/datn/pkg/diag"
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/evtx"
+	"lemita/datn/pkg/filesenum"
+	"lemita/datn/pkg/filter"
+	"lemita/datn/pkg/findings"
+	"lemita/datn/pkg/fleet"
+	"lemita/datn/pkg/formatter"
+	"lemita/datn/pkg/groups"
+	"lemita/datn/pkg/offline"
+	"lemita/datn/pkg/privileges"
+)
+
+// runOffline implements the offline subcommand: it reads the event logs and the
+// service configuration of a Windows volume that is not running, such as a disk
+// image mounted as a drive letter, through the same parsers, detections and report
+// as a live collection
+func runOffline(args []string) int {
+	fs := flag.NewFlagSet("offline", flag.ExitOnError)
+	channelsFile := fs.String("config", "", "YAML, JSON or TOML file of the channels to read (default: the built-in channels)")
+	all := fs.Bool("all", false, "Read every event of every log of the image, not only the configured channels and event IDs")
+	window := fs.String("since", "", "Only keep events from this far before the newest event of the image, e.g. 36h or 7d")
+	var filterExprs stringList
+	fs.Var(&filterExprs, "filter", "Only keep events matching this expression (repeatable)")
+	rulesFile := fs.String("rules", "", "File of \"name: expression\" detection rules to evaluate")
+	inventoryDir := fs.String("inventory", "", "Also write the services of the image as JSON to this directory")
+	outputFile := fs.String("out", "", "Write the report to this file (default: console)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s offline [flags] ROOT\n\nROOT is the folder or drive letter the Windows volume is mounted at, e.g. E:\\\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	image, err := offline.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 2
+	}
+	channels, err := config.LoadChannelConfigs(*channelsFile)
+	if err != nil {
+		fmt.Printf("Error loading channels: %v\n", err)
+		return 2
+	}
+	var duration time.Duration
+	if *window != "" {
+		if duration, err = parseWindow(*window); err != nil {
+			fmt.Printf("Invalid -since: %v\n", err)
+			return 2
+		}
+	}
+
+	c := &collector{
+		recentLines: diag.NewRing(diag.DefaultLines),
+		diagDir:     diag.DefaultDir(),
+		detections:  map[string]int{},
+		groups:      groups.NewTracker(groups.DefaultWatchlist()),
+		privileged:  privileges.NewTracker(),
+		findings:    findings.NewCollector(),
+	}
+	for _, source := range filterExprs {
+		expr, err := filter.Compile(source)
+		if err != nil {
+			fmt.Printf("Error in -filter: %v\n", err)
+			return 2
+		}
+		c.filters = append(c.filters, expr)
+	}
+	if *rulesFile != "" {
+		if c.rules, err = filter.LoadRules(*rulesFile); err != nil {
+			fmt.Printf("Error loading rules: %v\n", err)
+			return 2
+		}
+	}
+
+	output := os.Stdout
+	if *outputFile != "" {
+		file, err := os.Create(*outputFile)
+		if err != nil {
+			fmt.Printf("Error creating output file: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		output = file
+	}
+	c.output = diag.NewTee(output, c.recentLines)
+
+	header := fmt.Sprintf("Offline Windows Event Log Collection - %s\n", image.Root())
+	c.output.WriteString(header + strings.Repeat("=", len(header)-1) + "\n\n")
+
+	exitCode := 0
+	logs, err := image.EventLogs()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	collected := 0
+	for _, path := range logs {
+		channel := offline.ChannelOfFile(path)
+		wanted, ok := offlineChannel(channels, channel)
+		if !ok && !*all {
+			continue
+		}
+		events, err := readOfflineLog(path, wanted, *all)
+		if err != nil {
+			fmt.Printf("Error reading %s: %v\n", path, err)
+			exitCode = 1
+		}
+		if duration > 0 {
+			events = withinWindow(events, duration)
+		}
+		for start := 0; start < len(events); start += replayBatchSize {
+			batch := events[start:min(start+replayBatchSize, len(events))]
+			c.guard(channel, func() {
+				c.handleEvents(channel, batch)
+			})
+		}
+		collected += len(events)
+	}
+
+	services, err := image.ListServices()
+	if err != nil {
+		fmt.Printf("Error listing services: %v\n", err)
+		exitCode = 1
+	}
+	if *inventoryDir != "" && services != nil {
+		if err := os.MkdirAll(*inventoryDir, 0700); err != nil {
+			fmt.Printf("Error creating %s: %v\n", *inventoryDir, err)
+			exitCode = 1
+		} else if err := writeJSON(filepath.Join(*inventoryDir, fleet.ServicesFile), services); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exitCode = 1
+		}
+	}
+
+	summary := "\nSummary:\n"
+	summary += fmt.Sprintf("Read %d events from %d logs of %s\n", collected, len(logs), image.Root())
+	if len(c.rules) > 0 {
+		summary += fmt.Sprintf("Detections: %d rules matched\n", len(c.detections))
+	}
+	if c.findings.Len() > 0 {
+		summary += formatter.FormatFindings(c.findings.Findings())
+	}
+	if c.groups.Len() > 0 {
+		summary += formatter.FormatGroupChanges(c.groups.Changes())
+	}
+	if c.privileged.Len() > 0 {
+		summary += formatter.FormatPrivilegedAccounts(c.privileged.Accounts())
+	}
+	if len(services) > 0 {
+		summary += formatOfflineServices(services)
+	}
+	c.output.WriteString(summary)
+	return exitCode
+}
+
+// offlineChannel returns the event IDs configured for a channel, and whether it
+// is configured at all
+func offlineChannel(channels []config.ChannelConfig, name string) ([]uint32, bool) {
+	for _, channelConfig := range channels {
+		if strings.EqualFold(channelConfig.Name, name) {
+			return channelConfig.EventIDs, true
+		}
+	}
+	return nil, false
+}
+
+// readOfflineLog decodes an .evtx file of the image, keeping the events with one
+// of the wanted IDs, or all of them when all is set or no IDs are configured.
+// Events decoded before an error are returned with it.
+func readOfflineLog(path string, wanted []uint32, all bool) ([]eventlog.EventLogData, error) {
+	var events []eventlog.EventLogData
+	skipped, err := evtx.Scan(path, func(event eventlog.EventLogData) error {
+		if all || len(wanted) == 0 || slices.Contains(wanted, event.EventID) {
+			if event.UID == "" {
+				event.UID = eventlog.StableID(event)
+			}
+			events = append(events, event)
+		}
+		return nil
+	})
+	if skipped > 0 {
+		fmt.Printf("Skipped %d undecodable records of %s\n", skipped, path)
+	}
+	return events, err
+}
+
+// withinWindow keeps the events generated in the window before the newest one. An
+// image is examined after the fact, so the window ends at its last event rather
+// than now.
+func withinWindow(events []eventlog.EventLogData, window time.Duration) []eventlog.EventLogData {
+	var newest uint32
+	for _, event := range events {
+		newest = max(newest, event.TimeGenerated)
+	}
+	since := time.Unix(int64(newest), 0).Add(-window).Unix()
+	kept := events[:0]
+	for _, event := range events {
+		if int64(event.TimeGenerated) >= since {
+			kept = append(kept, event)
+		}
+	}
+	return kept
+}
+
+// formatOfflineServices formats the services configured in an image
+func formatOfflineServices(services []filesenum.PEInfo) string {
+	result := fmt.Sprintf("\nServices (%d):\n", len(services))
+	for _, service := range services {
+		result += fmt.Sprintf("  %-30s %s\n", service.Service, service.FilePath)
+		result += fmt.Sprintf("  %-30s sha256 %s\n", "", service.Hash)
+	}
+	return result
+}
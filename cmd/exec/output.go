@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/instance"
+)
+
+// defaultFleetDir is where fleet runs are written when -outdir is not given
+const defaultFleetDir = "datn-fleet"
+
+// runName returns the directory name of a one-shot run: the given name, or
+// datn-<computer>-<timestamp>
+func runName(name string, started time.Time) string {
+	if name != "" {
+		return name
+	}
+	computer, err := os.Hostname()
+	if err != nil || computer == "" {
+		computer = "localhost"
+	}
+	return fmt.Sprintf("datn-%s-%s", strings.ToLower(computer), started.Format("20060102-150405"))
+}
+
+// openReport opens the report file. An explicit path is used as given; otherwise the
+// report goes to report<extension> in a run directory below outDir (empty = the
+// current directory). An existing report is only written to in append mode, so an
+// earlier run is never overwritten.
+func openReport(path, outDir, name, extension string, appendMode bool) (*os.File, string, error) {
+	if path == "" {
+		dir := filepath.Join(outDir, runName(name, time.Now()))
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, "", fmt.Errorf("failed to create run directory %s: %v", dir, err)
+		}
+		path = filepath.Join(dir, "report"+extension)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if appendMode {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0600)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, path, fmt.Errorf("%s already exists (use -append to add to it)", path)
+	}
+	if err != nil {
+		return nil, path, fmt.Errorf("failed to create output file %s: %v", path, err)
+	}
+	return file, path, nil
+}
+
+// appendReport reports whether the report is opened in append mode: with -append,
+// or in follow mode with an explicit -out, since a restarted daemon resumes from its
+// checkpoints and continues the same report
+func appendReport(appendFlag, follow bool, path string) bool {
+	return appendFlag || (follow && path != "")
+}
+
+// lockCheckpoints takes the instance lock of a checkpoint file or registry key
+func lockCheckpoints(path string) (*instance.Lock, error) {
+	lock, err := eventlog.LockCheckpoints(path)
+	if errors.Is(err, instance.ErrRunning) {
+		return nil, fmt.Errorf("another run is already using the checkpoints in %s; wait for it to finish or pass -force", path)
+	}
+	return lock, err
+}
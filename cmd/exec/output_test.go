@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenReportFollowRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "datn.log")
+	for run, line := range []string{"first run\n", "second run\n"} {
+		file, _, err := openReport(path, "", "", ".log", appendReport(false, true, path))
+		if err != nil {
+			t.Fatalf("run %d: %v", run+1, err)
+		}
+		if _, err := file.WriteString(line); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "first run\nsecond run\n" {
+		t.Errorf("report = %q, want both runs appended", got)
+	}
+}
+
+func TestOpenReportRefusesOverwrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.log")
+	if err := os.WriteFile(path, []byte("earlier run\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := openReport(path, "", "", ".log", appendReport(false, false, path))
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("openReport = %v, want an already exists error", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "earlier run\n" {
+		t.Errorf("report = %q, want it untouched", data)
+	}
+}
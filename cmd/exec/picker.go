@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"lemita/datn/pkg/config"
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/formatter"
+)
+
+// picker asks the operator what to collect, one prompt at a time
+type picker struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+// runPicker lists the catalogued channels of server with their record counts and
+// prompts for the channels, time range, output format and output file. The answers
+// are applied to the -since, -format and -out flags of fs; the chosen channel names
+// are returned, or nil when the operator cancels.
+func runPicker(in io.Reader, out io.Writer, fs *flag.FlagSet, server string, catalog []config.ChannelConfig) []string {
+	p := &picker{in: bufio.NewScanner(in), out: out}
+
+	fmt.Fprintln(out, "Channels:")
+	counts := make([]uint32, len(catalog))
+	for i, channelConfig := range catalog {
+		state, err := eventlog.ProbeLog(server, channelConfig.Name, 0)
+		status := fmt.Sprintf("%d records", state.Count)
+		if err != nil {
+			status = "not available"
+		}
+		counts[i] = state.Count
+		fmt.Fprintf(out, "  %2d. %-55s %s\n      %s\n", i+1, channelConfig.Name, status, channelConfig.Purpose)
+	}
+
+	var picked []string
+	for picked == nil {
+		answer, ok := p.ask("Channels to collect (e.g. 1,3,5-7 or all; blank = every channel with records)")
+		if !ok {
+			return nil
+		}
+		var err error
+		if picked, err = pickChannels(answer, catalog, counts); err != nil {
+			fmt.Fprintf(out, "  %v\n", err)
+		}
+	}
+
+	for {
+		answer, ok := p.ask("Collect events from how far back (e.g. 24h or 7d; blank = everything retained)")
+		if !ok {
+			return nil
+		}
+		if answer == "" {
+			break
+		}
+		if _, err := parseWindow(answer); err != nil {
+			fmt.Fprintf(out, "  %v\n", err)
+			continue
+		}
+		fs.Set("since", answer)
+		break
+	}
+
+	for {
+		answer, ok := p.ask("Output format, text, json, csv or html (blank = text)")
+		if !ok {
+			return nil
+		}
+		if answer == "" {
+			break
+		}
+		if !formatter.ValidFormat(answer) {
+			fmt.Fprintf(out, "  %q is not text, json, csv or html\n", answer)
+			continue
+		}
+		fs.Set("format", answer)
+		break
+	}
+
+	answer, ok := p.ask("Output file (blank = a new run directory, console = this window)")
+	if !ok {
+		return nil
+	}
+	if answer != "" {
+		fs.Set("out", answer)
+	}
+
+	fmt.Fprintf(out, "\nCollecting %d channels: %s\n", len(picked), strings.Join(picked, ", "))
+	answer, ok = p.ask("Start? [Y/n]")
+	if !ok || strings.HasPrefix(strings.ToLower(answer), "n") {
+		return nil
+	}
+	return picked
+}
+
+// ask prints a prompt and returns the trimmed answer; ok is false at end of input
+func (p *picker) ask(prompt string) (answer string, ok bool) {
+	fmt.Fprintf(p.out, "\n%s: ", prompt)
+	if !p.in.Scan() {
+		return "", false
+	}
+	return strings.TrimSpace(p.in.Text()), true
+}
+
+// pickChannels resolves a selection such as "1,3,5-7" against the listed channels
+func pickChannels(answer string, catalog []config.ChannelConfig, counts []uint32) ([]string, error) {
+	picked := []string{}
+	switch strings.ToLower(answer) {
+	case "":
+		for i, channelConfig := range catalog {
+			if counts[i] > 0 {
+				picked = append(picked, channelConfig.Name)
+			}
+		}
+		if len(picked) == 0 {
+			return nil, fmt.Errorf("no channel has records")
+		}
+		return picked, nil
+	case "all":
+		for _, channelConfig := range catalog {
+			picked = append(picked, channelConfig.Name)
+		}
+		return picked, nil
+	}
+
+	chosen := make([]bool, len(catalog))
+	for _, part := range strings.Split(answer, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, err := strconv.Atoi(strings.TrimSpace(first))
+		to := from
+		if err == nil && isRange {
+			to, err = strconv.Atoi(strings.TrimSpace(last))
+		}
+		if err != nil || from < 1 || to > len(catalog) || from > to {
+			return nil, fmt.Errorf("%q is not a channel number or range between 1 and %d", part, len(catalog))
+		}
+		for i := from; i <= to; i++ {
+			chosen[i-1] = true
+		}
+	}
+	for i, channelConfig := range catalog {
+		if chosen[i] {
+			picked = append(picked, channelConfig.Name)
+		}
+	}
+	return picked, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"lemita/datn/pkg/store"
+)
+
+// pruneInterval is how often follow mode applies the store retention policy
+const pruneInterval = time.Hour
+
+// runPrune implements the prune subcommand: it applies a retention policy to the
+// local event store and optionally compacts it
+func runPrune(args []string) int {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	storeDir := fs.String("store", defaultStoreDir, "Event store directory written by the collector")
+	maxDays := fs.Int("max-days", 0, "Remove daily segments older than this many days (0 = keep forever)")
+	maxSizeMB := fs.Int64("max-size-mb", 0, "Remove the oldest segments until the store is at most this size in MB (0 = unlimited)")
+	vacuum := fs.Bool("vacuum", false, "Also drop unreadable records and leftover temporary or orphaned index files")
+	dryRun := fs.Bool("dry-run", false, "Only report what would be removed")
+	fs.Parse(args)
+
+	if _, err := os.Stat(*storeDir); err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		return 2
+	}
+	s, err := store.Open(*storeDir)
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		return 2
+	}
+
+	policy := retentionPolicy(*maxDays, *maxSizeMB)
+	if !policy.Enabled() && !*vacuum {
+		fmt.Println("Nothing to do: set -max-days, -max-size-mb or -vacuum")
+		return 2
+	}
+
+	exitCode := 0
+	if policy.Enabled() {
+		result, err := s.Prune(policy, *dryRun)
+		if err != nil {
+			fmt.Printf("Error pruning store: %v\n", err)
+			exitCode = 1
+		}
+		if result != nil {
+			verb := "Removed"
+			if *dryRun {
+				verb = "Would remove"
+			}
+			for _, segment := range result.Removed {
+				fmt.Printf("%s %s\n", verb, segment)
+			}
+			fmt.Printf("%s %d segments (%s), %s remaining\n", verb, len(result.Removed), formatBytes(result.FreedBytes), formatBytes(result.RemainingSize))
+		}
+	}
+
+	if *vacuum && !*dryRun {
+		result, err := s.Vacuum()
+		if err != nil {
+			fmt.Printf("Error vacuuming store: %v\n", err)
+			exitCode = 1
+		}
+		if result != nil {
+			fmt.Printf("Vacuum removed %d leftover files and %d unreadable records (%s freed), %s remaining\n",
+				len(result.Removed), result.DroppedLines, formatBytes(result.FreedBytes), formatBytes(result.RemainingSize))
+		}
+	}
+
+	return exitCode
+}
+
+// retentionPolicy builds a store retention policy from day and megabyte limits
+func retentionPolicy(maxDays int, maxSizeMB int64) store.Retention {
+	return store.Retention{
+		MaxAge:   time.Duration(maxDays) * 24 * time.Hour,
+		MaxBytes: maxSizeMB << 20,
+	}
+}
+
+// applyRetention prunes the collector's store and reports removed segments
+func (c *collector) applyRetention(policy store.Retention) {
+	if c.store == nil || !policy.Enabled() {
+		return
+	}
+	result, err := c.store.Prune(policy, false)
+	if err != nil {
+		c.output.WriteString(fmt.Sprintf("Error pruning store: %v\n", err))
+		return
+	}
+	if len(result.Removed) > 0 {
+		c.output.WriteString(fmt.Sprintf("Pruned %d store segments (%s freed)\n", len(result.Removed), formatBytes(result.FreedBytes)))
+	}
+}
+
+// formatBytes renders a byte count with a binary unit
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/query"
+	"lemita/datn/pkg/store"
+)
+
+// defaultStoreDir is where collected events are saved when -store is given without a path
+const defaultStoreDir = "datn-store"
+
+// maxMessageWidth is the number of characters of insertion strings shown in table output
+const maxMessageWidth = 80
+
+// runQuery implements the query subcommand: it filters events saved with -store (or
+// any JSONL file of events) and prints them as a table or as JSON lines
+func runQuery(args []string) int {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	storeDir := fs.String("store", defaultStoreDir, "Event store directory written by the collector")
+	file := fs.String("file", "", "Query this JSONL file of events instead of the store")
+	outputFormat := fs.String("output", "table", "Output format: table or json")
+	limit := fs.Int("limit", 0, "Maximum number of events to print (0 = unlimited)")
+	search := fs.String("search", "", "Full-text search terms that must all appear in the event (term* matches a prefix)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s query [flags] [expression]\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Example: %s query channel=Security AND event_id IN (4624,4625) AND time > 2024-05-01\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "         %s query -search \"mimikatz lsass\" channel=Security\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *outputFormat != "table" && *outputFormat != "json" {
+		fmt.Printf("Invalid output format %q (expected table or json)\n", *outputFormat)
+		return 2
+	}
+
+	q, err := query.Parse(strings.Join(fs.Args(), " "))
+	if err != nil {
+		fmt.Printf("Error in query: %v\n", err)
+		return 2
+	}
+
+	path := *storeDir
+	if *file != "" {
+		path = *file
+	}
+
+	var table *tabwriter.Writer
+	var encoder *json.Encoder
+	if *outputFormat == "json" {
+		encoder = json.NewEncoder(os.Stdout)
+	} else {
+		table = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "TIME\tCHANNEL\tRECORD\tEVENT ID\tLEVEL\tSOURCE\tMESSAGE\tLABELS")
+	}
+
+	// Full-text searches go through the store's inverted index instead of a full scan
+	scan := store.ScanPath
+	if terms := store.SearchTerms(*search); len(terms) > 0 {
+		scan = func(path string, fn func(eventlog.EventLogData) error) error {
+			return store.SearchPath(path, terms, fn)
+		}
+	}
+
+	matched := 0
+	err = scan(path, func(event eventlog.EventLogData) error {
+		if !q.Match(event) {
+			return nil
+		}
+		matched++
+
+		if encoder != nil {
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(table, "%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\n",
+				time.Unix(int64(event.TimeGenerated), 0).Format("2006-01-02 15:04:05"),
+				event.Channel,
+				event.RecordNumber,
+				event.EventID,
+				eventlog.GetEventTypeName(event.EventType),
+				event.SourceName,
+				summarizeStrings(event.Strings),
+				strings.Join(eventlog.NoteLabels(event.Notes), ","))
+		}
+
+		if *limit > 0 && matched >= *limit {
+			return store.ErrStop
+		}
+		return nil
+	})
+	if table != nil {
+		table.Flush()
+	}
+	if err != nil {
+		fmt.Printf("Error querying %s: %v\n", path, err)
+		return 1
+	}
+
+	if table != nil {
+		fmt.Printf("\n%d matching events\n", matched)
+	}
+	return 0
+}
+
+// summarizeStrings joins insertion strings into one truncated line for table output
+func summarizeStrings(values []string) string {
+	message := strings.Join(strings.Fields(strings.Join(values, " | ")), " ")
+	if runes := []rune(message); len(runes) > maxMessageWidth {
+		message = string(runes[:maxMessageWidth-3]) + "..."
+	}
+	return message
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"lemita/datn/pkg/integrity"
+)
+
+// selfCheck verifies the binary against its signed manifest and warns when the
+// configuration or state paths can be modified by non-admin users, since the
+// collector often runs on hosts that may already be compromised. It returns the
+// warnings and whether the binary's integrity was verified.
+func selfCheck(paths []string) (warnings []string, verified bool) {
+	manifest, err := integrity.VerifySelf()
+	switch {
+	case errors.Is(err, integrity.ErrNotSigned):
+		warnings = append(warnings, "binary is not signed; its integrity cannot be verified")
+	case err != nil:
+		warnings = append(warnings, fmt.Sprintf("integrity check failed: %v", err))
+	default:
+		verified = true
+		if manifest.Version != "" {
+			fmt.Printf("Binary integrity verified (version %s)\n", manifest.Version)
+		}
+	}
+
+	warnings = append(warnings, integrity.CheckPermissions(paths)...)
+	return warnings, verified
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// serviceName is the Windows service registered by the MSI package
+const serviceName = "datn"
+
+// windowsService connects follow mode to the service control manager when the
+// collector is started as a Windows service
+type windowsService struct {
+	stop     chan os.Signal // Receives SIGTERM when the service is stopped
+	exitCode chan int       // Exit code of follow mode, reported to the SCM
+	done     chan struct{}  // Closed once the SCM has been told the service stopped
+}
+
+// startService reports whether the process was started by the service control
+// manager and, if so, starts the service dispatcher in the background
+func startService() (*windowsService, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect service mode: %v", err)
+	}
+	if !isService {
+		return nil, nil
+	}
+
+	s := &windowsService{
+		stop:     make(chan os.Signal, 1),
+		exitCode: make(chan int, 1),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		if err := svc.Run(serviceName, s); err != nil {
+			fmt.Printf("Service dispatcher failed: %v\n", err)
+		}
+	}()
+	return s, nil
+}
+
+// Execute implements svc.Handler: it reports the service as running until the SCM
+// asks it to stop, then waits for follow mode to drain and shut down
+func (s *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				s.stop <- syscall.SIGTERM
+				return false, uint32(<-s.exitCode)
+			}
+		case code := <-s.exitCode:
+			// Follow mode stopped on its own
+			return false, uint32(code)
+		}
+	}
+}
+
+// finish reports the exit code to the SCM and waits until the service is marked
+// stopped, so the process doesn't exit while a stop is still pending
+func (s *windowsService) finish(exitCode int) {
+	s.exitCode <- exitCode
+	<-s.done
+}
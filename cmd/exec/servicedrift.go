@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"lemita/datn/pkg/filesenum"
+	"lemita/datn/pkg/servicedrift"
+)
+
+// checkServices snapshots the services of the collected computer and passes those
+// whose binary path or hash changed since the previous snapshot through the
+// pipeline, returning their number
+func (c *collector) checkServices() int {
+	if c.services == nil {
+		return 0
+	}
+	changed := 0
+	c.guard(servicedrift.Channel, func() {
+		services, err := filesenum.ListServicesOn(c.server)
+		if err != nil {
+			c.output.WriteString(fmt.Sprintf("Error listing services: %v\n", err))
+			return
+		}
+		events := c.services.Check(services, time.Now())
+		for _, event := range events {
+			from, to := event.Strings[2], event.Strings[3]
+			if event.EventID == servicedrift.HashChangedEventID {
+				from, to = event.Strings[4], event.Strings[5]
+			}
+			c.output.WriteString(fmt.Sprintf("Alert: binary of service %s changed from %s to %s\n", event.Strings[0], from, to))
+		}
+		if len(events) > 0 {
+			c.handleEvents(servicedrift.Channel, events)
+			changed = len(events)
+		}
+	})
+	return changed
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/filesenum"
+)
+
+// runServices implements the services subcommand: it lists the Win32 services of
+// a computer with their binaries and the SHA-256 and signature of each, the
+// inventory fleet and triage runs save, for persistence hunting
+func runServices(args []string) int {
+	fs := flag.NewFlagSet("services", flag.ExitOnError)
+	server := fs.String("server", "", "List the services of this remote computer (admin share access for the hashes)")
+	unusual := fs.Bool("unusual", false, "Only list auto-start services running as LocalSystem from outside the Windows and Program Files folders")
+	unsigned := fs.Bool("unsigned", false, "Only list services whose binary in the Windows folder is unsigned or fails signature verification")
+	asJSON := fs.Bool("json", false, "Print the services as JSON, with their recovery actions")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s services [flags]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	services, err := filesenum.ListServicesOn(*server)
+	if err != nil {
+		fmt.Printf("Error listing services: %v\n", err)
+		return 1
+	}
+	if *unusual || *unsigned {
+		// Recovery programs stay with the services they belong to
+		keep := map[string]bool{}
+		for _, service := range services {
+			if service.Kind == filesenum.KindRecovery {
+				continue
+			}
+			info := service.ServiceInfo
+			if *unusual && (info == nil || !info.AutoStart() || !info.RunsAsSystem() || !filesenum.OutsideSystemFolders(service.FilePath)) {
+				continue
+			}
+			if *unsigned && !unsignedSystemBinary(service) {
+				continue
+			}
+			keep[service.Service] = true
+		}
+		kept := services[:0]
+		for _, service := range services {
+			if keep[service.Service] {
+				kept = append(kept, service)
+			}
+		}
+		services = kept
+	}
+	sort.SliceStable(services, func(i, j int) bool {
+		return strings.ToLower(services[i].Service) < strings.ToLower(services[j].Service)
+	})
+
+	if *asJSON {
+		return printJSON(services)
+	}
+
+	host := *server
+	if host == "" {
+		host = eventlog.GetLocalComputerName()
+	}
+	count := 0
+	for _, service := range services {
+		if service.Kind != filesenum.KindRecovery {
+			count++
+		}
+	}
+	fmt.Printf("Services on %s: %d\n\n", host, count)
+	for _, service := range services {
+		// A recovery program follows its service, which sorting keeps in place
+		if service.Kind == filesenum.KindRecovery {
+			fmt.Printf("  %-32s on failure %s\n", "", service.FilePath)
+			fmt.Printf("  %-32s sha256 %s\n", "", service.Hash)
+			printSignature(service)
+			continue
+		}
+		fmt.Printf("  %-32s %s\n", service.Service, service.Name)
+		fmt.Printf("  %-32s %s\n", "", service.FilePath)
+		fmt.Printf("  %-32s sha256 %s\n", "", service.Hash)
+		printSignature(service)
+		if info := service.ServiceInfo; info != nil {
+			account := info.Account
+			if account == "" {
+				account = "LocalSystem"
+			}
+			details := []string{info.StartType, info.ServiceType, account}
+			if info.State != "" {
+				details = append(details, info.State)
+			}
+			if info.PID != 0 {
+				details = append(details, fmt.Sprintf("PID %d", info.PID))
+			}
+			fmt.Printf("  %-32s %s\n", "", strings.Join(details, ", "))
+		}
+	}
+	return 0
+}
+
+// unsignedSystemBinary reports whether a binary in the Windows folder is unsigned
+// or fails verification; Microsoft signs every service binary it installs there
+func unsignedSystemBinary(service filesenum.PEInfo) bool {
+	return service.Signature.Suspicious() && filesenum.InWindowsFolder(service.FilePath)
+}
+
+// printSignature prints the signature line of a service binary, flagging binaries
+// of the Windows folder that aren't validly signed
+func printSignature(service filesenum.PEInfo) {
+	signature := service.Signature
+	if signature == nil {
+		return
+	}
+	line := "signature " + signature.Status
+	if signature.Subject != "" {
+		line += ", " + signature.Subject
+	}
+	if signature.Catalog != "" {
+		line += " (catalog)"
+	}
+	if !signature.NotAfter.IsZero() {
+		line += fmt.Sprintf(", valid %s to %s", signature.NotBefore.Format("2006-01-02"), signature.NotAfter.Format("2006-01-02"))
+	}
+	if unsignedSystemBinary(service) {
+		line += "  [!] not validly signed in the Windows folder"
+	}
+	fmt.Printf("  %-32s %s\n", "", line)
+}
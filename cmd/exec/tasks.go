@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/tasksenum"
+)
+
+// runTasks implements the tasks subcommand: it lists the scheduled tasks of a
+// computer with their actions, triggers, author and the SHA-256 of the programs
+// they run, for persistence hunting
+func runTasks(args []string) int {
+	fs := flag.NewFlagSet("tasks", flag.ExitOnError)
+	server := fs.String("server", "", "List the tasks of this remote computer (admin share access, or schtasks through the Task Scheduler service)")
+	all := fs.Bool("all", false, "Also list the tasks under \\Microsoft\\, which ship with Windows")
+	asJSON := fs.Bool("json", false, "Print the tasks as JSON, with their full XML definitions")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s tasks [flags]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	tasks, source, err := tasksenum.ListOn(*server)
+	if err != nil {
+		fmt.Printf("Error listing scheduled tasks: %v\n", err)
+		return 1
+	}
+	tasksenum.Sort(tasks)
+	if !*all {
+		kept := tasks[:0]
+		for _, task := range tasks {
+			if !strings.HasPrefix(strings.ToLower(task.Name), `\microsoft\`) {
+				kept = append(kept, task)
+			}
+		}
+		tasks = kept
+	}
+
+	if *asJSON {
+		return printJSON(tasks)
+	}
+
+	host := *server
+	if host == "" {
+		host = eventlog.GetLocalComputerName()
+	}
+	fmt.Printf("Scheduled tasks on %s: %d (read from %s)\n", host, len(tasks), source)
+	for _, task := range tasks {
+		state := "enabled"
+		if !task.Enabled {
+			state = "disabled"
+		}
+		if task.Hidden {
+			state += ", hidden"
+		}
+		fmt.Printf("\n  %s (%s)\n", task.Name, state)
+		if task.Author != "" {
+			fmt.Printf("    Author:   %s\n", task.Author)
+		}
+		if task.RunAs != "" {
+			runAs := task.RunAs
+			if task.RunLevel != "" {
+				runAs += " (" + task.RunLevel + ")"
+			}
+			fmt.Printf("    Run as:   %s\n", runAs)
+		}
+		for _, action := range task.Actions {
+			if action.ClassID != "" {
+				fmt.Printf("    COM:      %s\n", action.ClassID)
+				continue
+			}
+			fmt.Printf("    Exec:     %s %s\n", action.Binary, action.Arguments)
+			fmt.Printf("    SHA-256:  %s\n", action.Hash)
+		}
+		for _, trigger := range task.Triggers {
+			line := trigger.Type
+			if trigger.Start != "" {
+				line += " from " + trigger.Start
+			}
+			if trigger.Detail != "" {
+				line += ", " + trigger.Detail
+			}
+			if trigger.Repeats != "" {
+				line += ", repeats every " + trigger.Repeats
+			}
+			if !trigger.Enabled {
+				line += " (disabled)"
+			}
+			fmt.Printf("    Trigger:  %s\n", line)
+		}
+	}
+	return 0
+}
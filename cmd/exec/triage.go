@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/autoruns"
+	"lemita/datn/pkg/config"
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/filesenum"
+	"lemita/datn/pkg/fleet"
+	"lemita/datn/pkg/formatter"
+	"lemita/datn/pkg/netprofile"
+	"lemita/datn/pkg/tasksenum"
+	"lemita/datn/pkg/triage"
+)
+
+// triageNetworks is the networks.json entry of a triage archive
+type triageNetworks struct {
+	Profiles   []netprofile.Profile  `json:"profiles"`
+	VPNEntries []netprofile.VPNEntry `json:"vpn_entries"`
+}
+
+// runTriage implements the triage subcommand: one command with no required flags
+// that collects the key channels over a short window, the persistence inventories,
+// running processes, TCP connections, known networks and host details of the local
+// computer into a single ZIP to hand to a responder
+func runTriage(args []string) int {
+	fs := flag.NewFlagSet("triage", flag.ExitOnError)
+	out := fs.String("out", "", "Archive path (default: triage-<computer>-<time>.zip in the current directory)")
+	window := fs.String("since", "72h", "Collect events from this far back, e.g. 36h or 7d")
+	channelsFile := fs.String("config", "", "YAML, JSON or TOML file of the channels to collect (default: the built-in channels)")
+	maxEvents := fs.Int("max", 20000, "Maximum number of events per channel (0 = no limit)")
+	caseID := fs.String("case", "", "Incident or case identifier recorded in the manifest and every event")
+	analyst := fs.String("analyst", "", "Analyst running the triage, recorded with -case")
+	caseNotes := fs.String("notes", "", "Free-text notes about the triage, recorded with -case")
+	exportEvtx := fs.Bool("evtx", false, "Also add the window of each channel as an .evtx export, verified against the channel's record count in the manifest")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s triage [flags]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	duration, err := parseWindow(*window)
+	if err != nil {
+		fmt.Printf("Invalid -since: %v\n", err)
+		return 2
+	}
+	var caseInfo *eventlog.Case
+	if *caseID != "" {
+		caseInfo = &eventlog.Case{ID: *caseID, Analyst: *analyst, Notes: *caseNotes}
+	} else if *analyst != "" || *caseNotes != "" {
+		fmt.Println("-analyst and -notes require -case")
+		return 2
+	}
+	channels, err := config.LoadChannelConfigs(*channelsFile)
+	if err != nil {
+		fmt.Printf("Error loading channels: %v\n", err)
+		return 2
+	}
+
+	host := triage.GetHostInfo()
+	if !host.Admin {
+		fmt.Println("Warning: not running as administrator; the Security channel and some processes will be missing")
+	}
+	path := *out
+	if path == "" {
+		path = fmt.Sprintf("triage-%s-%s.zip", host.Computer, host.Time.Format("20060102-150405"))
+	}
+
+	archive, err := triage.Create(path, host)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	archive.SetCase(caseInfo)
+	fmt.Printf("Triage of %s (events since %s) to %s\n", host.Computer, host.Time.Add(-duration).Format(time.RFC1123), path)
+
+	addTriage(archive, "host details", "host.json", func() (any, error) { return host, nil })
+	since := host.Time.Add(-duration)
+	for _, channelConfig := range channels {
+		if channelConfig.Available {
+			triageChannel(archive, channelConfig, since, *maxEvents, caseInfo)
+			if *exportEvtx {
+				triageExport(archive, channelConfig.Name, since)
+			}
+		}
+	}
+	inventories := []struct {
+		what string
+		file string
+		list func(string) ([]filesenum.PEInfo, error)
+	}{
+		{"services", fleet.ServicesFile, filesenum.ListServicesOn},
+		{"scheduled tasks", fleet.TasksFile, tasksenum.ListProgramsOn},
+		{"autoruns", fleet.AutorunsFile, autoruns.ListInventoryOn},
+		{"COM servers in user-writable folders", fleet.COMFile, filesenum.ListCOMHijacksOn},
+		{"IFEO debuggers", fleet.IFEOFile, filesenum.ListIFEODebuggersOn},
+	}
+	for _, inventory := range inventories {
+		list := inventory.list
+		addTriage(archive, inventory.what, inventory.file, func() (any, error) { return list("") })
+	}
+	addTriage(archive, "processes", "processes.json", func() (any, error) { return triage.ListProcesses() })
+	addTriage(archive, "TCP connections", "connections.json", func() (any, error) { return triage.ListConnections() })
+	addTriage(archive, "known networks", "networks.json", func() (any, error) {
+		var networks triageNetworks
+		var err error
+		if networks.Profiles, err = netprofile.ListProfilesOn(""); err != nil {
+			return networks, err
+		}
+		networks.VPNEntries, err = netprofile.ListVPNEntriesOn("")
+		return networks, err
+	})
+
+	manifest, err := archive.Close()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("\nTriage complete in %v: %d files in %s\n", manifest.Duration.Round(time.Second), len(manifest.Files), path)
+	if len(manifest.Errors) > 0 {
+		fmt.Printf("%d parts could not be collected (listed in %s):\n", len(manifest.Errors), triage.ManifestFile)
+		for _, e := range manifest.Errors {
+			fmt.Printf("  %s\n", e)
+		}
+		return 1
+	}
+	return 0
+}
+
+// addTriage collects one part of the triage and adds it to the archive as JSON.
+// Partial results are kept alongside the error.
+func addTriage(archive *triage.Archive, what, file string, collect func() (any, error)) {
+	v, err := collect()
+	if err != nil {
+		fmt.Printf("Error collecting %s: %v\n", what, err)
+		archive.Fail("%s: %v", what, err)
+	}
+	if err := archive.AddJSON(file, v); err != nil {
+		archive.Fail("%s: %v", what, err)
+		return
+	}
+	fmt.Printf("Collected %s\n", what)
+}
+
+// triageChannel adds the events of a channel since the start of the window as
+// newline-delimited JSON under events/
+func triageChannel(archive *triage.Archive, channelConfig config.ChannelConfig, since time.Time, maxEvents int, caseInfo *eventlog.Case) {
+	result, err := eventlog.CollectWithOptions(channelConfig.Name, eventlog.CollectOptions{
+		EventIDs:    channelConfig.EventIDs,
+		Since:       since,
+		MaxEvents:   maxEvents,
+		MemoryLimit: eventlog.DefaultMemoryLimit,
+	})
+	if err != nil {
+		fmt.Printf("Error reading %s: %v\n", channelConfig.Name, err)
+		archive.Fail("%s: %v", channelConfig.Name, err)
+		if result == nil {
+			return
+		}
+	}
+	defer result.Close()
+
+	name := "events/" + channelFileName(channelConfig.Name) + ".jsonl"
+	w, err := archive.Create(name)
+	if err != nil {
+		archive.Fail("%s: %v", channelConfig.Name, err)
+		return
+	}
+	buffered := bufio.NewWriter(w)
+	var writeErr error
+	err = result.Each(func(batch []eventlog.EventLogData) {
+		for i := range batch {
+			batch[i].Case = caseInfo
+		}
+		if writeErr == nil {
+			writeErr = formatter.WriteJSONChannel(buffered, channelConfig.Name, batch)
+		}
+	})
+	if err == nil {
+		err = writeErr
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		archive.Fail("%s: %v", channelConfig.Name, err)
+		return
+	}
+	fmt.Printf("Collected %d events from %s\n", result.Len(), channelConfig.Name)
+}
+
+// channelFileName names the files of a channel the way Windows names its log
+// files, e.g. Microsoft-Windows-Sysmon%4Operational
+func channelFileName(channel string) string {
+	return strings.ReplaceAll(channel, "/", "%4")
+}
+
+// triageExport adds the records of a channel since the start of the window as an
+// .evtx export under events/ and records its verification in the manifest. The
+// export is unfiltered, so it also holds the records the -config event IDs leave out.
+func triageExport(archive *triage.Archive, channel string, since time.Time) {
+	dir, err := os.MkdirTemp("", "datn-evtx")
+	if err != nil {
+		archive.Fail("%s export: %v", channel, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	name := "events/" + channelFileName(channel) + ".evtx"
+	check, err := eventlog.ExportChannel(channel, since, filepath.Join(dir, filepath.Base(name)))
+	if check.SHA256 != "" {
+		check.Path = name
+		archive.AddExport(check)
+		if addErr := archive.AddFile(name, filepath.Join(dir, filepath.Base(name))); addErr != nil && err == nil {
+			err = addErr
+		}
+	}
+	if err != nil {
+		fmt.Printf("Error exporting %s: %v\n", channel, err)
+		archive.Fail("%s export: %v", channel, err)
+		return
+	}
+	fmt.Printf("Exported %s (%d records verified)\n", channel, check.Records)
+}
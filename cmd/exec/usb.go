@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/store"
+	"lemita/datn/pkg/usb"
+)
+
+// runUSB implements the usb subcommand: it reports the removable storage devices
+// used on a computer, from the USBSTOR and MountedDevices registry keys and the
+// disk arrivals of the Partition/Diagnostic channel, for data-exfiltration
+// investigations
+func runUSB(args []string) int {
+	fs := flag.NewFlagSet("usb", flag.ExitOnError)
+	server := fs.String("server", "", "Examine this remote computer (Remote Registry and remote event log access)")
+	var eventFiles stringList
+	fs.Var(&eventFiles, "events", "Also use the Partition events of this saved JSONL file or store directory (repeatable)")
+	noEvents := fs.Bool("no-events", false, "Don't read the Partition/Diagnostic channel of the computer")
+	asJSON := fs.Bool("json", false, "Print the devices as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s usb [flags]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	report := usb.NewReport()
+	exitCode := 0
+
+	devices, err := usb.ListDevicesOn(*server)
+	if err != nil {
+		fmt.Printf("Error reading device registry: %v\n", err)
+		exitCode = 1
+	}
+	report.AddDevices(devices)
+
+	if !*noEvents {
+		result, err := eventlog.CollectWithOptions(usb.PartitionChannel, eventlog.CollectOptions{
+			EventIDs: []uint32{usb.PartitionEventID},
+			Server:   *server,
+		})
+		if err != nil {
+			fmt.Printf("Error reading %s: %v\n", usb.PartitionChannel, err)
+			exitCode = 1
+		} else {
+			report.AddEvents(*server, result.Events)
+		}
+	}
+	for _, path := range eventFiles {
+		err := store.ScanPath(path, func(event eventlog.EventLogData) error {
+			report.AddEvents(*server, []eventlog.EventLogData{event})
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Error reading %s: %v\n", path, err)
+			exitCode = 1
+		}
+	}
+
+	list := report.Devices()
+	if *asJSON {
+		if code := printJSON(list); code != 0 {
+			return code
+		}
+		return exitCode
+	}
+
+	host := *server
+	if host == "" {
+		host = eventlog.GetLocalComputerName()
+	}
+	fmt.Printf("Removable storage devices on %s: %d\n", host, len(list))
+	for _, d := range list {
+		name := d.FriendlyName
+		if name == "" {
+			name = strings.TrimSpace(d.Vendor + " " + d.Product)
+		}
+		fmt.Printf("\n  %s\n", name)
+		fmt.Printf("    Device ID:       %s\n", d.ID)
+		if d.Serial != "" {
+			fmt.Printf("    Serial:          %s\n", d.Serial)
+		}
+		fmt.Printf("    First connected: %s\n", formatReportTime(d.FirstConnected))
+		fmt.Printf("    Last connected:  %s\n", formatReportTime(d.LastConnected))
+		if !d.LastRemoved.IsZero() {
+			fmt.Printf("    Last removed:    %s\n", formatReportTime(d.LastRemoved))
+		}
+		if d.Connections > 0 {
+			fmt.Printf("    Arrivals logged: %d\n", d.Connections)
+		}
+		if len(d.DriveLetters) > 0 {
+			fmt.Printf("    Drive letters:   %s\n", strings.Join(d.DriveLetters, ", "))
+		}
+	}
+	return exitCode
+}
+
+// formatReportTime renders a timestamp of the usb and network reports, which is
+// unknown when zero
+func formatReportTime(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
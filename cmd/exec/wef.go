@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"lemita/datn/pkg/config"
+	"lemita/datn/pkg/wef"
+)
+
+// runWEF implements the wef subcommand. "wef setup" creates or updates a
+// source-initiated Windows Event Forwarding subscription on the local collector,
+// so the channels forwarded to it match the ones this tool collects.
+func runWEF(args []string) int {
+	if len(args) == 0 || args[0] != "setup" {
+		fmt.Printf("Usage: %s wef setup [flags]\n", os.Args[0])
+		return 2
+	}
+
+	fs := flag.NewFlagSet("wef setup", flag.ExitOnError)
+	name := fs.String("name", "datn", "Subscription name")
+	description := fs.String("description", "Channels collected by datn", "Subscription description")
+	var channelArgs stringList
+	fs.Var(&channelArgs, "channel", "Forward this channel, as Name or Name:id,id,... (repeatable; default: the available catalogued channels)")
+	channelsFile := fs.String("config", "", "YAML, JSON or TOML channels file the channel names and event IDs are taken from (default: the built-in channels)")
+	allEvents := fs.Bool("all-events", false, "Forward every event of the channels instead of the catalogued event IDs")
+	logFile := fs.String("log", wef.DefaultLogFile, "Channel the forwarded events are written to on this collector")
+	mode := fs.String("mode", wef.ModeNormal, "Delivery optimization: normal, min-latency or min-bandwidth")
+	sources := fs.String("sources", wef.DomainComputers, "SDDL of the computers allowed to forward (default: domain computers and controllers)")
+	readExisting := fs.Bool("read-existing", false, "Also forward the events logged before a source picked up the subscription")
+	disabled := fs.Bool("disabled", false, "Save the subscription disabled")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s wef setup [flags]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+
+	if !wef.ValidMode(*mode) {
+		fmt.Printf("Invalid -mode %q (expected normal, min-latency or min-bandwidth)\n", *mode)
+		return 2
+	}
+
+	catalog, err := config.LoadChannelConfigs(*channelsFile)
+	if err != nil {
+		fmt.Printf("Error loading channels: %v\n", err)
+		return 2
+	}
+	var channels []config.ChannelConfig
+	if len(channelArgs) == 0 {
+		for _, channelConfig := range catalog {
+			if channelConfig.Available {
+				channels = append(channels, channelConfig)
+			}
+		}
+	} else {
+		var err error
+		if channels, err = wef.ParseChannels(channelArgs, catalog); err != nil {
+			fmt.Printf("Error in -channel: %v\n", err)
+			return 2
+		}
+	}
+	if *allEvents {
+		for i := range channels {
+			channels[i].EventIDs = nil
+		}
+	}
+
+	created, err := wef.Save(wef.Subscription{
+		Name:           *name,
+		Description:    *description,
+		Channels:       channels,
+		LogFile:        *logFile,
+		Mode:           *mode,
+		AllowedSources: *sources,
+		ReadExisting:   *readExisting,
+		Disabled:       *disabled,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println("Run as administrator with the Windows Event Collector service configured (wecutil qc)")
+		return 1
+	}
+
+	action := "Updated"
+	if created {
+		action = "Created"
+	}
+	names := make([]string, len(channels))
+	for i, channelConfig := range channels {
+		names[i] = channelConfig.Name
+	}
+	fmt.Printf("%s subscription %s forwarding %d channels to %s: %s\n", action, *name, len(channels), *logFile, strings.Join(names, ", "))
+	return 0
+}
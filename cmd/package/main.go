@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+//go:embed datn.wxs
+var wxsTemplate string
+
+//go:embed config/tags.conf
+var defaultTags []byte
+
+//go:embed config/rules.conf
+var defaultRules []byte
+
+// wixArchs maps Go architectures to WiX platforms
+var wixArchs = map[string]string{
+	"amd64": "x64",
+	"386":   "x86",
+	"arm64": "arm64",
+}
+
+// msiVersion matches the numeric versions Windows Installer accepts
+var msiVersion = regexp.MustCompile(`^\d+\.\d+\.\d+(\.\d+)?$`)
+
+// serviceArguments are the collector flags of the installed service; state and
+// configuration live in the data directory (%ProgramData%\datn)
+var serviceArguments = []string{
+	"-follow",
+	`-out "[DATADIR]datn.log"`,
+	"-append",
+	`-checkpoint "[DATADIR]checkpoints.json"`,
+	`-health-file "[DATADIR]health.json"`,
+	`-diag-dir "[DATADIR]diag"`,
+	`-audit-log "[DATADIR]audit.jsonl"`,
+	`-tags-file "[DATADIR]tags.conf"`,
+	`-rules "[DATADIR]rules.conf"`,
+	`-store "[DATADIR]store"`,
+}
+
+// package builds the collector MSI: it renders the WiX source with the service
+// registration and default configuration and runs the WiX v4 toolset (wix build)
+func main() {
+	binary := flag.String("binary", "", "Collector binary to package (e.g. dist/datn-amd64.exe)")
+	version := flag.String("version", "", "Package version, e.g. 1.2.0")
+	arch := flag.String("arch", "amd64", "Architecture of the binary: amd64, 386 or arm64")
+	out := flag.String("out", "", "MSI file to write (default: dist/datn-VERSION-ARCH.msi)")
+	manufacturer := flag.String("manufacturer", "datn", "Manufacturer shown in Programs and Features")
+	storeDays := flag.Int("store-max-days", 30, "Retention of the service's local event store in days (0 = keep forever)")
+	extraArgs := flag.String("service-args", "", "Additional collector flags for the service, e.g. \"-sink https://collector:8443/events\"")
+	sourceDir := flag.String("source", "", "Keep the generated WiX sources in this directory")
+	sourceOnly := flag.Bool("source-only", false, "Only generate the WiX sources (requires -source)")
+	wix := flag.String("wix", "wix", "WiX v4 command line tool")
+	flag.Parse()
+
+	if *binary == "" || *version == "" {
+		fmt.Println("Usage: package -binary FILE -version V [-arch ARCH] [-out FILE]")
+		os.Exit(2)
+	}
+	productVersion := strings.TrimPrefix(*version, "v")
+	if !msiVersion.MatchString(productVersion) {
+		fmt.Printf("Error: MSI versions must be numeric (major.minor.build), got %q\n", *version)
+		os.Exit(2)
+	}
+	platform, ok := wixArchs[*arch]
+	if !ok {
+		fmt.Printf("Error: unsupported architecture %q\n", *arch)
+		os.Exit(2)
+	}
+	if *sourceOnly && *sourceDir == "" {
+		fmt.Println("Error: -source-only requires -source")
+		os.Exit(2)
+	}
+	binaryPath, err := filepath.Abs(*binary)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := os.Stat(binaryPath); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *out == "" {
+		*out = filepath.Join("dist", fmt.Sprintf("datn-%s-%s.msi", productVersion, *arch))
+	}
+	msiPath, err := filepath.Abs(*out)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	args := append([]string{}, serviceArguments...)
+	if *storeDays > 0 {
+		args = append(args, fmt.Sprintf("-store-max-days %d", *storeDays))
+	}
+	if *extraArgs != "" {
+		args = append(args, *extraArgs)
+	}
+
+	dir := *sourceDir
+	if dir == "" {
+		dir, err = os.MkdirTemp("", "datn-package-")
+		if err != nil {
+			fmt.Printf("Error creating build directory: %v\n", err)
+			os.Exit(1)
+		}
+		defer os.RemoveAll(dir)
+	}
+	wxsPath, err := writeSources(dir, sourceData{
+		Version:      productVersion,
+		Manufacturer: xmlEscape(*manufacturer),
+		Binary:       xmlEscape(binaryPath),
+		ServiceName:  "datn",
+		Arguments:    xmlEscape(strings.Join(args, " ")),
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *sourceOnly {
+		fmt.Printf("WiX sources written to %s\n", dir)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(msiPath), 0755); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	cmd := exec.Command(*wix, "build", "-arch", platform, "-ext", "WixToolset.Util.wixext", "-o", msiPath, wxsPath)
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Printf("Error running %s: %v\n", *wix, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Built %s\n", msiPath)
+}
+
+// sourceData fills the WiX template; every value is already XML-escaped
+type sourceData struct {
+	Version      string
+	Manufacturer string
+	Binary       string
+	ServiceName  string
+	Arguments    string
+}
+
+// writeSources renders the WiX source and the default configuration files into dir
+// and returns the path of the source
+func writeSources(dir string, data sourceData) (string, error) {
+	tmpl, err := template.New("datn.wxs").Parse(wxsTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid WiX template: %v", err)
+	}
+	var source bytes.Buffer
+	if err := tmpl.Execute(&source, data); err != nil {
+		return "", fmt.Errorf("failed to render WiX source: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "config"), 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", dir, err)
+	}
+	files := map[string][]byte{
+		"datn.wxs":                            source.Bytes(),
+		filepath.Join("config", "tags.conf"):  defaultTags,
+		filepath.Join("config", "rules.conf"): defaultRules,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			return "", fmt.Errorf("failed to write %s: %v", name, err)
+		}
+	}
+	return filepath.Join(dir, "datn.wxs"), nil
+}
+
+// xmlEscape escapes s for use in an XML attribute
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"lemita/datn/pkg/integrity"
+)
+
+// sign appends a signed integrity manifest to a collector binary. It runs on the
+// release machine only; the collector embeds the matching public key at build time.
+func main() {
+	genKey := flag.String("genkey", "", "Generate a new Ed25519 key pair, write the private key to this file and print the public key")
+	keyFile := flag.String("key", "", "File holding the hex-encoded Ed25519 private key")
+	version := flag.String("version", "", "Version recorded in the manifest")
+	flag.Parse()
+
+	if *genKey != "" {
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			fmt.Printf("Error generating key: %v\n", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(*genKey, []byte(hex.EncodeToString(private)+"\n"), 0600); err != nil {
+			fmt.Printf("Error writing key: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Private key written to %s\n", *genKey)
+		fmt.Printf("Public key (pass as -X lemita/datn/pkg/integrity.PublicKey=...): %s\n", hex.EncodeToString(public))
+		return
+	}
+
+	if *keyFile == "" || flag.NArg() == 0 {
+		fmt.Println("Usage: sign -key FILE [-version V] BINARY...")
+		os.Exit(2)
+	}
+
+	keyData, err := os.ReadFile(*keyFile)
+	if err != nil {
+		fmt.Printf("Error reading key: %v\n", err)
+		os.Exit(1)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(keyData)))
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		fmt.Println("Error: key file must contain a hex-encoded Ed25519 private key")
+		os.Exit(1)
+	}
+
+	for _, path := range flag.Args() {
+		manifest, err := integrity.Sign(path, *version, ed25519.PrivateKey(key))
+		if err != nil {
+			fmt.Printf("Error signing %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Signed %s (sha256 %s)\n", path, manifest.SHA256)
+	}
+}
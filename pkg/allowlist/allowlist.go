@@ -0,0 +1,226 @@
+package allowlist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// FileName is the allowlist file kept in the local store directory
+const FileName = "allowlist.json"
+
+// DefaultBaseline is how long executables are learned before they are flagged
+const DefaultBaseline = 7 * 24 * time.Hour
+
+// DetectionName marks process creation events of executables not seen during the baseline
+const DetectionName = "First-seen executable"
+
+// Process creation events: the executable path field and, for Sysmon, the hashes field
+var processEvents = map[eventKey]processFields{
+	{"security", 4688}:                          {path: "NewProcessName", user: "SubjectUserName", parent: "ParentProcessName"},
+	{"microsoft-windows-sysmon/operational", 1}: {path: "Image", hashes: "Hashes", user: "User", parent: "ParentImage"},
+}
+
+type eventKey struct {
+	Channel string // Lowercase
+	EventID uint32
+}
+
+type processFields struct {
+	path, hashes, user, parent string
+}
+
+// Executable is an allowed executable path and the hashes it was seen with
+type Executable struct {
+	Path   string    `json:"path"`
+	Hashes []string  `json:"hashes,omitempty"` // SHA256 of Sysmon events; empty when only 4688 saw it
+	First  time.Time `json:"first"`
+	Count  int       `json:"count"`
+}
+
+// Sighting is a process creation of an executable first seen after the baseline
+type Sighting struct {
+	Time   time.Time `json:"time"`
+	Host   string    `json:"host"`
+	UID    string    `json:"uid,omitempty"`
+	Path   string    `json:"path"`
+	Hash   string    `json:"hash,omitempty"`
+	User   string    `json:"user,omitempty"`
+	Parent string    `json:"parent,omitempty"`
+	Reason string    `json:"reason"` // "new path" or "new hash"
+}
+
+// file is the layout of the allowlist file
+type file struct {
+	LearnUntil  time.Time     `json:"learn_until"`
+	Executables []*Executable `json:"executables"`
+}
+
+// List is the allowlist of executables observed in process creation events
+// (Security 4688, Sysmon 1). Until the baseline period ends every executable is
+// learned; afterwards the first run of an unknown path, or of a known path with a
+// new hash, is flagged and then allowed, so each new executable is reported once.
+// The baseline is measured in event time, so replayed logs learn and detect like
+// live ones.
+type List struct {
+	path        string
+	learnUntil  time.Time
+	executables map[string]*Executable // By lowercase path
+	sightings   []Sighting
+	dirty       bool
+}
+
+// Open loads the allowlist kept in the store directory dir, starting a new baseline
+// of the given length at now when there is none yet
+func Open(dir string, baseline time.Duration, now time.Time) (*List, error) {
+	l := &List{path: filepath.Join(dir, FileName), executables: make(map[string]*Executable)}
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		l.learnUntil = now.Add(baseline).UTC()
+		l.dirty = true
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read allowlist %s: %v", l.path, err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse allowlist %s: %v", l.path, err)
+	}
+	l.learnUntil = f.LearnUntil
+	for _, executable := range f.Executables {
+		l.executables[strings.ToLower(executable.Path)] = executable
+	}
+	return l, nil
+}
+
+// Learning reports whether the baseline is still being learned at t
+func (l *List) Learning(t time.Time) bool {
+	return t.Before(l.learnUntil)
+}
+
+// LearnUntil returns the end of the baseline period
+func (l *List) LearnUntil() time.Time {
+	return l.learnUntil
+}
+
+// Len returns the number of allowed executables
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.executables)
+}
+
+// Add learns the executables of process creation events, or flags the first-seen
+// ones when the baseline is over, and saves the allowlist when it changed
+func (l *List) Add(events []eventlog.EventLogData) error {
+	if l == nil {
+		return nil
+	}
+	for i := range events {
+		event := &events[i]
+		fields, ok := processEvents[eventKey{strings.ToLower(event.Channel), event.EventID}]
+		if !ok {
+			continue
+		}
+		data := eventlog.NamedData(event.Channel, *event)
+		path := data[fields.path]
+		if path == "" {
+			continue
+		}
+		hash := sha256Of(data[fields.hashes])
+		at := eventlog.EventTime(event.TimeGenerated)
+
+		key := strings.ToLower(path)
+		executable, known := l.executables[key]
+		reason := ""
+		switch {
+		case !known:
+			executable = &Executable{Path: path, First: at}
+			l.executables[key] = executable
+			reason = "new path"
+		case hash != "" && len(executable.Hashes) > 0 && !slices.Contains(executable.Hashes, hash):
+			reason = "new hash"
+		}
+		if hash != "" && !slices.Contains(executable.Hashes, hash) {
+			executable.Hashes = append(executable.Hashes, hash)
+		}
+		executable.Count++
+		l.dirty = true
+
+		if reason == "" || l.Learning(at) {
+			continue
+		}
+		l.sightings = append(l.sightings, Sighting{
+			Time:   at,
+			Host:   event.ComputerName,
+			UID:    event.UID,
+			Path:   path,
+			Hash:   hash,
+			User:   data[fields.user],
+			Parent: data[fields.parent],
+			Reason: reason,
+		})
+		event.Detections = append(event.Detections, DetectionName)
+	}
+	return l.Save()
+}
+
+// Sightings returns the first-seen executables flagged so far, in time order
+func (l *List) Sightings() []Sighting {
+	if l == nil {
+		return nil
+	}
+	list := append([]Sighting(nil), l.sightings...)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Time.Before(list[j].Time) })
+	return list
+}
+
+// Save writes the allowlist if it changed since it was loaded or last saved,
+// replacing the file atomically
+func (l *List) Save() error {
+	if l == nil || !l.dirty {
+		return nil
+	}
+	f := file{LearnUntil: l.learnUntil, Executables: make([]*Executable, 0, len(l.executables))}
+	for _, executable := range l.executables {
+		f.Executables = append(f.Executables, executable)
+	}
+	sort.Slice(f.Executables, func(i, j int) bool { return f.Executables[i].Path < f.Executables[j].Path })
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode allowlist: %v", err)
+	}
+
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write allowlist %s: %v", l.path, err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write allowlist %s: %v", l.path, err)
+	}
+	l.dirty = false
+	return nil
+}
+
+// sha256Of extracts the SHA256 of a Sysmon Hashes field such as
+// "SHA1=...,MD5=...,SHA256=...,IMPHASH=..."; empty when it has none
+func sha256Of(hashes string) string {
+	for _, hash := range strings.Split(hashes, ",") {
+		if name, value, ok := strings.Cut(strings.TrimSpace(hash), "="); ok && strings.EqualFold(name, "SHA256") {
+			return strings.ToUpper(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"lemita/datn/pkg/audit"
+)
+
+// AuthOptions secures the agent's HTTP listener
+type AuthOptions struct {
+	CertFile     string   // Server certificate (PEM); TLS is off when empty
+	KeyFile      string   // Server private key (PEM)
+	ClientCAFile string   // Require client certificates issued by this CA (mutual TLS)
+	TokensFile   string   // Accepted API tokens, one per line; # starts a comment
+	Allow        []string // Client IP addresses or CIDR ranges allowed to connect (empty = any)
+	PolicyFile   string   // Operations each client certificate may invoke (see LoadPolicy); requires ClientCAFile
+}
+
+// Enabled reports whether clients are authenticated or restricted. TLS without a
+// client CA only encrypts the connection, so a server certificate alone doesn't count.
+func (o AuthOptions) Enabled() bool {
+	return o.TokensFile != "" || o.ClientCAFile != "" || len(o.Allow) > 0
+}
+
+// Policy loads the policy file, returning nil when no policy is configured
+func (o AuthOptions) Policy() (Policy, error) {
+	if o.PolicyFile == "" {
+		return nil, nil
+	}
+	if o.ClientCAFile == "" {
+		return nil, fmt.Errorf("a policy requires client certificates (a client CA)")
+	}
+	return LoadPolicy(o.PolicyFile)
+}
+
+// TLSConfig returns the listener's TLS configuration, or nil when TLS is off. With
+// a client CA, connections without a certificate issued by it are refused.
+func (o AuthOptions) TLSConfig() (*tls.Config, error) {
+	if o.CertFile == "" {
+		if o.ClientCAFile != "" {
+			return nil, fmt.Errorf("a client CA requires a server certificate")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %v", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if o.ClientCAFile != "" {
+		pem, err := os.ReadFile(o.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA %s", o.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// Authenticator checks the client address and API token of every request
+type Authenticator struct {
+	networks []*net.IPNet
+	tokens   [][sha256.Size]byte // Hashes of the accepted tokens
+}
+
+// NewAuthenticator loads the allowlist and tokens of the options
+func NewAuthenticator(o AuthOptions) (*Authenticator, error) {
+	a := &Authenticator{}
+	for _, entry := range o.Allow {
+		for _, value := range strings.Split(entry, ",") {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			// A bare address is a single host; IPv4-mapped IPv6 addresses are written
+			// in IPv6 form, so their prefix is 128 bits too
+			if !strings.Contains(value, "/") {
+				if strings.Contains(value, ":") {
+					value += "/128"
+				} else {
+					value += "/32"
+				}
+			}
+			_, network, err := net.ParseCIDR(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowlist entry %q", value)
+			}
+			a.networks = append(a.networks, network)
+		}
+	}
+
+	if o.TokensFile != "" {
+		file, err := os.Open(o.TokensFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open tokens file: %v", err)
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			token := strings.TrimSpace(scanner.Text())
+			if token == "" || strings.HasPrefix(token, "#") {
+				continue
+			}
+			a.tokens = append(a.tokens, sha256.Sum256([]byte(token)))
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read tokens file: %v", err)
+		}
+		if len(a.tokens) == 0 {
+			return nil, fmt.Errorf("no tokens in %s", o.TokensFile)
+		}
+	}
+	return a, nil
+}
+
+// allowed reports whether the client address is on the allowlist
+func (a *Authenticator) allowed(remoteAddr string) bool {
+	if len(a.networks) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range a.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// validToken reports whether the request carries an accepted bearer token
+func (a *Authenticator) validToken(r *http.Request) bool {
+	if len(a.tokens) == 0 {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	valid := 0
+	for _, accepted := range a.tokens {
+		valid |= subtle.ConstantTimeCompare(sum[:], accepted[:])
+	}
+	return valid == 1
+}
+
+// Wrap rejects requests from addresses outside the allowlist (403) and requests
+// without an accepted token (401) before they reach h
+func (a *Authenticator) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.allowed(r.RemoteAddr) {
+			writeError(w, http.StatusForbidden, "client address not allowed")
+			return
+		}
+		if !a.validToken(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="datn"`)
+			writeError(w, http.StatusUnauthorized, "missing or invalid API token")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Audited records every request to log with the client, its certificate identity
+// and the response status, including requests the checks refused
+func Audited(log *audit.Log, h http.Handler) http.Handler {
+	if log == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(recorder, r)
+
+		identity := "-"
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			identity = r.TLS.VerifiedChains[0][0].Subject.CommonName
+		}
+		log.Record(audit.ActionAPIRequest, "%s %s from %s (%s): %d", r.Method, r.URL.RequestURI(), r.RemoteAddr, identity, recorder.status)
+	})
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		allow   []string
+		addr    string
+		want    bool
+		invalid bool
+	}{
+		{"no allowlist", nil, "203.0.113.7:5000", true, false},
+		{"bare IPv4", []string{"10.0.0.5"}, "10.0.0.5:5000", true, false},
+		{"bare IPv4 is a single address", []string{"10.0.0.5"}, "10.0.0.6:5000", false, false},
+		{"IPv4 range", []string{"10.0.0.0/24"}, "10.0.0.200:5000", true, false},
+		{"outside the range", []string{"10.0.0.0/24"}, "10.0.1.1:5000", false, false},
+		{"bare IPv6", []string{"2001:db8::1"}, "[2001:db8::1]:5000", true, false},
+		{"bare IPv6 is a single address", []string{"2001:db8::1"}, "[2001:db8::2]:5000", false, false},
+		{"bare IPv4-mapped IPv6", []string{"::ffff:10.0.0.5"}, "10.0.0.5:5000", true, false},
+		{"IPv6 range", []string{"2001:db8::/32"}, "[2001:db8:1::9]:5000", true, false},
+		{"comma-separated entries", []string{"10.0.0.5, 192.168.1.0/24"}, "192.168.1.9:5000", true, false},
+		{"address without a port", []string{"10.0.0.5"}, "10.0.0.5", true, false},
+		{"unparsable client address", []string{"10.0.0.5"}, "unknown", false, false},
+		{"host name", []string{"console.corp.example"}, "", false, true},
+		{"invalid range", []string{"10.0.0.0/33"}, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAuthenticator(AuthOptions{Allow: tt.allow})
+			if tt.invalid {
+				if err == nil {
+					t.Errorf("NewAuthenticator(%q) succeeded, want an error", tt.allow)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := a.allowed(tt.addr); got != tt.want {
+				t.Errorf("allowed(%q) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+// writeTokens writes a tokens file and returns its path
+func writeTokens(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidToken(t *testing.T) {
+	a, err := NewAuthenticator(AuthOptions{TokensFile: writeTokens(t, "# console\nfirst-token\n\n  second-token  \n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"Bearer first-token", true},
+		{"Bearer second-token", true},
+		{"Bearer  second-token ", true},
+		{"Bearer # console", false},
+		{"Bearer first", false},
+		{"Bearer first-token-and-more", false},
+		{"Basic first-token", false},
+		{"first-token", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		if got := a.validToken(r); got != tt.want {
+			t.Errorf("validToken(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+
+	if _, err := NewAuthenticator(AuthOptions{TokensFile: writeTokens(t, "# no tokens yet\n")}); err == nil {
+		t.Error("a tokens file without tokens was accepted")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	a, err := NewAuthenticator(AuthOptions{Allow: []string{"10.0.0.0/24"}, TokensFile: writeTokens(t, "secret\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := a.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// The address is checked before the token, so clients outside the allowlist
+	// learn nothing about the tokens
+	tests := []struct {
+		name   string
+		addr   string
+		token  string
+		status int
+	}{
+		{"outside the allowlist without a token", "192.168.1.1:5000", "", http.StatusForbidden},
+		{"outside the allowlist with a token", "192.168.1.1:5000", "secret", http.StatusForbidden},
+		{"allowed address without a token", "10.0.0.1:5000", "", http.StatusUnauthorized},
+		{"allowed address with a wrong token", "10.0.0.1:5000", "guess", http.StatusUnauthorized},
+		{"allowed address with the token", "10.0.0.1:5000", "secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+			r.RemoteAddr = tt.addr
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if challenge := w.Header().Get("WWW-Authenticate"); (tt.status == http.StatusUnauthorized) != (challenge != "") {
+				t.Errorf("WWW-Authenticate = %q with status %d", challenge, w.Code)
+			}
+		})
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	tests := []struct {
+		name string
+		opts AuthOptions
+		want bool
+	}{
+		{"nothing", AuthOptions{}, false},
+		{"TLS alone", AuthOptions{CertFile: "cert.pem", KeyFile: "key.pem"}, false},
+		{"client CA", AuthOptions{CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: "ca.pem"}, true},
+		{"tokens", AuthOptions{TokensFile: "tokens"}, true},
+		{"allowlist", AuthOptions{Allow: []string{"10.0.0.0/8"}}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.Enabled(); got != tt.want {
+			t.Errorf("%s: Enabled() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
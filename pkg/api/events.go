@@ -0,0 +1,165 @@
+// Package api serves the events of the local store to a central console
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/query"
+	"lemita/datn/pkg/store"
+)
+
+// Page sizes of GET /events
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// maxScanPerPage bounds the events examined for one page, so a selective filter
+// returns a short page with a cursor instead of scanning the whole store at once
+const maxScanPerPage = 100000
+
+// Page is the response of GET /events
+type Page struct {
+	Events     []eventlog.EventLogData `json:"events"`
+	NextCursor string                  `json:"next_cursor,omitempty"` // Pass as ?cursor= for the next page, or later for newly stored events
+	More       bool                    `json:"more"`                  // More events are stored after this page
+	Scanned    int                     `json:"scanned"`               // Events examined for this page
+}
+
+// filter is the server-side filter of a GET /events request
+type filter struct {
+	query    *query.Query
+	channel  string
+	eventIDs map[uint32]bool
+	since    time.Time
+	until    time.Time
+}
+
+// match reports whether an event passes the filter
+func (f *filter) match(event eventlog.EventLogData) bool {
+	if f.channel != "" && !strings.EqualFold(event.Channel, f.channel) {
+		return false
+	}
+	if len(f.eventIDs) > 0 && !f.eventIDs[event.EventID] {
+		return false
+	}
+	generated := time.Unix(int64(event.TimeGenerated), 0)
+	if !f.since.IsZero() && generated.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !generated.Before(f.until) {
+		return false
+	}
+	return f.query == nil || f.query.Match(event)
+}
+
+// parseFilter reads the filter parameters: q (query language, see query.Parse),
+// channel, event_id (comma-separated), since and until
+func parseFilter(r *http.Request) (*filter, error) {
+	params := r.URL.Query()
+	f := &filter{channel: params.Get("channel")}
+	now := time.Now()
+
+	if q := params.Get("q"); q != "" {
+		parsed, err := query.Parse(q)
+		if err != nil {
+			return nil, fmt.Errorf("invalid q: %v", err)
+		}
+		f.query = parsed
+	}
+	if ids := params.Get("event_id"); ids != "" {
+		f.eventIDs = map[uint32]bool{}
+		for _, id := range strings.Split(ids, ",") {
+			n, err := strconv.ParseUint(strings.TrimSpace(id), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid event_id %q", id)
+			}
+			f.eventIDs[uint32(n)] = true
+		}
+	}
+	for name, t := range map[string]*time.Time{"since": &f.since, "until": &f.until} {
+		if value := params.Get(name); value != "" {
+			parsed, err := query.ParseTime(value, now)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", name, err)
+			}
+			*t = parsed
+		}
+	}
+	return f, nil
+}
+
+// EventsHandler serves GET /events: one page of the store's events, oldest first,
+// matching the filter parameters. limit sets the page size and cursor continues
+// from the previous page's next_cursor. Pages are read straight from the segment
+// files, so the agent never holds more than one page in memory.
+func EventsHandler(s *store.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		f, err := parseFilter(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		cursor, err := store.ParseCursor(r.URL.Query().Get("cursor"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		limit := DefaultPageSize
+		if value := r.URL.Query().Get("limit"); value != "" {
+			if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+				writeError(w, http.StatusBadRequest, "invalid limit")
+				return
+			}
+			limit = min(limit, MaxPageSize)
+		}
+
+		page := Page{Events: []eventlog.EventLogData{}}
+		next := cursor
+		err = s.ScanFrom(cursor, func(event eventlog.EventLogData, after store.Cursor) error {
+			if len(page.Events) == limit || page.Scanned == maxScanPerPage {
+				page.More = true
+				return store.ErrStop
+			}
+			page.Scanned++
+			next = after
+			if f.match(event) {
+				page.Events = append(page.Events, event)
+			}
+			return nil
+		})
+		if errors.Is(err, store.ErrCursorExpired) {
+			writeError(w, http.StatusGone, "cursor expired, start again without one")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		page.NextCursor = next.String()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	})
+}
+
+// writeError responds with a JSON error message
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{message})
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/store"
+)
+
+// maxNoteSize bounds the body of a POST /notes request
+const maxNoteSize = 64 << 10
+
+// noteRequest is the body of POST /notes
+type noteRequest struct {
+	UID    string   `json:"uid"`
+	Labels []string `json:"labels"`
+	Text   string   `json:"text"`
+	Author string   `json:"author"` // Ignored when the client has a certificate, whose identity is recorded instead
+}
+
+// NotesHandler serves POST /notes, which attaches labels and a note to the stored
+// event with the given UID. GET /events returns the notes with the events.
+func NotesHandler(s *store.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		var request noteRequest
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxNoteSize))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid note: %v", err))
+			return
+		}
+
+		note := eventlog.Note{Labels: request.Labels, Text: request.Text, Author: request.Author}
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			note.Author = r.TLS.VerifiedChains[0][0].Subject.CommonName
+		}
+		if err := s.AddNote(request.UID, note); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Operations a controller can invoke on the agent's listener
+const (
+	OpHealth   = "health"   // Read the collection status (/healthz)
+	OpEvents   = "events"   // Read collected events (/events)
+	OpAnnotate = "annotate" // Label and note collected events (/notes)
+)
+
+// operations lists the valid operation names
+var operations = map[string]bool{OpHealth: true, OpEvents: true, OpAnnotate: true}
+
+// Policy maps controller identities, the common names of their client
+// certificates, to the operations they may invoke. The identity "*" applies to
+// every client without its own line. A nil policy allows everything.
+type Policy map[string]map[string]bool
+
+// LoadPolicy reads a policy file of "identity: operation, operation" lines, e.g.
+//
+//	console.corp.example: events, health
+//	*: health
+//
+// Blank lines and lines starting with # are ignored.
+func LoadPolicy(path string) (Policy, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open policy file: %v", err)
+	}
+	defer file.Close()
+
+	policy := Policy{}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		identity, ops, ok := strings.Cut(line, ":")
+		identity = strings.ToLower(strings.TrimSpace(identity))
+		if !ok || identity == "" {
+			return nil, fmt.Errorf("%s:%d: expected \"identity: operations\"", path, lineNumber)
+		}
+		allowed := policy[identity]
+		if allowed == nil {
+			allowed = map[string]bool{}
+			policy[identity] = allowed
+		}
+		for _, op := range strings.Split(ops, ",") {
+			op = strings.ToLower(strings.TrimSpace(op))
+			if op == "" {
+				continue
+			}
+			if !operations[op] {
+				return nil, fmt.Errorf("%s:%d: unknown operation %q", path, lineNumber, op)
+			}
+			allowed[op] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %v", err)
+	}
+	return policy, nil
+}
+
+// Allows reports whether identity may invoke op
+func (p Policy) Allows(identity, op string) bool {
+	if p == nil {
+		return true
+	}
+	if allowed, ok := p[strings.ToLower(identity)]; ok {
+		return allowed[op]
+	}
+	return p["*"][op]
+}
+
+// Restrict only passes requests to h when the client certificate's identity may
+// invoke op; requests without a verified client certificate are refused
+func (p Policy) Restrict(op string, h http.Handler) http.Handler {
+	if p == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			writeError(w, http.StatusForbidden, "a client certificate is required")
+			return
+		}
+		identity := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		if !p.Allows(identity, op) {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("%s may not invoke %s", identity, op))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
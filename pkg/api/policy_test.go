@@ -0,0 +1,98 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy")
+	content := "# controllers\nConsole.corp.example: events, HEALTH\nsoc.corp.example: annotate\nsoc.corp.example: events\nreadonly.corp.example:\n*: health\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		identity string
+		op       string
+		want     bool
+	}{
+		{"console.corp.example", OpEvents, true},
+		{"CONSOLE.corp.example", OpHealth, true},
+		{"console.corp.example", OpAnnotate, false},
+		{"soc.corp.example", OpAnnotate, true},
+		{"soc.corp.example", OpEvents, true},
+		// An identity with its own line doesn't fall back to "*"
+		{"readonly.corp.example", OpHealth, false},
+		{"laptop.corp.example", OpHealth, true},
+		{"laptop.corp.example", OpEvents, false},
+	}
+	for _, tt := range tests {
+		if got := policy.Allows(tt.identity, tt.op); got != tt.want {
+			t.Errorf("Allows(%q, %q) = %v, want %v", tt.identity, tt.op, got, tt.want)
+		}
+	}
+
+	var none Policy
+	if !none.Allows("anyone", OpAnnotate) {
+		t.Error("a nil policy refused an operation")
+	}
+}
+
+func TestLoadPolicyErrors(t *testing.T) {
+	for _, content := range []string{
+		"console.corp.example events\n",
+		": events\n",
+		"console.corp.example: events, shutdown\n",
+	} {
+		path := filepath.Join(t.TempDir(), "policy")
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadPolicy(path); err == nil {
+			t.Errorf("LoadPolicy(%q) succeeded, want an error", content)
+		}
+	}
+}
+
+func TestRestrict(t *testing.T) {
+	policy := Policy{"console.corp.example": {OpEvents: true}, "*": {OpHealth: true}}
+	h := policy.Restrict(OpEvents, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// withCert returns the TLS state of a connection with a verified client certificate
+	withCert := func(commonName string) *tls.ConnectionState {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	tests := []struct {
+		name   string
+		tls    *tls.ConnectionState
+		status int
+	}{
+		{"plain HTTP", nil, http.StatusForbidden},
+		{"TLS without a client certificate", &tls.ConnectionState{}, http.StatusForbidden},
+		{"allowed identity", withCert("console.corp.example"), http.StatusOK},
+		{"identity only allowed by the fallback", withCert("laptop.corp.example"), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/events", nil)
+			r.TLS = tt.tls
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+// Package audit keeps an append-only log of the collector's own actions. Every
+// record carries the SHA-256 of the previous record, so editing, removing or
+// reordering records breaks the chain, and the head recorded in a run summary
+// shows whether the log was truncated afterwards.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// Actions recorded by the collector
+const (
+	ActionStart        = "start"         // Collector started, with its effective configuration
+	ActionReadChannel  = "read-channel"  // Events read from a channel
+	ActionInventory    = "inventory"     // Services, tasks or autoruns listed and their files hashed
+	ActionAPIRequest   = "api-request"   // Request served on the HTTP listener
+	ActionConfigChange = "config-change" // System configuration changed by the collector
+	ActionStop         = "stop"          // Collector finished
+)
+
+// DefaultPath returns the audit log written when no -audit-log is given: one log
+// in the data directory for every run, wherever it was started from
+func DefaultPath() string {
+	if programData := os.Getenv("ProgramData"); programData != "" {
+		return filepath.Join(programData, "datn", "audit.jsonl")
+	}
+	return filepath.Join(os.TempDir(), "datn-audit.jsonl")
+}
+
+// Record is one line of the audit log
+type Record struct {
+	Seq    uint64    `json:"seq"`
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Detail string    `json:"detail"`
+	Prev   string    `json:"prev"` // Hash of the previous record ("" for the first)
+	Hash   string    `json:"hash"`
+}
+
+// digest computes the hash of a record from its other fields
+func (r *Record) digest() string {
+	sum := sha256.Sum256([]byte(r.Prev + "\n" + strconv.FormatUint(r.Seq, 10) + "\n" +
+		r.Time.UTC().Format(time.RFC3339Nano) + "\n" + r.Action + "\n" + r.Detail))
+	return hex.EncodeToString(sum[:])
+}
+
+// Head identifies the newest record of a log
+type Head struct {
+	Path string `json:"path"`
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// Log appends records to an audit log file. A nil *Log records nothing.
+type Log struct {
+	mu     sync.Mutex
+	file   *os.File
+	path   string
+	seq    uint64
+	last   string
+	offset int64 // End of the last record known to this process
+}
+
+// lockOffset is the byte locked while the log is read or appended to. It lies far
+// past the end of any log, since Windows file locks are mandatory and a lock on
+// the records themselves would make other readers fail instead of wait.
+const lockOffset = 1 << 62
+
+// Open opens an audit log for appending, continuing its chain; a missing log is
+// created. A partial record at the end, left by a write interrupted by a crash or
+// power loss, is removed. A log that doesn't verify is still opened, continuing
+// from its last readable record: collection must not depend on the log's history.
+// Both are returned as warnings.
+func Open(path string) (*Log, []string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, nil, fmt.Errorf("failed to create audit log directory: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	l := &Log{file: file, path: path}
+	if err := l.lock(); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	defer l.unlock()
+
+	head, end, problem, err := scan(file, 0, Head{Path: path})
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	var warnings []string
+	if problem != nil {
+		warnings = append(warnings, fmt.Sprintf("audit log %s does not verify (%v); new records continue from record %d", path, problem, head.Seq))
+	}
+	torn, err := l.truncate(end)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if torn {
+		warnings = append(warnings, fmt.Sprintf("removed a partial record left by an interrupted write at the end of audit log %s", path))
+	}
+	l.seq, l.last, l.offset = head.Seq, head.Hash, end
+	return l, warnings, nil
+}
+
+// lock takes the exclusive lock of the log file, waiting while another process
+// holds it
+func (l *Log) lock() error {
+	overlapped := windows.Overlapped{OffsetHigh: lockOffset >> 32}
+	if err := windows.LockFileEx(windows.Handle(l.file.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, &overlapped); err != nil {
+		return fmt.Errorf("failed to lock audit log %s: %v", l.path, err)
+	}
+	return nil
+}
+
+// unlock releases the lock taken by lock
+func (l *Log) unlock() {
+	overlapped := windows.Overlapped{OffsetHigh: lockOffset >> 32}
+	windows.UnlockFileEx(windows.Handle(l.file.Fd()), 0, 1, 0, &overlapped)
+}
+
+// truncate cuts the log back to end, the end of its last complete record, and
+// reports whether there was anything after it
+func (l *Log) truncate(end int64) (bool, error) {
+	info, err := l.file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to read audit log %s: %v", l.path, err)
+	}
+	if info.Size() <= end {
+		return false, nil
+	}
+	if err := l.file.Truncate(end); err != nil {
+		return false, fmt.Errorf("failed to remove the partial record of audit log %s: %v", l.path, err)
+	}
+	return true, nil
+}
+
+// Record appends a record; errors are returned so callers can report them, but a
+// failed write never stops collection. Other processes may append to the same log,
+// so the records they wrote since are read first and the chain continues after them.
+func (l *Log) Record(action, format string, args ...any) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.lock(); err != nil {
+		return err
+	}
+	defer l.unlock()
+
+	head, end, _, err := scan(l.file, l.offset, Head{Path: l.path, Seq: l.seq, Hash: l.last})
+	if err != nil {
+		return err
+	}
+	if _, err := l.truncate(end); err != nil {
+		return err
+	}
+	l.seq, l.last, l.offset = head.Seq, head.Hash, end
+
+	record := Record{
+		Seq:    l.seq + 1,
+		Time:   time.Now().UTC(),
+		Action: action,
+		Detail: fmt.Sprintf(format, args...),
+		Prev:   l.last,
+	}
+	record.Hash = record.digest()
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := l.file.WriteAt(line, l.offset); err != nil {
+		return fmt.Errorf("failed to write audit log: %v", err)
+	}
+	l.seq, l.last, l.offset = record.Seq, record.Hash, l.offset+int64(len(line))
+	return nil
+}
+
+// Head returns the newest record written so far
+func (l *Log) Head() *Head {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return &Head{Path: l.path, Seq: l.seq, Hash: l.last}
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// Verify checks the hash chain of an audit log and returns its newest record
+func Verify(path string) (Head, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Head{Path: path}, err
+	}
+	defer file.Close()
+
+	head, end, problem, err := scan(file, 0, Head{Path: path})
+	if err != nil {
+		return head, err
+	}
+	if problem != nil {
+		return head, problem
+	}
+	if info, err := file.Stat(); err == nil && info.Size() > end {
+		return head, fmt.Errorf("audit record %d is incomplete", head.Seq+1)
+	}
+	return head, nil
+}
+
+// scan reads the records of file from offset on, continuing the chain of head. It
+// returns the newest record, the end of the last complete line and the first break
+// in the chain, if any. After a break the chain continues from the next readable
+// record, so one damaged record doesn't hide the ones after it. A last line without
+// its newline is an interrupted write and is not read.
+func scan(file *os.File, offset int64, head Head) (_ Head, end int64, problem, err error) {
+	reader := bufio.NewReader(io.NewSectionReader(file, offset, lockOffset-offset))
+	end = offset
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return head, end, problem, nil
+		}
+		if err != nil {
+			return head, end, problem, fmt.Errorf("failed to read audit log: %v", err)
+		}
+		end += int64(len(line))
+
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			if problem == nil {
+				problem = fmt.Errorf("audit record %d is unreadable: %v", head.Seq+1, err)
+			}
+			continue
+		}
+		if problem == nil {
+			if record.Seq != head.Seq+1 || record.Prev != head.Hash {
+				problem = fmt.Errorf("audit record %d does not follow record %d", record.Seq, head.Seq)
+			} else if record.digest() != record.Hash {
+				problem = fmt.Errorf("audit record %d was modified", record.Seq)
+			}
+		}
+		head.Seq, head.Hash = record.Seq, record.Hash
+	}
+}
@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenRemovesTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, _, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Record(ActionStart, "first run")
+	log.Close()
+
+	// A crash in the middle of the second run's write
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"seq":2,"time":"2026-`)
+	file.Close()
+
+	log, warnings, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open after a torn write: %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("warnings = %q, want one about the partial record", warnings)
+	}
+	if err := log.Record(ActionStart, "third run"); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+
+	head, err := Verify(path)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if head.Seq != 2 {
+		t.Errorf("head = record %d, want 2", head.Seq)
+	}
+}
+
+func TestRecordContinuesOtherWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	first, _, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, _, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	for _, log := range []*Log{first, second, first, second} {
+		if err := log.Record(ActionReadChannel, "interleaved"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	head, err := Verify(path)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if head.Seq != 4 {
+		t.Errorf("head = record %d, want 4", head.Seq)
+	}
+}
+
+func TestOpenContinuesBrokenChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := os.WriteFile(path, []byte("not a record\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	log, warnings, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open of a broken log: %v", err)
+	}
+	defer log.Close()
+	if len(warnings) != 1 {
+		t.Errorf("warnings = %q, want one about the broken chain", warnings)
+	}
+	if err := log.Record(ActionStart, "still recording"); err != nil {
+		t.Fatal(err)
+	}
+}
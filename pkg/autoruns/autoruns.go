@@ -0,0 +1,259 @@
+// Package autoruns enumerates the programs Windows starts at boot or logon: the
+// Run and RunOnce keys of the machine and of every loaded user hive, the Startup
+// folders and the Winlogon Shell, Userinit and related values
+package autoruns
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+
+	"lemita/datn/pkg/filesenum"
+)
+
+// Categories of autorun entries
+const (
+	CategoryRun      = "run"      // Run, RunOnce and policy Run keys
+	CategoryStartup  = "startup"  // Startup folders
+	CategoryWinlogon = "winlogon" // Winlogon values started with the user's session
+)
+
+// Entry is a program started at boot or logon
+type Entry struct {
+	Category string `json:"category"`
+	Location string `json:"location"`       // Registry key or folder, e.g. HKLM\SOFTWARE\...\Run
+	Name     string `json:"name"`           // Value or file name
+	User     string `json:"user,omitempty"` // SID of the user hive, or profile of a user Startup folder; empty for machine-wide entries
+	Command  string `json:"command"`        // Command line as stored
+	Binary   string `json:"binary"`         // Program of the command line, with environment variables expanded
+	Hash     string `json:"sha256"`         // SHA-256 of Binary, or filesenum.UnavailableHash
+	Default  bool   `json:"default,omitempty"`
+}
+
+// runKeys are the Run keys below HKLM and each user's hive
+var runKeys = []string{
+	`SOFTWARE\Microsoft\Windows\CurrentVersion\Run`,
+	`SOFTWARE\Microsoft\Windows\CurrentVersion\RunOnce`,
+	`SOFTWARE\Microsoft\Windows\CurrentVersion\Policies\Explorer\Run`,
+	`SOFTWARE\WOW6432Node\Microsoft\Windows\CurrentVersion\Run`,
+	`SOFTWARE\WOW6432Node\Microsoft\Windows\CurrentVersion\RunOnce`,
+}
+
+// winlogonKey holds the programs started with a user's session
+const winlogonKey = `SOFTWARE\Microsoft\Windows NT\CurrentVersion\Winlogon`
+
+// winlogonValues are the Winlogon values holding programs, with the value Windows
+// ships with (empty when the value is normally absent). Userinit is a comma
+// separated list.
+var winlogonValues = []struct {
+	name, standard string
+}{
+	{"Shell", "explorer.exe"},
+	{"Userinit", `C:\Windows\system32\userinit.exe`},
+	{"Taskman", ""},
+	{"AppSetup", ""},
+}
+
+// machineStartup is the all-users Startup folder
+const machineStartup = `C:\ProgramData\Microsoft\Windows\Start Menu\Programs\StartUp`
+
+// userStartup is the Startup folder below a user profile
+const userStartup = `AppData\Roaming\Microsoft\Windows\Start Menu\Programs\Startup`
+
+// usersFolder holds the user profiles
+const usersFolder = `C:\Users`
+
+// ListOn lists the autorun entries of a computer (empty = local) with the SHA-256
+// of their programs. Remote registry access needs the RemoteRegistry service and
+// the Startup folders are read through the admin share. Only the user hives that
+// are loaded, those of logged on users and services, are examined.
+func ListOn(server string) ([]Entry, error) {
+	l := &lister{server: server, hashes: map[string]string{}}
+
+	machine, remote, err := filesenum.OpenHive(server, registry.LOCAL_MACHINE)
+	if err != nil {
+		return nil, err
+	}
+	if remote {
+		defer machine.Close()
+	}
+	for _, path := range runKeys {
+		l.runKey(machine, `HKLM\`, path, "")
+	}
+	l.winlogon(machine, `HKLM\`, "")
+
+	users, remote, err := filesenum.OpenHive(server, registry.USERS)
+	if err != nil {
+		fmt.Printf("Warning: Could not open the user hives: %v\n", err)
+	} else {
+		if remote {
+			defer users.Close()
+		}
+		sids, err := users.ReadSubKeyNames(0)
+		if err != nil {
+			fmt.Printf("Warning: Could not list the user hives: %v\n", err)
+		}
+		for _, sid := range sids {
+			if strings.HasSuffix(sid, "_Classes") {
+				continue
+			}
+			for _, path := range runKeys {
+				l.runKey(users, `HKU\`+sid+`\`, sid+`\`+path, sid)
+			}
+			l.winlogon(users, `HKU\`+sid+`\`, sid)
+		}
+	}
+
+	l.folder(machineStartup, "")
+	profiles, err := os.ReadDir(filesenum.AdminSharePath(server, usersFolder))
+	if err != nil {
+		fmt.Printf("Warning: Could not list the user profiles: %v\n", err)
+	}
+	for _, profile := range profiles {
+		if profile.IsDir() {
+			l.folder(filepath.Join(usersFolder, profile.Name(), userStartup), profile.Name())
+		}
+	}
+
+	sort.SliceStable(l.entries, func(i, j int) bool {
+		return l.entries[i].Category < l.entries[j].Category
+	})
+	return l.entries, nil
+}
+
+// ListInventoryOn lists the autorun programs of a computer (empty = local) as
+// filesenum.PEInfo entries, for the fleet and triage inventories and triggers
+func ListInventoryOn(server string) ([]filesenum.PEInfo, error) {
+	entries, err := ListOn(server)
+	if err != nil {
+		return nil, err
+	}
+	var list []filesenum.PEInfo
+	for _, entry := range entries {
+		list = append(list, filesenum.PEInfo{
+			FilePath: entry.Binary,
+			Hash:     entry.Hash,
+			Name:     entry.Name,
+			Kind:     filesenum.KindAutorun,
+			Location: entry.Location,
+		})
+	}
+	return list, nil
+}
+
+// lister accumulates the entries of one computer
+type lister struct {
+	server  string
+	hashes  map[string]string
+	entries []Entry
+}
+
+// add records an entry, resolving and hashing its program
+func (l *lister) add(entry Entry) {
+	if entry.Binary == "" {
+		entry.Binary = filesenum.ResolveCommand(entry.Command)
+	}
+	if entry.Binary == "" {
+		return
+	}
+	entry.Hash = filesenum.HashProgram(l.server, l.hashes, entry.Binary)
+	l.entries = append(l.entries, entry)
+}
+
+// runKey adds the values of a Run key; display is the prefix naming the hive
+func (l *lister) runKey(root registry.Key, display, path, user string) {
+	key, err := registry.OpenKey(root, path, registry.QUERY_VALUE)
+	if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+		return
+	}
+	location := display + strings.TrimPrefix(path, user+`\`)
+	if err != nil {
+		fmt.Printf("Warning: Could not open %s: %v\n", location, err)
+		return
+	}
+	defer key.Close()
+
+	names, err := key.ReadValueNames(0)
+	if err != nil {
+		fmt.Printf("Warning: Could not read %s: %v\n", location, err)
+	}
+	for _, name := range names {
+		command, _, err := key.GetStringValue(name)
+		if err != nil || strings.TrimSpace(command) == "" {
+			continue
+		}
+		l.add(Entry{Category: CategoryRun, Location: location, Name: name, User: user, Command: command})
+	}
+}
+
+// winlogon adds the programs of the Winlogon values; display is the prefix naming
+// the hive
+func (l *lister) winlogon(root registry.Key, display, user string) {
+	path := winlogonKey
+	if user != "" {
+		path = user + `\` + winlogonKey
+	}
+	key, err := registry.OpenKey(root, path, registry.QUERY_VALUE)
+	if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+		return
+	}
+	location := display + winlogonKey
+	if err != nil {
+		fmt.Printf("Warning: Could not open %s: %v\n", location, err)
+		return
+	}
+	defer key.Close()
+
+	for _, value := range winlogonValues {
+		command, _, err := key.GetStringValue(value.name)
+		if err != nil || strings.TrimSpace(command) == "" {
+			continue
+		}
+		// Userinit runs every program of its list
+		for _, part := range strings.Split(command, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			entry := Entry{
+				Category: CategoryWinlogon,
+				Location: location,
+				Name:     value.name,
+				User:     user,
+				Command:  part,
+				Default:  value.standard != "" && strings.EqualFold(part, value.standard),
+			}
+			// A bare Shell is looked up in the Windows folder, where explorer.exe is
+			if value.name == "Shell" && !strings.ContainsAny(part, `\/ `) {
+				entry.Binary = filepath.Join(os.Getenv("SystemRoot"), part)
+			}
+			l.add(entry)
+		}
+	}
+}
+
+// folder adds the files of a Startup folder; user is the profile name, empty for
+// the all-users folder
+func (l *lister) folder(path, user string) {
+	entries, err := os.ReadDir(filesenum.AdminSharePath(l.server, path))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("Warning: Could not read %s: %v\n", path, err)
+		}
+		return
+	}
+	for _, file := range entries {
+		if file.IsDir() || strings.EqualFold(file.Name(), "desktop.ini") {
+			continue
+		}
+		// Shortcuts are hashed as files; their target is not resolved
+		binary := filepath.Join(path, file.Name())
+		l.add(Entry{Category: CategoryStartup, Location: path, Name: file.Name(), User: user, Command: binary, Binary: binary})
+	}
+}
@@ -0,0 +1,146 @@
+// Package benchmark measures the throughput of the record parser, the .evtx
+// reader, the report formatters and the per-batch pipeline on synthetic events, so
+// performance work can be checked against a saved baseline.
+//
+// Results depend on the machine, so a baseline is only meaningful on the computer
+// it was recorded on and none is kept in the repository: record one before a
+// change with "datn bench -save baseline.json" and compare after it with "datn
+// bench -baseline baseline.json", which fails when a case got slower than the
+// tolerance allows. The same cases run as go test benchmarks in pkg/eventlog,
+// pkg/formatter and pkg/evtx (make bench).
+package benchmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+// Case is one measured operation
+type Case struct {
+	Name string
+	Run  func(b *testing.B)
+}
+
+// Result is the measurement of a case
+type Result struct {
+	Name        string  `json:"name"`
+	Iterations  int     `json:"iterations"`
+	NsPerOp     int64   `json:"ns_per_op"`
+	BytesPerOp  int64   `json:"bytes_per_op"`  // Allocated
+	AllocsPerOp int64   `json:"allocs_per_op"` // Allocations
+	MBPerSec    float64 `json:"mb_per_sec,omitempty"`
+}
+
+// String formats a result like go test -bench
+func (r Result) String() string {
+	s := fmt.Sprintf("%-24s %10d %14d ns/op", r.Name, r.Iterations, r.NsPerOp)
+	if r.MBPerSec > 0 {
+		s += fmt.Sprintf(" %10.2f MB/s", r.MBPerSec)
+	}
+	return s + fmt.Sprintf(" %12d B/op %8d allocs/op", r.BytesPerOp, r.AllocsPerOp)
+}
+
+// Run measures the cases whose name matches pattern (nil = all) with
+// testing.Benchmark, calling progress after each one
+func Run(cases []Case, pattern *regexp.Regexp, progress func(Result)) []Result {
+	var results []Result
+	for _, c := range cases {
+		if pattern != nil && !pattern.MatchString(c.Name) {
+			continue
+		}
+		run := c.Run
+		r := testing.Benchmark(func(b *testing.B) {
+			b.ReportAllocs()
+			run(b)
+		})
+		result := Result{
+			Name:        c.Name,
+			Iterations:  r.N,
+			NsPerOp:     r.NsPerOp(),
+			BytesPerOp:  r.AllocedBytesPerOp(),
+			AllocsPerOp: r.AllocsPerOp(),
+		}
+		if r.Bytes > 0 && r.T > 0 {
+			result.MBPerSec = float64(r.Bytes) * float64(r.N) / 1e6 / r.T.Seconds()
+		}
+		results = append(results, result)
+		if progress != nil {
+			progress(result)
+		}
+	}
+	return results
+}
+
+// Baseline is a saved set of results
+type Baseline struct {
+	Host    string   `json:"host"`
+	Go      string   `json:"go"`
+	Events  int      `json:"events"` // Synthetic events per operation
+	Results []Result `json:"results"`
+}
+
+// LoadBaseline reads a baseline written by SaveBaseline
+func LoadBaseline(path string) (Baseline, error) {
+	var baseline Baseline
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return baseline, fmt.Errorf("failed to read baseline %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return baseline, fmt.Errorf("failed to parse baseline %s: %v", path, err)
+	}
+	return baseline, nil
+}
+
+// SaveBaseline writes a baseline as indented JSON
+func SaveBaseline(path string, baseline Baseline) error {
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode baseline: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write baseline %s: %v", path, err)
+	}
+	return nil
+}
+
+// Regression is a case slower than its baseline by more than the tolerance
+type Regression struct {
+	Name     string
+	Baseline int64   // ns/op
+	Current  int64   // ns/op
+	Change   float64 // Relative increase, e.g. 0.25 for 25% slower
+}
+
+// String describes the regression
+func (r Regression) String() string {
+	return fmt.Sprintf("%s: %d ns/op, %+.1f%% against %d ns/op", r.Name, r.Current, r.Change*100, r.Baseline)
+}
+
+// Compare returns the cases of results that take more than tolerance (0.10 =
+// 10%) longer per operation than in the baseline, slowest change first. Cases
+// missing from the baseline are not compared.
+func Compare(results []Result, baseline Baseline, tolerance float64) []Regression {
+	previous := make(map[string]int64, len(baseline.Results))
+	for _, r := range baseline.Results {
+		previous[r.Name] = r.NsPerOp
+	}
+	var regressions []Regression
+	for _, r := range results {
+		before, ok := previous[r.Name]
+		if !ok || before <= 0 {
+			continue
+		}
+		if change := float64(r.NsPerOp-before) / float64(before); change > tolerance {
+			regressions = append(regressions, Regression{Name: r.Name, Baseline: before, Current: r.NsPerOp, Change: change})
+		}
+	}
+	sort.Slice(regressions, func(i, j int) bool {
+		return regressions[i].Change > regressions[j].Change
+	})
+	return regressions
+}
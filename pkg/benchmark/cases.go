@@ -0,0 +1,173 @@
+package benchmark
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/evtx"
+	"lemita/datn/pkg/filter"
+	"lemita/datn/pkg/formatter"
+)
+
+// DefaultEvents is the number of synthetic events of an operation
+const DefaultEvents = 10000
+
+// baseTime is the Unix time of the first synthetic event, fixed so runs compare
+const baseTime = 1717200000 // 2024-06-01 00:00:00 UTC
+
+// template is the shape of a family of synthetic events
+type template struct {
+	channel string
+	source  string
+	eventID uint32
+	strings func(r *rand.Rand) []string
+}
+
+// templates mix the events the collector sees most: logons, process creations,
+// Sysmon network connections and service installs, with the insertion strings of
+// the real events so field naming and typing do their usual work
+var templates = []template{
+	{"Security", "Microsoft-Windows-Security-Auditing", 4624, func(r *rand.Rand) []string {
+		return []string{"S-1-5-18", "WS01$", "CORP", "0x3e7", fmt.Sprintf("S-1-5-21-1004336348-1177238915-682003330-%d", 1000+r.Intn(500)),
+			fmt.Sprintf("user%03d", r.Intn(500)), "CORP", fmt.Sprintf("0x%x", r.Int63n(1<<32)), []string{"2", "3", "10"}[r.Intn(3)],
+			"User32", "Negotiate", "WS01", "{00000000-0000-0000-0000-000000000000}", "-", "-", "0",
+			fmt.Sprintf("0x%x", 400+r.Intn(4000)), `C:\Windows\System32\svchost.exe`,
+			fmt.Sprintf("10.0.%d.%d", r.Intn(256), r.Intn(256)), fmt.Sprint(49152 + r.Intn(16384)), "%%1833"}
+	}},
+	{"Security", "Microsoft-Windows-Security-Auditing", 4688, func(r *rand.Rand) []string {
+		image := []string{`C:\Windows\System32\cmd.exe`, `C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe`, `C:\Program Files\App\app.exe`}[r.Intn(3)]
+		return []string{"S-1-5-21-1004336348-1177238915-682003330-1001", "alice", "CORP", "0x5c3a1", fmt.Sprintf("0x%x", 400+r.Intn(8000)),
+			image, "%%1936", fmt.Sprintf("0x%x", 400+r.Intn(8000)), image + " /c echo " + strings.Repeat("x", r.Intn(200)),
+			"S-1-0-0", "-", "-", "0x0", `C:\Windows\explorer.exe`, "S-1-16-8192"}
+	}},
+	{"Microsoft-Windows-Sysmon/Operational", "Microsoft-Windows-Sysmon", 3, func(r *rand.Rand) []string {
+		return []string{"-", "2024-06-01 00:00:00.000", "{7d1c5b7e-1f2a-665a-0000-0010a1b2c3d4}", fmt.Sprint(400 + r.Intn(8000)),
+			`C:\Program Files\Browser\browser.exe`, `CORP\alice`, "tcp", "true", "false",
+			fmt.Sprintf("10.0.0.%d", r.Intn(256)), "WS01.corp.example", fmt.Sprint(49152 + r.Intn(16384)), "-",
+			"false", fmt.Sprintf("93.184.%d.%d", r.Intn(256), r.Intn(256)), "example.com", "443", "https"}
+	}},
+	{"System", "Service Control Manager", 7045, func(r *rand.Rand) []string {
+		return []string{fmt.Sprintf("svc%04d", r.Intn(10000)), fmt.Sprintf(`C:\Windows\Temp\svc%04d.exe`, r.Intn(10000)),
+			"user mode service", "demand start", "LocalSystem"}
+	}},
+}
+
+// Events returns n synthetic events, the same for a given n on every run
+func Events(n int) []eventlog.EventLogData {
+	r := rand.New(rand.NewSource(1))
+	events := make([]eventlog.EventLogData, n)
+	for i := range events {
+		t := templates[r.Intn(len(templates))]
+		events[i] = eventlog.EventLogData{
+			Channel:       t.channel,
+			RecordNumber:  uint32(i + 1),
+			TimeGenerated: uint32(baseTime + i),
+			TimeWritten:   uint32(baseTime + i),
+			EventID:       t.eventID,
+			EventType:     eventlog.EVENTLOG_INFORMATION_TYPE,
+			SourceName:    t.source,
+			ComputerName:  "WS01.corp.example",
+			Strings:       t.strings(r),
+		}
+		events[i].Fields = eventlog.NamedData(t.channel, events[i])
+	}
+	return events
+}
+
+// Cases returns the benchmark cases over n synthetic events per operation. With
+// an .evtx file, such as a large log saved with wevtutil epl, the .evtx reader is
+// measured on it as well.
+func Cases(n int, evtxPath string) ([]Case, error) {
+	events := Events(n)
+	records := eventlog.EncodeRecords(events)
+	pipelineFilter, err := filter.Compile(`event.id in [4624, 4688] && event.data.TargetUserName != "-"`)
+	if err != nil {
+		return nil, err
+	}
+
+	cases := []Case{
+		{"parse/records", func(b *testing.B) {
+			b.SetBytes(int64(len(records)))
+			for i := 0; i < b.N; i++ {
+				eventlog.ParseRecords("Security", records)
+			}
+		}},
+		{"fields/named", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, event := range events {
+					eventlog.NamedData(event.Channel, event)
+				}
+			}
+		}},
+		{"fields/typed", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, event := range events {
+					eventlog.TypedFields(event)
+				}
+			}
+		}},
+		formatCase("format/text", events, func(event eventlog.EventLogData) (string, error) {
+			return formatter.FormatLogEntry(event, 0), nil
+		}),
+		formatCase("format/json", events, formatter.FormatJSON),
+		formatCase("format/csv", events, formatter.FormatCSV),
+		formatCase("format/html", events, func(event eventlog.EventLogData) (string, error) {
+			return formatter.FormatHTML(event), nil
+		}),
+		{"pipeline/filter-json", func(b *testing.B) {
+			// The collector's per-batch work: name the fields, filter, then format
+			var sb strings.Builder
+			for i := 0; i < b.N; i++ {
+				logs := eventlog.ParseRecords("Security", records)
+				for j := range logs {
+					logs[j].Fields = eventlog.NamedData(logs[j].Channel, logs[j])
+				}
+				logs = filter.Apply(logs, []*filter.Expression{pipelineFilter}, nil)
+				sb.Reset()
+				if err := formatter.WriteJSONChannel(&sb, "Security", logs); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}},
+	}
+
+	if evtxPath != "" {
+		info, err := os.Stat(evtxPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read .evtx fixture: %v", err)
+		}
+		cases = append(cases, Case{"parse/evtx", func(b *testing.B) {
+			b.SetBytes(info.Size())
+			for i := 0; i < b.N; i++ {
+				if _, err := evtx.Scan(evtxPath, func(eventlog.EventLogData) error { return nil }); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}})
+	}
+	return cases, nil
+}
+
+// formatCase measures a formatter over every event
+func formatCase(name string, events []eventlog.EventLogData, format func(eventlog.EventLogData) (string, error)) Case {
+	return Case{name, func(b *testing.B) {
+		var size int64
+		for _, event := range events {
+			s, _ := format(event)
+			size += int64(len(s))
+		}
+		b.SetBytes(size)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for _, event := range events {
+				if _, err := format(event); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}}
+}
@@ -0,0 +1,339 @@
+package benchmark
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"unicode/utf16"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Layout of the .evtx files WriteEvtx generates, as the event log service writes
+// them: a 4 KB file header, then 64 KB chunks of a 512 byte header and records
+const (
+	evtxHeaderSize      = 4096
+	evtxChunkSize       = 65536
+	evtxChunkHeaderSize = 512
+)
+
+// Binary XML tokens and value types used by the generated records
+const (
+	binxmlEOF                  = 0x00
+	binxmlOpenStartElement     = 0x01
+	binxmlCloseStartElement    = 0x02
+	binxmlCloseEmptyElement    = 0x03
+	binxmlEndElement           = 0x04
+	binxmlAttribute            = 0x06
+	binxmlTemplateInstance     = 0x0c
+	binxmlNormalSubstitution   = 0x0d
+	binxmlOptionalSubstitution = 0x0e
+	binxmlFragmentHeader       = 0x0f
+	binxmlMore                 = 0x40
+
+	binxmlString   = 0x01
+	binxmlUInt8    = 0x04
+	binxmlUInt16   = 0x06
+	binxmlUInt64   = 0x0a
+	binxmlFileTime = 0x11
+)
+
+// systemSubstitutions is the number of substitutions of the System element; the
+// insertion strings follow them
+const systemSubstitutions = 7
+
+// WriteEvtx writes events to a new .evtx file at path, so the .evtx reader can be
+// measured on files of any size without shipping large logs. Each chunk defines a
+// template per number of insertion strings on first use, names are stored once per
+// chunk, and the file and chunk checksums are set, as in a log the service wrote.
+func WriteEvtx(path string, events []eventlog.EventLogData) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(make([]byte, evtxHeaderSize)); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	chunks := 0
+	chunk := newEvtxChunk()
+	for _, event := range events {
+		if chunk.add(event) {
+			continue
+		}
+		if chunk.records == 0 {
+			return fmt.Errorf("record %d does not fit in a chunk", event.RecordNumber)
+		}
+		if _, err := file.Write(chunk.finish()); err != nil {
+			return fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		chunks++
+		chunk = newEvtxChunk()
+		if !chunk.add(event) {
+			return fmt.Errorf("record %d does not fit in a chunk", event.RecordNumber)
+		}
+	}
+	if chunk.records > 0 {
+		if _, err := file.Write(chunk.finish()); err != nil {
+			return fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		chunks++
+	}
+
+	var next uint64 = 1
+	if len(events) > 0 {
+		next = uint64(events[len(events)-1].RecordNumber) + 1
+	}
+	header := make([]byte, 128)
+	copy(header, "ElfFile\x00")
+	le := binary.LittleEndian
+	le.PutUint64(header[8:], 0)                         // First chunk
+	le.PutUint64(header[16:], uint64(max(chunks-1, 0))) // Last chunk
+	le.PutUint64(header[24:], next)                     // Next record identifier
+	le.PutUint32(header[32:], 128)                      // Header size
+	le.PutUint16(header[36:], 1)                        // Minor version
+	le.PutUint16(header[38:], 3)                        // Major version
+	le.PutUint16(header[40:], evtxHeaderSize)           // Header block size
+	le.PutUint16(header[42:], uint16(chunks))           // Chunk count
+	le.PutUint32(header[124:], crc32.ChecksumIEEE(header[:120]))
+	if _, err := file.WriteAt(header, 0); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return file.Close()
+}
+
+// evtxChunk builds one chunk. A record that doesn't fit sets overflow and is
+// rolled back, leaving the chunk as it was before the record.
+type evtxChunk struct {
+	buf       []byte
+	pos       int
+	overflow  bool
+	names     map[string]uint32 // Offset of each name stored in the chunk
+	templates map[int]uint32    // Offset of the template of each insertion string count
+	added     []string          // Names stored by the record being written
+	records   int
+	first     uint64
+	last      uint64
+	lastAt    int // Offset of the last record
+}
+
+func newEvtxChunk() *evtxChunk {
+	return &evtxChunk{
+		buf:       make([]byte, evtxChunkSize),
+		pos:       evtxChunkHeaderSize,
+		names:     map[string]uint32{},
+		templates: map[int]uint32{},
+	}
+}
+
+func (c *evtxChunk) put(b ...byte) {
+	if c.pos+len(b) > len(c.buf) {
+		c.overflow = true
+		return
+	}
+	c.pos += copy(c.buf[c.pos:], b)
+}
+
+func (c *evtxChunk) u16(v uint16) { c.put(binary.LittleEndian.AppendUint16(nil, v)...) }
+func (c *evtxChunk) u32(v uint32) { c.put(binary.LittleEndian.AppendUint32(nil, v)...) }
+func (c *evtxChunk) u64(v uint64) { c.put(binary.LittleEndian.AppendUint64(nil, v)...) }
+
+// patch32 overwrites a value written earlier, unless the record already overflowed
+func (c *evtxChunk) patch32(at int, v uint32) {
+	if !c.overflow {
+		binary.LittleEndian.PutUint32(c.buf[at:], v)
+	}
+}
+
+// name writes a reference to a name, storing the name after it on first use
+func (c *evtxChunk) name(s string) {
+	if offset, ok := c.names[s]; ok {
+		c.u32(offset)
+		return
+	}
+	offset := uint32(c.pos + 4)
+	c.names[s] = offset
+	c.added = append(c.added, s)
+	units := utf16.Encode([]rune(s))
+	c.u32(offset)
+	c.u32(0) // Next name in the hash bucket
+	c.u16(0) // Hash
+	c.u16(uint16(len(units)))
+	for _, unit := range units {
+		c.u16(unit)
+	}
+	c.u16(0)
+}
+
+// element writes an element holding one substitution
+func (c *evtxChunk) element(name string, sub uint16, kind byte) {
+	c.put(binxmlOpenStartElement)
+	c.u16(0) // Dependency identifier
+	c.u32(0) // Data size
+	c.name(name)
+	c.put(binxmlCloseStartElement, binxmlOptionalSubstitution)
+	c.u16(sub)
+	c.put(kind, binxmlEndElement)
+}
+
+// attributeElement writes an empty element with one attribute set by a substitution
+func (c *evtxChunk) attributeElement(name, attribute string, sub uint16, kind byte) {
+	c.put(binxmlOpenStartElement | binxmlMore)
+	c.u16(0)
+	c.u32(0)
+	c.name(name)
+	c.u32(0) // Attribute list size
+	c.put(binxmlAttribute)
+	c.name(attribute)
+	c.put(binxmlNormalSubstitution)
+	c.u16(sub)
+	c.put(kind, binxmlCloseEmptyElement)
+}
+
+// open writes the start of an element with content
+func (c *evtxChunk) open(name string) {
+	c.put(binxmlOpenStartElement)
+	c.u16(0)
+	c.u32(0)
+	c.name(name)
+	c.put(binxmlCloseStartElement)
+}
+
+// template writes the body of the template of events with strings insertion strings
+func (c *evtxChunk) template(strings int) {
+	c.put(binxmlFragmentHeader, 1, 1, 0)
+	c.open("Event")
+	c.open("System")
+	c.attributeElement("Provider", "Name", 0, binxmlString)
+	c.element("EventID", 1, binxmlUInt16)
+	c.element("Level", 2, binxmlUInt8)
+	c.attributeElement("TimeCreated", "SystemTime", 3, binxmlFileTime)
+	c.element("EventRecordID", 4, binxmlUInt64)
+	c.element("Channel", 5, binxmlString)
+	c.element("Computer", 6, binxmlString)
+	c.put(binxmlEndElement)
+	c.open("EventData")
+	for i := 0; i < strings; i++ {
+		c.element("Data", uint16(systemSubstitutions+i), binxmlString)
+	}
+	c.put(binxmlEndElement, binxmlEndElement, binxmlEOF)
+}
+
+// add appends a record for event, reporting false when the chunk is full
+func (c *evtxChunk) add(event eventlog.EventLogData) bool {
+	start, names := c.pos, len(c.added)
+	_, defined := c.templates[len(event.Strings)]
+
+	written := filetime(event.TimeGenerated)
+	c.put(0x2a, 0x2a, 0x00, 0x00)
+	c.u32(0) // Size, patched below
+	c.u64(uint64(event.RecordNumber))
+	c.u64(written)
+
+	c.put(binxmlFragmentHeader, 1, 1, 0, binxmlTemplateInstance, 1)
+	c.u32(uint32(len(event.Strings))) // Template ID
+	if offset, ok := c.templates[len(event.Strings)]; ok {
+		c.u32(offset)
+	} else {
+		// The template is defined inline on its first use in the chunk
+		offset := uint32(c.pos + 4)
+		c.templates[len(event.Strings)] = offset
+		c.u32(offset)
+		c.u32(0)                   // Next template
+		c.put(make([]byte, 16)...) // GUID
+		sizeAt := c.pos
+		c.u32(0)
+		c.template(len(event.Strings))
+		c.patch32(sizeAt, uint32(c.pos-sizeAt-4))
+	}
+
+	level := byte(4)
+	switch event.EventType {
+	case eventlog.EVENTLOG_ERROR_TYPE:
+		level = 2
+	case eventlog.EVENTLOG_WARNING_TYPE:
+		level = 3
+	}
+	values := [][]byte{
+		utf16LE(event.SourceName),
+		binary.LittleEndian.AppendUint16(nil, uint16(event.EventID)),
+		{level},
+		binary.LittleEndian.AppendUint64(nil, filetime(event.TimeGenerated)),
+		binary.LittleEndian.AppendUint64(nil, uint64(event.RecordNumber)),
+		utf16LE(event.Channel),
+		utf16LE(event.ComputerName),
+	}
+	kinds := []byte{binxmlString, binxmlUInt16, binxmlUInt8, binxmlFileTime, binxmlUInt64, binxmlString, binxmlString}
+	for _, s := range event.Strings {
+		values = append(values, utf16LE(s))
+		kinds = append(kinds, binxmlString)
+	}
+	c.u32(uint32(len(values)))
+	for i, value := range values {
+		c.u16(uint16(len(value)))
+		c.put(kinds[i], 0)
+	}
+	for _, value := range values {
+		c.put(value...)
+	}
+	c.put(binxmlEOF)
+	c.u32(uint32(c.pos + 4 - start)) // Size again, closing the record
+	c.patch32(start+4, uint32(c.pos-start))
+
+	if c.overflow {
+		// Undo the record: the chunk is full
+		clear(c.buf[start:])
+		c.pos, c.overflow = start, false
+		for _, name := range c.added[names:] {
+			delete(c.names, name)
+		}
+		c.added = c.added[:names]
+		if !defined {
+			delete(c.templates, len(event.Strings))
+		}
+		return false
+	}
+	if c.records == 0 {
+		c.first = uint64(event.RecordNumber)
+	}
+	c.records++
+	c.last = uint64(event.RecordNumber)
+	c.lastAt = start
+	return true
+}
+
+// finish fills in the chunk header and returns the chunk
+func (c *evtxChunk) finish() []byte {
+	le := binary.LittleEndian
+	copy(c.buf, "ElfChnk\x00")
+	le.PutUint64(c.buf[8:], c.first)  // First record number
+	le.PutUint64(c.buf[16:], c.last)  // Last record number
+	le.PutUint64(c.buf[24:], c.first) // First record identifier
+	le.PutUint64(c.buf[32:], c.last)  // Last record identifier
+	le.PutUint32(c.buf[40:], 128)     // Header size
+	le.PutUint32(c.buf[44:], uint32(c.lastAt))
+	le.PutUint32(c.buf[48:], uint32(c.pos)) // Free space
+	le.PutUint32(c.buf[52:], crc32.ChecksumIEEE(c.buf[evtxChunkHeaderSize:c.pos]))
+	sum := crc32.NewIEEE()
+	sum.Write(c.buf[:120])
+	sum.Write(c.buf[128:evtxChunkHeaderSize])
+	le.PutUint32(c.buf[124:], sum.Sum32())
+	return c.buf
+}
+
+// utf16LE encodes s as UTF-16LE without a terminator
+func utf16LE(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 0, 2*len(units))
+	for _, unit := range units {
+		b = binary.LittleEndian.AppendUint16(b, unit)
+	}
+	return b
+}
+
+// filetime converts a Unix time to a FILETIME
+func filetime(unix uint32) uint64 {
+	return (uint64(unix) + 11644473600) * 10000000
+}
@@ -0,0 +1,360 @@
+// Package boot builds a timeline of the startups and shutdowns of a computer from
+// the System log and the Diagnostics-Performance channel, flags shutdowns that
+// weren't clean, such as power losses, resets and crashes, and measures how long
+// boots and shutdowns take
+package boot
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// DetectionName marks the events of unexpected shutdowns in the events' Detections
+const DetectionName = "unexpected-shutdown"
+
+// Kinds of timeline entries
+const (
+	KindStartup      = "startup"              // 6005: the event log service started, early in every boot
+	KindShutdown     = "shutdown"             // 6006: the event log service stopped, late in every clean shutdown
+	KindInitiated    = "initiated"            // 1074: a process or user asked for a shutdown or restart
+	KindUnexpected   = "unexpected"           // 6008 or Kernel-Power 41: the previous shutdown wasn't clean
+	KindBootTime     = "boot-performance"     // Diagnostics-Performance 100
+	KindShutdownTime = "shutdown-performance" // Diagnostics-Performance 200
+	KindDegradation  = "degradation"          // Diagnostics-Performance 101-110 and 201-210: a component slowed a boot or shutdown
+)
+
+const (
+	systemChannel      = "System"
+	performanceChannel = "Microsoft-Windows-Diagnostics-Performance/Operational"
+)
+
+// mergeWindow bounds the time between the 6008 and Kernel-Power 41 events that
+// report the same unexpected shutdown; both are logged early in the next boot
+const mergeWindow = 5 * time.Minute
+
+// Entry is a startup, shutdown or measurement of the timeline
+type Entry struct {
+	Time     time.Time     `json:"time"`
+	Host     string        `json:"host"`
+	Kind     string        `json:"kind"`
+	EventIDs []uint32      `json:"event_ids"`
+	Detail   string        `json:"detail,omitempty"`   // Cause of an unexpected shutdown, who initiated one, or the slow component
+	Duration time.Duration `json:"duration,omitempty"` // Boot, shutdown or degradation time
+	Degraded bool          `json:"degraded,omitempty"` // Windows rated the boot or shutdown slower than usual
+}
+
+// Unexpected reports whether the entry is a shutdown that wasn't clean
+func (e Entry) Unexpected() bool {
+	return e.Kind == KindUnexpected
+}
+
+// HostStats sums up the timeline of a computer
+type HostStats struct {
+	Host            string        `json:"host"`
+	Startups        int           `json:"startups"`
+	Unexpected      int           `json:"unexpected"` // Unexpected shutdowns, each counted once
+	Boots           int           `json:"boots"`      // Boots measured by Diagnostics-Performance
+	AverageBoot     time.Duration `json:"average_boot,omitempty"`
+	LongestBoot     time.Duration `json:"longest_boot,omitempty"`
+	DegradedBoots   int           `json:"degraded_boots,omitempty"`
+	AverageShutdown time.Duration `json:"average_shutdown,omitempty"`
+}
+
+// Timeline collects the startup and shutdown events of a collection
+type Timeline struct {
+	entries []Entry
+}
+
+// NewTimeline returns an empty timeline
+func NewTimeline() *Timeline {
+	return &Timeline{}
+}
+
+// Add records the startup, shutdown and boot performance events among events
+// and marks unexpected shutdowns with DetectionName
+func (t *Timeline) Add(events []eventlog.EventLogData) {
+	if t == nil {
+		return
+	}
+	for i := range events {
+		entry, ok := parseEvent(events[i])
+		if !ok {
+			continue
+		}
+		t.entries = append(t.entries, entry)
+		if entry.Unexpected() {
+			events[i].Detections = append(events[i].Detections, DetectionName)
+		}
+	}
+}
+
+// parseEvent returns the timeline entry of an event, if it is one
+func parseEvent(event eventlog.EventLogData) (Entry, bool) {
+	entry := Entry{
+		Time:     eventlog.EventTime(event.TimeGenerated),
+		Host:     event.ComputerName,
+		EventIDs: []uint32{event.EventID},
+	}
+	switch {
+	case strings.EqualFold(event.Channel, systemChannel):
+		return parseSystemEvent(event, entry)
+	case strings.EqualFold(event.Channel, performanceChannel):
+		return parsePerformanceEvent(event, entry)
+	}
+	return entry, false
+}
+
+// parseSystemEvent handles the event log service and shutdown events of the
+// System log, told apart from other events of the same IDs by their source
+func parseSystemEvent(event eventlog.EventLogData, entry Entry) (Entry, bool) {
+	source := strings.ToLower(event.SourceName)
+	switch {
+	case event.EventID == 6005 && source == "eventlog":
+		entry.Kind = KindStartup
+	case event.EventID == 6006 && source == "eventlog":
+		entry.Kind = KindShutdown
+	case event.EventID == 6008 && source == "eventlog":
+		// The time of the lost shutdown is written in the computer's locale
+		entry.Kind = KindUnexpected
+		if len(event.Strings) >= 2 {
+			entry.Detail = "previous shutdown at " + cleanText(event.Strings[1]+" "+event.Strings[0])
+		}
+	case event.EventID == 41 && source == "microsoft-windows-kernel-power":
+		entry.Kind = KindUnexpected
+		entry.Detail = powerLossCause(eventlog.NamedData(event.Channel, event))
+	case event.EventID == 1074 && source == "user32":
+		// The insertion strings are unnamed: process, computer, reason, reason
+		// code, shutdown type, comment and user
+		entry.Kind = KindInitiated
+		entry.Detail = initiatedBy(event.Strings)
+	default:
+		return entry, false
+	}
+	return entry, true
+}
+
+// powerLossCause explains a Kernel-Power 41 event: a bug check, a held power
+// button, or else a power loss or reset nothing logged
+func powerLossCause(data map[string]string) string {
+	var cause string
+	switch {
+	case parseUint(data["BugcheckCode"]) != 0:
+		cause = fmt.Sprintf("crash with bug check 0x%X", parseUint(data["BugcheckCode"]))
+	case parseUint(data["PowerButtonTimestamp"]) != 0 || strings.EqualFold(data["LongPowerButtonPressDetected"], "true"):
+		cause = "power button held"
+	default:
+		cause = "power lost or hard reset"
+	}
+	if parseUint(data["SleepInProgress"]) != 0 {
+		cause += " while entering sleep"
+	}
+	return cause
+}
+
+// initiatedBy describes who asked for a shutdown from the strings of a 1074 event
+func initiatedBy(values []string) string {
+	value := func(i int) string {
+		if i < len(values) {
+			return strings.TrimSpace(values[i])
+		}
+		return ""
+	}
+	detail := value(4)
+	if detail == "" {
+		detail = "shutdown"
+	}
+	if process := value(0); process != "" {
+		detail += " by " + process
+	}
+	if user := value(6); user != "" {
+		detail += " (" + user + ")"
+	}
+	if reason := value(2); reason != "" {
+		detail += ": " + reason
+	}
+	if comment := value(5); comment != "" {
+		detail += ", " + comment
+	}
+	return detail
+}
+
+// parsePerformanceEvent handles the boot and shutdown measurements and the
+// degradation events of the Diagnostics-Performance channel
+func parsePerformanceEvent(event eventlog.EventLogData, entry Entry) (Entry, bool) {
+	data := eventlog.NamedData(event.Channel, event)
+	switch {
+	case event.EventID == 100:
+		entry.Kind = KindBootTime
+		entry.Duration = milliseconds(data["BootTime"])
+		entry.Degraded = data["BootIsDegradation"] == "true" || data["BootIsDegradation"] == "1"
+		if start, err := time.Parse(time.RFC3339Nano, data["BootStartTime"]); err == nil {
+			entry.Time = start.UTC()
+		}
+		if postBoot := milliseconds(data["BootPostBootTime"]); postBoot > 0 {
+			entry.Detail = fmt.Sprintf("%s until the desktop was idle", postBoot.Round(time.Millisecond))
+		}
+	case event.EventID == 200:
+		entry.Kind = KindShutdownTime
+		entry.Duration = milliseconds(data["ShutdownTime"])
+		if start, err := time.Parse(time.RFC3339Nano, data["ShutdownStartTime"]); err == nil {
+			entry.Time = start.UTC()
+		}
+	case event.EventID > 100 && event.EventID <= 110, event.EventID > 200 && event.EventID <= 210:
+		entry.Kind = KindDegradation
+		entry.Duration = milliseconds(data["DegradationTime"])
+		phase := "boot"
+		if event.EventID > 200 {
+			phase = "shutdown"
+		}
+		component := data["FriendlyName"]
+		if name := data["Name"]; name != "" && component != "" && !strings.EqualFold(name, component) {
+			component += " (" + name + ")"
+		} else if component == "" {
+			component = name
+		}
+		if component == "" {
+			component = "unknown component"
+		}
+		entry.Detail = fmt.Sprintf("%s slowed the %s", component, phase)
+	default:
+		return entry, false
+	}
+	return entry, true
+}
+
+// Len returns the number of recorded entries
+func (t *Timeline) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.entries)
+}
+
+// Entries returns the timeline in time order. The 6008 and Kernel-Power 41 events
+// of the same unexpected shutdown become one entry.
+func (t *Timeline) Entries() []Entry {
+	if t == nil {
+		return nil
+	}
+	list := append([]Entry(nil), t.entries...)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Time.Before(list[j].Time)
+	})
+
+	merged := list[:0]
+	last := map[string]int{} // Host to the index of its last unexpected shutdown in merged
+	for _, entry := range list {
+		if entry.Unexpected() {
+			if i, ok := last[strings.ToLower(entry.Host)]; ok && entry.Time.Sub(merged[i].Time) <= mergeWindow && !sameEvents(merged[i].EventIDs, entry.EventIDs) {
+				merged[i].EventIDs = append(append([]uint32(nil), merged[i].EventIDs...), entry.EventIDs...)
+				merged[i].Detail = joinDetails(merged[i].Detail, entry.Detail)
+				delete(last, strings.ToLower(entry.Host))
+				continue
+			}
+			last[strings.ToLower(entry.Host)] = len(merged)
+		}
+		merged = append(merged, entry)
+	}
+	return merged
+}
+
+// Stats sums up the timeline per computer, in host order
+func (t *Timeline) Stats() []HostStats {
+	type totals struct {
+		stats     HostStats
+		boot      time.Duration
+		shutdown  time.Duration
+		shutdowns int
+	}
+	byHost := map[string]*totals{}
+	for _, entry := range t.Entries() {
+		key := strings.ToLower(entry.Host)
+		host, ok := byHost[key]
+		if !ok {
+			host = &totals{stats: HostStats{Host: entry.Host}}
+			byHost[key] = host
+		}
+		switch entry.Kind {
+		case KindStartup:
+			host.stats.Startups++
+		case KindUnexpected:
+			host.stats.Unexpected++
+		case KindBootTime:
+			host.stats.Boots++
+			host.boot += entry.Duration
+			if entry.Duration > host.stats.LongestBoot {
+				host.stats.LongestBoot = entry.Duration
+			}
+			if entry.Degraded {
+				host.stats.DegradedBoots++
+			}
+		case KindShutdownTime:
+			host.shutdowns++
+			host.shutdown += entry.Duration
+		}
+	}
+
+	list := make([]HostStats, 0, len(byHost))
+	for _, host := range byHost {
+		if host.stats.Boots > 0 {
+			host.stats.AverageBoot = host.boot / time.Duration(host.stats.Boots)
+		}
+		if host.shutdowns > 0 {
+			host.stats.AverageShutdown = host.shutdown / time.Duration(host.shutdowns)
+		}
+		list = append(list, host.stats)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return strings.ToLower(list[i].Host) < strings.ToLower(list[j].Host)
+	})
+	return list
+}
+
+// sameEvents reports whether two entries come from the same event IDs, such as
+// two 6008 events of different shutdowns
+func sameEvents(a, b []uint32) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// joinDetails joins the details of merged entries, skipping empty ones
+func joinDetails(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	}
+	return a + "; " + b
+}
+
+// milliseconds parses a duration the Diagnostics-Performance events log in ms
+func milliseconds(value string) time.Duration {
+	return time.Duration(parseUint(value)) * time.Millisecond
+}
+
+// parseUint parses a decimal or 0x hex number, 0 when it doesn't parse
+func parseUint(value string) uint64 {
+	n, err := strconv.ParseUint(strings.TrimSpace(value), 0, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// cleanText drops the left-to-right and right-to-left marks Windows puts around
+// the dates of 6008 events
+func cleanText(value string) string {
+	return strings.TrimSpace(strings.NewReplacer("\u200e", "", "\u200f", "").Replace(value))
+}
@@ -0,0 +1,205 @@
+// Package cache keeps the events of earlier one-shot reads so repeated runs over
+// overlapping windows, common during an investigation, only read the records
+// logged since the previous run
+package cache
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Entry describes the cached read of one channel
+type Entry struct {
+	Host        string    `json:"host"`
+	Channel     string    `json:"channel"`
+	EventIDs    []uint32  `json:"event_ids,omitempty"`
+	Since       time.Time `json:"since"`        // Start of the cached window (zero = whole log)
+	LastRecord  uint32    `json:"last_record"`  // Highest record number examined by the read
+	ProbeRecord uint32    `json:"probe_record"` // Record number of the newest cached event
+	ProbeTime   uint32    `json:"probe_time"`   // Its generation time, compared with the log on reuse
+	Events      int       `json:"events"`
+	Checksum    string    `json:"checksum"` // SHA-256 of the events file
+	Saved       time.Time `json:"saved"`
+}
+
+// Covers reports whether the entry holds every event of a window starting at since
+func (e *Entry) Covers(since time.Time) bool {
+	return e.Since.IsZero() || (!since.IsZero() && !since.Before(e.Since))
+}
+
+// Valid reports whether the log still holds the records the entry was read from: a
+// log that was cleared holds fewer records than were read, and one that was cleared
+// and refilled has a different event under the probed record number
+func (e *Entry) Valid(state eventlog.LogState) bool {
+	if state.Newest() < e.LastRecord {
+		return false
+	}
+	if e.ProbeRecord >= state.Oldest && state.RecordTime != e.ProbeTime {
+		return false
+	}
+	return true
+}
+
+// Cache is a directory of cached reads: an entry file (<key>.json) and a gzip
+// JSONL events file (<key>.jsonl.gz) per host, channel and event ID list
+type Cache struct {
+	dir string
+}
+
+// Open opens (creating if needed) the cache in dir
+func Open(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory %s: %v", dir, err)
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// key names the files of a host's channel read with the given event IDs
+func key(host, channel string, eventIDs []uint32) string {
+	ids := slices.Clone(eventIDs)
+	slices.Sort(ids)
+	parts := []string{strings.ToLower(host), strings.ToLower(channel)}
+	for _, id := range ids {
+		parts = append(parts, strconv.FormatUint(uint64(id), 10))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Load returns the cached entry and events of a channel when they cover a window
+// starting at since, and a nil entry when there is no usable cache. An events file
+// that no longer matches its checksum is discarded.
+func (c *Cache) Load(host, channel string, eventIDs []uint32, since time.Time) (*Entry, []eventlog.EventLogData, error) {
+	name := key(host, channel, eventIDs)
+	data, err := os.ReadFile(filepath.Join(c.dir, name+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read cache entry: %v", err)
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		c.remove(name)
+		return nil, nil, fmt.Errorf("discarded corrupt cache entry of %s: %v", channel, err)
+	}
+	if !entry.Covers(since) {
+		return nil, nil, nil
+	}
+
+	file, err := os.Open(filepath.Join(c.dir, name+".jsonl.gz"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open cached events: %v", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	gz, err := gzip.NewReader(bufio.NewReader(io.TeeReader(file, hash)))
+	if err != nil {
+		c.remove(name)
+		return nil, nil, fmt.Errorf("discarded corrupt cached events of %s: %v", channel, err)
+	}
+	var events []eventlog.EventLogData
+	dec := json.NewDecoder(gz)
+	for {
+		var event eventlog.EventLogData
+		if err := dec.Decode(&event); err == io.EOF {
+			break
+		} else if err != nil {
+			c.remove(name)
+			return nil, nil, fmt.Errorf("discarded corrupt cached events of %s: %v", channel, err)
+		}
+		events = append(events, event)
+	}
+	// Hash whatever the decoder didn't need, such as the gzip trailer
+	io.Copy(io.Discard, gz)
+	io.Copy(hash, file)
+	if hex.EncodeToString(hash.Sum(nil)) != entry.Checksum || len(events) != entry.Events {
+		c.remove(name)
+		return nil, nil, fmt.Errorf("discarded cached events of %s: checksum mismatch", channel)
+	}
+
+	return &entry, events, nil
+}
+
+// Save replaces the cached read of a channel. lastRecord is the highest record
+// number the read examined.
+func (c *Cache) Save(host, channel string, eventIDs []uint32, since time.Time, lastRecord uint32, events []eventlog.EventLogData) error {
+	name := key(host, channel, eventIDs)
+	entry := Entry{
+		Host:       host,
+		Channel:    channel,
+		EventIDs:   eventIDs,
+		Since:      since,
+		LastRecord: lastRecord,
+		Events:     len(events),
+		Saved:      time.Now(),
+	}
+	if len(events) > 0 {
+		newest := events[len(events)-1]
+		entry.ProbeRecord = newest.RecordNumber
+		entry.ProbeTime = newest.TimeGenerated
+	}
+
+	// Write the events first; the entry is only replaced once they are complete
+	tmp, err := os.CreateTemp(c.dir, name+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	buf := bufio.NewWriter(io.MultiWriter(tmp, hash))
+	gz := gzip.NewWriter(buf)
+	enc := json.NewEncoder(gz)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write cached events: %v", err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cached events: %v", err)
+	}
+	if err := buf.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cached events: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cached events: %v", err)
+	}
+	entry.Checksum = hex.EncodeToString(hash.Sum(nil))
+
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, name+".jsonl.gz")); err != nil {
+		return fmt.Errorf("failed to save cached events: %v", err)
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(c.dir, name+".json"), data, 0600); err != nil {
+		return fmt.Errorf("failed to save cache entry: %v", err)
+	}
+	return nil
+}
+
+// remove deletes the files of a cached read
+func (c *Cache) remove(name string) {
+	os.Remove(filepath.Join(c.dir, name+".json"))
+	os.Remove(filepath.Join(c.dir, name+".jsonl.gz"))
+}
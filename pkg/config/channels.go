@@ -1,34 +1,38 @@
 package config
 
+import "time"
+
 // ChannelConfig defines the configuration for an event log channel
 type ChannelConfig struct {
 	Name      string
 	Purpose   string
 	EventIDs  []uint32
-	Available bool // Whether this channel is expected to be available on most systems
+	Available bool          // Whether this channel is expected to be available on most systems
+	Timeout   time.Duration // Longest a read of the channel may take (0 = the collector's default)
 }
 
 // GetChannelConfigs returns configuration for all monitored event log channels
 func GetChannelConfigs() []ChannelConfig {
 	return []ChannelConfig{
 		{
-			Name:      "Security",
-			Purpose:   "User logins, privilege escalation",
-			EventIDs:  []uint32{4624, 4625, 4672, 4688, 4720, 4768},
+			Name:    "Security",
+			Purpose: "User logins, privilege escalation, account lockouts, group and policy changes, certificate requests",
+			EventIDs: []uint32{4624, 4625, 4648, 4657, 4672, 4688, 4698, 4699, 4719, 4720, 4728, 4729, 4732, 4733, 4740,
+				4756, 4757, 4765, 4766, 4767, 4768, 4886, 4887, 4899, 4900, 5152, 5157},
 			Available: true,
 		},
 		{
 			Name:    "System",
-			Purpose: "System changes, service failures",
-			EventIDs: []uint32{6005, 6006, 7000, 7001, 7002, 7003, 7004, 7005, 7006, 7007, 7008, 7009, 7010,
-				7011, 7012, 7013, 7014, 7015, 7016, 7017, 7018, 7019, 7020, 7021, 7022, 7023,
+			Purpose: "System changes, service failures, startups and unexpected shutdowns",
+			EventIDs: []uint32{41, 1074, 6005, 6006, 6008, 7000, 7001, 7002, 7003, 7004, 7005, 7006, 7007, 7008,
+				7009, 7010, 7011, 7012, 7013, 7014, 7015, 7016, 7017, 7018, 7019, 7020, 7021, 7022, 7023,
 				7045, 1102},
 			Available: true,
 		},
 		{
 			Name:      "Application",
-			Purpose:   "App crashes, service failures",
-			EventIDs:  []uint32{1000, 7034, 5000},
+			Purpose:   "App crashes, service failures, VPN connections",
+			EventIDs:  []uint32{1000, 7034, 5000, 20225, 20226, 20227},
 			Available: true,
 		},
 		{
@@ -46,9 +50,15 @@ func GetChannelConfigs() []ChannelConfig {
 		{
 			Name:      "Microsoft-Windows-Sysmon/Operational",
 			Purpose:   "Process and network monitoring",
-			EventIDs:  []uint32{1, 3, 7, 11, 13},
+			EventIDs:  []uint32{1, 3, 7, 11, 13, 22},
 			Available: false, // Sysmon is not installed by default
 		},
+		{
+			Name:      "Microsoft-Windows-DNS-Client/Operational",
+			Purpose:   "DNS queries (domain lookups)",
+			EventIDs:  []uint32{3008},
+			Available: false, // The channel is disabled by default
+		},
 		{
 			Name:      "Microsoft-Windows-TerminalServices-LocalSessionManager/Operational",
 			Purpose:   "RDP connections",
@@ -67,6 +77,25 @@ func GetChannelConfigs() []ChannelConfig {
 			EventIDs:  []uint32{1502, 1503},
 			Available: true,
 		},
+		{
+			Name:      "Microsoft-Windows-WLAN-AutoConfig/Operational",
+			Purpose:   "Wireless network connections",
+			EventIDs:  []uint32{8001, 8002, 8003},
+			Available: false, // Only present where the WLAN AutoConfig service is installed
+		},
+		{
+			Name:      "Microsoft-Windows-Partition/Diagnostic",
+			Purpose:   "Removable disk arrivals and removals",
+			EventIDs:  []uint32{1006},
+			Available: true,
+		},
+		{
+			Name:    "Microsoft-Windows-Diagnostics-Performance/Operational",
+			Purpose: "Boot and shutdown times, components that slowed them",
+			EventIDs: []uint32{100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 110,
+				200, 201, 202, 203, 204, 205, 206, 207, 208, 209, 210},
+			Available: true,
+		},
 		{
 			Name:      "Microsoft-Windows-Windows Firewall With Advanced Security/Firewall",
 			Purpose:   "Network connections, rule changes",
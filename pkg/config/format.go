@@ -0,0 +1,170 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of channels files
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+	FormatTOML = "toml"
+)
+
+// ValidFormat reports whether format is a supported channels file format
+func ValidFormat(format string) bool {
+	return format == FormatYAML || format == FormatJSON || format == FormatTOML
+}
+
+// DetectFormat returns the format of a channels file from its extension: .json is
+// JSON, .toml is TOML and .yaml or .yml is YAML. Files with another extension are
+// recognized by their content, and read as YAML when nothing else matches.
+func DetectFormat(path string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+	for _, line := range strings.Split(string(bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "{"):
+			return FormatJSON
+		case strings.HasPrefix(line, "[[") || strings.Contains(line, "=") && !strings.Contains(line, ":"):
+			return FormatTOML
+		}
+		break
+	}
+	return FormatYAML
+}
+
+// decodeChannels parses the content of a channels file in a format
+func decodeChannels(data []byte, format string) (channelsFile, error) {
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+	switch format {
+	case FormatJSON:
+		var file channelsFile
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(&file)
+		return file, err
+	case FormatTOML:
+		return parseChannelsTOML(data)
+	}
+	return parseChannelsYAML(data)
+}
+
+// EncodeChannels writes channels as a channels file in a format, so that
+// LoadChannelConfigs reads them back unchanged
+func EncodeChannels(channels []ChannelConfig, format string) ([]byte, error) {
+	var b bytes.Buffer
+	switch format {
+	case FormatJSON:
+		file := channelsFile{Channels: make([]fileChannel, 0, len(channels))}
+		for _, channel := range channels {
+			fc := fileChannel{Name: channel.Name, Purpose: channel.Purpose, EventIDs: channel.EventIDs, Timeout: formatTimeout(channel.Timeout)}
+			if !channel.Available {
+				available := false
+				fc.Available = &available
+			}
+			file.Channels = append(file.Channels, fc)
+		}
+		data, err := json.MarshalIndent(file, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode channels: %v", err)
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	case FormatTOML:
+		for i, channel := range channels {
+			if i > 0 {
+				b.WriteByte('\n')
+			}
+			b.WriteString("[[channels]]\n")
+			fmt.Fprintf(&b, "name = %s\n", tomlString(channel.Name))
+			if channel.Purpose != "" {
+				fmt.Fprintf(&b, "purpose = %s\n", tomlString(channel.Purpose))
+			}
+			if len(channel.EventIDs) > 0 {
+				fmt.Fprintf(&b, "event_ids = [%s]\n", joinEventIDs(channel.EventIDs))
+			}
+			if !channel.Available {
+				b.WriteString("available = false\n")
+			}
+			if channel.Timeout > 0 {
+				fmt.Fprintf(&b, "timeout = %s\n", tomlString(formatTimeout(channel.Timeout)))
+			}
+		}
+	case FormatYAML:
+		b.WriteString("channels:\n")
+		for _, channel := range channels {
+			fmt.Fprintf(&b, "  - name: %s\n", yamlString(channel.Name))
+			if channel.Purpose != "" {
+				fmt.Fprintf(&b, "    purpose: %s\n", yamlString(channel.Purpose))
+			}
+			if len(channel.EventIDs) > 0 {
+				fmt.Fprintf(&b, "    event_ids: [%s]\n", joinEventIDs(channel.EventIDs))
+			}
+			if !channel.Available {
+				b.WriteString("    available: false\n")
+			}
+			if channel.Timeout > 0 {
+				fmt.Fprintf(&b, "    timeout: %s\n", formatTimeout(channel.Timeout))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q (expected yaml, json or toml)", format)
+	}
+	return b.Bytes(), nil
+}
+
+// joinEventIDs renders event IDs as the items of a flow list
+func joinEventIDs(ids []uint32) string {
+	items := make([]string, len(ids))
+	for i, id := range ids {
+		items[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(items, ", ")
+}
+
+// formatTimeout renders a channel timeout without the zero units Duration.String
+// adds, e.g. 2m instead of 2m0s; empty when unset
+func formatTimeout(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// yamlString renders a scalar for the YAML layout of parseChannelsYAML, quoting
+// it when it could be mistaken for a comment, a list, a quoted string or another
+// type
+func yamlString(s string) string {
+	switch s {
+	case "null", "Null", "NULL", "~":
+		return strconv.Quote(s)
+	}
+	if s == "" || strings.TrimSpace(s) != s || strings.Contains(s, " #") || strings.ContainsAny(s, "\n\t\"") ||
+		strings.ContainsAny(s[:1], "-[]{}!&*#?|>@`'\",%:") {
+		return strconv.Quote(s)
+	}
+	return s
+}
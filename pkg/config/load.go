@@ -0,0 +1,194 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/internal/yaml"
+)
+
+// fileChannel is a channel as written in a channels file
+type fileChannel struct {
+	Name      string   `json:"name"`
+	Purpose   string   `json:"purpose,omitempty"`
+	EventIDs  []uint32 `json:"event_ids,omitempty"`
+	Available *bool    `json:"available,omitempty"` // Defaults to true
+	Timeout   string   `json:"timeout,omitempty"`   // Go duration, e.g. 2m
+}
+
+// channelsFile is the layout of a channels file
+type channelsFile struct {
+	Channels []fileChannel `json:"channels"`
+}
+
+// LoadChannelConfigs returns the channels to monitor: those of the file at path,
+// or the built-in list of GetChannelConfigs when path is empty. The format is
+// chosen by DetectFormat: JSON, TOML (see parseChannelsTOML) or YAML, for example
+//
+//	channels:
+//	  - name: Security
+//	    purpose: User logins
+//	    event_ids: [4624, 4625]
+//	  - name: Microsoft-Windows-WLAN-AutoConfig/Operational
+//	    purpose: Wireless network connections
+//	    event_ids:
+//	      - 8001
+//	    available: false
+//	    timeout: 2m
+//
+// Only this layout of YAML is understood: a channels list of mappings with scalar
+// values, and event IDs as a [flow] or block list. A channel without event IDs
+// collects every event.
+func LoadChannelConfigs(path string) ([]ChannelConfig, error) {
+	if path == "" {
+		return GetChannelConfigs(), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read channels file %s: %v", path, err)
+	}
+
+	format := DetectFormat(path, data)
+	file, err := decodeChannels(data, format)
+	if err != nil {
+		// TOML and YAML syntax errors start with the line number
+		var syntax *yaml.Error
+		if format == FormatJSON || format == FormatYAML && !errors.As(err, &syntax) {
+			return nil, fmt.Errorf("failed to parse channels file %s: %v", path, err)
+		}
+		return nil, fmt.Errorf("%s:%v", path, err)
+	}
+
+	channels := make([]ChannelConfig, 0, len(file.Channels))
+	seen := make(map[string]bool)
+	for i, channel := range file.Channels {
+		if channel.Name == "" {
+			return nil, fmt.Errorf("channel %d in %s has no name", i+1, path)
+		}
+		if seen[strings.ToLower(channel.Name)] {
+			return nil, fmt.Errorf("channel %s is listed twice in %s", channel.Name, path)
+		}
+		seen[strings.ToLower(channel.Name)] = true
+		var timeout time.Duration
+		if channel.Timeout != "" {
+			if timeout, err = time.ParseDuration(channel.Timeout); err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("invalid timeout %q of channel %s in %s", channel.Timeout, channel.Name, path)
+			}
+		}
+		channels = append(channels, ChannelConfig{
+			Name:      channel.Name,
+			Purpose:   channel.Purpose,
+			EventIDs:  channel.EventIDs,
+			Available: channel.Available == nil || *channel.Available,
+			Timeout:   timeout,
+		})
+	}
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("no channels in %s", path)
+	}
+	return channels, nil
+}
+
+// parseChannelsYAML reads the YAML layout described at LoadChannelConfigs.
+// Syntax errors are of type *yaml.Error and start with the line number.
+func parseChannelsYAML(data []byte) (channelsFile, error) {
+	var file channelsFile
+	documents, err := yaml.Parse(string(data))
+	if err != nil {
+		return file, err
+	}
+	if len(documents) != 1 {
+		return file, fmt.Errorf("expected one document, found %d", len(documents))
+	}
+	root, ok := documents[0].(map[string]any)
+	if !ok {
+		return file, fmt.Errorf("expected \"channels:\"")
+	}
+	for key := range root {
+		if key != "channels" {
+			return file, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	if root["channels"] == nil {
+		return file, nil
+	}
+	items, ok := root["channels"].([]any)
+	if !ok {
+		return file, fmt.Errorf("expected channels as a list")
+	}
+	for i, item := range items {
+		fields, ok := item.(map[string]any)
+		if !ok {
+			return file, fmt.Errorf("channel %d: expected a mapping", i+1)
+		}
+		channel, err := yamlChannel(fields)
+		if err != nil {
+			return file, fmt.Errorf("channel %d: %v", i+1, err)
+		}
+		file.Channels = append(file.Channels, channel)
+	}
+	return file, nil
+}
+
+// yamlChannel converts the mapping of one channel of a YAML channels file
+func yamlChannel(fields map[string]any) (fileChannel, error) {
+	var channel fileChannel
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // Report the same error on every run
+	for _, key := range keys {
+		value := fields[key]
+		if key == "event_ids" {
+			ids, ok := value.([]any)
+			if !ok {
+				return channel, fmt.Errorf("expected event_ids as [id, id] or a list")
+			}
+			for _, item := range ids {
+				s, _ := item.(string)
+				id, err := parseEventID(s)
+				if err != nil {
+					return channel, err
+				}
+				channel.EventIDs = append(channel.EventIDs, id)
+			}
+			continue
+		}
+		s, ok := value.(string)
+		if !ok && value != nil {
+			return channel, fmt.Errorf("expected a value for %s", key)
+		}
+		switch key {
+		case "name":
+			channel.Name = s
+		case "purpose":
+			channel.Purpose = s
+		case "timeout":
+			channel.Timeout = s
+		case "available":
+			available, err := strconv.ParseBool(s)
+			if err != nil {
+				return channel, fmt.Errorf("invalid available value %q", s)
+			}
+			channel.Available = &available
+		default:
+			return channel, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return channel, nil
+}
+
+// parseEventID parses one event ID of a channels file
+func parseEventID(s string) (uint32, error) {
+	id, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid event ID %q", strings.TrimSpace(s))
+	}
+	return uint32(id), nil
+}
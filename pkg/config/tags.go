@@ -0,0 +1,73 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Tags holds static labels (customer ID, site, environment) attached to every event and report.
+// It implements flag.Value so it can be filled from repeated -tag key=value flags.
+type Tags map[string]string
+
+// String returns the tags as a sorted, comma-separated key=value list
+func (t Tags) String() string {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + t[k]
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// Set parses a single key=value pair
+func (t Tags) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("invalid tag %q (expected key=value)", value)
+	}
+	t[key] = strings.TrimSpace(val)
+	return nil
+}
+
+// LoadTagsFile reads key=value lines from a file into t. Blank lines and lines
+// starting with # are ignored. Tags already set (e.g. from flags) take precedence.
+func (t Tags) LoadTagsFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open tags file %s: %v", path, err)
+	}
+	defer file.Close()
+
+	fileTags := Tags{}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fileTags.Set(line); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read tags file %s: %v", path, err)
+	}
+
+	for k, v := range fileTags {
+		if _, exists := t[k]; !exists {
+			t[k] = v
+		}
+	}
+	return nil
+}
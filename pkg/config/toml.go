@@ -0,0 +1,183 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseChannelsTOML reads a channels file written in TOML, one [[channels]] table
+// per channel:
+//
+//	[[channels]]
+//	name = "Security"
+//	purpose = "User logins"
+//	event_ids = [4624, 4625]
+//	available = false
+//	timeout = "2m"
+//
+// Only this layout is understood: [[channels]] tables of bare keys with string,
+// boolean and integer array values; arrays may span several lines. Errors start
+// with the line number.
+func parseChannelsTOML(data []byte) (channelsFile, error) {
+	var file channelsFile
+	var current *fileChannel
+	seen := map[string]bool{} // Keys of the current table
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		start := lineNumber
+		line := strings.TrimSpace(stripTOMLComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && !strings.Contains(line, "=") {
+			if line != "[[channels]]" {
+				return file, fmt.Errorf("%d: unexpected table %s, expected [[channels]]", start, line)
+			}
+			file.Channels = append(file.Channels, fileChannel{})
+			current = &file.Channels[len(file.Channels)-1]
+			seen = map[string]bool{}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return file, fmt.Errorf("%d: expected \"key = value\"", start)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if current == nil {
+			return file, fmt.Errorf("%d: key %q outside a [[channels]] table", start, key)
+		}
+		if seen[key] {
+			return file, fmt.Errorf("%d: duplicate key %q", start, key)
+		}
+		seen[key] = true
+
+		// An array continues on the following lines until its closing bracket
+		for strings.HasPrefix(value, "[") && !tomlArrayClosed(value) {
+			if !scanner.Scan() {
+				return file, fmt.Errorf("%d: unterminated array", start)
+			}
+			lineNumber++
+			value += " " + strings.TrimSpace(stripTOMLComment(scanner.Text()))
+		}
+
+		switch key {
+		case "name", "purpose", "timeout":
+			s, err := parseTOMLString(value)
+			if err != nil {
+				return file, fmt.Errorf("%d: %s: %v", start, key, err)
+			}
+			switch key {
+			case "name":
+				current.Name = s
+			case "purpose":
+				current.Purpose = s
+			default:
+				current.Timeout = s
+			}
+		case "available":
+			available, err := strconv.ParseBool(value)
+			if err != nil || (value != "true" && value != "false") {
+				return file, fmt.Errorf("%d: invalid available value %s", start, value)
+			}
+			current.Available = &available
+		case "event_ids":
+			list, ok := strings.CutPrefix(value, "[")
+			if list, ok = strings.CutSuffix(list, "]"); !ok {
+				return file, fmt.Errorf("%d: expected event_ids as [id, id]", start)
+			}
+			current.EventIDs = []uint32{}
+			for _, field := range strings.Split(list, ",") {
+				if field = strings.TrimSpace(field); field == "" {
+					continue
+				}
+				id, err := strconv.ParseUint(strings.ReplaceAll(field, "_", ""), 10, 32)
+				if err != nil {
+					return file, fmt.Errorf("%d: invalid event ID %q", start, field)
+				}
+				current.EventIDs = append(current.EventIDs, uint32(id))
+			}
+		default:
+			return file, fmt.Errorf("%d: unknown key %q", start, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return file, fmt.Errorf("%d: %v", lineNumber+1, err)
+	}
+	return file, nil
+}
+
+// stripTOMLComment removes a # comment outside strings
+func stripTOMLComment(line string) string {
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// tomlArrayClosed reports whether an array value has its closing bracket
+func tomlArrayClosed(value string) bool {
+	return strings.HasSuffix(value, "]")
+}
+
+// parseTOMLString parses a "basic" or 'literal' string
+func parseTOMLString(value string) (string, error) {
+	switch {
+	case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+		return value[1 : len(value)-1], nil
+	case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", value)
+		}
+		return s, nil
+	}
+	return "", fmt.Errorf("expected a quoted string, not %s", value)
+}
+
+// tomlString quotes a string as a TOML basic string
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r == 0x7F:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,263 @@
+// Package crashes indexes the crash evidence Windows keeps on disk, kernel
+// minidumps, live kernel reports and Windows Error Reporting archives, and links
+// it to the Application Error 1000 events of a collection
+package crashes
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/filesenum"
+)
+
+// Kinds of entries
+const (
+	KindMinidump   = "minidump"    // Kernel crash dump of a bug check
+	KindLiveKernel = "live-kernel" // Dump of a kernel failure Windows recovered from, such as a GPU timeout
+	KindWER        = "wer"         // Windows Error Reporting report of an application crash or hang
+)
+
+// Folders indexed on every computer; WER keeps reports not yet sent in the queue
+// and sent ones in the archive
+const (
+	minidumpFolder   = `C:\Windows\Minidump`
+	liveKernelFolder = `C:\Windows\LiveKernelReports`
+	werArchiveFolder = `C:\ProgramData\Microsoft\Windows\WER\ReportArchive`
+	werQueueFolder   = `C:\ProgramData\Microsoft\Windows\WER\ReportQueue`
+)
+
+// correlationWindow bounds the time between a crash event and its WER report when
+// they are matched by application name because the event carries no report ID
+const correlationWindow = 5 * time.Minute
+
+// rescanInterval is how long a computer's index is reused before a crash event
+// that matches nothing makes it scanned again, as in follow mode
+const rescanInterval = time.Minute
+
+// Entry is a crash dump or error report
+type Entry struct {
+	Host               string    `json:"host"`
+	Kind               string    `json:"kind"`
+	Path               string    `json:"path"` // Dump file or Report.wer, as a path on Host
+	Time               time.Time `json:"time"` // Event time of a report, modification time of a dump
+	Size               int64     `json:"size,omitempty"`
+	EventType          string    `json:"event_type,omitempty"` // WER event type, e.g. APPCRASH, BEX64 or LiveKernelEvent
+	Application        string    `json:"application,omitempty"`
+	AppPath            string    `json:"app_path,omitempty"`
+	AppVersion         string    `json:"app_version,omitempty"`
+	FaultModule        string    `json:"fault_module,omitempty"`
+	FaultModuleVersion string    `json:"fault_module_version,omitempty"`
+	ExceptionCode      string    `json:"exception_code,omitempty"`
+	ReportID           string    `json:"report_id,omitempty"`
+	IntegratorReportID string    `json:"integrator_report_id,omitempty"`
+	Record             uint32    `json:"record,omitempty"` // Application Error 1000 event of the crash, when collected
+}
+
+// hostIndex holds the entries of one computer
+type hostIndex struct {
+	entries []*Entry
+	scanned time.Time
+}
+
+// Index holds the crash evidence of the computers a collection reads
+type Index struct {
+	hosts map[string]*hostIndex
+}
+
+// NewIndex returns an empty index; computers are scanned by Scan or on their
+// first crash event
+func NewIndex() *Index {
+	return &Index{hosts: map[string]*hostIndex{}}
+}
+
+// Scan indexes the dumps and reports of a computer (empty = local), replacing
+// what was indexed for it before. Remote folders are read through the admin
+// share. Folders that can't be read are reported as warnings.
+func (x *Index) Scan(server string) {
+	if x == nil {
+		return
+	}
+	host := &hostIndex{scanned: time.Now()}
+	name := server
+	if name == "" {
+		name = eventlog.GetLocalComputerName()
+	}
+
+	for _, folder := range []struct {
+		path string
+		kind string
+	}{{minidumpFolder, KindMinidump}, {liveKernelFolder, KindLiveKernel}} {
+		walk(server, folder.path, func(path string, info fs.FileInfo) {
+			if strings.EqualFold(filepath.Ext(path), ".dmp") {
+				host.entries = append(host.entries, &Entry{Host: name, Kind: folder.kind, Path: path, Time: info.ModTime().UTC(), Size: info.Size()})
+			}
+		})
+	}
+	for _, folder := range []string{werArchiveFolder, werQueueFolder} {
+		walk(server, folder, func(path string, info fs.FileInfo) {
+			if !strings.EqualFold(filepath.Base(path), "Report.wer") {
+				return
+			}
+			data, err := os.ReadFile(filesenum.AdminSharePath(server, path))
+			if err != nil {
+				fmt.Printf("Warning: Could not read %s: %v\n", path, err)
+				return
+			}
+			entry := parseReport(data)
+			entry.Host, entry.Path, entry.Size = name, path, info.Size()
+			if entry.Time.IsZero() {
+				entry.Time = info.ModTime().UTC()
+			}
+			host.entries = append(host.entries, &entry)
+		})
+	}
+	x.hosts[strings.ToLower(server)] = host
+}
+
+// walk calls fn for the files below a folder of a computer with their paths as on
+// that computer; a missing folder is not an error
+func walk(server, folder string, fn func(path string, info fs.FileInfo)) {
+	root := filesenum.AdminSharePath(server, folder)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil // An unreadable report folder doesn't hide the others
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		fn(folder+strings.TrimPrefix(path, root), info)
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: Could not read %s: %v\n", folder, err)
+	}
+}
+
+// IsCrashEvent reports whether an event is an Application Error 1000 crash event
+func IsCrashEvent(event eventlog.EventLogData) bool {
+	return event.EventID == 1000 && strings.EqualFold(event.Channel, "Application") && strings.EqualFold(event.SourceName, "Application Error")
+}
+
+// Correlate links the Application Error 1000 events among events to the WER
+// reports of their computer, by report ID or else by application and time, and
+// sets their WERReport annotation to the report's path. A computer is scanned
+// on its first crash event, and again when an event matches nothing and the
+// index is more than a minute old.
+func (x *Index) Correlate(events []eventlog.EventLogData) {
+	if x == nil {
+		return
+	}
+	for i := range events {
+		if !IsCrashEvent(events[i]) {
+			continue
+		}
+		server := eventServer(events[i])
+		host, ok := x.hosts[strings.ToLower(server)]
+		if !ok {
+			x.Scan(server)
+			host = x.hosts[strings.ToLower(server)]
+		}
+		entry := host.match(events[i])
+		if entry == nil && time.Since(host.scanned) > rescanInterval {
+			x.Scan(server)
+			host = x.hosts[strings.ToLower(server)]
+			entry = host.match(events[i])
+		}
+		if entry == nil {
+			continue
+		}
+		entry.Record = events[i].RecordNumber
+		if events[i].Annotations == nil {
+			events[i].Annotations = map[string]string{}
+		}
+		events[i].Annotations["WERReport"] = entry.Path
+	}
+}
+
+// match returns the WER report of a crash event, or nil
+func (h *hostIndex) match(event eventlog.EventLogData) *Entry {
+	data := eventlog.NamedData(event.Channel, event)
+	if id := strings.Trim(data["IntegratorReportId"], "{}"); id != "" {
+		for _, entry := range h.entries {
+			if entry.Kind == KindWER && (strings.EqualFold(strings.Trim(entry.IntegratorReportID, "{}"), id) || strings.EqualFold(strings.Trim(entry.ReportID, "{}"), id)) {
+				return entry
+			}
+		}
+	}
+
+	// Reports of older systems, or events whose report ID is missing, are matched
+	// by application within the correlation window, closest first
+	application := data["AppName"]
+	if application == "" {
+		return nil
+	}
+	eventTime := eventlog.EventTime(event.TimeGenerated)
+	var best *Entry
+	for _, entry := range h.entries {
+		if entry.Kind != KindWER || entry.Record != 0 || !strings.EqualFold(entry.Application, application) {
+			continue
+		}
+		if gap := absDuration(entry.Time.Sub(eventTime)); gap <= correlationWindow && (best == nil || gap < absDuration(best.Time.Sub(eventTime))) {
+			best = entry
+		}
+	}
+	return best
+}
+
+// Len returns the number of entries indexed
+func (x *Index) Len() int {
+	if x == nil {
+		return 0
+	}
+	n := 0
+	for _, host := range x.hosts {
+		n += len(host.entries)
+	}
+	return n
+}
+
+// Entries returns the entries of every computer, newest first
+func (x *Index) Entries() []Entry {
+	if x == nil {
+		return nil
+	}
+	var list []Entry
+	for _, host := range x.hosts {
+		for _, entry := range host.entries {
+			list = append(list, *entry)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Time.After(list[j].Time)
+	})
+	return list
+}
+
+// eventServer returns the computer that logged an event ("" = local)
+func eventServer(event eventlog.EventLogData) string {
+	if event.Provenance != nil && event.Provenance.Remote {
+		return event.Provenance.Host
+	}
+	return ""
+}
+
+// absDuration returns the absolute value of d
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
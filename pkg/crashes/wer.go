@@ -0,0 +1,82 @@
+package crashes
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// werSignatures maps the Sig[n].Name of a Report.wer to the Entry field it fills
+var werSignatures = map[string]func(e *Entry, value string){
+	"Application Name":     func(e *Entry, value string) { e.Application = value },
+	"Application Version":  func(e *Entry, value string) { e.AppVersion = value },
+	"Fault Module Name":    func(e *Entry, value string) { e.FaultModule = value },
+	"Fault Module Version": func(e *Entry, value string) { e.FaultModuleVersion = value },
+	"Exception Code":       func(e *Entry, value string) { e.ExceptionCode = value },
+}
+
+// parseReport reads a Report.wer: UTF-16LE (or UTF-8) key=value lines, where the
+// problem signature is a list of Sig[n].Name and Sig[n].Value pairs
+func parseReport(data []byte) Entry {
+	entry := Entry{Kind: KindWER}
+	names := map[string]string{} // Sig[n] to its name
+	values := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(reportText(data)))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimRight(scanner.Text(), "\r"), "=")
+		if !ok {
+			continue
+		}
+		switch {
+		case key == "EventType":
+			entry.EventType = value
+		case key == "EventTime":
+			entry.Time = fileTime(value)
+		case key == "ReportIdentifier":
+			entry.ReportID = value
+		case key == "IntegratorReportIdentifier":
+			entry.IntegratorReportID = value
+		case key == "AppPath":
+			entry.AppPath = value
+		case strings.HasPrefix(key, "Sig[") && strings.HasSuffix(key, "].Name"):
+			names[strings.TrimSuffix(key, ".Name")] = value
+		case strings.HasPrefix(key, "Sig[") && strings.HasSuffix(key, "].Value"):
+			values[strings.TrimSuffix(key, ".Value")] = value
+		}
+	}
+	for sig, name := range names {
+		if set, ok := werSignatures[name]; ok {
+			set(&entry, values[sig])
+		}
+	}
+	return entry
+}
+
+// reportText converts a Report.wer to UTF-8; Windows writes them as UTF-16LE with
+// a byte order mark
+func reportText(data []byte) []byte {
+	if !bytes.HasPrefix(data, []byte{0xFF, 0xFE}) {
+		return bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+	}
+	data = data[2:]
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+	}
+	return []byte(string(utf16.Decode(units)))
+}
+
+// fileTime converts a FILETIME written in decimal, 100 ns intervals since 1601,
+// to a time in UTC; zero when it doesn't parse
+func fileTime(value string) time.Time {
+	ft, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || ft <= 116444736000000000 {
+		return time.Time{}
+	}
+	return time.Unix(0, (ft-116444736000000000)*100).UTC()
+}
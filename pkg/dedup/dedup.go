@@ -0,0 +1,90 @@
+package dedup
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Group is a set of identical events: the same channel, event ID, source and message
+type Group struct {
+	Channel  string    `json:"channel"`
+	EventID  uint32    `json:"event_id"`
+	Source   string    `json:"source"`
+	Message  string    `json:"message"` // The rendered message, or the insertion strings joined with " | "
+	Count    int       `json:"count"`
+	First    time.Time `json:"first"`
+	Last     time.Time `json:"last"`
+	FirstUID string    `json:"first_uid,omitempty"` // Stable ID of the earliest event, to look it up in the store
+}
+
+// key identifies a group
+type key struct {
+	channel string // Lowercase
+	eventID uint32
+	source  string
+	message string
+}
+
+// Table groups identical events so a noisy channel is reported as one line per
+// distinct event instead of thousands of repeated entries
+type Table struct {
+	groups map[key]*Group
+}
+
+// NewTable returns an empty table
+func NewTable() *Table {
+	return &Table{groups: make(map[key]*Group)}
+}
+
+// Add counts events into their groups
+func (t *Table) Add(events []eventlog.EventLogData) {
+	if t == nil {
+		return
+	}
+	for _, event := range events {
+		message := event.Message
+		if message == "" {
+			message = strings.Join(event.Strings, " | ")
+		}
+		k := key{strings.ToLower(event.Channel), event.EventID, event.SourceName, message}
+		at := eventlog.EventTime(event.TimeGenerated)
+		group, ok := t.groups[k]
+		if !ok {
+			group = &Group{Channel: event.Channel, EventID: event.EventID, Source: event.SourceName, Message: message, First: at, Last: at, FirstUID: event.UID}
+			t.groups[k] = group
+		}
+		group.Count++
+		if at.Before(group.First) {
+			group.First = at
+			group.FirstUID = event.UID
+		}
+		if at.After(group.Last) {
+			group.Last = at
+		}
+	}
+}
+
+// Take returns the groups of a channel, most frequent first, and removes them
+// from the table
+func (t *Table) Take(channel string) []Group {
+	if t == nil {
+		return nil
+	}
+	var list []Group
+	for k, group := range t.groups {
+		if k.channel == strings.ToLower(channel) {
+			list = append(list, *group)
+			delete(t.groups, k)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].First.Before(list[j].First)
+	})
+	return list
+}
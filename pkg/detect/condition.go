@@ -0,0 +1,185 @@
+package detect
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// condNode is a node of a parsed rule condition
+type condNode interface {
+	// eval evaluates the node, calling selected for the selections it needs
+	eval(selected func(name string) bool) bool
+}
+
+type (
+	andNode struct{ left, right condNode }
+	orNode  struct{ left, right condNode }
+	notNode struct{ operand condNode }
+	// selectionNode is a selection named in the condition
+	selectionNode struct{ name string }
+	// quantifierNode is "1 of pattern" or "all of pattern", with "them" expanded
+	// to every selection not starting with _
+	quantifierNode struct {
+		all   bool
+		names []string
+	}
+)
+
+func (n *andNode) eval(selected func(string) bool) bool {
+	return n.left.eval(selected) && n.right.eval(selected)
+}
+
+func (n *orNode) eval(selected func(string) bool) bool {
+	return n.left.eval(selected) || n.right.eval(selected)
+}
+
+func (n *notNode) eval(selected func(string) bool) bool {
+	return !n.operand.eval(selected)
+}
+
+func (n *selectionNode) eval(selected func(string) bool) bool {
+	return selected(n.name)
+}
+
+func (n *quantifierNode) eval(selected func(string) bool) bool {
+	for _, name := range n.names {
+		if selected(name) != n.all {
+			return !n.all
+		}
+	}
+	return n.all
+}
+
+// conditionParser is a recursive descent parser of Sigma conditions:
+//
+//	or         = and { "or" and }
+//	and        = not { "and" not }
+//	not        = "not" not | primary
+//	primary    = "(" or ")" | ("1" | "any" | "all") "of" (pattern | "them") | name
+//
+// Aggregations after a | (count() > 5 and the like) are not supported.
+type conditionParser struct {
+	tokens []string
+	pos    int
+	names  []string // Selections of the rule
+}
+
+// parseCondition parses the condition of a rule with the given selections
+func parseCondition(source string, names []string) (condNode, error) {
+	if strings.Contains(source, "|") {
+		return nil, fmt.Errorf("aggregations are not supported")
+	}
+	p := &conditionParser{tokens: tokenizeCondition(source), names: names}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return node, nil
+}
+
+// tokenizeCondition splits a condition into words and parentheses
+func tokenizeCondition(source string) []string {
+	source = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(source)
+	return strings.Fields(source)
+}
+
+// peek returns the current token in lowercase, or "" at the end
+func (p *conditionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return strings.ToLower(p.tokens[p.pos])
+	}
+	return ""
+}
+
+func (p *conditionParser) parseOr() (condNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peek() == "or" {
+		p.pos++
+		var right condNode
+		if right, err = p.parseAnd(); err == nil {
+			left = &orNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *conditionParser) parseAnd() (condNode, error) {
+	left, err := p.parseNot()
+	for err == nil && p.peek() == "and" {
+		p.pos++
+		var right condNode
+		if right, err = p.parseNot(); err == nil {
+			left = &andNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *conditionParser) parseNot() (condNode, error) {
+	if p.peek() == "not" {
+		p.pos++
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *conditionParser) parsePrimary() (condNode, error) {
+	token := p.peek()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end of condition")
+	case "(":
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return node, nil
+	case "1", "any", "all":
+		p.pos++
+		if p.peek() != "of" {
+			return nil, fmt.Errorf("expected \"of\" after %q", token)
+		}
+		p.pos++
+		pattern := p.peek()
+		if pattern == "" {
+			return nil, fmt.Errorf("expected a selection pattern after \"of\"")
+		}
+		pattern = p.tokens[p.pos]
+		p.pos++
+		var names []string
+		for _, name := range p.names {
+			them := strings.EqualFold(pattern, "them") && !strings.HasPrefix(name, "_")
+			if matched, _ := path.Match(pattern, name); matched || them {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("no selection matches %q", pattern)
+		}
+		return &quantifierNode{all: token == "all", names: names}, nil
+	case ")", "and", "or", "of":
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+
+	name := p.tokens[p.pos]
+	p.pos++
+	for _, known := range p.names {
+		if known == name {
+			return &selectionNode{name}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown selection %q", name)
+}
@@ -0,0 +1,78 @@
+package detect
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCondition(t *testing.T) {
+	names := []string{"_filter", "sel_a", "sel_b", "keywords"}
+	tests := []struct {
+		condition string
+		selected  string // Selections that match, comma-separated
+		want      bool
+	}{
+		{"sel_a", "sel_a", true},
+		{"sel_a", "sel_b", false},
+		{"sel_a and sel_b", "sel_a", false},
+		{"sel_a or sel_b", "sel_b", true},
+		{"sel_a and not _filter", "sel_a,_filter", false},
+		{"sel_a and not _filter", "sel_a", true},
+		{"not not sel_a", "sel_a", true},
+		// and binds tighter than or
+		{"sel_a or sel_b and keywords", "sel_a", true},
+		{"(sel_a or sel_b) and keywords", "sel_a", false},
+		{"1 of sel_*", "sel_b", true},
+		{"any of sel_*", "", false},
+		{"all of sel_*", "sel_a", false},
+		{"all of sel_*", "sel_a,sel_b", true},
+		{"ALL OF sel_* AND NOT _filter", "sel_a,sel_b", true},
+		// them leaves out selections starting with _
+		{"all of them", "sel_a,sel_b,keywords", true},
+		{"1 of them", "_filter", false},
+	}
+	for _, tt := range tests {
+		node, err := parseCondition(tt.condition, names)
+		if err != nil {
+			t.Errorf("parseCondition(%q): %v", tt.condition, err)
+			continue
+		}
+		selected := func(name string) bool {
+			for _, s := range strings.Split(tt.selected, ",") {
+				if s == name {
+					return true
+				}
+			}
+			return false
+		}
+		if got := node.eval(selected); got != tt.want {
+			t.Errorf("%q with %s = %v, want %v", tt.condition, tt.selected, got, tt.want)
+		}
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	names := []string{"sel", "filter"}
+	tests := []struct {
+		condition string
+		want      string
+	}{
+		{"", "unexpected end of condition"},
+		{"sel and", "unexpected end of condition"},
+		{"(sel", "missing )"},
+		{"sel)", `unexpected ")"`},
+		{"sel filter", `unexpected "filter"`},
+		{"and sel", `unexpected "and"`},
+		{"other", `unknown selection "other"`},
+		{"1 sel", `expected "of" after "1"`},
+		{"all of", `expected a selection pattern after "of"`},
+		{"1 of x*", `no selection matches "x*"`},
+		{"sel | count() > 5", "aggregations are not supported"},
+	}
+	for _, tt := range tests {
+		_, err := parseCondition(tt.condition, names)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("parseCondition(%q) = %v, want %q", tt.condition, err, tt.want)
+		}
+	}
+}
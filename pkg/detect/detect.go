@@ -0,0 +1,143 @@
+// Package detect evaluates Sigma rules against collected events
+package detect
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/internal/yaml"
+)
+
+// Engine holds the compiled Sigma rules of a run
+type Engine struct {
+	rules   []*Rule
+	skipped []string // "path: reason" of every rule that could not be used
+}
+
+// Load compiles the Sigma rules of a .yml or .yaml file, or of every such file
+// below a directory. Rules that use unsupported features (aggregations,
+// correlations, non-Windows log sources) are skipped and listed by Skipped rather
+// than failing the whole rule set.
+func Load(path string) (*Engine, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Sigma rules %s: %v", path, err)
+	}
+	var files []string
+	if info.IsDir() {
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			ext := strings.ToLower(filepath.Ext(file))
+			if !d.IsDir() && (ext == ".yml" || ext == ".yaml") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Sigma rules in %s: %v", path, err)
+		}
+	} else {
+		files = []string{path}
+	}
+
+	e := &Engine{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Sigma rule %s: %v", file, err)
+		}
+		documents, err := yaml.Parse(string(data))
+		if err != nil {
+			e.skipped = append(e.skipped, fmt.Sprintf("%s:%v", file, err))
+			continue
+		}
+		for _, doc := range documents {
+			rule, err := compileRule(doc, file)
+			if err != nil {
+				e.skipped = append(e.skipped, fmt.Sprintf("%s: %v", file, err))
+				continue
+			}
+			e.rules = append(e.rules, rule)
+		}
+	}
+	if len(e.rules) == 0 {
+		return nil, fmt.Errorf("no usable Sigma rules in %s (%d skipped)", path, len(e.skipped))
+	}
+	return e, nil
+}
+
+// Len returns the number of loaded rules
+func (e *Engine) Len() int {
+	if e == nil {
+		return 0
+	}
+	return len(e.rules)
+}
+
+// Rules returns the loaded rules
+func (e *Engine) Rules() []*Rule {
+	if e == nil {
+		return nil
+	}
+	return e.rules
+}
+
+// Skipped returns the rules that could not be used, with the reason
+func (e *Engine) Skipped() []string {
+	if e == nil {
+		return nil
+	}
+	return e.skipped
+}
+
+// Match returns the rules matching an event
+func (e *Engine) Match(event eventlog.EventLogData) []*Rule {
+	if e == nil {
+		return nil
+	}
+	var matched []*Rule
+	view := &eventView{event: event}
+	for _, rule := range e.rules {
+		if !rule.source.applies(event) {
+			continue
+		}
+		results := map[string]bool{}
+		selected := func(name string) bool {
+			result, ok := results[name]
+			if !ok {
+				result = rule.selections[name].match(view)
+				results[name] = result
+			}
+			return result
+		}
+		if rule.condition.eval(selected) {
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
+
+// Apply records the titles of the matching rules in each event's Detections field.
+// With only set, events no rule matched are dropped.
+func (e *Engine) Apply(logs []eventlog.EventLogData, only bool) []eventlog.EventLogData {
+	if e == nil {
+		return logs
+	}
+	kept := logs[:0:0]
+	for _, log := range logs {
+		rules := e.Match(log)
+		for _, rule := range rules {
+			log.Detections = append(log.Detections, rule.Title)
+		}
+		if len(rules) > 0 || !only {
+			kept = append(kept, log)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,138 @@
+package detect
+
+import (
+	"fmt"
+	"strings"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Channels the Sigma log sources are read from
+const (
+	sysmonChannel     = "Microsoft-Windows-Sysmon/Operational"
+	powershellChannel = "Microsoft-Windows-PowerShell/Operational"
+)
+
+// logSource is the set of events a rule applies to: channels, optionally narrowed
+// to event IDs per channel. An empty logSource applies to every event.
+type logSource struct {
+	channels map[string][]uint32 // Lowercase channel name to event IDs (nil = all)
+}
+
+// sigmaServices maps the Windows services of Sigma log sources to their channels
+var sigmaServices = map[string]string{
+	"security":                             "Security",
+	"system":                               "System",
+	"application":                          "Application",
+	"sysmon":                               sysmonChannel,
+	"powershell":                           powershellChannel,
+	"powershell-classic":                   "Windows PowerShell",
+	"taskscheduler":                        "Microsoft-Windows-TaskScheduler/Operational",
+	"wmi":                                  "Microsoft-Windows-WMI-Activity/Operational",
+	"windefend":                            "Microsoft-Windows-Windows Defender/Operational",
+	"dns-server":                           "DNS Server",
+	"dns-client":                           "Microsoft-Windows-DNS Client Events/Operational",
+	"bits-client":                          "Microsoft-Windows-Bits-Client/Operational",
+	"driver-framework":                     "Microsoft-Windows-DriverFrameworks-UserMode/Operational",
+	"firewall-as":                          "Microsoft-Windows-Windows Firewall With Advanced Security/Firewall",
+	"codeintegrity-operational":            "Microsoft-Windows-CodeIntegrity/Operational",
+	"ntlm":                                 "Microsoft-Windows-NTLM/Operational",
+	"terminalservices-localsessionmanager": "Microsoft-Windows-TerminalServices-LocalSessionManager/Operational",
+	"printservice-operational":             "Microsoft-Windows-PrintService/Operational",
+	"smbclient-security":                   "Microsoft-Windows-SmbClient/Security",
+	"openssh":                              "OpenSSH/Operational",
+	"msexchange-management":                "MSExchange Management",
+	"appxdeployment-server":                "Microsoft-Windows-AppXDeploymentServer/Operational",
+	"lsa-server":                           "Microsoft-Windows-LSA/Operational",
+}
+
+// sigmaCategories maps the categories of Sigma log sources to the channels and
+// event IDs that record them
+var sigmaCategories = map[string]map[string][]uint32{
+	"process_creation":     {sysmonChannel: {1}, "Security": {4688}},
+	"process_termination":  {sysmonChannel: {5}, "Security": {4689}},
+	"network_connection":   {sysmonChannel: {3}, "Security": {5156}},
+	"driver_load":          {sysmonChannel: {6}},
+	"image_load":           {sysmonChannel: {7}},
+	"create_remote_thread": {sysmonChannel: {8}},
+	"raw_access_thread":    {sysmonChannel: {9}},
+	"process_access":       {sysmonChannel: {10}},
+	"file_event":           {sysmonChannel: {11}},
+	"registry_add":         {sysmonChannel: {12}},
+	"registry_delete":      {sysmonChannel: {12}},
+	"registry_set":         {sysmonChannel: {13}},
+	"registry_rename":      {sysmonChannel: {14}},
+	"registry_event":       {sysmonChannel: {12, 13, 14}},
+	"create_stream_hash":   {sysmonChannel: {15}},
+	"pipe_created":         {sysmonChannel: {17, 18}},
+	"wmi_event":            {sysmonChannel: {19, 20, 21}},
+	"dns_query":            {sysmonChannel: {22}},
+	"file_delete":          {sysmonChannel: {23, 26}},
+	"clipboard_capture":    {sysmonChannel: {24}},
+	"process_tampering":    {sysmonChannel: {25}},
+	"file_block":           {sysmonChannel: {27, 28}},
+	"ps_script":            {powershellChannel: {4104}},
+	"ps_module":            {powershellChannel: {4103}},
+	"ps_classic_start":     {"Windows PowerShell": {400}},
+}
+
+// resolveLogSource maps the logsource section of a rule to channels. Rules for
+// other products, or for categories and services without a known channel, are
+// rejected since they could never match collected events.
+func resolveLogSource(m map[string]any) (logSource, error) {
+	product := strings.ToLower(stringValue(m["product"]))
+	category := strings.ToLower(stringValue(m["category"]))
+	service := strings.ToLower(stringValue(m["service"]))
+	if product != "" && product != "windows" {
+		return logSource{}, fmt.Errorf("product %s is not collected", product)
+	}
+
+	source := logSource{channels: map[string][]uint32{}}
+	switch {
+	case category != "":
+		channels, ok := sigmaCategories[category]
+		if !ok {
+			return logSource{}, fmt.Errorf("category %s is not supported", category)
+		}
+		for channel, ids := range channels {
+			source.channels[strings.ToLower(channel)] = ids
+		}
+		// A service narrows a category to one of its channels, e.g. sysmon
+		if channel, ok := sigmaServices[service]; ok {
+			ids, known := source.channels[strings.ToLower(channel)]
+			if !known {
+				return logSource{}, fmt.Errorf("service %s does not record category %s", service, category)
+			}
+			source.channels = map[string][]uint32{strings.ToLower(channel): ids}
+		}
+	case service != "":
+		channel, ok := sigmaServices[service]
+		if !ok {
+			return logSource{}, fmt.Errorf("service %s is not supported", service)
+		}
+		source.channels[strings.ToLower(channel)] = nil
+	default:
+		source.channels = nil
+	}
+	return source, nil
+}
+
+// applies reports whether events of the channel and event ID are in the log source
+func (s logSource) applies(event eventlog.EventLogData) bool {
+	if s.channels == nil {
+		return true
+	}
+	ids, ok := s.channels[strings.ToLower(event.Channel)]
+	if !ok {
+		return false
+	}
+	if len(ids) == 0 {
+		return true
+	}
+	for _, id := range ids {
+		if id == event.EventID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package detect
+
+import (
+	"testing"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+func TestResolveLogSource(t *testing.T) {
+	tests := []struct {
+		logsource map[string]any
+		channel   string
+		eventID   uint32
+		want      bool
+	}{
+		{nil, "Anything", 1, true},
+		{map[string]any{"product": "windows"}, "System", 7045, true},
+		{map[string]any{"product": "windows", "service": "security"}, "Security", 4624, true},
+		{map[string]any{"product": "windows", "service": "security"}, "System", 4624, false},
+		{map[string]any{"category": "process_creation"}, "Security", 4688, true},
+		{map[string]any{"category": "process_creation"}, "security", 4624, false},
+		{map[string]any{"category": "process_creation"}, sysmonChannel, 1, true},
+		// A service narrows a category to its channel
+		{map[string]any{"category": "process_creation", "service": "sysmon"}, "Security", 4688, false},
+		{map[string]any{"category": "process_creation", "service": "sysmon"}, sysmonChannel, 1, true},
+		{map[string]any{"category": "ps_script"}, powershellChannel, 4104, true},
+	}
+	for _, tt := range tests {
+		source, err := resolveLogSource(tt.logsource)
+		if err != nil {
+			t.Errorf("resolveLogSource(%v): %v", tt.logsource, err)
+			continue
+		}
+		event := eventlog.EventLogData{Channel: tt.channel, EventID: tt.eventID}
+		if got := source.applies(event); got != tt.want {
+			t.Errorf("%v applies to %s %d = %v, want %v", tt.logsource, tt.channel, tt.eventID, got, tt.want)
+		}
+	}
+}
+
+func TestResolveLogSourceErrors(t *testing.T) {
+	tests := []struct {
+		logsource map[string]any
+		want      string
+	}{
+		{map[string]any{"product": "linux"}, "product linux is not collected"},
+		{map[string]any{"category": "proxy"}, "category proxy is not supported"},
+		{map[string]any{"service": "unknown"}, "service unknown is not supported"},
+		{map[string]any{"category": "ps_script", "service": "sysmon"}, "service sysmon does not record category ps_script"},
+	}
+	for _, tt := range tests {
+		_, err := resolveLogSource(tt.logsource)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("resolveLogSource(%v) = %v, want %q", tt.logsource, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,444 @@
+package detect
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Rule is a compiled Sigma rule
+type Rule struct {
+	ID          string
+	Title       string
+	Level       string // informational, low, medium, high or critical
+	Status      string
+	Description string
+	Tags        []string // ATT&CK techniques and other labels, e.g. attack.t1059.001
+	Path        string   // File the rule was loaded from
+
+	source     logSource
+	selections map[string]*selection
+	condition  condNode
+}
+
+// selection is a named search of a rule's detection section: alternatives of
+// field matchers (a list of mappings matches when any mapping does), or keywords
+// searched for in the whole event
+type selection struct {
+	alternatives [][]*fieldMatcher
+	keywords     []valueMatcher
+}
+
+// fieldMatcher matches one field against the values of a "Field|modifier: values"
+// entry: any value, or all of them with the all modifier
+type fieldMatcher struct {
+	field  string
+	all    bool
+	exists *bool          // The exists modifier: whether the field must be present
+	values []valueMatcher // A nil entry matches a missing or empty field (value null)
+}
+
+// valueMatcher matches a field value
+type valueMatcher func(string) bool
+
+// compileRule builds a rule from a parsed Sigma YAML document
+func compileRule(doc any, path string) (*Rule, error) {
+	m, ok := doc.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("a rule must be a mapping")
+	}
+	rule := &Rule{
+		ID:          stringValue(m["id"]),
+		Title:       stringValue(m["title"]),
+		Level:       strings.ToLower(stringValue(m["level"])),
+		Status:      stringValue(m["status"]),
+		Description: stringValue(m["description"]),
+		Path:        path,
+	}
+	if rule.Title == "" {
+		return nil, fmt.Errorf("rule has no title")
+	}
+	if tags, ok := m["tags"].([]any); ok {
+		for _, tag := range tags {
+			rule.Tags = append(rule.Tags, stringValue(tag))
+		}
+	}
+
+	logsource, _ := m["logsource"].(map[string]any)
+	source, err := resolveLogSource(logsource)
+	if err != nil {
+		return nil, err
+	}
+	rule.source = source
+
+	detection, ok := m["detection"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("rule has no detection")
+	}
+	rule.selections = map[string]*selection{}
+	for name, value := range detection {
+		if name == "condition" || name == "timeframe" {
+			continue
+		}
+		sel, err := compileSelection(value)
+		if err != nil {
+			return nil, fmt.Errorf("selection %s: %v", name, err)
+		}
+		rule.selections[name] = sel
+	}
+	if _, ok := detection["timeframe"]; ok {
+		return nil, fmt.Errorf("timeframe correlations are not supported")
+	}
+
+	var condition string
+	switch c := detection["condition"].(type) {
+	case string:
+		condition = c
+	case []any:
+		// A list of conditions matches when any of them does
+		parts := make([]string, len(c))
+		for i, part := range c {
+			parts[i] = "(" + stringValue(part) + ")"
+		}
+		condition = strings.Join(parts, " or ")
+	default:
+		return nil, fmt.Errorf("rule has no condition")
+	}
+	if rule.condition, err = parseCondition(condition, rule.selectionNames()); err != nil {
+		return nil, fmt.Errorf("condition %q: %v", condition, err)
+	}
+	return rule, nil
+}
+
+// selectionNames returns the names of the rule's selections, sorted
+func (r *Rule) selectionNames() []string {
+	names := make([]string, 0, len(r.selections))
+	for name := range r.selections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compileSelection compiles a selection: a mapping, a list of mappings or a list of keywords
+func compileSelection(value any) (*selection, error) {
+	sel := &selection{}
+	switch v := value.(type) {
+	case map[string]any:
+		matchers, err := compileMapping(v)
+		if err != nil {
+			return nil, err
+		}
+		sel.alternatives = append(sel.alternatives, matchers)
+	case []any:
+		for _, item := range v {
+			if mapping, ok := item.(map[string]any); ok {
+				matchers, err := compileMapping(mapping)
+				if err != nil {
+					return nil, err
+				}
+				sel.alternatives = append(sel.alternatives, matchers)
+				continue
+			}
+			keyword, err := compileValue(stringValue(item), []string{"contains"})
+			if err != nil {
+				return nil, err
+			}
+			sel.keywords = append(sel.keywords, keyword)
+		}
+	case string:
+		keyword, err := compileValue(v, []string{"contains"})
+		if err != nil {
+			return nil, err
+		}
+		sel.keywords = append(sel.keywords, keyword)
+	default:
+		return nil, fmt.Errorf("expected a mapping or a list")
+	}
+	return sel, nil
+}
+
+// compileMapping compiles the "Field|modifier: values" entries of a mapping, all of
+// which must match
+func compileMapping(m map[string]any) ([]*fieldMatcher, error) {
+	var matchers []*fieldMatcher
+	for key, value := range m {
+		parts := strings.Split(key, "|")
+		matcher := &fieldMatcher{field: parts[0]}
+		var modifiers []string
+		for _, modifier := range parts[1:] {
+			switch modifier = strings.ToLower(modifier); modifier {
+			case "all":
+				matcher.all = true
+			case "exists":
+				exists := strings.EqualFold(stringValue(value), "true")
+				matcher.exists = &exists
+			default:
+				modifiers = append(modifiers, modifier)
+			}
+		}
+		if matcher.exists != nil {
+			matchers = append(matchers, matcher)
+			continue
+		}
+
+		values, isList := value.([]any)
+		if !isList {
+			values = []any{value}
+		}
+		for _, v := range values {
+			if v == nil {
+				matcher.values = append(matcher.values, nil)
+				continue
+			}
+			if _, nested := v.(map[string]any); nested {
+				return nil, fmt.Errorf("field %s: nested mappings are not supported", matcher.field)
+			}
+			vm, err := compileValue(stringValue(v), modifiers)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %v", matcher.field, err)
+			}
+			matcher.values = append(matcher.values, vm)
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers, nil
+}
+
+// compileValue compiles a value with its modifiers. Values match the whole field,
+// case-insensitively, with * and ? wildcards (\* and \? are literal) unless a
+// modifier says otherwise.
+func compileValue(value string, modifiers []string) (valueMatcher, error) {
+	prefix, suffix := "^", "$"
+	cased := false
+	for _, modifier := range modifiers {
+		switch modifier {
+		case "contains":
+			prefix, suffix = "", ""
+		case "startswith":
+			suffix = ""
+		case "endswith":
+			prefix = ""
+		case "cased":
+			cased = true
+		case "re":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression %q: %v", value, err)
+			}
+			return re.MatchString, nil
+		case "gt", "gte", "lt", "lte":
+			return compileNumeric(value, modifier)
+		case "windash":
+			// -flag and /flag are interchangeable on the Windows command line
+			rest := withoutModifier(modifiers, "windash")
+			dash, err := compileValue(value, rest)
+			if err != nil {
+				return nil, err
+			}
+			slash, err := compileValue(windashPattern.ReplaceAllString(value, "$1/"), rest)
+			if err != nil {
+				return nil, err
+			}
+			return func(s string) bool { return dash(s) || slash(s) }, nil
+		default:
+			return nil, fmt.Errorf("unsupported modifier %s", modifier)
+		}
+	}
+
+	// The wildcards of contains, startswith and endswith are left out of the
+	// anchors rather than appended to the value, where a trailing \ would escape them
+	pattern := "(?s)" + prefix + globPattern(value) + suffix
+	if !cased {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q: %v", value, err)
+	}
+	return re.MatchString, nil
+}
+
+// windashPattern finds the dashes that start command-line flags in a value
+var windashPattern = regexp.MustCompile(`(^|\s)-`)
+
+// withoutModifier returns the modifiers other than name
+func withoutModifier(modifiers []string, name string) []string {
+	var rest []string
+	for _, modifier := range modifiers {
+		if modifier != name {
+			rest = append(rest, modifier)
+		}
+	}
+	return rest
+}
+
+// compileNumeric compiles a gt, gte, lt or lte comparison with a number
+func compileNumeric(value, modifier string) (valueMatcher, error) {
+	limit, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s needs a number, not %q", modifier, value)
+	}
+	return func(s string) bool {
+		n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return false
+		}
+		switch modifier {
+		case "gt":
+			return n > limit
+		case "gte":
+			return n >= limit
+		case "lt":
+			return n < limit
+		}
+		return n <= limit
+	}, nil
+}
+
+// globPattern translates a Sigma value with wildcards into an unanchored regular
+// expression. A backslash only escapes *, ? and another backslash, so Windows
+// paths need no escaping.
+func globPattern(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '\\' && i+1 < len(value) && strings.IndexByte(`*?\`, value[i+1]) >= 0:
+			i++
+			b.WriteString(regexp.QuoteMeta(value[i : i+1]))
+		case c == '*':
+			b.WriteString(".*")
+		case c == '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(value[i : i+1]))
+		}
+	}
+	return b.String()
+}
+
+// stringValue renders a scalar of a parsed document as a string
+func stringValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// match reports whether the selection matches the event
+func (s *selection) match(e *eventView) bool {
+	for _, keyword := range s.keywords {
+		if e.anyString(keyword) {
+			return true
+		}
+	}
+	for _, matchers := range s.alternatives {
+		matched := true
+		for _, m := range matchers {
+			if !m.match(e) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether the field of the event matches any, or all, of the values
+func (m *fieldMatcher) match(e *eventView) bool {
+	value, present := e.field(m.field)
+	if m.exists != nil {
+		return present == *m.exists
+	}
+	for _, vm := range m.values {
+		var matched bool
+		if vm == nil {
+			matched = !present || value == ""
+		} else {
+			matched = present && vm(value)
+		}
+		if matched != m.all {
+			return matched
+		}
+	}
+	return m.all && len(m.values) > 0
+}
+
+// eventView gives rules access to the fields of an event by their Sigma names
+type eventView struct {
+	event eventlog.EventLogData
+	data  map[string]string // Insertion strings by lowercase field name, built on first use
+}
+
+// sigmaAliases maps the Sysmon field names that Sigma rules use to their names in
+// other events of the same category, such as Security 4688 process creations
+var sigmaAliases = map[string][]string{
+	"image":             {"newprocessname"},
+	"parentimage":       {"parentprocessname"},
+	"processid":         {"newprocessid"},
+	"parentprocessid":   {"processid"},
+	"user":              {"subjectusername", "targetusername"},
+	"logonid":           {"subjectlogonid", "targetlogonid"},
+	"integritylevel":    {"mandatorylabel"},
+	"targetfilename":    {"objectname"},
+	"destinationip":     {"destaddress"},
+	"destinationport":   {"destport"},
+	"sourceip":          {"sourceaddress", "ipaddress"},
+	"scriptblocktext":   {"scriptblock"},
+	"servicefilename":   {"imagepath"},
+	"commandline":       {"processcommandline"},
+	"querystatusresult": {"querystatus"},
+}
+
+// field returns a field of the event by its Sigma name
+func (e *eventView) field(name string) (string, bool) {
+	switch strings.ToLower(name) {
+	case "eventid":
+		return strconv.FormatUint(uint64(e.event.EventID), 10), true
+	case "channel":
+		return e.event.Channel, true
+	case "provider_name", "provider", "source":
+		return e.event.SourceName, true
+	case "computer", "computername":
+		return e.event.ComputerName, true
+	case "level":
+		return eventlog.GetEventTypeName(e.event.EventType), true
+	}
+
+	if e.data == nil {
+		e.data = map[string]string{}
+		for key, value := range eventlog.NamedData(e.event.Channel, e.event) {
+			e.data[strings.ToLower(key)] = value
+		}
+	}
+	key := strings.ToLower(name)
+	if value, ok := e.data[key]; ok {
+		return value, true
+	}
+	for _, alias := range sigmaAliases[key] {
+		if value, ok := e.data[alias]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// anyString reports whether any insertion string or the rendered message matches
+func (e *eventView) anyString(vm valueMatcher) bool {
+	for _, s := range e.event.Strings {
+		if vm(s) {
+			return true
+		}
+	}
+	return e.event.Message != "" && vm(e.event.Message)
+}
@@ -0,0 +1,178 @@
+package detect
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+func TestCompileValue(t *testing.T) {
+	tests := []struct {
+		value     string
+		modifiers string // Comma-separated
+		input     string
+		want      bool
+	}{
+		{`cmd.exe`, "", `CMD.EXE`, true},
+		{`cmd.exe`, "", `xcmd.exe`, false},
+		{`*\cmd.exe`, "", `C:\Windows\System32\cmd.exe`, true},
+		{`C:\Windows\\*`, "", `c:\windows\temp\x`, true},
+		// \* is a literal *, so a path ending in a backslash needs \\*
+		{`C:\Windows\*`, "", `c:\windows\temp\x`, false},
+		{`cmd?exe`, "", `cmd.exe`, true},
+		{`a\*b`, "", `a*b`, true},
+		{`a\*b`, "", `axb`, false},
+		{`a\\`, "", `a\`, true},
+		{`line`, "", "one\nline", false},
+		{`temp`, "contains", `C:\TEMP\x`, true},
+		{`temp\`, "contains", `C:\TEMP\x`, true},
+		{`C:\`, "startswith", `c:\x`, true},
+		{`.exe`, "endswith", `x.exe.txt`, false},
+		{`Temp`, "contains,cased", `C:\TEMP\x`, false},
+		{`Temp`, "contains,cased", `C:\Temp\x`, true},
+		{`^\d+$`, "re", `123`, true},
+		{`5`, "gt", `10`, true},
+		{`5`, "gte", ` 5 `, true},
+		{`5`, "lt", `x`, false},
+		{`5`, "lte", `6`, false},
+		{` -enc `, "contains,windash", `powershell /enc abc`, true},
+		{` -enc `, "contains,windash", `powershell -enc abc`, true},
+		{`-e`, "windash", `/e`, true},
+	}
+	for _, tt := range tests {
+		var modifiers []string
+		if tt.modifiers != "" {
+			modifiers = strings.Split(tt.modifiers, ",")
+		}
+		vm, err := compileValue(tt.value, modifiers)
+		if err != nil {
+			t.Errorf("compileValue(%q, %s): %v", tt.value, tt.modifiers, err)
+			continue
+		}
+		if got := vm(tt.input); got != tt.want {
+			t.Errorf("%q|%s on %q = %v, want %v", tt.value, tt.modifiers, tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestCompileValueErrors(t *testing.T) {
+	tests := []struct {
+		value    string
+		modifier string
+		want     string
+	}{
+		{`(`, "re", "invalid regular expression"},
+		{`x`, "gt", `gt needs a number, not "x"`},
+		{`x`, "base64", "unsupported modifier base64"},
+	}
+	for _, tt := range tests {
+		_, err := compileValue(tt.value, []string{tt.modifier})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("compileValue(%q, %s) = %v, want %q", tt.value, tt.modifier, err, tt.want)
+		}
+	}
+}
+
+// rules are the Sigma rules of TestLoad, by file name
+var rules = map[string]string{
+	"temp.yml": `title: Process in Temp
+id: 1
+level: High
+tags: [attack.execution]
+logsource:
+  category: process_creation
+  product: windows
+detection:
+  selection:
+    NewProcessName|contains: '\Temp\'
+  filter:
+    ParentProcessName|endswith:
+      - '\explorer.exe'
+      - '\msiexec.exe'
+  condition: selection and not filter
+`,
+	"both.yaml": `title: Encoded PowerShell
+logsource:
+  category: process_creation
+detection:
+  selection:
+    Image|endswith: '\powershell.exe'
+    CommandLine|contains|windash: ' -enc '
+  condition: selection
+---
+title: Keyword
+logsource:
+  service: security
+detection:
+  keywords:
+    - mimikatz
+  condition: keywords
+`,
+	"skipped.yml": `title: Linux
+logsource:
+  product: linux
+detection:
+  selection:
+    a: b
+  condition: selection
+---
+title: Unknown selection
+detection:
+  selection:
+    a: b
+  condition: other
+`,
+	"broken.yml":  "title: x\n  bad: indentation\n",
+	"ignored.txt": "not a rule",
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range rules {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	engine, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if engine.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", engine.Len())
+	}
+	if skipped := engine.Skipped(); len(skipped) != 3 {
+		t.Errorf("Skipped() = %q, want 3 entries", skipped)
+	}
+
+	// Insertion strings of Security 4688, see eventlog.FieldNames
+	process := func(name, commandLine, parent string) eventlog.EventLogData {
+		return eventlog.EventLogData{Channel: "Security", EventID: 4688, Strings: []string{
+			"S-1-5-18", "HOST$", "CORP", "0x3e7", "0x1a4", name, "%%1936", "0x2f0", commandLine,
+			"S-1-0-0", "-", "-", "0x0", parent, "S-1-16-8192"}}
+	}
+	tests := []struct {
+		name  string
+		event eventlog.EventLogData
+		want  []string
+	}{
+		{"temp", process(`C:\Users\a\AppData\Local\Temp\x.exe`, "x.exe", `C:\Windows\System32\cmd.exe`), []string{"Process in Temp"}},
+		{"filtered", process(`C:\Windows\Temp\x.exe`, "x.exe", `C:\Windows\System32\msiexec.exe`), nil},
+		// Image and CommandLine are the Sysmon names of NewProcessName and CommandLine
+		{"alias", process(`C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe`, "powershell.exe /enc SQBFAFgA", `C:\Windows\explorer.exe`), []string{"Encoded PowerShell"}},
+		{"keyword", eventlog.EventLogData{Channel: "Security", EventID: 4673, Message: "Process Mimikatz.exe used a privilege"}, []string{"Keyword"}},
+		{"other log source", eventlog.EventLogData{Channel: "System", EventID: 7045, Message: "mimikatz"}, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, rule := range engine.Match(tt.event) {
+			got = append(got, rule.Title)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Match() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
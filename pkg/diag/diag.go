@@ -0,0 +1,177 @@
+package diag
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLines is the number of recent log lines kept for diagnostic bundles
+const DefaultLines = 200
+
+// Ring keeps the last N lines written to it
+type Ring struct {
+	mu      sync.Mutex
+	lines   []string
+	max     int
+	partial string
+}
+
+// NewRing creates a ring that retains up to max lines
+func NewRing(max int) *Ring {
+	if max <= 0 {
+		max = DefaultLines
+	}
+	return &Ring{max: max}
+}
+
+// Write appends text to the ring, splitting it into lines
+func (r *Ring) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	text := r.partial + string(p)
+	parts := strings.Split(text, "\n")
+	r.partial = parts[len(parts)-1]
+	for _, line := range parts[:len(parts)-1] {
+		r.lines = append(r.lines, line)
+	}
+	if len(r.lines) > r.max {
+		r.lines = append([]string(nil), r.lines[len(r.lines)-r.max:]...)
+	}
+	return len(p), nil
+}
+
+// Lines returns the retained lines, oldest first
+func (r *Ring) Lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lines := append([]string(nil), r.lines...)
+	if r.partial != "" {
+		lines = append(lines, r.partial)
+	}
+	return lines
+}
+
+// Tee writes to an underlying writer and records everything in a ring
+type Tee struct {
+	w    io.Writer
+	ring *Ring
+}
+
+// NewTee creates a writer that copies output into ring
+func NewTee(w io.Writer, ring *Ring) *Tee {
+	return &Tee{w: w, ring: ring}
+}
+
+// Write writes p to the underlying writer and the ring
+func (t *Tee) Write(p []byte) (int, error) {
+	t.ring.Write(p)
+	return t.w.Write(p)
+}
+
+// WriteString writes s to the underlying writer and the ring
+func (t *Tee) WriteString(s string) (int, error) {
+	return t.Write([]byte(s))
+}
+
+// Bundle describes the state captured after a recovered panic
+type Bundle struct {
+	Time     time.Time         `json:"time"`
+	Context  string            `json:"context"`
+	Panic    string            `json:"panic"`
+	Stack    string            `json:"-"`
+	Config   map[string]string `json:"config"`
+	Lines    []string          `json:"-"`
+	GoOS     string            `json:"goos"`
+	GoArch   string            `json:"goarch"`
+	Version  string            `json:"go_version"`
+	Hostname string            `json:"hostname"`
+}
+
+// NewBundle captures the current goroutine's stack and the process context
+func NewBundle(context string, recovered any, config map[string]string, lines []string) *Bundle {
+	stack := make([]byte, 64<<10)
+	stack = stack[:runtime.Stack(stack, false)]
+	hostname, _ := os.Hostname()
+
+	return &Bundle{
+		Time:     time.Now(),
+		Context:  context,
+		Panic:    fmt.Sprint(recovered),
+		Stack:    string(stack),
+		Config:   config,
+		Lines:    lines,
+		GoOS:     runtime.GOOS,
+		GoArch:   runtime.GOARCH,
+		Version:  runtime.Version(),
+		Hostname: hostname,
+	}
+}
+
+// written numbers the bundles of this process, so that two panics in the same
+// second get different names
+var written atomic.Uint64
+
+// Write saves the bundle as a ZIP (summary.json, stack.txt, log.txt) in dir and returns its path
+func (b *Bundle) Write(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create diagnostic directory %s: %v", dir, err)
+	}
+
+	name := fmt.Sprintf("datn-crash-%s-%d-%d.zip", b.Time.Format("20060102-150405"), os.Getpid(), written.Add(1))
+	path := filepath.Join(dir, name)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create diagnostic bundle: %v", err)
+	}
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+
+	summary, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode diagnostic summary: %v", err)
+	}
+
+	entries := []struct {
+		name string
+		data string
+	}{
+		{"summary.json", string(summary)},
+		{"stack.txt", b.Stack},
+		{"log.txt", strings.Join(b.Lines, "\n") + "\n"},
+	}
+	for _, entry := range entries {
+		w, err := zw.Create(entry.name)
+		if err != nil {
+			return "", fmt.Errorf("failed to add %s to diagnostic bundle: %v", entry.name, err)
+		}
+		if _, err := io.WriteString(w, entry.data); err != nil {
+			return "", fmt.Errorf("failed to write %s to diagnostic bundle: %v", entry.name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("failed to finish diagnostic bundle: %v", err)
+	}
+
+	return path, nil
+}
+
+// DefaultDir returns the known location for diagnostic bundles
+func DefaultDir() string {
+	if programData := os.Getenv("ProgramData"); programData != "" {
+		return filepath.Join(programData, "datn", "diag")
+	}
+	return filepath.Join(os.TempDir(), "datn-diag")
+}
@@ -0,0 +1,24 @@
+package diag
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWriteSameSecond(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		b := NewBundle("test", "boom", nil, nil)
+		b.Time = now
+		path, err := b.Write(dir)
+		if err != nil {
+			t.Fatalf("Write %d: %v", i+1, err)
+		}
+		if seen[path] {
+			t.Fatalf("Write %d reused %s", i+1, path)
+		}
+		seen[path] = true
+	}
+}
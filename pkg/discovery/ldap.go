@@ -0,0 +1,186 @@
+package discovery
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	wldap32               = syscall.NewLazyDLL("wldap32.dll")
+	ldapInit              = wldap32.NewProc("ldap_initW")
+	ldapSetOption         = wldap32.NewProc("ldap_set_optionW")
+	ldapBind              = wldap32.NewProc("ldap_bind_sW")
+	ldapUnbind            = wldap32.NewProc("ldap_unbind")
+	ldapSearchInitPage    = wldap32.NewProc("ldap_search_init_pageW")
+	ldapGetNextPage       = wldap32.NewProc("ldap_get_next_page_s")
+	ldapSearchAbandonPage = wldap32.NewProc("ldap_search_abandon_page")
+	ldapFirstEntry        = wldap32.NewProc("ldap_first_entry")
+	ldapNextEntry         = wldap32.NewProc("ldap_next_entry")
+	ldapGetValues         = wldap32.NewProc("ldap_get_valuesW")
+	ldapValueFree         = wldap32.NewProc("ldap_value_freeW")
+	ldapMsgFree           = wldap32.NewProc("ldap_msgfree")
+)
+
+const (
+	LDAP_PORT                 = 389
+	LDAP_SUCCESS              = 0x00
+	LDAP_NO_RESULTS_RETURNED  = 0x5E
+	LDAP_SCOPE_SUBTREE        = 0x02
+	LDAP_AUTH_NEGOTIATE       = 0x0486
+	LDAP_OPT_PROTOCOL_VERSION = 0x11
+	LDAP_VERSION3             = 3
+	LDAP_OPT_REFERRALS        = 0x08
+	LDAP_OPT_OFF              = 0
+)
+
+// ldapPageSize is the number of entries requested per page; domain controllers
+// cap unpaged searches at 1000 results
+const ldapPageSize = 500
+
+// computerFilter matches enabled computer accounts (bit 2 of userAccountControl is ACCOUNTDISABLE)
+const computerFilter = "(&(objectCategory=computer)(!(userAccountControl:1.2.840.113556.1.4.803:=2)))"
+
+// Computer is a computer object found in Active Directory
+type Computer struct {
+	Name            string // sAMAccountName-style short name (cn)
+	DNSHostName     string
+	OperatingSystem string
+}
+
+// Host returns the name used to connect to the computer
+func (c Computer) Host() string {
+	if c.DNSHostName != "" {
+		return c.DNSHostName
+	}
+	return c.Name
+}
+
+// ldapError formats an LDAP result code
+func ldapError(call string, code uintptr) error {
+	return fmt.Errorf("%s failed with LDAP error 0x%X", call, code)
+}
+
+// FindComputers lists the enabled computer objects below the organizational unit
+// baseDN (e.g. "OU=Servers,DC=corp,DC=example,DC=com"). The search binds to a domain
+// controller of the current domain (or server, when set) with the caller's Kerberos
+// or NTLM credentials, so it honours -runas impersonation.
+func FindComputers(server, baseDN string) ([]Computer, error) {
+	var serverPtr *uint16
+	if server != "" {
+		var err error
+		if serverPtr, err = syscall.UTF16PtrFromString(server); err != nil {
+			return nil, fmt.Errorf("invalid server name: %v", err)
+		}
+	}
+
+	ld, _, err := ldapInit.Call(uintptr(unsafe.Pointer(serverPtr)), LDAP_PORT)
+	if ld == 0 {
+		return nil, fmt.Errorf("ldap_init failed: %v", err)
+	}
+	defer ldapUnbind.Call(ld)
+
+	version := uint32(LDAP_VERSION3)
+	ldapSetOption.Call(ld, LDAP_OPT_PROTOCOL_VERSION, uintptr(unsafe.Pointer(&version)))
+	referrals := uint32(LDAP_OPT_OFF)
+	ldapSetOption.Call(ld, LDAP_OPT_REFERRALS, uintptr(unsafe.Pointer(&referrals)))
+
+	if ret, _, _ := ldapBind.Call(ld, 0, 0, LDAP_AUTH_NEGOTIATE); ret != LDAP_SUCCESS {
+		return nil, ldapError("ldap_bind", ret)
+	}
+
+	basePtr, err := syscall.UTF16PtrFromString(baseDN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base DN: %v", err)
+	}
+	filterPtr, _ := syscall.UTF16PtrFromString(computerFilter)
+
+	attributes := []string{"cn", "dNSHostName", "operatingSystem"}
+	attrPtrs := make([]*uint16, len(attributes)+1) // NULL-terminated
+	for i, name := range attributes {
+		attrPtrs[i], _ = syscall.UTF16PtrFromString(name)
+	}
+
+	search, _, _ := ldapSearchInitPage.Call(
+		ld,
+		uintptr(unsafe.Pointer(basePtr)),
+		LDAP_SCOPE_SUBTREE,
+		uintptr(unsafe.Pointer(filterPtr)),
+		uintptr(unsafe.Pointer(&attrPtrs[0])),
+		0, // attrsonly
+		0, // server controls
+		0, // client controls
+		0, // page time limit
+		0, // total size limit
+		0, // sort keys
+	)
+	if search == 0 {
+		return nil, fmt.Errorf("ldap_search_init_page failed for %s", baseDN)
+	}
+	defer ldapSearchAbandonPage.Call(ld, search)
+
+	var computers []Computer
+	for {
+		var totalCount uint32
+		var message uintptr
+		ret, _, _ := ldapGetNextPage.Call(
+			ld,
+			search,
+			0, // no timeout
+			ldapPageSize,
+			uintptr(unsafe.Pointer(&totalCount)),
+			uintptr(unsafe.Pointer(&message)),
+		)
+		if ret == LDAP_NO_RESULTS_RETURNED {
+			break
+		}
+		if ret != LDAP_SUCCESS {
+			if message != 0 {
+				ldapMsgFree.Call(message)
+			}
+			return computers, ldapError("ldap_get_next_page", ret)
+		}
+
+		for entry, _, _ := ldapFirstEntry.Call(ld, message); entry != 0; entry, _, _ = ldapNextEntry.Call(ld, entry) {
+			computer := Computer{
+				Name:            firstValue(ld, entry, "cn"),
+				DNSHostName:     firstValue(ld, entry, "dNSHostName"),
+				OperatingSystem: firstValue(ld, entry, "operatingSystem"),
+			}
+			if computer.Host() != "" {
+				computers = append(computers, computer)
+			}
+		}
+		ldapMsgFree.Call(message)
+	}
+
+	return computers, nil
+}
+
+// firstValue returns the first value of an attribute of an entry, or ""
+func firstValue(ld, entry uintptr, attribute string) string {
+	namePtr, _ := syscall.UTF16PtrFromString(attribute)
+	values, _, _ := ldapGetValues.Call(ld, entry, uintptr(unsafe.Pointer(namePtr)))
+	if values == 0 {
+		return ""
+	}
+	defer ldapValueFree.Call(values)
+
+	// values is a system-allocated array of string pointers; reading it through the
+	// variable's address keeps the uintptr from being converted back to a Pointer
+	first := **(***uint16)(unsafe.Pointer(&values))
+	if first == nil {
+		return ""
+	}
+	return strings.TrimSpace(windowsString(first))
+}
+
+// windowsString converts a NUL-terminated UTF-16 string owned by the system
+func windowsString(p *uint16) string {
+	var units []uint16
+	for ptr := unsafe.Pointer(p); *(*uint16)(ptr) != 0; ptr = unsafe.Add(ptr, 2) {
+		units = append(units, *(*uint16)(ptr))
+	}
+	return syscall.UTF16ToString(units)
+}
@@ -0,0 +1,63 @@
+package discovery
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Ports checked to decide whether a host can be collected from
+const (
+	PortRPC   = 135  // RPC endpoint mapper, used by remote OpenEventLogW
+	PortSMB   = 445  // Named pipes carrying the event log RPC interface
+	PortWinRM = 5985 // WinRM over HTTP, used by the WinRM fallback
+)
+
+// DefaultPorts are probed by CheckReachable
+var DefaultPorts = []int{PortRPC, PortSMB, PortWinRM}
+
+// Reachability is the result of probing one host
+type Reachability struct {
+	Host      string
+	OpenPorts []int
+}
+
+// Reachable reports whether any probed port accepted a connection
+func (r Reachability) Reachable() bool {
+	return len(r.OpenPorts) > 0
+}
+
+// CheckReachable probes every host on the given ports with TCP connects, at most
+// parallel hosts at a time, and returns the results in the order of hosts. ICMP is
+// not used because it is commonly blocked where the collection ports are open.
+func CheckReachable(hosts []string, ports []int, timeout time.Duration, parallel int) []Reachability {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([]Reachability, len(hosts))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, host string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i].Host = host
+			for _, port := range ports {
+				conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+				if err != nil {
+					continue
+				}
+				conn.Close()
+				results[i].OpenPorts = append(results[i].OpenPorts, port)
+			}
+		}(i, host)
+	}
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,158 @@
+package domains
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// DGA-like names have a long, high-entropy label; both thresholds must be met
+const (
+	SuspiciousEntropy = 3.5 // Shannon entropy in bits per character
+	SuspiciousLength  = 10  // Minimum length of the scored label
+)
+
+// queryEvents are the channels and event IDs whose QueryName field is a DNS lookup
+var queryEvents = map[string][]uint32{
+	"microsoft-windows-dns-client/operational": {3006, 3008, 3020},
+	"microsoft-windows-sysmon/operational":     {22},
+}
+
+// Domain aggregates the lookups of one name
+type Domain struct {
+	Name       string    `json:"name"`
+	Count      int       `json:"count"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	Entropy    float64   `json:"entropy"` // Of the longest label below the top-level domain
+	Suspicious bool      `json:"suspicious"`
+}
+
+// Table collects the unique domains queried in DNS Client and Sysmon events
+type Table struct {
+	domains map[string]*Domain
+}
+
+// NewTable returns an empty table
+func NewTable() *Table {
+	return &Table{domains: map[string]*Domain{}}
+}
+
+// QueryName returns the name looked up by a DNS query event, or "" if the event
+// isn't one
+func QueryName(event eventlog.EventLogData) string {
+	ids, ok := queryEvents[strings.ToLower(event.Channel)]
+	if !ok {
+		return ""
+	}
+	for _, id := range ids {
+		if id == event.EventID {
+			return normalize(eventlog.NamedData(event.Channel, event)["QueryName"])
+		}
+	}
+	return ""
+}
+
+// normalize lowercases a name and strips the trailing root dot
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// Add records the DNS queries among the events
+func (t *Table) Add(events []eventlog.EventLogData) {
+	if t == nil {
+		return
+	}
+	for _, event := range events {
+		name := QueryName(event)
+		if name == "" {
+			continue
+		}
+		seen := time.Unix(int64(event.TimeGenerated), 0)
+
+		d, ok := t.domains[name]
+		if !ok {
+			entropy := Entropy(name)
+			d = &Domain{
+				Name:       name,
+				FirstSeen:  seen,
+				LastSeen:   seen,
+				Entropy:    entropy,
+				Suspicious: entropy >= SuspiciousEntropy && len(scoredLabel(name)) >= SuspiciousLength,
+			}
+			t.domains[name] = d
+		}
+		d.Count++
+		if seen.Before(d.FirstSeen) {
+			d.FirstSeen = seen
+		}
+		if seen.After(d.LastSeen) {
+			d.LastSeen = seen
+		}
+	}
+}
+
+// Len returns the number of unique domains
+func (t *Table) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.domains)
+}
+
+// Domains returns the unique domains, highest entropy first, so DGA-like names
+// surface at the top
+func (t *Table) Domains() []Domain {
+	if t == nil {
+		return nil
+	}
+	list := make([]Domain, 0, len(t.domains))
+	for _, d := range t.domains {
+		list = append(list, *d)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Entropy != list[j].Entropy {
+			return list[i].Entropy > list[j].Entropy
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// scoredLabel returns the longest label of a name, ignoring the top-level domain
+func scoredLabel(name string) string {
+	labels := strings.Split(name, ".")
+	if len(labels) > 1 {
+		labels = labels[:len(labels)-1]
+	}
+	longest := ""
+	for _, label := range labels {
+		if len(label) > len(longest) {
+			longest = label
+		}
+	}
+	return longest
+}
+
+// Entropy returns the Shannon entropy, in bits per character, of the longest label
+// of a name below its top-level domain
+func Entropy(name string) float64 {
+	label := scoredLabel(name)
+	if label == "" {
+		return 0
+	}
+	counts := map[rune]int{}
+	for _, r := range label {
+		counts[r]++
+	}
+	n := float64(len([]rune(label)))
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
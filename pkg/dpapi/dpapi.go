@@ -0,0 +1,67 @@
+package dpapi
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// entropy is mixed into every blob so other DPAPI consumers on the host can't decrypt ours by accident
+var entropy = []byte("lemita/datn at-rest state")
+
+// newBlob wraps a byte slice in a DATA_BLOB
+func newBlob(data []byte) *windows.DataBlob {
+	if len(data) == 0 {
+		return &windows.DataBlob{}
+	}
+	return &windows.DataBlob{
+		Size: uint32(len(data)),
+		Data: &data[0],
+	}
+}
+
+// blobBytes copies the contents of a DATA_BLOB allocated by the system and frees it
+func blobBytes(blob *windows.DataBlob) []byte {
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(blob.Data)))
+	out := make([]byte, blob.Size)
+	copy(out, unsafe.Slice(blob.Data, blob.Size))
+	return out
+}
+
+// Protect encrypts data with a key bound to the local machine (CRYPTPROTECT_LOCAL_MACHINE),
+// so the result can only be decrypted on this host
+func Protect(data []byte) ([]byte, error) {
+	var out windows.DataBlob
+	err := windows.CryptProtectData(
+		newBlob(data),
+		nil,
+		newBlob(entropy),
+		0,
+		nil,
+		windows.CRYPTPROTECT_LOCAL_MACHINE|windows.CRYPTPROTECT_UI_FORBIDDEN,
+		&out,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("CryptProtectData failed: %v", err)
+	}
+	return blobBytes(&out), nil
+}
+
+// Unprotect decrypts data previously encrypted with Protect on this machine
+func Unprotect(data []byte) ([]byte, error) {
+	var out windows.DataBlob
+	err := windows.CryptUnprotectData(
+		newBlob(data),
+		nil,
+		newBlob(entropy),
+		0,
+		nil,
+		windows.CRYPTPROTECT_UI_FORBIDDEN,
+		&out,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("CryptUnprotectData failed: %v", err)
+	}
+	return blobBytes(&out), nil
+}
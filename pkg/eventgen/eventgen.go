@@ -0,0 +1,175 @@
+package eventgen
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+var (
+	advapi32              = syscall.NewLazyDLL("advapi32.dll")
+	RegisterEventSource   = advapi32.NewProc("RegisterEventSourceW")
+	ReportEvent           = advapi32.NewProc("ReportEventW")
+	DeregisterEventSource = advapi32.NewProc("DeregisterEventSource")
+)
+
+// Test events are written to their own log so they never mix with real telemetry
+const (
+	DefaultLog    = "datn-test"
+	DefaultSource = "datn-generator"
+)
+
+// eventLogKey holds the registered event logs and their sources
+const eventLogKey = `SYSTEM\CurrentControlSet\Services\EventLog`
+
+// messageFile renders any event ID as its first insertion string, so generated
+// events are readable in Event Viewer; it ships with the .NET Framework 4
+const messageFile = `%SystemRoot%\Microsoft.NET\Framework\v4.0.30319\EventLogMessages.dll`
+
+// Event is a synthetic event to write
+type Event struct {
+	ID       uint32
+	Type     uint16 // EVENTLOG_*_TYPE
+	Category uint16
+	Strings  []string
+	Data     []byte
+}
+
+// Install registers source in the given event log, creating the log if needed.
+// It needs administrative rights and only has to be done once per machine.
+func Install(log, source string) error {
+	key, _, err := registry.CreateKey(registry.LOCAL_MACHINE, eventLogKey+`\`+log+`\`+source, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("failed to register event source %s in %s: %v", source, log, err)
+	}
+	defer key.Close()
+
+	if err := key.SetExpandStringValue("EventMessageFile", messageFile); err != nil {
+		return fmt.Errorf("failed to register event source %s: %v", source, err)
+	}
+	types := uint32(windows.EVENTLOG_ERROR_TYPE | windows.EVENTLOG_WARNING_TYPE | windows.EVENTLOG_INFORMATION_TYPE |
+		windows.EVENTLOG_AUDIT_SUCCESS | windows.EVENTLOG_AUDIT_FAILURE)
+	if err := key.SetDWordValue("TypesSupported", types); err != nil {
+		return fmt.Errorf("failed to register event source %s: %v", source, err)
+	}
+	return nil
+}
+
+// Uninstall removes source from the given event log, and the log itself once it has
+// no other sources. The built-in logs are never removed.
+func Uninstall(log, source string) error {
+	err := registry.DeleteKey(registry.LOCAL_MACHINE, eventLogKey+`\`+log+`\`+source)
+	if err != nil && !errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+		return fmt.Errorf("failed to remove event source %s: %v", source, err)
+	}
+
+	switch log {
+	case "Application", "System", "Security":
+		return nil
+	}
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, eventLogKey+`\`+log, registry.ENUMERATE_SUB_KEYS)
+	if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open event log %s: %v", log, err)
+	}
+	sources, err := key.ReadSubKeyNames(0)
+	key.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read event log %s: %v", log, err)
+	}
+	// The event log service registers the log's own name as a source
+	for _, name := range sources {
+		if name != log {
+			return nil
+		}
+	}
+	if len(sources) > 0 {
+		if err := registry.DeleteKey(registry.LOCAL_MACHINE, eventLogKey+`\`+log+`\`+log); err != nil {
+			return fmt.Errorf("failed to remove event log %s: %v", log, err)
+		}
+	}
+	if err := registry.DeleteKey(registry.LOCAL_MACHINE, eventLogKey+`\`+log); err != nil {
+		return fmt.Errorf("failed to remove event log %s: %v", log, err)
+	}
+	return nil
+}
+
+// Writer reports events through a registered event source
+type Writer struct {
+	handle uintptr
+}
+
+// Open returns a writer for source on a computer (empty = local)
+func Open(server, source string) (*Writer, error) {
+	var serverPtr *uint16
+	if server != "" {
+		var err error
+		if serverPtr, err = syscall.UTF16PtrFromString(server); err != nil {
+			return nil, fmt.Errorf("invalid server name: %v", err)
+		}
+	}
+	sourcePtr, err := syscall.UTF16PtrFromString(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source name: %v", err)
+	}
+
+	handle, _, err := RegisterEventSource.Call(uintptr(unsafe.Pointer(serverPtr)), uintptr(unsafe.Pointer(sourcePtr)))
+	if handle == 0 {
+		return nil, fmt.Errorf("RegisterEventSource failed: %v", err)
+	}
+	return &Writer{handle: handle}, nil
+}
+
+// Write reports one event
+func (w *Writer) Write(event Event) error {
+	insertions := make([]*uint16, len(event.Strings))
+	for i, s := range event.Strings {
+		p, err := syscall.UTF16PtrFromString(s)
+		if err != nil {
+			return fmt.Errorf("invalid insertion string %d: %v", i+1, err)
+		}
+		insertions[i] = p
+	}
+	var stringsPtr, dataPtr uintptr
+	if len(insertions) > 0 {
+		stringsPtr = uintptr(unsafe.Pointer(&insertions[0]))
+	}
+	if len(event.Data) > 0 {
+		dataPtr = uintptr(unsafe.Pointer(&event.Data[0]))
+	}
+
+	ret, _, err := ReportEvent.Call(
+		w.handle,
+		uintptr(event.Type),
+		uintptr(event.Category),
+		uintptr(event.ID),
+		0,
+		uintptr(len(insertions)),
+		uintptr(len(event.Data)),
+		stringsPtr,
+		dataPtr,
+	)
+	if ret == 0 {
+		return fmt.Errorf("ReportEvent failed for event %d: %v", event.ID, err)
+	}
+	return nil
+}
+
+// Close deregisters the event source
+func (w *Writer) Close() error {
+	if w.handle == 0 {
+		return nil
+	}
+	ret, _, err := DeregisterEventSource.Call(w.handle)
+	w.handle = 0
+	if ret == 0 {
+		return fmt.Errorf("DeregisterEventSource failed: %v", err)
+	}
+	return nil
+}
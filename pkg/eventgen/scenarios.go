@@ -0,0 +1,111 @@
+package eventgen
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/store"
+)
+
+// Scenario is a named set of synthetic events exercising one kind of detection.
+// Insertion strings follow the layout of the Windows event they imitate, so field
+// positions match what the collector sees on real hosts.
+type Scenario struct {
+	Name        string
+	Description string
+	Events      []Event
+}
+
+// Scenarios returns the built-in scenarios for the local computer
+func Scenarios() []Scenario {
+	host, _ := os.Hostname()
+	host = strings.ToUpper(host)
+
+	failedLogon := Event{
+		ID:   4625,
+		Type: eventlog.EVENTLOG_AUDIT_FAILURE,
+		Strings: []string{"S-1-0-0", "-", "-", "0x0", "S-1-0-0", "administrator", host,
+			"0xc000006d", "%%2313", "0xc000006a", "3", "NtLmSsp", "NTLM", "ATTACKER-PC",
+			"-", "-", "0", "0x0", "-", "203.0.113.50", "49152"},
+	}
+	failedLogons := make([]Event, 5)
+	for i := range failedLogons {
+		failedLogons[i] = failedLogon
+	}
+
+	return []Scenario{
+		{
+			Name:        "failed-logons",
+			Description: "A burst of failed network logons (4625) for administrator from one address",
+			Events:      failedLogons,
+		},
+		{
+			Name:        "encoded-powershell",
+			Description: "Process creation (4688) of PowerShell with an encoded command line",
+			Events: []Event{{
+				ID:   4688,
+				Type: eventlog.EVENTLOG_AUDIT_SUCCESS,
+				Strings: []string{"S-1-5-21-1000", "labuser", host, "0x3e7", "0x1a2c",
+					`C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe`, "%%1936", "0x1f00",
+					"powershell.exe -NoProfile -enc SQBFAFgAIAAoAE4AZQB3AC0ATwBiAGoAZQBjAHQAKQA=",
+					"S-1-0-0", "-", "-", "0x0", `C:\Windows\System32\cmd.exe`, "S-1-16-12288"},
+			}},
+		},
+		{
+			Name:        "service-install",
+			Description: "Installation of a service (7045) running from a temporary folder",
+			Events: []Event{{
+				ID:   7045,
+				Type: eventlog.EVENTLOG_INFORMATION_TYPE,
+				Strings: []string{"updsvc", `C:\Users\Public\AppData\Local\Temp\updsvc.exe`,
+					"user mode service", "auto start", "LocalSystem"},
+			}},
+		},
+		{
+			Name:        "log-cleared",
+			Description: "Clearing of the audit log (1102)",
+			Events: []Event{{
+				ID:      1102,
+				Type:    eventlog.EVENTLOG_AUDIT_SUCCESS,
+				Strings: []string{"S-1-5-21-1000", "labuser", host, "0x3e7"},
+			}},
+		},
+	}
+}
+
+// FindScenario returns the built-in scenario with the given name
+func FindScenario(name string) (Scenario, error) {
+	var names []string
+	for _, scenario := range Scenarios() {
+		if strings.EqualFold(scenario.Name, name) {
+			return scenario, nil
+		}
+		names = append(names, scenario.Name)
+	}
+	return Scenario{}, fmt.Errorf("unknown scenario %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// LoadCorpus reads up to limit events (0 = all) from a saved JSONL collection, such
+// as an events.jsonl of a fleet run or a store segment, for replay
+func LoadCorpus(path string, limit int) ([]Event, error) {
+	var events []Event
+	err := store.ScanFile(path, func(event eventlog.EventLogData) error {
+		events = append(events, Event{
+			ID:       event.EventID,
+			Type:     event.EventType,
+			Category: event.EventCategory,
+			Strings:  event.Strings,
+			Data:     event.Data,
+		})
+		if limit > 0 && len(events) >= limit {
+			return store.ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,43 @@
+package eventlog_test
+
+import (
+	"testing"
+
+	"lemita/datn/pkg/benchmark"
+	"lemita/datn/pkg/eventlog"
+)
+
+// Benchmarks over benchmark.DefaultEvents synthetic events, the same cases datn
+// bench runs; see make bench for comparing a change with benchstat
+
+func BenchmarkParseRecords(b *testing.B) {
+	records := eventlog.EncodeRecords(benchmark.Events(benchmark.DefaultEvents))
+	b.SetBytes(int64(len(records)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		eventlog.ParseRecords("Security", records)
+	}
+}
+
+func BenchmarkNamedData(b *testing.B) {
+	events := benchmark.Events(benchmark.DefaultEvents)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, event := range events {
+			eventlog.NamedData(event.Channel, event)
+		}
+	}
+}
+
+func BenchmarkTypedFields(b *testing.B) {
+	events := benchmark.Events(benchmark.DefaultEvents)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, event := range events {
+			eventlog.TypedFields(event)
+		}
+	}
+}
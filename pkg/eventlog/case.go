@@ -0,0 +1,22 @@
+package eventlog
+
+import "fmt"
+
+// Case associates a collection with the incident it belongs to; it is recorded on
+// every event, report header and run summary of the collection
+type Case struct {
+	ID      string `json:"id"`
+	Analyst string `json:"analyst,omitempty"`
+	Notes   string `json:"notes,omitempty"`
+}
+
+// String renders the case for report headers, e.g. "IR-2024-017 (analyst: jdoe)"
+func (c *Case) String() string {
+	if c == nil {
+		return ""
+	}
+	if c.Analyst == "" {
+		return c.ID
+	}
+	return fmt.Sprintf("%s (analyst: %s)", c.ID, c.Analyst)
+}
@@ -0,0 +1,228 @@
+package eventlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+
+	"lemita/datn/pkg/dpapi"
+	"lemita/datn/pkg/instance"
+)
+
+// checkpointRoots are the registry hives a checkpoint location may name
+var checkpointRoots = map[string]registry.Key{
+	"HKLM":               registry.LOCAL_MACHINE,
+	"HKEY_LOCAL_MACHINE": registry.LOCAL_MACHINE,
+	"HKCU":               registry.CURRENT_USER,
+	"HKEY_CURRENT_USER":  registry.CURRENT_USER,
+}
+
+// checkpointUpdatedValue holds the time of the last save in a registry checkpoint
+// key; every other value is the DWORD record number of the channel it is named after
+const checkpointUpdatedValue = "(updated)"
+
+// Checkpoints remembers the last collected record number per channel so that
+// repeated reads only return new events. They are kept in a JSON file encrypted
+// with the machine-bound DPAPI key, like the spool, or, when the location names a
+// registry key such as HKLM\SOFTWARE\datn\Checkpoints, as values of that key.
+// Registry values stay readable DWORDs: the key's ACL protects them, and they
+// hold record numbers only, none of the event data the spool holds.
+type Checkpoints struct {
+	path    string
+	root    registry.Key // Hive of a registry location; 0 for a file
+	subkey  string
+	mu      sync.Mutex
+	Records map[string]uint32 `json:"records"`
+	Updated time.Time         `json:"updated"`
+}
+
+// CheckpointKey returns the name a channel's checkpoint is kept under. Record
+// numbers are only meaningful on the computer that assigned them, so the channels
+// of a remote server are prefixed with \\server\, which no channel name starts
+// with; local channels keep their plain names.
+func CheckpointKey(server, channel string) string {
+	if server == "" {
+		return channel
+	}
+	return `\\` + strings.ToLower(server) + `\` + channel
+}
+
+// RegistryCheckpoints reports whether a checkpoint location names a registry key
+// rather than a file
+func RegistryCheckpoints(path string) bool {
+	root, _, _ := strings.Cut(path, `\`)
+	_, ok := checkpointRoots[strings.ToUpper(root)]
+	return ok
+}
+
+// LockCheckpoints takes the instance lock of the checkpoints at path, so two runs
+// never resume from, and overwrite, the same checkpoints. It returns
+// instance.ErrRunning when another process holds the lock.
+func LockCheckpoints(path string) (*instance.Lock, error) {
+	return instance.Acquire(strings.ToLower(checkpointLocation(path)))
+}
+
+// checkpointLocation returns the canonical form of a checkpoint location, so every
+// spelling of it maps to one lock: the absolute path of a file, or a registry key
+// with its hive abbreviated and no surrounding backslashes
+func checkpointLocation(path string) string {
+	if RegistryCheckpoints(path) {
+		root, subkey, _ := strings.Cut(path, `\`)
+		hive := "HKLM"
+		if checkpointRoots[strings.ToUpper(root)] == registry.CURRENT_USER {
+			hive = "HKCU"
+		}
+		return hive + `\` + strings.Trim(subkey, `\`)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// LoadCheckpoints reads the checkpoints at path, a file or a registry key. A
+// missing file or key yields an empty set.
+func LoadCheckpoints(path string) (*Checkpoints, error) {
+	cp := &Checkpoints{path: path, Records: map[string]uint32{}}
+	if RegistryCheckpoints(path) {
+		root, subkey, _ := strings.Cut(path, `\`)
+		cp.root, cp.subkey = checkpointRoots[strings.ToUpper(root)], subkey
+		return cp, cp.loadKey()
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint file %s: %v", path, err)
+	}
+
+	// Files written before checkpoints were encrypted are plain JSON; they are
+	// encrypted on the next save
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		if data, err = dpapi.Unprotect(data); err != nil {
+			return nil, fmt.Errorf("failed to decrypt checkpoint file %s: %v", path, err)
+		}
+	}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint file %s: %v", path, err)
+	}
+	if cp.Records == nil {
+		cp.Records = map[string]uint32{}
+	}
+
+	return cp, nil
+}
+
+// loadKey reads the checkpoints from the registry key
+func (c *Checkpoints) loadKey() error {
+	k, err := registry.OpenKey(c.root, c.subkey, registry.QUERY_VALUE)
+	if err == registry.ErrNotExist {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open checkpoint key %s: %v", c.path, err)
+	}
+	defer k.Close()
+	names, err := k.ReadValueNames(-1)
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint key %s: %v", c.path, err)
+	}
+	for _, name := range names {
+		if name == checkpointUpdatedValue {
+			if updated, _, err := k.GetStringValue(name); err == nil {
+				c.Updated, _ = time.Parse(time.RFC3339Nano, updated)
+			}
+			continue
+		}
+		if record, _, err := k.GetIntegerValue(name); err == nil {
+			c.Records[name] = uint32(record)
+		}
+	}
+	return nil
+}
+
+// Get returns the last collected record number of a channel (0 if none)
+func (c *Checkpoints) Get(channel string) uint32 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Records[channel]
+}
+
+// Set records the last collected record number of a channel
+func (c *Checkpoints) Set(channel string, record uint32) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Records[channel] = record
+}
+
+// Save writes the checkpoints: a file encrypted and atomically (write to a
+// temporary file, then rename), a registry key value by value
+func (c *Checkpoints) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Updated = time.Now()
+	if c.root != 0 {
+		return c.saveKey()
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoints: %v", err)
+	}
+	if data, err = dpapi.Protect(data); err != nil {
+		return fmt.Errorf("failed to encrypt checkpoints: %v", err)
+	}
+
+	if dir := filepath.Dir(c.path); dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create checkpoint directory %s: %v", dir, err)
+		}
+	}
+
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write checkpoint file: %v", err)
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to commit checkpoint file: %v", err)
+	}
+
+	return nil
+}
+
+// saveKey writes the checkpoints to the registry key, creating it if needed
+func (c *Checkpoints) saveKey() error {
+	k, _, err := registry.CreateKey(c.root, c.subkey, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint key %s: %v", c.path, err)
+	}
+	defer k.Close()
+	for channel, record := range c.Records {
+		if err := k.SetDWordValue(channel, record); err != nil {
+			return fmt.Errorf("failed to write checkpoint of %s to %s: %v", channel, c.path, err)
+		}
+	}
+	if err := k.SetStringValue(checkpointUpdatedValue, c.Updated.Format(time.RFC3339Nano)); err != nil {
+		return fmt.Errorf("failed to write checkpoint key %s: %v", c.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package eventlog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointLocation(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every spelling of a location must map to the same lock
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"datn-checkpoints.json", filepath.Join(dir, "datn-checkpoints.json")},
+		{`.\sub\..\datn-checkpoints.json`, filepath.Join(dir, "datn-checkpoints.json")},
+		{filepath.Join(dir, "datn-checkpoints.json"), filepath.Join(dir, "datn-checkpoints.json")},
+		{`HKLM\SOFTWARE\datn\Checkpoints`, `HKLM\SOFTWARE\datn\Checkpoints`},
+		{`HKEY_LOCAL_MACHINE\SOFTWARE\datn\Checkpoints\`, `HKLM\SOFTWARE\datn\Checkpoints`},
+		{`hkcu\Software\datn`, `HKCU\Software\datn`},
+	}
+	for _, tt := range tests {
+		if got := checkpointLocation(tt.path); got != tt.want {
+			t.Errorf("checkpointLocation(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
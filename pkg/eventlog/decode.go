@@ -0,0 +1,82 @@
+package eventlog
+
+import (
+	"encoding/binary"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// recordDecoder converts the UTF-16LE strings of event records. One scratch buffer is
+// reused for every conversion, and source names, which repeat on nearly every record,
+// are shared, so parsing allocates little beyond the insertion strings themselves.
+type recordDecoder struct {
+	scratch []byte
+	sources map[string]string
+}
+
+// text decodes the UTF-16LE code units in b
+func (d *recordDecoder) text(b []byte) string {
+	d.scratch = appendUTF16(d.scratch[:0], b)
+	return string(d.scratch)
+}
+
+// source decodes a source name, returning the copy shared by earlier records
+func (d *recordDecoder) source(b []byte) string {
+	d.scratch = appendUTF16(d.scratch[:0], b)
+	if name, ok := d.sources[string(d.scratch)]; ok {
+		return name
+	}
+	name := string(d.scratch)
+	if d.sources == nil {
+		d.sources = map[string]string{}
+	}
+	d.sources[name] = name
+	return name
+}
+
+// appendUTF16 appends the UTF-8 encoding of the UTF-16LE code units in b to dst,
+// reading the units straight from the byte slice so the record buffer needs no
+// alignment or unsafe conversion. Unpaired surrogates become U+FFFD, a trailing odd
+// byte is ignored.
+func appendUTF16(dst, b []byte) []byte {
+	for i := 0; i+1 < len(b); i += 2 {
+		r := rune(binary.LittleEndian.Uint16(b[i:]))
+		switch {
+		case r < utf8.RuneSelf:
+			dst = append(dst, byte(r))
+			continue
+		case utf16.IsSurrogate(r):
+			if i+3 < len(b) {
+				if decoded := utf16.DecodeRune(r, rune(binary.LittleEndian.Uint16(b[i+2:]))); decoded != utf8.RuneError {
+					r = decoded
+					i += 2
+				} else {
+					r = utf8.RuneError
+				}
+			} else {
+				r = utf8.RuneError
+			}
+		}
+		dst = utf8.AppendRune(dst, r)
+	}
+	return dst
+}
+
+// sidString formats a binary SID as S-R-I-S-S..., or returns "" when b is not a
+// well-formed SID
+func sidString(b []byte) string {
+	if len(b) < 8 || b[0] != 1 || len(b) != 8+4*int(b[1]) {
+		return ""
+	}
+	var authority uint64
+	for _, c := range b[2:8] {
+		authority = authority<<8 | uint64(c)
+	}
+	s := append([]byte("S-1-"), strconv.FormatUint(authority, 10)...)
+	for i := 8; i < len(b); i += 4 {
+		s = append(s, '-')
+		s = strconv.AppendUint(s, uint64(binary.LittleEndian.Uint32(b[i:])), 10)
+	}
+	return string(s)
+}
@@ -0,0 +1,125 @@
+package eventlog
+
+import (
+	"fmt"
+	"slices"
+	"syscall"
+	"unsafe"
+)
+
+// estimateSampleSize is how many bytes of the newest records are read to measure
+// the average record size of a channel
+const estimateSampleSize = 64 * 1024
+
+// SizeEstimate is the expected size of a channel's share of the report
+type SizeEstimate struct {
+	Channel     string
+	Records     uint32 // Matching records in the collection window, capped by the event limit
+	AverageSize int    // Average size of the newest records in bytes
+}
+
+// Bytes returns the estimated output size. Records are UTF-16 on disk and the
+// report is UTF-8 with field labels, which roughly cancel out.
+func (e SizeEstimate) Bytes() int64 {
+	return int64(e.Records) * int64(e.AverageSize)
+}
+
+// EstimateSize estimates the output of collecting a channel with opts.Server,
+// opts.Since, opts.AfterRecord, opts.EventIDs and opts.MaxEvents. Records are
+// counted from the checkpoint or the start of the window, whichever is later, and
+// scaled by the share of the newest records that pass the event ID filter.
+func EstimateSize(logName string, opts CollectOptions) (SizeEstimate, error) {
+	estimate := SizeEstimate{Channel: logName}
+	server := opts.Server
+
+	advapi32 := syscall.NewLazyDLL("advapi32.dll")
+	openEventLog := advapi32.NewProc("OpenEventLogW")
+	closeEventLog := advapi32.NewProc("CloseEventLog")
+	readEventLog := advapi32.NewProc("ReadEventLogW")
+	getNumberOfEventLogRecords := advapi32.NewProc("GetNumberOfEventLogRecords")
+	getOldestEventLogRecord := advapi32.NewProc("GetOldestEventLogRecord")
+
+	serverNameUTF16, err := syscall.UTF16PtrFromString(server)
+	if err != nil {
+		return estimate, fmt.Errorf("failed to convert server name to UTF16: %v", err)
+	}
+	logNameUTF16, err := syscall.UTF16PtrFromString(logName)
+	if err != nil {
+		return estimate, fmt.Errorf("failed to convert log name to UTF16: %v", err)
+	}
+	handle, _, err := openEventLog.Call(uintptr(unsafe.Pointer(serverNameUTF16)), uintptr(unsafe.Pointer(logNameUTF16)))
+	if handle == 0 {
+		return estimate, fmt.Errorf("failed to open event log: %v", err)
+	}
+	defer closeEventLog.Call(handle)
+
+	var state LogState
+	if ret, _, _ := getNumberOfEventLogRecords.Call(handle, uintptr(unsafe.Pointer(&state.Count))); ret == 0 {
+		return estimate, fmt.Errorf("failed to get number of event log records")
+	}
+	if ret, _, _ := getOldestEventLogRecord.Call(handle, uintptr(unsafe.Pointer(&state.Oldest))); ret == 0 {
+		return estimate, fmt.Errorf("failed to get oldest event log record")
+	}
+	if state.Count == 0 {
+		return estimate, nil
+	}
+
+	first := state.Oldest
+	if !opts.Since.IsZero() {
+		if first, err = findFirstRecord(readEventLog, handle, state.Oldest, state.Newest(), uint32(opts.Since.Unix())); err != nil {
+			return estimate, err
+		}
+	}
+	// A checkpoint past the newest record belongs to a log cleared since, which is read whole
+	if opts.AfterRecord >= first && opts.AfterRecord < state.Newest() {
+		first = opts.AfterRecord + 1
+	} else if opts.AfterRecord == state.Newest() {
+		return estimate, nil
+	}
+	estimate.Records = state.Newest() - first + 1
+
+	// Average the newest records, which are the most representative of what is logged now
+	buffer := make([]byte, estimateSampleSize)
+	var bytesRead, bytesNeeded uint32
+	ret, _, err := readEventLog.Call(
+		handle,
+		uintptr(EVENTLOG_SEQUENTIAL_READ|EVENTLOG_BACKWARDS_READ),
+		0,
+		uintptr(unsafe.Pointer(&buffer[0])),
+		uintptr(len(buffer)),
+		uintptr(unsafe.Pointer(&bytesRead)),
+		uintptr(unsafe.Pointer(&bytesNeeded)),
+	)
+	if ret == 0 {
+		if err.(syscall.Errno) == syscall.ERROR_INSUFFICIENT_BUFFER {
+			estimate.AverageSize = int(bytesNeeded) // A single record larger than the sample
+			estimate.cap(opts.MaxEvents)
+			return estimate, nil
+		}
+		return estimate, fmt.Errorf("failed to read event log: %v", err)
+	}
+	records, matching := 0, 0
+	for offset := uint32(0); offset+sizeof_EVENTLOGRECORD <= bytesRead; records++ {
+		record := (*EVENTLOGRECORD)(unsafe.Pointer(&buffer[offset]))
+		if record.Length == 0 {
+			break
+		}
+		if len(opts.EventIDs) == 0 || slices.Contains(opts.EventIDs, record.EventID&0xFFFF) {
+			matching++
+		}
+		offset += record.Length
+	}
+	if records > 0 {
+		estimate.AverageSize = int(bytesRead) / records
+		estimate.Records = uint32(uint64(estimate.Records) * uint64(matching) / uint64(records))
+	}
+	estimate.cap(opts.MaxEvents)
+	return estimate, nil
+}
+
+// cap limits the records to the event limit (0 = no limit)
+func (e *SizeEstimate) cap(maxEvents int) {
+	if maxEvents > 0 && e.Records > uint32(maxEvents) {
+		e.Records = uint32(maxEvents)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
@@ -11,6 +12,7 @@ import (
 const (
 	ERROR_SUCCESS       = 0
 	ERROR_NO_MORE_ITEMS = 259
+	ERROR_TIMEOUT       = 1460
 
 	EVENTLOG_SEQUENTIAL_READ = 0x0001
 	EVENTLOG_BACKWARDS_READ  = 0x0008
@@ -48,18 +50,38 @@ type EVENTLOGRECORD struct {
 // Size of the EVENTLOGRECORD structure - used for buffer management
 const sizeof_EVENTLOGRECORD = 56 // Sum of all fields sizes
 
+// EVENTLOGRECORD only holds fixed-size integers, so its layout is identical on
+// 386, amd64 and arm64; fail the build if that ever stops being true
+var (
+	_ [unsafe.Sizeof(EVENTLOGRECORD{}) - sizeof_EVENTLOGRECORD]struct{}
+	_ [sizeof_EVENTLOGRECORD - unsafe.Sizeof(EVENTLOGRECORD{})]struct{}
+)
+
 // EventLogData represents a processed event log entry
 type EventLogData struct {
-	RecordNumber  uint32
-	TimeGenerated uint32
-	TimeWritten   uint32
-	EventID       uint32
-	EventType     uint16
-	EventCategory uint16
-	SourceName    string
-	ComputerName  string
-	Strings       []string
-	Data          []byte
+	UID           string            `json:"uid,omitempty"` // Stable identifier, see StableID
+	Channel       string            `json:"channel"`
+	RecordNumber  uint32            `json:"record_number"`
+	TimeGenerated uint32            `json:"time_generated"`
+	TimeWritten   uint32            `json:"time_written"`
+	EventID       uint32            `json:"event_id"`
+	EventType     uint16            `json:"event_type"`
+	EventCategory uint16            `json:"event_category"`
+	SourceName    string            `json:"source"`
+	ComputerName  string            `json:"computer"`
+	UserSid       string            `json:"user_sid,omitempty"`    // Security context the event was logged in, when the source records one
+	UserName      string            `json:"user_name,omitempty"`   // UserSid resolved with LookupAccountSidW; empty when it can't be resolved
+	UserDomain    string            `json:"user_domain,omitempty"` // Domain of UserName
+	Strings       []string          `json:"strings,omitempty"`
+	Message       string            `json:"message,omitempty"` // Rendered description, only with CollectOptions.Locale, a MessageRenderer or MessageFiles
+	Data          []byte            `json:"data,omitempty"`
+	Fields        map[string]string `json:"fields,omitempty"`      // Insertion strings by EventData name, see NamedData
+	Tags          map[string]string `json:"tags,omitempty"`        // Static labels (customer, site, environment) set by the collector
+	Detections    []string          `json:"detections,omitempty"`  // Names of the detection rules that matched this event
+	Annotations   map[string]string `json:"annotations,omitempty"` // Values resolved by the collector, such as WFP filter names
+	Provenance    *Provenance       `json:"provenance,omitempty"`  // Where and how the event was collected
+	Case          *Case             `json:"case,omitempty"`        // Incident the collection belongs to
+	Notes         []Note            `json:"notes,omitempty"`       // Analyst labels and notes attached in the store, oldest first
 }
 
 // GetLocalComputerName retrieves the name of the local computer
@@ -85,8 +107,15 @@ func GetLocalComputerName() string {
 
 // GetSourceFromEvent extracts the source name from an event log record
 func GetSourceFromEvent(logName string, record *EVENTLOGRECORD, buffer []byte, offset uint32) string {
-	// First, try to extract from the buffer
-	sourceStart := offset + 8*4 // Start of strings after the record header
+	var d recordDecoder
+	return d.sourceFromEvent(logName, buffer, offset)
+}
+
+// sourceFromEvent is GetSourceFromEvent with the decoder of the current read
+func (d *recordDecoder) sourceFromEvent(logName string, buffer []byte, offset uint32) string {
+	// First, try to extract from the buffer; the source name immediately
+	// follows the fixed-size record header
+	sourceStart := offset + sizeof_EVENTLOGRECORD
 	sourceEnd := sourceStart
 
 	// Make sure we don't go out of bounds
@@ -101,7 +130,7 @@ func GetSourceFromEvent(logName string, record *EVENTLOGRECORD, buffer []byte, o
 	// Safe string conversion with length check
 	strLen := (sourceEnd - sourceStart) / 2
 	if strLen > 0 && strLen < 1024 {
-		sourceName := syscall.UTF16ToString((*[1024]uint16)(unsafe.Pointer(&buffer[sourceStart]))[:strLen])
+		sourceName := d.source(buffer[sourceStart:sourceEnd])
 		if sourceName != "" {
 			return sourceName
 		}
@@ -126,21 +155,16 @@ func GetSourceFromEvent(logName string, record *EVENTLOGRECORD, buffer []byte, o
 	return "EventLog"
 }
 
-// WindowsTimeToTime converts a Windows timestamp to human-readable format
+// EventTime converts the TimeGenerated or TimeWritten of an event, seconds since
+// 1970-01-01 UTC, to a time in UTC
+func EventTime(windowsTime uint32) time.Time {
+	return time.Unix(int64(windowsTime), 0).UTC()
+}
+
+// WindowsTimeToTime formats the TimeGenerated or TimeWritten of an event as
+// YYYY-MM-DD HH:MM:SS in UTC
 func WindowsTimeToTime(windowsTime uint32) string {
-	// Windows time is number of seconds since 1970-01-01 UTC
-	unixTime := int64(windowsTime)
-	t := syscall.NsecToTimeval(unixTime * 1e9)
-
-	// Format: YYYY-MM-DD HH:MM:SS
-	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d",
-		1970+t.Sec/31536000,
-		(t.Sec%31536000)/2592000+1,
-		((t.Sec%31536000)%2592000)/86400+1,
-		((t.Sec%31536000)%2592000)%86400/3600,
-		(((t.Sec%31536000)%2592000)%86400)%3600/60,
-		(((t.Sec%31536000)%2592000)%86400)%3600%60,
-	)
+	return EventTime(windowsTime).Format("2006-01-02 15:04:05")
 }
 
 // GetEventTypeName returns a human-readable name for an event type
@@ -163,10 +187,96 @@ func GetEventTypeName(eventType uint16) string {
 	}
 }
 
+// CollectOptions controls how events are read from a channel
+type CollectOptions struct {
+	MaxEvents   int       // Maximum number of matching events to return (0 = no limit)
+	EventIDs    []uint32  // Only return these event IDs (empty = all)
+	Levels      []uint16  // Only return events of these types, e.g. EVENTLOG_ERROR_TYPE, see ParseLevels (empty = all)
+	AfterRecord uint32    // Only return events with a higher record number (0 = from the oldest record)
+	Server      string    // Remote computer to read from over RPC (empty = local computer)
+	Since       time.Time // Only return events generated at or after this time (zero = no limit)
+	MemoryLimit int64     // Spill events to a temporary file beyond this many bytes (0 = keep all in memory)
+	SpillDir    string    // Directory of the spill file (empty = the system temporary directory)
+	Locale      string    // Have WinRM render messages in this locale, e.g. en-US (empty = insertion strings only)
+	API         string    // APILegacy or APIWevt to force an API (empty or APIAuto = probe the channel, see ChannelAPI)
+	Deadline    time.Time // Stop reading at this time and return the events read so far (zero = no limit)
+}
+
+// CollectResult holds the events read from a channel and how far the read got
+type CollectResult struct {
+	Events     []EventLogData
+	LastRecord uint32       // Highest record number examined, whether or not it matched the filters
+	OldestTime time.Time    // Oldest retained record; set by every reader when opts.Since is set
+	Timings    StageTimings // Open, read and parse times; the caller fills in format and write
+	Spill      *Spill       // Events moved to disk once opts.MemoryLimit was exceeded; nil when all are in Events
+	TimedOut   bool         // The read stopped at opts.Deadline; LastRecord only covers the events returned
+	Reset      bool         // opts.AfterRecord was past the newest record: the log was cleared since, and was read from its oldest record
+}
+
+// Len returns the number of events read, in memory or spilled
+func (r *CollectResult) Len() int {
+	if r.Spill != nil {
+		return r.Spill.Len() + len(r.Events)
+	}
+	return len(r.Events)
+}
+
+// Each passes the events to fn, in one batch when they are held in memory and in
+// batches of SpillBatchSize read back from the spill file otherwise
+func (r *CollectResult) Each(fn func([]EventLogData)) error {
+	if r.Spill == nil {
+		fn(r.Events)
+		return nil
+	}
+	return r.Spill.Each(SpillBatchSize, fn)
+}
+
+// Close removes the spill file, if any
+func (r *CollectResult) Close() error {
+	if r.Spill == nil {
+		return nil
+	}
+	return r.Spill.Close()
+}
+
+// Coverage compares the requested window with the records the channel still retains
+func (r *CollectResult) Coverage(channel string, since time.Time) Coverage {
+	return Coverage{Channel: channel, Requested: since, Oldest: r.OldestTime}
+}
+
 // CollectWindowsEventLogs retrieves events from the specified Windows Event Log channel
 func CollectWindowsEventLogs(logName string, maxEvents int, specificEventIDs []uint32) ([]EventLogData, error) {
-	// Get local computer name for fallback
-	localComputerName := GetLocalComputerName()
+	result, err := CollectWithOptions(logName, CollectOptions{
+		MaxEvents: maxEvents,
+		EventIDs:  specificEventIDs,
+	})
+	if result == nil {
+		return nil, err
+	}
+	return result.Events, err
+}
+
+// CollectWithOptions retrieves events from the specified Windows Event Log channel.
+// When opts.AfterRecord is set, reading starts right after that record so repeated
+// calls only return new events. Manifest-based channels are read with EvtQuery,
+// see opts.API.
+func CollectWithOptions(logName string, opts CollectOptions) (*CollectResult, error) {
+	if resolveAPI(opts.Server, logName, opts.API) == APIWevt {
+		return collectEvt(logName, opts)
+	}
+
+	maxEvents := opts.MaxEvents
+	specificEventIDs := opts.EventIDs
+	result := &CollectResult{LastRecord: opts.AfterRecord}
+	result.Timings.Channel = logName
+	result.Timings.API = APIReadEventLog
+	start := time.Now()
+
+	// Get the computer name recorded on every event
+	computerName := GetLocalComputerName()
+	if opts.Server != "" {
+		computerName = opts.Server
+	}
 
 	// Load the required DLLs
 	advapi32 := syscall.NewLazyDLL("advapi32.dll")
@@ -176,6 +286,7 @@ func CollectWindowsEventLogs(logName string, maxEvents int, specificEventIDs []u
 	closeEventLog := advapi32.NewProc("CloseEventLog")
 	readEventLog := advapi32.NewProc("ReadEventLogW")
 	getNumberOfEventLogRecords := advapi32.NewProc("GetNumberOfEventLogRecords")
+	getOldestEventLogRecord := advapi32.NewProc("GetOldestEventLogRecord")
 
 	// Convert logName to UTF16
 	logNameUTF16, err := syscall.UTF16PtrFromString(logName)
@@ -185,7 +296,10 @@ func CollectWindowsEventLogs(logName string, maxEvents int, specificEventIDs []u
 
 	// Try to open the event log
 	var handle uintptr
-	serverNameUTF16, _ := syscall.UTF16PtrFromString("")
+	serverNameUTF16, err := syscall.UTF16PtrFromString(opts.Server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert server name to UTF16: %v", err)
+	}
 	ret, _, err := openEventLog.Call(
 		uintptr(unsafe.Pointer(serverNameUTF16)),
 		uintptr(unsafe.Pointer(logNameUTF16)),
@@ -197,6 +311,9 @@ func CollectWindowsEventLogs(logName string, maxEvents int, specificEventIDs []u
 		if err.(syscall.Errno) == syscall.ERROR_FILE_NOT_FOUND {
 			return nil, fmt.Errorf("event log '%s' not found - this channel may not be available on this system", logName)
 		}
+		if opts.Server != "" {
+			return nil, &RemoteError{Server: opts.Server, Err: err}
+		}
 		return nil, fmt.Errorf("failed to open event log: %v", err)
 	}
 	handle = ret
@@ -212,163 +329,215 @@ func CollectWindowsEventLogs(logName string, maxEvents int, specificEventIDs []u
 		return nil, fmt.Errorf("failed to get number of event log records")
 	}
 
-	// Limit the number of events to read
-	if maxEvents > 0 && int(totalRecords) > maxEvents {
-		totalRecords = uint32(maxEvents)
+	// Get the oldest record number to know where a resumed read can seek to
+	var oldestRecord uint32
+	ret, _, _ = getOldestEventLogRecord.Call(
+		handle,
+		uintptr(unsafe.Pointer(&oldestRecord)),
+	)
+	if ret == 0 {
+		return nil, fmt.Errorf("failed to get oldest event log record")
 	}
 
-	logs := make([]EventLogData, 0, totalRecords)
+	// Record numbers restart when a log is cleared, so a checkpoint past the newest
+	// record was taken before the log was cleared: everything in it is unread
+	afterRecord := opts.AfterRecord
+	if afterRecord > 0 && afterRecord >= oldestRecord+totalRecords {
+		result.Reset = true
+		result.LastRecord = 0
+		afterRecord = 0
+	}
 
-	// Read the events
-	bufferSize := uint32(4096) // Initial buffer size
-	buffer := make([]byte, bufferSize)
-	var bytesRead uint32
-	var bytesNeeded uint32
+	// Skip straight to the start of the requested window, noting how far back the
+	// log actually goes so a rollover inside the window can be reported
+	var since uint32
+	if !opts.Since.IsZero() && totalRecords > 0 {
+		since = uint32(opts.Since.Unix())
+		oldestTime, err := readRecordTime(readEventLog, handle, oldestRecord)
+		if err != nil {
+			return nil, err
+		}
+		result.OldestTime = time.Unix(int64(oldestTime), 0)
+		if oldestTime < since {
+			first, err := findFirstRecord(readEventLog, handle, oldestRecord, oldestRecord+totalRecords-1, since)
+			if err != nil {
+				return nil, err
+			}
+			afterRecord = max(afterRecord, first-1)
+		}
+	}
 
 	flags := uint32(EVENTLOG_SEQUENTIAL_READ | EVENTLOG_FORWARDS_READ)
+	seekRecord := uint32(0)
+	if afterRecord > 0 {
+		nextRecord := afterRecord + 1
+		if nextRecord >= oldestRecord+totalRecords {
+			// Nothing new since the last read
+			result.Events = []EventLogData{}
+			result.Timings.Open = time.Since(start)
+			return result, nil
+		}
+		if nextRecord > oldestRecord {
+			// Seek directly to the first unread record; if it was overwritten
+			// (log wrapped or cleared) read everything that is left instead
+			flags = EVENTLOG_SEEK_READ | EVENTLOG_FORWARDS_READ
+			seekRecord = nextRecord
+			totalRecords = oldestRecord + totalRecords - nextRecord
+		}
+	}
 
-	for len(logs) < int(totalRecords) {
-		ret, _, err = readEventLog.Call(
-			handle,
-			uintptr(flags),
-			0,
-			uintptr(unsafe.Pointer(&buffer[0])),
-			uintptr(bufferSize),
-			uintptr(unsafe.Pointer(&bytesRead)),
-			uintptr(unsafe.Pointer(&bytesNeeded)),
-		)
-
-		if ret == 0 {
-			errno := err.(syscall.Errno)
-			if errno == ERROR_NO_MORE_ITEMS {
-				// Reached end of log - this is normal, not an error
-				break
-			} else if errno == syscall.ERROR_INSUFFICIENT_BUFFER {
-				// Resize buffer and try again
-				bufferSize = bytesNeeded
-				buffer = make([]byte, bufferSize)
-				continue
+	// Limit the number of events to read
+	if maxEvents > 0 && int(totalRecords) > maxEvents {
+		totalRecords = uint32(maxEvents)
+	}
+	result.Timings.Open = time.Since(start)
+	start = time.Now()
+
+	capacity := totalRecords
+	if opts.MemoryLimit > 0 && capacity > SpillBatchSize {
+		capacity = SpillBatchSize
+	}
+	logs := make([]EventLogData, 0, capacity)
+	collected := 0 // Matching events, including those already spilled
+	var memory int64
+
+	// spillEvents moves the events held in memory to the spill file
+	spillEvents := func() error {
+		if result.Spill == nil {
+			spill, err := NewSpill(opts.SpillDir)
+			if err != nil {
+				return err
 			}
-			return logs, fmt.Errorf("error reading event log: %v", err)
+			result.Spill = spill
 		}
+		stampEvents(logs, logName, APIReadEventLog, computerName, opts.Server != "")
+		if err := result.Spill.Write(logs); err != nil {
+			return err
+		}
+		logs = logs[:0]
+		memory = 0
+		return nil
+	}
 
-		// Process the buffer which may contain multiple event records
-		offset := uint32(0)
-		for offset < bytesRead {
-			// Safety check - make sure we have at least enough space for the record header
-			if offset+sizeof_EVENTLOGRECORD > bytesRead {
-				break
-			}
+	// finish stamps the events and completes the spill file, if the read needed one
+	finish := func() error {
+		defer func() {
+			result.Timings.Parse = time.Since(start) - result.Timings.Read
+		}()
+		if result.Spill == nil {
+			stampEvents(logs, logName, APIReadEventLog, computerName, opts.Server != "")
+			result.Events = logs
+			return nil
+		}
+		err := spillEvents()
+		if err == nil {
+			err = result.Spill.finish()
+		}
+		if err != nil {
+			result.Close()
+			result.Spill = nil
+		}
+		return err
+	}
 
-			record := (*EVENTLOGRECORD)(unsafe.Pointer(&buffer[offset]))
+	if totalRecords == 0 {
+		if err := finish(); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
 
-			// Basic validation - check if record length is reasonable
-			if record.Length < sizeof_EVENTLOGRECORD || record.Length > bytesRead-offset {
-				// Invalid record length, skip to next aligned position or end
-				offset += 8 // Try to realign on 8-byte boundary
-				if offset >= bytesRead {
-					break
-				}
-				continue
+	// One goroutine reads record buffers while a pool of workers decodes and filters
+	// them; the parsed buffers are put back in read order below
+	parser := &recordParser{
+		logName:      logName,
+		computerName: computerName,
+		afterRecord:  afterRecord,
+		since:        since,
+		eventIDs:     specificEventIDs,
+		levels:       opts.Levels,
+	}
+	workers := parseWorkers()
+	free := make(chan []byte, 2*workers)
+	for i := 0; i < cap(free); i++ {
+		free <- make([]byte, readBufferSize)
+	}
+	chunks := make(chan readChunk, workers)
+	done := make(chan struct{})
+	var readErr error
+	go func() {
+		result.Timings.Read, readErr = readRecords(readEventLog, handle, flags, seekRecord, free, chunks, done)
+		close(chunks)
+	}()
+	parsed := parser.parseAll(workers, chunks, free)
+
+	pending := map[int]parsedChunk{}
+	next := 0
+	stopped := false
+	var spillErr, parseErr error
+	for chunk := range parsed {
+		if !stopped && !opts.Deadline.IsZero() && time.Now().After(opts.Deadline) {
+			result.TimedOut = true
+			stopped = true
+			close(done)
+		}
+		pending[chunk.seq] = chunk
+		for !stopped {
+			chunk, ok := pending[next]
+			if !ok {
+				break
 			}
-
-			// Extract event data
-			event := EventLogData{
-				RecordNumber:  record.RecordNumber,
-				TimeGenerated: record.TimeGenerated,
-				TimeWritten:   record.TimeWritten,
-				EventID:       record.EventID & 0xFFFF, // Low 16 bits
-				EventType:     record.EventType,
-				EventCategory: record.EventCategory,
-				SourceName:    GetSourceFromEvent(logName, record, buffer, offset),
-				ComputerName:  localComputerName, // Use the local computer name
+			delete(pending, next)
+			next++
+			if chunk.err != nil {
+				parseErr = chunk.err
+				stopped = true
+				close(done)
+				break
 			}
 
-			// Get strings - with bounds checking
-			event.Strings = make([]string, 0, record.NumStrings)
-			if record.NumStrings > 0 && record.StringOffset > 0 {
-				stringsPtr := offset + record.StringOffset
-
-				// Safety check - make sure StringOffset is within buffer bounds
-				if stringsPtr < uint32(len(buffer)) {
-					for i := uint16(0); i < record.NumStrings; i++ {
-						// Check if we're still within buffer
-						if stringsPtr >= uint32(len(buffer)) {
+			lastRecord := chunk.lastRecord
+			for _, event := range chunk.events {
+				logs = append(logs, event)
+				collected++
+
+				// Move the events to disk once they outgrow the memory limit
+				if opts.MemoryLimit > 0 {
+					memory += eventSize(&event)
+					if memory > opts.MemoryLimit {
+						if spillErr = spillEvents(); spillErr != nil {
+							stopped = true
 							break
 						}
-
-						strStart := stringsPtr
-						strEnd := strStart
-
-						// Find null terminator with bounds checking
-						for strEnd+1 < uint32(len(buffer)) && (buffer[strEnd] != 0 || buffer[strEnd+1] != 0) {
-							strEnd += 2
-							// Safety check for overly long strings
-							if strEnd-strStart > 32768 { // Max reasonable string length
-								break
-							}
-						}
-
-						// Safe string conversion
-						strLen := (strEnd - strStart) / 2
-						if strLen > 0 && strLen < 16384 {
-							str := syscall.UTF16ToString((*[16384]uint16)(unsafe.Pointer(&buffer[strStart]))[:strLen])
-							event.Strings = append(event.Strings, str)
-						}
-
-						// Move to next string (if any)
-						if strEnd+2 >= uint32(len(buffer)) {
-							break // End of buffer
-						}
-						stringsPtr = strEnd + 2
 					}
 				}
-			}
-
-			// Get binary data if present - with bounds checking
-			if record.DataLength > 0 && record.DataOffset > 0 {
-				dataStart := offset + record.DataOffset
-
-				// Make sure offsets are within buffer bounds
-				if dataStart < uint32(len(buffer)) {
-					dataEnd := dataStart + record.DataLength
 
-					// Ensure we don't go beyond buffer
-					if dataEnd > uint32(len(buffer)) {
-						dataEnd = uint32(len(buffer))
-					}
-
-					if dataEnd > dataStart {
-						event.Data = make([]byte, dataEnd-dataStart)
-						copy(event.Data, buffer[dataStart:dataEnd])
-					}
+				// Records after the last returned event count as unread
+				if collected >= int(totalRecords) {
+					lastRecord = event.RecordNumber
+					stopped = true
+					break
 				}
 			}
-
-			// Filter by specific event IDs if provided
-			if specificEventIDs != nil && len(specificEventIDs) > 0 {
-				eventIDMatches := false
-				for _, id := range specificEventIDs {
-					if event.EventID == id {
-						eventIDMatches = true
-						break
-					}
-				}
-				if eventIDMatches {
-					logs = append(logs, event)
-				}
-			} else {
-				// No filtering, add all events
-				logs = append(logs, event)
+			if lastRecord > result.LastRecord {
+				result.LastRecord = lastRecord
 			}
-
-			offset += record.Length
-
-			if len(logs) >= int(totalRecords) {
-				break
+			if stopped {
+				close(done)
 			}
 		}
 	}
+	if spillErr != nil {
+		result.Close()
+		return nil, spillErr
+	}
+	if parseErr != nil {
+		result.Close()
+		return nil, parseErr
+	}
 
-	return logs, nil
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	return result, readErr
 }
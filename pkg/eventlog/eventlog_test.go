@@ -0,0 +1,25 @@
+package eventlog
+
+import "testing"
+
+func TestWindowsTimeToTime(t *testing.T) {
+	// The times a year of 365 days and months of 30 days got wrong: leap days, the
+	// ends of months and years, and the last second a uint32 holds
+	tests := []struct {
+		seconds uint32
+		want    string
+	}{
+		{0, "1970-01-01 00:00:00"},
+		{951782400, "2000-02-29 00:00:00"},
+		{1709251199, "2024-02-29 23:59:59"},
+		{1717200000, "2024-06-01 00:00:00"},
+		{1735689599, "2024-12-31 23:59:59"},
+		{1735689600, "2025-01-01 00:00:00"},
+		{4294967295, "2106-02-07 06:28:15"},
+	}
+	for _, tt := range tests {
+		if got := WindowsTimeToTime(tt.seconds); got != tt.want {
+			t.Errorf("WindowsTimeToTime(%d) = %s, want %s", tt.seconds, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package eventlog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"lemita/datn/pkg/longpath"
+)
+
+var (
+	wevtapi  = syscall.NewLazyDLL("wevtapi.dll")
+	evtQuery = wevtapi.NewProc("EvtQuery")
+	evtNext  = wevtapi.NewProc("EvtNext")
+	evtClose = wevtapi.NewProc("EvtClose")
+
+	evtExportLog = wevtapi.NewProc("EvtExportLog")
+)
+
+const (
+	EVT_QUERY_FILE_PATH         = 0x2
+	EVT_QUERY_FORWARD_DIRECTION = 0x100
+	EVT_QUERY_REVERSE_DIRECTION = 0x200
+	EVT_EXPORTLOG_CHANNEL_PATH  = 0x1
+	INFINITE                    = 0xFFFFFFFF
+)
+
+// evtNextBatch is the number of event handles requested per EvtNext call
+const evtNextBatch = 256
+
+// ExportCheck is the result of verifying an exported .evtx file
+type ExportCheck struct {
+	Path     string `json:"path"`
+	Records  int    `json:"records"`  // Records readable from the file
+	Expected int    `json:"expected"` // Records the channel held for the export query
+	SHA256   string `json:"sha256"`
+}
+
+// OK reports whether every exported record can be read back from the file
+func (c ExportCheck) OK() bool {
+	return c.Records == c.Expected
+}
+
+// String describes the check, e.g. "Security.evtx: 1200 of 1200 records"
+func (c ExportCheck) String() string {
+	return fmt.Sprintf("%s: %d of %d records (sha256 %s)", c.Path, c.Records, c.Expected, c.SHA256)
+}
+
+// ExportChannel exports the records of a local channel logged since since (zero =
+// all of them) to a new .evtx file at path with EvtExportLog, then verifies it.
+// The export stops at the newest record when it started, so records logged while
+// it runs don't count, and it isn't filtered by event ID, so the file can be
+// compared with the number of records the channel holds for the same query.
+func ExportChannel(channel string, since time.Time, path string) (ExportCheck, error) {
+	newest, err := newestRecord(channel)
+	if err != nil {
+		return ExportCheck{Path: path}, err
+	}
+	query := "*[System[(EventRecordID<=" + strconv.FormatUint(uint64(newest), 10) + ")"
+	if !since.IsZero() {
+		query += " and (TimeCreated[@SystemTime>='" + since.UTC().Format("2006-01-02T15:04:05.000Z") + "'])"
+	}
+	query += "]]"
+	expected, err := countRecords(channel, query, EVT_QUERY_CHANNEL_PATH)
+	if err != nil {
+		return ExportCheck{Path: path}, err
+	}
+
+	channelUTF16, err := syscall.UTF16PtrFromString(channel)
+	if err != nil {
+		return ExportCheck{Path: path}, fmt.Errorf("failed to convert channel name to UTF16: %v", err)
+	}
+	queryUTF16, _ := syscall.UTF16PtrFromString(query)
+	pathUTF16, err := syscall.UTF16PtrFromString(longpath.Fix(path))
+	if err != nil {
+		return ExportCheck{Path: path}, fmt.Errorf("failed to convert path to UTF16: %v", err)
+	}
+	ret, _, err := evtExportLog.Call(0, uintptr(unsafe.Pointer(channelUTF16)), uintptr(unsafe.Pointer(queryUTF16)),
+		uintptr(unsafe.Pointer(pathUTF16)), EVT_EXPORTLOG_CHANNEL_PATH)
+	if ret == 0 {
+		return ExportCheck{Path: path}, fmt.Errorf("failed to export %s: %v", channel, err)
+	}
+	return VerifyExport(path, expected)
+}
+
+// newestRecord returns the record number of the newest record of a local channel
+// (0 if it is empty)
+func newestRecord(channel string) (uint32, error) {
+	channelUTF16, err := syscall.UTF16PtrFromString(channel)
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert channel name to UTF16: %v", err)
+	}
+	queryUTF16, _ := syscall.UTF16PtrFromString("*")
+	results, _, err := evtQuery.Call(0, uintptr(unsafe.Pointer(channelUTF16)), uintptr(unsafe.Pointer(queryUTF16)),
+		EVT_QUERY_CHANNEL_PATH|EVT_QUERY_REVERSE_DIRECTION)
+	if results == 0 {
+		return 0, fmt.Errorf("failed to query %s: %v", channel, err)
+	}
+	defer evtClose.Call(results)
+
+	var event uintptr
+	var returned uint32
+	ret, _, err := evtNext.Call(results, 1, uintptr(unsafe.Pointer(&event)), INFINITE, 0, uintptr(unsafe.Pointer(&returned)))
+	if ret == 0 {
+		if err.(syscall.Errno) == ERROR_NO_MORE_ITEMS {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read the newest record of %s: %v", channel, err)
+	}
+	defer evtClose.Call(event)
+	xml, _, err := renderEventXML(event, make([]uint16, 4096))
+	if err != nil {
+		return 0, fmt.Errorf("failed to render the newest record of %s: %v", channel, err)
+	}
+	events, err := ParseEventXML([]byte("<Events>" + xml + "</Events>"))
+	if err != nil || len(events) == 0 {
+		return 0, fmt.Errorf("failed to parse the newest record of %s: %v", channel, err)
+	}
+	return events[0].RecordNumber, nil
+}
+
+// VerifyExport opens an exported .evtx file with EvtQuery, counts the records it
+// yields and hashes the file, so an export that was truncated or corrupted on disk
+// is caught before it is handed on. expected is the number of records the channel
+// held for the query the file was exported with.
+func VerifyExport(path string, expected int) (ExportCheck, error) {
+	check := ExportCheck{Path: path, Expected: expected}
+
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return check, err
+	}
+	check.SHA256 = sum
+
+	if check.Records, err = countRecords(longpath.Fix(path), "*", EVT_QUERY_FILE_PATH); err != nil {
+		return check, err
+	}
+	if !check.OK() {
+		return check, fmt.Errorf("export %s holds %d records, the channel held %d", path, check.Records, expected)
+	}
+	return check, nil
+}
+
+// countRecords returns the number of records EvtQuery reads for query from a local
+// channel or .evtx file, as selected by flags (EVT_QUERY_CHANNEL_PATH or
+// EVT_QUERY_FILE_PATH)
+func countRecords(path, query string, flags uintptr) (int, error) {
+	pathUTF16, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert path to UTF16: %v", err)
+	}
+	queryUTF16, err := syscall.UTF16PtrFromString(query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert query to UTF16: %v", err)
+	}
+
+	results, _, err := evtQuery.Call(
+		0, // local session
+		uintptr(unsafe.Pointer(pathUTF16)),
+		uintptr(unsafe.Pointer(queryUTF16)),
+		flags|EVT_QUERY_FORWARD_DIRECTION,
+	)
+	if results == 0 {
+		return 0, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer evtClose.Call(results)
+
+	count := 0
+	events := make([]uintptr, evtNextBatch)
+	for {
+		var returned uint32
+		ret, _, err := evtNext.Call(
+			results,
+			evtNextBatch,
+			uintptr(unsafe.Pointer(&events[0])),
+			INFINITE,
+			0,
+			uintptr(unsafe.Pointer(&returned)),
+		)
+		if ret == 0 {
+			if err.(syscall.Errno) == ERROR_NO_MORE_ITEMS {
+				return count, nil
+			}
+			return count, fmt.Errorf("failed to read %s after %d records: %v", path, count, err)
+		}
+		for _, event := range events[:returned] {
+			evtClose.Call(event)
+		}
+		count += int(returned)
+	}
+}
+
+// fileSHA256 returns the hex SHA-256 of a file
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
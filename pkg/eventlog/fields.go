@@ -0,0 +1,272 @@
+package eventlog
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fieldKey identifies the insertion string layout of one event
+type fieldKey struct {
+	Channel string
+	EventID uint32
+}
+
+// builtinFieldNames assigns EventData names to the positional insertion strings of
+// well-known events, so filters and structured output can refer to fields by name
+var builtinFieldNames = map[fieldKey][]string{
+	{"security", 4624}: {"SubjectUserSid", "SubjectUserName", "SubjectDomainName", "SubjectLogonId",
+		"TargetUserSid", "TargetUserName", "TargetDomainName", "TargetLogonId", "LogonType",
+		"LogonProcessName", "AuthenticationPackageName", "WorkstationName", "LogonGuid",
+		"TransmittedServices", "LmPackageName", "KeyLength", "ProcessId", "ProcessName",
+		"IpAddress", "IpPort", "ImpersonationLevel"},
+	{"security", 4625}: {"SubjectUserSid", "SubjectUserName", "SubjectDomainName", "SubjectLogonId",
+		"TargetUserSid", "TargetUserName", "TargetDomainName", "Status", "FailureReason",
+		"SubStatus", "LogonType", "LogonProcessName", "AuthenticationPackageName",
+		"WorkstationName", "TransmittedServices", "LmPackageName", "KeyLength", "ProcessId",
+		"ProcessName", "IpAddress", "IpPort"},
+	{"security", 4648}: {"SubjectUserSid", "SubjectUserName", "SubjectDomainName", "SubjectLogonId",
+		"LogonGuid", "TargetUserName", "TargetDomainName", "TargetLogonGuid", "TargetServerName",
+		"TargetInfo", "ProcessId", "ProcessName", "IpAddress", "IpPort"},
+	{"security", 4657}: {"SubjectUserSid", "SubjectUserName", "SubjectDomainName", "SubjectLogonId",
+		"ObjectName", "ObjectValueName", "HandleId", "OperationType", "OldValueType", "OldValue",
+		"NewValueType", "NewValue", "ProcessId", "ProcessName"},
+	{"security", 4672}: {"SubjectUserSid", "SubjectUserName", "SubjectDomainName", "SubjectLogonId",
+		"PrivilegeList"},
+	{"security", 4688}: {"SubjectUserSid", "SubjectUserName", "SubjectDomainName", "SubjectLogonId",
+		"NewProcessId", "NewProcessName", "TokenElevationType", "ProcessId", "CommandLine",
+		"TargetUserSid", "TargetUserName", "TargetDomainName", "TargetLogonId",
+		"ParentProcessName", "MandatoryLabel"},
+	{"security", 4698}: {"SubjectUserSid", "SubjectUserName", "SubjectDomainName", "SubjectLogonId",
+		"TaskName", "TaskContent", "ClientProcessStartKey", "ClientProcessId", "ParentProcessId",
+		"RpcCallClientLocality", "FQDN"},
+	{"security", 4699}: {"SubjectUserSid", "SubjectUserName", "SubjectDomainName", "SubjectLogonId",
+		"TaskName", "TaskContent", "ClientProcessStartKey", "ClientProcessId", "ParentProcessId",
+		"RpcCallClientLocality", "FQDN"},
+	{"security", 4719}: {"SubjectUserSid", "SubjectUserName", "SubjectDomainName", "SubjectLogonId",
+		"CategoryId", "SubcategoryId", "SubcategoryGuid", "AuditPolicyChanges"},
+	{"security", 4720}: {"TargetUserName", "TargetDomainName", "TargetSid", "SubjectUserSid",
+		"SubjectUserName", "SubjectDomainName", "SubjectLogonId"},
+	{"security", 4728}: {"MemberName", "MemberSid", "TargetUserName", "TargetDomainName",
+		"TargetSid", "SubjectUserSid", "SubjectUserName", "SubjectDomainName", "SubjectLogonId",
+		"PrivilegeList"},
+	{"security", 4729}: {"MemberName", "MemberSid", "TargetUserName", "TargetDomainName",
+		"TargetSid", "SubjectUserSid", "SubjectUserName", "SubjectDomainName", "SubjectLogonId",
+		"PrivilegeList"},
+	{"security", 4732}: {"MemberName", "MemberSid", "TargetUserName", "TargetDomainName",
+		"TargetSid", "SubjectUserSid", "SubjectUserName", "SubjectDomainName", "SubjectLogonId",
+		"PrivilegeList"},
+	{"security", 4733}: {"MemberName", "MemberSid", "TargetUserName", "TargetDomainName",
+		"TargetSid", "SubjectUserSid", "SubjectUserName", "SubjectDomainName", "SubjectLogonId",
+		"PrivilegeList"},
+	{"security", 4740}: {"TargetUserName", "TargetDomainName", "TargetSid", "SubjectUserSid",
+		"SubjectUserName", "SubjectDomainName", "SubjectLogonId"},
+	{"security", 4765}: {"SourceUserName", "SourceSid", "TargetUserName", "TargetDomainName", "TargetSid",
+		"SubjectUserSid", "SubjectUserName", "SubjectDomainName", "SubjectLogonId", "PrivilegeList", "SidList"},
+	{"security", 4766}: {"SourceUserName", "SourceSid", "TargetUserName", "TargetDomainName", "TargetSid",
+		"SubjectUserSid", "SubjectUserName", "SubjectDomainName", "SubjectLogonId", "PrivilegeList"},
+	{"security", 4767}: {"TargetUserName", "TargetDomainName", "TargetSid", "SubjectUserSid",
+		"SubjectUserName", "SubjectDomainName", "SubjectLogonId"},
+	{"security", 4756}: {"MemberName", "MemberSid", "TargetUserName", "TargetDomainName",
+		"TargetSid", "SubjectUserSid", "SubjectUserName", "SubjectDomainName", "SubjectLogonId",
+		"PrivilegeList"},
+	{"security", 4757}: {"MemberName", "MemberSid", "TargetUserName", "TargetDomainName",
+		"TargetSid", "SubjectUserSid", "SubjectUserName", "SubjectDomainName", "SubjectLogonId",
+		"PrivilegeList"},
+	{"security", 4886}: {"RequestId", "Requester", "Attributes"},
+	{"security", 4887}: {"RequestId", "Requester", "Attributes", "Disposition", "SubjectKeyIdentifier",
+		"Subject"},
+	{"security", 4899}: {"TemplateInternalName", "TemplateVersion", "TemplateSchemaVersion",
+		"TemplateOID", "TemplateDSObjectFQDN", "DCDNSName", "TemplateContent", "NewTemplateContent"},
+	{"security", 4900}: {"TemplateInternalName", "TemplateVersion", "TemplateSchemaVersion",
+		"TemplateOID", "TemplateDSObjectFQDN", "DCDNSName", "TemplateSecurityDescriptor",
+		"NewTemplateSecurityDescriptor"},
+	{"security", 5152}: {"ProcessId", "Application", "Direction", "SourceAddress", "SourcePort",
+		"DestAddress", "DestPort", "Protocol", "FilterRTID", "LayerName", "LayerRTID"},
+	{"security", 5156}: {"ProcessID", "Application", "Direction", "SourceAddress", "SourcePort",
+		"DestAddress", "DestPort", "Protocol", "FilterRTID", "LayerName", "LayerRTID",
+		"RemoteUserID", "RemoteMachineID"},
+	{"security", 5157}: {"ProcessID", "Application", "Direction", "SourceAddress", "SourcePort",
+		"DestAddress", "DestPort", "Protocol", "FilterRTID", "LayerName", "LayerRTID",
+		"RemoteUserID", "RemoteMachineID"},
+	{"system", 41}: {"BugcheckCode", "BugcheckParameter1", "BugcheckParameter2", "BugcheckParameter3",
+		"BugcheckParameter4", "SleepInProgress", "PowerButtonTimestamp", "BootAppStatus", "Checkpoint",
+		"ConnectedStandbyInProgress", "SystemSleepTransitionsToOn", "CsEntryScenarioInstanceId",
+		"BugcheckInfoFromEFI", "CheckpointStatus", "CsEntryScenarioInstanceIdV2",
+		"LongPowerButtonPressDetected"},
+	{"system", 7045}: {"ServiceName", "ImagePath", "ServiceType", "StartType", "AccountName"},
+	{"microsoft-windows-powershell/operational", 4104}: {"MessageNumber", "MessageTotal",
+		"ScriptBlockText", "ScriptBlockId", "Path"},
+	{"microsoft-windows-windows defender/operational", 5007}: {"ProductName", "ProductVersion", "OldValue",
+		"NewValue"},
+	{"microsoft-windows-windows defender/operational", 1116}: {"Product Name", "Product Version",
+		"Detection ID", "Detection Time", "Unused", "Unused2", "Threat ID", "Threat Name", "Severity ID",
+		"Severity Name", "Category ID", "Category Name", "FWLink", "Status Code", "Status Description",
+		"State", "Source ID", "Source Name", "Process Name", "Detection User", "Unused3", "Path",
+		"Origin ID", "Origin Name", "Execution ID", "Execution Name", "Type ID", "Type Name",
+		"Pre Execution Status", "Action ID", "Action Name", "Unused4", "Error Code", "Error Description",
+		"Unused5", "Post Clean Status", "Additional Actions ID", "Additional Actions String",
+		"Remediation User", "Unused6", "Security intelligence Version", "Engine Version"},
+	{"microsoft-windows-sysmon/operational", 1}: {"RuleName", "UtcTime", "ProcessGuid", "ProcessId",
+		"Image", "FileVersion", "Description", "Product", "Company", "OriginalFileName",
+		"CommandLine", "CurrentDirectory", "User", "LogonGuid", "LogonId", "TerminalSessionId",
+		"IntegrityLevel", "Hashes", "ParentProcessGuid", "ParentProcessId", "ParentImage",
+		"ParentCommandLine", "ParentUser"},
+	{"microsoft-windows-sysmon/operational", 3}: {"RuleName", "UtcTime", "ProcessGuid", "ProcessId",
+		"Image", "User", "Protocol", "Initiated", "SourceIsIpv6", "SourceIp", "SourceHostname",
+		"SourcePort", "SourcePortName", "DestinationIsIpv6", "DestinationIp",
+		"DestinationHostname", "DestinationPort", "DestinationPortName"},
+	{"microsoft-windows-sysmon/operational", 22}: {"RuleName", "UtcTime", "ProcessGuid", "ProcessId",
+		"QueryName", "QueryStatus", "QueryResults", "Image", "User"},
+	{"microsoft-windows-wlan-autoconfig/operational", 8001}: {"InterfaceGuid", "InterfaceDescription",
+		"ConnectionMode", "ProfileName", "SSID", "BSSType", "PHYType", "AuthenticationAlgorithm",
+		"CipherAlgorithm", "OnexEnabled", "ConnectionId", "NonBroadcast"},
+	{"microsoft-windows-wlan-autoconfig/operational", 8002}: {"InterfaceGuid", "InterfaceDescription",
+		"ConnectionMode", "ProfileName", "SSID", "BSSType", "FailureReason", "ReasonCode",
+		"ConnectionId", "RSSI"},
+	{"microsoft-windows-wlan-autoconfig/operational", 8003}: {"InterfaceGuid", "InterfaceDescription",
+		"ConnectionMode", "ProfileName", "SSID", "BSSType", "Reason", "ConnectionId", "ReasonCode"},
+	{"application", 1000}: {"AppName", "AppVersion", "AppTimeStamp", "ModuleName", "ModuleVersion",
+		"ModuleTimeStamp", "ExceptionCode", "FaultingOffset", "ProcessId", "ProcessCreationTime", "AppPath",
+		"ModulePath", "IntegratorReportId", "PackageFullName", "PackageRelativeAppId"},
+	{"application", 20225}: {"CoId", "UserName", "ConnectionName"},
+	{"application", 20226}: {"CoId", "UserName", "ConnectionName", "ReasonCode"},
+	{"application", 20227}: {"CoId", "UserName", "ConnectionName", "ErrorCode"},
+	{"microsoft-windows-partition/diagnostic", 1006}: {"Version", "DiskNumber", "Flags", "Characteristics",
+		"IsSystem", "IsBoot", "BusType", "Manufacturer", "Model", "Revision", "SerialNumber", "Location",
+		"ParentId", "DiskId", "AdapterId", "RegistryId", "PoolId", "StorageIdCount", "StorageIdBytes",
+		"StorageIds", "PropertiesSize", "Properties", "BytesPerSector", "Capacity"},
+	{"microsoft-windows-diagnostics-performance/operational", 100}: {"BootTsVersion", "BootStartTime",
+		"BootEndTime", "SystemBootInstance", "UserBootInstance", "BootTime", "MainPathBootTime",
+		"BootKernelInitTime", "BootDriverInitTime", "BootDevicesInitTime", "BootPrefetchInitTime",
+		"BootPrefetchBytes", "BootAutoChkTime", "BootSmssInitTime", "BootCriticalServicesInitTime",
+		"BootUserProfileProcessingTime", "BootMachineProfileProcessingTime", "BootExplorerInitTime",
+		"BootNumStartupApps", "BootPostBootTime", "BootIsRebootAfterInstall",
+		"BootRootCauseStepImprovementBits", "BootRootCauseGradualImprovementBits",
+		"BootRootCauseStepDegradationBits", "BootRootCauseGradualDegradationBits", "BootIsDegradation"},
+	{"microsoft-windows-diagnostics-performance/operational", 101}: degradationFields,
+	{"microsoft-windows-diagnostics-performance/operational", 102}: degradationFields,
+	{"microsoft-windows-diagnostics-performance/operational", 103}: degradationFields,
+	{"microsoft-windows-diagnostics-performance/operational", 200}: {"ShutdownTsVersion", "ShutdownStartTime",
+		"ShutdownEndTime", "ShutdownTime"},
+	{"microsoft-windows-diagnostics-performance/operational", 203}: degradationFields,
+	{"microsoft-windows-dns-client/operational", 3006}: {"QueryName", "QueryType", "QueryOptions",
+		"ServerList", "IsNetworkQuery", "NetworkQueryIndex", "InterfaceIndex", "IsAsyncQuery"},
+	{"microsoft-windows-dns-client/operational", 3008}: {"QueryName", "QueryType", "QueryOptions",
+		"QueryStatus", "QueryResults"},
+	{"microsoft-windows-dns-client/operational", 3020}: {"QueryName", "NetworkIndex", "InterfaceIndex",
+		"Status", "QueryResults"},
+	{"iis", 1}: {"ClientIp", "Method", "UriStem", "UriQuery", "Status", "SubStatus", "Win32Status",
+		"Username", "UserAgent", "Referer", "ServerIp", "ServerPort", "TimeTaken"},
+	{"servicedrift", 1}: {"ServiceName", "DisplayName", "OldImagePath", "NewImagePath", "OldHash", "NewHash"},
+	{"servicedrift", 2}: {"ServiceName", "DisplayName", "OldImagePath", "NewImagePath", "OldHash", "NewHash"},
+}
+
+// degradationFields are the fields of the Diagnostics-Performance events naming an
+// application, driver or service that slowed a boot or shutdown
+var degradationFields = []string{"StartTime", "EndTime", "Name", "FriendlyName", "Version", "TotalTime",
+	"DegradationTime"}
+
+// fieldNames holds the names loaded from a field map file and those learned from
+// rendered event XML. Both take precedence over builtinFieldNames.
+var fieldNames = struct {
+	sync.RWMutex
+	custom  map[fieldKey][]string
+	learned map[fieldKey][]string
+}{learned: make(map[fieldKey][]string)}
+
+// LoadFieldMap reads field names for providers that only log positional insertion
+// strings. Each line has the form "channel event-id: name1, name2, ..."; a position
+// left empty keeps its default name. Blank lines and lines starting with # are ignored.
+func LoadFieldMap(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open field map %s: %v", path, err)
+	}
+	defer file.Close()
+
+	custom := make(map[fieldKey][]string)
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		event, list, ok := strings.Cut(line, ":")
+		split := strings.LastIndexByte(strings.TrimSpace(event), ' ')
+		if !ok || split <= 0 {
+			return fmt.Errorf("%s:%d: expected \"channel event-id: names\"", path, lineNumber)
+		}
+		event = strings.TrimSpace(event)
+		eventID, err := strconv.ParseUint(event[split+1:], 10, 32)
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid event ID %q", path, lineNumber, event[split+1:])
+		}
+
+		var names []string
+		for _, name := range strings.Split(list, ",") {
+			names = append(names, strings.TrimSpace(name))
+		}
+		custom[fieldKey{strings.ToLower(strings.TrimSpace(event[:split])), uint32(eventID)}] = names
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read field map %s: %v", path, err)
+	}
+
+	fieldNames.Lock()
+	fieldNames.custom = custom
+	fieldNames.Unlock()
+	return nil
+}
+
+// learnFieldNames remembers the EventData names a provider rendered for an event,
+// so events of the same ID read through the legacy API get the same field names
+func learnFieldNames(channel string, eventID uint32, names []string) {
+	key := fieldKey{strings.ToLower(channel), eventID}
+	fieldNames.RLock()
+	known := len(fieldNames.learned[key]) >= len(names)
+	fieldNames.RUnlock()
+	if known {
+		return
+	}
+
+	fieldNames.Lock()
+	fieldNames.learned[key] = names
+	fieldNames.Unlock()
+}
+
+// FieldNames returns the EventData names of an event's insertion strings, or nil if unknown.
+// An empty name leaves that position unnamed.
+func FieldNames(channel string, eventID uint32) []string {
+	key := fieldKey{strings.ToLower(channel), eventID}
+	fieldNames.RLock()
+	defer fieldNames.RUnlock()
+	if names, ok := fieldNames.custom[key]; ok {
+		return names
+	}
+	if names, ok := fieldNames.learned[key]; ok {
+		return names
+	}
+	return builtinFieldNames[key]
+}
+
+// NamedData maps an event's insertion strings to their field names. Strings
+// without a known name are keyed by position (param1, param2, ...).
+func NamedData(channel string, event EventLogData) map[string]string {
+	names := FieldNames(channel, event.EventID)
+	data := make(map[string]string, len(event.Strings))
+	for i, value := range event.Strings {
+		if i < len(names) && names[i] != "" {
+			data[names[i]] = value
+		} else {
+			data["param"+strconv.Itoa(i+1)] = value
+		}
+	}
+	return data
+}
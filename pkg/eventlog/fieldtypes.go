@@ -0,0 +1,152 @@
+package eventlog
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types of named fields in structured output, see TypedFields
+const (
+	FieldString = "string"
+	FieldInt    = "int"  // Decimal, or hexadecimal with 0x as Windows logs process IDs
+	FieldBool   = "bool" // true/false or 1/0
+	FieldTime   = "time" // Written as RFC3339 in UTC
+	FieldIP     = "ip"   // Written as a string, IPv4-mapped IPv6 addresses as IPv4
+)
+
+// builtinFieldTypes gives the type of the catalogued fields by name, whatever the
+// event; fields not listed stay strings
+var builtinFieldTypes = map[string]string{
+	// Process IDs
+	"ProcessId":       FieldInt,
+	"ProcessID":       FieldInt,
+	"NewProcessId":    FieldInt,
+	"ParentProcessId": FieldInt,
+	"ClientProcessId": FieldInt,
+
+	// Ports
+	"IpPort":          FieldInt,
+	"SourcePort":      FieldInt,
+	"DestPort":        FieldInt,
+	"DestinationPort": FieldInt,
+
+	// Other counters and codes
+	"LogonType":         FieldInt,
+	"KeyLength":         FieldInt,
+	"TerminalSessionId": FieldInt,
+	"MessageNumber":     FieldInt,
+	"MessageTotal":      FieldInt,
+	"QueryType":         FieldInt,
+	"QueryStatus":       FieldInt,
+	"InterfaceIndex":    FieldInt,
+	"NetworkIndex":      FieldInt,
+	"DiskNumber":        FieldInt,
+	"BytesPerSector":    FieldInt,
+	"Capacity":          FieldInt,
+	"RSSI":              FieldInt,
+
+	// Flags
+	"Initiated":         FieldBool,
+	"SourceIsIpv6":      FieldBool,
+	"DestinationIsIpv6": FieldBool,
+	"IsNetworkQuery":    FieldBool,
+	"IsAsyncQuery":      FieldBool,
+	"IsSystem":          FieldBool,
+	"IsBoot":            FieldBool,
+	"OnexEnabled":       FieldBool,
+	"NonBroadcast":      FieldBool,
+
+	// Times
+	"UtcTime":        FieldTime,
+	"Detection Time": FieldTime,
+
+	// Addresses
+	"IpAddress":     FieldIP,
+	"SourceAddress": FieldIP,
+	"DestAddress":   FieldIP,
+	"SourceIp":      FieldIP,
+	"DestinationIp": FieldIP,
+	"ClientIp":      FieldIP,
+	"ServerIp":      FieldIP,
+}
+
+// builtinEventFieldTypes types the fields whose meaning depends on the event, such
+// as Protocol, a number in the firewall events but a name in Sysmon's, or Status,
+// an NTSTATUS code in Security events but an HTTP status in IIS logs
+var builtinEventFieldTypes = map[fieldKey]map[string]string{
+	{"security", 5152}: {"Protocol": FieldInt},
+	{"security", 5156}: {"Protocol": FieldInt},
+	{"security", 5157}: {"Protocol": FieldInt},
+	{"iis", 1}:         {"Status": FieldInt, "SubStatus": FieldInt, "Win32Status": FieldInt, "ServerPort": FieldInt, "TimeTaken": FieldInt},
+}
+
+// sysmonTimeLayout is how Sysmon writes UtcTime
+const sysmonTimeLayout = "2006-01-02 15:04:05.999"
+
+// FieldType returns the type of a named field of an event, FieldString when the
+// catalog doesn't know it
+func FieldType(channel string, eventID uint32, name string) string {
+	if types, ok := builtinEventFieldTypes[fieldKey{strings.ToLower(channel), eventID}]; ok {
+		if fieldType, ok := types[name]; ok {
+			return fieldType
+		}
+	}
+	if fieldType, ok := builtinFieldTypes[name]; ok {
+		return fieldType
+	}
+	return FieldString
+}
+
+// TypedFields returns an event's named fields with the values of the catalogued
+// types converted, for JSON output: integers and booleans as numbers and
+// booleans, times as RFC3339 and addresses in their canonical form. A value that
+// doesn't parse as its type, such as "-" for a missing port, becomes nil, so a
+// field always has the same JSON type.
+func TypedFields(event EventLogData) map[string]any {
+	if event.Fields == nil {
+		return nil
+	}
+	typed := make(map[string]any, len(event.Fields))
+	for name, value := range event.Fields {
+		typed[name] = coerceField(FieldType(event.Channel, event.EventID, name), value)
+	}
+	return typed
+}
+
+// coerceField converts a field value to a type; nil when it doesn't parse
+func coerceField(fieldType, value string) any {
+	value = strings.TrimSpace(value)
+	switch fieldType {
+	case FieldInt:
+		if hex, ok := strings.CutPrefix(strings.ToLower(value), "0x"); ok {
+			if n, err := strconv.ParseUint(hex, 16, 64); err == nil {
+				return n
+			}
+			return nil
+		}
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+		return nil
+	case FieldBool:
+		if b, err := strconv.ParseBool(strings.ToLower(value)); err == nil {
+			return b
+		}
+		return nil
+	case FieldTime:
+		for _, layout := range []string{time.RFC3339Nano, sysmonTimeLayout} {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t.UTC().Format(time.RFC3339Nano)
+			}
+		}
+		return nil
+	case FieldIP:
+		if addr, err := netip.ParseAddr(strings.Trim(value, "[]")); err == nil {
+			return addr.Unmap().String()
+		}
+		return nil
+	}
+	return value
+}
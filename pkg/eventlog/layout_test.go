@@ -0,0 +1,126 @@
+package eventlog
+
+import (
+	"runtime"
+	"testing"
+	"unsafe"
+)
+
+// field is the offset of a struct field in the Windows SDK layout
+type field struct {
+	name   string
+	offset uintptr
+	want   uintptr
+}
+
+func checkLayout(t *testing.T, name string, size, wantSize uintptr, fields []field) {
+	t.Helper()
+	if size != wantSize {
+		t.Errorf("%s on %s: size = %d, want %d", name, runtime.GOARCH, size, wantSize)
+	}
+	for _, f := range fields {
+		if f.offset != f.want {
+			t.Errorf("%s.%s on %s: offset = %d, want %d", name, f.name, runtime.GOARCH, f.offset, f.want)
+		}
+	}
+}
+
+func TestEventLogRecordLayout(t *testing.T) {
+	// Only fixed-size integers, so the offsets are the same on 386, amd64 and arm64
+	var r EVENTLOGRECORD
+	checkLayout(t, "EVENTLOGRECORD", unsafe.Sizeof(r), sizeof_EVENTLOGRECORD, []field{
+		{"Length", unsafe.Offsetof(r.Length), 0},
+		{"Reserved", unsafe.Offsetof(r.Reserved), 4},
+		{"RecordNumber", unsafe.Offsetof(r.RecordNumber), 8},
+		{"TimeGenerated", unsafe.Offsetof(r.TimeGenerated), 12},
+		{"TimeWritten", unsafe.Offsetof(r.TimeWritten), 16},
+		{"EventID", unsafe.Offsetof(r.EventID), 20},
+		{"EventType", unsafe.Offsetof(r.EventType), 24},
+		{"NumStrings", unsafe.Offsetof(r.NumStrings), 26},
+		{"EventCategory", unsafe.Offsetof(r.EventCategory), 28},
+		{"ReservedFlags", unsafe.Offsetof(r.ReservedFlags), 30},
+		{"ClosingRecordNumber", unsafe.Offsetof(r.ClosingRecordNumber), 32},
+		{"StringOffset", unsafe.Offsetof(r.StringOffset), 36},
+		{"UserSidLength", unsafe.Offsetof(r.UserSidLength), 40},
+		{"UserSidOffset", unsafe.Offsetof(r.UserSidOffset), 44},
+		{"DataLength", unsafe.Offsetof(r.DataLength), 48},
+		{"DataOffset", unsafe.Offsetof(r.DataOffset), 52},
+	})
+}
+
+func TestEvtVariantLayout(t *testing.T) {
+	// EvtRender returns an array of these, so the stride must be 16 everywhere
+	var v EVT_VARIANT
+	checkLayout(t, "EVT_VARIANT", unsafe.Sizeof(v), 16, []field{
+		{"Value", unsafe.Offsetof(v.Value), 0},
+		{"Count", unsafe.Offsetof(v.Count), 8},
+		{"Type", unsafe.Offsetof(v.Type), 12},
+	})
+}
+
+func TestEvtRPCLoginInfoLayout(t *testing.T) {
+	// Four pointers and a DWORD, padded to pointer alignment
+	layouts := map[string]struct {
+		size, user, domain, password, flags uintptr
+	}{
+		"386":   {20, 4, 8, 12, 16},
+		"amd64": {40, 8, 16, 24, 32},
+		"arm64": {40, 8, 16, 24, 32},
+	}
+	want, ok := layouts[runtime.GOARCH]
+	if !ok {
+		t.Skipf("no SDK layout recorded for %s", runtime.GOARCH)
+	}
+	var l EVT_RPC_LOGIN_INFO
+	checkLayout(t, "EVT_RPC_LOGIN_INFO", unsafe.Sizeof(l), want.size, []field{
+		{"Server", unsafe.Offsetof(l.Server), 0},
+		{"User", unsafe.Offsetof(l.User), want.user},
+		{"Domain", unsafe.Offsetof(l.Domain), want.domain},
+		{"Password", unsafe.Offsetof(l.Password), want.password},
+		{"Flags", unsafe.Offsetof(l.Flags), want.flags},
+	})
+}
+
+func TestEncodedRecordMatchesLayout(t *testing.T) {
+	// The header EncodeRecords writes byte by byte must read back through the
+	// struct the parser casts the buffer to
+	event := EventLogData{
+		RecordNumber:  1234,
+		TimeGenerated: 1709251199,
+		TimeWritten:   1709251200,
+		EventID:       0x40001000 | 7036,
+		EventType:     EVENTLOG_WARNING_TYPE,
+		EventCategory: 3,
+		SourceName:    "Service Control Manager",
+		ComputerName:  "HOST01",
+		Strings:       []string{"Spooler", "running"},
+		Data:          []byte{1, 2, 3},
+	}
+	buffer := EncodeRecords([]EventLogData{event})
+	if len(buffer) < sizeof_EVENTLOGRECORD {
+		t.Fatalf("EncodeRecords wrote %d bytes, want at least %d", len(buffer), sizeof_EVENTLOGRECORD)
+	}
+	r := (*EVENTLOGRECORD)(unsafe.Pointer(&buffer[0]))
+	if int(r.Length) != len(buffer) {
+		t.Errorf("Length = %d, want %d", r.Length, len(buffer))
+	}
+	if r.Reserved != 0x654c664c { // "LfLe"
+		t.Errorf("Reserved = %#x, want the LfLe signature", r.Reserved)
+	}
+	if r.RecordNumber != event.RecordNumber || r.EventID != event.EventID {
+		t.Errorf("RecordNumber, EventID = %d, %#x, want %d, %#x", r.RecordNumber, r.EventID, event.RecordNumber, event.EventID)
+	}
+	if r.TimeGenerated != event.TimeGenerated || r.TimeWritten != event.TimeWritten {
+		t.Errorf("TimeGenerated, TimeWritten = %d, %d, want %d, %d", r.TimeGenerated, r.TimeWritten, event.TimeGenerated, event.TimeWritten)
+	}
+	if r.EventType != event.EventType || r.EventCategory != event.EventCategory || int(r.NumStrings) != len(event.Strings) {
+		t.Errorf("EventType, EventCategory, NumStrings = %d, %d, %d, want %d, %d, %d",
+			r.EventType, r.EventCategory, r.NumStrings, event.EventType, event.EventCategory, len(event.Strings))
+	}
+	if int(r.DataLength) != len(event.Data) || r.DataOffset+r.DataLength > r.Length {
+		t.Errorf("DataLength, DataOffset = %d, %d, want %d bytes inside the record", r.DataLength, r.DataOffset, len(event.Data))
+	}
+	if r.StringOffset < sizeof_EVENTLOGRECORD || r.StringOffset >= r.Length {
+		t.Errorf("StringOffset = %d, outside the record of %d bytes", r.StringOffset, r.Length)
+	}
+}
@@ -0,0 +1,80 @@
+package eventlog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// levelNames maps the names accepted by ParseLevels to event types
+var levelNames = map[string]uint16{
+	"success":       EVENTLOG_SUCCESS,
+	"critical":      EVENTLOG_ERROR_TYPE, // Critical events are read as errors
+	"error":         EVENTLOG_ERROR_TYPE,
+	"warning":       EVENTLOG_WARNING_TYPE,
+	"information":   EVENTLOG_INFORMATION_TYPE,
+	"info":          EVENTLOG_INFORMATION_TYPE,
+	"audit-success": EVENTLOG_AUDIT_SUCCESS,
+	"audit-failure": EVENTLOG_AUDIT_FAILURE,
+}
+
+// ParseLevels parses a comma-separated list of event types such as
+// "error,warning,audit-failure", as named by GetEventTypeName (case-insensitive,
+// with a space, hyphen or underscore in the audit types)
+func ParseLevels(list string) ([]uint16, error) {
+	var levels []uint16
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		name = strings.NewReplacer(" ", "-", "_", "-").Replace(name)
+		level, ok := levelNames[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown level %q (expected error, warning, information, success, audit-success or audit-failure)", name)
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+// MatchesLevel reports whether an event type passes a level filter (empty = all)
+func MatchesLevel(levels []uint16, eventType uint16) bool {
+	if len(levels) == 0 {
+		return true
+	}
+	for _, level := range levels {
+		if eventType == level {
+			return true
+		}
+	}
+	return false
+}
+
+// levelXPath returns the XPath condition selecting the events of levels, or ""
+// when they can't be expressed. The condition can select more events than the
+// levels, such as audit events of level 0 for information, so the results are
+// filtered again with MatchesLevel.
+func levelXPath(levels []uint16) string {
+	var conditions []string
+	for _, level := range levels {
+		switch level {
+		case EVENTLOG_ERROR_TYPE:
+			conditions = append(conditions, "Level=1", "Level=2")
+		case EVENTLOG_WARNING_TYPE:
+			conditions = append(conditions, "Level=3")
+		case EVENTLOG_INFORMATION_TYPE:
+			conditions = append(conditions, "Level=0", "Level=4", "Level=5")
+		case EVENTLOG_AUDIT_SUCCESS:
+			conditions = append(conditions, "band(Keywords,"+strconv.FormatUint(keywordAuditSuccess, 10)+")")
+		case EVENTLOG_AUDIT_FAILURE:
+			conditions = append(conditions, "band(Keywords,"+strconv.FormatUint(keywordAuditFailure, 10)+")")
+		default:
+			return "" // Success is never set on events rendered as XML
+		}
+	}
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "(" + strings.Join(conditions, " or ") + ")"
+}
@@ -0,0 +1,179 @@
+package eventlog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	evtOpenSession           = wevtapi.NewProc("EvtOpenSession")
+	evtOpenPublisherMetadata = wevtapi.NewProc("EvtOpenPublisherMetadata")
+	evtFormatMessage         = wevtapi.NewProc("EvtFormatMessage")
+	localeNameToLCID         = syscall.NewLazyDLL("kernel32.dll").NewProc("LocaleNameToLCID")
+)
+
+const (
+	EVT_RPC_LOGIN                  = 1
+	EVT_QUERY_CHANNEL_PATH         = 0x1
+	EVT_FORMAT_MESSAGE_EVENT       = 1
+	ERROR_EVT_MESSAGE_NOT_FOUND    = 15027
+	ERROR_EVT_MESSAGE_ID_NOT_FOUND = 15028
+)
+
+// EVT_RPC_LOGIN_INFO identifies the remote computer of an EvtOpenSession call
+type EVT_RPC_LOGIN_INFO struct {
+	Server   *uint16
+	User     *uint16
+	Domain   *uint16
+	Password *uint16
+	Flags    uint32
+}
+
+// ParseLocale converts a locale name such as "en-US" or a numeric LCID such as
+// 1033 or 0x409 into the LCID EvtOpenPublisherMetadata expects
+func ParseLocale(locale string) (uint32, error) {
+	if id, err := strconv.ParseUint(locale, 0, 32); err == nil {
+		return uint32(id), nil
+	}
+
+	name, err := syscall.UTF16PtrFromString(locale)
+	if err != nil {
+		return 0, fmt.Errorf("invalid locale %q: %v", locale, err)
+	}
+	lcid, _, _ := localeNameToLCID.Call(uintptr(unsafe.Pointer(name)), 0)
+	if lcid == 0 {
+		return 0, fmt.Errorf("unknown locale %q", locale)
+	}
+	return uint32(lcid), nil
+}
+
+// MessageRenderer renders event messages in one fixed locale, so the text does not
+// depend on the display language of the computer the events were read from
+type MessageRenderer struct {
+	session    uintptr            // 0 for the local computer
+	lcid       uint32             // Locale messages are rendered in
+	publishers map[string]uintptr // Publisher metadata handles by source name; 0 when unavailable
+	buffer     []uint16
+}
+
+// NewMessageRenderer opens a renderer for server (empty = local computer) in locale
+func NewMessageRenderer(server, locale string) (*MessageRenderer, error) {
+	lcid, err := ParseLocale(locale)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := openSession(server)
+	if err != nil {
+		return nil, err
+	}
+	return &MessageRenderer{session: session, lcid: lcid, publishers: make(map[string]uintptr), buffer: make([]uint16, 1024)}, nil
+}
+
+// Render fills in the Message of events that don't have one yet. Each event is
+// looked up by record number, so this costs one query per event and is meant for
+// reports rather than bulk collection. Events whose provider has no message for
+// them are left without one.
+func (r *MessageRenderer) Render(channel string, events []EventLogData) error {
+	channelUTF16, err := syscall.UTF16PtrFromString(channel)
+	if err != nil {
+		return fmt.Errorf("failed to convert channel name to UTF16: %v", err)
+	}
+
+	for i := range events {
+		if events[i].Message != "" {
+			continue
+		}
+		publisher := r.publisher(events[i].SourceName)
+		if publisher == 0 {
+			continue
+		}
+		message, err := r.render(channelUTF16, publisher, events[i].RecordNumber)
+		if err != nil {
+			return fmt.Errorf("failed to render record %d of %s: %v", events[i].RecordNumber, channel, err)
+		}
+		events[i].Message = message
+	}
+	return nil
+}
+
+// publisher returns the cached metadata handle of a provider, opened in the
+// renderer's locale
+func (r *MessageRenderer) publisher(source string) uintptr {
+	if handle, ok := r.publishers[source]; ok {
+		return handle
+	}
+
+	var handle uintptr
+	if sourceUTF16, err := syscall.UTF16PtrFromString(source); err == nil {
+		handle, _, _ = evtOpenPublisherMetadata.Call(r.session, uintptr(unsafe.Pointer(sourceUTF16)), 0, uintptr(r.lcid), 0)
+	}
+	r.publishers[source] = handle
+	return handle
+}
+
+// render formats the message of one record
+func (r *MessageRenderer) render(channel *uint16, publisher uintptr, record uint32) (string, error) {
+	query, _ := syscall.UTF16PtrFromString("*[System[EventRecordID=" + strconv.FormatUint(uint64(record), 10) + "]]")
+	results, _, err := evtQuery.Call(r.session, uintptr(unsafe.Pointer(channel)), uintptr(unsafe.Pointer(query)), EVT_QUERY_CHANNEL_PATH)
+	if results == 0 {
+		return "", fmt.Errorf("query failed: %v", err)
+	}
+	defer evtClose.Call(results)
+
+	var event uintptr
+	var returned uint32
+	ret, _, err := evtNext.Call(results, 1, uintptr(unsafe.Pointer(&event)), INFINITE, 0, uintptr(unsafe.Pointer(&returned)))
+	if ret == 0 {
+		if err.(syscall.Errno) == ERROR_NO_MORE_ITEMS {
+			return "", nil // Overwritten since it was read
+		}
+		return "", err
+	}
+	defer evtClose.Call(event)
+
+	for {
+		var used uint32
+		ret, _, err := evtFormatMessage.Call(
+			publisher,
+			event,
+			0,
+			0,
+			0,
+			EVT_FORMAT_MESSAGE_EVENT,
+			uintptr(len(r.buffer)),
+			uintptr(unsafe.Pointer(&r.buffer[0])),
+			uintptr(unsafe.Pointer(&used)),
+		)
+		if ret != 0 {
+			return strings.TrimSpace(syscall.UTF16ToString(r.buffer[:used])), nil
+		}
+
+		switch err.(syscall.Errno) {
+		case syscall.ERROR_INSUFFICIENT_BUFFER:
+			r.buffer = make([]uint16, used)
+		case ERROR_EVT_MESSAGE_NOT_FOUND, ERROR_EVT_MESSAGE_ID_NOT_FOUND:
+			return "", nil
+		default:
+			return "", err
+		}
+	}
+}
+
+// Close releases the publisher metadata and session handles
+func (r *MessageRenderer) Close() {
+	if r == nil {
+		return
+	}
+	for _, handle := range r.publishers {
+		if handle != 0 {
+			evtClose.Call(handle)
+		}
+	}
+	if r.session != 0 {
+		evtClose.Call(r.session)
+	}
+}
@@ -0,0 +1,239 @@
+package eventlog
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// eventLogServiceKey holds the classic event logs and the sources registered in them
+const eventLogServiceKey = `SYSTEM\CurrentControlSet\Services\EventLog`
+
+// maxMessageLength is the longest message FormatMessageW returns
+const maxMessageLength = 64 * 1024
+
+// messageSeverities are the severity bits tried in turn when looking up an event
+// ID: the records only keep the low 16 bits, while message files are keyed by the
+// full ID
+var messageSeverities = []uint32{0, 0x40000000, 0x80000000, 0xC0000000}
+
+// messageSource holds the message files of one event source
+type messageSource struct {
+	messages   []windows.Handle // EventMessageFile modules
+	parameters []windows.Handle // ParameterMessageFile modules, for %%n insertion strings
+}
+
+// MessageFiles renders the description of classic events from the EventMessageFile
+// of their source and FormatMessageW, like Event Viewer does. The files are
+// registered on the computer that wrote the events, so only events of the local
+// computer can be rendered. Unlike MessageRenderer, messages come out in the
+// display language of the computer.
+type MessageFiles struct {
+	sources map[string]*messageSource // By channel\source, lower case; nil when the source has no message file
+	modules map[string]windows.Handle // Loaded message files by expanded path, lower case; 0 when unavailable
+	buffer  []uint16
+}
+
+// NewMessageFiles returns an empty renderer; message files are loaded on first use
+func NewMessageFiles() *MessageFiles {
+	return &MessageFiles{
+		sources: make(map[string]*messageSource),
+		modules: make(map[string]windows.Handle),
+		buffer:  make([]uint16, maxMessageLength),
+	}
+}
+
+// Render fills in the Message of events that don't have one yet. Events whose
+// source registers no message file, or whose file has no message for them, are
+// left without one.
+func (m *MessageFiles) Render(channel string, events []EventLogData) {
+	if m == nil {
+		return
+	}
+	for i := range events {
+		if events[i].Message != "" {
+			continue
+		}
+		source := m.source(channel, events[i].SourceName)
+		if source == nil {
+			continue
+		}
+		template := m.format(source.messages, events[i].EventID)
+		if template == "" {
+			continue
+		}
+		inserts := make([]string, len(events[i].Strings))
+		for j, s := range events[i].Strings {
+			inserts[j] = m.expandParameters(source, s)
+		}
+		events[i].Message = strings.TrimSpace(expandInserts(template, inserts))
+	}
+}
+
+// source returns the message files of a source, loading them on first use
+func (m *MessageFiles) source(channel, name string) *messageSource {
+	key := strings.ToLower(channel + `\` + name)
+	if source, ok := m.sources[key]; ok {
+		return source
+	}
+
+	var source *messageSource
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, eventLogServiceKey+`\`+channel+`\`+name, registry.QUERY_VALUE)
+	if err == nil {
+		source = &messageSource{
+			messages:   m.load(k, "EventMessageFile"),
+			parameters: m.load(k, "ParameterMessageFile"),
+		}
+		k.Close()
+		if len(source.messages) == 0 {
+			source = nil
+		}
+	}
+	m.sources[key] = source
+	return source
+}
+
+// load loads the modules of a semicolon-separated list of message files
+func (m *MessageFiles) load(k registry.Key, value string) []windows.Handle {
+	list, _, err := k.GetStringValue(value)
+	if err != nil {
+		return nil
+	}
+
+	var modules []windows.Handle
+	for _, path := range strings.Split(list, ";") {
+		path, err = registry.ExpandString(strings.TrimSpace(path))
+		if err != nil || path == "" {
+			continue
+		}
+		module, ok := m.modules[strings.ToLower(path)]
+		if !ok {
+			// As a data file, so no code of the DLL runs
+			module, _ = windows.LoadLibraryEx(path, 0, windows.LOAD_LIBRARY_AS_DATAFILE|windows.LOAD_LIBRARY_AS_IMAGE_RESOURCE)
+			m.modules[strings.ToLower(path)] = module
+		}
+		if module != 0 {
+			modules = append(modules, module)
+		}
+	}
+	return modules
+}
+
+// format returns the message template of id from the first module that has it,
+// with its %1 inserts left in place
+func (m *MessageFiles) format(modules []windows.Handle, id uint32) string {
+	for _, module := range modules {
+		for _, severity := range messageSeverities {
+			n, err := windows.FormatMessage(windows.FORMAT_MESSAGE_FROM_HMODULE|windows.FORMAT_MESSAGE_IGNORE_INSERTS,
+				uintptr(module), id|severity, 0, m.buffer, nil)
+			if err == nil {
+				return syscall.UTF16ToString(m.buffer[:n])
+			}
+			if !errors.Is(err, windows.ERROR_MR_MID_NOT_FOUND) {
+				break // No message table, or a broken one
+			}
+		}
+	}
+	return ""
+}
+
+// expandParameters replaces the %%n references of an insertion string, such as
+// the access masks and logon types of Security events, with their text from the
+// source's parameter files
+func (m *MessageFiles) expandParameters(source *messageSource, s string) string {
+	if len(source.parameters) == 0 || !strings.Contains(s, "%%") {
+		return s
+	}
+
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "%%")
+		if i < 0 {
+			break
+		}
+		digits := 0
+		for i+2+digits < len(s) && s[i+2+digits] >= '0' && s[i+2+digits] <= '9' {
+			digits++
+		}
+		b.WriteString(s[:i])
+		text := ""
+		if id, err := strconv.ParseUint(s[i+2:i+2+digits], 10, 32); err == nil {
+			text = strings.TrimRight(m.format(source.parameters, uint32(id)), "\r\n")
+		}
+		if text == "" {
+			text = s[i : i+2+digits] // Leave unknown references as they are
+		}
+		b.WriteString(text)
+		s = s[i+2+digits:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// expandInserts processes the escapes of a message template: %1 to %99, with an
+// optional !printf format! that is ignored since all inserts are strings, are
+// replaced by the insertion strings; %n, %t and %r are a line break, tab and
+// carriage return; %b a space; %0 ends the message; %%, %. and %! are the
+// character itself. Inserts without an insertion string and unknown escapes are
+// left in place.
+func expandInserts(template string, inserts []string) string {
+	var b strings.Builder
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' || i+1 == len(template) {
+			b.WriteByte(template[i])
+			continue
+		}
+		i++
+		switch c := template[i]; {
+		case c >= '1' && c <= '9':
+			end := i + 1
+			if end < len(template) && template[end] >= '0' && template[end] <= '9' {
+				end++
+			}
+			n, _ := strconv.Atoi(template[i:end])
+			if end < len(template) && template[end] == '!' {
+				if closing := strings.IndexByte(template[end+1:], '!'); closing >= 0 {
+					end += closing + 2
+				}
+			}
+			if n <= len(inserts) {
+				b.WriteString(inserts[n-1])
+			} else {
+				b.WriteString("%" + template[i:end])
+			}
+			i = end - 1
+		case c == 'n':
+			b.WriteString("\r\n")
+		case c == 't':
+			b.WriteByte('\t')
+		case c == 'r':
+			b.WriteByte('\r')
+		case c == 'b':
+			b.WriteByte(' ')
+		case c == '0':
+			return b.String()
+		case c == '%' || c == '.' || c == '!':
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Close unloads the message files
+func (m *MessageFiles) Close() {
+	if m == nil {
+		return
+	}
+	for _, module := range m.modules {
+		if module != 0 {
+			windows.FreeLibrary(module)
+		}
+	}
+}
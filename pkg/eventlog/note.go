@@ -0,0 +1,27 @@
+package eventlog
+
+import "time"
+
+// Note is an analyst's triage of an event: labels such as "benign" or
+// "escalated" and free text, kept in the local store next to the events
+type Note struct {
+	Labels []string  `json:"labels,omitempty"`
+	Text   string    `json:"text,omitempty"`
+	Author string    `json:"author,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// NoteLabels returns the labels of notes, in order and without duplicates
+func NoteLabels(notes []Note) []string {
+	var labels []string
+	seen := map[string]bool{}
+	for _, note := range notes {
+		for _, label := range note.Labels {
+			if !seen[label] {
+				seen[label] = true
+				labels = append(labels, label)
+			}
+		}
+	}
+	return labels
+}
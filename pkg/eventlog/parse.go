@@ -0,0 +1,291 @@
+package eventlog
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// readBufferSize is the size of the ReadEventLogW buffers; each holds many records
+// and is grown when a single record is larger
+const readBufferSize = 64 * 1024
+
+// maxParseWorkers bounds the goroutines parsing the buffers of one read
+const maxParseWorkers = 8
+
+// recordParser decodes the records of a ReadEventLogW buffer and applies the
+// filters of a read
+type recordParser struct {
+	logName      string
+	computerName string
+	afterRecord  uint32   // Skip records already returned by an earlier read
+	since        uint32   // Skip records generated before this Unix time
+	eventIDs     []uint32 // Only keep these event IDs (empty = all)
+	levels       []uint16 // Only keep these event types (empty = all)
+}
+
+// readChunk is a filled read buffer, numbered in read order
+type readChunk struct {
+	seq    int
+	buffer []byte
+	length uint32
+}
+
+// parsedChunk holds the matching events of a read buffer and the highest record
+// number it contained, or the error a malformed buffer caused
+type parsedChunk struct {
+	seq        int
+	events     []EventLogData
+	lastRecord uint32
+	err        error
+}
+
+// parseWorkers returns the number of goroutines parsing the buffers of one read
+func parseWorkers() int {
+	return min(runtime.GOMAXPROCS(0), maxParseWorkers)
+}
+
+// parse decodes the records in buffer, returning the events that pass the filters
+// and the highest record number examined
+func (p *recordParser) parse(decoder *recordDecoder, buffer []byte) (events []EventLogData, lastRecord uint32) {
+	bytesRead := uint32(len(buffer))
+
+	// Process the buffer which may contain multiple event records
+	offset := uint32(0)
+	for offset < bytesRead {
+		// Safety check - make sure we have at least enough space for the record header
+		if offset+sizeof_EVENTLOGRECORD > bytesRead {
+			break
+		}
+
+		record := (*EVENTLOGRECORD)(unsafe.Pointer(&buffer[offset]))
+
+		// Basic validation - check if record length is reasonable
+		if record.Length < sizeof_EVENTLOGRECORD || record.Length > bytesRead-offset {
+			// Invalid record length, skip to next aligned position or end
+			offset += 8 // Try to realign on 8-byte boundary
+			if offset >= bytesRead {
+				break
+			}
+			continue
+		}
+
+		// Skip records that were already returned by an earlier read
+		if record.RecordNumber <= p.afterRecord {
+			offset += record.Length
+			continue
+		}
+		if record.RecordNumber > lastRecord {
+			lastRecord = record.RecordNumber
+		}
+		// Clock changes can put older records after the start of the window
+		if record.TimeGenerated < p.since || !p.matches(record.EventID&0xFFFF) || !MatchesLevel(p.levels, record.EventType) {
+			offset += record.Length
+			continue
+		}
+
+		events = append(events, p.decode(decoder, record, buffer, offset))
+		offset += record.Length
+	}
+
+	return events, lastRecord
+}
+
+// matches reports whether an event ID passes the event ID filter
+func (p *recordParser) matches(eventID uint32) bool {
+	if len(p.eventIDs) == 0 {
+		return true
+	}
+	for _, id := range p.eventIDs {
+		if eventID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// decode extracts the event of the record at offset
+func (p *recordParser) decode(decoder *recordDecoder, record *EVENTLOGRECORD, buffer []byte, offset uint32) EventLogData {
+	// Extract event data
+	event := EventLogData{
+		Channel:       p.logName,
+		RecordNumber:  record.RecordNumber,
+		TimeGenerated: record.TimeGenerated,
+		TimeWritten:   record.TimeWritten,
+		EventID:       record.EventID & 0xFFFF, // Low 16 bits
+		EventType:     record.EventType,
+		EventCategory: record.EventCategory,
+		SourceName:    decoder.sourceFromEvent(p.logName, buffer, offset),
+		ComputerName:  p.computerName,
+	}
+
+	// Get strings - with bounds checking
+	event.Strings = make([]string, 0, record.NumStrings)
+	if record.NumStrings > 0 && record.StringOffset > 0 {
+		stringsPtr := offset + record.StringOffset
+
+		// Safety check - make sure StringOffset is within buffer bounds
+		if stringsPtr < uint32(len(buffer)) {
+			for i := uint16(0); i < record.NumStrings; i++ {
+				// Check if we're still within buffer
+				if stringsPtr >= uint32(len(buffer)) {
+					break
+				}
+
+				strStart := stringsPtr
+				strEnd := strStart
+
+				// Find null terminator with bounds checking
+				for strEnd+1 < uint32(len(buffer)) && (buffer[strEnd] != 0 || buffer[strEnd+1] != 0) {
+					strEnd += 2
+					// Safety check for overly long strings
+					if strEnd-strStart > 32768 { // Max reasonable string length
+						break
+					}
+				}
+
+				// Safe string conversion
+				strLen := (strEnd - strStart) / 2
+				// Empty strings are kept so insertion string positions stay stable
+				if strLen == 0 {
+					event.Strings = append(event.Strings, "")
+				} else if strLen < 16384 {
+					event.Strings = append(event.Strings, decoder.text(buffer[strStart:strEnd]))
+				}
+
+				// Move to next string (if any)
+				if strEnd+2 >= uint32(len(buffer)) {
+					break // End of buffer
+				}
+				stringsPtr = strEnd + 2
+			}
+		}
+	}
+
+	// Get the user SID if the source recorded one
+	if record.UserSidLength > 0 && record.UserSidOffset > 0 {
+		sidStart := offset + record.UserSidOffset
+		if sidEnd := sidStart + record.UserSidLength; sidEnd <= uint32(len(buffer)) && sidEnd > sidStart {
+			event.UserSid = sidString(buffer[sidStart:sidEnd])
+		}
+	}
+
+	// Get binary data if present - with bounds checking
+	if record.DataLength > 0 && record.DataOffset > 0 {
+		dataStart := offset + record.DataOffset
+
+		// Make sure offsets are within buffer bounds
+		if dataStart < uint32(len(buffer)) {
+			dataEnd := dataStart + record.DataLength
+
+			// Ensure we don't go beyond buffer
+			if dataEnd > uint32(len(buffer)) {
+				dataEnd = uint32(len(buffer))
+			}
+
+			if dataEnd > dataStart {
+				event.Data = make([]byte, dataEnd-dataStart)
+				copy(event.Data, buffer[dataStart:dataEnd])
+			}
+		}
+	}
+
+	return event
+}
+
+// parseAll parses the read buffers on workers goroutines, each with its own
+// decoder, and returns their results, which arrive out of read order. Buffers are
+// returned to free once parsed. A panic while parsing a buffer is returned as the
+// error of its chunk, since it happens outside the goroutine of the caller.
+func (p *recordParser) parseAll(workers int, chunks <-chan readChunk, free chan<- []byte) <-chan parsedChunk {
+	parsed := make(chan parsedChunk, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var decoder recordDecoder
+			for chunk := range chunks {
+				result := p.parseChunk(&decoder, chunk)
+				free <- chunk.buffer
+				parsed <- result
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(parsed)
+	}()
+	return parsed
+}
+
+// parseChunk parses one read buffer, recovering from a panic on a malformed record
+func (p *recordParser) parseChunk(decoder *recordDecoder, chunk readChunk) (result parsedChunk) {
+	result.seq = chunk.seq
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			result.events = nil
+			result.err = fmt.Errorf("failed to parse %s records: %v", p.logName, recovered)
+		}
+	}()
+	result.events, result.lastRecord = p.parse(decoder, chunk.buffer[:chunk.length])
+	return result
+}
+
+// readRecords issues the ReadEventLogW calls of a read, taking empty buffers from
+// free and handing each filled one to chunks in read order, until the log ends, a
+// call fails or done is closed. It returns the time spent in ReadEventLogW.
+func readRecords(readEventLog *syscall.LazyProc, handle uintptr, flags, seekRecord uint32,
+	free <-chan []byte, chunks chan<- readChunk, done <-chan struct{}) (time.Duration, error) {
+	var elapsed time.Duration
+	for seq := 0; ; seq++ {
+		var buffer []byte
+		select {
+		case buffer = <-free:
+		case <-done:
+			return elapsed, nil
+		}
+
+		var bytesRead, bytesNeeded uint32
+		for {
+			start := time.Now()
+			ret, _, err := readEventLog.Call(
+				handle,
+				uintptr(flags),
+				uintptr(seekRecord),
+				uintptr(unsafe.Pointer(&buffer[0])),
+				uintptr(len(buffer)),
+				uintptr(unsafe.Pointer(&bytesRead)),
+				uintptr(unsafe.Pointer(&bytesNeeded)),
+			)
+			elapsed += time.Since(start)
+			if ret != 0 {
+				break
+			}
+
+			errno := err.(syscall.Errno)
+			if errno == ERROR_NO_MORE_ITEMS {
+				// Reached end of log - this is normal, not an error
+				return elapsed, nil
+			} else if errno == syscall.ERROR_INSUFFICIENT_BUFFER {
+				// Resize buffer and try again
+				buffer = make([]byte, bytesNeeded)
+				continue
+			}
+			return elapsed, fmt.Errorf("error reading event log: %v", err)
+		}
+
+		// After the initial seek, continue reading sequentially
+		flags = EVENTLOG_SEQUENTIAL_READ | EVENTLOG_FORWARDS_READ
+		seekRecord = 0
+
+		select {
+		case chunks <- readChunk{seq: seq, buffer: buffer, length: bytesRead}:
+		case <-done:
+			return elapsed, nil
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package eventlog
+
+import "time"
+
+// Collection APIs recorded in provenance
+const (
+	APIReadEventLog = "ReadEventLogW"
+	APIEvtQuery     = "EvtQuery"
+	APIWinRM        = "WinRM wevtutil"
+)
+
+// CollectorVersion is recorded in the provenance of every event; release builds set
+// it with -ldflags "-X lemita/datn/pkg/eventlog.CollectorVersion=1.2.0"
+var CollectorVersion = "dev"
+
+// Provenance traces an event back to where and how it was collected
+type Provenance struct {
+	Channel          string    `json:"channel"`
+	API              string    `json:"api"`
+	Remote           bool      `json:"remote,omitempty"` // Read from another computer
+	CollectorVersion string    `json:"collector_version"`
+	Host             string    `json:"host"`      // Computer the event was read from
+	Collector        string    `json:"collector"` // Computer that ran the collection
+	RecordNumber     uint32    `json:"record_number"`
+	CollectedAt      time.Time `json:"collected_at"`
+}
+
+// stampEvents records the provenance, stable ID and user account of a batch of
+// events read from one channel
+func stampEvents(events []EventLogData, channel, api, host string, remote bool) {
+	// WinRM is used where RPC to the host is blocked, and account lookups need RPC
+	if api != APIWinRM {
+		server := ""
+		if remote {
+			server = host
+		}
+		resolveUsers(events, server)
+	}
+
+	collector := GetLocalComputerName()
+	collectedAt := time.Now().UTC()
+	for i := range events {
+		events[i].UID = StableID(events[i])
+		events[i].Provenance = &Provenance{
+			Channel:          channel,
+			API:              api,
+			Remote:           remote,
+			CollectorVersion: CollectorVersion,
+			Host:             host,
+			Collector:        collector,
+			RecordNumber:     events[i].RecordNumber,
+			CollectedAt:      collectedAt,
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package eventlog
+
+import (
+	"encoding/binary"
+	"unicode/utf16"
+)
+
+// EncodeRecords lays events out as the EVENTLOGRECORD buffer ReadEventLogW fills,
+// with the source and computer names, insertion strings and data of each, so the
+// record parser can be measured and exercised without an event log. User SIDs are
+// not encoded.
+func EncodeRecords(events []EventLogData) []byte {
+	var buffer []byte
+	for _, event := range events {
+		start := len(buffer)
+		buffer = append(buffer, make([]byte, sizeof_EVENTLOGRECORD)...)
+		buffer = appendUTF16Z(buffer, event.SourceName)
+		buffer = appendUTF16Z(buffer, event.ComputerName)
+		buffer = pad4(buffer, start)
+
+		stringOffset := len(buffer) - start
+		for _, s := range event.Strings {
+			buffer = appendUTF16Z(buffer, s)
+		}
+		dataOffset := len(buffer) - start
+		buffer = append(buffer, event.Data...)
+		buffer = pad4(buffer, start)
+		// The record ends with its length repeated
+		length := len(buffer) - start + 4
+		buffer = binary.LittleEndian.AppendUint32(buffer, uint32(length))
+
+		header := buffer[start:]
+		binary.LittleEndian.PutUint32(header[0:], uint32(length))
+		binary.LittleEndian.PutUint32(header[4:], 0x654c664c) // "LfLe"
+		binary.LittleEndian.PutUint32(header[8:], event.RecordNumber)
+		binary.LittleEndian.PutUint32(header[12:], event.TimeGenerated)
+		binary.LittleEndian.PutUint32(header[16:], event.TimeWritten)
+		binary.LittleEndian.PutUint32(header[20:], event.EventID)
+		binary.LittleEndian.PutUint16(header[24:], event.EventType)
+		binary.LittleEndian.PutUint16(header[26:], uint16(len(event.Strings)))
+		binary.LittleEndian.PutUint16(header[28:], event.EventCategory)
+		binary.LittleEndian.PutUint32(header[36:], uint32(stringOffset))
+		binary.LittleEndian.PutUint32(header[48:], uint32(len(event.Data)))
+		binary.LittleEndian.PutUint32(header[52:], uint32(dataOffset))
+	}
+	return buffer
+}
+
+// ParseRecords decodes a buffer of EVENTLOGRECORDs, such as one written by
+// EncodeRecords, with the parser of live reads and no filters
+func ParseRecords(logName string, buffer []byte) []EventLogData {
+	p := &recordParser{logName: logName}
+	var decoder recordDecoder
+	events, _ := p.parse(&decoder, buffer)
+	return events
+}
+
+// appendUTF16Z appends s as null-terminated UTF-16LE
+func appendUTF16Z(b []byte, s string) []byte {
+	for _, unit := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, unit)
+	}
+	return append(b, 0, 0)
+}
+
+// pad4 pads the record started at start to a multiple of 4 bytes
+func pad4(b []byte, start int) []byte {
+	for (len(b)-start)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
@@ -0,0 +1,48 @@
+package eventlog
+
+import (
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/windows"
+)
+
+// account is a resolved user SID
+type account struct {
+	name, domain string
+}
+
+// accounts caches LookupAccountSidW results by server and SID, including SIDs
+// that could not be resolved, since every event of a service repeats its SID
+var accounts = struct {
+	sync.Mutex
+	names map[string]account
+}{names: make(map[string]account)}
+
+// LookupAccount resolves a SID string on server (empty = local computer) to its
+// account name and domain. Deleted accounts and SIDs of other domains that can't
+// be reached resolve to empty names. Results are cached.
+func LookupAccount(server, sid string) (name, domain string) {
+	key := strings.ToLower(server) + "\x00" + sid
+	accounts.Lock()
+	defer accounts.Unlock()
+	if cached, ok := accounts.names[key]; ok {
+		return cached.name, cached.domain
+	}
+
+	var resolved account
+	if binary, err := windows.StringToSid(sid); err == nil {
+		resolved.name, resolved.domain, _, _ = binary.LookupAccount(server)
+	}
+	accounts.names[key] = resolved
+	return resolved.name, resolved.domain
+}
+
+// resolveUsers fills in the UserName and UserDomain of events with a UserSid
+func resolveUsers(events []EventLogData, server string) {
+	for i := range events {
+		if events[i].UserSid != "" && events[i].UserName == "" {
+			events[i].UserName, events[i].UserDomain = LookupAccount(server, events[i].UserSid)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package eventlog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"unsafe"
+)
+
+// DefaultMemoryLimit is the default size of the events a reader keeps in memory
+// before spilling them to disk
+const DefaultMemoryLimit = 256 << 20
+
+// SpillBatchSize is the number of events handed on at a time when reading back a
+// spill file
+const SpillBatchSize = 5000
+
+// Spill is a gzip-compressed temporary file of JSON lines holding the events of a
+// read that exceeded its memory limit
+type Spill struct {
+	file  *os.File
+	gz    *gzip.Writer
+	buf   *bufio.Writer
+	enc   *json.Encoder
+	count int
+}
+
+// NewSpill creates a spill file in dir (empty = the system temporary directory)
+func NewSpill(dir string) (*Spill, error) {
+	file, err := os.CreateTemp(dir, "datn-spill-*.jsonl.gz")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %v", err)
+	}
+	gz := gzip.NewWriter(file)
+	buf := bufio.NewWriter(gz)
+	return &Spill{file: file, gz: gz, buf: buf, enc: json.NewEncoder(buf)}, nil
+}
+
+// Write appends events to the spill file
+func (s *Spill) Write(events []EventLogData) error {
+	for _, event := range events {
+		if err := s.enc.Encode(event); err != nil {
+			return fmt.Errorf("failed to write spill file: %v", err)
+		}
+		s.count++
+	}
+	return nil
+}
+
+// Len returns the number of spilled events
+func (s *Spill) Len() int {
+	return s.count
+}
+
+// Path returns the location of the spill file
+func (s *Spill) Path() string {
+	return s.file.Name()
+}
+
+// finish flushes the compressed stream so the file can be read back
+func (s *Spill) finish() error {
+	if err := s.buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write spill file: %v", err)
+	}
+	if err := s.gz.Close(); err != nil {
+		return fmt.Errorf("failed to write spill file: %v", err)
+	}
+	return nil
+}
+
+// Each reads the spilled events back in batches of up to batchSize events
+func (s *Spill) Each(batchSize int, fn func([]EventLogData)) error {
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind spill file: %v", err)
+	}
+	gz, err := gzip.NewReader(bufio.NewReader(s.file))
+	if err != nil {
+		return fmt.Errorf("failed to read spill file: %v", err)
+	}
+	defer gz.Close()
+
+	dec := json.NewDecoder(gz)
+	batch := make([]EventLogData, 0, batchSize)
+	for {
+		var event EventLogData
+		if err := dec.Decode(&event); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read spill file: %v", err)
+		}
+		batch = append(batch, event)
+		if len(batch) == batchSize {
+			fn(batch)
+			batch = make([]EventLogData, 0, batchSize)
+		}
+	}
+	if len(batch) > 0 {
+		fn(batch)
+	}
+	return nil
+}
+
+// Close removes the spill file
+func (s *Spill) Close() error {
+	s.file.Close()
+	return os.Remove(s.file.Name())
+}
+
+// eventSize estimates the memory held by an event
+func eventSize(event *EventLogData) int64 {
+	size := int64(unsafe.Sizeof(*event)) + int64(len(event.SourceName)+len(event.ComputerName)+len(event.UserSid)+len(event.Data))
+	for _, s := range event.Strings {
+		size += int64(unsafe.Sizeof(s)) + int64(len(s))
+	}
+	return size
+}
@@ -0,0 +1,37 @@
+package eventlog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// StableID returns a deterministic identifier of an event, the truncated SHA-256 of
+// its computer, channel, record number, generation time and provider. The same
+// record gets the same ID in every run, over RPC or WinRM, and in every output, so
+// overlapping incremental runs and multiple sinks can be deduplicated downstream,
+// while the same record number of two computers gets two IDs.
+func StableID(event EventLogData) string {
+	key := strings.Join([]string{
+		computerKey(event.ComputerName),
+		strings.ToLower(event.Channel),
+		strconv.FormatUint(uint64(event.RecordNumber), 10),
+		strconv.FormatUint(uint64(event.TimeGenerated), 10),
+		strings.ToLower(event.SourceName),
+	}, "\x00")
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// computerKey reduces a computer name to its lowercase host label, since RPC reads
+// report the NetBIOS name or the server as given and WinRM the FQDN of the event
+func computerKey(name string) string {
+	name = strings.ToLower(strings.TrimPrefix(name, `\\`))
+	if net.ParseIP(name) != nil {
+		return name
+	}
+	host, _, _ := strings.Cut(name, ".")
+	return host
+}
@@ -0,0 +1,29 @@
+package eventlog
+
+import "testing"
+
+func TestStableIDComputer(t *testing.T) {
+	event := EventLogData{Channel: "Security", RecordNumber: 42, TimeGenerated: 1709251199, SourceName: "Microsoft-Windows-Security-Auditing"}
+	id := func(computer string) string {
+		e := event
+		e.ComputerName = computer
+		return StableID(e)
+	}
+
+	// The same record read over RPC and over WinRM
+	for _, computer := range []string{"WS01", `\\ws01`, "ws01.corp.example", "WS01.CORP.EXAMPLE"} {
+		if got, want := id(computer), id("ws01"); got != want {
+			t.Errorf("StableID with computer %q = %s, want %s", computer, got, want)
+		}
+	}
+
+	// The same record number on another computer
+	for _, computer := range []string{"ws02", "ws02.corp.example", "10.0.0.1", "10.0.0.2"} {
+		if id(computer) == id("ws01") {
+			t.Errorf("StableID with computer %q is the ID of ws01", computer)
+		}
+	}
+	if id("10.0.0.1") == id("10.0.0.2") {
+		t.Errorf("StableID of 10.0.0.1 is the ID of 10.0.0.2")
+	}
+}
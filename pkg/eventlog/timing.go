@@ -0,0 +1,38 @@
+package eventlog
+
+import (
+	"fmt"
+	"time"
+)
+
+// StageTimings is the time spent on one channel in each stage of a collection
+type StageTimings struct {
+	Channel string        `json:"channel"`
+	API     string        `json:"api,omitempty"` // Event log API the channel was read with, as in Provenance
+	Open    time.Duration `json:"open"`          // Opening the log and seeking to the first record
+	Read    time.Duration `json:"read"`          // ReadEventLog calls, or the remote query for WinRM
+	Parse   time.Duration `json:"parse"`         // Decoding records into EventLogData
+	Format  time.Duration `json:"format"`        // Rendering the text report
+	Write   time.Duration `json:"write"`         // Sink, store, JSONL events and report output
+}
+
+// Total returns the time spent in all stages
+func (t StageTimings) Total() time.Duration {
+	return t.Open + t.Read + t.Parse + t.Format + t.Write
+}
+
+// String formats the timings on one line
+func (t StageTimings) String() string {
+	s := fmt.Sprintf("open %v, read %v, parse %v, format %v, write %v (total %v)",
+		roundDuration(t.Open), roundDuration(t.Read), roundDuration(t.Parse),
+		roundDuration(t.Format), roundDuration(t.Write), roundDuration(t.Total()))
+	if t.API != "" {
+		s += " via " + t.API
+	}
+	return s
+}
+
+// roundDuration drops sub-microsecond noise from a duration
+func roundDuration(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,347 @@
+package eventlog
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	evtRender                   = wevtapi.NewProc("EvtRender")
+	evtOpenChannelConfig        = wevtapi.NewProc("EvtOpenChannelConfig")
+	evtGetChannelConfigProperty = wevtapi.NewProc("EvtGetChannelConfigProperty")
+)
+
+const (
+	EVT_RENDER_EVENT_XML            = 1
+	EvtChannelConfigClassicEventlog = 4
+	EvtVarTypeBoolean               = 13
+	ERROR_EVT_CHANNEL_NOT_FOUND     = 15007
+)
+
+// Event log APIs a channel can be read with
+const (
+	APIAuto   = "auto"    // Probe every channel, see ChannelAPI
+	APILegacy = "legacy"  // OpenEventLogW and ReadEventLogW, for classic logs
+	APIWevt   = "wevtapi" // EvtQuery, for manifest-based channels such as Sysmon/Operational
+)
+
+// ValidAPI reports whether api is a supported API selection
+func ValidAPI(api string) bool {
+	return api == APIAuto || api == APILegacy || api == APIWevt
+}
+
+// EVT_VARIANT holds one channel configuration property
+type EVT_VARIANT struct {
+	Value uint64
+	Count uint32
+	Type  uint32
+}
+
+// channelAPIs caches the probed API of each channel by server and name
+var channelAPIs = struct {
+	sync.Mutex
+	apis map[string]string
+}{apis: make(map[string]string)}
+
+// ChannelAPI returns the API that reads a channel on server (empty = local
+// computer): APILegacy for classic logs such as Security and System, APIWevt for
+// manifest-based channels, which OpenEventLogW silently replaces with the
+// Application log. Systems without wevtapi.dll, and channels whose configuration
+// can't be read, use the legacy API. The result is cached per channel.
+func ChannelAPI(server, channel string) string {
+	key := strings.ToLower(server + "\x00" + channel)
+	channelAPIs.Lock()
+	defer channelAPIs.Unlock()
+	if api, ok := channelAPIs.apis[key]; ok {
+		return api
+	}
+	api := probeChannelAPI(server, channel)
+	channelAPIs.apis[key] = api
+	return api
+}
+
+// probeChannelAPI reads the ClassicEventlog property of a channel's configuration
+func probeChannelAPI(server, channel string) string {
+	if wevtapi.Load() != nil {
+		return APILegacy // Before Windows Vista
+	}
+	session, err := openSession(server)
+	if err != nil {
+		return APILegacy
+	}
+	if session != 0 {
+		defer evtClose.Call(session)
+	}
+
+	channelUTF16, err := syscall.UTF16PtrFromString(channel)
+	if err != nil {
+		return APILegacy
+	}
+	config, _, err := evtOpenChannelConfig.Call(session, uintptr(unsafe.Pointer(channelUTF16)), 0)
+	if config == 0 {
+		if err.(syscall.Errno) == ERROR_EVT_CHANNEL_NOT_FOUND {
+			return APIWevt // Reports the missing channel instead of reading Application
+		}
+		return APILegacy
+	}
+	defer evtClose.Call(config)
+
+	var value EVT_VARIANT
+	var used uint32
+	ret, _, _ := evtGetChannelConfigProperty.Call(config, EvtChannelConfigClassicEventlog, 0,
+		unsafe.Sizeof(value), uintptr(unsafe.Pointer(&value)), uintptr(unsafe.Pointer(&used)))
+	if ret == 0 || value.Type != EvtVarTypeBoolean || uint32(value.Value) != 0 {
+		return APILegacy
+	}
+	return APIWevt
+}
+
+// resolveAPI returns the API a read of channel uses: api when it forces one,
+// otherwise the probed API
+func resolveAPI(server, channel, api string) string {
+	if api == APILegacy || api == APIWevt {
+		return api
+	}
+	return ChannelAPI(server, channel)
+}
+
+// openSession opens an event log session on server; 0 for the local computer
+func openSession(server string) (uintptr, error) {
+	if server == "" {
+		return 0, nil
+	}
+	serverUTF16, err := syscall.UTF16PtrFromString(server)
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert server name to UTF16: %v", err)
+	}
+	login := EVT_RPC_LOGIN_INFO{Server: serverUTF16}
+	session, _, err := evtOpenSession.Call(EVT_RPC_LOGIN, uintptr(unsafe.Pointer(&login)), 0, 0)
+	if session == 0 {
+		return 0, fmt.Errorf("failed to open event log session on %s: %v", server, err)
+	}
+	return session, nil
+}
+
+// collectEvt reads a channel with EvtQuery, filtering on the XPath of opts, and
+// parses the rendered XML like WinRM output
+func collectEvt(logName string, opts CollectOptions) (*CollectResult, error) {
+	result := &CollectResult{LastRecord: opts.AfterRecord}
+	result.Timings = StageTimings{Channel: logName, API: APIEvtQuery}
+	start := time.Now()
+
+	computerName := GetLocalComputerName()
+	if opts.Server != "" {
+		computerName = opts.Server
+	}
+	session, err := openSession(opts.Server)
+	if err != nil {
+		return nil, &RemoteError{Server: opts.Server, Err: err}
+	}
+	if session != 0 {
+		defer evtClose.Call(session)
+	}
+
+	channelUTF16, err := syscall.UTF16PtrFromString(logName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert log name to UTF16: %v", err)
+	}
+	queryUTF16, err := syscall.UTF16PtrFromString(XPathQuery(opts))
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert query to UTF16: %v", err)
+	}
+	results, _, err := evtQuery.Call(session, uintptr(unsafe.Pointer(channelUTF16)), uintptr(unsafe.Pointer(queryUTF16)),
+		EVT_QUERY_CHANNEL_PATH|EVT_QUERY_FORWARD_DIRECTION)
+	if results == 0 {
+		if err.(syscall.Errno) == ERROR_EVT_CHANNEL_NOT_FOUND {
+			return nil, fmt.Errorf("event log '%s' not found - this channel may not be available on this system", logName)
+		}
+		if opts.Server != "" {
+			return nil, &RemoteError{Server: opts.Server, Err: err}
+		}
+		return nil, fmt.Errorf("failed to query event log: %v", err)
+	}
+	defer evtClose.Call(results)
+
+	// Note how far back the channel goes so a rollover inside the window is reported
+	if !opts.Since.IsZero() {
+		if result.OldestTime, err = oldestEventTime(session, logName); err != nil {
+			return nil, err
+		}
+	}
+	result.Timings.Open = time.Since(start)
+
+	logs := []EventLogData{}
+	collected := 0
+	var memory int64
+
+	// spillEvents moves the events held in memory to the spill file
+	spillEvents := func() error {
+		if result.Spill == nil {
+			spill, err := NewSpill(opts.SpillDir)
+			if err != nil {
+				return err
+			}
+			result.Spill = spill
+		}
+		stampEvents(logs, logName, APIEvtQuery, computerName, opts.Server != "")
+		if err := result.Spill.Write(logs); err != nil {
+			return err
+		}
+		logs = logs[:0]
+		memory = 0
+		return nil
+	}
+
+	handles := make([]uintptr, evtNextBatch)
+	buffer := make([]uint16, 4096)
+	var readErr error
+	for opts.MaxEvents == 0 || collected < opts.MaxEvents {
+		batch := evtNextBatch
+		if opts.MaxEvents > 0 {
+			batch = min(batch, opts.MaxEvents-collected)
+		}
+
+		start = time.Now()
+		// EvtNext waits for remote records at most until the deadline
+		timeout := int64(INFINITE)
+		if !opts.Deadline.IsZero() {
+			remaining := time.Until(opts.Deadline)
+			if remaining <= 0 {
+				result.TimedOut = true
+				break
+			}
+			timeout = min(remaining.Milliseconds()+1, INFINITE-1)
+		}
+		var returned uint32
+		ret, _, err := evtNext.Call(results, uintptr(batch), uintptr(unsafe.Pointer(&handles[0])), uintptr(timeout), 0, uintptr(unsafe.Pointer(&returned)))
+		if ret == 0 {
+			if err.(syscall.Errno) == ERROR_TIMEOUT {
+				result.TimedOut = true
+				break
+			}
+			if err.(syscall.Errno) != ERROR_NO_MORE_ITEMS {
+				readErr = fmt.Errorf("failed to read %s after %d events: %v", logName, collected, err)
+			}
+			break
+		}
+		var doc strings.Builder
+		doc.WriteString("<Events>")
+		for _, handle := range handles[:returned] {
+			if readErr == nil {
+				var xml string
+				if xml, buffer, err = renderEventXML(handle, buffer); err != nil {
+					readErr = fmt.Errorf("failed to render event of %s: %v", logName, err)
+				}
+				doc.WriteString(xml)
+			}
+			evtClose.Call(handle)
+		}
+		doc.WriteString("</Events>")
+		result.Timings.Read += time.Since(start)
+		if readErr != nil {
+			break
+		}
+
+		start = time.Now()
+		events, err := ParseEventXML([]byte(doc.String()))
+		if err != nil {
+			readErr = fmt.Errorf("failed to parse events of %s: %v", logName, err)
+			break
+		}
+		matched := events[:0]
+		for _, event := range events {
+			event.Channel = logName
+			if event.RecordNumber > result.LastRecord {
+				result.LastRecord = event.RecordNumber
+			}
+			if !MatchesLevel(opts.Levels, event.EventType) {
+				continue
+			}
+			if opts.MemoryLimit > 0 {
+				memory += eventSize(&event)
+			}
+			matched = append(matched, event)
+		}
+		logs = append(logs, matched...)
+		collected += len(matched)
+		if opts.MemoryLimit > 0 && memory > opts.MemoryLimit {
+			if err := spillEvents(); err != nil {
+				result.Close()
+				return nil, err
+			}
+		}
+		result.Timings.Parse += time.Since(start)
+	}
+
+	if result.Spill == nil {
+		stampEvents(logs, logName, APIEvtQuery, computerName, opts.Server != "")
+		result.Events = logs
+		return result, readErr
+	}
+	err = spillEvents()
+	if err == nil {
+		err = result.Spill.finish()
+	}
+	if err != nil {
+		result.Close()
+		return nil, err
+	}
+	return result, readErr
+}
+
+// oldestEventTime returns when the oldest event of a channel was logged (zero if
+// the channel is empty)
+func oldestEventTime(session uintptr, channel string) (time.Time, error) {
+	channelUTF16, err := syscall.UTF16PtrFromString(channel)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to convert log name to UTF16: %v", err)
+	}
+	queryUTF16, _ := syscall.UTF16PtrFromString("*")
+	results, _, err := evtQuery.Call(session, uintptr(unsafe.Pointer(channelUTF16)), uintptr(unsafe.Pointer(queryUTF16)),
+		EVT_QUERY_CHANNEL_PATH|EVT_QUERY_FORWARD_DIRECTION)
+	if results == 0 {
+		return time.Time{}, fmt.Errorf("failed to query %s: %v", channel, err)
+	}
+	defer evtClose.Call(results)
+
+	var event uintptr
+	var returned uint32
+	ret, _, err := evtNext.Call(results, 1, uintptr(unsafe.Pointer(&event)), INFINITE, 0, uintptr(unsafe.Pointer(&returned)))
+	if ret == 0 {
+		if err.(syscall.Errno) == ERROR_NO_MORE_ITEMS {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("failed to read the oldest event of %s: %v", channel, err)
+	}
+	defer evtClose.Call(event)
+	xml, _, err := renderEventXML(event, make([]uint16, 4096))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to render the oldest event of %s: %v", channel, err)
+	}
+	events, err := ParseEventXML([]byte("<Events>" + xml + "</Events>"))
+	if err != nil || len(events) == 0 {
+		return time.Time{}, fmt.Errorf("failed to parse the oldest event of %s: %v", channel, err)
+	}
+	return time.Unix(int64(events[0].TimeGenerated), 0), nil
+}
+
+// renderEventXML renders an event handle as XML, growing buffer as needed
+func renderEventXML(event uintptr, buffer []uint16) (string, []uint16, error) {
+	for {
+		var used, properties uint32
+		ret, _, err := evtRender.Call(0, event, EVT_RENDER_EVENT_XML,
+			uintptr(len(buffer)*2), uintptr(unsafe.Pointer(&buffer[0])),
+			uintptr(unsafe.Pointer(&used)), uintptr(unsafe.Pointer(&properties)))
+		if ret != 0 {
+			return syscall.UTF16ToString(buffer[:used/2]), buffer, nil
+		}
+		if err.(syscall.Errno) != syscall.ERROR_INSUFFICIENT_BUFFER {
+			return "", buffer, err
+		}
+		buffer = make([]uint16, used/2+1)
+	}
+}
@@ -0,0 +1,153 @@
+package eventlog
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Coverage compares a requested collection window with what a channel retains
+type Coverage struct {
+	Channel   string
+	Requested time.Time // Start of the requested window
+	Oldest    time.Time // Generation time of the oldest retained record
+}
+
+// Gap reports whether the log rolled over inside the requested window, i.e. events
+// from the start of the window are no longer available
+func (c Coverage) Gap() bool {
+	return !c.Oldest.IsZero() && !c.Requested.IsZero() && c.Oldest.After(c.Requested)
+}
+
+// String describes the coverage gap, e.g. "Security only retains 36 hours, requested 7 days"
+func (c Coverage) String() string {
+	now := time.Now()
+	return fmt.Sprintf("%s only retains %s, requested %s (oldest record %s)",
+		c.Channel, FormatSpan(now.Sub(c.Oldest)), FormatSpan(now.Sub(c.Requested)), c.Oldest.Format(time.RFC3339))
+}
+
+// FormatSpan renders a duration in whole days, hours or minutes
+func FormatSpan(d time.Duration) string {
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	switch {
+	case d >= 72*time.Hour:
+		return plural(int64(d/(24*time.Hour)), "day")
+	case d >= time.Hour:
+		return plural(int64(d/time.Hour), "hour")
+	}
+	return plural(int64(d/time.Minute), "minute")
+}
+
+// readRecordTime returns the generation time of a single record, read with a seek
+func readRecordTime(readEventLog *syscall.LazyProc, handle uintptr, recordNumber uint32) (uint32, error) {
+	bufferSize := uint32(sizeof_EVENTLOGRECORD * 64)
+	for {
+		buffer := make([]byte, bufferSize)
+		var bytesRead, bytesNeeded uint32
+		ret, _, err := readEventLog.Call(
+			handle,
+			uintptr(EVENTLOG_SEEK_READ|EVENTLOG_FORWARDS_READ),
+			uintptr(recordNumber),
+			uintptr(unsafe.Pointer(&buffer[0])),
+			uintptr(bufferSize),
+			uintptr(unsafe.Pointer(&bytesRead)),
+			uintptr(unsafe.Pointer(&bytesNeeded)),
+		)
+		if ret == 0 {
+			if err.(syscall.Errno) == syscall.ERROR_INSUFFICIENT_BUFFER && bytesNeeded > bufferSize {
+				bufferSize = bytesNeeded
+				continue
+			}
+			return 0, fmt.Errorf("failed to read record %d: %v", recordNumber, err)
+		}
+		if bytesRead < sizeof_EVENTLOGRECORD {
+			return 0, fmt.Errorf("short read of record %d", recordNumber)
+		}
+		record := (*EVENTLOGRECORD)(unsafe.Pointer(&buffer[0]))
+		return record.TimeGenerated, nil
+	}
+}
+
+// findFirstRecord binary searches the records first..last for the first one
+// generated at or after since. Records are appended in time order, so the search
+// only reads a handful of records even in very large logs. It returns last+1 when
+// every record is older.
+func findFirstRecord(readEventLog *syscall.LazyProc, handle uintptr, first, last, since uint32) (uint32, error) {
+	lo, hi := first, last+1
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		t, err := readRecordTime(readEventLog, handle, mid)
+		if err != nil {
+			return 0, err
+		}
+		if t < since {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// LogState describes the records a channel currently retains, so a cached read can
+// be checked against the log before it is reused
+type LogState struct {
+	Oldest     uint32 // Oldest retained record number
+	Count      uint32 // Number of retained records
+	RecordTime uint32 // Generation time of the probed record (0 when it is no longer retained)
+}
+
+// Newest returns the newest retained record number (0 when the log is empty)
+func (s LogState) Newest() uint32 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Oldest + s.Count - 1
+}
+
+// ProbeLog reads the record range of a channel on server (empty = local computer)
+// and the generation time of one record (0 = none)
+func ProbeLog(server, logName string, record uint32) (LogState, error) {
+	var state LogState
+
+	advapi32 := syscall.NewLazyDLL("advapi32.dll")
+	openEventLog := advapi32.NewProc("OpenEventLogW")
+	closeEventLog := advapi32.NewProc("CloseEventLog")
+	readEventLog := advapi32.NewProc("ReadEventLogW")
+	getNumberOfEventLogRecords := advapi32.NewProc("GetNumberOfEventLogRecords")
+	getOldestEventLogRecord := advapi32.NewProc("GetOldestEventLogRecord")
+
+	serverNameUTF16, err := syscall.UTF16PtrFromString(server)
+	if err != nil {
+		return state, fmt.Errorf("failed to convert server name to UTF16: %v", err)
+	}
+	logNameUTF16, err := syscall.UTF16PtrFromString(logName)
+	if err != nil {
+		return state, fmt.Errorf("failed to convert log name to UTF16: %v", err)
+	}
+	handle, _, err := openEventLog.Call(uintptr(unsafe.Pointer(serverNameUTF16)), uintptr(unsafe.Pointer(logNameUTF16)))
+	if handle == 0 {
+		return state, fmt.Errorf("failed to open event log: %v", err)
+	}
+	defer closeEventLog.Call(handle)
+
+	if ret, _, _ := getNumberOfEventLogRecords.Call(handle, uintptr(unsafe.Pointer(&state.Count))); ret == 0 {
+		return state, fmt.Errorf("failed to get number of event log records")
+	}
+	if ret, _, _ := getOldestEventLogRecord.Call(handle, uintptr(unsafe.Pointer(&state.Oldest))); ret == 0 {
+		return state, fmt.Errorf("failed to get oldest event log record")
+	}
+
+	if record != 0 && record >= state.Oldest && record <= state.Newest() {
+		if state.RecordTime, err = readRecordTime(readEventLog, handle, record); err != nil {
+			return state, err
+		}
+	}
+	return state, nil
+}
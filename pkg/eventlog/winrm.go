@@ -0,0 +1,333 @@
+package eventlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Transports for remote collection
+const (
+	TransportAuto  = "auto"  // RPC, falling back to WinRM when the host can't be reached over RPC
+	TransportRPC   = "rpc"   // OpenEventLogW against the remote server
+	TransportWinRM = "winrm" // wevtutil run remotely through PowerShell remoting
+)
+
+// ValidTransport reports whether t is a supported transport
+func ValidTransport(t string) bool {
+	return t == TransportAuto || t == TransportRPC || t == TransportWinRM
+}
+
+// RemoteError reports that a remote event log could not be opened over RPC
+type RemoteError struct {
+	Server string
+	Err    error
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("failed to open event log on %s: %v", e.Server, e.Err)
+}
+
+func (e *RemoteError) Unwrap() error {
+	return e.Err
+}
+
+// Credential is an explicit account for WinRM connections. The password is handed to
+// PowerShell through its environment rather than its command line.
+type Credential struct {
+	User     string
+	Password string
+}
+
+// winrmPasswordVariable carries the credential password to the PowerShell child process
+const winrmPasswordVariable = "DATN_WINRM_PASSWORD"
+
+// CollectRemote reads a channel from opts.Server with the given transport. With
+// TransportAuto, WinRM is tried only when the event log service can't be reached
+// over RPC (for example when SMB/RPC ports are firewalled).
+func CollectRemote(logName string, opts CollectOptions, transport string, cred *Credential) (*CollectResult, error) {
+	switch transport {
+	case TransportWinRM:
+		return CollectWinRM(logName, opts, cred)
+	case TransportRPC:
+		return CollectWithOptions(logName, opts)
+	}
+
+	result, err := CollectWithOptions(logName, opts)
+	remoteErr, ok := err.(*RemoteError)
+	if !ok {
+		return result, err
+	}
+
+	result, winrmErr := CollectWinRM(logName, opts, cred)
+	if winrmErr != nil {
+		return nil, fmt.Errorf("%v; WinRM fallback failed: %v", remoteErr, winrmErr)
+	}
+	return result, nil
+}
+
+// xmlEvents is the output of "wevtutil qe /e:Events"
+type xmlEvents struct {
+	Events []xmlEvent `xml:"Event"`
+}
+
+// xmlEvent is one event rendered as XML
+type xmlEvent struct {
+	System struct {
+		Provider struct {
+			Name string `xml:"Name,attr"`
+		} `xml:"Provider"`
+		EventID     uint32 `xml:"EventID"`
+		Level       uint8  `xml:"Level"`
+		Task        uint16 `xml:"Task"`
+		Keywords    string `xml:"Keywords"`
+		TimeCreated struct {
+			SystemTime string `xml:"SystemTime,attr"`
+		} `xml:"TimeCreated"`
+		EventRecordID uint32 `xml:"EventRecordID"`
+		Channel       string `xml:"Channel"`
+		Computer      string `xml:"Computer"`
+		Security      struct {
+			UserID string `xml:"UserID,attr"`
+		} `xml:"Security"`
+	} `xml:"System"`
+	EventData struct {
+		Data []struct {
+			Name  string `xml:"Name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"Data"`
+	} `xml:"EventData"`
+	RenderingInfo struct {
+		Message string `xml:"Message"`
+	} `xml:"RenderingInfo"`
+}
+
+// Audit keyword bits of Security events
+const (
+	keywordAuditFailure = 0x0010000000000000
+	keywordAuditSuccess = 0x0020000000000000
+)
+
+// CollectWinRM reads a channel from opts.Server by running wevtutil through
+// PowerShell remoting (Invoke-Command), which authenticates with Kerberos or NTLM
+// over the WinRM port. The XML result is converted into the same EventLogData the
+// RPC reader produces.
+func CollectWinRM(logName string, opts CollectOptions, cred *Credential) (*CollectResult, error) {
+	if opts.Server == "" {
+		return nil, fmt.Errorf("WinRM collection requires a server name")
+	}
+
+	ctx := context.Background()
+	if !opts.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, opts.Deadline)
+		defer cancel()
+	}
+
+	// Note how far back the channel goes so a rollover inside the window is
+	// reported; wevtutil returns the oldest event first
+	var oldest time.Time
+	if !opts.Since.IsZero() {
+		output, err := runWinRM(ctx, logName, CollectOptions{Server: opts.Server, MaxEvents: 1}, cred)
+		if err != nil {
+			return nil, err
+		}
+		events, err := ParseEventXML(output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse WinRM result from %s: %v", opts.Server, err)
+		}
+		if len(events) > 0 {
+			oldest = time.Unix(int64(events[0].TimeGenerated), 0)
+		}
+	}
+
+	start := time.Now()
+	output, err := runWinRM(ctx, logName, opts, cred)
+	if err != nil {
+		return nil, err
+	}
+	read := time.Since(start)
+
+	start = time.Now()
+	events, err := ParseEventXML(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse WinRM result from %s: %v", opts.Server, err)
+	}
+
+	result := &CollectResult{Events: events[:0], LastRecord: opts.AfterRecord, OldestTime: oldest}
+	result.Timings = StageTimings{Channel: logName, API: APIWinRM, Read: read}
+	for _, event := range events {
+		event.Channel = logName
+		if event.RecordNumber > result.LastRecord {
+			result.LastRecord = event.RecordNumber
+		}
+		if MatchesLevel(opts.Levels, event.EventType) {
+			result.Events = append(result.Events, event)
+		}
+	}
+	stampEvents(result.Events, logName, APIWinRM, opts.Server, true)
+	result.Timings.Parse = time.Since(start)
+	return result, nil
+}
+
+// runWinRM runs the wevtutil query of opts on opts.Server and returns its XML output
+func runWinRM(ctx context.Context, logName string, opts CollectOptions, cred *Credential) ([]byte, error) {
+	script := winrmScript(logName, opts, cred)
+	cmd := exec.CommandContext(ctx, "powershell.exe", "-NoProfile", "-NonInteractive", "-EncodedCommand", encodePowerShell(script))
+	cmd.Env = os.Environ()
+	if cred != nil {
+		cmd.Env = append(cmd.Env, winrmPasswordVariable+"="+cred.Password)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// The query returns all events at once, so there is nothing partial to keep
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("WinRM query of %s on %s timed out", logName, opts.Server)
+		}
+		return nil, fmt.Errorf("WinRM query of %s on %s failed: %v: %s", logName, opts.Server, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// winrmScript builds the PowerShell that runs wevtutil on the remote host
+func winrmScript(logName string, opts CollectOptions, cred *Credential) string {
+	var b strings.Builder
+	b.WriteString("$ErrorActionPreference = 'Stop'\n")
+	b.WriteString("[Console]::OutputEncoding = [Text.Encoding]::UTF8\n")
+	b.WriteString("$params = @{ ComputerName = " + psQuote(opts.Server) + " }\n")
+	if cred != nil {
+		b.WriteString("$password = ConvertTo-SecureString $env:" + winrmPasswordVariable + " -AsPlainText -Force\n")
+		b.WriteString("$params.Credential = New-Object System.Management.Automation.PSCredential(" + psQuote(cred.User) + ", $password)\n")
+	}
+	b.WriteString("Invoke-Command @params -ScriptBlock {\n")
+	b.WriteString("  param($channel, $query, $count, $locale)\n")
+	b.WriteString("  $wargs = @('qe', $channel, \"/q:$query\", '/e:Events')\n")
+	b.WriteString("  if ($count -gt 0) { $wargs += \"/c:$count\" }\n")
+	b.WriteString("  if ($locale) { $wargs += @('/f:RenderedXml', \"/l:$locale\") }\n")
+	b.WriteString("  & wevtutil.exe @wargs\n")
+	b.WriteString("  if ($LASTEXITCODE -ne 0) { throw \"wevtutil exited with code $LASTEXITCODE\" }\n")
+	fmt.Fprintf(&b, "} -ArgumentList %s, %s, %d, %s\n", psQuote(logName), psQuote(XPathQuery(opts)), opts.MaxEvents, psQuote(opts.Locale))
+	return b.String()
+}
+
+// XPathQuery translates the collect options into an event log XPath filter
+func XPathQuery(opts CollectOptions) string {
+	var conditions []string
+	if len(opts.EventIDs) > 0 {
+		ids := make([]string, len(opts.EventIDs))
+		for i, id := range opts.EventIDs {
+			ids[i] = "EventID=" + strconv.FormatUint(uint64(id), 10)
+		}
+		conditions = append(conditions, "("+strings.Join(ids, " or ")+")")
+	}
+	if levels := levelXPath(opts.Levels); levels != "" {
+		conditions = append(conditions, levels)
+	}
+	if opts.AfterRecord > 0 {
+		conditions = append(conditions, "(EventRecordID>"+strconv.FormatUint(uint64(opts.AfterRecord), 10)+")")
+	}
+	if !opts.Since.IsZero() {
+		conditions = append(conditions, "(TimeCreated[@SystemTime>='"+opts.Since.UTC().Format("2006-01-02T15:04:05.000Z")+"'])")
+	}
+	if len(conditions) == 0 {
+		return "*"
+	}
+	return "*[System[" + strings.Join(conditions, " and ") + "]]"
+}
+
+// psQuote quotes a string as a PowerShell single-quoted literal
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// encodePowerShell encodes a script for -EncodedCommand (base64 of UTF-16LE)
+func encodePowerShell(script string) string {
+	units := utf16.Encode([]rune(script))
+	buf := make([]byte, len(units)*2)
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(buf[i*2:], u)
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// ParseEventXML converts rendered event XML (an <Events> document) into EventLogData.
+// EventData values become the insertion strings, in order, and their names are
+// remembered for FieldNames.
+func ParseEventXML(data []byte) ([]EventLogData, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("\xef\xbb\xbf"))
+	if len(data) == 0 {
+		return []EventLogData{}, nil
+	}
+
+	var doc xmlEvents
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	events := make([]EventLogData, 0, len(doc.Events))
+	for _, e := range doc.Events {
+		var generated uint32
+		if t, err := time.Parse(time.RFC3339Nano, e.System.TimeCreated.SystemTime); err == nil {
+			generated = uint32(t.Unix())
+		}
+
+		values := make([]string, len(e.EventData.Data))
+		names := make([]string, len(e.EventData.Data))
+		named := false
+		for i, data := range e.EventData.Data {
+			values[i] = data.Value
+			names[i] = data.Name
+			named = named || data.Name != ""
+		}
+		if named {
+			learnFieldNames(e.System.Channel, e.System.EventID, names)
+		}
+
+		events = append(events, EventLogData{
+			Channel:       e.System.Channel,
+			RecordNumber:  e.System.EventRecordID,
+			TimeGenerated: generated,
+			TimeWritten:   generated,
+			EventID:       e.System.EventID,
+			EventType:     eventTypeFromLevel(e.System.Level, e.System.Keywords),
+			EventCategory: e.System.Task,
+			SourceName:    e.System.Provider.Name,
+			ComputerName:  e.System.Computer,
+			UserSid:       e.System.Security.UserID,
+			Strings:       values,
+			Message:       strings.TrimSpace(e.RenderingInfo.Message),
+		})
+	}
+	return events, nil
+}
+
+// eventTypeFromLevel maps an XML event level and keywords to the legacy event type
+func eventTypeFromLevel(level uint8, keywords string) uint16 {
+	if k, err := strconv.ParseUint(strings.TrimPrefix(keywords, "0x"), 16, 64); err == nil {
+		switch {
+		case k&keywordAuditFailure != 0:
+			return EVENTLOG_AUDIT_FAILURE
+		case k&keywordAuditSuccess != 0:
+			return EVENTLOG_AUDIT_SUCCESS
+		}
+	}
+
+	switch level {
+	case 1, 2: // Critical, Error
+		return EVENTLOG_ERROR_TYPE
+	case 3:
+		return EVENTLOG_WARNING_TYPE
+	}
+	return EVENTLOG_INFORMATION_TYPE
+}
@@ -0,0 +1,602 @@
+package evtx
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Binary XML tokens. The 0x40 bit marks elements with attributes, attributes
+// followed by another attribute and values followed by more content.
+const (
+	tokenEOF                  = 0x00
+	tokenOpenStartElement     = 0x01
+	tokenCloseStartElement    = 0x02
+	tokenCloseEmptyElement    = 0x03
+	tokenEndElement           = 0x04
+	tokenValue                = 0x05
+	tokenAttribute            = 0x06
+	tokenCDATA                = 0x07
+	tokenCharRef              = 0x08
+	tokenEntityRef            = 0x09
+	tokenPITarget             = 0x0a
+	tokenPIData               = 0x0b
+	tokenTemplateInstance     = 0x0c
+	tokenNormalSubstitution   = 0x0d
+	tokenOptionalSubstitution = 0x0e
+	tokenFragmentHeader       = 0x0f
+
+	tokenMore = 0x40
+)
+
+// Value types of substitutions and value tokens
+const (
+	typeNull       = 0x00
+	typeString     = 0x01
+	typeAnsiString = 0x02
+	typeInt8       = 0x03
+	typeUInt8      = 0x04
+	typeInt16      = 0x05
+	typeUInt16     = 0x06
+	typeInt32      = 0x07
+	typeUInt32     = 0x08
+	typeInt64      = 0x09
+	typeUInt64     = 0x0a
+	typeFloat      = 0x0b
+	typeDouble     = 0x0c
+	typeBool       = 0x0d
+	typeBinary     = 0x0e
+	typeGUID       = 0x0f
+	typeSizeT      = 0x10
+	typeFileTime   = 0x11
+	typeSystemTime = 0x12
+	typeSID        = 0x13
+	typeHexInt32   = 0x14
+	typeHexInt64   = 0x15
+	typeBinXML     = 0x21
+	typeArray      = 0x80
+)
+
+// templateHeaderSize is the size of a template definition header: the offset of
+// the next definition, the template GUID and the size of the definition
+const templateHeaderSize = 24
+
+// maxDepth bounds nested templates and elements in a corrupt chunk
+const maxDepth = 64
+
+// maxWork bounds the tokens and substitution bytes rendered for one record. A
+// real record renders each token of its template once, well below this; a corrupt
+// template that instantiates itself would otherwise take exponential time.
+const maxWork = 1 << 22
+
+// reader reads little-endian values from a chunk. Offsets are relative to the
+// chunk, which is how names and templates refer to each other.
+type reader struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+// need fails when fewer than n bytes are left
+func (r *reader) need(n int) error {
+	if n < 0 || r.pos < 0 || r.pos > len(r.data) || n > len(r.data)-r.pos {
+		return fmt.Errorf("truncated binary XML at offset %d", r.pos)
+	}
+	return nil
+}
+
+func (r *reader) u8() (byte, error) {
+	if err := r.need(1); err != nil {
+		return 0, err
+	}
+	r.pos++
+	return r.data[r.pos-1], nil
+}
+
+func (r *reader) u16() (uint16, error) {
+	if err := r.need(2); err != nil {
+		return 0, err
+	}
+	r.pos += 2
+	return binary.LittleEndian.Uint16(r.data[r.pos-2:]), nil
+}
+
+func (r *reader) u32() (uint32, error) {
+	if err := r.need(4); err != nil {
+		return 0, err
+	}
+	r.pos += 4
+	return binary.LittleEndian.Uint32(r.data[r.pos-4:]), nil
+}
+
+func (r *reader) bytes(n int) ([]byte, error) {
+	if err := r.need(n); err != nil {
+		return nil, err
+	}
+	r.pos += n
+	return r.data[r.pos-n : r.pos], nil
+}
+
+// utf16 reads a string of n UTF-16 characters
+func (r *reader) utf16(n int) (string, error) {
+	data, err := r.bytes(2 * n)
+	if err != nil {
+		return "", err
+	}
+	return decodeUTF16(data), nil
+}
+
+// substitution is one value of a template instance
+type substitution struct {
+	kind byte
+	data []byte
+	pos  int // Chunk offset of data, to render nested binary XML
+}
+
+// parser renders the binary XML of one record of a chunk
+type parser struct {
+	chunk []byte
+	work  int // Left of maxWork
+}
+
+// newParser returns a parser for one record of a chunk
+func newParser(chunk []byte) *parser {
+	return &parser{chunk: chunk, work: maxWork}
+}
+
+// spend charges n units of work, failing once the record used up maxWork
+func (p *parser) spend(n int, r *reader) error {
+	p.work -= n
+	if p.work < 0 {
+		return fmt.Errorf("binary XML expands too much at offset %d", r.pos)
+	}
+	return nil
+}
+
+// offset checks that a chunk offset read from the data, plus n bytes, lies within
+// the chunk, before it is converted to an int that could overflow on 32-bit builds
+func (p *parser) offset(offset uint32, n int) (int, error) {
+	if uint64(offset)+uint64(n) > uint64(len(p.chunk)) {
+		return 0, fmt.Errorf("offset %d is outside the chunk", offset)
+	}
+	return int(offset), nil
+}
+
+// fragment renders tokens up to the end of a fragment
+func (p *parser) fragment(r *reader, subs []substitution, out *strings.Builder) error {
+	for {
+		if err := p.spend(1, r); err != nil {
+			return err
+		}
+		token, err := r.u8()
+		if err != nil {
+			return err
+		}
+		switch token &^ tokenMore {
+		case tokenEOF:
+			return nil
+		case tokenFragmentHeader:
+			if _, err := r.bytes(3); err != nil { // Major and minor version, flags
+				return err
+			}
+		case tokenTemplateInstance:
+			if err := p.template(r, out); err != nil {
+				return err
+			}
+		case tokenOpenStartElement:
+			if err := p.element(r, token, subs, out); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected token 0x%02x at offset %d", token, r.pos-1)
+		}
+	}
+}
+
+// name reads a name offset and returns the name. Names are stored once per chunk;
+// the first use of a name is followed by the name itself, which is skipped.
+func (p *parser) name(r *reader) (string, error) {
+	value, err := r.u32()
+	if err != nil {
+		return "", err
+	}
+	offset, err := p.offset(value, 8)
+	if err != nil {
+		return "", err
+	}
+	names := &reader{data: p.chunk, pos: offset + 6} // Skip the next name offset and hash
+	length, err := names.u16()
+	if err != nil {
+		return "", err
+	}
+	name, err := names.utf16(int(length))
+	if err != nil {
+		return "", err
+	}
+	if offset == r.pos {
+		r.pos += 10 + 2*int(length) // Header, characters and the terminating NUL
+	}
+	return name, nil
+}
+
+// template renders a template instance: the template definition with the
+// substitution values that follow the instance
+func (p *parser) template(r *reader, out *strings.Builder) error {
+	if r.depth >= maxDepth {
+		return fmt.Errorf("templates nested too deeply at offset %d", r.pos)
+	}
+	if _, err := r.bytes(5); err != nil { // Unknown byte and template ID
+		return err
+	}
+	value, err := r.u32()
+	if err != nil {
+		return err
+	}
+	definition, err := p.offset(value, templateHeaderSize)
+	if err != nil {
+		return err
+	}
+	if definition == r.pos {
+		// The definition is stored inline on its first use in the chunk
+		if _, err := r.bytes(templateHeaderSize - 4); err != nil {
+			return err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return err
+		}
+		if _, err := r.bytes(int(size)); err != nil {
+			return err
+		}
+	}
+
+	count, err := r.u32()
+	if err != nil {
+		return err
+	}
+	// Each substitution has a 4 byte descriptor, which bounds the count by the
+	// bytes left before the count can overflow
+	if err := r.need(0); err != nil {
+		return err
+	}
+	if uint64(count) > uint64(len(r.data)-r.pos)/4 {
+		return fmt.Errorf("%d substitutions at offset %d exceed the record", count, r.pos)
+	}
+	subs := make([]substitution, count)
+	sizes := make([]int, count)
+	for i := range subs {
+		size, _ := r.u16()
+		sizes[i] = int(size)
+		subs[i].kind, _ = r.u8()
+		r.pos++ // Padding
+	}
+	for i := range subs {
+		subs[i].pos = r.pos
+		if subs[i].data, err = r.bytes(sizes[i]); err != nil {
+			return err
+		}
+	}
+
+	body := &reader{data: p.chunk, pos: definition + templateHeaderSize, depth: r.depth + 1}
+	return p.fragment(body, subs, out)
+}
+
+// element renders an element, its attributes and its content
+func (p *parser) element(r *reader, token byte, subs []substitution, out *strings.Builder) error {
+	if r.depth >= maxDepth {
+		return fmt.Errorf("elements nested too deeply at offset %d", r.pos)
+	}
+	if _, err := r.bytes(6); err != nil { // Dependency identifier and data size
+		return err
+	}
+	name, err := p.name(r)
+	if err != nil {
+		return err
+	}
+	out.WriteString("<" + name)
+
+	if token&tokenMore != 0 {
+		if _, err := r.u32(); err != nil { // Size of the attribute list
+			return err
+		}
+		for {
+			attribute, err := r.u8()
+			if err != nil {
+				return err
+			}
+			if attribute&^tokenMore != tokenAttribute {
+				return fmt.Errorf("unexpected token 0x%02x in attributes of %s", attribute, name)
+			}
+			attributeName, err := p.name(r)
+			if err != nil {
+				return err
+			}
+			var value strings.Builder
+			if err := p.value(r, subs, &value); err != nil {
+				return err
+			}
+			out.WriteString(" " + attributeName + "=\"" + value.String() + "\"")
+			if attribute&tokenMore == 0 {
+				break
+			}
+		}
+	}
+
+	close, err := r.u8()
+	if err != nil {
+		return err
+	}
+	switch close {
+	case tokenCloseEmptyElement:
+		out.WriteString("/>")
+		return nil
+	case tokenCloseStartElement:
+		out.WriteString(">")
+	default:
+		return fmt.Errorf("unexpected token 0x%02x after start of %s", close, name)
+	}
+
+	r.depth++
+	defer func() { r.depth-- }()
+	for {
+		if err := p.spend(1, r); err != nil {
+			return err
+		}
+		next, err := r.u8()
+		if err != nil {
+			return err
+		}
+		switch next &^ tokenMore {
+		case tokenEndElement:
+			out.WriteString("</" + name + ">")
+			return nil
+		case tokenOpenStartElement:
+			if err := p.element(r, next, subs, out); err != nil {
+				return err
+			}
+		default:
+			r.pos--
+			if err := p.value(r, subs, out); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// value renders one content token: text, a substitution, a reference, CDATA or a
+// processing instruction
+func (p *parser) value(r *reader, subs []substitution, out *strings.Builder) error {
+	token, err := r.u8()
+	if err != nil {
+		return err
+	}
+	switch token &^ tokenMore {
+	case tokenValue:
+		if _, err := r.u8(); err != nil { // Always a string
+			return err
+		}
+		length, err := r.u16()
+		if err != nil {
+			return err
+		}
+		text, err := r.utf16(int(length))
+		if err != nil {
+			return err
+		}
+		xml.EscapeText(out, []byte(text))
+	case tokenNormalSubstitution, tokenOptionalSubstitution:
+		id, err := r.u16()
+		if err != nil {
+			return err
+		}
+		if _, err := r.u8(); err != nil { // Declared type, the value carries its own
+			return err
+		}
+		if int(id) < len(subs) {
+			return p.substitution(r, subs[id], out)
+		}
+	case tokenCharRef:
+		char, err := r.u16()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "&#%d;", char)
+	case tokenEntityRef:
+		name, err := p.name(r)
+		if err != nil {
+			return err
+		}
+		out.WriteString("&" + name + ";")
+	case tokenCDATA:
+		length, err := r.u16()
+		if err != nil {
+			return err
+		}
+		text, err := r.utf16(int(length))
+		if err != nil {
+			return err
+		}
+		out.WriteString("<![CDATA[" + text + "]]>")
+	case tokenPITarget:
+		target, err := p.name(r)
+		if err != nil {
+			return err
+		}
+		if token, err = r.u8(); err != nil || token != tokenPIData {
+			return fmt.Errorf("missing data of processing instruction %s", target)
+		}
+		length, err := r.u16()
+		if err != nil {
+			return err
+		}
+		data, err := r.utf16(int(length))
+		if err != nil {
+			return err
+		}
+		out.WriteString("<?" + target + " " + data + "?>")
+	default:
+		return fmt.Errorf("unexpected token 0x%02x at offset %d", token, r.pos-1)
+	}
+	return nil
+}
+
+// substitution renders a substitution value; nested binary XML is rendered as
+// markup, everything else as escaped text
+func (p *parser) substitution(r *reader, sub substitution, out *strings.Builder) error {
+	if err := p.spend(len(sub.data), r); err != nil {
+		return err
+	}
+	if sub.kind == typeBinXML {
+		nested := &reader{data: p.chunk[:sub.pos+len(sub.data)], pos: sub.pos, depth: r.depth + 1}
+		return p.fragment(nested, nil, out)
+	}
+	xml.EscapeText(out, []byte(formatValue(sub.kind, sub.data)))
+	return nil
+}
+
+// formatValue renders a substitution value the way the event log service does
+func formatValue(kind byte, data []byte) string {
+	if kind&typeArray != 0 {
+		return formatArray(kind&^typeArray, data)
+	}
+
+	le := binary.LittleEndian
+	switch {
+	case kind == typeNull:
+		return ""
+	case kind == typeString:
+		return strings.TrimRight(decodeUTF16(data), "\x00")
+	case kind == typeAnsiString:
+		return strings.TrimRight(string(data), "\x00")
+	case kind == typeBinary:
+		return strings.ToUpper(hex.EncodeToString(data))
+	}
+
+	size := fixedSize(kind)
+	if size == 0 || len(data) < size {
+		if kind == typeSID {
+			return formatSID(data)
+		}
+		if kind == typeSizeT && len(data) == 4 {
+			return fmt.Sprintf("0x%08x", le.Uint32(data))
+		}
+		return strings.ToUpper(hex.EncodeToString(data))
+	}
+	switch kind {
+	case typeInt8:
+		return strconv.Itoa(int(int8(data[0])))
+	case typeUInt8:
+		return strconv.Itoa(int(data[0]))
+	case typeInt16:
+		return strconv.Itoa(int(int16(le.Uint16(data))))
+	case typeUInt16:
+		return strconv.Itoa(int(le.Uint16(data)))
+	case typeInt32:
+		return strconv.FormatInt(int64(int32(le.Uint32(data))), 10)
+	case typeUInt32:
+		return strconv.FormatUint(uint64(le.Uint32(data)), 10)
+	case typeInt64:
+		return strconv.FormatInt(int64(le.Uint64(data)), 10)
+	case typeUInt64:
+		return strconv.FormatUint(le.Uint64(data), 10)
+	case typeFloat:
+		return strconv.FormatFloat(float64(math.Float32frombits(le.Uint32(data))), 'g', -1, 32)
+	case typeDouble:
+		return strconv.FormatFloat(math.Float64frombits(le.Uint64(data)), 'g', -1, 64)
+	case typeBool:
+		return strconv.FormatBool(le.Uint32(data) != 0)
+	case typeGUID:
+		return fmt.Sprintf("{%08X-%04X-%04X-%X-%X}", le.Uint32(data), le.Uint16(data[4:]), le.Uint16(data[6:]), data[8:10], data[10:16])
+	case typeSizeT, typeHexInt64:
+		return fmt.Sprintf("0x%016x", le.Uint64(data))
+	case typeHexInt32:
+		return fmt.Sprintf("0x%08x", le.Uint32(data))
+	case typeFileTime:
+		return filetimeToTime(le.Uint64(data)).Format("2006-01-02T15:04:05.0000000Z")
+	case typeSystemTime:
+		t := time.Date(int(le.Uint16(data)), time.Month(le.Uint16(data[2:])), int(le.Uint16(data[6:])),
+			int(le.Uint16(data[8:])), int(le.Uint16(data[10:])), int(le.Uint16(data[12:])),
+			int(le.Uint16(data[14:]))*int(time.Millisecond), time.UTC)
+		return t.Format("2006-01-02T15:04:05.000Z")
+	}
+	return strings.ToUpper(hex.EncodeToString(data))
+}
+
+// fixedSize returns the size of a fixed-size value type, or 0
+func fixedSize(kind byte) int {
+	switch kind {
+	case typeInt8, typeUInt8:
+		return 1
+	case typeInt16, typeUInt16:
+		return 2
+	case typeInt32, typeUInt32, typeFloat, typeBool, typeHexInt32:
+		return 4
+	case typeInt64, typeUInt64, typeDouble, typeFileTime, typeHexInt64:
+		return 8
+	case typeSizeT:
+		return 8 // 4 byte values are handled by the caller
+	case typeGUID, typeSystemTime:
+		return 16
+	}
+	return 0
+}
+
+// formatArray renders an array value as its elements separated by commas
+func formatArray(kind byte, data []byte) string {
+	var items []string
+	switch kind {
+	case typeString:
+		items = strings.Split(strings.TrimRight(decodeUTF16(data), "\x00"), "\x00")
+	case typeAnsiString:
+		items = strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+	default:
+		size := fixedSize(kind)
+		if size == 0 {
+			return strings.ToUpper(hex.EncodeToString(data))
+		}
+		for i := 0; i+size <= len(data); i += size {
+			items = append(items, formatValue(kind, data[i:i+size]))
+		}
+	}
+	return strings.Join(items, ", ")
+}
+
+// formatSID renders a binary SID as S-1-5-...
+func formatSID(data []byte) string {
+	if len(data) < 8 || len(data) < 8+4*int(data[1]) {
+		return strings.ToUpper(hex.EncodeToString(data))
+	}
+	var authority uint64
+	for _, b := range data[2:8] {
+		authority = authority<<8 | uint64(b)
+	}
+	sid := fmt.Sprintf("S-%d-%d", data[0], authority)
+	for i := 0; i < int(data[1]); i++ {
+		sid += fmt.Sprintf("-%d", binary.LittleEndian.Uint32(data[8+4*i:]))
+	}
+	return sid
+}
+
+// decodeUTF16 decodes little-endian UTF-16
+func decodeUTF16(data []byte) string {
+	chars := make([]uint16, len(data)/2)
+	for i := range chars {
+		chars[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(chars))
+}
+
+// filetimeToTime converts a FILETIME (100 ns intervals since 1601) to a time
+func filetimeToTime(filetime uint64) time.Time {
+	const epochDifference = 116444736000000000 // 1601-01-01 to 1970-01-01 in 100 ns
+	if filetime < epochDifference {
+		return time.Unix(0, 0).UTC()
+	}
+	return time.Unix(0, int64(filetime-epochDifference)*100).UTC()
+}
@@ -0,0 +1,215 @@
+package evtx
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// recordOffset is where the fixtures put their record, after the chunk header
+const recordOffset = chunkHeaderSize
+
+// chunkBuilder writes binary XML into a chunk at increasing offsets
+type chunkBuilder struct {
+	chunk []byte
+	pos   int
+}
+
+func newChunkBuilder() *chunkBuilder {
+	return &chunkBuilder{chunk: make([]byte, chunkSize), pos: recordOffset}
+}
+
+func (b *chunkBuilder) u8(values ...byte) {
+	b.pos += copy(b.chunk[b.pos:], values)
+}
+
+func (b *chunkBuilder) u16(v uint16) {
+	binary.LittleEndian.PutUint16(b.chunk[b.pos:], v)
+	b.pos += 2
+}
+
+func (b *chunkBuilder) u32(v uint32) {
+	binary.LittleEndian.PutUint32(b.chunk[b.pos:], v)
+	b.pos += 4
+}
+
+func (b *chunkBuilder) utf16(s string) {
+	for _, c := range utf16.Encode([]rune(s)) {
+		b.u16(c)
+	}
+}
+
+// name writes a name offset followed by the name, as on its first use in a chunk
+func (b *chunkBuilder) name(s string) {
+	b.u32(uint32(b.pos + 4))
+	b.u32(0) // Next name offset
+	b.u16(0) // Hash
+	b.u16(uint16(len(s)))
+	b.utf16(s)
+	b.u16(0)
+}
+
+// fragmentHeader writes the header that starts every fragment
+func (b *chunkBuilder) fragmentHeader() {
+	b.u8(tokenFragmentHeader, 1, 1, 0)
+}
+
+// instance writes a template instance token referring to the definition at
+// offset, without substitutions
+func (b *chunkBuilder) instance(definition uint32) {
+	b.u8(tokenTemplateInstance, 1)
+	b.u32(0) // Template ID
+	b.u32(definition)
+	b.u32(0) // Substitution count
+}
+
+// definition writes a template definition header whose body follows; it returns
+// the definition offset
+func (b *chunkBuilder) definition() uint32 {
+	offset := uint32(b.pos)
+	b.u32(0)    // Next definition offset
+	b.pos += 16 // Template GUID
+	b.u32(0)    // Size, only read for inline definitions
+	return offset
+}
+
+// validRecord builds a record instantiating an inline template whose body is
+// <Event>%1</Event>, with the string substitution "hi"; it returns the chunk and
+// the end of the record
+func validRecord() ([]byte, int) {
+	b := newChunkBuilder()
+	b.fragmentHeader()
+	b.u8(tokenTemplateInstance, 1)
+	b.u32(0)                 // Template ID
+	b.u32(uint32(b.pos + 4)) // Defined inline
+	b.u32(0)                 // Next definition offset
+	b.pos += 16              // Template GUID
+	sizeAt := b.pos
+	b.u32(0)
+	bodyStart := b.pos
+	b.fragmentHeader()
+	b.u8(tokenOpenStartElement)
+	b.u16(0) // Dependency identifier
+	b.u32(0) // Data size
+	b.name("Event")
+	b.u8(tokenCloseStartElement)
+	b.u8(tokenOptionalSubstitution)
+	b.u16(0)
+	b.u8(typeString)
+	b.u8(tokenEndElement, tokenEOF)
+	binary.LittleEndian.PutUint32(b.chunk[sizeAt:], uint32(b.pos-bodyStart))
+
+	b.u32(1) // Substitution count
+	b.u16(4) // Size
+	b.u8(typeString, 0)
+	b.utf16("hi")
+	b.u8(tokenEOF)
+	return b.chunk, b.pos
+}
+
+// render renders the record at recordOffset that ends at end
+func render(chunk []byte, end int) (string, error) {
+	var out strings.Builder
+	err := newParser(chunk).fragment(&reader{data: chunk[:end], pos: recordOffset}, nil, &out)
+	return out.String(), err
+}
+
+func TestRenderTemplate(t *testing.T) {
+	chunk, end := validRecord()
+	xml, err := render(chunk, end)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if xml != "<Event>hi</Event>" {
+		t.Errorf("render = %q, want %q", xml, "<Event>hi</Event>")
+	}
+}
+
+func TestRenderTruncated(t *testing.T) {
+	chunk, end := validRecord()
+	for n := recordOffset; n < end; n++ {
+		if _, err := render(chunk, n); err == nil {
+			t.Errorf("record truncated to %d of %d bytes rendered without an error", n-recordOffset, end-recordOffset)
+		}
+	}
+}
+
+func TestRenderOffsetOutsideChunk(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(b *chunkBuilder)
+	}{
+		{"name offset", func(b *chunkBuilder) {
+			b.u8(tokenOpenStartElement)
+			b.u16(0)
+			b.u32(0)
+			b.u32(0xfffffff0)
+		}},
+		{"template offset", func(b *chunkBuilder) {
+			b.instance(0xfffffff0)
+		}},
+		{"substitution count", func(b *chunkBuilder) {
+			b.u8(tokenTemplateInstance, 1)
+			b.u32(0)
+			b.u32(uint32(recordOffset)) // Any offset inside the chunk
+			b.u32(0x40000001)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newChunkBuilder()
+			b.fragmentHeader()
+			tt.build(b)
+			if _, err := render(b.chunk, b.pos); err == nil {
+				t.Error("rendered without an error")
+			}
+		})
+	}
+}
+
+func TestRenderSelfReferencingTemplate(t *testing.T) {
+	b := newChunkBuilder()
+	b.fragmentHeader()
+	b.instance(2048)
+	b.u8(tokenEOF)
+	end := b.pos
+
+	b.pos = 2048
+	definition := b.definition()
+	b.fragmentHeader()
+	b.instance(definition)
+	b.instance(definition)
+	b.u8(tokenEOF)
+
+	if _, err := render(b.chunk, end); err == nil {
+		t.Error("self-referencing template rendered without an error")
+	}
+}
+
+func TestRenderTemplateChain(t *testing.T) {
+	// Each template instantiates the next one twice, 2^40 instances in all but
+	// below maxDepth, so only the work budget stops it
+	const templates = 40
+	b := newChunkBuilder()
+	b.fragmentHeader()
+	b.instance(4096)
+	b.u8(tokenEOF)
+	end := b.pos
+
+	b.pos = 4096
+	for i := 0; i < templates; i++ {
+		b.definition()
+		b.fragmentHeader()
+		if i < templates-1 {
+			next := uint32(b.pos + 2*14 + 1) // After the two instances and the EOF
+			b.instance(next)
+			b.instance(next)
+		}
+		b.u8(tokenEOF)
+	}
+
+	if _, err := render(b.chunk, end); err == nil || !strings.Contains(err.Error(), "expands too much") {
+		t.Errorf("render = %v, want the work budget error", err)
+	}
+}
@@ -0,0 +1,136 @@
+package evtx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Layout of an .evtx file: a file header block followed by 64 KB chunks, each with
+// its own string and template tables and a run of event records
+const (
+	fileHeaderSize  = 4096
+	chunkSize       = 65536
+	chunkHeaderSize = 512
+	recordHeaderLen = 24 // Signature, size, record ID and written time
+
+	// Chunk header fields
+	chunkFreeSpaceOffset = 48
+)
+
+var (
+	fileSignature   = []byte("ElfFile\x00")
+	chunkSignature  = []byte("ElfChnk\x00")
+	recordSignature = []byte{0x2a, 0x2a, 0x00, 0x00}
+)
+
+// Record is one event record of an .evtx file
+type Record struct {
+	ID      uint64
+	Written uint64 // FILETIME
+	XML     string // The event rendered as XML, as wevtutil would show it
+}
+
+// Scan reads a saved .evtx file without the event log service, so logs exported
+// from other machines can be examined anywhere. Each record's binary XML is
+// rendered and parsed like WinRM output; records that fail to decode are skipped
+// and counted. Events without a channel take the file name, minus the extension.
+func Scan(path string, fn func(eventlog.EventLogData) error) (skipped int, err error) {
+	fallback := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	err = ScanRecords(path, func(record Record, decodeErr error) error {
+		if decodeErr != nil {
+			skipped++
+			return nil
+		}
+		events, err := eventlog.ParseEventXML([]byte("<Events>" + record.XML + "</Events>"))
+		if err != nil || len(events) != 1 {
+			skipped++
+			return nil
+		}
+		event := events[0]
+		if event.Channel == "" {
+			event.Channel = fallback
+		}
+		if event.RecordNumber == 0 {
+			event.RecordNumber = uint32(record.ID)
+		}
+		event.TimeWritten = uint32(filetimeToTime(record.Written).Unix())
+		return fn(event)
+	})
+	return skipped, err
+}
+
+// ScanRecords calls fn with every record of an .evtx file in file order. A record
+// whose binary XML can't be rendered is passed with the decoding error; an error
+// returned by fn stops the scan.
+func ScanRecords(path string, fn func(Record, error) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	header := make([]byte, fileHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return fmt.Errorf("failed to read header of %s: %v", path, err)
+	}
+	if !bytes.HasPrefix(header, fileSignature) {
+		return fmt.Errorf("%s is not an .evtx file", path)
+	}
+
+	// The chunk count in the file header is stale in logs copied while in use, so
+	// every chunk present is read and unused (zeroed) chunks are skipped
+	chunk := make([]byte, chunkSize)
+	for index := 0; ; index++ {
+		if _, err := io.ReadFull(file, chunk); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return fmt.Errorf("failed to read chunk %d of %s: %v", index, path, err)
+		}
+		if !bytes.HasPrefix(chunk, chunkSignature) {
+			continue
+		}
+		if err := scanChunk(chunk, fn); err != nil {
+			return err
+		}
+	}
+}
+
+// scanChunk calls fn with the records of one chunk
+func scanChunk(chunk []byte, fn func(Record, error) error) error {
+	end := int(binary.LittleEndian.Uint32(chunk[chunkFreeSpaceOffset:]))
+	if end < chunkHeaderSize || end > len(chunk) {
+		end = len(chunk)
+	}
+
+	for offset := chunkHeaderSize; offset+recordHeaderLen <= end; {
+		if !bytes.Equal(chunk[offset:offset+4], recordSignature) {
+			return nil
+		}
+		size := int(binary.LittleEndian.Uint32(chunk[offset+4:]))
+		if size < recordHeaderLen+4 || offset+size > end {
+			return nil
+		}
+		record := Record{
+			ID:      binary.LittleEndian.Uint64(chunk[offset+8:]),
+			Written: binary.LittleEndian.Uint64(chunk[offset+16:]),
+		}
+
+		// The record's binary XML ends before the trailing copy of its size
+		var b strings.Builder
+		err := newParser(chunk).fragment(&reader{data: chunk[:offset+size-4], pos: offset + recordHeaderLen}, nil, &b)
+		record.XML = b.String()
+		if err := fn(record, err); err != nil {
+			return err
+		}
+		offset += size
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package evtx_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"lemita/datn/pkg/benchmark"
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/evtx"
+)
+
+func TestScanGeneratedFile(t *testing.T) {
+	// Enough events to span several chunks
+	events := benchmark.Events(5000)
+	path := filepath.Join(t.TempDir(), "Security.evtx")
+	if err := benchmark.WriteEvtx(path, events); err != nil {
+		t.Fatal(err)
+	}
+
+	var scanned []eventlog.EventLogData
+	skipped, err := evtx.Scan(path, func(event eventlog.EventLogData) error {
+		scanned = append(scanned, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 0 || len(scanned) != len(events) {
+		t.Fatalf("scanned %d events, skipped %d, want %d", len(scanned), skipped, len(events))
+	}
+	for i, want := range events {
+		got := scanned[i]
+		if got.RecordNumber != want.RecordNumber || got.EventID != want.EventID || got.Channel != want.Channel ||
+			got.SourceName != want.SourceName || got.ComputerName != want.ComputerName ||
+			got.TimeGenerated != want.TimeGenerated || !slices.Equal(got.Strings, want.Strings) {
+			t.Fatalf("event %d = %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+// BenchmarkScan reads a generated log of benchmark.DefaultEvents events, the
+// parse/evtx case of datn bench
+func BenchmarkScan(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "Security.evtx")
+	if err := benchmark.WriteEvtx(path, benchmark.Events(benchmark.DefaultEvents)); err != nil {
+		b.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(info.Size())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := evtx.Scan(path, func(eventlog.EventLogData) error { return nil }); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
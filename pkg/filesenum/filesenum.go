@@ -27,10 +27,31 @@ const (
 	SERVICE_QUERY_CONFIG         = 0x0001
 )
 
+// Persistence mechanisms recorded in PEInfo.Kind
+const (
+	KindService  = "service"
+	KindTask     = "task"
+	KindAutorun  = "autorun"
+	KindRecovery = "recovery" // Program a service runs when it fails
+	KindCOM      = "com"      // COM in-process server in a user-writable folder
+	KindIFEO     = "ifeo"     // Image File Execution Options debugger
+)
+
+// UnavailableHash marks binaries that couldn't be read
+const UnavailableHash = "hash-unavailable"
+
 type PEInfo struct {
-	FilePath string
-	Hash     string
-	Name     string
+	FilePath string `json:"path"`
+	Hash     string `json:"sha256"`
+	Name     string `json:"name"`
+	Service  string `json:"service,omitempty"`  // Service key name
+	Kind     string `json:"kind,omitempty"`     // See the Kind constants (empty = service)
+	Location string `json:"location,omitempty"` // Task path, registry key or folder of the entry
+
+	Recovery    *RecoveryActions `json:"recovery,omitempty"`     // Failure actions of a service
+	ServiceInfo *ServiceInfo     `json:"service_info,omitempty"` // Start type, account and state of a service
+	Signature   *Signature       `json:"signature,omitempty"`    // Authenticode signature of the binary
+	TaskXML     string           `json:"task_xml,omitempty"`     // Full definition of a scheduled task
 }
 
 type ENUM_SERVICE_STATUS_PROCESS struct {
@@ -107,27 +128,55 @@ func extractExecutablePath(binaryPath string) string {
 	return path
 }
 
-func getSHA256Hash(binaryPath string) (string, error) {
-	// Extract the actual executable path from the service binary path
-	executablePath := extractExecutablePath(binaryPath)
+// AdminSharePath maps a local path on a remote computer to its administrative share
+// (C:\Windows\x.exe on SRV01 becomes \\SRV01\C$\Windows\x.exe)
+func AdminSharePath(server, path string) string {
+	if server == "" || len(path) < 2 || path[1] != ':' {
+		return path
+	}
+	return `\\` + strings.TrimPrefix(server, `\\`) + `\` + path[:1] + "$" + path[2:]
+}
+
+func getSHA256Hash(server, binaryPath string) (string, error) {
+	// Extract the actual executable path from the service binary path; environment
+	// variables are expanded locally, which matches remote hosts for %SystemRoot%
+	return fileSHA256(AdminSharePath(server, extractExecutablePath(binaryPath)))
+}
 
+// fileSHA256 returns the hex SHA-256 of a file
+func fileSHA256(path string) (string, error) {
 	// Try to open the file
-	file, err := os.Open(executablePath)
+	file, err := os.Open(path)
 	if err != nil {
-		return "", fmt.Errorf("failed to open file %s: %v", executablePath, err)
+		return "", fmt.Errorf("failed to open file %s: %v", path, err)
 	}
 	defer file.Close()
 
 	// Calculate hash
 	hash := sha256.New()
 	if _, err := io.Copy(hash, file); err != nil {
-		return "", fmt.Errorf("failed to read file %s: %v", executablePath, err)
+		return "", fmt.Errorf("failed to read file %s: %v", path, err)
 	}
 
 	sum := hash.Sum(nil)
 	return fmt.Sprintf("%x", sum), nil
 }
 
+// cachedHash returns the SHA-256 of a binary, reading each path only once per cache;
+// unreadable binaries get UnavailableHash
+func cachedHash(server string, cache map[string]string, binaryPath string) string {
+	if hash, ok := cache[binaryPath]; ok {
+		return hash
+	}
+	hash, err := getSHA256Hash(server, binaryPath)
+	if err != nil {
+		fmt.Printf("Warning: Could not calculate hash for %s: %v\n", binaryPath, err)
+		hash = UnavailableHash
+	}
+	cache[binaryPath] = hash
+	return hash
+}
+
 func GetServiceBinaryPath(scManager uintptr, serviceName *uint16) (string, error) {
 	serviceHandle, _, err := OpenService.Call(
 		scManager,
@@ -140,30 +189,10 @@ func GetServiceBinaryPath(scManager uintptr, serviceName *uint16) (string, error
 	}
 	defer CloseServiceHandle.Call(serviceHandle)
 
-	var bytesNeeded uint32
-	QueryServiceConfig.Call(
-		serviceHandle,
-		0,
-		0,
-		uintptr(unsafe.Pointer(&bytesNeeded)),
-	)
-
-	if bytesNeeded == 0 {
-		return "", fmt.Errorf("QueryServiceConfig failed to return buffer size")
-	}
-
-	buffer := make([]byte, bytesNeeded)
-	ret, _, err := QueryServiceConfig.Call(
-		serviceHandle,
-		uintptr(unsafe.Pointer(&buffer[0])),
-		uintptr(bytesNeeded),
-		uintptr(unsafe.Pointer(&bytesNeeded)),
-	)
-
-	if ret == 0 {
-		return "", fmt.Errorf("QueryServiceConfig failed: %v", err)
+	buffer, err := queryServiceConfig(serviceHandle)
+	if err != nil {
+		return "", err
 	}
-
 	config := (*QUERY_SERVICE_CONFIG)(unsafe.Pointer(&buffer[0]))
 	binaryPath := windows.UTF16PtrToString(config.BinaryPathName)
 
@@ -171,10 +200,25 @@ func GetServiceBinaryPath(scManager uintptr, serviceName *uint16) (string, error
 }
 
 func ListServices() ([]PEInfo, error) {
+	return ListServicesOn("")
+}
+
+// ListServicesOn lists the Win32 services of a computer (empty = local) with the
+// SHA-256 and Authenticode signature of their binaries; remote binaries are read
+// through the admin share
+func ListServicesOn(server string) ([]PEInfo, error) {
 	var peList []PEInfo
 
+	var serverPtr *uint16
+	if server != "" {
+		var err error
+		if serverPtr, err = syscall.UTF16PtrFromString(server); err != nil {
+			return nil, fmt.Errorf("invalid server name: %v", err)
+		}
+	}
+
 	// Open the service control manager
-	scManager, _, err0 := OpenSCManager.Call(0, 0, SC_MANAGER_ENUMERATE_SERVICE)
+	scManager, _, err0 := OpenSCManager.Call(uintptr(unsafe.Pointer(serverPtr)), 0, SC_MANAGER_ENUMERATE_SERVICE)
 	if scManager == 0 {
 		return nil, fmt.Errorf("OpenSCManager failed: %v", err0)
 	}
@@ -201,7 +245,10 @@ func ListServices() ([]PEInfo, error) {
 
 	// Allocate buffer and call again to get actual data
 	bufSize = bytesNeeded
-	buf := make([]byte, bufSize)
+	if bufSize == 0 {
+		return peList, nil
+	}
+	buf := alignedBuffer(bufSize)
 	ret, _, err2 := EnumServicesStatusEx.Call(
 		uintptr(scManager),
 		0,
@@ -220,13 +267,15 @@ func ListServices() ([]PEInfo, error) {
 	}
 
 	// Process each service
+	hashes := map[string]string{}
+	signatures := map[string]*Signature{}
 	for i := uint32(0); i < servicesReturned; i++ {
-		// Calculate offset for the current service
+		// Calculate offset for the current service; the entry size differs
+		// between 32-bit and 64-bit processes because of the two string pointers
 		offset := unsafe.Sizeof(ENUM_SERVICE_STATUS_PROCESS{})
-		servicePtr := uintptr(unsafe.Pointer(&buf[0])) + uintptr(i)*offset
 
 		// Get a pointer to the current service
-		service := (*ENUM_SERVICE_STATUS_PROCESS)(unsafe.Pointer(servicePtr))
+		service := (*ENUM_SERVICE_STATUS_PROCESS)(unsafe.Add(unsafe.Pointer(&buf[0]), uintptr(i)*offset))
 
 		serviceName := windows.UTF16PtrToString(service.ServiceName)
 		displayName := windows.UTF16PtrToString(service.DisplayName)
@@ -238,20 +287,45 @@ func ListServices() ([]PEInfo, error) {
 			continue
 		}
 
-		// Calculate hash for the binary
-		hash, err := getSHA256Hash(binaryPath)
+		recovery, err := GetServiceFailureActions(scManager, service.ServiceName)
 		if err != nil {
-			fmt.Printf("Warning: Could not calculate hash for %s: %v\n", binaryPath, err)
-			hash = "hash-unavailable"
+			fmt.Printf("Warning: Could not get recovery actions for service %s: %v\n", serviceName, err)
 		}
 
-		// Add to our list
+		serviceInfo, err := GetServiceInfo(scManager, service.ServiceName)
+		if err != nil {
+			fmt.Printf("Warning: Could not get the configuration of service %s: %v\n", serviceName, err)
+		} else {
+			serviceInfo.State = ServiceStateName(service.StatusProcess.CurrentState)
+			serviceInfo.PID = service.StatusProcess.ProcessId
+		}
+
+		// Add to our list; shared hosts like svchost.exe are only hashed and
+		// verified once
 		info := PEInfo{
-			FilePath: binaryPath,
-			Hash:     hash,
-			Name:     displayName,
+			FilePath:    binaryPath,
+			Hash:        cachedHash(server, hashes, binaryPath),
+			Name:        displayName,
+			Service:     serviceName,
+			Kind:        KindService,
+			Recovery:    recovery,
+			ServiceInfo: serviceInfo,
+			Signature:   cachedSignature(server, signatures, binaryPath),
 		}
 		peList = append(peList, info)
+
+		// The recovery command is inventoried as a binary of its own so that
+		// stacking sees it
+		if recovery != nil && recovery.RunsCommand() {
+			peList = append(peList, PEInfo{
+				FilePath:  recovery.Command,
+				Hash:      cachedHash(server, hashes, recovery.Command),
+				Name:      displayName,
+				Service:   serviceName,
+				Kind:      KindRecovery,
+				Signature: cachedSignature(server, signatures, recovery.Command),
+			})
+		}
 	}
 
 	return peList, nil
@@ -0,0 +1,186 @@
+package filesenum
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// clsidKeys hold the COM class registrations of the machine and, under each
+// loaded user hive, of the user; user registrations take precedence
+var clsidKeys = []string{
+	`SOFTWARE\Classes\CLSID`,
+	`SOFTWARE\Classes\WOW6432Node\CLSID`,
+}
+
+// ifeoKeys hold the Image File Execution Options, whose Debugger value starts
+// another program in place of the named executable
+var ifeoKeys = []string{
+	`SOFTWARE\Microsoft\Windows NT\CurrentVersion\Image File Execution Options`,
+	`SOFTWARE\WOW6432Node\Microsoft\Windows NT\CurrentVersion\Image File Execution Options`,
+}
+
+// userWritableDirs are path fragments of folders ordinary users can write to
+var userWritableDirs = []string{`\users\`, `\programdata\`, `\temp\`, `\appdata\`, `\windows\tasks\`}
+
+// userWritable reports whether a resolved path lies in a user-writable folder
+func userWritable(path string) bool {
+	lower := strings.ToLower(path)
+	for _, dir := range userWritableDirs {
+		if strings.Contains(lower, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenHive opens a root key of a computer (empty = local)
+func OpenHive(server string, root registry.Key) (registry.Key, bool, error) {
+	if server == "" {
+		return root, false, nil
+	}
+	key, err := registry.OpenRemoteKey(`\\`+strings.TrimPrefix(server, `\\`), root)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to connect to the registry of %s: %v", server, err)
+	}
+	return key, true, nil
+}
+
+// ListCOMHijacksOn lists the COM in-process servers of a computer (empty = local)
+// that load a DLL from a user-writable folder, with its SHA-256. Both the machine
+// registrations and those of the users whose hives are loaded are scanned;
+// environment variables in user registrations are expanded for the collecting
+// account.
+func ListCOMHijacksOn(server string) ([]PEInfo, error) {
+	var hijacks []PEInfo
+	hashes := map[string]string{}
+
+	machine, remote, err := OpenHive(server, registry.LOCAL_MACHINE)
+	if err != nil {
+		return nil, err
+	}
+	if remote {
+		defer machine.Close()
+	}
+	for _, path := range clsidKeys {
+		hijacks = append(hijacks, scanCLSIDs(server, hashes, machine, path, `HKLM\`+path)...)
+	}
+
+	users, remote, err := OpenHive(server, registry.USERS)
+	if err != nil {
+		return hijacks, err
+	}
+	if remote {
+		defer users.Close()
+	}
+	sids, err := users.ReadSubKeyNames(0)
+	if err != nil {
+		return hijacks, fmt.Errorf("failed to read HKEY_USERS: %v", err)
+	}
+	for _, sid := range sids {
+		if strings.HasSuffix(sid, "_Classes") {
+			continue
+		}
+		path := sid + `\Software\Classes\CLSID`
+		hijacks = append(hijacks, scanCLSIDs(server, hashes, users, path, `HKU\`+path)...)
+	}
+	return hijacks, nil
+}
+
+// scanCLSIDs returns the InprocServer32 registrations under one CLSID key that
+// point to a user-writable folder
+func scanCLSIDs(server string, hashes map[string]string, root registry.Key, path, location string) []PEInfo {
+	clsids, err := registry.OpenKey(root, path, registry.ENUMERATE_SUB_KEYS)
+	if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+		return nil
+	}
+	if err != nil {
+		fmt.Printf("Warning: Could not open %s: %v\n", location, err)
+		return nil
+	}
+	defer clsids.Close()
+	names, err := clsids.ReadSubKeyNames(0)
+	if err != nil {
+		fmt.Printf("Warning: Could not read %s: %v\n", location, err)
+	}
+
+	var found []PEInfo
+	for _, clsid := range names {
+		key, err := registry.OpenKey(clsids, clsid+`\InprocServer32`, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		server32, _, err := key.GetStringValue("")
+		key.Close()
+		if err != nil || strings.TrimSpace(server32) == "" {
+			continue
+		}
+		binaryPath := ResolveCommand(`"` + strings.Trim(strings.TrimSpace(server32), `"`) + `"`)
+		if !userWritable(binaryPath) {
+			continue
+		}
+		found = append(found, PEInfo{
+			FilePath: binaryPath,
+			Hash:     HashProgram(server, hashes, binaryPath),
+			Name:     clsid,
+			Kind:     KindCOM,
+			Location: location,
+		})
+	}
+	return found
+}
+
+// ListIFEODebuggersOn lists the Image File Execution Options Debugger values of a
+// computer (empty = local), which start the debugger program whenever the named
+// executable is launched, with the debugger's SHA-256
+func ListIFEODebuggersOn(server string) ([]PEInfo, error) {
+	var debuggers []PEInfo
+	hashes := map[string]string{}
+
+	root, remote, err := OpenHive(server, registry.LOCAL_MACHINE)
+	if err != nil {
+		return nil, err
+	}
+	if remote {
+		defer root.Close()
+	}
+
+	for _, path := range ifeoKeys {
+		ifeo, err := registry.OpenKey(root, path, registry.ENUMERATE_SUB_KEYS)
+		if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Warning: Could not open HKLM\\%s: %v\n", path, err)
+			continue
+		}
+		images, err := ifeo.ReadSubKeyNames(0)
+		if err != nil {
+			fmt.Printf("Warning: Could not read HKLM\\%s: %v\n", path, err)
+		}
+		for _, image := range images {
+			key, err := registry.OpenKey(ifeo, image, registry.QUERY_VALUE)
+			if err != nil {
+				continue
+			}
+			debugger, _, err := key.GetStringValue("Debugger")
+			key.Close()
+			if err != nil || strings.TrimSpace(debugger) == "" {
+				continue
+			}
+			binaryPath := ResolveCommand(debugger)
+			debuggers = append(debuggers, PEInfo{
+				FilePath: binaryPath,
+				Hash:     HashProgram(server, hashes, binaryPath),
+				Name:     image,
+				Kind:     KindIFEO,
+				Location: `HKLM\` + path,
+			})
+		}
+		ifeo.Close()
+	}
+	return debuggers, nil
+}
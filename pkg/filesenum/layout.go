@@ -0,0 +1,27 @@
+package filesenum
+
+import "unsafe"
+
+// alignedBuffer returns a byte buffer whose start is pointer-aligned, as required
+// when the Windows API fills it with structures containing pointers (arm64 and
+// amd64 need 8-byte alignment, 386 needs 4)
+func alignedBuffer(size uint32) []byte {
+	words := make([]uint64, (uintptr(size)+7)/8)
+	return unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), size)
+}
+
+// Compile-time checks that the Go structs match the Windows SDK layout for the
+// target architecture. A mismatch makes the array length negative and fails the build.
+var (
+	_ [unsafe.Sizeof(SERVICE_STATUS_PROCESS{}) - 36]struct{}
+	_ [36 - unsafe.Sizeof(SERVICE_STATUS_PROCESS{})]struct{}
+
+	_ [unsafe.Sizeof(ENUM_SERVICE_STATUS_PROCESS{}) - sizeofEnumServiceStatusProcess]struct{}
+	_ [sizeofEnumServiceStatusProcess - unsafe.Sizeof(ENUM_SERVICE_STATUS_PROCESS{})]struct{}
+
+	_ [unsafe.Sizeof(QUERY_SERVICE_CONFIG{}) - sizeofQueryServiceConfig]struct{}
+	_ [sizeofQueryServiceConfig - unsafe.Sizeof(QUERY_SERVICE_CONFIG{})]struct{}
+
+	_ [unsafe.Sizeof(WINTRUST_CATALOG_INFO{}) - sizeofWintrustCatalogInfo]struct{}
+	_ [sizeofWintrustCatalogInfo - unsafe.Sizeof(WINTRUST_CATALOG_INFO{})]struct{}
+)
@@ -0,0 +1,10 @@
+//go:build 386 || arm
+
+package filesenum
+
+// Structure sizes from the Windows SDK for 32-bit processes
+const (
+	sizeofEnumServiceStatusProcess = 44 // 2 pointers + SERVICE_STATUS_PROCESS
+	sizeofQueryServiceConfig       = 36 // 5 pointers and 4 DWORDs, no padding
+	sizeofWintrustCatalogInfo      = 40 // 3 DWORDs, 5 pointers and 2 handles, no padding
+)
@@ -0,0 +1,10 @@
+//go:build amd64 || arm64
+
+package filesenum
+
+// Structure sizes from the Windows SDK for 64-bit processes
+const (
+	sizeofEnumServiceStatusProcess = 56 // 2 pointers + SERVICE_STATUS_PROCESS, padded to 8
+	sizeofQueryServiceConfig       = 64 // 5 pointers and 4 DWORDs with alignment padding
+	sizeofWintrustCatalogInfo      = 72 // 3 DWORDs, 5 pointers and 2 handles with alignment padding
+)
@@ -0,0 +1,66 @@
+package filesenum
+
+import (
+	"runtime"
+	"testing"
+	"unsafe"
+)
+
+// sdkLayout is the size and pointer-field offsets of the service structures in
+// the Windows SDK for one architecture
+type sdkLayout struct {
+	enumServiceStatus uintptr // sizeof(ENUM_SERVICE_STATUS_PROCESS)
+	statusProcess     uintptr // offsetof(ENUM_SERVICE_STATUS_PROCESS, ServiceStatusProcess)
+	queryConfig       uintptr // sizeof(QUERY_SERVICE_CONFIG)
+	binaryPathName    uintptr // offsetof(QUERY_SERVICE_CONFIG, lpBinaryPathName)
+	dependencies      uintptr // offsetof(QUERY_SERVICE_CONFIG, lpDependencies)
+	displayName       uintptr // offsetof(QUERY_SERVICE_CONFIG, lpDisplayName)
+	catalogInfo       uintptr // sizeof(WINTRUST_CATALOG_INFO)
+	memberFile        uintptr // offsetof(WINTRUST_CATALOG_INFO, hMemberFile)
+	catAdmin          uintptr // offsetof(WINTRUST_CATALOG_INFO, hCatAdmin)
+	failureActions    uintptr // sizeof(SERVICE_FAILURE_ACTIONS)
+	saActions         uintptr // offsetof(SERVICE_FAILURE_ACTIONS, lpsaActions)
+}
+
+var sdkLayouts = map[string]sdkLayout{
+	"386":   {44, 8, 36, 12, 24, 32, 40, 20, 36, 20, 16},
+	"amd64": {56, 16, 64, 16, 40, 56, 72, 32, 64, 40, 32},
+	"arm64": {56, 16, 64, 16, 40, 56, 72, 32, 64, 40, 32},
+}
+
+func TestServiceStructLayout(t *testing.T) {
+	want, ok := sdkLayouts[runtime.GOARCH]
+	if !ok {
+		t.Skipf("no SDK layout recorded for %s", runtime.GOARCH)
+	}
+
+	var (
+		enum    ENUM_SERVICE_STATUS_PROCESS
+		config  QUERY_SERVICE_CONFIG
+		catalog WINTRUST_CATALOG_INFO
+		actions SERVICE_FAILURE_ACTIONS
+	)
+	tests := []struct {
+		name      string
+		got, want uintptr
+	}{
+		{"sizeof(SERVICE_STATUS_PROCESS)", unsafe.Sizeof(SERVICE_STATUS_PROCESS{}), 36},
+		{"sizeof(ENUM_SERVICE_STATUS_PROCESS)", unsafe.Sizeof(enum), want.enumServiceStatus},
+		{"ENUM_SERVICE_STATUS_PROCESS.StatusProcess", unsafe.Offsetof(enum.StatusProcess), want.statusProcess},
+		{"sizeof(QUERY_SERVICE_CONFIG)", unsafe.Sizeof(config), want.queryConfig},
+		{"QUERY_SERVICE_CONFIG.BinaryPathName", unsafe.Offsetof(config.BinaryPathName), want.binaryPathName},
+		{"QUERY_SERVICE_CONFIG.Dependencies", unsafe.Offsetof(config.Dependencies), want.dependencies},
+		{"QUERY_SERVICE_CONFIG.DisplayName", unsafe.Offsetof(config.DisplayName), want.displayName},
+		{"sizeof(WINTRUST_CATALOG_INFO)", unsafe.Sizeof(catalog), want.catalogInfo},
+		{"WINTRUST_CATALOG_INFO.MemberFile", unsafe.Offsetof(catalog.MemberFile), want.memberFile},
+		{"WINTRUST_CATALOG_INFO.CatAdmin", unsafe.Offsetof(catalog.CatAdmin), want.catAdmin},
+		{"sizeof(SERVICE_FAILURE_ACTIONS)", unsafe.Sizeof(actions), want.failureActions},
+		{"SERVICE_FAILURE_ACTIONS.SaActions", unsafe.Offsetof(actions.SaActions), want.saActions},
+		{"sizeof(SC_ACTION)", unsafe.Sizeof(SC_ACTION{}), 8},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s on %s = %d, want %d", tt.name, runtime.GOARCH, tt.got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package filesenum
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HashProgram returns the SHA-256 of a resolved program path, which may contain
+// spaces, reading each path only once per cache
+func HashProgram(server string, cache map[string]string, path string) string {
+	return cachedHash(server, cache, `"`+path+`"`)
+}
+
+// ResolveCommand returns the program of a command line, with environment variables
+// expanded; bare program names such as rundll32.exe are looked up in System32
+func ResolveCommand(command string) string {
+	path := extractExecutablePath(strings.TrimSpace(command))
+	if path != "" && !strings.ContainsAny(path, `\/`) {
+		path = filepath.Join(os.Getenv("SystemRoot"), "System32", path)
+		if filepath.Ext(path) == "" {
+			path += ".exe"
+		}
+	}
+	return path
+}
@@ -0,0 +1,129 @@
+package filesenum
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var QueryServiceConfig2 = advapi32.NewProc("QueryServiceConfig2W")
+
+const SERVICE_CONFIG_FAILURE_ACTIONS = 2
+
+// SC_ACTION_TYPE values
+const (
+	SC_ACTION_NONE        = 0
+	SC_ACTION_RESTART     = 1
+	SC_ACTION_REBOOT      = 2
+	SC_ACTION_RUN_COMMAND = 3
+)
+
+type SC_ACTION struct {
+	Type  uint32
+	Delay uint32
+}
+
+type SERVICE_FAILURE_ACTIONS struct {
+	ResetPeriod uint32
+	RebootMsg   *uint16
+	Command     *uint16
+	Actions     uint32
+	SaActions   *SC_ACTION
+}
+
+var actionNames = map[uint32]string{
+	SC_ACTION_NONE:        "none",
+	SC_ACTION_RESTART:     "restart",
+	SC_ACTION_REBOOT:      "reboot",
+	SC_ACTION_RUN_COMMAND: "run command",
+}
+
+// RecoveryAction is what the service control manager does after a failure
+type RecoveryAction struct {
+	Action string        `json:"action"` // none, restart, reboot or run command
+	Delay  time.Duration `json:"delay"`
+}
+
+// RecoveryActions are the failure actions of a service. A run-command action
+// executes Command as the service account, which makes it a persistence mechanism
+// that binary-hash inventories miss.
+type RecoveryActions struct {
+	ResetPeriod   time.Duration    `json:"reset_period"` // Failure count reset after this long without failures
+	RebootMessage string           `json:"reboot_message,omitempty"`
+	Command       string           `json:"command,omitempty"`
+	Actions       []RecoveryAction `json:"actions"` // For the first, second and subsequent failures
+}
+
+// RunsCommand reports whether any failure action runs the command
+func (r *RecoveryActions) RunsCommand() bool {
+	for _, action := range r.Actions {
+		if action.Action == actionNames[SC_ACTION_RUN_COMMAND] {
+			return r.Command != ""
+		}
+	}
+	return false
+}
+
+// GetServiceFailureActions returns the failure actions of a service, or nil when
+// none are configured
+func GetServiceFailureActions(scManager uintptr, serviceName *uint16) (*RecoveryActions, error) {
+	serviceHandle, _, err := OpenService.Call(
+		scManager,
+		uintptr(unsafe.Pointer(serviceName)),
+		SERVICE_QUERY_CONFIG,
+	)
+	if serviceHandle == 0 {
+		return nil, fmt.Errorf("OpenService failed: %v", err)
+	}
+	defer CloseServiceHandle.Call(serviceHandle)
+
+	var bytesNeeded uint32
+	QueryServiceConfig2.Call(
+		serviceHandle,
+		SERVICE_CONFIG_FAILURE_ACTIONS,
+		0,
+		0,
+		uintptr(unsafe.Pointer(&bytesNeeded)),
+	)
+	if bytesNeeded == 0 {
+		return nil, fmt.Errorf("QueryServiceConfig2 failed to return buffer size")
+	}
+
+	buffer := alignedBuffer(bytesNeeded)
+	ret, _, err := QueryServiceConfig2.Call(
+		serviceHandle,
+		SERVICE_CONFIG_FAILURE_ACTIONS,
+		uintptr(unsafe.Pointer(&buffer[0])),
+		uintptr(bytesNeeded),
+		uintptr(unsafe.Pointer(&bytesNeeded)),
+	)
+	if ret == 0 {
+		return nil, fmt.Errorf("QueryServiceConfig2 failed: %v", err)
+	}
+
+	config := (*SERVICE_FAILURE_ACTIONS)(unsafe.Pointer(&buffer[0]))
+	if config.Actions == 0 && config.Command == nil {
+		return nil, nil
+	}
+	recovery := &RecoveryActions{
+		// INFINITE (0xFFFFFFFF) means the count is never reset
+		ResetPeriod:   time.Duration(config.ResetPeriod) * time.Second,
+		RebootMessage: windows.UTF16PtrToString(config.RebootMsg),
+		Command:       windows.UTF16PtrToString(config.Command),
+	}
+	if config.Actions > 0 {
+		for _, action := range unsafe.Slice(config.SaActions, config.Actions) {
+			name, ok := actionNames[action.Type]
+			if !ok {
+				name = fmt.Sprintf("unknown (%d)", action.Type)
+			}
+			recovery.Actions = append(recovery.Actions, RecoveryAction{
+				Action: name,
+				Delay:  time.Duration(action.Delay) * time.Millisecond,
+			})
+		}
+	}
+	return recovery, nil
+}
@@ -0,0 +1,217 @@
+package filesenum
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// QueryServiceConfig2 information levels besides SERVICE_CONFIG_FAILURE_ACTIONS
+const (
+	SERVICE_CONFIG_DESCRIPTION             = 1
+	SERVICE_CONFIG_DELAYED_AUTO_START_INFO = 3
+)
+
+// Service type bits not defined by the windows package
+const (
+	SERVICE_USER_SERVICE         = 0x40
+	SERVICE_USERSERVICE_INSTANCE = 0x80
+	SERVICE_INTERACTIVE_PROCESS  = 0x100
+)
+
+type SERVICE_DESCRIPTION struct {
+	Description *uint16
+}
+
+type SERVICE_DELAYED_AUTO_START_INFO struct {
+	DelayedAutostart uint32
+}
+
+// ServiceInfo is the configuration and status of a service
+type ServiceInfo struct {
+	ServiceType string `json:"service_type"`      // own-process, share-process, user-own-process, ...
+	StartType   string `json:"start_type"`        // boot, system, auto, delayed-auto, demand or disabled
+	Account     string `json:"account,omitempty"` // Account the service runs as, e.g. LocalSystem
+	State       string `json:"state,omitempty"`   // running, stopped, ...; empty when read from an offline image
+	PID         uint32 `json:"pid,omitempty"`     // Process of a running service
+	Description string `json:"description,omitempty"`
+}
+
+// ServiceTypeName names a SERVICE_* service type
+func ServiceTypeName(serviceType uint32) string {
+	var name string
+	switch serviceType &^ (SERVICE_INTERACTIVE_PROCESS | SERVICE_USERSERVICE_INSTANCE) {
+	case windows.SERVICE_KERNEL_DRIVER:
+		name = "kernel-driver"
+	case windows.SERVICE_FILE_SYSTEM_DRIVER:
+		name = "file-system-driver"
+	case windows.SERVICE_WIN32_OWN_PROCESS:
+		name = "own-process"
+	case windows.SERVICE_WIN32_SHARE_PROCESS:
+		name = "share-process"
+	case SERVICE_USER_SERVICE | windows.SERVICE_WIN32_OWN_PROCESS:
+		name = "user-own-process"
+	case SERVICE_USER_SERVICE | windows.SERVICE_WIN32_SHARE_PROCESS:
+		name = "user-share-process"
+	default:
+		name = fmt.Sprintf("unknown (0x%x)", serviceType)
+	}
+	if serviceType&SERVICE_INTERACTIVE_PROCESS != 0 {
+		name += " interactive"
+	}
+	return name
+}
+
+// StartTypeName names a SERVICE_*_START start type; delayed marks automatic
+// services started after the others
+func StartTypeName(startType uint32, delayed bool) string {
+	switch startType {
+	case windows.SERVICE_BOOT_START:
+		return "boot"
+	case windows.SERVICE_SYSTEM_START:
+		return "system"
+	case windows.SERVICE_AUTO_START:
+		if delayed {
+			return "delayed-auto"
+		}
+		return "auto"
+	case windows.SERVICE_DEMAND_START:
+		return "demand"
+	case windows.SERVICE_DISABLED:
+		return "disabled"
+	}
+	return fmt.Sprintf("unknown (%d)", startType)
+}
+
+// ServiceStateName names a SERVICE_* current state
+func ServiceStateName(state uint32) string {
+	switch state {
+	case windows.SERVICE_STOPPED:
+		return "stopped"
+	case windows.SERVICE_START_PENDING:
+		return "start-pending"
+	case windows.SERVICE_STOP_PENDING:
+		return "stop-pending"
+	case windows.SERVICE_RUNNING:
+		return "running"
+	case windows.SERVICE_CONTINUE_PENDING:
+		return "continue-pending"
+	case windows.SERVICE_PAUSE_PENDING:
+		return "pause-pending"
+	case windows.SERVICE_PAUSED:
+		return "paused"
+	}
+	return fmt.Sprintf("unknown (%d)", state)
+}
+
+// AutoStart reports whether the service starts without anyone asking for it
+func (s *ServiceInfo) AutoStart() bool {
+	switch s.StartType {
+	case "boot", "system", "auto", "delayed-auto":
+		return true
+	}
+	return false
+}
+
+// RunsAsSystem reports whether the service runs as LocalSystem, which is also
+// what an empty account means for Win32 services
+func (s *ServiceInfo) RunsAsSystem() bool {
+	return s.Account == "" || strings.EqualFold(s.Account, "LocalSystem") || strings.EqualFold(s.Account, `NT AUTHORITY\SYSTEM`)
+}
+
+// OutsideSystemFolders reports whether a service binary is outside the Windows
+// and Program Files folders, where an auto-start SYSTEM service is unusual
+func OutsideSystemFolders(binaryPath string) bool {
+	path := strings.ToLower(ResolveCommand(binaryPath))
+	if path == "" {
+		return false
+	}
+	for _, folder := range []string{os.Getenv("SystemRoot"), os.Getenv("ProgramFiles"), os.Getenv("ProgramFiles(x86)")} {
+		if folder != "" && strings.HasPrefix(path, strings.ToLower(strings.TrimRight(folder, `\`))+`\`) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetServiceInfo returns the configuration of a service; state and PID come from
+// the enumeration and are set by the caller
+func GetServiceInfo(scManager uintptr, serviceName *uint16) (*ServiceInfo, error) {
+	serviceHandle, _, err := OpenService.Call(
+		scManager,
+		uintptr(unsafe.Pointer(serviceName)),
+		SERVICE_QUERY_CONFIG,
+	)
+	if serviceHandle == 0 {
+		return nil, fmt.Errorf("OpenService failed: %v", err)
+	}
+	defer CloseServiceHandle.Call(serviceHandle)
+
+	buffer, err := queryServiceConfig(serviceHandle)
+	if err != nil {
+		return nil, err
+	}
+	config := (*QUERY_SERVICE_CONFIG)(unsafe.Pointer(&buffer[0]))
+	info := &ServiceInfo{
+		ServiceType: ServiceTypeName(config.ServiceType),
+		Account:     windows.UTF16PtrToString(config.ServiceStartName),
+	}
+
+	delayed := false
+	if config.StartType == windows.SERVICE_AUTO_START {
+		if buffer, err := queryServiceConfig2(serviceHandle, SERVICE_CONFIG_DELAYED_AUTO_START_INFO); err == nil {
+			delayed = (*SERVICE_DELAYED_AUTO_START_INFO)(unsafe.Pointer(&buffer[0])).DelayedAutostart != 0
+		}
+	}
+	info.StartType = StartTypeName(config.StartType, delayed)
+
+	if buffer, err := queryServiceConfig2(serviceHandle, SERVICE_CONFIG_DESCRIPTION); err == nil {
+		info.Description = windows.UTF16PtrToString((*SERVICE_DESCRIPTION)(unsafe.Pointer(&buffer[0])).Description)
+	}
+	return info, nil
+}
+
+// queryServiceConfig returns the QUERY_SERVICE_CONFIG of an open service
+func queryServiceConfig(serviceHandle uintptr) ([]byte, error) {
+	var bytesNeeded uint32
+	QueryServiceConfig.Call(serviceHandle, 0, 0, uintptr(unsafe.Pointer(&bytesNeeded)))
+	if bytesNeeded == 0 {
+		return nil, fmt.Errorf("QueryServiceConfig failed to return buffer size")
+	}
+	buffer := alignedBuffer(bytesNeeded)
+	ret, _, err := QueryServiceConfig.Call(
+		serviceHandle,
+		uintptr(unsafe.Pointer(&buffer[0])),
+		uintptr(bytesNeeded),
+		uintptr(unsafe.Pointer(&bytesNeeded)),
+	)
+	if ret == 0 {
+		return nil, fmt.Errorf("QueryServiceConfig failed: %v", err)
+	}
+	return buffer, nil
+}
+
+// queryServiceConfig2 returns one information level of QueryServiceConfig2 for an
+// open service
+func queryServiceConfig2(serviceHandle uintptr, level uint32) ([]byte, error) {
+	var bytesNeeded uint32
+	QueryServiceConfig2.Call(serviceHandle, uintptr(level), 0, 0, uintptr(unsafe.Pointer(&bytesNeeded)))
+	if bytesNeeded == 0 {
+		return nil, fmt.Errorf("QueryServiceConfig2 failed to return buffer size")
+	}
+	buffer := alignedBuffer(bytesNeeded)
+	ret, _, err := QueryServiceConfig2.Call(
+		serviceHandle,
+		uintptr(level),
+		uintptr(unsafe.Pointer(&buffer[0])),
+		uintptr(bytesNeeded),
+		uintptr(unsafe.Pointer(&bytesNeeded)),
+	)
+	if ret == 0 {
+		return nil, fmt.Errorf("QueryServiceConfig2 failed: %v", err)
+	}
+	return buffer, nil
+}
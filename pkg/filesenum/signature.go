@@ -0,0 +1,319 @@
+package filesenum
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	wintrust                             = syscall.NewLazyDLL("wintrust.dll")
+	CryptCATAdminAcquireContext2         = wintrust.NewProc("CryptCATAdminAcquireContext2")
+	CryptCATAdminCalcHashFromFileHandle2 = wintrust.NewProc("CryptCATAdminCalcHashFromFileHandle2")
+	CryptCATAdminEnumCatalogFromHash     = wintrust.NewProc("CryptCATAdminEnumCatalogFromHash")
+	CryptCATCatalogInfoFromContext       = wintrust.NewProc("CryptCATCatalogInfoFromContext")
+	CryptCATAdminReleaseCatalogContext   = wintrust.NewProc("CryptCATAdminReleaseCatalogContext")
+	CryptCATAdminReleaseContext          = wintrust.NewProc("CryptCATAdminReleaseContext")
+	WTHelperProvDataFromStateData        = wintrust.NewProc("WTHelperProvDataFromStateData")
+	WTHelperGetProvSignerFromChain       = wintrust.NewProc("WTHelperGetProvSignerFromChain")
+	WTHelperGetProvCertFromChain         = wintrust.NewProc("WTHelperGetProvCertFromChain")
+)
+
+// Signature states recorded in Signature.Status
+const (
+	SignatureValid     = "valid"
+	SignatureUnsigned  = "unsigned"  // Neither signed itself nor listed in a catalog
+	SignatureInvalid   = "invalid"   // Signed, but the file was changed after signing or the signature is malformed
+	SignatureExpired   = "expired"   // Signed without a timestamp by a certificate that expired since
+	SignatureRevoked   = "revoked"   // Signing certificate revoked, as far as the cached revocation lists know
+	SignatureUntrusted = "untrusted" // Certificate chain doesn't end at a trusted root, or is explicitly distrusted
+	SignatureUnknown   = "unknown"   // Couldn't be checked: unreadable file, or not in a local catalog for a remote binary
+)
+
+// Name string formats of CertGetNameString not defined by the windows package
+const (
+	CERT_X500_NAME_STR         = 3
+	CERT_NAME_STR_REVERSE_FLAG = 0x02000000
+)
+
+// Signature is the Authenticode signature of a binary
+type Signature struct {
+	Status    string    `json:"status"`
+	Subject   string    `json:"subject,omitempty"` // Subject of the signing certificate
+	Issuer    string    `json:"issuer,omitempty"`
+	NotBefore time.Time `json:"not_before,omitempty"` // Validity of the signing certificate
+	NotAfter  time.Time `json:"not_after,omitempty"`
+	Catalog   string    `json:"catalog,omitempty"` // Catalog that signs the binary, for Windows files not signed themselves
+	Error     string    `json:"error,omitempty"`
+}
+
+// Signed reports whether the binary carries or is covered by a signature, valid
+// or not
+func (s *Signature) Signed() bool {
+	return s != nil && s.Status != SignatureUnsigned && s.Status != SignatureUnknown
+}
+
+// Suspicious reports whether the signature is missing or fails verification;
+// unknown results are not suspicious
+func (s *Signature) Suspicious() bool {
+	return s != nil && s.Status != SignatureValid && s.Status != SignatureUnknown
+}
+
+// InWindowsFolder reports whether a binary is in the Windows folder, where
+// Microsoft signs every service binary, so an unsigned one stands out
+func InWindowsFolder(binaryPath string) bool {
+	path := strings.ToLower(ResolveCommand(binaryPath))
+	root := strings.ToLower(strings.TrimRight(os.Getenv("SystemRoot"), `\`))
+	return path != "" && root != "" && strings.HasPrefix(path, root+`\`)
+}
+
+type CATALOG_INFO struct {
+	Size        uint32
+	CatalogFile [windows.MAX_PATH]uint16
+}
+
+type WINTRUST_CATALOG_INFO struct {
+	Size                 uint32
+	CatalogVersion       uint32
+	CatalogFilePath      *uint16
+	MemberTag            *uint16
+	MemberFilePath       *uint16
+	MemberFile           windows.Handle
+	CalculatedFileHash   *byte
+	CalculatedFileHashSz uint32
+	CatalogContext       uintptr
+	CatAdmin             windows.Handle
+}
+
+// CRYPT_PROVIDER_CERT is the start of the structure; only the certificate is read
+type CRYPT_PROVIDER_CERT struct {
+	Size uint32
+	Cert *windows.CertContext
+}
+
+// VerifySignature checks the Authenticode signature of a service binary on a
+// computer (empty = local), reading remote binaries through the admin share.
+// Binaries without a signature of their own are looked up in the catalogs of
+// this computer, which sign most of Windows; a remote binary missing from them
+// may be signed by a catalog of its own computer and is reported as unknown.
+// Revocation is only checked against cached lists, so no request leaves the
+// computer.
+func VerifySignature(server, binaryPath string) *Signature {
+	path := AdminSharePath(server, extractExecutablePath(binaryPath))
+	if _, err := os.Stat(path); err != nil {
+		return &Signature{Status: SignatureUnknown, Error: err.Error()}
+	}
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return &Signature{Status: SignatureUnknown, Error: err.Error()}
+	}
+
+	fileInfo := windows.WinTrustFileInfo{FilePath: pathPtr}
+	fileInfo.Size = uint32(unsafe.Sizeof(fileInfo))
+	signature := verifyTrust(windows.WTD_CHOICE_FILE, unsafe.Pointer(&fileInfo))
+	if signature.Status != SignatureUnsigned {
+		return signature
+	}
+
+	catalog, hash, err := findCatalog(path)
+	if err != nil {
+		return &Signature{Status: SignatureUnknown, Error: err.Error()}
+	}
+	if catalog == "" {
+		if server != "" {
+			return &Signature{Status: SignatureUnknown, Error: "no embedded signature and not in a catalog of this computer"}
+		}
+		return signature
+	}
+	catalogPtr, _ := syscall.UTF16PtrFromString(catalog)
+	tagPtr, _ := syscall.UTF16PtrFromString(strings.ToUpper(hex.EncodeToString(hash)))
+	catalogInfo := WINTRUST_CATALOG_INFO{
+		CatalogFilePath:      catalogPtr,
+		MemberTag:            tagPtr,
+		MemberFilePath:       pathPtr,
+		CalculatedFileHash:   &hash[0],
+		CalculatedFileHashSz: uint32(len(hash)),
+	}
+	catalogInfo.Size = uint32(unsafe.Sizeof(catalogInfo))
+	signature = verifyTrust(windows.WTD_CHOICE_CATALOG, unsafe.Pointer(&catalogInfo))
+	signature.Catalog = catalog
+	return signature
+}
+
+// verifyTrust runs WinVerifyTrust on a file or catalog member and reads the
+// signing certificate from the verification state
+func verifyTrust(choice uint32, object unsafe.Pointer) *Signature {
+	data := windows.WinTrustData{
+		UIChoice:                        windows.WTD_UI_NONE,
+		RevocationChecks:                windows.WTD_REVOKE_NONE,
+		UnionChoice:                     choice,
+		FileOrCatalogOrBlobOrSgnrOrCert: object,
+		StateAction:                     windows.WTD_STATEACTION_VERIFY,
+		ProvFlags:                       windows.WTD_CACHE_ONLY_URL_RETRIEVAL,
+	}
+	data.Size = uint32(unsafe.Sizeof(data))
+	err := windows.WinVerifyTrustEx(windows.InvalidHWND, &windows.WINTRUST_ACTION_GENERIC_VERIFY_V2, &data)
+
+	signature := &Signature{Status: signatureStatus(err)}
+	if err != nil && signature.Status != SignatureUnsigned {
+		signature.Error = err.Error()
+	}
+	if data.StateData != 0 {
+		signer(data.StateData, signature)
+		data.StateAction = windows.WTD_STATEACTION_CLOSE
+		windows.WinVerifyTrustEx(windows.InvalidHWND, &windows.WINTRUST_ACTION_GENERIC_VERIFY_V2, &data)
+	}
+	return signature
+}
+
+// signatureStatus maps a WinVerifyTrust result to a Signature status
+func signatureStatus(err error) string {
+	if err == nil {
+		return SignatureValid
+	}
+	errno, ok := err.(syscall.Errno)
+	if !ok {
+		return SignatureUnknown
+	}
+	switch windows.Handle(uint32(errno)) {
+	case windows.TRUST_E_NOSIGNATURE, windows.TRUST_E_SUBJECT_FORM_UNKNOWN:
+		return SignatureUnsigned
+	case windows.TRUST_E_BAD_DIGEST:
+		return SignatureInvalid
+	case windows.CERT_E_EXPIRED:
+		return SignatureExpired
+	case windows.CERT_E_REVOKED:
+		return SignatureRevoked
+	case windows.CERT_E_UNTRUSTEDROOT, windows.CERT_E_CHAINING, windows.TRUST_E_EXPLICIT_DISTRUST:
+		return SignatureUntrusted
+	}
+	return SignatureInvalid
+}
+
+// signer fills the subject, issuer and validity of the signing certificate from
+// the state of a verification
+func signer(stateData windows.Handle, signature *Signature) {
+	provData, _, _ := WTHelperProvDataFromStateData.Call(uintptr(stateData))
+	if provData == 0 {
+		return
+	}
+	sgnr, _, _ := WTHelperGetProvSignerFromChain.Call(provData, 0, 0, 0)
+	if sgnr == 0 {
+		return
+	}
+	provCert, _, _ := WTHelperGetProvCertFromChain.Call(sgnr, 0)
+	if provCert == 0 {
+		return
+	}
+	// The structure is owned by the verification state, not the Go heap
+	cert := (*CRYPT_PROVIDER_CERT)(*(*unsafe.Pointer)(unsafe.Pointer(&provCert))).Cert
+	if cert == nil || cert.CertInfo == nil {
+		return
+	}
+	signature.Subject = certName(cert, 0)
+	signature.Issuer = certName(cert, windows.CERT_NAME_ISSUER_FLAG)
+	signature.NotBefore = time.Unix(0, cert.CertInfo.NotBefore.Nanoseconds()).UTC()
+	signature.NotAfter = time.Unix(0, cert.CertInfo.NotAfter.Nanoseconds()).UTC()
+}
+
+// certName returns the subject (or with CERT_NAME_ISSUER_FLAG the issuer) of a
+// certificate as a distinguished name starting with its CN
+func certName(cert *windows.CertContext, flags uint32) string {
+	nameType := uint32(CERT_X500_NAME_STR | CERT_NAME_STR_REVERSE_FLAG)
+	size := windows.CertGetNameString(cert, windows.CERT_NAME_RDN_TYPE, flags, unsafe.Pointer(&nameType), nil, 0)
+	if size <= 1 {
+		return ""
+	}
+	name := make([]uint16, size)
+	windows.CertGetNameString(cert, windows.CERT_NAME_RDN_TYPE, flags, unsafe.Pointer(&nameType), &name[0], size)
+	return windows.UTF16ToString(name)
+}
+
+// findCatalog returns the catalog of this computer that lists a file, with the
+// hash it is listed under, or an empty name. Windows 10 catalogs list SHA-256
+// hashes, older ones SHA-1.
+func findCatalog(path string) (string, []byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open file %s: %v", path, err)
+	}
+	defer file.Close()
+
+	for _, algorithm := range []string{"SHA256", "SHA1"} {
+		algorithmPtr, _ := syscall.UTF16PtrFromString(algorithm)
+		var catAdmin windows.Handle
+		ret, _, _ := CryptCATAdminAcquireContext2.Call(
+			uintptr(unsafe.Pointer(&catAdmin)),
+			0,
+			uintptr(unsafe.Pointer(algorithmPtr)),
+			0,
+			0,
+		)
+		if ret == 0 {
+			continue
+		}
+		catalog, hash := catalogOf(catAdmin, file)
+		CryptCATAdminReleaseContext.Call(uintptr(catAdmin), 0)
+		if catalog != "" {
+			return catalog, hash, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// catalogOf looks up the hash of an open file among the catalogs of one hash
+// algorithm
+func catalogOf(catAdmin windows.Handle, file *os.File) (string, []byte) {
+	hash := make([]byte, 64)
+	size := uint32(len(hash))
+	if _, err := file.Seek(0, 0); err != nil {
+		return "", nil
+	}
+	ret, _, _ := CryptCATAdminCalcHashFromFileHandle2.Call(
+		uintptr(catAdmin),
+		file.Fd(),
+		uintptr(unsafe.Pointer(&size)),
+		uintptr(unsafe.Pointer(&hash[0])),
+		0,
+	)
+	if ret == 0 || size == 0 {
+		return "", nil
+	}
+	hash = hash[:size]
+
+	catInfo, _, _ := CryptCATAdminEnumCatalogFromHash.Call(
+		uintptr(catAdmin),
+		uintptr(unsafe.Pointer(&hash[0])),
+		uintptr(size),
+		0,
+		0,
+	)
+	if catInfo == 0 {
+		return "", nil
+	}
+	defer CryptCATAdminReleaseCatalogContext.Call(uintptr(catAdmin), catInfo, 0)
+
+	var info CATALOG_INFO
+	info.Size = uint32(unsafe.Sizeof(info))
+	if ret, _, _ := CryptCATCatalogInfoFromContext.Call(catInfo, uintptr(unsafe.Pointer(&info)), 0); ret == 0 {
+		return "", nil
+	}
+	return windows.UTF16ToString(info.CatalogFile[:]), hash
+}
+
+// cachedSignature returns the signature of a binary, verifying each path only
+// once per cache
+func cachedSignature(server string, cache map[string]*Signature, binaryPath string) *Signature {
+	if signature, ok := cache[binaryPath]; ok {
+		return signature
+	}
+	signature := VerifySignature(server, binaryPath)
+	cache[binaryPath] = signature
+	return signature
+}
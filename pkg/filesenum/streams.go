@@ -0,0 +1,122 @@
+package filesenum
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"lemita/datn/pkg/longpath"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	FindFirstStreamW = kernel32.NewProc("FindFirstStreamW")
+	FindNextStreamW  = kernel32.NewProc("FindNextStreamW")
+	FindClose        = kernel32.NewProc("FindClose")
+)
+
+const (
+	FindStreamInfoStandard = 0
+	ERROR_HANDLE_EOF       = 38
+	MAX_PATH               = 260
+
+	// maxStreamContent is the largest alternate data stream whose content is kept,
+	// enough for Zone.Identifier and similar marker streams
+	maxStreamContent = 4096
+)
+
+// WIN32_FIND_STREAM_DATA describes one data stream of a file
+type WIN32_FIND_STREAM_DATA struct {
+	StreamSize  int64
+	cStreamName [MAX_PATH + 36]uint16
+}
+
+// Stream is an alternate data stream of a file
+type Stream struct {
+	Name    string `json:"name"` // e.g. Zone.Identifier
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256,omitempty"`
+	Content string `json:"content,omitempty"` // Set for streams of up to 4 KB, such as the download origin in Zone.Identifier
+}
+
+// targetPath resolves a path taken from an event: the value itself when such a
+// file exists, otherwise the executable of a command line such as a service
+// ImagePath. Paths on a remote server go through its administrative share.
+func targetPath(server, value string) string {
+	path := AdminSharePath(server, value)
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	return AdminSharePath(server, extractExecutablePath(value))
+}
+
+// HashFile returns the path a file or command line resolves to and its SHA-256
+func HashFile(server, value string) (path, hash string, err error) {
+	path = targetPath(server, value)
+	hash, err = fileSHA256(path)
+	return path, hash, err
+}
+
+// ListStreams returns the alternate data streams of a file or of the executable of
+// a command line, skipping the unnamed main stream
+func ListStreams(server, value string) ([]Stream, error) {
+	path := targetPath(server, value)
+	pathUTF16, err := syscall.UTF16PtrFromString(longpath.Fix(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert path to UTF16: %v", err)
+	}
+
+	var data WIN32_FIND_STREAM_DATA
+	handle, _, err := FindFirstStreamW.Call(uintptr(unsafe.Pointer(pathUTF16)), FindStreamInfoStandard, uintptr(unsafe.Pointer(&data)), 0)
+	if syscall.Handle(handle) == syscall.InvalidHandle {
+		if err.(syscall.Errno) == ERROR_HANDLE_EOF {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list streams of %s: %v", path, err)
+	}
+	defer FindClose.Call(handle)
+
+	var streams []Stream
+	for {
+		// Names have the form ":Zone.Identifier:$DATA"
+		name := strings.TrimSuffix(strings.TrimPrefix(syscall.UTF16ToString(data.cStreamName[:]), ":"), ":$DATA")
+		if name != "" {
+			streams = append(streams, readStream(path, name, data.StreamSize))
+		}
+
+		ret, _, err := FindNextStreamW.Call(handle, uintptr(unsafe.Pointer(&data)))
+		if ret == 0 {
+			if err.(syscall.Errno) == ERROR_HANDLE_EOF {
+				return streams, nil
+			}
+			return streams, fmt.Errorf("failed to list streams of %s: %v", path, err)
+		}
+	}
+}
+
+// readStream hashes a stream and keeps the content of small ones
+func readStream(path, name string, size int64) Stream {
+	stream := Stream{Name: name, Size: size}
+	file, err := os.Open(path + ":" + name)
+	if err != nil {
+		return stream
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	var reader io.Reader = file
+	var content strings.Builder
+	if size <= maxStreamContent {
+		reader = io.TeeReader(file, &content)
+	}
+	if _, err := io.Copy(hash, reader); err != nil {
+		return stream
+	}
+	stream.SHA256 = fmt.Sprintf("%x", hash.Sum(nil))
+	stream.Content = content.String()
+	return stream
+}
@@ -0,0 +1,318 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Expression is a compiled filter or detection expression such as
+//
+//	event.id == 4688 && event.data.NewProcessName.contains("\\temp\\")
+//
+// Supported syntax: && || ! (or and/or/not), == != < <= > >=, in, contains,
+// startsWith, endsWith, matches (regular expression), field access with "." and
+// [index], list literals [a, b], and the methods contains, startsWith, endsWith,
+// matches, lower, upper and size. Missing fields evaluate to nil, which never matches.
+type Expression struct {
+	source string
+	root   node
+}
+
+// Compile parses an expression
+func Compile(source string) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %v", source, err)
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %v", source, err)
+	}
+
+	return &Expression{source: source, root: root}, nil
+}
+
+// String returns the expression source
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression against an environment of variables
+func (e *Expression) Eval(env map[string]any) any {
+	return eval(e.root, env)
+}
+
+// Match reports whether the expression is true for the event
+func (e *Expression) Match(event eventlog.EventLogData) bool {
+	return truthy(e.Eval(EventEnv(event)))
+}
+
+// EventEnv exposes an event to expressions as the "event" variable
+func EventEnv(event eventlog.EventLogData) map[string]any {
+	stringsList := make([]any, len(event.Strings))
+	for i, s := range event.Strings {
+		stringsList[i] = s
+	}
+
+	data := map[string]any{}
+	for k, v := range eventlog.NamedData(event.Channel, event) {
+		data[k] = v
+	}
+
+	tags := map[string]any{}
+	for k, v := range event.Tags {
+		tags[k] = v
+	}
+
+	return map[string]any{
+		"event": map[string]any{
+			"channel":  event.Channel,
+			"id":       float64(event.EventID),
+			"record":   float64(event.RecordNumber),
+			"time":     float64(event.TimeGenerated),
+			"type":     float64(event.EventType),
+			"level":    eventlog.GetEventTypeName(event.EventType),
+			"category": float64(event.EventCategory),
+			"source":   event.SourceName,
+			"computer": event.ComputerName,
+			"strings":  stringsList,
+			"data":     data,
+			"tags":     tags,
+		},
+	}
+}
+
+// eval evaluates a node; type mismatches produce nil rather than errors so a filter
+// never aborts collection
+func eval(n node, env map[string]any) any {
+	switch n := n.(type) {
+	case *literalNode:
+		return n.value
+
+	case *variableNode:
+		return env[n.name]
+
+	case *listNode:
+		items := make([]any, len(n.items))
+		for i, item := range n.items {
+			items[i] = eval(item, env)
+		}
+		return items
+
+	case *notNode:
+		return !truthy(eval(n.operand, env))
+
+	case *logicalNode:
+		left := truthy(eval(n.left, env))
+		if n.op == "&&" {
+			return left && truthy(eval(n.right, env))
+		}
+		return left || truthy(eval(n.right, env))
+
+	case *memberNode:
+		return member(eval(n.object, env), n.name)
+
+	case *indexNode:
+		object := eval(n.object, env)
+		index := eval(n.index, env)
+		switch obj := object.(type) {
+		case []any:
+			if i, ok := toNumber(index); ok && int(i) >= 0 && int(i) < len(obj) {
+				return obj[int(i)]
+			}
+		case map[string]any:
+			if key, ok := index.(string); ok {
+				return obj[key]
+			}
+		}
+		return nil
+
+	case *compareNode:
+		return compare(n.op, eval(n.left, env), eval(n.right, env), n.pattern)
+
+	case *methodNode:
+		object := eval(n.object, env)
+		switch n.name {
+		case "lower":
+			if s, ok := object.(string); ok {
+				return strings.ToLower(s)
+			}
+			return nil
+		case "upper":
+			if s, ok := object.(string); ok {
+				return strings.ToUpper(s)
+			}
+			return nil
+		case "size":
+			switch obj := object.(type) {
+			case string:
+				return float64(len(obj))
+			case []any:
+				return float64(len(obj))
+			case map[string]any:
+				return float64(len(obj))
+			}
+			return nil
+		default:
+			return compare(n.name, object, eval(n.args[0], env), n.pattern)
+		}
+	}
+
+	return nil
+}
+
+// member looks up a field of a map value
+func member(object any, name string) any {
+	if m, ok := object.(map[string]any); ok {
+		return m[name]
+	}
+	return nil
+}
+
+// compare applies a binary comparison operator
+func compare(op string, left, right any, pattern *regexp.Regexp) bool {
+	switch op {
+	case "==":
+		return equal(left, right)
+	case "!=":
+		return !equal(left, right)
+	case "<", "<=", ">", ">=":
+		if l, ok := toNumber(left); ok {
+			if r, ok := toNumber(right); ok {
+				switch op {
+				case "<":
+					return l < r
+				case "<=":
+					return l <= r
+				case ">":
+					return l > r
+				default:
+					return l >= r
+				}
+			}
+		}
+		ls, lok := left.(string)
+		rs, rok := right.(string)
+		if !lok || !rok {
+			return false
+		}
+		switch op {
+		case "<":
+			return ls < rs
+		case "<=":
+			return ls <= rs
+		case ">":
+			return ls > rs
+		default:
+			return ls >= rs
+		}
+	case "in":
+		return contains(right, left)
+	case "contains":
+		return contains(left, right)
+	case "startsWith":
+		ls, lok := left.(string)
+		rs, rok := right.(string)
+		return lok && rok && strings.HasPrefix(ls, rs)
+	case "endsWith":
+		ls, lok := left.(string)
+		rs, rok := right.(string)
+		return lok && rok && strings.HasSuffix(ls, rs)
+	case "matches":
+		ls, ok := left.(string)
+		if !ok {
+			return false
+		}
+		if pattern == nil {
+			rs, ok := right.(string)
+			if !ok {
+				return false
+			}
+			compiled, err := regexp.Compile(rs)
+			if err != nil {
+				return false
+			}
+			pattern = compiled
+		}
+		return pattern.MatchString(ls)
+	}
+	return false
+}
+
+// contains reports whether container (string, list or map) holds item
+func contains(container, item any) bool {
+	switch c := container.(type) {
+	case string:
+		s, ok := item.(string)
+		return ok && strings.Contains(c, s)
+	case []any:
+		for _, element := range c {
+			if equal(element, item) {
+				return true
+			}
+		}
+	case map[string]any:
+		if key, ok := item.(string); ok {
+			_, exists := c[key]
+			return exists
+		}
+	}
+	return false
+}
+
+// equal compares two values; numbers compare numerically with numeric strings so
+// event.data.LogonType == 3 works even though insertion strings are text
+func equal(left, right any) bool {
+	if left == nil || right == nil {
+		return left == nil && right == nil
+	}
+
+	if l, ok := left.(float64); ok {
+		r, ok := toNumber(right)
+		return ok && l == r
+	}
+	if r, ok := right.(float64); ok {
+		l, ok := toNumber(left)
+		return ok && l == r
+	}
+
+	switch l := left.(type) {
+	case string:
+		r, ok := right.(string)
+		return ok && l == r
+	case bool:
+		r, ok := right.(bool)
+		return ok && l == r
+	}
+	return false
+}
+
+// toNumber converts numbers and numeric strings (decimal or 0x hex, as Windows
+// writes process IDs and logon IDs) to float64
+func toNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		v = strings.TrimSpace(v)
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f, true
+		}
+		if i, err := strconv.ParseInt(v, 0, 64); err == nil {
+			return float64(i), true
+		}
+	}
+	return 0, false
+}
+
+// truthy reports whether a value counts as true
+func truthy(value any) bool {
+	b, ok := value.(bool)
+	return ok && b
+}
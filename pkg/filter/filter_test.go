@@ -0,0 +1,116 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// env is the event the expressions of the tests are evaluated against
+var env = map[string]any{
+	"event": map[string]any{
+		"channel": "Security",
+		"id":      float64(4688),
+		"level":   "Information",
+		"strings": []any{"S-1-5-18", "C:\\Windows\\Temp\\x.exe"},
+		"data": map[string]any{
+			"NewProcessName": "C:\\Windows\\Temp\\x.exe",
+			"LogonType":      "3",
+			"ProcessId":      "0x1a4",
+		},
+		"tags": map[string]any{"site": "hanoi"},
+	},
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{`event.id == 4688`, true},
+		{`event.id != 4688`, false},
+		{`event.id == 4688 && event.channel == "Security"`, true},
+		{`event.id == 4624 || event.channel == "Security"`, true},
+		{`event.id == 4624 and event.channel == "Security"`, false},
+		{`not event.id == 4624`, true},
+		{`!(event.id == 4688)`, false},
+		{`event.id in [4624, 4688]`, true},
+		{`event.id > 4600 && event.id <= 4688`, true},
+		{`event.channel < "System"`, true},
+		// Insertion strings are text but compare as numbers, hex included
+		{`event.data.LogonType == 3`, true},
+		{`event.data.ProcessId == 420`, true},
+		{`event.data.NewProcessName.contains("\\Temp\\")`, true},
+		{`event.data.NewProcessName contains "\\temp\\"`, false},
+		{`event.data.NewProcessName.lower().contains("\\temp\\")`, true},
+		{`event.data.NewProcessName.startsWith("C:")`, true},
+		{`event.data.NewProcessName.upper().endsWith(".EXE")`, true},
+		{`event.data.NewProcessName matches "(?i)\\\\temp\\\\[^\\\\]+\\.exe$"`, true},
+		{`event.strings[1] == event.data.NewProcessName`, true},
+		{`event.strings.size() == 2`, true},
+		{`event.data["LogonType"] == "3"`, true},
+		{`event.tags contains "site"`, true},
+		// Missing fields are nil and never match, whatever the operator
+		{`event.data.Missing == "x"`, false},
+		{`event.strings[5] == "x"`, false},
+		{`event.data.Missing.contains("x")`, false},
+		{`event.id.lower() == "x"`, false},
+	}
+	for _, tt := range tests {
+		expr, err := Compile(tt.source)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.source, err)
+			continue
+		}
+		if got := truthy(expr.Eval(env)); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, source := range []string{
+		``,
+		`event.id ==`,
+		`event.id == 4688 &&`,
+		`(event.id == 4688`,
+		`event.id == "4688`,
+		`event.data.x matches "("`,
+		`event.id @ 4688`,
+		`[1, 2`,
+	} {
+		if _, err := Compile(source); err == nil {
+			t.Errorf("Compile(%q) succeeded, want an error", source)
+		}
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.conf")
+	content := "# detections\n\ntemp-exec: event.id == 4688 && event.data.NewProcessName.contains(\"\\\\Temp\\\\\")\nnetwork-logon: event.data.LogonType == 3\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0].Name != "temp-exec" || rules[1].Name != "network-logon" {
+		t.Fatalf("rules = %v, want temp-exec and network-logon", rules)
+	}
+	for _, rule := range rules {
+		if !truthy(rule.Expr.Eval(env)) {
+			t.Errorf("rule %s didn't match", rule.Name)
+		}
+	}
+
+	for _, content := range []string{"event.id == 4688\n", ": event.id == 4688\n", "broken: event.id ==\n"} {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadRules(path); err == nil {
+			t.Errorf("LoadRules(%q) succeeded, want an error", content)
+		}
+	}
+}
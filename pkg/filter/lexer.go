@@ -0,0 +1,119 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// tokenKind classifies lexer tokens
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+// token is a single lexical element of an expression
+type token struct {
+	kind  tokenKind
+	text  string
+	value string // Unescaped contents for string literals
+	pos   int
+}
+
+// operators lists the symbolic operators, longest first so "==" wins over "="
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", "."}
+
+// tokenize splits an expression into tokens
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	i := 0
+
+	for i < len(source) {
+		c := rune(source[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '"' || c == '\'':
+			start := i
+			quote := source[i]
+			i++
+			var sb strings.Builder
+			closed := false
+			for i < len(source) {
+				if source[i] == '\\' && i+1 < len(source) {
+					switch source[i+1] {
+					case 'n':
+						sb.WriteByte('\n')
+					case 't':
+						sb.WriteByte('\t')
+					default:
+						sb.WriteByte(source[i+1])
+					}
+					i += 2
+					continue
+				}
+				if source[i] == quote {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteByte(source[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated string starting at position %d", start)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: source[start:i], value: sb.String(), pos: start})
+
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(source) && unicode.IsDigit(rune(source[i+1])) && !lastIsValue(tokens)):
+			start := i
+			i++
+			for i < len(source) && (unicode.IsDigit(rune(source[i])) || source[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[start:i], pos: start})
+
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(source) && (unicode.IsLetter(rune(source[i])) || unicode.IsDigit(rune(source[i])) || source[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[start:i], pos: start})
+
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, token{kind: tokenOperator, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(source)})
+	return tokens, nil
+}
+
+// lastIsValue reports whether the previous token ends an operand, in which case a
+// following '-' can't start a negative number
+func lastIsValue(tokens []token) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	last := tokens[len(tokens)-1]
+	return last.kind == tokenNumber || last.kind == tokenString || last.kind == tokenIdent ||
+		last.text == ")" || last.text == "]"
+}
@@ -0,0 +1,316 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// node is an element of a parsed expression tree
+type node interface{}
+
+type (
+	literalNode  struct{ value any }
+	variableNode struct{ name string }
+	listNode     struct{ items []node }
+	notNode      struct{ operand node }
+	logicalNode  struct {
+		op          string // "&&" or "||"
+		left, right node
+	}
+	compareNode struct {
+		op          string
+		left, right node
+		pattern     *regexp.Regexp // Precompiled pattern for "matches" with a literal
+	}
+	memberNode struct {
+		object node
+		name   string
+	}
+	indexNode struct {
+		object, index node
+	}
+	methodNode struct {
+		object  node
+		name    string
+		args    []node
+		pattern *regexp.Regexp
+	}
+)
+
+// comparisonOperators are the binary operators accepted between two operands
+var comparisonOperators = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+	"in": true, "contains": true, "startsWith": true, "endsWith": true, "matches": true,
+}
+
+// methodArity lists supported methods and their argument counts
+var methodArity = map[string]int{
+	"contains": 1, "startsWith": 1, "endsWith": 1, "matches": 1,
+	"lower": 0, "upper": 0, "size": 0,
+}
+
+// parser builds an expression tree from tokens with recursive descent
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the given operators or keywords
+func (p *parser) accept(texts ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokenOperator && t.kind != tokenIdent {
+		return "", false
+	}
+	for _, text := range texts {
+		if t.text == text {
+			p.pos++
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(text string) error {
+	if _, ok := p.accept(text); !ok {
+		t := p.peek()
+		return fmt.Errorf("expected %q at position %d, found %q", text, t.pos, t.text)
+	}
+	return nil
+}
+
+// parse parses a complete expression
+func (p *parser) parse() (node, error) {
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+	return n, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||", "or"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "||", left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&", "and"); !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "&&", left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if _, ok := p.accept("!", "not"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	if (t.kind != tokenOperator && t.kind != tokenIdent) || !comparisonOperators[t.text] {
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+
+	cmp := &compareNode{op: t.text, left: left, right: right}
+	if t.text == "matches" {
+		if lit, ok := right.(*literalNode); ok {
+			pattern, ok := lit.value.(string)
+			if !ok {
+				return nil, fmt.Errorf("matches requires a string pattern at position %d", t.pos)
+			}
+			if cmp.pattern, err = regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+			}
+		}
+	}
+	return cmp, nil
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := p.accept("."); ok {
+			name := p.next()
+			if name.kind != tokenIdent {
+				return nil, fmt.Errorf("expected field name at position %d", name.pos)
+			}
+
+			if _, ok := p.accept("("); ok {
+				arity, known := methodArity[name.text]
+				if !known {
+					return nil, fmt.Errorf("unknown method %q at position %d", name.text, name.pos)
+				}
+				args, err := p.parseArgs(")")
+				if err != nil {
+					return nil, err
+				}
+				if len(args) != arity {
+					return nil, fmt.Errorf("method %s expects %d argument(s), got %d", name.text, arity, len(args))
+				}
+
+				method := &methodNode{object: n, name: name.text, args: args}
+				if name.text == "matches" {
+					if lit, ok := args[0].(*literalNode); ok {
+						if pattern, ok := lit.value.(string); ok {
+							if method.pattern, err = regexp.Compile(pattern); err != nil {
+								return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+							}
+						}
+					}
+				}
+				n = method
+				continue
+			}
+
+			n = &memberNode{object: n, name: name.text}
+			continue
+		}
+
+		if _, ok := p.accept("["); ok {
+			index, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			n = &indexNode{object: n, index: index}
+			continue
+		}
+
+		return n, nil
+	}
+}
+
+// parseArgs parses a comma-separated list of expressions up to the closing token
+func (p *parser) parseArgs(closing string) ([]node, error) {
+	var args []node
+	if _, ok := p.accept(closing); ok {
+		return args, nil
+	}
+	for {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		if _, ok := p.accept(","); ok {
+			continue
+		}
+		if err := p.expect(closing); err != nil {
+			return nil, err
+		}
+		return args, nil
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenNumber:
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", t.text, t.pos)
+		}
+		return &literalNode{value: value}, nil
+
+	case tokenString:
+		return &literalNode{value: t.value}, nil
+
+	case tokenIdent:
+		switch strings.ToLower(t.text) {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "nil", "null":
+			return &literalNode{value: nil}, nil
+		}
+		return &variableNode{name: t.text}, nil
+
+	case tokenOperator:
+		switch t.text {
+		case "(":
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return n, nil
+		case "[":
+			items, err := p.parseArgs("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{items: items}, nil
+		}
+	}
+
+	if t.kind == tokenEOF {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
@@ -0,0 +1,87 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Rule is a named detection expression
+type Rule struct {
+	Name string
+	Expr *Expression
+}
+
+// LoadRules reads detection rules from a file with one "name: expression" per line.
+// Blank lines and lines starting with # are ignored.
+func LoadRules(path string) ([]Rule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rules file %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var rules []Rule
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, source, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%s:%d: expected \"name: expression\"", path, lineNumber)
+		}
+
+		expr, err := Compile(strings.TrimSpace(source))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNumber, err)
+		}
+		rules = append(rules, Rule{Name: name, Expr: expr})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rules file %s: %v", path, err)
+	}
+
+	return rules, nil
+}
+
+// Apply keeps the events matching every filter and records the names of matching
+// detection rules in each kept event's Detections field
+func Apply(logs []eventlog.EventLogData, filters []*Expression, rules []Rule) []eventlog.EventLogData {
+	if len(filters) == 0 && len(rules) == 0 {
+		return logs
+	}
+
+	kept := logs[:0:0]
+	for _, log := range logs {
+		env := EventEnv(log)
+
+		matched := true
+		for _, f := range filters {
+			if !truthy(f.Eval(env)) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		for _, rule := range rules {
+			if truthy(rule.Expr.Eval(env)) {
+				log.Detections = append(log.Detections, rule.Name)
+			}
+		}
+		kept = append(kept, log)
+	}
+
+	return kept
+}
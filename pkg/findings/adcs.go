@@ -0,0 +1,69 @@
+package findings
+
+import (
+	"regexp"
+	"strings"
+)
+
+// sanAttribute matches the subject alternative names a requester supplied in the
+// request attributes, e.g. "SAN:upn=administrator@corp.local&dns=dc01.corp.local"
+var sanAttribute = regexp.MustCompile(`(?i)\bsan:\s*(\S+)`)
+
+// enrolleeSuppliesSubject is the CT_FLAG_ENROLLEE_SUPPLIES_SUBJECT template flag
+// that lets any enrollee request a certificate for another identity (ESC1)
+const enrolleeSuppliesSubject = "CT_FLAG_ENROLLEE_SUPPLIES_SUBJECT"
+
+// certificateRequest flags 4886 (request received) and 4887 (certificate issued)
+// when the requester supplied a subject alternative name for another account,
+// the signature of ESC1 and ESC6 abuse
+func certificateRequest(data map[string]string) *Finding {
+	m := sanAttribute.FindStringSubmatch(data["Attributes"])
+	if m == nil {
+		return nil
+	}
+	requester := strings.ToLower(data["Requester"])
+	if i := strings.LastIndex(requester, `\`); i >= 0 {
+		requester = requester[i+1:]
+	}
+
+	for _, name := range strings.Split(m[1], "&") {
+		_, value, _ := strings.Cut(name, "=")
+		value = strings.ToLower(value)
+		user, _, _ := strings.Cut(value, "@")
+		if value == "" || user == requester || strings.TrimSuffix(user, "$") == strings.TrimSuffix(requester, "$") {
+			continue
+		}
+		return &Finding{
+			Severity: SeverityHigh,
+			Title:    "adcs-san-for-other-account",
+			Detail:   "request " + data["RequestId"] + " by " + data["Requester"] + " for " + m[1],
+		}
+	}
+	return nil
+}
+
+// templateChanged flags 4899; a template that now lets the enrollee supply the
+// subject becomes an ESC1 path
+func templateChanged(data map[string]string) *Finding {
+	finding := &Finding{
+		Severity: SeverityMedium,
+		Title:    "adcs-template-changed",
+		Detail:   data["TemplateInternalName"],
+	}
+	if strings.Contains(data["NewTemplateContent"], enrolleeSuppliesSubject) &&
+		!strings.Contains(data["TemplateContent"], enrolleeSuppliesSubject) {
+		finding.Severity = SeverityHigh
+		finding.Title = "adcs-template-enrollee-supplies-subject"
+	}
+	return finding
+}
+
+// templateSecurityChanged flags 4900; new enrollment rights on a template are the
+// ESC4 path
+func templateSecurityChanged(data map[string]string) *Finding {
+	return &Finding{
+		Severity: SeverityMedium,
+		Title:    "adcs-template-security-changed",
+		Detail:   data["TemplateInternalName"] + ": " + data["NewTemplateSecurityDescriptor"],
+	}
+}
@@ -0,0 +1,117 @@
+package findings
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Audit policy change messages (%%84xx) that remove auditing
+var auditRemovals = []string{
+	"%%8448", // Success removed
+	"%%8450", // Failure removed
+}
+
+// auditPolicyChanged flags 4719; removing auditing is how attackers blind the
+// Security log before acting
+func auditPolicyChanged(data map[string]string) *Finding {
+	changes := data["AuditPolicyChanges"]
+	finding := &Finding{
+		Severity: SeverityMedium,
+		Title:    "audit-policy-changed",
+		Detail:   "subcategory " + data["SubcategoryGuid"] + ": " + describeAuditChanges(changes),
+	}
+	for _, removal := range auditRemovals {
+		if strings.Contains(changes, removal) {
+			finding.Severity = SeverityHigh
+			finding.Title = "audit-policy-weakened"
+		}
+	}
+	return finding
+}
+
+// describeAuditChanges replaces the %%84xx message references of 4719
+func describeAuditChanges(changes string) string {
+	return strings.NewReplacer(
+		"%%8448", "success removed",
+		"%%8449", "success added",
+		"%%8450", "failure removed",
+		"%%8451", "failure added",
+	).Replace(changes)
+}
+
+// taskCommand extracts the command lines of a task definition (TaskContent)
+var taskCommand = regexp.MustCompile(`(?s)<Command>(.*?)</Command>\s*(?:<Arguments>(.*?)</Arguments>)?`)
+
+// suspiciousTaskCommand matches task actions commonly used for persistence
+var suspiciousTaskCommand = regexp.MustCompile(`(?i)\\(users|temp|appdata|programdata|public)\\|powershell|cmd(\.exe)?\s*/c|mshta|rundll32|regsvr32|wscript|cscript|-enc`)
+
+// taskCreated flags 4698; tasks launching from user-writable folders or through
+// script hosts are rated high
+func taskCreated(data map[string]string) *Finding {
+	finding := &Finding{
+		Severity: SeverityMedium,
+		Title:    "scheduled-task-created",
+		Detail:   data["TaskName"],
+	}
+	var commands []string
+	for _, m := range taskCommand.FindAllStringSubmatch(data["TaskContent"], -1) {
+		commands = append(commands, strings.TrimSpace(m[1]+" "+m[2]))
+	}
+	if len(commands) > 0 {
+		command := strings.Join(commands, "; ")
+		finding.Detail += " runs " + command
+		if suspiciousTaskCommand.MatchString(command) {
+			finding.Severity = SeverityHigh
+		}
+	}
+	return finding
+}
+
+// taskDeleted flags 4699; attackers remove their tasks after use
+func taskDeleted(data map[string]string) *Finding {
+	return &Finding{
+		Severity: SeverityLow,
+		Title:    "scheduled-task-deleted",
+		Detail:   data["TaskName"],
+	}
+}
+
+// sensitiveKeys are registry locations whose modification affects persistence or
+// security controls; 4657 is only logged for keys with an auditing SACL
+var sensitiveKeys = []struct {
+	fragment string
+	severity string
+}{
+	{`\currentversion\run`, SeverityHigh},
+	{`\currentversion\image file execution options`, SeverityHigh},
+	{`\currentversion\winlogon`, SeverityHigh},
+	{`\control\lsa`, SeverityHigh},
+	{`\control\securityproviders`, SeverityHigh},
+	{`\windows defender`, SeverityHigh},
+	{`\currentversion\windows`, SeverityMedium}, // AppInit_DLLs
+	{`\currentcontrolset\services`, SeverityMedium},
+	{`\policies\`, SeverityMedium},
+}
+
+// registryValueModified flags 4657 on sensitive keys; others are ignored
+func registryValueModified(data map[string]string) *Finding {
+	key := strings.ToLower(data["ObjectName"])
+	for _, sensitive := range sensitiveKeys {
+		if !strings.Contains(key, sensitive.fragment) {
+			continue
+		}
+		detail := data["ObjectName"] + `\` + data["ObjectValueName"]
+		if value := data["NewValue"]; value != "" && value != "-" {
+			detail += " = " + value
+		}
+		if process := data["ProcessName"]; process != "" {
+			detail += " by " + process
+		}
+		return &Finding{
+			Severity: sensitive.severity,
+			Title:    "sensitive-registry-change",
+			Detail:   detail,
+		}
+	}
+	return nil
+}
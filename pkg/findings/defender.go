@@ -0,0 +1,68 @@
+package findings
+
+import "strings"
+
+// defenderProtections are the Defender settings that switch protection off when
+// set to 1
+var defenderProtections = []string{
+	"DisableAntiSpyware",
+	"DisableAntiVirus",
+	"DisableRealtimeMonitoring",
+	"DisableBehaviorMonitoring",
+	"DisableIOAVProtection",
+	"DisableOnAccessProtection",
+	"DisableScriptScanning",
+}
+
+// Values of the TamperProtection setting that leave tamper protection off
+var tamperProtectionOff = map[string]bool{"0x0": true, "0x4": true}
+
+// defenderConfigChanged flags 5007 configuration changes that weaken Defender:
+// new exclusions, disabled protection and tamper protection changes. The old and
+// new values have the form "HKLM\SOFTWARE\Microsoft\Windows Defender\...\Name = 0x1".
+func defenderConfigChanged(data map[string]string) *Finding {
+	oldSetting, _ := splitSetting(data["OldValue"])
+	newSetting, newValue := splitSetting(data["NewValue"])
+	setting := newSetting
+	if setting == "" {
+		setting = oldSetting
+	}
+	lower := strings.ToLower(setting)
+
+	switch {
+	case strings.Contains(lower, `\exclusions\`):
+		if newSetting == "" {
+			return &Finding{Severity: SeverityLow, Title: "defender-exclusion-removed", Detail: exclusion(setting)}
+		}
+		if strings.EqualFold(oldSetting, newSetting) {
+			return nil
+		}
+		return &Finding{Severity: SeverityHigh, Title: "defender-exclusion-added", Detail: exclusion(setting)}
+	case strings.HasSuffix(lower, `\features\tamperprotection`):
+		if tamperProtectionOff[newValue] {
+			return &Finding{Severity: SeverityHigh, Title: "defender-tamper-protection-disabled", Detail: data["NewValue"]}
+		}
+		return &Finding{Severity: SeverityMedium, Title: "defender-tamper-protection-changed", Detail: data["NewValue"]}
+	}
+
+	for _, protection := range defenderProtections {
+		if strings.HasSuffix(lower, `\`+strings.ToLower(protection)) && newValue == "0x1" {
+			return &Finding{Severity: SeverityHigh, Title: "defender-protection-disabled", Detail: data["NewValue"]}
+		}
+	}
+	return nil
+}
+
+// splitSetting splits "key\name = value" into the setting path and its value
+func splitSetting(s string) (string, string) {
+	setting, value, _ := strings.Cut(s, " = ")
+	return strings.TrimSpace(setting), strings.ToLower(strings.TrimSpace(value))
+}
+
+// exclusion returns the excluded path, extension, process or address and its type
+// from an exclusion setting, e.g. "Paths: C:\Temp"
+func exclusion(setting string) string {
+	i := strings.Index(strings.ToLower(setting), `\exclusions\`)
+	kind, item, _ := strings.Cut(setting[i+len(`\exclusions\`):], `\`)
+	return kind + ": " + item
+}
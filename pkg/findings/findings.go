@@ -0,0 +1,110 @@
+package findings
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Severities, most severe first
+const (
+	SeverityHigh   = "high"
+	SeverityMedium = "medium"
+	SeverityLow    = "low"
+)
+
+var severityRank = map[string]int{SeverityHigh: 0, SeverityMedium: 1, SeverityLow: 2}
+
+// Finding is a security-relevant configuration change worth an analyst's attention
+type Finding struct {
+	Time     time.Time `json:"time"`
+	Host     string    `json:"host"`
+	EventID  uint32    `json:"event_id"`
+	UID      string    `json:"uid,omitempty"`
+	Severity string    `json:"severity"`
+	Title    string    `json:"title"`
+	Detail   string    `json:"detail,omitempty"`
+	By       string    `json:"by,omitempty"` // DOMAIN\user that made the change
+}
+
+// analyzer inspects one event's named data and returns a finding, or nil
+type analyzer func(data map[string]string) *Finding
+
+// analyzerKey identifies the events an analyzer handles
+type analyzerKey struct {
+	Channel string // Lowercase
+	EventID uint32
+}
+
+// analyzers are keyed by channel and event ID
+var analyzers = map[analyzerKey]analyzer{
+	{"security", 4719}: auditPolicyChanged,
+	{"security", 4698}: taskCreated,
+	{"security", 4699}: taskDeleted,
+	{"security", 4657}: registryValueModified,
+	{"security", 4886}: certificateRequest,
+	{"security", 4887}: certificateRequest,
+	{"security", 4899}: templateChanged,
+	{"security", 4900}: templateSecurityChanged,
+	{"microsoft-windows-windows defender/operational", 5007}: defenderConfigChanged,
+}
+
+// Collector runs the analyzers over events and keeps the findings
+type Collector struct {
+	findings []Finding
+}
+
+// NewCollector returns an empty collector
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// Add analyzes events and marks those with a finding with its title
+func (c *Collector) Add(events []eventlog.EventLogData) {
+	if c == nil {
+		return
+	}
+	for i := range events {
+		event := &events[i]
+		analyze, ok := analyzers[analyzerKey{strings.ToLower(event.Channel), event.EventID}]
+		if !ok {
+			continue
+		}
+		data := eventlog.NamedData(event.Channel, *event)
+		finding := analyze(data)
+		if finding == nil {
+			continue
+		}
+		finding.Time = eventlog.EventTime(event.TimeGenerated)
+		finding.Host = event.ComputerName
+		finding.EventID = event.EventID
+		finding.UID = event.UID
+		if user := data["SubjectUserName"]; user != "" {
+			finding.By = data["SubjectDomainName"] + `\` + user
+		}
+		c.findings = append(c.findings, *finding)
+		event.Detections = append(event.Detections, finding.Title)
+	}
+}
+
+// Len returns the number of findings
+func (c *Collector) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.findings)
+}
+
+// Findings returns the findings, most severe first and in time order within a severity
+func (c *Collector) Findings() []Finding {
+	list := append([]Finding(nil), c.findings...)
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Severity != list[j].Severity {
+			return severityRank[list[i].Severity] < severityRank[list[j].Severity]
+		}
+		return list[i].Time.Before(list[j].Time)
+	})
+	return list
+}
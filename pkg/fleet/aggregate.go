@@ -0,0 +1,262 @@
+package fleet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/filesenum"
+	"lemita/datn/pkg/store"
+)
+
+// failedLogonEventID is the Security event for a failed logon
+const failedLogonEventID = 4625
+
+// HostCount is a per-host counter
+type HostCount struct {
+	Host  string `json:"host"`
+	Count int    `json:"count"`
+}
+
+// StackEntry is a persistence binary (by kind and hash) and the hosts it was seen on
+type StackEntry struct {
+	Kind  string   `json:"kind"` // filesenum.Kind*
+	Hash  string   `json:"sha256"`
+	Name  string   `json:"name"`
+	Path  string   `json:"path"`
+	Hosts []string `json:"hosts"`
+	Names []string `json:"names"` // Every entry name seen with this hash
+}
+
+// Report holds fleet-wide statistics over saved runs
+type Report struct {
+	Runs          int          `json:"runs"`
+	Hosts         []string     `json:"hosts"`
+	Events        int          `json:"events"`
+	FailedLogons  []HostCount  `json:"failed_logons"`  // Hosts with the most 4625 events, descending
+	LeastFrequent []StackEntry `json:"least_frequent"` // Rarest persistence binaries, ascending by host count
+	Inventoried   int          `json:"inventoried_hosts"`
+}
+
+// Aggregate merges saved runs and computes fleet statistics. Events collected twice
+// by overlapping runs of the same host are counted once. Persistence binaries found
+// on at most maxHosts of the inventoried hosts are listed in LeastFrequent.
+func Aggregate(runs []Run, top, maxHosts int) (*Report, error) {
+	report := &Report{Runs: len(runs)}
+
+	hosts := map[string]bool{}
+	failedLogons := map[string]int{}
+	seen := map[string]bool{}
+	for _, run := range runs {
+		hosts[run.Host] = true
+		err := store.ScanFile(run.EventsPath(), func(event eventlog.EventLogData) error {
+			key := run.Host + "|" + event.UID
+			if event.UID == "" {
+				key = fmt.Sprintf("%s|%s|%d", run.Host, event.Channel, event.RecordNumber)
+			}
+			if seen[key] {
+				return nil
+			}
+			seen[key] = true
+			report.Events++
+
+			if event.EventID == failedLogonEventID && strings.EqualFold(event.Channel, "Security") {
+				failedLogons[run.Host]++
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for host := range hosts {
+		report.Hosts = append(report.Hosts, host)
+	}
+	sort.Strings(report.Hosts)
+
+	report.FailedLogons = topCounts(failedLogons, top)
+
+	stack, inventoried, err := Stack(runs)
+	if err != nil {
+		return nil, err
+	}
+	report.Inventoried = inventoried
+	for _, entry := range stack {
+		if len(entry.Hosts) > maxHosts {
+			break
+		}
+		report.LeastFrequent = append(report.LeastFrequent, entry)
+	}
+
+	return report, nil
+}
+
+// Stack performs least-frequency-of-occurrence analysis on the persistence
+// inventories of the runs: every binary is counted by the number
+// of hosts it was seen on, so that binaries unique to one host come first. Entries
+// are grouped by kind and hash. It also returns the number of hosts that had an
+// inventory.
+func Stack(runs []Run) ([]StackEntry, int, error) {
+	entries := map[string]*StackEntry{}
+	inventoried := map[string]bool{}
+	for _, run := range runs {
+		inventory, err := run.Inventory()
+		if err != nil {
+			return nil, 0, err
+		}
+		if inventory == nil {
+			continue
+		}
+		inventoried[run.Host] = true
+
+		for _, item := range inventory {
+			if item.Hash == "" || item.Hash == filesenum.UnavailableHash {
+				continue
+			}
+			key := item.Kind + "|" + item.Hash
+			entry, ok := entries[key]
+			if !ok {
+				entry = &StackEntry{Kind: item.Kind, Hash: item.Hash, Name: item.Name, Path: item.FilePath}
+				entries[key] = entry
+			}
+			entry.Hosts = appendUnique(entry.Hosts, run.Host)
+			name := item.Name
+			if item.Service != "" {
+				name = item.Service
+			}
+			entry.Names = appendUnique(entry.Names, name)
+		}
+	}
+
+	stack := make([]StackEntry, 0, len(entries))
+	for _, entry := range entries {
+		sort.Strings(entry.Hosts)
+		stack = append(stack, *entry)
+	}
+	sort.Slice(stack, func(i, j int) bool {
+		a, b := stack[i], stack[j]
+		if len(a.Hosts) != len(b.Hosts) {
+			return len(a.Hosts) < len(b.Hosts)
+		}
+		if a.Hosts[0] != b.Hosts[0] {
+			return a.Hosts[0] < b.Hosts[0]
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+	return stack, len(inventoried), nil
+}
+
+// Sighting is the first and last time a value was seen on a host
+type Sighting struct {
+	Host      string    `json:"host"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Events    int       `json:"events"`
+	Sources   []string  `json:"sources"` // Channels or inventory kinds ("service", "task", ...) where the value appeared
+}
+
+// Timeline returns where a value (hash, IP address, or any other string) appears in
+// the saved runs, one sighting per host ordered by first appearance. Event
+// insertion strings are matched case-insensitively as substrings, so a SHA-256
+// matches Sysmon's "SHA256=...,MD5=..." Hashes field; persistence inventories match
+// on the binary hash and count from the time of the run.
+func Timeline(runs []Run, value string) ([]Sighting, error) {
+	needle := strings.ToLower(strings.TrimSpace(value))
+	if needle == "" {
+		return nil, fmt.Errorf("empty timeline value")
+	}
+
+	byHost := map[string]*Sighting{}
+	record := func(host, source string, t time.Time) {
+		s, ok := byHost[host]
+		if !ok {
+			s = &Sighting{Host: host, FirstSeen: t, LastSeen: t}
+			byHost[host] = s
+		}
+		if t.Before(s.FirstSeen) {
+			s.FirstSeen = t
+		}
+		if t.After(s.LastSeen) {
+			s.LastSeen = t
+		}
+		s.Sources = appendUnique(s.Sources, source)
+	}
+
+	for _, run := range runs {
+		seen := map[string]bool{}
+		err := store.ScanFile(run.EventsPath(), func(event eventlog.EventLogData) error {
+			for _, s := range event.Strings {
+				if !strings.Contains(strings.ToLower(s), needle) {
+					continue
+				}
+				key := fmt.Sprintf("%s|%d", event.Channel, event.RecordNumber)
+				if !seen[key] {
+					seen[key] = true
+					record(run.Host, event.Channel, time.Unix(int64(event.TimeGenerated), 0))
+					byHost[run.Host].Events++
+				}
+				break
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		inventory, err := run.Inventory()
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range inventory {
+			if strings.ToLower(item.Hash) == needle {
+				record(run.Host, item.Kind, run.Started)
+			}
+		}
+	}
+
+	sightings := make([]Sighting, 0, len(byHost))
+	for _, s := range byHost {
+		sightings = append(sightings, *s)
+	}
+	sort.Slice(sightings, func(i, j int) bool {
+		if !sightings[i].FirstSeen.Equal(sightings[j].FirstSeen) {
+			return sightings[i].FirstSeen.Before(sightings[j].FirstSeen)
+		}
+		return sightings[i].Host < sightings[j].Host
+	})
+	return sightings, nil
+}
+
+// topCounts returns the n largest counts, descending (n <= 0 returns all)
+func topCounts(counts map[string]int, n int) []HostCount {
+	list := make([]HostCount, 0, len(counts))
+	for host, count := range counts {
+		list = append(list, HostCount{Host: host, Count: count})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Host < list[j].Host
+	})
+	if n > 0 && len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+// appendUnique appends s to list unless it is already present
+func appendUnique(list []string, s string) []string {
+	for _, existing := range list {
+		if existing == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,205 @@
+package fleet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/store"
+)
+
+// Security events of the lockout analysis
+const (
+	lockoutEventID = 4740 // A user account was locked out (logged on domain controllers)
+	unlockEventID  = 4767 // A user account was unlocked
+)
+
+// badPasswordStatuses are the 4625 status and sub-status codes of the attempts that
+// count toward, or hit, a lockout
+var badPasswordStatuses = map[string]bool{
+	"0xc000006a": true, // Wrong password
+	"0xc0000234": true, // Account locked out
+}
+
+// LockoutSource is a computer, address and process that submitted bad passwords
+type LockoutSource struct {
+	Workstation string    `json:"workstation,omitempty"`
+	IpAddress   string    `json:"ip_address,omitempty"`
+	Process     string    `json:"process,omitempty"`
+	LogonType   string    `json:"logon_type,omitempty"`
+	ReportedBy  []string  `json:"reported_by"` // Hosts that logged the failures
+	Count       int       `json:"count"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// Unlock is an administrator unlocking the account
+type Unlock struct {
+	Time time.Time `json:"time"`
+	By   string    `json:"by"`
+	Host string    `json:"host"`
+}
+
+// AccountLockouts is the root-cause analysis of one account's lockouts
+type AccountLockouts struct {
+	Account         string          `json:"account"`
+	Lockouts        int             `json:"lockouts"`
+	FirstLockout    time.Time       `json:"first_lockout,omitempty"`
+	LastLockout     time.Time       `json:"last_lockout,omitempty"`
+	CallerComputers []HostCount     `json:"caller_computers"` // Computers named by 4740 as the lockout source
+	Sources         []LockoutSource `json:"sources"`          // Bad-password sources from 4625, most first
+	Unlocks         []Unlock        `json:"unlocks"`
+}
+
+// Lockouts identifies the workstations and processes causing account lockouts in
+// the saved runs. Domain controllers name the caller computer in 4740; the 4625
+// failures logged there and on member servers add the address and process that
+// used the stale password. With account empty, every account that was locked out
+// is analyzed, most lockouts first.
+func Lockouts(runs []Run, account string) ([]AccountLockouts, error) {
+	account = accountName(account)
+
+	type analysis struct {
+		AccountLockouts
+		callers map[string]int
+		sources map[string]*LockoutSource
+	}
+	accounts := map[string]*analysis{}
+	get := func(name string) *analysis {
+		key := strings.ToLower(name)
+		a, ok := accounts[key]
+		if !ok {
+			a = &analysis{
+				AccountLockouts: AccountLockouts{Account: name},
+				callers:         map[string]int{},
+				sources:         map[string]*LockoutSource{},
+			}
+			accounts[key] = a
+		}
+		return a
+	}
+
+	seen := map[string]bool{}
+	for _, run := range runs {
+		err := store.ScanFile(run.EventsPath(), func(event eventlog.EventLogData) error {
+			if !strings.EqualFold(event.Channel, "Security") {
+				return nil
+			}
+			switch event.EventID {
+			case lockoutEventID, unlockEventID, failedLogonEventID:
+			default:
+				return nil
+			}
+			data := eventlog.NamedData(event.Channel, event)
+			name := data["TargetUserName"]
+			if name == "" || (account != "" && !strings.EqualFold(name, account)) {
+				return nil
+			}
+			key := run.Host + "|" + event.UID
+			if event.UID == "" {
+				key = fmt.Sprintf("%s|%s|%d", run.Host, event.Channel, event.RecordNumber)
+			}
+			if seen[key] {
+				return nil
+			}
+			seen[key] = true
+
+			when := eventlog.EventTime(event.TimeGenerated)
+			switch event.EventID {
+			case lockoutEventID:
+				a := get(name)
+				a.Lockouts++
+				if a.FirstLockout.IsZero() || when.Before(a.FirstLockout) {
+					a.FirstLockout = when
+				}
+				if when.After(a.LastLockout) {
+					a.LastLockout = when
+				}
+				// The caller computer is logged in the TargetDomainName field
+				if caller := data["TargetDomainName"]; caller != "" {
+					a.callers[strings.ToUpper(caller)]++
+				}
+			case unlockEventID:
+				a := get(name)
+				a.Unlocks = append(a.Unlocks, Unlock{Time: when, By: data["SubjectUserName"], Host: run.Host})
+			case failedLogonEventID:
+				if !badPasswordStatuses[strings.ToLower(data["Status"])] && !badPasswordStatuses[strings.ToLower(data["SubStatus"])] {
+					return nil
+				}
+				a := get(name)
+				source := LockoutSource{
+					Workstation: strings.ToUpper(blankDash(data["WorkstationName"])),
+					IpAddress:   blankDash(data["IpAddress"]),
+					Process:     blankDash(data["ProcessName"]),
+					LogonType:   data["LogonType"],
+				}
+				sourceKey := strings.Join([]string{source.Workstation, source.IpAddress, strings.ToLower(source.Process), source.LogonType}, "|")
+				s, ok := a.sources[sourceKey]
+				if !ok {
+					s = &source
+					a.sources[sourceKey] = s
+				}
+				s.Count++
+				s.ReportedBy = appendUnique(s.ReportedBy, run.Host)
+				if when.After(s.LastSeen) {
+					s.LastSeen = when
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var results []AccountLockouts
+	for _, a := range accounts {
+		// Accounts with bad passwords but no lockout are only of interest when asked for
+		if account == "" && a.Lockouts == 0 {
+			continue
+		}
+		a.CallerComputers = topCounts(a.callers, 0)
+		for _, s := range a.sources {
+			sort.Strings(s.ReportedBy)
+			a.Sources = append(a.Sources, *s)
+		}
+		sort.Slice(a.Sources, func(i, j int) bool {
+			if a.Sources[i].Count != a.Sources[j].Count {
+				return a.Sources[i].Count > a.Sources[j].Count
+			}
+			return a.Sources[i].LastSeen.After(a.Sources[j].LastSeen)
+		})
+		sort.Slice(a.Unlocks, func(i, j int) bool {
+			return a.Unlocks[i].Time.Before(a.Unlocks[j].Time)
+		})
+		results = append(results, a.AccountLockouts)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Lockouts != results[j].Lockouts {
+			return results[i].Lockouts > results[j].Lockouts
+		}
+		return results[i].Account < results[j].Account
+	})
+	return results, nil
+}
+
+// accountName strips the domain from DOMAIN\user and user@domain
+func accountName(account string) string {
+	account = strings.TrimSpace(account)
+	if i := strings.LastIndex(account, `\`); i >= 0 {
+		account = account[i+1:]
+	}
+	if i := strings.Index(account, "@"); i >= 0 {
+		account = account[:i]
+	}
+	return account
+}
+
+// blankDash returns "" for the "-" Windows logs in place of empty fields
+func blankDash(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,150 @@
+package fleet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"lemita/datn/pkg/audit"
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/filesenum"
+)
+
+// Files written for every host of a fleet run, under <outdir>/<host>/<timestamp>/
+const (
+	ReportFile   = "events.log"
+	EventsFile   = "events.jsonl"
+	SummaryFile  = "summary.json"
+	ServicesFile = "services.json"
+	TasksFile    = "tasks.json"
+	AutorunsFile = "autoruns.json"
+	COMFile      = "com.json"
+	IFEOFile     = "ifeo.json"
+)
+
+// inventoryFiles maps every persistence inventory file to the kind of its entries
+var inventoryFiles = []struct{ file, kind string }{
+	{ServicesFile, filesenum.KindService},
+	{TasksFile, filesenum.KindTask},
+	{AutorunsFile, filesenum.KindAutorun},
+	{COMFile, filesenum.KindCOM},
+	{IFEOFile, filesenum.KindIFEO},
+}
+
+// RunTimestampLayout names the per-run directories
+const RunTimestampLayout = "20060102-150405"
+
+// HostSummary describes the collection from one host of a fleet run
+type HostSummary struct {
+	Host           string                  `json:"host"`
+	Case           *eventlog.Case          `json:"case,omitempty"`
+	Started        time.Time               `json:"started"`
+	Duration       time.Duration           `json:"duration"`
+	Events         int                     `json:"events"`
+	ChannelsFailed int                     `json:"channels_failed"`
+	Succeeded      bool                    `json:"succeeded"`
+	Detections     map[string]int          `json:"detections,omitempty"`
+	CoverageGaps   []string                `json:"coverage_gaps,omitempty"`  // Channels that rolled over inside the -since window
+	Services       int                     `json:"services,omitempty"`       // Number of inventoried services
+	Tasks          int                     `json:"tasks,omitempty"`          // Number of inventoried scheduled task actions
+	Autoruns       int                     `json:"autoruns,omitempty"`       // Number of inventoried autoruns
+	COMHijacks     int                     `json:"com_hijacks,omitempty"`    // Number of COM servers in user-writable folders
+	IFEODebuggers  int                     `json:"ifeo_debuggers,omitempty"` // Number of IFEO debugger values
+	Timings        []eventlog.StageTimings `json:"timings,omitempty"`        // Per-channel open, read, parse, format and write times
+	Audit          *audit.Head             `json:"audit,omitempty"`          // Newest audit log record once the host was collected
+	Directory      string                  `json:"directory"`
+	Error          string                  `json:"error,omitempty"`
+}
+
+// Run is one host's saved collection
+type Run struct {
+	Host    string
+	Dir     string
+	Started time.Time
+}
+
+// EventsPath returns the run's JSONL events file
+func (r Run) EventsPath() string {
+	return filepath.Join(r.Dir, EventsFile)
+}
+
+// Inventory reads the run's persistence inventories (services, scheduled tasks,
+// autoruns, COM servers and IFEO debuggers), with the Kind of every entry set; runs without any inventory return nil
+func (r Run) Inventory() ([]filesenum.PEInfo, error) {
+	var inventory []filesenum.PEInfo
+	for _, f := range inventoryFiles {
+		data, err := os.ReadFile(filepath.Join(r.Dir, f.file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s of %s: %v", f.file, r.Dir, err)
+		}
+
+		var entries []filesenum.PEInfo
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse %s of %s: %v", f.file, r.Dir, err)
+		}
+		for i := range entries {
+			if entries[i].Kind == "" {
+				entries[i].Kind = f.kind
+			}
+		}
+		if inventory == nil {
+			inventory = []filesenum.PEInfo{}
+		}
+		inventory = append(inventory, entries...)
+	}
+	return inventory, nil
+}
+
+// FindRuns walks fleet output directories (or individual host or run directories)
+// for saved runs, identified by their events file. The host name comes from the
+// run's summary, falling back to the <host>/<timestamp> directory layout.
+func FindRuns(roots []string) ([]Run, error) {
+	var runs []Run
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || d.Name() != EventsFile {
+				return nil
+			}
+
+			dir := filepath.Dir(path)
+			run := Run{Host: filepath.Base(filepath.Dir(dir)), Dir: dir}
+			if started, err := time.ParseInLocation(RunTimestampLayout, filepath.Base(dir), time.Local); err == nil {
+				run.Started = started
+			}
+			if data, err := os.ReadFile(filepath.Join(dir, SummaryFile)); err == nil {
+				var summary HostSummary
+				if json.Unmarshal(data, &summary) == nil {
+					if summary.Host != "" {
+						run.Host = summary.Host
+					}
+					if !summary.Started.IsZero() {
+						run.Started = summary.Started
+					}
+				}
+			}
+			runs = append(runs, run)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %v", root, err)
+		}
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		if runs[i].Host != runs[j].Host {
+			return runs[i].Host < runs[j].Host
+		}
+		return runs[i].Started.Before(runs[j].Started)
+	})
+	return runs, nil
+}
@@ -0,0 +1,97 @@
+package formatter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/dedup"
+)
+
+// aggregateMessageLength bounds the characters of the message shown per group in
+// the text report
+const aggregateMessageLength = 200
+
+// aggregateCSVColumns are the columns of a CSV report in aggregate mode, in order
+var aggregateCSVColumns = []string{"channel", "event_id", "source", "count", "first", "last", "message"}
+
+// WriteAggregatedChannel writes the groups of identical events of a channel, one
+// entry per group with its count and first and last times
+func WriteAggregatedChannel(w io.StringWriter, channel string, groups []dedup.Group) error {
+	total := 0
+	for _, group := range groups {
+		total += group.Count
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Found %d logs in %s channel, %d distinct\n", total, channel, len(groups)))
+	if len(groups) == 0 {
+		sb.WriteString("No matching events found with the specified Event IDs in this channel.\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("  %7s  %-19s  %-19s  %7s  %s\n", "Count", "First", "Last", "EventID", "Source"))
+	}
+	for _, group := range groups {
+		sb.WriteString(fmt.Sprintf("  %7d  %-19s  %-19s  %7d  %s\n", group.Count, formatGroupTime(group.First), formatGroupTime(group.Last), group.EventID, group.Source))
+		message := strings.Join(strings.Fields(group.Message), " ")
+		if runes := []rune(message); len(runes) > aggregateMessageLength {
+			message = string(runes[:aggregateMessageLength]) + "..."
+		}
+		if message != "" {
+			sb.WriteString("           " + message + "\n")
+		}
+	}
+	sb.WriteString(strings.Repeat("-", 50) + "\n")
+	_, err := w.WriteString(sb.String())
+	return err
+}
+
+// WriteAggregatedJSON writes the groups of a channel as newline-delimited JSON
+func WriteAggregatedJSON(w io.StringWriter, groups []dedup.Group) error {
+	for _, group := range groups {
+		group.First, group.Last = group.First.In(timeZone), group.Last.In(timeZone)
+		data, err := json.Marshal(group)
+		if err != nil {
+			return fmt.Errorf("failed to encode group of event %d: %v", group.EventID, err)
+		}
+		if _, err := w.WriteString(string(data) + "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AggregateCSVHeader returns the header row of a CSV report in aggregate mode
+func AggregateCSVHeader() string {
+	header, _ := encodeCSV(aggregateCSVColumns)
+	return header
+}
+
+// WriteAggregatedCSV writes the groups of a channel as CSV rows with the columns
+// of AggregateCSVHeader
+func WriteAggregatedCSV(w io.StringWriter, groups []dedup.Group) error {
+	for _, group := range groups {
+		row, err := encodeCSV([]string{
+			csvCell(group.Channel),
+			strconv.FormatUint(uint64(group.EventID), 10),
+			csvCell(group.Source),
+			strconv.Itoa(group.Count),
+			formatGroupTime(group.First),
+			formatGroupTime(group.Last),
+			csvCell(group.Message),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode group of event %d: %v", group.EventID, err)
+		}
+		if _, err := w.WriteString(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatGroupTime formats the first or last time of a group in the report's zone
+func formatGroupTime(t time.Time) string {
+	return t.In(timeZone).Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,73 @@
+package formatter_test
+
+import (
+	"strings"
+	"testing"
+
+	"lemita/datn/pkg/benchmark"
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/formatter"
+)
+
+// Benchmarks over benchmark.DefaultEvents synthetic events, the same cases datn
+// bench runs; see make bench for comparing a change with benchstat
+
+func BenchmarkFormatLogEntry(b *testing.B) {
+	benchmarkFormat(b, func(event eventlog.EventLogData) (string, error) {
+		return formatter.FormatLogEntry(event, 0), nil
+	})
+}
+
+func BenchmarkFormatJSON(b *testing.B) {
+	benchmarkFormat(b, formatter.FormatJSON)
+}
+
+func BenchmarkFormatCSV(b *testing.B) {
+	benchmarkFormat(b, formatter.FormatCSV)
+}
+
+func BenchmarkFormatHTML(b *testing.B) {
+	benchmarkFormat(b, func(event eventlog.EventLogData) (string, error) {
+		return formatter.FormatHTML(event), nil
+	})
+}
+
+func BenchmarkWriteJSONChannel(b *testing.B) {
+	events := benchmark.Events(benchmark.DefaultEvents)
+	var sb strings.Builder
+	if err := formatter.WriteJSONChannel(&sb, "Security", events); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(sb.Len()))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sb.Reset()
+		if err := formatter.WriteJSONChannel(&sb, "Security", events); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkFormat measures a formatter over every synthetic event
+func benchmarkFormat(b *testing.B, format func(eventlog.EventLogData) (string, error)) {
+	events := benchmark.Events(benchmark.DefaultEvents)
+	var size int64
+	for _, event := range events {
+		s, err := format(event)
+		if err != nil {
+			b.Fatal(err)
+		}
+		size += int64(len(s))
+	}
+	b.SetBytes(size)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, event := range events {
+			if _, err := format(event); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package formatter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// CSVFormat is the spreadsheet report format, see FormatCSV
+const CSVFormat = "csv"
+
+// csvColumns are the columns of a CSV report, in order
+var csvColumns = []string{"channel", "record_number", "time", "event_id", "type", "source", "computer", "strings", "message", "case"}
+
+// csvStringSeparator joins the insertion strings of an event into one cell
+const csvStringSeparator = " | "
+
+// csvCell protects a value from being evaluated as a formula when the report is
+// opened in Excel: event data is attacker-controlled, so text starting with a
+// formula character is prefixed with an apostrophe
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// caseID returns the identifier of a case; empty without a case
+func caseID(c *eventlog.Case) string {
+	if c == nil {
+		return ""
+	}
+	return c.ID
+}
+
+// encodeCSV renders one CSV record, newline included
+func encodeCSV(record []string) (string, error) {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.UseCRLF = true // What Excel writes and expects
+	if err := w.Write(record); err != nil {
+		return "", err
+	}
+	w.Flush()
+	return b.String(), w.Error()
+}
+
+// CSVHeader returns the header row of a CSV report
+func CSVHeader() string {
+	header, _ := encodeCSV(csvColumns)
+	return header
+}
+
+// FormatCSV serializes an event as one CSV row with the columns of CSVHeader: the
+// generation time in the report's time zone (UTC unless set by SetTimeZone), the
+// insertion strings joined with " | " and the rendered message, either of which is
+// left empty when SetMessageDetail leaves it out
+func FormatCSV(log eventlog.EventLogData) (string, error) {
+	log = withMessageDetail(log)
+	row, err := encodeCSV([]string{
+		csvCell(log.Channel),
+		strconv.FormatUint(uint64(log.RecordNumber), 10),
+		eventTime(log.TimeGenerated).Format("2006-01-02 15:04:05"),
+		strconv.FormatUint(uint64(log.EventID), 10),
+		eventlog.GetEventTypeName(log.EventType),
+		csvCell(log.SourceName),
+		csvCell(log.ComputerName),
+		csvCell(strings.Join(log.Strings, csvStringSeparator)),
+		csvCell(log.Message),
+		csvCell(caseID(log.Case)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode event %d: %v", log.RecordNumber, err)
+	}
+	return row, nil
+}
+
+// WriteCSVChannel writes the logs from a particular channel as CSV rows. The header
+// row is written once per report with CSVHeader.
+func WriteCSVChannel(w io.StringWriter, channel string, logs []eventlog.EventLogData) error {
+	for _, log := range logs {
+		if log.Channel == "" {
+			log.Channel = channel
+		}
+		row, err := FormatCSV(log)
+		if err != nil {
+			return err
+		}
+		if _, err := w.WriteString(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package formatter
+
+import "lemita/datn/pkg/eventlog"
+
+// Message details accepted by SetMessageDetail: what the report shows of an
+// event's description
+const (
+	MessageDetailMessage = "message" // Only the rendered message; readable text for responders
+	MessageDetailStrings = "strings" // Only the raw insertion strings and named fields, for detection engineering
+	MessageDetailBoth    = "both"    // The rendered message and the raw insertion strings
+)
+
+// messageDetail is what the report formats show of an event's description; both
+// unless SetMessageDetail is called
+var messageDetail = MessageDetailBoth
+
+// ValidMessageDetail reports whether detail is a supported message detail
+func ValidMessageDetail(detail string) bool {
+	return detail == MessageDetailMessage || detail == MessageDetailStrings || detail == MessageDetailBoth
+}
+
+// SetMessageDetail sets what the report formats show of an event's description
+func SetMessageDetail(detail string) {
+	messageDetail = detail
+}
+
+// withMessageDetail returns the event with the description parts the message
+// detail leaves out cleared. An event without a rendered message keeps its raw
+// strings whatever the detail, since they are all there is of its description.
+func withMessageDetail(log eventlog.EventLogData) eventlog.EventLogData {
+	switch {
+	case messageDetail == MessageDetailStrings:
+		log.Message = ""
+	case messageDetail == MessageDetailMessage && log.Message != "":
+		log.Strings = nil
+		log.Fields = nil
+	}
+	return log
+}
@@ -0,0 +1,59 @@
+package formatter
+
+import (
+	"encoding/binary"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Report file encodings
+const (
+	UTF8Encoding    = "utf8"     // UTF-8 without a byte order mark
+	UTF8BOMEncoding = "utf8-bom" // UTF-8 with a byte order mark, which Excel needs to read CSV files as UTF-8
+	UTF16LEEncoding = "utf16le"  // UTF-16 little endian with a byte order mark, for older Windows editors
+)
+
+// Byte order marks written at the start of new report files
+var (
+	utf8BOM    = []byte{0xef, 0xbb, 0xbf}
+	utf16LEBOM = []byte{0xff, 0xfe}
+)
+
+// ValidEncoding reports whether encoding is a supported report file encoding
+func ValidEncoding(encoding string) bool {
+	return encoding == UTF8Encoding || encoding == UTF8BOMEncoding || encoding == UTF16LEEncoding
+}
+
+// encoder converts the UTF-8 report output to the file encoding
+type encoder struct {
+	utf16   bool
+	pending []byte // Incomplete UTF-8 sequence at the end of the last write
+	out     []byte
+}
+
+// encode returns p in the file encoding. Invalid UTF-8, such as event strings
+// decoded with the wrong code page, becomes U+FFFD.
+func (e *encoder) encode(p []byte) []byte {
+	if !e.utf16 {
+		return p
+	}
+	if len(e.pending) > 0 {
+		p = append(e.pending, p...)
+		e.pending = nil
+	}
+	e.out = e.out[:0]
+	for len(p) > 0 {
+		r, size := utf8.DecodeRune(p)
+		if r == utf8.RuneError && size < utf8.UTFMax && !utf8.FullRune(p) {
+			e.pending = append(e.pending, p...) // Completed by the next write
+			break
+		}
+		p = p[size:]
+		if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+			e.out = binary.LittleEndian.AppendUint16(e.out, uint16(r1))
+			r = r2
+		}
+		e.out = binary.LittleEndian.AppendUint16(e.out, uint16(r))
+	}
+	return e.out
+}
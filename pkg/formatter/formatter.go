@@ -2,23 +2,67 @@ package formatter
 
 import (
 	"fmt"
+	"io"
 	"strings"
+	"time"
 
+	"lemita/datn/pkg/allowlist"
+	"lemita/datn/pkg/boot"
+	"lemita/datn/pkg/config"
+	"lemita/datn/pkg/crashes"
+	"lemita/datn/pkg/domains"
 	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/findings"
+	"lemita/datn/pkg/groups"
+	"lemita/datn/pkg/privileges"
+	"lemita/datn/pkg/wfp"
 )
 
-// FormatLogEntry creates a human-readable string representation of an event log entry
+// FormatLogEntry creates a human-readable string representation of an event log
+// entry, with the description parts selected by SetMessageDetail
 func FormatLogEntry(log eventlog.EventLogData, index int) string {
 	var sb strings.Builder
+	log = withMessageDetail(log)
 
 	sb.WriteString(fmt.Sprintf("\nLog #%d:\n", index+1))
 	sb.WriteString(fmt.Sprintf("  Source: %s\n", log.SourceName))
 	sb.WriteString(fmt.Sprintf("  Computer: %s\n", log.ComputerName))
+	if log.UserName != "" {
+		sb.WriteString(fmt.Sprintf("  User: %s\\%s (%s)\n", log.UserDomain, log.UserName, log.UserSid))
+	} else if log.UserSid != "" {
+		sb.WriteString(fmt.Sprintf("  User: %s\n", log.UserSid))
+	}
 	sb.WriteString(fmt.Sprintf("  EventID: %d\n", log.EventID))
 	sb.WriteString(fmt.Sprintf("  Type: %s\n", eventlog.GetEventTypeName(log.EventType)))
 	sb.WriteString(fmt.Sprintf("  Category: %d\n", log.EventCategory))
-	sb.WriteString(fmt.Sprintf("  Time: %s\n", eventlog.WindowsTimeToTime(log.TimeGenerated)))
+	sb.WriteString(fmt.Sprintf("  Time: %s\n", eventTime(log.TimeGenerated).Format("2006-01-02 15:04:05 MST")))
+	if log.UID != "" {
+		sb.WriteString(fmt.Sprintf("  UID: %s\n", log.UID))
+	}
+	if len(log.Tags) > 0 {
+		sb.WriteString(fmt.Sprintf("  Tags: %s\n", FormatTags(log.Tags)))
+	}
+	if len(log.Annotations) > 0 {
+		sb.WriteString(fmt.Sprintf("  Annotations: %s\n", FormatTags(log.Annotations)))
+	}
+	if len(log.Detections) > 0 {
+		sb.WriteString(fmt.Sprintf("  Detections: %s\n", strings.Join(log.Detections, ", ")))
+	}
+	for _, note := range log.Notes {
+		sb.WriteString(fmt.Sprintf("  Note: %s %s", note.Time.In(timeZone).Format("2006-01-02 15:04"), note.Author))
+		if len(note.Labels) > 0 {
+			sb.WriteString(" [" + strings.Join(note.Labels, ", ") + "]")
+		}
+		if note.Text != "" {
+			sb.WriteString(": " + note.Text)
+		}
+		sb.WriteString("\n")
+	}
 
+	if log.Message != "" {
+		message := strings.ReplaceAll(strings.ReplaceAll(log.Message, "\r\n", "\n"), "\n", "\n    ")
+		sb.WriteString(fmt.Sprintf("  Message: %s\n", message))
+	}
 	if len(log.Strings) > 0 {
 		sb.WriteString("  Messages:\n")
 		for j, msg := range log.Strings {
@@ -29,21 +73,290 @@ func FormatLogEntry(log eventlog.EventLogData, index int) string {
 	return sb.String()
 }
 
+// FormatCase renders the case lines of a report header; empty without a case
+func FormatCase(c *eventlog.Case) string {
+	if c == nil {
+		return ""
+	}
+	header := fmt.Sprintf("Case: %s\n", c)
+	if c.Notes != "" {
+		header += fmt.Sprintf("Case notes: %s\n", c.Notes)
+	}
+	return header
+}
+
+// FormatTags renders tags as a sorted, comma-separated key=value list
+func FormatTags(tags map[string]string) string {
+	return config.Tags(tags).String()
+}
+
 // FormatLogChannel formats all logs from a particular channel
 func FormatLogChannel(channel string, logs []eventlog.EventLogData) string {
 	var sb strings.Builder
+	WriteLogChannel(&sb, channel, logs)
+	return sb.String()
+}
 
-	sb.WriteString(fmt.Sprintf("Found %d logs in %s channel\n", len(logs), channel))
+// WriteLogChannel writes the logs from a particular channel one entry at a time,
+// so the report of a large channel is never held in memory as a whole
+func WriteLogChannel(w io.StringWriter, channel string, logs []eventlog.EventLogData) error {
+	if _, err := w.WriteString(fmt.Sprintf("Found %d logs in %s channel\n", len(logs), channel)); err != nil {
+		return err
+	}
 
 	if len(logs) == 0 {
-		sb.WriteString("No matching events found with the specified Event IDs in this channel.\n")
+		if _, err := w.WriteString("No matching events found with the specified Event IDs in this channel.\n"); err != nil {
+			return err
+		}
 	} else {
 		for i, log := range logs {
-			sb.WriteString(FormatLogEntry(log, i))
+			if _, err := w.WriteString(FormatLogEntry(log, i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := w.WriteString(strings.Repeat("-", 50) + "\n")
+	return err
+}
+
+// FormatDomainTable renders the unique queried domains with first/last seen and
+// entropy, highest entropy first; limit bounds the number of rows (0 = all)
+func FormatDomainTable(list []domains.Domain, limit int) string {
+	var sb strings.Builder
+
+	suspicious := 0
+	for _, d := range list {
+		if d.Suspicious {
+			suspicious++
+		}
+	}
+	sb.WriteString(fmt.Sprintf("\nQueried Domains (%d unique, %d DGA-like)\n", len(list), suspicious))
+	sb.WriteString(strings.Repeat("-", 50) + "\n")
+
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	for _, d := range list {
+		marker := " "
+		if d.Suspicious {
+			marker = "!"
+		}
+		sb.WriteString(fmt.Sprintf("%s %-50s %5d  entropy %.2f  first %s  last %s\n", marker, d.Name, d.Count, d.Entropy,
+			d.FirstSeen.Format("2006-01-02 15:04:05"), d.LastSeen.Format("2006-01-02 15:04:05")))
+	}
+
+	return sb.String()
+}
+
+// FormatBlockedConnections renders the WFP drops grouped by the firewall rule or
+// filter that blocked them
+func FormatBlockedConnections(blocks []wfp.Block) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("\nBlocked Connections (%d filters)\n", len(blocks)))
+	sb.WriteString(strings.Repeat("-", 50) + "\n")
+	for _, block := range blocks {
+		name := block.Name
+		if name == "" {
+			name = fmt.Sprintf("filter %d (unresolved)", block.FilterID)
+		}
+		sb.WriteString(fmt.Sprintf("%-50s %6d\n", name, block.Count))
+		if len(block.Applications) > 0 {
+			sb.WriteString(fmt.Sprintf("    Applications: %s\n", strings.Join(wfp.Top(block.Applications, 3), ", ")))
+		}
+		if len(block.Destinations) > 0 {
+			sb.WriteString(fmt.Sprintf("    Destinations: %s\n", strings.Join(wfp.Top(block.Destinations, 3), ", ")))
+		}
+	}
+
+	return sb.String()
+}
+
+// FormatCrashes renders the crash dumps and WER reports, newest first, with the
+// record of the crash event each report was linked to
+func FormatCrashes(entries []crashes.Entry) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("\nCrash Dumps and Error Reports (%d)\n", len(entries)))
+	sb.WriteString(strings.Repeat("-", 50) + "\n")
+	for _, entry := range entries {
+		what := entry.Kind
+		switch {
+		case entry.Application != "" && entry.FaultModule != "":
+			what = fmt.Sprintf("%s %s in %s", entry.EventType, entry.Application, entry.FaultModule)
+		case entry.Application != "":
+			what = fmt.Sprintf("%s %s", entry.EventType, entry.Application)
+		case entry.EventType != "":
+			what = entry.EventType
+		}
+		sb.WriteString(fmt.Sprintf("%s  %-12s %s  %s\n", entry.Time.Format("2006-01-02 15:04:05"), entry.Host, what, entry.ExceptionCode))
+		sb.WriteString(fmt.Sprintf("    %s\n", entry.Path))
+		if entry.Record != 0 {
+			sb.WriteString(fmt.Sprintf("    Application Error event record %d\n", entry.Record))
+		}
+	}
+
+	return sb.String()
+}
+
+// FormatBootTimeline renders the startups and shutdowns in time order after a
+// line per computer, marking the shutdowns that weren't clean
+func FormatBootTimeline(entries []boot.Entry, stats []boot.HostStats) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("\nStartups and Shutdowns (%d)\n", len(entries)))
+	sb.WriteString(strings.Repeat("-", 50) + "\n")
+	for _, s := range stats {
+		sb.WriteString(fmt.Sprintf("%s: %d startups, %d unexpected shutdowns", s.Host, s.Startups, s.Unexpected))
+		if s.Boots > 0 {
+			sb.WriteString(fmt.Sprintf(", boot %s on average (longest %s", s.AverageBoot.Round(100*time.Millisecond), s.LongestBoot.Round(100*time.Millisecond)))
+			if s.DegradedBoots > 0 {
+				sb.WriteString(fmt.Sprintf(", %d degraded", s.DegradedBoots))
+			}
+			sb.WriteString(")")
 		}
+		if s.AverageShutdown > 0 {
+			sb.WriteString(fmt.Sprintf(", shutdown %s on average", s.AverageShutdown.Round(100*time.Millisecond)))
+		}
+		sb.WriteString("\n")
 	}
+	sb.WriteString("\n")
+	for _, e := range entries {
+		what := e.Kind
+		switch e.Kind {
+		case boot.KindUnexpected:
+			what = "UNEXPECTED SHUTDOWN"
+		case boot.KindBootTime:
+			what = "boot took " + e.Duration.Round(100*time.Millisecond).String()
+		case boot.KindShutdownTime:
+			what = "shutdown took " + e.Duration.Round(100*time.Millisecond).String()
+		case boot.KindDegradation:
+			what = "slowed by " + e.Duration.Round(100*time.Millisecond).String()
+		}
+		if e.Degraded {
+			what += " (degraded)"
+		}
+		sb.WriteString(fmt.Sprintf("%s  %-12s %s", e.Time.Local().Format("2006-01-02 15:04:05"), e.Host, what))
+		if e.Detail != "" {
+			sb.WriteString("  " + e.Detail)
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
 
+// FormatGroupChanges renders the membership changes of watched privileged groups
+func FormatGroupChanges(changes []groups.Change) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("\nPrivileged Group Changes (%d)\n", len(changes)))
 	sb.WriteString(strings.Repeat("-", 50) + "\n")
+	for _, c := range changes {
+		preposition := "to"
+		if c.Action == "removed" {
+			preposition = "from"
+		}
+		sb.WriteString(fmt.Sprintf("%s  %-7s %s %s %s by %s on %s\n", c.Time.Local().Format("2006-01-02 15:04:05"),
+			c.Action, c.Member, preposition, c.Group, c.By, c.Host))
+	}
+
+	return sb.String()
+}
+
+// FormatPrivilegedAccounts renders the special privilege logons, explicit credential
+// use and SID history changes of each account
+func FormatPrivilegedAccounts(accounts []privileges.Account) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("\nPrivileged Accounts (%d)\n", len(accounts)))
+	sb.WriteString(strings.Repeat("-", 50) + "\n")
+	for _, a := range accounts {
+		sb.WriteString(fmt.Sprintf("%s  %d special logon(s), %d explicit credential use(s) on %s, %s to %s\n", a.Account,
+			a.SpecialLogons, a.ExplicitCredentials, strings.Join(a.Hosts, ", "),
+			a.First.Local().Format("2006-01-02 15:04:05"), a.Last.Local().Format("2006-01-02 15:04:05")))
+		if len(a.SIDHistory) > 0 || a.SIDHistoryFailures > 0 {
+			sb.WriteString(fmt.Sprintf("    SID history added: %s (%d failed attempt(s))\n", strings.Join(a.SIDHistory, ", "), a.SIDHistoryFailures))
+		}
+		if len(a.Privileges) > 0 {
+			sb.WriteString("    Privileges: " + strings.Join(a.Privileges, ", ") + "\n")
+		}
+		if len(a.AlternateAccounts) > 0 {
+			sb.WriteString("    Credentials of: " + strings.Join(a.AlternateAccounts, ", ") + "\n")
+		}
+		if len(a.Targets) > 0 {
+			sb.WriteString("    Against: " + strings.Join(a.Targets, ", ") + "\n")
+		}
+		if len(a.Processes) > 0 {
+			sb.WriteString("    Via: " + strings.Join(a.Processes, ", ") + "\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// FormatFirstSeen renders the executables first run after the allowlist baseline
+func FormatFirstSeen(sightings []allowlist.Sighting) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("\nFirst-Seen Executables (%d)\n", len(sightings)))
+	sb.WriteString(strings.Repeat("-", 50) + "\n")
+	for _, s := range sightings {
+		sb.WriteString(fmt.Sprintf("%s  %-8s %s on %s", s.Time.Local().Format("2006-01-02 15:04:05"), s.Reason, s.Path, s.Host))
+		if s.User != "" {
+			sb.WriteString(" by " + s.User)
+		}
+		sb.WriteString("\n")
+		if s.Parent != "" {
+			sb.WriteString("    Parent: " + s.Parent + "\n")
+		}
+		if s.Hash != "" {
+			sb.WriteString("    SHA256: " + s.Hash + "\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// FormatFindings renders the findings, most severe first, so configuration changes
+// that weaken security stand out at the top of the summary
+func FormatFindings(list []findings.Finding) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("\nFindings (%d)\n", len(list)))
+	sb.WriteString(strings.Repeat("=", 50) + "\n")
+	for _, f := range list {
+		sb.WriteString(fmt.Sprintf("[%s] %s  %s on %s", strings.ToUpper(f.Severity), f.Time.Local().Format("2006-01-02 15:04:05"), f.Title, f.Host))
+		if f.By != "" {
+			sb.WriteString(" by " + f.By)
+		}
+		sb.WriteString("\n")
+		if f.Detail != "" {
+			sb.WriteString("    " + f.Detail + "\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// FormatTimings renders the per-channel stage timings with a total row, showing
+// where a slow collection spends its time
+func FormatTimings(list []eventlog.StageTimings) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("\nStage Timings (%d channels)\n", len(list)))
+	sb.WriteString(strings.Repeat("-", 50) + "\n")
+	var total eventlog.StageTimings
+	for _, t := range list {
+		sb.WriteString(fmt.Sprintf("%s: %s\n", t.Channel, t))
+		total.Open += t.Open
+		total.Read += t.Read
+		total.Parse += t.Parse
+		total.Format += t.Format
+		total.Write += t.Write
+	}
+	sb.WriteString(fmt.Sprintf("All channels: %s\n", total))
 
 	return sb.String()
 }
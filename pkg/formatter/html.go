@@ -0,0 +1,251 @@
+package formatter
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// HTMLFormat is the standalone HTML report format, see HTMLWriter
+const HTMLFormat = "html"
+
+// htmlColumns are the column headings of a channel's table, in the order of the
+// cells written by FormatHTML
+var htmlColumns = []string{"Time", "Record", "Event ID", "Type", "Source", "Computer", "Description", "Detections"}
+
+// htmlTypeClass returns the CSS class coloring the rows of an event type
+func htmlTypeClass(eventType uint16) string {
+	switch eventType {
+	case eventlog.EVENTLOG_ERROR_TYPE:
+		return "error"
+	case eventlog.EVENTLOG_WARNING_TYPE:
+		return "warning"
+	case eventlog.EVENTLOG_AUDIT_SUCCESS:
+		return "audit-success"
+	case eventlog.EVENTLOG_AUDIT_FAILURE:
+		return "audit-failure"
+	}
+	return "information"
+}
+
+// FormatHTML renders an event as one row of a channel's table: the generation
+// time in the report's time zone and the description parts selected by
+// SetMessageDetail. Cells carry a data-sort value so numeric and time columns
+// sort by value rather than by text.
+func FormatHTML(log eventlog.EventLogData) string {
+	log = withMessageDetail(log)
+	var description strings.Builder
+	if log.Message != "" {
+		description.WriteString(`<div class="message">` + html.EscapeString(log.Message) + `</div>`)
+	}
+	if len(log.Strings) > 0 {
+		description.WriteString(`<div class="strings">` + html.EscapeString(strings.Join(log.Strings, csvStringSeparator)) + `</div>`)
+	}
+
+	at := eventTime(log.TimeGenerated)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<tr class="%s">`, htmlTypeClass(log.EventType))
+	fmt.Fprintf(&sb, `<td data-sort="%d">%s</td>`, at.Unix(), at.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&sb, `<td data-sort="%d">%d</td>`, log.RecordNumber, log.RecordNumber)
+	fmt.Fprintf(&sb, `<td data-sort="%d">%d</td>`, log.EventID, log.EventID)
+	fmt.Fprintf(&sb, `<td>%s</td>`, html.EscapeString(eventlog.GetEventTypeName(log.EventType)))
+	fmt.Fprintf(&sb, `<td>%s</td>`, html.EscapeString(log.SourceName))
+	fmt.Fprintf(&sb, `<td>%s</td>`, html.EscapeString(log.ComputerName))
+	fmt.Fprintf(&sb, `<td>%s</td>`, description.String())
+	fmt.Fprintf(&sb, `<td>%s</td>`, html.EscapeString(strings.Join(log.Detections, ", ")))
+	sb.WriteString("</tr>\n")
+	return sb.String()
+}
+
+// htmlChannel is the dashboard entry of a channel
+type htmlChannel struct {
+	name       string
+	anchor     string
+	types      map[uint16]int
+	total      int
+	detections int // Events with at least one detection
+}
+
+// HTMLWriter writes a standalone HTML report, with no external scripts or styles:
+// one section per channel with a table sortable by clicking its headings, rows
+// colored by event type, and a summary dashboard of the events per channel and
+// type. Sections are streamed as events arrive; the dashboard, which needs the
+// totals, is written by Close and shown above the sections.
+type HTMLWriter struct {
+	title    string
+	started  bool
+	current  *htmlChannel // Channel of the open section; nil when none is open
+	channels []*htmlChannel
+}
+
+// NewHTMLWriter returns a writer for a report with the given title
+func NewHTMLWriter(title string) *HTMLWriter {
+	return &HTMLWriter{title: title}
+}
+
+// WriteChannel writes events of a channel. Consecutive calls for the same channel,
+// as for the batches of a spilled read, add to the same section.
+func (h *HTMLWriter) WriteChannel(w io.StringWriter, channel string, logs []eventlog.EventLogData) error {
+	var sb strings.Builder
+	h.start(&sb)
+	if h.current == nil || h.current.name != channel {
+		h.closeSection(&sb)
+		h.current = &htmlChannel{name: channel, anchor: fmt.Sprintf("channel-%d", len(h.channels)+1), types: map[uint16]int{}}
+		h.channels = append(h.channels, h.current)
+		fmt.Fprintf(&sb, "<section id=\"%s\">\n<h2>%s</h2>\n<table class=\"events\">\n<thead><tr>", h.current.anchor, html.EscapeString(channel))
+		for _, column := range htmlColumns {
+			sb.WriteString("<th>" + column + "</th>")
+		}
+		sb.WriteString("</tr></thead>\n<tbody>\n")
+	}
+	for _, log := range logs {
+		if log.Channel == "" {
+			log.Channel = channel
+		}
+		h.current.types[log.EventType]++
+		h.current.total++
+		if len(log.Detections) > 0 {
+			h.current.detections++
+		}
+		sb.WriteString(FormatHTML(log))
+	}
+	_, err := w.WriteString(sb.String())
+	return err
+}
+
+// Close ends the open section and writes the dashboard, the sorting script and
+// the end of the document
+func (h *HTMLWriter) Close(w io.StringWriter) error {
+	var sb strings.Builder
+	h.start(&sb)
+	h.closeSection(&sb)
+	sb.WriteString(h.dashboard())
+	sb.WriteString("<script>\n" + htmlScript + "</script>\n</body>\n</html>\n")
+	_, err := w.WriteString(sb.String())
+	return err
+}
+
+// start writes the head of the document before the first section
+func (h *HTMLWriter) start(sb *strings.Builder) {
+	if h.started {
+		return
+	}
+	h.started = true
+	title := html.EscapeString(h.title)
+	fmt.Fprintf(sb, "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s</style>\n</head>\n<body>\n<h1>%s</h1>\n", title, htmlStyle, title)
+}
+
+// closeSection ends the table of the open section
+func (h *HTMLWriter) closeSection(sb *strings.Builder) {
+	if h.current == nil {
+		return
+	}
+	sb.WriteString("</tbody>\n</table>\n</section>\n")
+	h.current = nil
+}
+
+// dashboard renders the events per channel and type, linking to the sections
+func (h *HTMLWriter) dashboard() string {
+	var sb strings.Builder
+	total, detections := 0, 0
+	types := map[uint16]int{}
+	for _, channel := range h.channels {
+		total += channel.total
+		detections += channel.detections
+		for eventType, n := range channel.types {
+			types[eventType] += n
+		}
+	}
+	order := make([]uint16, 0, len(types))
+	for eventType := range types {
+		order = append(order, eventType)
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i] < order[j] })
+
+	sb.WriteString("<div id=\"dashboard\">\n<div class=\"cards\">\n")
+	fmt.Fprintf(&sb, "<div class=\"card\"><b>%d</b>events</div>\n", total)
+	fmt.Fprintf(&sb, "<div class=\"card\"><b>%d</b>channels</div>\n", len(h.channels))
+	fmt.Fprintf(&sb, "<div class=\"card detections\"><b>%d</b>with detections</div>\n", detections)
+	for _, eventType := range order {
+		fmt.Fprintf(&sb, "<div class=\"card %s\"><b>%d</b>%s</div>\n", htmlTypeClass(eventType), types[eventType], html.EscapeString(eventlog.GetEventTypeName(eventType)))
+	}
+	sb.WriteString("</div>\n<table class=\"summary\">\n<thead><tr><th>Channel</th><th>Events</th>")
+	for _, eventType := range order {
+		sb.WriteString("<th>" + html.EscapeString(eventlog.GetEventTypeName(eventType)) + "</th>")
+	}
+	sb.WriteString("<th>Detections</th></tr></thead>\n<tbody>\n")
+	for _, channel := range h.channels {
+		fmt.Fprintf(&sb, "<tr><td><a href=\"#%s\">%s</a></td><td data-sort=\"%d\">%d</td>", channel.anchor, html.EscapeString(channel.name), channel.total, channel.total)
+		for _, eventType := range order {
+			n := channel.types[eventType]
+			fmt.Fprintf(&sb, "<td data-sort=\"%d\">%s</td>", n, htmlCount(n))
+		}
+		fmt.Fprintf(&sb, "<td data-sort=\"%d\">%s</td></tr>\n", channel.detections, htmlCount(channel.detections))
+	}
+	fmt.Fprintf(&sb, "</tbody>\n</table>\n<p class=\"generated\">Generated %s</p>\n</div>\n", time.Now().In(timeZone).Format("2006-01-02 15:04:05 MST"))
+	return sb.String()
+}
+
+// htmlCount renders a dashboard count, leaving zero cells empty so the counts
+// that matter stand out
+func htmlCount(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// htmlStyle colors rows by event type and shows the dashboard, written last, above
+// the channel sections
+const htmlStyle = `body { display: flex; flex-direction: column; font: 13px/1.4 "Segoe UI", Arial, sans-serif; margin: 1em 2em; color: #222; }
+h1 { order: -2; }
+#dashboard { order: -1; margin-bottom: 2em; }
+.cards { display: flex; flex-wrap: wrap; gap: .75em; margin-bottom: 1em; }
+.card { border: 1px solid #ccc; border-radius: 4px; padding: .5em 1em; min-width: 7em; background: #fafafa; }
+.card b { display: block; font-size: 20px; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 1.5em; }
+table.summary { width: auto; }
+th, td { border: 1px solid #ddd; padding: 3px 6px; text-align: left; vertical-align: top; }
+th { background: #eee; cursor: pointer; user-select: none; white-space: nowrap; }
+th.asc::after { content: " \25B2"; }
+th.desc::after { content: " \25BC"; }
+td .strings { color: #666; font-family: Consolas, monospace; white-space: pre-wrap; word-break: break-all; }
+td .message { white-space: pre-wrap; }
+tr.error, .card.error { background: #fde2e2; }
+tr.warning, .card.warning { background: #fff4d6; }
+tr.audit-failure, .card.audit-failure { background: #fbe3f1; }
+tr.audit-success, .card.audit-success { background: #e4f6e4; }
+.card.detections { background: #e3ecfb; }
+.generated { color: #888; }
+`
+
+// htmlScript sorts a table by the clicked heading, by data-sort values when the
+// cells have them and by text otherwise
+const htmlScript = `document.querySelectorAll("table").forEach(function (table) {
+  table.querySelectorAll("th").forEach(function (th, column) {
+    th.addEventListener("click", function () {
+      var asc = !th.classList.contains("asc");
+      table.querySelectorAll("th").forEach(function (other) { other.classList.remove("asc", "desc"); });
+      th.classList.add(asc ? "asc" : "desc");
+      var body = table.tBodies[0];
+      var rows = Array.prototype.slice.call(body.rows);
+      var key = function (row) {
+        var cell = row.cells[column];
+        var value = cell.getAttribute("data-sort");
+        return value === null ? cell.textContent.toLowerCase() : Number(value);
+      };
+      rows.sort(function (a, b) {
+        var x = key(a), y = key(b);
+        return (x < y ? -1 : x > y ? 1 : 0) * (asc ? 1 : -1);
+      });
+      rows.forEach(function (row) { body.appendChild(row); });
+    });
+  });
+});
+`
@@ -0,0 +1,85 @@
+package formatter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Report formats of the collected events
+const (
+	TextFormat = "text" // Human-readable report, see FormatLogEntry
+	JSONFormat = "json" // Newline-delimited JSON, one event per line, see FormatJSON
+)
+
+// ValidFormat reports whether format is a supported report format
+func ValidFormat(format string) bool {
+	return format == TextFormat || format == JSONFormat || format == CSVFormat || format == HTMLFormat
+}
+
+// jsonEvent is an event as written by FormatJSON: the EventLogData fields with the
+// timestamps as RFC3339, the event type by name and, with SetTypedFields, the
+// named fields converted to their catalogued types
+type jsonEvent struct {
+	eventlog.EventLogData
+	TimeGenerated string `json:"time_generated"`
+	TimeWritten   string `json:"time_written"`
+	TypeName      string `json:"type_name"`
+	Fields        any    `json:"fields,omitempty"` // map[string]string, or map[string]any with SetTypedFields
+}
+
+// typedFields is whether FormatJSON writes the named fields with their types
+var typedFields bool
+
+// SetTypedFields sets whether FormatJSON writes the named fields of the event
+// catalog as numbers, booleans, RFC3339 times and canonical addresses, see
+// eventlog.TypedFields, rather than as the strings the event logged
+func SetTypedFields(typed bool) {
+	typedFields = typed
+}
+
+// FormatJSON serializes an event as one line of JSON, newline included, with the
+// description parts selected by SetMessageDetail
+func FormatJSON(log eventlog.EventLogData) (string, error) {
+	log = withMessageDetail(log)
+	event := jsonEvent{
+		EventLogData:  log,
+		TimeGenerated: eventTime(log.TimeGenerated).Format(time.RFC3339),
+		TimeWritten:   eventTime(log.TimeWritten).Format(time.RFC3339),
+		TypeName:      eventlog.GetEventTypeName(log.EventType),
+	}
+	switch {
+	case log.Fields == nil:
+	case typedFields:
+		event.Fields = eventlog.TypedFields(log)
+	default:
+		event.Fields = log.Fields
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode event %d: %v", log.RecordNumber, err)
+	}
+	return string(data) + "\n", nil
+}
+
+// WriteJSONChannel writes the logs from a particular channel as newline-delimited
+// JSON. Unlike WriteLogChannel there is no header, so the output can be piped
+// straight into jq or a log shipper.
+func WriteJSONChannel(w io.StringWriter, channel string, logs []eventlog.EventLogData) error {
+	for _, log := range logs {
+		if log.Channel == "" {
+			log.Channel = channel
+		}
+		line, err := FormatJSON(log)
+		if err != nil {
+			return err
+		}
+		if _, err := w.WriteString(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
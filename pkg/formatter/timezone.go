@@ -0,0 +1,54 @@
+package formatter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // Windows has no IANA time zone database for time.LoadLocation
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Time zones accepted by ParseTimeZone besides IANA names and offsets
+const (
+	UTCTimeZone   = "utc"
+	LocalTimeZone = "local"
+)
+
+// timeZone is the zone event times are written in; UTC unless SetTimeZone is called
+var timeZone = time.UTC
+
+// SetTimeZone sets the zone event times are written in by the report formats
+func SetTimeZone(zone *time.Location) {
+	timeZone = zone
+}
+
+// ParseTimeZone parses a time zone: utc, local (the zone of this computer), an
+// offset such as +07:00, or an IANA name such as Asia/Ho_Chi_Minh from the
+// embedded time zone database
+func ParseTimeZone(name string) (*time.Location, error) {
+	switch strings.ToLower(name) {
+	case UTCTimeZone, "":
+		return time.UTC, nil
+	case LocalTimeZone:
+		return time.Local, nil
+	}
+	if name[0] == '+' || name[0] == '-' {
+		offset, err := time.Parse("-07:00", name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset %q (expected +HH:MM or -HH:MM)", name)
+		}
+		_, seconds := offset.Zone()
+		return time.FixedZone("UTC"+name, seconds), nil
+	}
+	zone, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q: %v", name, err)
+	}
+	return zone, nil
+}
+
+// eventTime returns the TimeGenerated or TimeWritten of an event in the report's zone
+func eventTime(windowsTime uint32) time.Time {
+	return eventlog.EventTime(windowsTime).In(timeZone)
+}
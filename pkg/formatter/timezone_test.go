@@ -0,0 +1,38 @@
+package formatter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeZone(t *testing.T) {
+	// 2024-06-01 00:00:00 UTC
+	at := time.Unix(1717200000, 0)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"utc", "2024-06-01 00:00"},
+		{"+07:00", "2024-06-01 07:00"},
+		{"-05:30", "2024-05-31 18:30"},
+		// IANA names resolve from the embedded database, as Windows has none
+		{"Asia/Ho_Chi_Minh", "2024-06-01 07:00"},
+		{"America/New_York", "2024-05-31 20:00"},
+	}
+	for _, tt := range tests {
+		zone, err := ParseTimeZone(tt.name)
+		if err != nil {
+			t.Errorf("ParseTimeZone(%q): %v", tt.name, err)
+			continue
+		}
+		if got := at.In(zone).Format("2006-01-02 15:04"); got != tt.want {
+			t.Errorf("ParseTimeZone(%q): got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	for _, name := range []string{"+7", "Mars/Olympus_Mons"} {
+		if _, err := ParseTimeZone(name); err == nil {
+			t.Errorf("ParseTimeZone(%q) succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package formatter
+
+import (
+	"bufio"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultFlushInterval is how often buffered report output is flushed to disk
+const DefaultFlushInterval = 5 * time.Second
+
+// StreamWriter buffers report output and flushes it, syncing files to disk, at
+// least every flush interval, so a crash loses at most the last interval of the
+// report while large channels are written without building them in memory
+type StreamWriter struct {
+	mu       sync.Mutex
+	file     *os.File
+	buf      *bufio.Writer
+	sync     bool // Sync after flushing; false for the console and pipes
+	interval time.Duration
+	encoder  encoder
+	last     time.Time
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+}
+
+// NewStreamWriter wraps file in a buffered writer flushed every interval (0 = on
+// every write). Console and pipe output is flushed on every write so it stays live.
+func NewStreamWriter(file *os.File, interval time.Duration) *StreamWriter {
+	w := &StreamWriter{
+		file: file,
+		buf:  bufio.NewWriterSize(file, 64*1024),
+		last: time.Now(),
+		stop: make(chan struct{}),
+	}
+	if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+		w.sync = true
+		w.interval = interval
+	}
+
+	// Flush output that sits in the buffer while collection is idle, as between
+	// follow mode passes
+	if w.interval > 0 {
+		w.stopped.Add(1)
+		go func() {
+			defer w.stopped.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					w.mu.Lock()
+					if time.Since(w.last) >= interval {
+						w.flush()
+					}
+					w.mu.Unlock()
+				case <-w.stop:
+					return
+				}
+			}
+		}()
+	}
+	return w
+}
+
+// SetEncoding sets the encoding of a report file, before anything is written to
+// it. The byte order mark of the encoding is only written at the start of a file,
+// not when appending. The console is left alone, since Windows converts console
+// output itself.
+func (w *StreamWriter) SetEncoding(encoding string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	info, err := w.file.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice != 0 {
+		return err
+	}
+	var bom []byte
+	switch encoding {
+	case UTF8BOMEncoding:
+		bom = utf8BOM
+	case UTF16LEEncoding:
+		bom = utf16LEBOM
+		w.encoder.utf16 = true
+	}
+	if bom == nil || info.Size() > 0 {
+		return nil
+	}
+	_, err = w.buf.Write(bom)
+	return err
+}
+
+// Write buffers p, flushing when the flush interval has passed
+func (w *StreamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.buf.Write(w.encoder.encode(p)); err != nil {
+		return 0, err
+	}
+	n := len(p)
+	if time.Since(w.last) >= w.interval {
+		return n, w.flush()
+	}
+	return n, nil
+}
+
+// WriteString buffers s, flushing when the flush interval has passed
+func (w *StreamWriter) WriteString(s string) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := len(s)
+	if w.encoder.utf16 {
+		if _, err := w.buf.Write(w.encoder.encode([]byte(s))); err != nil {
+			return 0, err
+		}
+	} else if _, err := w.buf.WriteString(s); err != nil {
+		return 0, err
+	}
+	if time.Since(w.last) >= w.interval {
+		return n, w.flush()
+	}
+	return n, nil
+}
+
+// Flush writes the buffered output and syncs it to disk
+func (w *StreamWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flush()
+}
+
+// flush is Flush with the lock held
+func (w *StreamWriter) flush() error {
+	w.last = time.Now()
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if w.sync {
+		return w.file.Sync()
+	}
+	return nil
+}
+
+// Close stops the periodic flush and flushes the remaining output. The file is
+// left open.
+func (w *StreamWriter) Close() error {
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+	w.stopped.Wait()
+	return w.Flush()
+}
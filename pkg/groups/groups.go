@@ -0,0 +1,188 @@
+package groups
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// DetectionName marks membership changes of watched groups in the events' Detections
+const DetectionName = "privileged-group-change"
+
+// Membership change events of security-enabled groups
+var changeEvents = map[uint32]string{
+	4728: "added",   // Member added to a global group
+	4729: "removed", // Member removed from a global group
+	4732: "added",   // Member added to a local group
+	4733: "removed", // Member removed from a local group
+	4756: "added",   // Member added to a universal group
+	4757: "removed", // Member removed from a universal group
+}
+
+// defaultGroups are the sensitive built-in groups, by name and SID; domain groups
+// are matched by the relative ID that ends their SID
+var (
+	defaultGroups = []string{
+		"Administrators", "Domain Admins", "Enterprise Admins", "Schema Admins",
+		"Account Operators", "Backup Operators", "Server Operators", "Print Operators",
+		"Group Policy Creator Owners", "DnsAdmins", "Remote Desktop Users",
+	}
+	defaultSIDs = []string{
+		"S-1-5-32-544", // Administrators
+		"S-1-5-32-548", // Account Operators
+		"S-1-5-32-549", // Server Operators
+		"S-1-5-32-550", // Print Operators
+		"S-1-5-32-551", // Backup Operators
+		"S-1-5-32-555", // Remote Desktop Users
+	}
+	defaultRIDs = []string{
+		"-512", // Domain Admins
+		"-518", // Schema Admins
+		"-519", // Enterprise Admins
+		"-520", // Group Policy Creator Owners
+	}
+)
+
+// Watchlist is the set of groups whose membership changes are flagged
+type Watchlist struct {
+	names map[string]bool
+	sids  map[string]bool
+	rids  []string
+}
+
+// DefaultWatchlist returns the built-in sensitive groups
+func DefaultWatchlist() *Watchlist {
+	w := &Watchlist{names: map[string]bool{}, sids: map[string]bool{}, rids: defaultRIDs}
+	for _, name := range defaultGroups {
+		w.names[strings.ToLower(name)] = true
+	}
+	for _, sid := range defaultSIDs {
+		w.sids[sid] = true
+	}
+	return w
+}
+
+// LoadWatchlist adds the groups of a file, one name or SID per line, to the
+// watchlist. Blank lines and lines starting with # are ignored.
+func (w *Watchlist) LoadWatchlist(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open group watchlist %s: %v", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(strings.ToUpper(line), "S-1-") {
+			w.sids[strings.ToUpper(line)] = true
+		} else {
+			w.names[strings.ToLower(line)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read group watchlist %s: %v", path, err)
+	}
+	return nil
+}
+
+// Watched reports whether a group, by name or SID, is on the watchlist
+func (w *Watchlist) Watched(name, sid string) bool {
+	sid = strings.ToUpper(sid)
+	if w.names[strings.ToLower(name)] || w.sids[sid] {
+		return true
+	}
+	if strings.HasPrefix(sid, "S-1-5-21-") {
+		for _, rid := range w.rids {
+			if strings.HasSuffix(sid, rid) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Change is a membership change of a watched group
+type Change struct {
+	Time      time.Time `json:"time"`
+	Host      string    `json:"host"`
+	EventID   uint32    `json:"event_id"`
+	Action    string    `json:"action"` // added or removed
+	Group     string    `json:"group"`
+	GroupSid  string    `json:"group_sid"`
+	Member    string    `json:"member"` // Distinguished name, or SID when the name isn't logged
+	MemberSid string    `json:"member_sid"`
+	By        string    `json:"by"` // DOMAIN\user that made the change
+}
+
+// Tracker flags membership changes of watched groups and keeps them for the report
+type Tracker struct {
+	watchlist *Watchlist
+	changes   []Change
+}
+
+// NewTracker returns a tracker for the groups of watchlist
+func NewTracker(watchlist *Watchlist) *Tracker {
+	return &Tracker{watchlist: watchlist}
+}
+
+// Add records the watched membership changes among events and marks them with
+// DetectionName
+func (t *Tracker) Add(events []eventlog.EventLogData) {
+	if t == nil {
+		return
+	}
+	for i := range events {
+		event := &events[i]
+		action, ok := changeEvents[event.EventID]
+		if !ok || !strings.EqualFold(event.Channel, "Security") {
+			continue
+		}
+		data := eventlog.NamedData(event.Channel, *event)
+		if !t.watchlist.Watched(data["TargetUserName"], data["TargetSid"]) {
+			continue
+		}
+
+		member := data["MemberName"]
+		if member == "" || member == "-" {
+			member = data["MemberSid"]
+		}
+		t.changes = append(t.changes, Change{
+			Time:      eventlog.EventTime(event.TimeGenerated),
+			Host:      event.ComputerName,
+			EventID:   event.EventID,
+			Action:    action,
+			Group:     data["TargetDomainName"] + `\` + data["TargetUserName"],
+			GroupSid:  data["TargetSid"],
+			Member:    member,
+			MemberSid: data["MemberSid"],
+			By:        data["SubjectDomainName"] + `\` + data["SubjectUserName"],
+		})
+		event.Detections = append(event.Detections, DetectionName)
+	}
+}
+
+// Len returns the number of recorded changes
+func (t *Tracker) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.changes)
+}
+
+// Changes returns the recorded changes in time order
+func (t *Tracker) Changes() []Change {
+	list := append([]Change(nil), t.changes...)
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Time.Before(list[j].Time)
+	})
+	return list
+}
@@ -0,0 +1,272 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"lemita/datn/pkg/sink"
+)
+
+// maxRecentErrors is the number of recent errors kept in the status
+const maxRecentErrors = 20
+
+// ChannelStatus describes the collection state of one channel
+type ChannelStatus struct {
+	Name            string    `json:"name"`
+	Subscribed      bool      `json:"subscribed"`
+	LastSuccess     time.Time `json:"last_success,omitempty"`
+	LastError       string    `json:"last_error,omitempty"`
+	LastErrorTime   time.Time `json:"last_error_time,omitempty"`
+	EventsCollected int64     `json:"events_collected"`
+	EventsSampled   int64     `json:"events_sampled_out,omitempty"` // Dropped by sampling or rate caps
+}
+
+// ErrorEntry is a timestamped error reported by the collector
+type ErrorEntry struct {
+	Time    time.Time `json:"time"`
+	Channel string    `json:"channel,omitempty"`
+	Message string    `json:"message"`
+}
+
+// Status is a point-in-time snapshot of the collector's health
+type Status struct {
+	PID               int                       `json:"pid"`
+	StartedAt         time.Time                 `json:"started_at"`
+	UpdatedAt         time.Time                 `json:"updated_at"` // End of the last collection pass, see RecordPass
+	Interval          time.Duration             `json:"interval"`
+	Channels          map[string]*ChannelStatus `json:"channels"`
+	Sink              *sink.Stats               `json:"sink,omitempty"`
+	CheckpointUpdated time.Time                 `json:"checkpoint_updated,omitempty"`
+	RecentErrors      []ErrorEntry              `json:"recent_errors,omitempty"`
+}
+
+// Monitor collects health information from a running collector
+type Monitor struct {
+	mu     sync.Mutex
+	path   string
+	status Status
+}
+
+// NewMonitor creates a monitor that persists its status to path (empty disables persistence)
+func NewMonitor(path string, interval time.Duration, channels []string) *Monitor {
+	m := &Monitor{
+		path: path,
+		status: Status{
+			PID:       os.Getpid(),
+			StartedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			Interval:  interval,
+			Channels:  map[string]*ChannelStatus{},
+		},
+	}
+	for _, name := range channels {
+		m.status.Channels[name] = &ChannelStatus{Name: name, Subscribed: true}
+	}
+	return m
+}
+
+// channel returns the status entry of a channel, creating it if needed. Must be called with m.mu held.
+func (m *Monitor) channel(name string) *ChannelStatus {
+	ch, ok := m.status.Channels[name]
+	if !ok {
+		ch = &ChannelStatus{Name: name}
+		m.status.Channels[name] = ch
+	}
+	return ch
+}
+
+// RecordSuccess marks a successful collection pass for a channel
+func (m *Monitor) RecordSuccess(channel string, events int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ch := m.channel(channel)
+	ch.LastSuccess = time.Now()
+	ch.EventsCollected += int64(events)
+}
+
+// RecordError records a collection error for a channel (empty channel for global errors)
+func (m *Monitor) RecordError(channel string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if channel != "" {
+		ch := m.channel(channel)
+		ch.LastError = err.Error()
+		ch.LastErrorTime = now
+	}
+
+	m.status.RecentErrors = append(m.status.RecentErrors, ErrorEntry{Time: now, Channel: channel, Message: err.Error()})
+	if len(m.status.RecentErrors) > maxRecentErrors {
+		m.status.RecentErrors = m.status.RecentErrors[len(m.status.RecentErrors)-maxRecentErrors:]
+	}
+}
+
+// RecordPass marks the end of a collection pass over every channel. A status
+// whose last pass is older than three intervals is reported as stale, so a hung
+// collector shows up even while its HTTP listener keeps answering.
+func (m *Monitor) RecordPass() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status.UpdatedAt = time.Now()
+}
+
+// Unsubscribe marks a channel as no longer being collected
+func (m *Monitor) Unsubscribe(channel string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.channel(channel).Subscribed = false
+}
+
+// SetSampled records the number of events dropped by sampling per channel
+func (m *Monitor) SetSampled(dropped map[string]int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for channel, n := range dropped {
+		m.channel(channel).EventsSampled = n
+	}
+}
+
+// SetSinkStats records the latest sink delivery counters
+func (m *Monitor) SetSinkStats(stats sink.Stats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status.Sink = &stats
+}
+
+// SetCheckpointUpdated records when checkpoints were last written
+func (m *Monitor) SetCheckpointUpdated(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status.CheckpointUpdated = t
+}
+
+// Snapshot returns a deep copy of the current status
+func (m *Monitor) Snapshot() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := m.status
+	snapshot.Channels = make(map[string]*ChannelStatus, len(m.status.Channels))
+	for name, ch := range m.status.Channels {
+		copied := *ch
+		snapshot.Channels[name] = &copied
+	}
+	snapshot.RecentErrors = append([]ErrorEntry(nil), m.status.RecentErrors...)
+	if m.status.Sink != nil {
+		stats := *m.status.Sink
+		snapshot.Sink = &stats
+	}
+	return snapshot
+}
+
+// Save writes the current status to the monitor's file
+func (m *Monitor) Save() error {
+	if m.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(m.Snapshot(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode health status: %v", err)
+	}
+
+	tmpPath := m.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write health status: %v", err)
+	}
+	if err := os.Rename(tmpPath, m.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to commit health status: %v", err)
+	}
+	return nil
+}
+
+// Handler serves the status as JSON; it responds 503 when problems are detected
+func (m *Monitor) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := m.Snapshot()
+		problems := status.Problems(time.Now())
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(problems) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(struct {
+			Healthy  bool     `json:"healthy"`
+			Problems []string `json:"problems,omitempty"`
+			Status
+		}{len(problems) == 0, problems, status})
+	})
+}
+
+// Load reads a status file written by a running collector
+func Load(path string) (*Status, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read health status %s: %v", path, err)
+	}
+
+	var status Status
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("failed to parse health status %s: %v", path, err)
+	}
+	return &status, nil
+}
+
+// Problems returns a description of every detected health problem. A collector is
+// considered broken when its status or a subscribed channel hasn't been updated for
+// three polling intervals, or when the sink is holding a spool backlog.
+func (s *Status) Problems(now time.Time) []string {
+	var problems []string
+
+	staleAfter := 3 * s.Interval
+	if staleAfter <= 0 {
+		staleAfter = 5 * time.Minute
+	}
+
+	if now.Sub(s.UpdatedAt) > staleAfter {
+		problems = append(problems, fmt.Sprintf("status not updated since %s", s.UpdatedAt.Format(time.RFC3339)))
+	}
+
+	names := make([]string, 0, len(s.Channels))
+	for name := range s.Channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		ch := s.Channels[name]
+		if !ch.Subscribed {
+			continue
+		}
+		if ch.LastSuccess.IsZero() {
+			if !ch.LastErrorTime.IsZero() {
+				problems = append(problems, fmt.Sprintf("%s: never collected successfully (last error: %s)", name, ch.LastError))
+			}
+			continue
+		}
+		if s.UpdatedAt.Sub(ch.LastSuccess) > staleAfter {
+			problems = append(problems, fmt.Sprintf("%s: last successful collection at %s", name, ch.LastSuccess.Format(time.RFC3339)))
+		}
+	}
+
+	if s.Sink != nil && s.Sink.Backlog > 0 {
+		problems = append(problems, fmt.Sprintf("sink backlog: %d spooled batches awaiting delivery", s.Sink.Backlog))
+	}
+	if s.Sink != nil && s.Sink.Quarantined > 0 {
+		problems = append(problems, fmt.Sprintf("sink quarantine: %d batches rejected or unreadable, kept as .bad spool files", s.Sink.Quarantined))
+	}
+
+	if !s.CheckpointUpdated.IsZero() && s.UpdatedAt.Sub(s.CheckpointUpdated) > staleAfter {
+		problems = append(problems, fmt.Sprintf("checkpoints not written since %s", s.CheckpointUpdated.Format(time.RFC3339)))
+	}
+
+	return problems
+}
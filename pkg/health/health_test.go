@@ -0,0 +1,25 @@
+package health
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStaleWithoutPasses(t *testing.T) {
+	m := NewMonitor("", time.Minute, []string{"Security"})
+	m.RecordSuccess("Security", 1)
+	m.RecordPass()
+	passed := m.Snapshot().UpdatedAt
+
+	// Reading the status, as the HTTP listener does, must not make it look fresh
+	if again := m.Snapshot().UpdatedAt; !again.Equal(passed) {
+		t.Fatalf("Snapshot moved UpdatedAt from %v to %v", passed, again)
+	}
+	status := m.Snapshot()
+	if problems := status.Problems(passed.Add(time.Minute)); len(problems) != 0 {
+		t.Fatalf("problems one interval after a pass: %v", problems)
+	}
+	if problems := status.Problems(passed.Add(4 * time.Minute)); len(problems) == 0 {
+		t.Fatal("no problem reported four intervals after the last pass")
+	}
+}
@@ -0,0 +1,258 @@
+package iislog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// IIS requests enter the pipeline as events of this pseudo channel, one event ID
+// for every request; the request fields are the insertion strings, named by
+// eventlog.FieldNames(Channel, RequestEventID)
+const (
+	Channel        = "IIS"
+	RequestEventID = 1
+	API            = "W3C log file"
+)
+
+// DefaultDir holds one W3SVC<site ID> directory of daily logs per site
+const DefaultDir = `C:\inetpub\logs\LogFiles`
+
+// columns maps the W3C fields to the event's field names
+var columns = map[string]string{
+	"c-ip":            "ClientIp",
+	"cs-method":       "Method",
+	"cs-uri-stem":     "UriStem",
+	"cs-uri-query":    "UriQuery",
+	"sc-status":       "Status",
+	"sc-substatus":    "SubStatus",
+	"sc-win32-status": "Win32Status",
+	"cs-username":     "Username",
+	"cs(user-agent)":  "UserAgent",
+	"cs(referer)":     "Referer",
+	"s-ip":            "ServerIp",
+	"s-port":          "ServerPort",
+	"time-taken":      "TimeTaken",
+}
+
+// file is the read position in one log file
+type file struct {
+	offset int64
+	fields []string // W3C fields of the current #Fields directive
+}
+
+// Reader reads new requests from the W3C logs of every site under a directory
+type Reader struct {
+	dir      string
+	files    map[string]*file
+	computer string
+}
+
+// NewReader returns a reader for the logs under dir
+func NewReader(dir string) *Reader {
+	return &Reader{dir: dir, files: map[string]*file{}, computer: eventlog.GetLocalComputerName()}
+}
+
+// Offset returns how far a log file has been read
+func (r *Reader) Offset(path string) int64 {
+	if f, ok := r.files[path]; ok {
+		return f.offset
+	}
+	return 0
+}
+
+// Seek sets how far a log file has been read, e.g. from a checkpoint
+func (r *Reader) Seek(path string, offset int64) {
+	r.files[path] = &file{offset: offset}
+}
+
+// Files returns the log files under the directory, oldest first
+func (r *Reader) Files() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(r.dir, "W3SVC*", "*.log"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list IIS logs in %s: %v", r.dir, err)
+	}
+	sort.Strings(paths) // u_exYYMMDD.log sorts by date within a site
+	return paths, nil
+}
+
+// Read returns the requests logged since the previous call, skipping files last
+// written before since. maxEvents bounds the result to the newest requests (0 = no
+// limit).
+func (r *Reader) Read(since time.Time, maxEvents int) ([]eventlog.EventLogData, error) {
+	paths, err := r.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []eventlog.EventLogData
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || (!since.IsZero() && info.ModTime().Before(since)) {
+			continue
+		}
+		read, err := r.readFile(path, since)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, read...)
+		if maxEvents > 0 && len(events) > maxEvents {
+			events = events[len(events)-maxEvents:]
+		}
+	}
+	return events, nil
+}
+
+// readFile parses the lines appended to a log file since the last read
+func (r *Reader) readFile(path string, since time.Time) ([]eventlog.EventLogData, error) {
+	f, ok := r.files[path]
+	if !ok {
+		f = &file{}
+		r.files[path] = f
+	}
+
+	handle, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer handle.Close()
+
+	// A smaller file was recycled; start over
+	if info, err := handle.Stat(); err == nil && info.Size() < f.offset {
+		f.offset = 0
+		f.fields = nil
+	}
+	// Resuming from a checkpoint needs the #Fields directive in force at the offset
+	if f.fields == nil && f.offset > 0 {
+		f.fields = lastFields(io.LimitReader(handle, f.offset))
+	}
+	if _, err := handle.Seek(f.offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek in %s: %v", path, err)
+	}
+
+	// The source names the site and daily log, e.g. W3SVC1/u_ex240501.log
+	source := filepath.Base(filepath.Dir(path)) + "/" + filepath.Base(path)
+	names := eventlog.FieldNames(Channel, RequestEventID)
+	collectedAt := time.Now().UTC()
+
+	var events []eventlog.EventLogData
+	reader := bufio.NewReader(handle)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// Leave a partially written line for the next read
+			break
+		}
+		start := f.offset
+		f.offset += int64(len(line))
+		line = strings.TrimRight(line, "\r\n")
+
+		if strings.HasPrefix(line, "#") {
+			if directive, ok := strings.CutPrefix(line, "#Fields:"); ok {
+				f.fields = strings.Fields(strings.ToLower(directive))
+			}
+			continue
+		}
+		event, ok := r.parse(f.fields, names, line)
+		if !ok || (!since.IsZero() && int64(event.TimeGenerated) < since.Unix()) {
+			continue
+		}
+		event.SourceName = source
+		// The byte offset identifies the line within its file; record numbers are
+		// 32-bit, so files beyond 4 GB wrap
+		event.RecordNumber = uint32(start)
+		event.UID = eventlog.StableID(event)
+		event.Provenance = &eventlog.Provenance{
+			Channel:          Channel,
+			API:              API,
+			CollectorVersion: eventlog.CollectorVersion,
+			Host:             r.computer,
+			Collector:        r.computer,
+			RecordNumber:     event.RecordNumber,
+			CollectedAt:      collectedAt,
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// parse converts one request line into an event
+func (r *Reader) parse(fields, names []string, line string) (eventlog.EventLogData, bool) {
+	values := strings.Fields(line)
+	if len(fields) == 0 || len(values) != len(fields) {
+		return eventlog.EventLogData{}, false
+	}
+
+	byName := map[string]string{}
+	var date, clock string
+	for i, field := range fields {
+		value := values[i]
+		if value == "-" {
+			value = ""
+		}
+		switch field {
+		case "date":
+			date = value
+		case "time":
+			clock = value
+		default:
+			if name, ok := columns[field]; ok {
+				// W3C encodes spaces as +
+				byName[name] = strings.ReplaceAll(value, "+", " ")
+			}
+		}
+	}
+	// Timestamps are in UTC
+	t, err := time.Parse("2006-01-02 15:04:05", date+" "+clock)
+	if err != nil {
+		return eventlog.EventLogData{}, false
+	}
+
+	event := eventlog.EventLogData{
+		Channel:       Channel,
+		TimeGenerated: uint32(t.Unix()),
+		TimeWritten:   uint32(t.Unix()),
+		EventID:       RequestEventID,
+		EventType:     eventType(byName["Status"]),
+		ComputerName:  r.computer,
+		Strings:       make([]string, len(names)),
+	}
+	for i, name := range names {
+		event.Strings[i] = byName[name]
+	}
+	return event, true
+}
+
+// eventType rates a request by its HTTP status: server errors are errors and client
+// errors warnings
+func eventType(status string) uint16 {
+	code, _ := strconv.Atoi(status)
+	switch {
+	case code >= 500:
+		return eventlog.EVENTLOG_ERROR_TYPE
+	case code >= 400:
+		return eventlog.EVENTLOG_WARNING_TYPE
+	}
+	return eventlog.EVENTLOG_INFORMATION_TYPE
+}
+
+// lastFields returns the W3C fields of the last #Fields directive in r
+func lastFields(r io.Reader) []string {
+	var fields []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if directive, ok := strings.CutPrefix(scanner.Text(), "#Fields:"); ok {
+			fields = strings.Fields(strings.ToLower(directive))
+		}
+	}
+	return fields
+}
@@ -0,0 +1,74 @@
+package instance
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// ErrRunning is returned by Acquire when another process holds the lock
+var ErrRunning = errors.New("another instance is running")
+
+// Lock is a named mutex held open for the lifetime of a run. The system closes it
+// when the process exits, so a crashed run never leaves a stale lock behind.
+type Lock struct {
+	handle windows.Handle
+}
+
+// lockSDDL lets every signed-in user open a lock for SYNCHRONIZE, so a user's
+// run sees the lock of a scheduled task running as SYSTEM, and the reverse
+const lockSDDL = "D:(A;;GA;;;SY)(A;;GA;;;BA)(A;;0x00100000;;;AU)"
+
+// Acquire takes the lock of a resource, such as the checkpoint file a run writes,
+// or returns ErrRunning when another process holds it. The lock is created in the
+// Global namespace, which any user may create mutexes in, so a scheduled task in
+// session 0 and the interactive runs of every user see the same lock.
+func Acquire(resource string) (*Lock, error) {
+	sum := sha256.Sum256([]byte(strings.ToLower(resource)))
+	return acquire(`Global\datn-` + hex.EncodeToString(sum[:8]))
+}
+
+// acquire creates the named mutex. The lock is the existence of the object rather
+// than its ownership, which belongs to an OS thread while goroutines move between
+// threads: creating it atomically reports whether another process has it open.
+// Only SYNCHRONIZE access is asked for, which lockSDDL grants to every user; a
+// mutex that denies even that was created by another process, typically an older
+// version running elevated, and is held just the same.
+func acquire(name string) (*Lock, error) {
+	nameUTF16, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lock name %s: %v", name, err)
+	}
+	sd, err := windows.SecurityDescriptorFromString(lockSDDL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the security descriptor of lock %s: %v", name, err)
+	}
+	attributes := &windows.SecurityAttributes{SecurityDescriptor: sd}
+	attributes.Length = uint32(unsafe.Sizeof(*attributes))
+	handle, err := windows.CreateMutexEx(attributes, nameUTF16, 0, windows.SYNCHRONIZE)
+	if handle == 0 {
+		if errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+			return nil, ErrRunning
+		}
+		return nil, fmt.Errorf("failed to create lock %s: %w", name, err)
+	}
+	if errors.Is(err, windows.ERROR_ALREADY_EXISTS) {
+		windows.CloseHandle(handle)
+		return nil, ErrRunning
+	}
+	return &Lock{handle: handle}, nil
+}
+
+// Release releases the lock; the mutex is destroyed with its last handle
+func (l *Lock) Release() {
+	if l == nil {
+		return
+	}
+	windows.CloseHandle(l.handle)
+}
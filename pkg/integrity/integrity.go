@@ -0,0 +1,135 @@
+package integrity
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// PublicKey is the hex-encoded Ed25519 key that release manifests are verified
+// with. It is set at build time:
+//
+//	go build -ldflags "-X lemita/datn/pkg/integrity.PublicKey=<hex>" ./cmd/exec
+var PublicKey string
+
+// trailerMagic ends a binary that carries a signed manifest. The layout appended
+// to the executable is: manifest JSON | Ed25519 signature | uint32 JSON length | magic.
+const trailerMagic = "DATNMAN1"
+
+// trailerSize is the fixed part at the end of the file (length and magic)
+const trailerSize = 4 + len(trailerMagic)
+
+// ErrNotSigned is returned when a binary has no embedded manifest
+var ErrNotSigned = errors.New("binary has no signed manifest")
+
+// Manifest describes a released binary
+type Manifest struct {
+	Version  string    `json:"version,omitempty"`
+	SHA256   string    `json:"sha256"` // Hash of the binary without the manifest trailer
+	SignedAt time.Time `json:"signed_at"`
+}
+
+// Sign appends a signed manifest for the binary at path. An existing manifest is
+// replaced, so a binary can be re-signed.
+func Sign(path string, version string, privateKey ed25519.PrivateKey) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if _, body, _, err := splitTrailer(data); err == nil {
+		data = body
+	}
+
+	sum := sha256.Sum256(data)
+	manifest := &Manifest{Version: version, SHA256: hex.EncodeToString(sum[:]), SignedAt: time.Now().UTC()}
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %v", err)
+	}
+
+	var trailer bytes.Buffer
+	trailer.Write(manifestJSON)
+	trailer.Write(ed25519.Sign(privateKey, manifestJSON))
+	binary.Write(&trailer, binary.LittleEndian, uint32(len(manifestJSON)))
+	trailer.WriteString(trailerMagic)
+
+	if err := os.WriteFile(path, append(data, trailer.Bytes()...), 0755); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return manifest, nil
+}
+
+// splitTrailer separates a signed binary into its manifest, the signed body and the signature
+func splitTrailer(data []byte) (manifestJSON, body, signature []byte, err error) {
+	if len(data) < trailerSize || string(data[len(data)-len(trailerMagic):]) != trailerMagic {
+		return nil, nil, nil, ErrNotSigned
+	}
+
+	lengthAt := len(data) - trailerSize
+	length := int(binary.LittleEndian.Uint32(data[lengthAt:]))
+	signatureAt := lengthAt - ed25519.SignatureSize
+	manifestAt := signatureAt - length
+	if length <= 0 || manifestAt < 0 {
+		return nil, nil, nil, fmt.Errorf("corrupt manifest trailer")
+	}
+
+	return data[manifestAt:signatureAt], data[:manifestAt], data[signatureAt:lengthAt], nil
+}
+
+// Verify checks the embedded manifest of the binary at path against the build's
+// public key and the binary's actual hash
+func Verify(path string) (*Manifest, error) {
+	if PublicKey == "" {
+		return nil, fmt.Errorf("no verification key was embedded in this build")
+	}
+	key, err := hex.DecodeString(PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid embedded verification key")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	manifestJSON, body, signature, err := splitTrailer(data)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), manifestJSON, signature) {
+		return nil, fmt.Errorf("manifest signature is invalid")
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+
+	sum := sha256.Sum256(body)
+	if actual := hex.EncodeToString(sum[:]); actual != manifest.SHA256 {
+		return &manifest, fmt.Errorf("binary hash %s does not match signed hash %s", actual, manifest.SHA256)
+	}
+	return &manifest, nil
+}
+
+// VerifySelf verifies the running executable
+func VerifySelf() (*Manifest, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate own executable: %v", err)
+	}
+	return Verify(path)
+}
@@ -0,0 +1,133 @@
+//go:build windows
+
+package integrity
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// FILE_DELETE_CHILD allows deleting files inside a directory
+const FILE_DELETE_CHILD = 0x00000040
+
+// writeAccessMask is the set of rights that allow modifying a file or the contents of a directory
+const writeAccessMask = windows.FILE_WRITE_DATA | windows.FILE_APPEND_DATA | FILE_DELETE_CHILD |
+	windows.DELETE | windows.WRITE_DAC | windows.WRITE_OWNER | windows.GENERIC_WRITE | windows.GENERIC_ALL
+
+// trustedSIDs are principals expected to be able to modify collector files
+var trustedSIDs = []windows.WELL_KNOWN_SID_TYPE{
+	windows.WinLocalSystemSid,
+	windows.WinBuiltinAdministratorsSid,
+	windows.WinCreatorOwnerSid,
+}
+
+// trustedInstallerSID is the NT SERVICE\TrustedInstaller account
+const trustedInstallerSID = "S-1-5-80-956008885-3418522649-1831038044-1853292631-2271478464"
+
+// CheckPermissions returns a warning for every path whose DACL lets a non-admin
+// principal modify it. Paths that don't exist yet are checked through their nearest
+// existing parent directory, where they would be created.
+func CheckPermissions(paths []string) []string {
+	var warnings []string
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		target, err := existingAncestor(path)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+
+		principals, err := writablePrincipals(target)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: failed to read permissions: %v", target, err))
+			continue
+		}
+		for _, principal := range principals {
+			warnings = append(warnings, fmt.Sprintf("%s is writable by non-admin principal %s", target, principal))
+		}
+	}
+	return warnings
+}
+
+// existingAncestor returns path, or its closest parent directory that exists
+func existingAncestor(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", fmt.Errorf("no existing parent directory")
+		}
+		path = parent
+	}
+}
+
+// writablePrincipals lists the untrusted principals granted write access by the DACL of path
+func writablePrincipals(path string) ([]string, error) {
+	sd, err := windows.GetNamedSecurityInfo(path, windows.SE_FILE_OBJECT, windows.DACL_SECURITY_INFORMATION)
+	if err != nil {
+		return nil, err
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return nil, err
+	}
+	if dacl == nil {
+		// A NULL DACL grants everyone full access
+		return []string{"Everyone (no DACL)"}, nil
+	}
+
+	var principals []string
+	for i := uint32(0); i < uint32(dacl.AceCount); i++ {
+		var ace *windows.ACCESS_ALLOWED_ACE
+		if err := windows.GetAce(dacl, i, &ace); err != nil {
+			return nil, err
+		}
+		if ace.Header.AceType != windows.ACCESS_ALLOWED_ACE_TYPE || ace.Header.AceFlags&windows.INHERIT_ONLY_ACE != 0 {
+			continue
+		}
+		if ace.Mask&writeAccessMask == 0 {
+			continue
+		}
+
+		sid := (*windows.SID)(unsafe.Pointer(&ace.SidStart))
+		if isTrusted(sid) {
+			continue
+		}
+		principals = append(principals, accountName(sid))
+	}
+	return principals, nil
+}
+
+// isTrusted reports whether a SID is an administrative principal
+func isTrusted(sid *windows.SID) bool {
+	for _, wellKnown := range trustedSIDs {
+		if sid.IsWellKnown(wellKnown) {
+			return true
+		}
+	}
+	return sid.String() == trustedInstallerSID
+}
+
+// accountName resolves a SID to DOMAIN\name, falling back to the SID string
+func accountName(sid *windows.SID) string {
+	account, domain, _, err := sid.LookupAccount("")
+	if err != nil {
+		return sid.String()
+	}
+	if domain != "" {
+		return domain + `\` + account
+	}
+	return account
+}
@@ -0,0 +1,354 @@
+// Package yaml reads the subset of YAML used by channels files and Sigma rules
+package yaml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a significant line of a YAML document
+type yamlLine struct {
+	indent int
+	text   string // Without indentation and comment
+	block  string // Content of a | or > block scalar started by this line
+	scalar bool   // The line starts a block scalar
+	number int
+}
+
+// Error is a syntax error at a line of a document
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.Line, e.Msg)
+}
+
+// errorf returns an Error at line
+func errorf(line int, format string, args ...any) error {
+	return &Error{Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// yamlParser reads nested mappings and lists, plain and quoted scalars, [flow]
+// lists and | or > block scalars. Anchors, tags and {flow} mappings are not
+// supported.
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// Parse splits data at --- separators and parses every document into
+// map[string]any, []any, string and nil values. Errors are of type *Error.
+func Parse(data string) ([]any, error) {
+	var documents []any
+	var current []string
+	first := 1 // Line number of the first line of current
+	flush := func() error {
+		lines, err := yamlLines(current, first)
+		if err != nil || len(lines) == 0 {
+			return err
+		}
+		p := &yamlParser{lines: lines}
+		doc, err := p.parseNode(lines[0].indent)
+		if err != nil {
+			return err
+		}
+		if p.pos < len(p.lines) {
+			return errorf(p.lines[p.pos].number, "unexpected %q", p.lines[p.pos].text)
+		}
+		documents = append(documents, doc)
+		return nil
+	}
+	for i, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		if strings.TrimRight(line, " \t") == "---" {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			current, first = nil, i+2
+			continue
+		}
+		current = append(current, line)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// yamlLines drops blank and comment lines and folds block scalars into the line
+// that starts them
+func yamlLines(raw []string, first int) ([]yamlLine, error) {
+	var lines []yamlLine
+	for i := 0; i < len(raw); i++ {
+		if strings.Contains(raw[i], "\t") && strings.TrimLeft(raw[i], " \t") != strings.TrimLeft(raw[i], " ") {
+			return nil, errorf(first+i, "tabs are not allowed in indentation")
+		}
+		text := strings.TrimSpace(stripComment(raw[i]))
+		if text == "" {
+			continue
+		}
+		line := yamlLine{indent: len(raw[i]) - len(strings.TrimLeft(raw[i], " ")), text: text, number: first + i}
+
+		// A block scalar holds every following line indented deeper, comments included
+		if indicator := blockIndicator(text); indicator != "" {
+			var block []string
+			blockIndent := -1
+			for i+1 < len(raw) {
+				next := raw[i+1]
+				trimmed := strings.TrimSpace(next)
+				nextIndent := len(next) - len(strings.TrimLeft(next, " "))
+				if trimmed != "" && nextIndent <= line.indent {
+					break
+				}
+				i++
+				if trimmed == "" {
+					block = append(block, "")
+					continue
+				}
+				if blockIndent < 0 {
+					blockIndent = nextIndent
+				}
+				block = append(block, strings.TrimRight(next[min(blockIndent, nextIndent):], " "))
+			}
+			separator := "\n"
+			if strings.HasPrefix(indicator, ">") {
+				separator = " "
+			}
+			line.block = strings.TrimRight(strings.Join(block, separator), " \n")
+			line.scalar = true
+			line.text = strings.TrimSpace(strings.TrimSuffix(text, indicator))
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// blockIndicator returns the | or > indicator ending a "key: |" or "- |" line
+func blockIndicator(text string) string {
+	for _, indicator := range []string{"|-", "|+", "|", ">-", ">+", ">"} {
+		if text == "- "+indicator || strings.HasSuffix(text, ": "+indicator) || text == indicator {
+			return indicator
+		}
+	}
+	return ""
+}
+
+// stripComment removes a # comment that starts a line or follows whitespace,
+// outside quotes
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			if i == 0 || strings.ContainsRune(" :[,-", rune(line[i-1])) {
+				quote = r
+			}
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseNode parses the mapping or list starting at the current line
+func (p *yamlParser) parseNode(indent int) (any, error) {
+	if isListItem(p.lines[p.pos].text) {
+		return p.parseList(indent)
+	}
+	return p.parseMap(indent)
+}
+
+// isListItem reports whether a line is a "- item" of a list
+func isListItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseMap parses the "key: value" lines at indent
+func (p *yamlParser) parseMap(indent int) (map[string]any, error) {
+	m := map[string]any{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent || isListItem(line.text) {
+			return nil, errorf(line.number, "unexpected %q", line.text)
+		}
+		key, value, ok := splitKey(line.text)
+		if !ok {
+			return nil, errorf(line.number, "expected \"key: value\"")
+		}
+		if _, duplicate := m[key]; duplicate {
+			return nil, errorf(line.number, "duplicate key %q", key)
+		}
+		p.pos++
+
+		switch {
+		case line.scalar:
+			m[key] = line.block
+		case value != "":
+			scalar, err := parseScalar(value)
+			if err != nil {
+				return nil, errorf(line.number, "%v", err)
+			}
+			m[key] = scalar
+		case p.pos < len(p.lines) && (p.lines[p.pos].indent > indent || p.lines[p.pos].indent == indent && isListItem(p.lines[p.pos].text)):
+			child, err := p.parseNode(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = child
+		default:
+			m[key] = nil
+		}
+	}
+	return m, nil
+}
+
+// parseList parses the "- item" lines at indent
+func (p *yamlParser) parseList(indent int) ([]any, error) {
+	list := []any{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent || line.indent == indent && !isListItem(line.text) {
+			break
+		}
+		if line.indent > indent {
+			return nil, errorf(line.number, "unexpected %q", line.text)
+		}
+		item := strings.TrimPrefix(line.text, "-")
+		trimmed := strings.TrimLeft(item, " ")
+
+		switch {
+		case line.scalar && trimmed == "":
+			p.pos++
+			list = append(list, line.block)
+		case trimmed == "":
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				child, err := p.parseNode(p.lines[p.pos].indent)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, child)
+			} else {
+				list = append(list, nil)
+			}
+		case isMappingItem(trimmed):
+			// "- key: value" starts a mapping indented like its first key
+			itemIndent := indent + 1 + len(item) - len(trimmed)
+			line.indent, line.text = itemIndent, trimmed
+			p.lines[p.pos] = line
+			child, err := p.parseMap(itemIndent)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, child)
+		default:
+			p.pos++
+			scalar, err := parseScalar(trimmed)
+			if err != nil {
+				return nil, errorf(line.number, "%v", err)
+			}
+			list = append(list, scalar)
+		}
+	}
+	return list, nil
+}
+
+// isMappingItem reports whether the text of a list item is a "key: value" pair
+// rather than a scalar
+func isMappingItem(text string) bool {
+	if text[0] == '"' || text[0] == '\'' || text[0] == '[' {
+		return false
+	}
+	_, _, ok := splitKey(text)
+	return ok
+}
+
+// splitKey splits "key: value" and "key:" lines
+func splitKey(text string) (key, value string, ok bool) {
+	if strings.HasSuffix(text, ":") {
+		key = strings.TrimSuffix(text, ":")
+	} else if i := strings.Index(text, ": "); i >= 0 {
+		key, value = text[:i], strings.TrimSpace(text[i+2:])
+	} else {
+		return "", "", false
+	}
+	key = strings.TrimSpace(key)
+	if unquoted, err := parseScalar(key); err == nil {
+		if s, isString := unquoted.(string); isString {
+			key = s
+		}
+	}
+	return key, value, key != ""
+}
+
+// parseScalar parses a plain, quoted or [flow list] value; null and ~ are nil
+func parseScalar(value string) (any, error) {
+	switch {
+	case value == "null" || value == "~" || value == "Null" || value == "NULL":
+		return nil, nil
+	case strings.HasPrefix(value, "\""):
+		if !strings.HasSuffix(value, "\"") || len(value) < 2 {
+			return nil, fmt.Errorf("unterminated string %s", value)
+		}
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			// YAML escapes that Go doesn't know, such as \/ or \e, are kept as written
+			return value[1 : len(value)-1], nil
+		}
+		return unquoted, nil
+	case strings.HasPrefix(value, "'"):
+		if !strings.HasSuffix(value, "'") || len(value) < 2 {
+			return nil, fmt.Errorf("unterminated string %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	case strings.HasPrefix(value, "["):
+		if !strings.HasSuffix(value, "]") {
+			return nil, fmt.Errorf("unterminated list %s", value)
+		}
+		list := []any{}
+		for _, field := range splitFlow(value[1 : len(value)-1]) {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			item, err := parseScalar(field)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, nil
+	case strings.HasPrefix(value, "{"), strings.HasPrefix(value, "&"), strings.HasPrefix(value, "*"), strings.HasPrefix(value, "!"):
+		return nil, fmt.Errorf("unsupported YAML value %s", value)
+	}
+	return value, nil
+}
+
+// splitFlow splits the items of a flow list at commas outside quotes
+func splitFlow(s string) []string {
+	var fields []string
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			fields = append(fields, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(fields, s[start:])
+}
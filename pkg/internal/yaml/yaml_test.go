@@ -0,0 +1,76 @@
+package yaml
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		data string
+		want []any
+	}{
+		{"", nil},
+		{"# only a comment\n", nil},
+		{"a: 1\nb:\n", []any{map[string]any{"a": "1", "b": nil}}},
+		{"a: 1\n---\nb: 2\n", []any{map[string]any{"a": "1"}, map[string]any{"b": "2"}}},
+		{"---\na: 1\n", []any{map[string]any{"a": "1"}}},
+		{"a:\r\n  b: c\r\n", []any{map[string]any{"a": map[string]any{"b": "c"}}}},
+		// Comments start a line or follow whitespace, outside quotes
+		{"a: x # note\nb: x#y\nc: \"# kept\"\nd: it's # gone\n",
+			[]any{map[string]any{"a": "x", "b": "x#y", "c": "# kept", "d": "it's"}}},
+		{"a: null\nb: ~\nc: 'it''s'\nd: \"tab\\t\"\ne: \"C:\\/x\"\n",
+			[]any{map[string]any{"a": nil, "b": nil, "c": "it's", "d": "tab\t", "e": "C:\\/x"}}},
+		{"a: [1, 'b, c', \"d\", ]\nb: []\n", []any{map[string]any{"a": []any{"1", "b, c", "d"}, "b": []any{}}}},
+		{"a: b: c\n", []any{map[string]any{"a": "b: c"}}},
+		{"\"a b\": 1\n", []any{map[string]any{"a b": "1"}}},
+		// Lists at the indentation of their key or deeper
+		{"a:\n- 1\n- 2\nb:\n  - 3\n", []any{map[string]any{"a": []any{"1", "2"}, "b": []any{"3"}}}},
+		{"- a: 1\n  b: 2\n- c\n-\n", []any{[]any{map[string]any{"a": "1", "b": "2"}, "c", nil}}},
+		{"-\n  - 1\n", []any{[]any{[]any{"1"}}}},
+		{"- \"a: b\"\n", []any{[]any{"a: b"}}},
+		// Block scalars keep their comments and blank lines
+		{"a: |\n  one\n  # two\n\n  three\nb: x\n", []any{map[string]any{"a": "one\n# two\n\nthree", "b": "x"}}},
+		{"a: >\n  one\n  two\n", []any{map[string]any{"a": "one two"}}},
+		{"- |\n  x\n", []any{[]any{"x"}}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.data)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"a: 1\nb\n", `2: expected "key: value"`},
+		{"a: 1\na: 2\n", `2: duplicate key "a"`},
+		{"a: 1\n  b: 2\n", `2: unexpected "b: 2"`},
+		{"a:\n\t- 1\n", "2: tabs are not allowed in indentation"},
+		{"a: \"open\n", `1: unterminated string "open`},
+		{"a: [1, 2\n", "1: unterminated list [1, 2"},
+		{"a: {b: 1}\n", "1: unsupported YAML value {b: 1}"},
+		{"a: 1\n---\nb: &anchor x\n", "3: unsupported YAML value &anchor x"},
+		{"- 1\nb: 2\n", `2: unexpected "b: 2"`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.data)
+		var syntax *Error
+		if !errors.As(err, &syntax) {
+			t.Errorf("Parse(%q) = %v, want an *Error", tt.data, err)
+			continue
+		}
+		if err.Error() != tt.want {
+			t.Errorf("Parse(%q) = %q, want %q", tt.data, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package longpath
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxShortPath is the longest path Windows accepts without the extended-length
+// prefix: MAX_PATH less room for an 8.3 file name, which directory APIs require
+const maxShortPath = 248
+
+// Fix returns the extended-length form of a path (\\?\C:\... or
+// \\?\UNC\server\share\...) when it is too long for the Win32 path limit, so deep
+// evidence folders on a network share can be used. Short paths and paths that
+// already carry a \\?\ or \\.\ prefix are returned unchanged.
+//
+// The os package applies the same fix to its own calls; this is for paths passed
+// straight to Windows APIs.
+func Fix(path string) string {
+	if path == "" || strings.HasPrefix(path, `\\?\`) || strings.HasPrefix(path, `\\.\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil || len(abs) < maxShortPath {
+		return path
+	}
+	// The prefix turns off normalization, so the path must be clean and use backslashes
+	abs = filepath.Clean(strings.ReplaceAll(abs, "/", `\`))
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
@@ -0,0 +1,118 @@
+package netprofile
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Channels and sources of connection events
+const (
+	WLANChannel = "Microsoft-Windows-WLAN-AutoConfig/Operational"
+	RASSource   = "RasClient" // Logs to the Application channel
+)
+
+// Connection events
+const (
+	EventConnected    = "connected"
+	EventDisconnected = "disconnected"
+	EventFailed       = "failed"
+)
+
+// wlanEvents and rasEvents map event IDs to what happened
+var (
+	wlanEvents = map[uint32]string{
+		8001: EventConnected,
+		8002: EventFailed,
+		8003: EventDisconnected,
+	}
+	rasEvents = map[uint32]string{
+		20225: EventConnected,
+		20226: EventDisconnected,
+		20227: EventFailed,
+	}
+)
+
+// Connection is one entry of the network-connection history
+type Connection struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"` // KindWireless or KindVPN
+	Name     string    `json:"name"` // SSID or VPN connection name
+	Event    string    `json:"event"`
+	Endpoint string    `json:"endpoint,omitempty"` // VPN server from the phonebook
+	User     string    `json:"user,omitempty"`
+	Detail   string    `json:"detail,omitempty"` // Reason or error code
+}
+
+// History returns the WLAN and VPN connection events among events in time order.
+// VPN servers are looked up by connection name in entries.
+func History(events []eventlog.EventLogData, entries []VPNEntry) []Connection {
+	servers := map[string]string{}
+	for _, entry := range entries {
+		servers[strings.ToLower(entry.Name)] = entry.Server
+	}
+
+	// The connect event of a RAS connection only carries its connection ID; the
+	// name comes from the matching disconnect or failure
+	rasNames := map[string]string{}
+	for _, event := range events {
+		if isRAS(event) {
+			data := eventlog.NamedData(event.Channel, event)
+			if name := data["ConnectionName"]; name != "" {
+				rasNames[data["CoId"]] = name
+			}
+		}
+	}
+
+	var history []Connection
+	for _, event := range events {
+		when := eventlog.EventTime(event.TimeGenerated)
+		data := eventlog.NamedData(event.Channel, event)
+		switch {
+		case strings.EqualFold(event.Channel, WLANChannel) && wlanEvents[event.EventID] != "":
+			connection := Connection{
+				Time:  when,
+				Kind:  KindWireless,
+				Name:  data["SSID"],
+				Event: wlanEvents[event.EventID],
+			}
+			if connection.Name == "" {
+				connection.Name = data["ProfileName"]
+			}
+			if connection.Event != EventConnected {
+				connection.Detail = data["Reason"] + data["FailureReason"]
+			}
+			history = append(history, connection)
+		case isRAS(event):
+			name := data["ConnectionName"]
+			if name == "" {
+				name = rasNames[data["CoId"]]
+			}
+			connection := Connection{
+				Time:     when,
+				Kind:     KindVPN,
+				Name:     name,
+				Event:    rasEvents[event.EventID],
+				Endpoint: servers[strings.ToLower(name)],
+				User:     data["UserName"],
+			}
+			if connection.Event != EventConnected {
+				connection.Detail = data["ReasonCode"] + data["ErrorCode"]
+			}
+			history = append(history, connection)
+		}
+	}
+
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Time.Before(history[j].Time)
+	})
+	return history
+}
+
+// isRAS reports whether an event is a RasClient connection event
+func isRAS(event eventlog.EventLogData) bool {
+	return strings.EqualFold(event.Channel, "Application") && strings.EqualFold(event.SourceName, RASSource) &&
+		rasEvents[event.EventID] != ""
+}
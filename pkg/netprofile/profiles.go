@@ -0,0 +1,166 @@
+package netprofile
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+
+	"lemita/datn/pkg/filesenum"
+)
+
+const networkListKey = `SOFTWARE\Microsoft\Windows NT\CurrentVersion\NetworkList\Profiles`
+
+// Profile kinds, from the NameType value of a network list profile
+const (
+	KindWired     = "wired"
+	KindWireless  = "wireless"
+	KindVPN       = "vpn"
+	KindMobile    = "mobile broadband"
+	KindUnknown   = "unknown"
+	phonebookFile = `Microsoft\Network\Connections\Pbk\rasphone.pbk`
+)
+
+var nameTypes = map[uint64]string{
+	6:   KindWired,
+	23:  KindVPN,
+	71:  KindWireless,
+	243: KindMobile,
+}
+
+// Profile is a network the computer has connected to, as remembered by the
+// Network List Service
+type Profile struct {
+	Name          string    `json:"name"` // SSID for wireless networks
+	Description   string    `json:"description,omitempty"`
+	Kind          string    `json:"kind"`
+	Created       time.Time `json:"created,omitempty"`
+	LastConnected time.Time `json:"last_connected,omitempty"`
+}
+
+// VPNEntry is a dial-up or VPN connection defined in a phonebook
+type VPNEntry struct {
+	Name      string `json:"name"`
+	Server    string `json:"server"`
+	Phonebook string `json:"phonebook"`
+}
+
+// ListProfilesOn returns the network list profiles of a computer (empty = local)
+func ListProfilesOn(server string) ([]Profile, error) {
+	root := registry.LOCAL_MACHINE
+	if server != "" {
+		var err error
+		root, err = registry.OpenRemoteKey(`\\`+strings.TrimPrefix(server, `\\`), registry.LOCAL_MACHINE)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to the registry of %s: %v", server, err)
+		}
+		defer root.Close()
+	}
+
+	profiles, err := registry.OpenKey(root, networkListKey, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		if err == registry.ErrNotExist {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open the network list: %v", err)
+	}
+	defer profiles.Close()
+	guids, err := profiles.ReadSubKeyNames(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the network list: %v", err)
+	}
+
+	var list []Profile
+	for _, guid := range guids {
+		key, err := registry.OpenKey(profiles, guid, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		profile := Profile{Kind: KindUnknown}
+		profile.Name, _, _ = key.GetStringValue("ProfileName")
+		profile.Description, _, _ = key.GetStringValue("Description")
+		if nameType, _, err := key.GetIntegerValue("NameType"); err == nil {
+			if kind, ok := nameTypes[nameType]; ok {
+				profile.Kind = kind
+			}
+		}
+		if data, _, err := key.GetBinaryValue("DateCreated"); err == nil {
+			profile.Created = systemTime(data)
+		}
+		if data, _, err := key.GetBinaryValue("DateLastConnected"); err == nil {
+			profile.LastConnected = systemTime(data)
+		}
+		key.Close()
+		list = append(list, profile)
+	}
+	return list, nil
+}
+
+// systemTime decodes a SYSTEMTIME structure. The network list stores local time.
+func systemTime(data []byte) time.Time {
+	if len(data) < 16 {
+		return time.Time{}
+	}
+	field := func(i int) int { return int(binary.LittleEndian.Uint16(data[2*i:])) }
+	// Fields: year, month, day of week, day, hour, minute, second, milliseconds
+	if field(0) == 0 {
+		return time.Time{}
+	}
+	return time.Date(field(0), time.Month(field(1)), field(3), field(4), field(5), field(6), field(7)*int(time.Millisecond), time.Local)
+}
+
+// ListVPNEntriesOn returns the VPN connections defined in the all-users phonebook
+// and the phonebooks of every user profile on a computer (empty = local)
+func ListVPNEntriesOn(server string) ([]VPNEntry, error) {
+	phonebooks := []string{filepath.Join(`C:\ProgramData`, phonebookFile)}
+	users, err := os.ReadDir(filesenum.AdminSharePath(server, `C:\Users`))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user profiles: %v", err)
+	}
+	for _, user := range users {
+		if user.IsDir() {
+			phonebooks = append(phonebooks, filepath.Join(`C:\Users`, user.Name(), `AppData\Roaming`, phonebookFile))
+		}
+	}
+
+	var entries []VPNEntry
+	for _, phonebook := range phonebooks {
+		found, err := readPhonebook(filesenum.AdminSharePath(server, phonebook))
+		if err != nil {
+			continue
+		}
+		for i := range found {
+			found[i].Phonebook = phonebook
+		}
+		entries = append(entries, found...)
+	}
+	return entries, nil
+}
+
+// readPhonebook parses a rasphone.pbk file: an INI file with one section per
+// entry, whose PhoneNumber is the VPN server for VPN entries
+func readPhonebook(path string) ([]VPNEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []VPNEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		switch {
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			entries = append(entries, VPNEntry{Name: line[1 : len(line)-1]})
+		case len(entries) > 0 && strings.HasPrefix(line, "PhoneNumber="):
+			entries[len(entries)-1].Server = strings.TrimPrefix(line, "PhoneNumber=")
+		}
+	}
+	return entries, scanner.Err()
+}
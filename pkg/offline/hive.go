@@ -0,0 +1,123 @@
+package offline
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows/registry"
+
+	"lemita/datn/pkg/filesenum"
+)
+
+var RegLoadAppKey = syscall.NewLazyDLL("advapi32.dll").NewProc("RegLoadAppKeyW")
+
+// Service types listed, as by filesenum.ListServicesOn
+const (
+	SERVICE_WIN32_OWN_PROCESS   = 0x10
+	SERVICE_WIN32_SHARE_PROCESS = 0x20
+)
+
+// LoadHive loads a registry hive of the image, such as SYSTEM or SOFTWARE, as a
+// private key readable with the registry package. RegLoadAppKeyW needs no
+// privileges, but the hive file must not be in use and the volume must be
+// writable, since Windows opens hives for writing. Close the key when done.
+func (img *Image) LoadHive(name string) (registry.Key, error) {
+	path := filepath.Join(img.root, configDir, name)
+	pathUTF16, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hive path %s: %v", path, err)
+	}
+	var key syscall.Handle
+	ret, _, _ := RegLoadAppKey.Call(uintptr(unsafe.Pointer(pathUTF16)), uintptr(unsafe.Pointer(&key)), registry.READ, 0, 0)
+	if ret != 0 {
+		return 0, fmt.Errorf("failed to load hive %s: %v", path, syscall.Errno(ret))
+	}
+	return registry.Key(key), nil
+}
+
+// ListServices lists the Win32 services configured in the image's SYSTEM hive,
+// under its current control set, with the SHA-256 of their binaries inside the
+// image. The paths are reported as the image records them.
+func (img *Image) ListServices() ([]filesenum.PEInfo, error) {
+	system, err := img.LoadHive("SYSTEM")
+	if err != nil {
+		return nil, err
+	}
+	defer system.Close()
+
+	selected, err := registry.OpenKey(system, "Select", registry.QUERY_VALUE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Select key of the SYSTEM hive: %v", err)
+	}
+	current, _, err := selected.GetIntegerValue("Current")
+	selected.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the current control set: %v", err)
+	}
+
+	servicesPath := fmt.Sprintf(`ControlSet%03d\Services`, current)
+	services, err := registry.OpenKey(system, servicesPath, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", servicesPath, err)
+	}
+	defer services.Close()
+	names, err := services.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", servicesPath, err)
+	}
+
+	var list []filesenum.PEInfo
+	hashes := map[string]string{}
+	for _, name := range names {
+		service, err := registry.OpenKey(services, name, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		serviceType, _, _ := service.GetIntegerValue("Type")
+		imagePath, _, pathErr := service.GetStringValue("ImagePath")
+		displayName, _, _ := service.GetStringValue("DisplayName")
+		start, _, _ := service.GetIntegerValue("Start")
+		delayed, _, _ := service.GetIntegerValue("DelayedAutostart")
+		account, _, _ := service.GetStringValue("ObjectName")
+		description, _, _ := service.GetStringValue("Description")
+		service.Close()
+		if serviceType&(SERVICE_WIN32_OWN_PROCESS|SERVICE_WIN32_SHARE_PROCESS) == 0 || pathErr != nil {
+			continue
+		}
+
+		list = append(list, filesenum.PEInfo{
+			FilePath: imagePath,
+			Hash:     img.hash(hashes, imagePath),
+			Name:     displayName,
+			Service:  name,
+			Kind:     filesenum.KindService,
+			Location: `HKLM\SYSTEM\` + servicesPath + `\` + name,
+			// Descriptions are often resource references such as @%SystemRoot%\x.dll,-101,
+			// which can't be resolved against an image
+			ServiceInfo: &filesenum.ServiceInfo{
+				ServiceType: filesenum.ServiceTypeName(uint32(serviceType)),
+				StartType:   filesenum.StartTypeName(uint32(start), delayed != 0),
+				Account:     account,
+				Description: description,
+			},
+		})
+	}
+	return list, nil
+}
+
+// hash returns the SHA-256 of the program of a command line inside the image,
+// reading each file once; unreadable binaries get filesenum.UnavailableHash
+func (img *Image) hash(cache map[string]string, command string) string {
+	path := img.Executable(command)
+	if hash, ok := cache[path]; ok {
+		return hash
+	}
+	_, hash, err := filesenum.HashFile("", path)
+	if err != nil {
+		hash = filesenum.UnavailableHash
+	}
+	cache[path] = hash
+	return hash
+}
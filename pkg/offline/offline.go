@@ -0,0 +1,120 @@
+package offline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Locations of the artifacts inside a Windows volume
+const (
+	logsDir   = `Windows\System32\winevt\Logs`
+	configDir = `Windows\System32\config`
+)
+
+// systemRoot is the Windows directory registry paths of the image refer to
+const systemRoot = `C:\Windows`
+
+// pathVariables are the environment variables found in registry paths, with the
+// value they have on a default installation
+var pathVariables = map[string]string{
+	"%systemroot%":         systemRoot,
+	"%windir%":             systemRoot,
+	"%systemdrive%":        `C:`,
+	"%programfiles%":       `C:\Program Files`,
+	"%programfiles(x86)%":  `C:\Program Files (x86)`,
+	"%programdata%":        `C:\ProgramData`,
+	"%commonprogramfiles%": `C:\Program Files\Common Files`,
+}
+
+// Image is an offline Windows volume, such as a disk image mounted as a drive
+// letter or folder, whose event logs and registry hives are read as files
+type Image struct {
+	root string
+}
+
+// Open returns the image whose system volume is mounted at root, e.g. E:\ or
+// C:\mnt\evidence
+func Open(root string) (*Image, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image root %s: %v", root, err)
+	}
+	if info, err := os.Stat(filepath.Join(root, configDir)); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a Windows volume (no %s)", root, configDir)
+	}
+	return &Image{root: root}, nil
+}
+
+// Root returns the folder the image is mounted at
+func (img *Image) Root() string {
+	return img.root
+}
+
+// EventLogs returns the .evtx files of the image, sorted by name
+func (img *Image) EventLogs() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(img.root, logsDir, "*.evtx"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list event logs: %v", err)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ChannelOfFile returns the channel an event log file holds: Windows names them
+// after the channel with "/" written as %4, e.g.
+// Microsoft-Windows-Sysmon%4Operational.evtx
+func ChannelOfFile(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return strings.ReplaceAll(name, "%4", "/")
+}
+
+// Path maps a path as the image's registry records it, e.g. a service ImagePath
+// of %SystemRoot%\system32\svchost.exe or \SystemRoot\System32\drivers\x.sys, to
+// the file inside the mounted image. Only the system drive can be mapped; paths on
+// other drive letters are mapped as if they were on it.
+func (img *Image) Path(path string) string {
+	path = strings.TrimPrefix(path, `\??\`)
+	lower := strings.ToLower(path)
+	for variable, value := range pathVariables {
+		if strings.HasPrefix(lower, variable) {
+			path = value + path[len(variable):]
+			lower = strings.ToLower(path)
+			break
+		}
+	}
+	switch {
+	case strings.HasPrefix(lower, `\systemroot\`):
+		path = systemRoot + path[len(`\systemroot`):]
+	case strings.HasPrefix(lower, `system32\`):
+		path = systemRoot + `\` + path
+	}
+	if len(path) >= 3 && path[1] == ':' && path[2] == '\\' {
+		return filepath.Join(img.root, path[3:])
+	}
+	return path
+}
+
+// Executable returns the program of a command line as the image records it, with
+// its arguments and quotes removed, mapped into the image
+func (img *Image) Executable(command string) string {
+	command = strings.TrimSpace(command)
+	if strings.HasPrefix(command, `"`) {
+		if end := strings.Index(command[1:], `"`); end >= 0 {
+			return img.Path(command[1 : end+1])
+		}
+	}
+	// Unquoted paths may contain spaces, so cut after the extension when there is one
+	lower := strings.ToLower(command)
+	for _, extension := range []string{".exe", ".sys", ".dll"} {
+		if i := strings.Index(lower, extension); i >= 0 {
+			return img.Path(command[:i+len(extension)])
+		}
+	}
+	if i := strings.IndexByte(command, ' '); i > 0 {
+		command = command[:i]
+	}
+	return img.Path(command)
+}
@@ -0,0 +1,135 @@
+package privacy
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Raw bundle file layout: magic | salt | nonce | AES-256-GCM(JSON)
+const (
+	bundleMagic      = "DATNRAW1"
+	bundleSaltSize   = 16
+	bundleIterations = 600000
+)
+
+// ChannelEvents holds the unredacted events collected from one channel
+type ChannelEvents struct {
+	Channel string                  `json:"channel"`
+	Events  []eventlog.EventLogData `json:"events"`
+}
+
+// RawBundle accumulates unredacted events for encrypted storage
+type RawBundle struct {
+	Channels []ChannelEvents `json:"channels"`
+}
+
+// Add records the raw events collected from a channel
+func (b *RawBundle) Add(channel string, logs []eventlog.EventLogData) {
+	b.Channels = append(b.Channels, ChannelEvents{Channel: channel, Events: logs})
+}
+
+// deriveKey stretches the passphrase into an AES-256 key
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, passphrase, salt, bundleIterations, 32)
+}
+
+// WriteEncrypted serializes the bundle and writes it encrypted with the passphrase
+func (b *RawBundle) WriteEncrypted(path string, passphrase string) error {
+	if passphrase == "" {
+		return fmt.Errorf("raw bundle requires a passphrase")
+	}
+
+	plaintext, err := json.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("failed to encode raw bundle: %v", err)
+	}
+
+	salt := make([]byte, bundleSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %v", err)
+	}
+
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return fmt.Errorf("failed to derive key: %v", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("failed to create GCM: %v", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	out := make([]byte, 0, len(bundleMagic)+len(salt)+len(nonce)+len(plaintext)+gcm.Overhead())
+	out = append(out, bundleMagic...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	out = gcm.Seal(out, nonce, plaintext, []byte(bundleMagic))
+
+	if err := os.WriteFile(path, out, 0600); err != nil {
+		return fmt.Errorf("failed to write raw bundle %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// ReadEncrypted decrypts a raw bundle previously written with WriteEncrypted
+func ReadEncrypted(path string, passphrase string) (*RawBundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read raw bundle %s: %v", path, err)
+	}
+
+	if len(data) < len(bundleMagic)+bundleSaltSize || string(data[:len(bundleMagic)]) != bundleMagic {
+		return nil, fmt.Errorf("%s is not a raw bundle", path)
+	}
+	salt := data[len(bundleMagic) : len(bundleMagic)+bundleSaltSize]
+	rest := data[len(bundleMagic)+bundleSaltSize:]
+
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %v", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %v", err)
+	}
+
+	if len(rest) < gcm.NonceSize() {
+		return nil, fmt.Errorf("raw bundle %s is truncated", path)
+	}
+	nonce, ciphertext := rest[:gcm.NonceSize()], rest[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(bundleMagic))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt raw bundle (wrong passphrase?): %v", err)
+	}
+
+	var bundle RawBundle
+	if err := json.Unmarshal(plaintext, &bundle); err != nil {
+		return nil, fmt.Errorf("failed to decode raw bundle: %v", err)
+	}
+
+	return &bundle, nil
+}
@@ -0,0 +1,112 @@
+package privacy
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Privacy modes controlling how command lines and script blocks are written
+const (
+	ModeOff      = "off"
+	ModeTruncate = "truncate"
+	ModeHash     = "hash"
+)
+
+// DefaultTruncateLength is the number of characters kept in truncate mode
+const DefaultTruncateLength = 64
+
+// sensitiveField identifies an insertion string that carries command-line data
+type sensitiveField struct {
+	Channel string
+	EventID uint32
+	Index   int
+}
+
+// sensitiveFields lists the insertion strings that hold command lines or script content
+var sensitiveFields = []sensitiveField{
+	{Channel: "Security", EventID: 4688, Index: 8},                                 // CommandLine
+	{Channel: "Microsoft-Windows-PowerShell/Operational", EventID: 4103, Index: 2}, // Payload
+	{Channel: "Microsoft-Windows-PowerShell/Operational", EventID: 4104, Index: 2}, // ScriptBlockText
+	{Channel: "Microsoft-Windows-Sysmon/Operational", EventID: 1, Index: 10},       // CommandLine
+	{Channel: "Microsoft-Windows-Sysmon/Operational", EventID: 1, Index: 21},       // ParentCommandLine
+}
+
+// Options configures how sensitive strings are redacted
+type Options struct {
+	Mode           string
+	TruncateLength int
+}
+
+// ValidMode reports whether mode is a supported privacy mode
+func ValidMode(mode string) bool {
+	switch mode {
+	case ModeOff, ModeTruncate, ModeHash:
+		return true
+	default:
+		return false
+	}
+}
+
+// Enabled reports whether any redaction will be applied
+func (o Options) Enabled() bool {
+	return o.Mode != "" && o.Mode != ModeOff
+}
+
+// Apply returns a copy of logs with command-line strings redacted according to opts.
+// The input slice is left untouched so the raw events can still be bundled.
+func Apply(channel string, logs []eventlog.EventLogData, opts Options) []eventlog.EventLogData {
+	if !opts.Enabled() {
+		return logs
+	}
+
+	redacted := make([]eventlog.EventLogData, len(logs))
+	for i, log := range logs {
+		redacted[i] = log
+		copied := false
+		for _, field := range sensitiveFields {
+			if !strings.EqualFold(field.Channel, channel) || field.EventID != log.EventID {
+				continue
+			}
+			if field.Index >= len(log.Strings) {
+				continue
+			}
+
+			// Copy the strings slice before the first modification
+			if !copied {
+				redacted[i].Strings = append([]string(nil), log.Strings...)
+				copied = true
+			}
+			redacted[i].Strings[field.Index] = RedactString(log.Strings[field.Index], opts)
+		}
+	}
+
+	return redacted
+}
+
+// RedactString truncates or hashes a single value according to opts
+func RedactString(value string, opts Options) string {
+	if value == "" {
+		return value
+	}
+
+	switch opts.Mode {
+	case ModeTruncate:
+		limit := opts.TruncateLength
+		if limit <= 0 {
+			limit = DefaultTruncateLength
+		}
+		runes := []rune(value)
+		if len(runes) <= limit {
+			return value
+		}
+		return fmt.Sprintf("%s... [truncated %d chars]", string(runes[:limit]), len(runes)-limit)
+	case ModeHash:
+		sum := sha256.Sum256([]byte(value))
+		return fmt.Sprintf("sha256:%x", sum)
+	default:
+		return value
+	}
+}
@@ -0,0 +1,181 @@
+package privileges
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Events summarized per account
+const (
+	SpecialLogonEvent        = 4672 // Special privileges assigned to a new logon
+	ExplicitCredentialsEvent = 4648 // A logon was attempted using explicit credentials
+	SIDHistoryEvent          = 4765 // SID history was added to an account
+	SIDHistoryFailedEvent    = 4766 // An attempt to add SID history to an account failed
+)
+
+// serviceSIDs are the built-in service accounts, which receive special privileges
+// on every logon and would drown out the interesting accounts
+var serviceSIDs = map[string]bool{
+	"S-1-5-18": true, // LocalSystem
+	"S-1-5-19": true, // LocalService
+	"S-1-5-20": true, // NetworkService
+}
+
+// Account is the privileged activity of one account
+type Account struct {
+	Account             string    `json:"account"` // DOMAIN\user
+	Sid                 string    `json:"sid,omitempty"`
+	SpecialLogons       int       `json:"special_logons"`                 // 4672 events
+	Privileges          []string  `json:"privileges,omitempty"`           // Privileges seen in those logons
+	ExplicitCredentials int       `json:"explicit_credentials"`           // 4648 events where the account supplied other credentials
+	AlternateAccounts   []string  `json:"alternate_accounts,omitempty"`   // DOMAIN\user of the credentials it supplied
+	Targets             []string  `json:"targets,omitempty"`              // Servers those credentials were used against
+	Processes           []string  `json:"processes,omitempty"`            // Processes that supplied them
+	SIDHistory          []string  `json:"sid_history,omitempty"`          // SIDs added to the account's SID history (4765)
+	SIDHistoryFailures  int       `json:"sid_history_failures,omitempty"` // Failed attempts to add SID history (4766)
+	Hosts               []string  `json:"hosts"`
+	First               time.Time `json:"first"`
+	Last                time.Time `json:"last"`
+}
+
+// Tracker summarizes special privilege logons, explicit credential use and SID
+// history changes per account; an account that suddenly holds debug or backup
+// privileges, or hands other accounts' credentials to runas or PsExec, is often an
+// attacker's
+type Tracker struct {
+	accounts map[string]*Account
+}
+
+// NewTracker returns an empty tracker
+func NewTracker() *Tracker {
+	return &Tracker{accounts: make(map[string]*Account)}
+}
+
+// Add records the privileged activity among events of the Security channel
+func (t *Tracker) Add(events []eventlog.EventLogData) {
+	if t == nil {
+		return
+	}
+	for _, event := range events {
+		if !strings.EqualFold(event.Channel, "Security") {
+			continue
+		}
+		switch event.EventID {
+		case SpecialLogonEvent, ExplicitCredentialsEvent, SIDHistoryEvent, SIDHistoryFailedEvent:
+		default:
+			continue
+		}
+
+		data := eventlog.NamedData(event.Channel, event)
+		prefix := "Subject"
+		if event.EventID == SIDHistoryEvent || event.EventID == SIDHistoryFailedEvent {
+			prefix = "Target" // The account whose SID history changed
+		}
+		sid := data[prefix+"UserSid"]
+		if sid == "" {
+			sid = data["TargetSid"]
+		}
+		name := data[prefix+"UserName"]
+		if serviceSIDs[strings.ToUpper(sid)] || strings.HasSuffix(name, "$") || name == "" || name == "-" {
+			continue
+		}
+
+		account := t.account(qualified(data[prefix+"DomainName"], name), sid)
+		at := eventlog.EventTime(event.TimeGenerated)
+		if account.First.IsZero() || at.Before(account.First) {
+			account.First = at
+		}
+		if at.After(account.Last) {
+			account.Last = at
+		}
+		account.Hosts = addUnique(account.Hosts, event.ComputerName)
+
+		switch event.EventID {
+		case SpecialLogonEvent:
+			account.SpecialLogons++
+			for _, privilege := range strings.Fields(data["PrivilegeList"]) {
+				account.Privileges = addUnique(account.Privileges, privilege)
+			}
+		case ExplicitCredentialsEvent:
+			account.ExplicitCredentials++
+			account.AlternateAccounts = addUnique(account.AlternateAccounts, qualified(data["TargetDomainName"], data["TargetUserName"]))
+			account.Targets = addUnique(account.Targets, data["TargetServerName"])
+			account.Processes = addUnique(account.Processes, data["ProcessName"])
+		case SIDHistoryEvent:
+			for _, added := range strings.Fields(data["SidList"]) {
+				account.SIDHistory = addUnique(account.SIDHistory, strings.Trim(added, "%{}"))
+			}
+		case SIDHistoryFailedEvent:
+			account.SIDHistoryFailures++
+		}
+	}
+}
+
+// account returns the entry of an account, creating it on first use
+func (t *Tracker) account(name, sid string) *Account {
+	key := strings.ToLower(name)
+	if account, ok := t.accounts[key]; ok {
+		if account.Sid == "" {
+			account.Sid = sid
+		}
+		return account
+	}
+	account := &Account{Account: name, Sid: sid}
+	t.accounts[key] = account
+	return account
+}
+
+// Len returns the number of accounts with privileged activity
+func (t *Tracker) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.accounts)
+}
+
+// Accounts returns the accounts, those with SID history changes first, then by the
+// number of explicit credential uses and special logons
+func (t *Tracker) Accounts() []Account {
+	list := make([]Account, 0, len(t.accounts))
+	for _, account := range t.accounts {
+		list = append(list, *account)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if (len(a.SIDHistory) + a.SIDHistoryFailures) != (len(b.SIDHistory) + b.SIDHistoryFailures) {
+			return len(a.SIDHistory)+a.SIDHistoryFailures > len(b.SIDHistory)+b.SIDHistoryFailures
+		}
+		if a.ExplicitCredentials != b.ExplicitCredentials {
+			return a.ExplicitCredentials > b.ExplicitCredentials
+		}
+		if a.SpecialLogons != b.SpecialLogons {
+			return a.SpecialLogons > b.SpecialLogons
+		}
+		return a.Account < b.Account
+	})
+	return list
+}
+
+// qualified joins a domain and user name as DOMAIN\user
+func qualified(domain, user string) string {
+	if domain == "" || domain == "-" {
+		return user
+	}
+	return domain + `\` + user
+}
+
+// addUnique appends value unless it is empty or already present, ignoring case
+func addUnique(list []string, value string) []string {
+	if value == "" || value == "-" {
+		return list
+	}
+	for _, existing := range list {
+		if strings.EqualFold(existing, value) {
+			return list
+		}
+	}
+	return append(list, value)
+}
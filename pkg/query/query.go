@@ -0,0 +1,503 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Query is a compiled filter over saved events, written as
+//
+//	channel=Security AND event_id IN (4624,4625) AND time > 2024-05-01
+//
+// Conditions are "field op value" with the operators = != < <= > >= ~ (contains),
+// LIKE (with * and ? wildcards) and IN (list), combined with AND, OR, NOT and
+// parentheses. Keywords and string comparisons are case-insensitive. Fields:
+// channel, event_id (id), record, time, level, type, category, source, computer,
+// message (any insertion string), detection, label (of an analyst note), data.NAME
+// and tag.NAME. Time values accept RFC3339, "2006-01-02[ 15:04:05]", "now" and
+// "now-24h".
+type Query struct {
+	source string
+	root   queryNode
+}
+
+// queryNode is an element of a parsed query
+type queryNode interface {
+	match(event eventlog.EventLogData) bool
+}
+
+type (
+	andNode  struct{ left, right queryNode }
+	orNode   struct{ left, right queryNode }
+	notNode  struct{ operand queryNode }
+	condNode struct {
+		field  string
+		op     string
+		values []string
+		times  []time.Time    // Parsed values for the time field
+		like   *regexp.Regexp // Compiled LIKE pattern
+	}
+	trueNode struct{}
+)
+
+func (n *andNode) match(e eventlog.EventLogData) bool { return n.left.match(e) && n.right.match(e) }
+func (n *orNode) match(e eventlog.EventLogData) bool  { return n.left.match(e) || n.right.match(e) }
+func (n *notNode) match(e eventlog.EventLogData) bool { return !n.operand.match(e) }
+func (trueNode) match(eventlog.EventLogData) bool     { return true }
+
+// Parse compiles a query. An empty query matches every event.
+func Parse(source string) (*Query, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return &Query{source: source, root: trueNode{}}, nil
+	}
+
+	p := &queryParser{tokens: tokens, now: time.Now()}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in query", p.tokens[p.pos])
+	}
+
+	return &Query{source: source, root: root}, nil
+}
+
+// String returns the query source
+func (q *Query) String() string {
+	return q.source
+}
+
+// Match reports whether an event satisfies the query
+func (q *Query) Match(event eventlog.EventLogData) bool {
+	return q.root.match(event)
+}
+
+// lex splits a query into words, quoted strings and the symbols ( ) , and comparison operators
+func lex(source string) ([]string, error) {
+	var tokens []string
+	i := 0
+	for i < len(source) {
+		c := source[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '(' || c == ')' || c == ',':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(source[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string in query")
+			}
+			// Quoted strings keep a leading quote marker so they are never taken as keywords
+			tokens = append(tokens, "\""+source[i+1:i+1+end])
+			i += end + 2
+		case strings.ContainsRune("=!<>~", rune(c)):
+			j := i + 1
+			for j < len(source) && strings.ContainsRune("=<>", rune(source[j])) {
+				j++
+			}
+			tokens = append(tokens, source[i:j])
+			i = j
+		default:
+			j := i
+			for j < len(source) && !unicode.IsSpace(rune(source[j])) && !strings.ContainsRune("()=!<>~,\"'", rune(source[j])) {
+				j++
+			}
+			tokens = append(tokens, source[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// queryParser builds a query tree with recursive descent
+type queryParser struct {
+	tokens []string
+	pos    int
+	now    time.Time
+}
+
+func (p *queryParser) peekKeyword(keyword string) bool {
+	return p.pos < len(p.tokens) && strings.EqualFold(p.tokens[p.pos], keyword)
+}
+
+func (p *queryParser) next() (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", fmt.Errorf("unexpected end of query")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, nil
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("OR") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("AND") {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (queryNode, error) {
+	if p.peekKeyword("NOT") {
+		p.pos++
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand}, nil
+	}
+	if p.peekKeyword("(") {
+		p.pos++
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peekKeyword(")") {
+			return nil, fmt.Errorf("missing ) in query")
+		}
+		p.pos++
+		return n, nil
+	}
+	return p.parseCondition()
+}
+
+func (p *queryParser) parseCondition() (queryNode, error) {
+	field, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	field = normalizeField(field)
+	if !validField(field) {
+		return nil, fmt.Errorf("unknown field %q in query", field)
+	}
+
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	op = strings.ToUpper(op)
+
+	cond := &condNode{field: field, op: op}
+	switch op {
+	case "=", "==", "!=", "<>", "<", "<=", ">", ">=", "~", "LIKE", "CONTAINS":
+		value, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		cond.values = []string{strings.TrimPrefix(value, "\"")}
+	case "NOT":
+		if !p.peekKeyword("IN") {
+			return nil, fmt.Errorf("expected IN after NOT in query")
+		}
+		p.pos++
+		cond.op = "NOT IN"
+		fallthrough
+	case "IN":
+		if !p.peekKeyword("(") {
+			return nil, fmt.Errorf("expected ( after IN in query")
+		}
+		p.pos++
+		for {
+			value, err := p.next()
+			if err != nil {
+				return nil, err
+			}
+			cond.values = append(cond.values, strings.TrimPrefix(value, "\""))
+			sep, err := p.next()
+			if err != nil {
+				return nil, err
+			}
+			if sep == ")" {
+				break
+			}
+			if sep != "," {
+				return nil, fmt.Errorf("expected , or ) in IN list, found %q", sep)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown operator %q in query", op)
+	}
+
+	if cond.op == "LIKE" {
+		cond.like = likePattern(cond.values[0])
+	}
+
+	if field == "time" {
+		for _, value := range cond.values {
+			t, err := ParseTime(value, p.now)
+			if err != nil {
+				return nil, err
+			}
+			cond.times = append(cond.times, t)
+		}
+	}
+
+	return cond, nil
+}
+
+// normalizeField maps field aliases to their canonical name
+func normalizeField(field string) string {
+	lower := strings.ToLower(field)
+	switch lower {
+	case "id", "eventid", "event":
+		return "event_id"
+	case "record_number", "recordnumber":
+		return "record"
+	case "time_generated", "timestamp":
+		return "time"
+	case "strings", "msg":
+		return "message"
+	case "provider":
+		return "source"
+	case "labels":
+		return "label"
+	case "host":
+		return "computer"
+	}
+	if strings.HasPrefix(lower, "data.") {
+		return "data." + field[len("data."):]
+	}
+	if strings.HasPrefix(lower, "tag.") || strings.HasPrefix(lower, "tags.") {
+		return "tag." + field[strings.Index(field, ".")+1:]
+	}
+	return lower
+}
+
+// validField reports whether a (normalized) field can be queried
+func validField(field string) bool {
+	switch field {
+	case "channel", "event_id", "record", "time", "level", "type", "category", "source", "computer", "message", "detection", "label":
+		return true
+	}
+	return strings.HasPrefix(field, "data.") || strings.HasPrefix(field, "tag.")
+}
+
+// ParseTime parses an absolute or relative ("now", "now-24h") time value
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	lower := strings.ToLower(value)
+	if lower == "now" {
+		return now, nil
+	}
+	if strings.HasPrefix(lower, "now-") {
+		d, err := time.ParseDuration(lower[len("now-"):])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid relative time %q: %v", value, err)
+		}
+		return now.Add(-d), nil
+	}
+
+	layouts := []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use RFC3339, YYYY-MM-DD[ HH:MM:SS] or now-DURATION)", value)
+}
+
+// fieldValues returns the textual values of a field for an event
+func fieldValues(event eventlog.EventLogData, field string) []string {
+	switch field {
+	case "channel":
+		return []string{event.Channel}
+	case "event_id":
+		return []string{strconv.FormatUint(uint64(event.EventID), 10)}
+	case "record":
+		return []string{strconv.FormatUint(uint64(event.RecordNumber), 10)}
+	case "level":
+		return []string{eventlog.GetEventTypeName(event.EventType)}
+	case "type":
+		return []string{strconv.Itoa(int(event.EventType))}
+	case "category":
+		return []string{strconv.Itoa(int(event.EventCategory))}
+	case "source":
+		return []string{event.SourceName}
+	case "computer":
+		return []string{event.ComputerName}
+	case "message":
+		return event.Strings
+	case "detection":
+		return event.Detections
+	case "label":
+		return eventlog.NoteLabels(event.Notes)
+	}
+
+	if name, ok := strings.CutPrefix(field, "data."); ok {
+		for key, value := range eventlog.NamedData(event.Channel, event) {
+			if strings.EqualFold(key, name) {
+				return []string{value}
+			}
+		}
+		return nil
+	}
+	if name, ok := strings.CutPrefix(field, "tag."); ok {
+		for key, value := range event.Tags {
+			if strings.EqualFold(key, name) {
+				return []string{value}
+			}
+		}
+	}
+	return nil
+}
+
+func (n *condNode) match(event eventlog.EventLogData) bool {
+	if n.field == "time" {
+		return n.matchTime(time.Unix(int64(event.TimeGenerated), 0))
+	}
+
+	values := fieldValues(event, n.field)
+	switch n.op {
+	case "!=", "<>":
+		for _, v := range values {
+			if compareValues(v, n.values[0]) == 0 {
+				return false
+			}
+		}
+		return true
+	case "NOT IN":
+		for _, v := range values {
+			for _, want := range n.values {
+				if compareValues(v, want) == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	for _, v := range values {
+		switch n.op {
+		case "=", "==":
+			if compareValues(v, n.values[0]) == 0 {
+				return true
+			}
+		case "IN":
+			for _, want := range n.values {
+				if compareValues(v, want) == 0 {
+					return true
+				}
+			}
+		case "<", "<=", ">", ">=":
+			if ordered(compareValues(v, n.values[0]), n.op) {
+				return true
+			}
+		case "~", "CONTAINS":
+			if strings.Contains(strings.ToLower(v), strings.ToLower(n.values[0])) {
+				return true
+			}
+		case "LIKE":
+			if n.like.MatchString(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchTime compares an event timestamp with the parsed time values
+func (n *condNode) matchTime(t time.Time) bool {
+	switch n.op {
+	case "IN", "NOT IN":
+		found := false
+		for _, want := range n.times {
+			if t.Equal(want) {
+				found = true
+			}
+		}
+		return found == (n.op == "IN")
+	case "!=", "<>":
+		return !t.Equal(n.times[0])
+	}
+	return ordered(t.Compare(n.times[0]), n.op)
+}
+
+// likePattern converts a LIKE pattern with * or % (any run) and ? or _ (one
+// character) wildcards into a case-insensitive regular expression
+func likePattern(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '*', '%':
+			sb.WriteString(".*")
+		case '?', '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
+// ordered applies a comparison operator to the result of a three-way comparison
+func ordered(cmp int, op string) bool {
+	switch op {
+	case "=", "==":
+		return cmp == 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// compareValues compares numerically when both values are numbers, otherwise as
+// case-insensitive strings
+func compareValues(a, b string) int {
+	if x, err := strconv.ParseFloat(a, 64); err == nil {
+		if y, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
@@ -0,0 +1,127 @@
+package runas
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	advapi32                = syscall.NewLazyDLL("advapi32.dll")
+	LogonUser               = advapi32.NewProc("LogonUserW")
+	ImpersonateLoggedOnUser = advapi32.NewProc("ImpersonateLoggedOnUser")
+)
+
+const (
+	LOGON32_LOGON_INTERACTIVE     = 2
+	LOGON32_LOGON_NEW_CREDENTIALS = 9
+
+	LOGON32_PROVIDER_DEFAULT = 0
+	LOGON32_PROVIDER_WINNT50 = 3
+)
+
+// Identity is a logged-on account whose credentials are used for remote calls
+type Identity struct {
+	Domain   string
+	User     string
+	password string // Kept for transports that authenticate in a child process (WinRM)
+	token    windows.Token
+}
+
+// SplitAccount splits DOMAIN\user or user@domain into its parts
+func SplitAccount(account string) (domain, user string) {
+	if i := strings.IndexByte(account, '\\'); i >= 0 {
+		return account[:i], account[i+1:]
+	}
+	if i := strings.LastIndexByte(account, '@'); i >= 0 {
+		return account[i+1:], account[:i]
+	}
+	return ".", account
+}
+
+// Logon obtains a token for account (DOMAIN\user or user@domain). Like
+// "runas /netonly", the credentials are only presented to remote hosts: local
+// access checks keep using the caller's own identity.
+func Logon(account, password string) (*Identity, error) {
+	domain, user := SplitAccount(account)
+	if user == "" {
+		return nil, fmt.Errorf("invalid account %q", account)
+	}
+
+	userPtr, err := syscall.UTF16PtrFromString(user)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user name: %v", err)
+	}
+	domainPtr, err := syscall.UTF16PtrFromString(domain)
+	if err != nil {
+		return nil, fmt.Errorf("invalid domain name: %v", err)
+	}
+	passwordPtr, err := syscall.UTF16PtrFromString(password)
+	if err != nil {
+		return nil, fmt.Errorf("invalid password: %v", err)
+	}
+
+	var token windows.Token
+	ret, _, err := LogonUser.Call(
+		uintptr(unsafe.Pointer(userPtr)),
+		uintptr(unsafe.Pointer(domainPtr)),
+		uintptr(unsafe.Pointer(passwordPtr)),
+		LOGON32_LOGON_NEW_CREDENTIALS,
+		LOGON32_PROVIDER_WINNT50,
+		uintptr(unsafe.Pointer(&token)),
+	)
+	if ret == 0 {
+		return nil, fmt.Errorf("LogonUser failed for %s\\%s: %v", domain, user, err)
+	}
+
+	return &Identity{Domain: domain, User: user, password: password, token: token}, nil
+}
+
+// String returns DOMAIN\user
+func (id *Identity) String() string {
+	return id.Domain + `\` + id.User
+}
+
+// Password returns the account password
+func (id *Identity) Password() string {
+	return id.password
+}
+
+// Do runs fn while the calling thread impersonates the identity. Impersonation is
+// per OS thread, so the goroutine is locked to its thread for the duration and fn
+// must not hand work to other goroutines. A nil identity runs fn unchanged.
+func (id *Identity) Do(fn func() error) error {
+	if id == nil {
+		return fn()
+	}
+
+	runtime.LockOSThread()
+
+	ret, _, err := ImpersonateLoggedOnUser.Call(uintptr(id.token))
+	if ret == 0 {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("ImpersonateLoggedOnUser failed for %s: %v", id, err)
+	}
+	defer func() {
+		if err := windows.RevertToSelf(); err != nil {
+			// Leave the goroutine locked so the impersonating thread is never
+			// handed back to the scheduler for other goroutines
+			return
+		}
+		runtime.UnlockOSThread()
+	}()
+
+	return fn()
+}
+
+// Close releases the logon token
+func (id *Identity) Close() error {
+	if id == nil {
+		return nil
+	}
+	return id.token.Close()
+}
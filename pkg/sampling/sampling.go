@@ -0,0 +1,215 @@
+package sampling
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Rule limits how many events of a channel (optionally a single event ID) are kept
+type Rule struct {
+	Channel   string
+	EventID   uint32        // 0 applies the rule to every event ID of the channel
+	KeepOneIn int           // Keep one event out of every KeepOneIn (0 = no sampling)
+	RateLimit int           // Maximum events kept per RatePer window (0 = no cap)
+	RatePer   time.Duration // Length of the rate window
+}
+
+// ParseRule parses a rule specification of the form
+//
+//	CHANNEL[:EVENTID]=1/N       keep one in N events
+//	CHANNEL[:EVENTID]=N/s|m|h   keep at most N events per second, minute or hour
+func ParseRule(spec string) (Rule, error) {
+	idx := strings.LastIndex(spec, "=")
+	if idx <= 0 {
+		return Rule{}, fmt.Errorf("invalid sampling rule %q (expected CHANNEL[:EVENTID]=1/N or CHANNEL[:EVENTID]=N/m)", spec)
+	}
+	target, value := strings.TrimSpace(spec[:idx]), strings.TrimSpace(spec[idx+1:])
+
+	rule := Rule{Channel: target}
+	if colon := strings.LastIndex(target, ":"); colon > 0 {
+		if id, err := strconv.ParseUint(target[colon+1:], 10, 32); err == nil {
+			rule.Channel = target[:colon]
+			rule.EventID = uint32(id)
+		}
+	}
+
+	amount, unit, ok := strings.Cut(value, "/")
+	if !ok {
+		return Rule{}, fmt.Errorf("invalid sampling value %q in rule %q", value, spec)
+	}
+
+	switch unit {
+	case "s", "sec":
+		rule.RatePer = time.Second
+	case "m", "min":
+		rule.RatePer = time.Minute
+	case "h", "hour":
+		rule.RatePer = time.Hour
+	default:
+		// "1/N" form
+		n, err := strconv.Atoi(unit)
+		if err != nil || amount != "1" || n < 1 {
+			return Rule{}, fmt.Errorf("invalid sampling value %q in rule %q", value, spec)
+		}
+		rule.KeepOneIn = n
+		return rule, nil
+	}
+
+	limit, err := strconv.Atoi(amount)
+	if err != nil || limit < 0 {
+		return Rule{}, fmt.Errorf("invalid rate limit %q in rule %q", amount, spec)
+	}
+	rule.RateLimit = limit
+	return rule, nil
+}
+
+// matches reports whether the rule applies to an event of the channel
+func (r Rule) matches(channel string, eventID uint32) bool {
+	return strings.EqualFold(r.Channel, channel) && (r.EventID == 0 || r.EventID == eventID)
+}
+
+// retainedWindows is how many windows before the newest one a rate-capped rule
+// remembers, so events that arrive out of order still count against their window
+const retainedWindows = 60
+
+// windows tracks how many events a rate-capped rule kept in each recent window.
+// Windows are aligned to multiples of the rule's RatePer in event time, so a batch
+// read at once, such as a follow-mode poll, is capped per window it spans.
+type windows struct {
+	newest int64         // Start of the newest window, in Unix nanoseconds
+	kept   map[int64]int // Events kept by window start
+}
+
+// keep reports whether an event of the window starting at start is kept and
+// counts it. Events older than the retained windows are dropped, as their
+// window may already have reached the limit.
+func (w *windows) keep(start time.Time, per time.Duration, limit int) bool {
+	key := start.UnixNano()
+	oldest := func(newest int64) int64 { return newest - retainedWindows*int64(per) }
+	switch {
+	case w.kept == nil:
+		w.kept = map[int64]int{}
+		w.newest = key
+	case key > w.newest:
+		w.newest = key
+		for k := range w.kept {
+			if k < oldest(key) {
+				delete(w.kept, k)
+			}
+		}
+	case key < oldest(w.newest):
+		return false
+	}
+	if w.kept[key] >= limit {
+		return false
+	}
+	w.kept[key]++
+	return true
+}
+
+// Sampler applies sampling rules and accounts for the events it drops
+type Sampler struct {
+	mu      sync.Mutex
+	rules   []Rule
+	seen    []uint64
+	windows []windows
+	dropped map[string]int64
+	now     func() time.Time // Time of events that carry none
+}
+
+// NewSampler creates a sampler for the rules. Event-specific rules take precedence
+// over channel-wide rules.
+func NewSampler(rules []Rule) *Sampler {
+	return &Sampler{
+		rules:   rules,
+		seen:    make([]uint64, len(rules)),
+		windows: make([]windows, len(rules)),
+		dropped: map[string]int64{},
+		now:     time.Now,
+	}
+}
+
+// ruleFor returns the index of the most specific rule for an event, or -1
+func (s *Sampler) ruleFor(channel string, eventID uint32) int {
+	match := -1
+	for i, rule := range s.rules {
+		if !rule.matches(channel, eventID) {
+			continue
+		}
+		if rule.EventID != 0 {
+			return i
+		}
+		if match == -1 {
+			match = i
+		}
+	}
+	return match
+}
+
+// Apply returns the events that survive sampling. Events without a matching rule are always kept.
+func (s *Sampler) Apply(channel string, logs []eventlog.EventLogData) []eventlog.EventLogData {
+	if s == nil || len(s.rules) == 0 {
+		return logs
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := logs[:0:0]
+	for _, log := range logs {
+		i := s.ruleFor(channel, log.EventID)
+		if i < 0 {
+			kept = append(kept, log)
+			continue
+		}
+		rule := s.rules[i]
+
+		keep := true
+		if rule.KeepOneIn > 1 {
+			keep = s.seen[i]%uint64(rule.KeepOneIn) == 0
+			s.seen[i]++
+		}
+		if keep && rule.RatePer > 0 {
+			start := s.eventTime(log).Truncate(rule.RatePer)
+			keep = s.windows[i].keep(start, rule.RatePer, rule.RateLimit)
+		}
+
+		if keep {
+			kept = append(kept, log)
+		} else {
+			s.dropped[channel]++
+		}
+	}
+
+	return kept
+}
+
+// eventTime returns when an event was logged, or the current time for events
+// without a time
+func (s *Sampler) eventTime(log eventlog.EventLogData) time.Time {
+	if log.TimeGenerated == 0 {
+		return s.now()
+	}
+	return eventlog.EventTime(log.TimeGenerated)
+}
+
+// Dropped returns the number of events dropped per channel so far
+func (s *Sampler) Dropped() map[string]int64 {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]int64, len(s.dropped))
+	for channel, n := range s.dropped {
+		out[channel] = n
+	}
+	return out
+}
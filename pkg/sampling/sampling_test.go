@@ -0,0 +1,72 @@
+package sampling
+
+import (
+	"testing"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// batch returns count events of an event ID logged every step seconds from start
+func batch(eventID uint32, start uint32, step uint32, count int) []eventlog.EventLogData {
+	events := make([]eventlog.EventLogData, count)
+	for i := range events {
+		events[i] = eventlog.EventLogData{EventID: eventID, TimeGenerated: start + uint32(i)*step}
+	}
+	return events
+}
+
+func TestApplyRateWindowsFollowEventTime(t *testing.T) {
+	const start = 1699999980 // 2023-11-14 22:13:00 UTC, aligned to a minute
+	tests := []struct {
+		name    string
+		rule    string
+		batches [][]eventlog.EventLogData
+		kept    int
+	}{
+		// A 30 s follow-mode poll hands over 30 windows of one second at once
+		{"one poll spanning 30 windows", "Security=5/s", [][]eventlog.EventLogData{concat(30, func(i int) []eventlog.EventLogData {
+			return batch(4624, start+uint32(i), 0, 10)
+		})}, 30 * 5},
+		{"windows continue across polls", "Security=5/s", [][]eventlog.EventLogData{batch(4624, start, 0, 4), batch(4624, start, 0, 4)}, 5},
+		{"a new window in the next poll", "Security=5/s", [][]eventlog.EventLogData{batch(4624, start, 0, 8), batch(4624, start+1, 0, 8)}, 10},
+		{"minute windows", "Security=2/m", [][]eventlog.EventLogData{batch(4624, start, 10, 18)}, 3 * 2},
+		// Events of an earlier window arriving after a later one count against
+		// their own window instead of starting it over
+		{"out-of-order windows", "Security=5/s", [][]eventlog.EventLogData{concat(4, func(i int) []eventlog.EventLogData {
+			return batch(4624, start+uint32(i%2), 0, 4)
+		})}, 2 * 5},
+		{"windows older than the retained ones", "Security=5/s", [][]eventlog.EventLogData{batch(4624, start, 0, 2), batch(4624, start+retainedWindows+1, 0, 2), batch(4624, start, 0, 2)}, 4},
+		{"event rule only", "Security:4625=1/s", [][]eventlog.EventLogData{batch(4624, start, 0, 5), batch(4625, start, 0, 5)}, 5 + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRule(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := NewSampler([]Rule{rule})
+			s.now = func() time.Time { t.Fatal("events with a time used the clock"); return time.Time{} }
+			kept, total := 0, 0
+			for _, events := range tt.batches {
+				total += len(events)
+				kept += len(s.Apply("Security", events))
+			}
+			if kept != tt.kept {
+				t.Errorf("kept %d events, want %d", kept, tt.kept)
+			}
+			if dropped := s.Dropped()["Security"]; dropped != int64(total-tt.kept) {
+				t.Errorf("dropped %d events, want %d", dropped, total-tt.kept)
+			}
+		})
+	}
+}
+
+// concat joins the batches fn returns for 0 to n-1
+func concat(n int, fn func(i int) []eventlog.EventLogData) []eventlog.EventLogData {
+	var events []eventlog.EventLogData
+	for i := 0; i < n; i++ {
+		events = append(events, fn(i)...)
+	}
+	return events
+}
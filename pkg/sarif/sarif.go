@@ -0,0 +1,287 @@
+// Package sarif exports detections as a SARIF 2.1.0 log, so they can be uploaded
+// to code scanning platforms and dashboards that already read SARIF. Hosts are the
+// log's artifacts and every detection on an event is a result.
+package sarif
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Version and Schema identify the SARIF format written
+const (
+	Version = "2.1.0"
+	Schema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// toolName is the driver name recorded in the log
+const toolName = "datn"
+
+// Rule describes a detection rule; rules without a description are exported with
+// their name only
+type Rule struct {
+	Name        string   // Name recorded in the events' Detections
+	ID          string   // Rule's own identifier, such as a Sigma rule id (optional)
+	Description string   // Longer description (optional)
+	Level       string   // Severity: critical, high, medium, low or informational (optional)
+	Tags        []string // Tags such as ATT&CK techniques (optional)
+}
+
+// Report accumulates the detections of a run
+type Report struct {
+	rules    map[string]Rule
+	order    []string       // Rule names in the order they were first seen
+	hosts    map[string]int // Host name to artifact index
+	artifact []string       // Host names by artifact index
+	results  []result
+}
+
+// NewReport returns an empty report
+func NewReport() *Report {
+	return &Report{rules: map[string]Rule{}, hosts: map[string]int{}}
+}
+
+// Describe records the metadata of a rule, whether or not it matches any event
+func (r *Report) Describe(rule Rule) {
+	if r == nil {
+		return
+	}
+	if _, ok := r.rules[rule.Name]; !ok {
+		r.order = append(r.order, rule.Name)
+	}
+	r.rules[rule.Name] = rule
+}
+
+// Add records a result for every detection on the events. Events without a
+// computer name are attributed to host.
+func (r *Report) Add(host string, events []eventlog.EventLogData) {
+	if r == nil {
+		return
+	}
+	for _, event := range events {
+		if len(event.Detections) == 0 {
+			continue
+		}
+		computer := event.ComputerName
+		if computer == "" {
+			computer = host
+		}
+		index, ok := r.hosts[strings.ToLower(computer)]
+		if !ok {
+			index = len(r.artifact)
+			r.hosts[strings.ToLower(computer)] = index
+			r.artifact = append(r.artifact, computer)
+		}
+		for _, name := range event.Detections {
+			if _, ok := r.rules[name]; !ok {
+				r.Describe(Rule{Name: name})
+			}
+			r.results = append(r.results, newResult(name, index, computer, event))
+		}
+	}
+}
+
+// Len returns the number of results
+func (r *Report) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.results)
+}
+
+// Write saves the report as a SARIF log
+func (r *Report) Write(path string) error {
+	if r == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.log(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode SARIF log: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write SARIF log %s: %v", path, err)
+	}
+	return nil
+}
+
+// The subset of the SARIF object model written by Report
+
+type sarifLog struct {
+	Version string `json:"version"`
+	Schema  string `json:"$schema"`
+	Runs    []run  `json:"runs"`
+}
+
+type run struct {
+	Tool      tool       `json:"tool"`
+	Artifacts []artifact `json:"artifacts"`
+	Results   []result   `json:"results"`
+}
+
+type tool struct {
+	Driver driver `json:"driver"`
+}
+
+type driver struct {
+	Name    string           `json:"name"`
+	Version string           `json:"version"`
+	Rules   []ruleDescriptor `json:"rules"`
+}
+
+type ruleDescriptor struct {
+	ID               string          `json:"id"`
+	Name             string          `json:"name,omitempty"`
+	ShortDescription message         `json:"shortDescription"`
+	FullDescription  *message        `json:"fullDescription,omitempty"`
+	DefaultConfig    *configuration  `json:"defaultConfiguration,omitempty"`
+	Properties       *ruleProperties `json:"properties,omitempty"`
+}
+
+type configuration struct {
+	Level string `json:"level"`
+}
+
+type ruleProperties struct {
+	RuleID string   `json:"ruleId,omitempty"` // Identifier of the rule in its own format
+	Tags   []string `json:"tags,omitempty"`
+}
+
+type message struct {
+	Text string `json:"text"`
+}
+
+type artifact struct {
+	Location artifactLocation `json:"location"`
+}
+
+type artifactLocation struct {
+	URI   string `json:"uri"`
+	Index *int   `json:"index,omitempty"`
+}
+
+type result struct {
+	RuleID     string           `json:"ruleId"`
+	RuleIndex  int              `json:"ruleIndex"`
+	Level      string           `json:"level,omitempty"`
+	Message    message          `json:"message"`
+	Locations  []location       `json:"locations"`
+	Properties resultProperties `json:"properties"`
+}
+
+type location struct {
+	PhysicalLocation physicalLocation  `json:"physicalLocation"`
+	LogicalLocations []logicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type physicalLocation struct {
+	ArtifactLocation artifactLocation `json:"artifactLocation"`
+}
+
+type logicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+type resultProperties struct {
+	UID          string `json:"uid,omitempty"`
+	Channel      string `json:"channel"`
+	EventID      uint32 `json:"eventId"`
+	RecordNumber uint32 `json:"recordNumber"`
+	Source       string `json:"source,omitempty"`
+	Time         string `json:"time"`
+}
+
+// newResult builds the result of a detection on an event, with the host as the
+// artifact and the channel and record as the logical location
+func newResult(name string, host int, computer string, event eventlog.EventLogData) result {
+	index := host
+	text := fmt.Sprintf("%s: event %d from %s on %s", name, event.EventID, event.SourceName, computer)
+	if event.Message != "" {
+		text += "\n" + event.Message
+	}
+	record := fmt.Sprintf("%s/%d", event.Channel, event.RecordNumber)
+	return result{
+		RuleID:  name,
+		Message: message{Text: text},
+		Locations: []location{{
+			PhysicalLocation: physicalLocation{ArtifactLocation: artifactLocation{URI: hostURI(computer), Index: &index}},
+			LogicalLocations: []logicalLocation{{Name: record, FullyQualifiedName: computer + "/" + record, Kind: "object"}},
+		}},
+		Properties: resultProperties{
+			UID:          event.UID,
+			Channel:      event.Channel,
+			EventID:      event.EventID,
+			RecordNumber: event.RecordNumber,
+			Source:       event.SourceName,
+			Time:         eventlog.EventTime(event.TimeGenerated).UTC().Format("2006-01-02T15:04:05Z"),
+		},
+	}
+}
+
+// hostURI is the relative URI of a host's artifact
+func hostURI(host string) string {
+	return url.PathEscape(host)
+}
+
+// level maps a rule severity to a SARIF level
+func level(severity string) string {
+	switch strings.ToLower(severity) {
+	case "critical", "high":
+		return "error"
+	case "medium":
+		return "warning"
+	case "low", "informational":
+		return "note"
+	}
+	return ""
+}
+
+// log assembles the SARIF log, with the rules sorted by name so reruns diff cleanly
+func (r *Report) log() sarifLog {
+	names := append([]string(nil), r.order...)
+	sort.Strings(names)
+	indexes := make(map[string]int, len(names))
+	rules := make([]ruleDescriptor, 0, len(names))
+	for i, name := range names {
+		indexes[name] = i
+		rule := r.rules[name]
+		descriptor := ruleDescriptor{ID: name, Name: name, ShortDescription: message{Text: name}}
+		if rule.Description != "" {
+			descriptor.FullDescription = &message{Text: rule.Description}
+		}
+		if l := level(rule.Level); l != "" {
+			descriptor.DefaultConfig = &configuration{Level: l}
+		}
+		if rule.ID != "" || len(rule.Tags) > 0 {
+			descriptor.Properties = &ruleProperties{RuleID: rule.ID, Tags: rule.Tags}
+		}
+		rules = append(rules, descriptor)
+	}
+
+	results := make([]result, len(r.results))
+	for i, res := range r.results {
+		res.RuleIndex = indexes[res.RuleID]
+		res.Level = level(r.rules[res.RuleID].Level)
+		results[i] = res
+	}
+	artifacts := make([]artifact, len(r.artifact))
+	for i, host := range r.artifact {
+		artifacts[i] = artifact{Location: artifactLocation{URI: hostURI(host)}}
+	}
+	return sarifLog{
+		Version: Version,
+		Schema:  Schema,
+		Runs: []run{{
+			Tool:      tool{Driver: driver{Name: toolName, Version: eventlog.CollectorVersion, Rules: rules}},
+			Artifacts: artifacts,
+			Results:   results,
+		}},
+	}
+}
@@ -0,0 +1,94 @@
+package servicedrift
+
+import (
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/filesenum"
+)
+
+// Service changes enter the pipeline as events of this pseudo channel; the
+// insertion strings are named by eventlog.FieldNames(Channel, ...)
+const (
+	Channel            = "ServiceDrift"
+	PathChangedEventID = 1 // The binary path of a service changed
+	HashChangedEventID = 2 // The binary at an unchanged path was replaced
+	API                = "service snapshot"
+)
+
+// Monitor compares successive snapshots of the services of a computer. Services
+// installed or removed between snapshots are left to the Service Control Manager
+// events (7045, 4697); the monitor catches what those miss: an existing service
+// repointed at another binary, or its binary overwritten in place.
+type Monitor struct {
+	computer string
+	previous map[string]filesenum.PEInfo // By lowercase service key name; nil before the first snapshot
+	sequence uint32
+}
+
+// NewMonitor returns a monitor for the services of computer
+func NewMonitor(computer string) *Monitor {
+	return &Monitor{computer: computer}
+}
+
+// Check compares a snapshot with the previous one and returns an event for every
+// service whose binary path or hash changed. The first snapshot is the baseline
+// and returns no events.
+func (m *Monitor) Check(services []filesenum.PEInfo, at time.Time) []eventlog.EventLogData {
+	current := make(map[string]filesenum.PEInfo, len(services))
+	for _, service := range services {
+		// Recovery commands are listed under the same service key
+		if service.Kind == filesenum.KindService {
+			current[strings.ToLower(service.Service)] = service
+		}
+	}
+	previous := m.previous
+	m.previous = current
+	if previous == nil {
+		return nil
+	}
+
+	var events []eventlog.EventLogData
+	for key, now := range current {
+		before, ok := previous[key]
+		if !ok {
+			continue
+		}
+		// An unreadable binary has no hash; that alone is not a replacement
+		switch {
+		case !strings.EqualFold(before.FilePath, now.FilePath):
+			events = append(events, m.event(PathChangedEventID, before, now, at))
+		case before.Hash != "" && now.Hash != "" && !strings.EqualFold(before.Hash, now.Hash):
+			events = append(events, m.event(HashChangedEventID, before, now, at))
+		}
+	}
+	return events
+}
+
+// event builds the event of one changed service
+func (m *Monitor) event(id uint32, before, now filesenum.PEInfo, at time.Time) eventlog.EventLogData {
+	m.sequence++
+	event := eventlog.EventLogData{
+		Channel:       Channel,
+		RecordNumber:  m.sequence,
+		TimeGenerated: uint32(at.Unix()),
+		TimeWritten:   uint32(at.Unix()),
+		EventID:       id,
+		EventType:     eventlog.EVENTLOG_WARNING_TYPE,
+		SourceName:    API,
+		ComputerName:  m.computer,
+		Strings:       []string{now.Service, now.Name, before.FilePath, now.FilePath, before.Hash, now.Hash},
+	}
+	event.UID = eventlog.StableID(event)
+	event.Provenance = &eventlog.Provenance{
+		Channel:          Channel,
+		API:              API,
+		CollectorVersion: eventlog.CollectorVersion,
+		Host:             m.computer,
+		Collector:        eventlog.GetLocalComputerName(),
+		RecordNumber:     event.RecordNumber,
+		CollectedAt:      at.UTC(),
+	}
+	return event
+}
@@ -0,0 +1,330 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// ErrRejected marks a permanent rejection of a batch by the destination: 400 (Bad
+// Request) or 422 (Unprocessable Content). Sending the same batch again would fail
+// the same way.
+var ErrRejected = errors.New("batch rejected")
+
+// ErrUnavailable marks a destination that refuses every request whatever the
+// batch: 401 (Unauthorized), 403 (Forbidden) or 404 (Not Found), as after an
+// expired token or a mistyped endpoint. Retrying at once won't help, but the
+// batches are good and are kept until the destination is fixed.
+var ErrUnavailable = errors.New("destination unavailable")
+
+// rejected reports whether a status code rejects a batch permanently
+func rejected(status int) bool {
+	return status == http.StatusBadRequest || status == http.StatusUnprocessableEntity
+}
+
+// unavailable reports whether a status code refuses requests regardless of the batch
+func unavailable(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return true
+	}
+	return false
+}
+
+// Options configures batching, retry and spooling for network sinks
+type Options struct {
+	BatchSize    int           // Initial number of events per request
+	MinBatchSize int           // Lower bound when shrinking batches after failures or slow sends
+	MaxBatchSize int           // Upper bound when growing batches after fast sends
+	SlowSend     time.Duration // Sends slower than this shrink the batch size
+	Gzip         bool          // Compress request bodies
+	MaxRetries   int           // Attempts per batch before spooling it
+	RetryBase    time.Duration // Base delay for exponential backoff
+	RetryMax     time.Duration // Cap on the backoff delay
+	Timeout      time.Duration // Per-request timeout
+	SpoolDir     string        // Directory for undeliverable batches (empty disables spooling)
+	Spool        SpoolOptions  // At-rest encryption and size cap of the spool
+}
+
+// DefaultOptions returns the default network sink settings
+func DefaultOptions() Options {
+	return Options{
+		BatchSize:    500,
+		MinBatchSize: 50,
+		MaxBatchSize: 5000,
+		SlowSend:     5 * time.Second,
+		Gzip:         true,
+		MaxRetries:   5,
+		RetryBase:    500 * time.Millisecond,
+		RetryMax:     30 * time.Second,
+		Timeout:      30 * time.Second,
+		Spool: SpoolOptions{
+			Encrypt:  true,
+			MaxBytes: 512 << 20,
+		},
+	}
+}
+
+// HTTPSink posts newline-delimited JSON batches to an HTTP endpoint
+type HTTPSink struct {
+	url       string
+	opts      Options
+	client    *http.Client
+	spool     *Spool
+	pending   [][]byte
+	batchSize int
+
+	// Delivery statistics, updated atomically so Stats can be read during a flush
+	sent         atomic.Int64
+	spooled      atomic.Int64
+	pendingCount atomic.Int64
+}
+
+// NewHTTPSink creates an HTTP sink posting to url
+func NewHTTPSink(url string, opts Options) (*HTTPSink, error) {
+	defaults := DefaultOptions()
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaults.BatchSize
+	}
+	if opts.MinBatchSize <= 0 {
+		opts.MinBatchSize = defaults.MinBatchSize
+	}
+	if opts.MaxBatchSize < opts.BatchSize {
+		opts.MaxBatchSize = opts.BatchSize
+	}
+	if opts.RetryBase <= 0 {
+		opts.RetryBase = defaults.RetryBase
+	}
+	if opts.RetryMax <= 0 {
+		opts.RetryMax = defaults.RetryMax
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaults.Timeout
+	}
+
+	s := &HTTPSink{
+		url:       url,
+		opts:      opts,
+		client:    &http.Client{Timeout: opts.Timeout},
+		batchSize: opts.BatchSize,
+	}
+
+	if opts.SpoolDir != "" {
+		spool, err := NewSpool(opts.SpoolDir, opts.Spool)
+		if err != nil {
+			return nil, err
+		}
+		s.spool = spool
+	}
+
+	return s, nil
+}
+
+// Write queues events and sends full batches
+func (s *HTTPSink) Write(channel string, logs []eventlog.EventLogData) error {
+	lines, err := encodeRecords(channel, logs)
+	if err != nil {
+		return err
+	}
+	s.pending = append(s.pending, lines...)
+	s.pendingCount.Store(int64(len(s.pending)))
+
+	for len(s.pending) >= s.batchSize {
+		batch := s.pending[:s.batchSize]
+		s.pending = s.pending[s.batchSize:]
+		err := s.deliver(batch)
+		s.pendingCount.Store(int64(len(s.pending)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Flush sends all queued events
+func (s *HTTPSink) Flush() error {
+	if len(s.pending) == 0 {
+		return s.drainSpool()
+	}
+	batch := s.pending
+	s.pending = nil
+	err := s.deliver(batch)
+	s.pendingCount.Store(0)
+	return err
+}
+
+// Stats reports delivery counters
+func (s *HTTPSink) Stats() Stats {
+	stats := Stats{
+		Sent:    s.sent.Load(),
+		Spooled: s.spooled.Load(),
+		Pending: s.pendingCount.Load(),
+	}
+	if s.spool != nil {
+		stats.Evicted = s.spool.EvictedCount()
+		stats.Quarantined = s.spool.QuarantinedCount()
+		if files, err := s.spool.Files(); err == nil {
+			stats.Backlog = int64(len(files))
+		}
+	}
+	return stats
+}
+
+// Close flushes queued events
+func (s *HTTPSink) Close() error {
+	return s.Flush()
+}
+
+// deliver sends a batch, spooling it to disk if the destination stays unreachable
+func (s *HTTPSink) deliver(batch [][]byte) error {
+	// Older spooled batches go first so events arrive in order
+	if err := s.drainSpool(); err != nil {
+		return s.spoolBatch(batch, err)
+	}
+
+	if err := s.sendWithRetry(batch); err != nil {
+		return s.spoolBatch(batch, err)
+	}
+
+	s.sent.Add(int64(len(batch)))
+	return nil
+}
+
+// spoolBatch stores an undeliverable batch, or returns sendErr when spooling is
+// disabled. A rejected batch goes straight to quarantine and sendErr is returned.
+// A batch an unavailable destination refused is spooled for later delivery, but
+// sendErr is still returned so callers hold their checkpoints back until the
+// destination accepts requests again.
+func (s *HTTPSink) spoolBatch(batch [][]byte, sendErr error) error {
+	if s.spool == nil {
+		return fmt.Errorf("failed to deliver %d events: %v", len(batch), sendErr)
+	}
+	if errors.Is(sendErr, ErrRejected) {
+		if err := s.spool.PutRejected(batch); err != nil {
+			return fmt.Errorf("failed to deliver %d events (%v) and failed to quarantine them: %v", len(batch), sendErr, err)
+		}
+		return fmt.Errorf("failed to deliver %d events, kept in the spool as rejected: %v", len(batch), sendErr)
+	}
+	if err := s.spool.Put(batch); err != nil {
+		return fmt.Errorf("failed to deliver %d events (%v) and failed to spool them: %v", len(batch), sendErr, err)
+	}
+	s.spooled.Add(int64(len(batch)))
+	if errors.Is(sendErr, ErrUnavailable) {
+		return fmt.Errorf("failed to deliver %d events, kept in the spool: %v", len(batch), sendErr)
+	}
+	return nil
+}
+
+// drainSpool resends spooled batches once the destination is reachable again
+func (s *HTTPSink) drainSpool() error {
+	if s.spool == nil {
+		return nil
+	}
+	_, _, err := s.spool.Drain(func(lines [][]byte) error {
+		if err := s.send(lines); err != nil {
+			return err
+		}
+		s.sent.Add(int64(len(lines)))
+		return nil
+	})
+	return err
+}
+
+// sendWithRetry sends a batch with exponential backoff and full jitter between attempts
+func (s *HTTPSink) sendWithRetry(batch [][]byte) error {
+	var err error
+	for attempt := 0; attempt <= s.opts.MaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := s.opts.RetryBase << (attempt - 1)
+			if delay > s.opts.RetryMax || delay <= 0 {
+				delay = s.opts.RetryMax
+			}
+			time.Sleep(time.Duration(rand.Int64N(int64(delay) + 1)))
+		}
+
+		if err = s.send(batch); err == nil || errors.Is(err, ErrRejected) || errors.Is(err, ErrUnavailable) {
+			return err
+		}
+	}
+	return err
+}
+
+// send performs a single POST and adapts the batch size to the observed result
+func (s *HTTPSink) send(batch [][]byte) error {
+	body := append(bytes.Join(batch, []byte("\n")), '\n')
+
+	var reader io.Reader = bytes.NewReader(body)
+	if s.opts.Gzip {
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		if _, err := gz.Write(body); err != nil {
+			return fmt.Errorf("failed to compress batch: %v", err)
+		}
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("failed to compress batch: %v", err)
+		}
+		reader = &compressed
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.opts.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.shrinkBatch()
+		return fmt.Errorf("request to %s failed: %v", s.url, err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if rejected(resp.StatusCode) {
+		return fmt.Errorf("request to %s returned %s: %w", s.url, resp.Status, ErrRejected)
+	}
+	if unavailable(resp.StatusCode) {
+		return fmt.Errorf("request to %s returned %s: %w", s.url, resp.Status, ErrUnavailable)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		s.shrinkBatch()
+		return fmt.Errorf("request to %s returned %s", s.url, resp.Status)
+	}
+
+	if s.opts.SlowSend > 0 && time.Since(start) > s.opts.SlowSend {
+		s.shrinkBatch()
+	} else {
+		s.growBatch()
+	}
+
+	return nil
+}
+
+// shrinkBatch halves the batch size after a failed or slow send
+func (s *HTTPSink) shrinkBatch() {
+	s.batchSize /= 2
+	if s.batchSize < s.opts.MinBatchSize {
+		s.batchSize = s.opts.MinBatchSize
+	}
+}
+
+// growBatch doubles the batch size after a fast successful send
+func (s *HTTPSink) growBatch() {
+	s.batchSize *= 2
+	if s.batchSize > s.opts.MaxBatchSize {
+		s.batchSize = s.opts.MaxBatchSize
+	}
+}
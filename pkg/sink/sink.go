@@ -0,0 +1,62 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Sink receives collected events and delivers them to a destination
+type Sink interface {
+	// Write queues the events collected from a channel for delivery
+	Write(channel string, logs []eventlog.EventLogData) error
+	// Flush delivers any queued events
+	Flush() error
+	// Close flushes queued events and releases resources
+	Close() error
+	// Stats reports delivery counters; safe to call while a flush is in progress
+	Stats() Stats
+}
+
+// Stats counts events by delivery outcome
+type Stats struct {
+	Sent    int64 // Delivered to the destination
+	Spooled int64 // Persisted to the on-disk spool for later delivery
+	Evicted int64 // Dropped from the spool by the size cap
+	Pending int64 // Still queued in memory
+	Backlog int64 // Batches waiting in the on-disk spool
+
+	// Batches set aside in the spool as .bad files, unreadable or rejected by the destination
+	Quarantined int64
+}
+
+// Record is the wire representation of a single event sent to a sink
+type Record struct {
+	Channel string                `json:"channel"`
+	Event   eventlog.EventLogData `json:"event"`
+}
+
+// encodeRecords serializes the events of a channel as newline-delimited JSON lines
+func encodeRecords(channel string, logs []eventlog.EventLogData) ([][]byte, error) {
+	lines := make([][]byte, 0, len(logs))
+	for _, log := range logs {
+		line, err := json.Marshal(Record{Channel: channel, Event: log})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode event %d: %v", log.RecordNumber, err)
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// New creates a sink from a destination URL. Supported schemes are http and https.
+func New(destination string, opts Options) (Sink, error) {
+	switch {
+	case strings.HasPrefix(destination, "http://"), strings.HasPrefix(destination, "https://"):
+		return NewHTTPSink(destination, opts)
+	default:
+		return nil, fmt.Errorf("unsupported sink destination %q", destination)
+	}
+}
@@ -0,0 +1,271 @@
+package sink
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"lemita/datn/pkg/dpapi"
+)
+
+// File extensions of plain and DPAPI-encrypted spooled batches, and the suffix
+// added to batches set aside because they can't be delivered
+const (
+	spoolExtension          = ".ndjson"
+	spoolEncryptedExtension = ".ndjson.enc"
+	quarantineSuffix        = ".bad"
+)
+
+// SpoolOptions configures at-rest protection and size limits of the spool
+type SpoolOptions struct {
+	Encrypt  bool  // Encrypt batches with the machine-bound DPAPI key
+	MaxBytes int64 // Maximum total size of spooled and quarantined batches; quarantined, then oldest, are evicted first (0 = unlimited)
+}
+
+// Spool buffers undelivered batches on disk so they survive an unreachable destination
+type Spool struct {
+	dir  string
+	opts SpoolOptions
+	mu   sync.Mutex
+	seq  uint64
+
+	// Number of events dropped by size-cap eviction
+	evicted atomic.Int64
+	// Number of batches set aside as unreadable or rejected
+	quarantined atomic.Int64
+}
+
+// NewSpool creates (if needed) and opens the spool directory
+func NewSpool(dir string, opts SpoolOptions) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory %s: %v", dir, err)
+	}
+	return &Spool{dir: dir, opts: opts}, nil
+}
+
+// Put stores a batch of encoded lines as a new spool file
+func (s *Spool) Put(lines [][]byte) error {
+	return s.put(lines, "")
+}
+
+// PutRejected stores a batch the destination rejected straight in quarantine, so
+// it is kept for inspection but never resent
+func (s *Spool) PutRejected(lines [][]byte) error {
+	if err := s.put(lines, quarantineSuffix); err != nil {
+		return err
+	}
+	s.quarantined.Add(1)
+	return nil
+}
+
+// put writes a spool file, with suffix added to its name
+func (s *Spool) put(lines [][]byte, suffix string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	extension := spoolExtension
+	if s.opts.Encrypt {
+		extension = spoolEncryptedExtension
+	}
+	// Zero-padded names keep lexical order equal to arrival order
+	name := fmt.Sprintf("%020d-%06d%s%s", time.Now().UnixNano(), s.seq, extension, suffix)
+	tmpPath := filepath.Join(s.dir, name+".tmp")
+
+	payload := append(bytes.Join(lines, []byte("\n")), '\n')
+	if s.opts.Encrypt {
+		protected, err := dpapi.Protect(payload)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt spool batch: %v", err)
+		}
+		payload = protected
+	}
+	if err := os.WriteFile(tmpPath, payload, 0600); err != nil {
+		return fmt.Errorf("failed to write spool file: %v", err)
+	}
+
+	// Rename so a crash never leaves a partially written batch behind
+	if err := os.Rename(tmpPath, filepath.Join(s.dir, name)); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to commit spool file: %v", err)
+	}
+
+	return s.enforceLimit()
+}
+
+// enforceLimit evicts batches until the spool fits within MaxBytes: quarantined
+// batches first, as they are never resent, then the oldest pending ones.
+// Must be called with s.mu held.
+func (s *Spool) enforceLimit() error {
+	if s.opts.MaxBytes <= 0 {
+		return nil
+	}
+
+	quarantined, err := s.list(true)
+	if err != nil {
+		return err
+	}
+	pending, err := s.Files()
+	if err != nil {
+		return err
+	}
+	// Always keep the newest pending batch, even if it alone exceeds the cap
+	if len(pending) > 0 {
+		pending = pending[:len(pending)-1]
+	}
+	files := append(quarantined, pending...)
+
+	total, err := s.size()
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		if total <= s.opts.MaxBytes {
+			break
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if lines, err := s.read(path); err == nil {
+			s.evicted.Add(int64(len(lines)))
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to evict spool file %s: %v", path, err)
+		}
+		total -= info.Size()
+	}
+
+	return nil
+}
+
+// size returns the total size of the pending and quarantined batches
+func (s *Spool) size() (int64, error) {
+	var total int64
+	for _, quarantined := range []bool{false, true} {
+		files, err := s.list(quarantined)
+		if err != nil {
+			return 0, err
+		}
+		for _, path := range files {
+			if info, err := os.Stat(path); err == nil {
+				total += info.Size()
+			}
+		}
+	}
+	return total, nil
+}
+
+// EvictedCount returns the number of events dropped by size-cap eviction
+func (s *Spool) EvictedCount() int64 {
+	return s.evicted.Load()
+}
+
+// QuarantinedCount returns the number of batches set aside as unreadable or rejected
+func (s *Spool) QuarantinedCount() int64 {
+	return s.quarantined.Load()
+}
+
+// quarantine renames a batch that can't be delivered to .bad, taking it out of
+// the spool without losing it
+func (s *Spool) quarantine(path string) error {
+	if err := os.Rename(path, path+quarantineSuffix); err != nil {
+		return fmt.Errorf("failed to quarantine spool file %s: %v", path, err)
+	}
+	s.quarantined.Add(1)
+	return nil
+}
+
+// read loads and, if needed, decrypts a spooled batch
+func (s *Spool) read(path string) ([][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool file %s: %v", path, err)
+	}
+
+	if strings.HasSuffix(strings.TrimSuffix(path, quarantineSuffix), spoolEncryptedExtension) {
+		data, err = dpapi.Unprotect(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt spool file %s: %v", path, err)
+		}
+	}
+
+	return bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n")), nil
+}
+
+// Files returns the spooled batch files, oldest first
+func (s *Spool) Files() ([]string, error) {
+	return s.list(false)
+}
+
+// list returns the pending batch files, or the quarantined ones, oldest first
+func (s *Spool) list(quarantined bool) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory %s: %v", s.dir, err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		if quarantined {
+			var ok bool
+			if name, ok = strings.CutSuffix(name, quarantineSuffix); !ok {
+				continue
+			}
+		}
+		if !(strings.HasSuffix(name, spoolExtension) || strings.HasSuffix(name, spoolEncryptedExtension)) {
+			continue
+		}
+		files = append(files, filepath.Join(s.dir, entry.Name()))
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// Drain sends spooled batches oldest-first using send, removing each one that is
+// delivered, and returns the number delivered and quarantined. Batches that can't
+// be read or decrypted, or that send rejects with ErrRejected, are quarantined and
+// draining continues; any other failure, ErrUnavailable included, is transient and
+// stops the drain so ordering is preserved.
+func (s *Spool) Drain(send func(lines [][]byte) error) (drained, quarantined int, err error) {
+	files, err := s.Files()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, path := range files {
+		lines, err := s.read(path)
+		if err == nil {
+			err = send(lines)
+			if err != nil && !errors.Is(err, ErrRejected) {
+				return drained, quarantined, err
+			}
+		}
+		if err != nil {
+			if err := s.quarantine(path); err != nil {
+				return drained, quarantined, err
+			}
+			quarantined++
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			return drained, quarantined, fmt.Errorf("failed to remove delivered spool file %s: %v", path, err)
+		}
+		drained++
+	}
+
+	return drained, quarantined, nil
+}
@@ -0,0 +1,156 @@
+package sink
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+func TestDrainQuarantinesBadBatches(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := NewSpool(dir, SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"rejected", "delivered"} {
+		if err := spool.Put([][]byte{[]byte(line)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An encrypted batch this machine can't decrypt
+	if err := os.WriteFile(filepath.Join(dir, "00000000000000000000-000000"+spoolEncryptedExtension), []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent []string
+	drained, quarantined, err := spool.Drain(func(lines [][]byte) error {
+		if string(lines[0]) == "rejected" {
+			return ErrRejected
+		}
+		sent = append(sent, string(lines[0]))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if drained != 1 || quarantined != 2 || len(sent) != 1 || sent[0] != "delivered" {
+		t.Errorf("drained %d, quarantined %d, sent %q; want 1, 2, [delivered]", drained, quarantined, sent)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	bad := 0
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), quarantineSuffix) {
+			bad++
+		}
+	}
+	if bad != 2 || spool.QuarantinedCount() != 2 {
+		t.Errorf("%d .bad files, QuarantinedCount %d; want 2", bad, spool.QuarantinedCount())
+	}
+}
+
+func TestDrainStopsOnTransientFailure(t *testing.T) {
+	spool, err := NewSpool(t.TempDir(), SpoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first", "second"} {
+		if err := spool.Put([][]byte{[]byte(line)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	unreachable := errors.New("connection refused")
+	drained, quarantined, err := spool.Drain(func(lines [][]byte) error { return unreachable })
+	if !errors.Is(err, unreachable) || drained != 0 || quarantined != 0 {
+		t.Errorf("Drain = %d, %d, %v; want 0, 0 and the send error", drained, quarantined, err)
+	}
+	if files, _ := spool.Files(); len(files) != 2 {
+		t.Errorf("%d batches left in the spool, want 2", len(files))
+	}
+}
+
+func TestRejected(t *testing.T) {
+	for status, want := range map[int]bool{400: true, 401: false, 403: false, 404: false, 408: false, 413: false, 422: true, 429: false, 500: false, 503: false} {
+		if got := rejected(status); got != want {
+			t.Errorf("rejected(%d) = %v, want %v", status, got, want)
+		}
+	}
+	for status, want := range map[int]bool{400: false, 401: true, 403: true, 404: true, 422: false, 429: false, 503: false} {
+		if got := unavailable(status); got != want {
+			t.Errorf("unavailable(%d) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestUnavailableDestinationKeepsBatches(t *testing.T) {
+	// An expired token: every request is refused, whatever the batch
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	s, err := NewHTTPSink(server.URL, Options{BatchSize: 1, SpoolDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.spool.Put([][]byte{[]byte("spooled")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The error holds the caller's checkpoint back
+	if err := s.Write("Security", []eventlog.EventLogData{{RecordNumber: 1}}); err == nil {
+		t.Error("Write to an unavailable destination succeeded")
+	}
+	files, err := s.spool.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || s.spool.QuarantinedCount() != 0 {
+		t.Errorf("%d batches spooled, %d quarantined; want 2 and 0", len(files), s.spool.QuarantinedCount())
+	}
+}
+
+func TestLimitCountsQuarantinedBatches(t *testing.T) {
+	dir := t.TempDir()
+	batch := [][]byte{[]byte(strings.Repeat("x", 99))} // 100 bytes with the newline
+	spool, err := NewSpool(dir, SpoolOptions{MaxBytes: 250})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := spool.PutRejected(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 300 bytes with the pending batch: the oldest quarantined batch goes first
+	if err := spool.Put(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, _ := spool.list(false)
+	quarantined, _ := spool.list(true)
+	if len(pending) != 1 || len(quarantined) != 1 || spool.EvictedCount() != 1 {
+		t.Errorf("%d pending, %d quarantined, %d evicted; want 1, 1 and 1", len(pending), len(quarantined), spool.EvictedCount())
+	}
+
+	// Rejected batches alone can't grow the spool past the cap
+	for i := 0; i < 5; i++ {
+		if err := spool.PutRejected(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if size, _ := spool.size(); size > 250 {
+		t.Errorf("spool holds %d bytes, want at most 250", size)
+	}
+	if pending, _ := spool.Files(); len(pending) != 1 {
+		t.Errorf("%d pending batches, want the newest kept", len(pending))
+	}
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Cursor is a position in the store: the byte offset of an event line in a
+// segment. A cursor whose segment was compacted since is moved on to the next
+// line; one past the end of its segment has expired.
+type Cursor struct {
+	Segment string // Segment file name, e.g. events-20240501.jsonl (empty = start of the store)
+	Offset  int64
+}
+
+// String encodes the cursor as an opaque token
+func (c Cursor) String() string {
+	if c.Segment == "" {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Segment + ":" + strconv.FormatInt(c.Offset, 10)))
+}
+
+// ParseCursor decodes a cursor token; the empty token is the start of the store
+func ParseCursor(token string) (Cursor, error) {
+	if token == "" {
+		return Cursor{}, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor")
+	}
+	segment, offset, ok := strings.Cut(string(data), ":")
+	n, err := strconv.ParseInt(offset, 10, 64)
+	if !ok || err != nil || n < 0 || segment != filepath.Base(segment) ||
+		!strings.HasPrefix(segment, segmentPrefix) || !strings.HasSuffix(segment, segmentExtension) {
+		return Cursor{}, fmt.Errorf("invalid cursor")
+	}
+	return Cursor{Segment: segment, Offset: n}, nil
+}
+
+// ErrCursorExpired is returned for a cursor past the end of its segment, which
+// was compacted since; the client has to start over
+var ErrCursorExpired = errors.New("cursor expired")
+
+// ScanFrom calls fn for every event at or after the cursor, oldest segment first,
+// with the cursor of the following event and its analyst notes. Returning ErrStop
+// from fn ends the scan. Lines that don't decode are skipped.
+func (s *Store) ScanFrom(cursor Cursor, fn func(event eventlog.EventLogData, next Cursor) error) error {
+	segments, err := s.Segments()
+	if err != nil {
+		return err
+	}
+	notes, err := s.Notes()
+	if err != nil {
+		return err
+	}
+	scan := func(event eventlog.EventLogData, next Cursor) error {
+		notes.Attach(&event)
+		return fn(event, next)
+	}
+
+	for _, segment := range segments {
+		name := filepath.Base(segment)
+		if name < cursor.Segment {
+			continue
+		}
+		offset := int64(0)
+		if name == cursor.Segment {
+			offset = cursor.Offset
+		}
+		stopped, err := scanSegmentFrom(segment, offset, scan)
+		if err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanSegmentFrom decodes the lines of a segment from offset on
+func scanSegmentFrom(segment string, offset int64, fn func(eventlog.EventLogData, Cursor) error) (stopped bool, err error) {
+	file, err := os.Open(segment)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %v", segment, err)
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err != nil {
+		return false, fmt.Errorf("failed to stat %s: %v", segment, err)
+	} else if offset > info.Size() {
+		return false, ErrCursorExpired
+	}
+
+	// An offset that isn't at the start of a line moves on to the next one
+	resync := false
+	if offset > 0 {
+		offset--
+		resync = true
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return false, fmt.Errorf("failed to seek %s: %v", segment, err)
+	}
+
+	name := filepath.Base(segment)
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) > 0 && line[len(line)-1] != '\n' {
+			// A line still being appended is picked up by the next page
+			return false, nil
+		}
+		if err != nil && err != io.EOF {
+			return false, fmt.Errorf("failed to read %s: %v", segment, err)
+		}
+		offset += int64(len(line))
+
+		if resync {
+			// The rest of the line before the cursor
+			resync = false
+		} else if len(strings.TrimSpace(string(line))) > 0 {
+			var event eventlog.EventLogData
+			if json.Unmarshal(line, &event) == nil {
+				if err := fn(event, Cursor{Segment: name, Offset: offset}); err != nil {
+					if err == ErrStop {
+						return true, nil
+					}
+					return false, err
+				}
+			}
+		}
+		if err == io.EOF {
+			return false, nil
+		}
+	}
+}
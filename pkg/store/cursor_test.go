@@ -0,0 +1,68 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+func TestScanFrom(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const name = "events-20240501.jsonl"
+	lines := []string{
+		`{"channel":"Security","record_number":1}` + "\n",
+		`{"channel":"Secu` + "\n", // Cut short by a crash
+		`{"channel":"Security","record_number":2}` + "\n",
+		`{"channel":"Security","record_number":3}` + "\n",
+	}
+	var data string
+	for _, line := range lines {
+		data += line
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	third := int64(len(lines[0]) + len(lines[1]))
+
+	tests := []struct {
+		name    string
+		offset  int64
+		records []uint32
+		err     error
+	}{
+		{"start of the store", 0, []uint32{1, 2, 3}, nil},
+		{"start of a line", third, []uint32{2, 3}, nil},
+		{"middle of a line after compaction", third + 5, []uint32{3}, nil},
+		{"end of the segment", int64(len(data)), nil, nil},
+		{"segment shrank", int64(len(data)) + 1, nil, ErrCursorExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var records []uint32
+			cursor := Cursor{Segment: name, Offset: tt.offset}
+			err := s.ScanFrom(cursor, func(event eventlog.EventLogData, next Cursor) error {
+				records = append(records, event.RecordNumber)
+				return nil
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ScanFrom = %v, want %v", err, tt.err)
+			}
+			if len(records) != len(tt.records) {
+				t.Fatalf("records %v, want %v", records, tt.records)
+			}
+			for i := range records {
+				if records[i] != tt.records[i] {
+					t.Errorf("records %v, want %v", records, tt.records)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package store
+
+import (
+	"bufio"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// indexExtension names the full-text index kept next to each segment
+const indexExtension = ".idx"
+
+// minTokenLength drops one-character tokens, which only bloat the index
+const minTokenLength = 2
+
+// segmentIndex is the inverted index of one segment: every token maps to the byte
+// offsets of the lines containing it, in file order
+type segmentIndex struct {
+	Size     int64 // Number of segment bytes covered by the index
+	Postings map[string][]int64
+}
+
+// Tokenize splits text into lowercase search tokens (runs of letters and digits)
+func Tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]bool, len(fields))
+	tokens := fields[:0]
+	for _, field := range fields {
+		if len([]rune(field)) < minTokenLength || seen[field] {
+			continue
+		}
+		seen[field] = true
+		tokens = append(tokens, field)
+	}
+	return tokens
+}
+
+// eventTokens returns the searchable tokens of an event: insertion strings, source,
+// computer, channel, event ID, detections and tag values
+func eventTokens(event eventlog.EventLogData) []string {
+	var b strings.Builder
+	for _, s := range event.Strings {
+		b.WriteString(s)
+		b.WriteByte(' ')
+	}
+	b.WriteString(event.SourceName + " " + event.ComputerName + " " + event.Channel + " ")
+	b.WriteString(strconv.FormatUint(uint64(event.EventID), 10) + " ")
+	for _, d := range event.Detections {
+		b.WriteString(d + " ")
+	}
+	for _, v := range event.Tags {
+		b.WriteString(v + " ")
+	}
+	return Tokenize(b.String())
+}
+
+// MatchTerms reports whether an event contains every search term. A term ending in
+// "*" matches any token with that prefix.
+func MatchTerms(event eventlog.EventLogData, terms []string) bool {
+	tokens := eventTokens(event)
+	for _, term := range terms {
+		found := false
+		for _, token := range tokens {
+			if matchToken(term, token) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matchToken compares a search term with an indexed token
+func matchToken(term, token string) bool {
+	if prefix, ok := strings.CutSuffix(term, "*"); ok {
+		return strings.HasPrefix(token, prefix)
+	}
+	return term == token
+}
+
+// SearchTerms normalizes a search string into terms, keeping trailing "*" wildcards
+func SearchTerms(search string) []string {
+	var terms []string
+	for _, word := range strings.Fields(search) {
+		wildcard := strings.HasSuffix(word, "*")
+		terms = append(terms, Tokenize(word)...)
+		if wildcard && len(terms) > 0 {
+			terms[len(terms)-1] += "*"
+		}
+	}
+	return terms
+}
+
+// indexPath returns the index file of a segment
+func indexPath(segment string) string {
+	return strings.TrimSuffix(segment, segmentExtension) + indexExtension
+}
+
+// loadIndex reads the index of a segment and brings it up to date. Segments are
+// append-only, so only lines written after the last indexing pass are tokenized.
+func loadIndex(segment string) (*segmentIndex, error) {
+	info, err := os.Stat(segment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", segment, err)
+	}
+
+	idx := &segmentIndex{Postings: map[string][]int64{}}
+	if file, err := os.Open(indexPath(segment)); err == nil {
+		var loaded segmentIndex
+		if gob.NewDecoder(file).Decode(&loaded) == nil && loaded.Size <= info.Size() && loaded.Postings != nil {
+			idx = &loaded
+		}
+		file.Close()
+	}
+	if idx.Size == info.Size() {
+		return idx, nil
+	}
+
+	if err := idx.update(segment); err != nil {
+		return nil, err
+	}
+	if err := idx.save(indexPath(segment)); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// update indexes the lines of a segment after idx.Size
+func (idx *segmentIndex) update(segment string) error {
+	file, err := os.Open(segment)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", segment, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(idx.Size, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek %s: %v", segment, err)
+	}
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	offset := idx.Size
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// A partially written last line is indexed on the next pass
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", segment, err)
+		}
+
+		var event eventlog.EventLogData
+		if json.Unmarshal(line, &event) == nil {
+			for _, token := range eventTokens(event) {
+				idx.Postings[token] = append(idx.Postings[token], offset)
+			}
+		}
+		offset += int64(len(line))
+	}
+	idx.Size = offset
+
+	return nil
+}
+
+// save writes the index atomically
+func (idx *segmentIndex) save(path string) error {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to write index %s: %v", path, err)
+	}
+	if err := gob.NewEncoder(file).Encode(idx); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to encode index %s: %v", path, err)
+	}
+	file.Close()
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to commit index %s: %v", path, err)
+	}
+	return nil
+}
+
+// lookup returns the sorted offsets of the lines containing every term
+func (idx *segmentIndex) lookup(terms []string) []int64 {
+	var result []int64
+	for i, term := range terms {
+		var postings []int64
+		if prefix, ok := strings.CutSuffix(term, "*"); ok {
+			set := map[int64]bool{}
+			for token, offsets := range idx.Postings {
+				if strings.HasPrefix(token, prefix) {
+					for _, offset := range offsets {
+						set[offset] = true
+					}
+				}
+			}
+			for offset := range set {
+				postings = append(postings, offset)
+			}
+			sort.Slice(postings, func(a, b int) bool { return postings[a] < postings[b] })
+		} else {
+			postings = idx.Postings[term]
+		}
+
+		if i == 0 {
+			result = append([]int64(nil), postings...)
+		} else {
+			result = intersect(result, postings)
+		}
+		if len(result) == 0 {
+			return nil
+		}
+	}
+	return result
+}
+
+// intersect returns the offsets present in both sorted lists
+func intersect(a, b []int64) []int64 {
+	var out []int64
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// Search calls fn for every event of the store containing all terms (see SearchTerms),
+// oldest segment first. Indexes are built or extended on demand.
+func (s *Store) Search(terms []string, fn func(eventlog.EventLogData) error) error {
+	segments, err := s.Segments()
+	if err != nil {
+		return err
+	}
+
+	for _, segment := range segments {
+		idx, err := loadIndex(segment)
+		if err != nil {
+			return err
+		}
+		offsets := idx.lookup(terms)
+		if len(offsets) == 0 {
+			continue
+		}
+
+		stopped, err := readAt(segment, offsets, fn)
+		if err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+// readAt decodes the lines starting at the given offsets and passes them to fn
+func readAt(segment string, offsets []int64, fn func(eventlog.EventLogData) error) (stopped bool, err error) {
+	file, err := os.Open(segment)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %v", segment, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for _, offset := range offsets {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return false, fmt.Errorf("failed to seek %s: %v", segment, err)
+		}
+		reader.Reset(file)
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return false, fmt.Errorf("failed to read %s: %v", segment, err)
+		}
+
+		var event eventlog.EventLogData
+		if err := json.Unmarshal(line, &event); err != nil {
+			return false, fmt.Errorf("%s@%d: invalid event: %v", segment, offset, err)
+		}
+		if err := fn(event); err != nil {
+			if err == ErrStop {
+				return true, nil
+			}
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// SearchPath searches a store directory through its indexes, or scans a single JSONL
+// file for the terms
+func SearchPath(path string, terms []string, fn func(eventlog.EventLogData) error) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	if !info.IsDir() {
+		return ScanFile(path, func(event eventlog.EventLogData) error {
+			if !MatchTerms(event, terms) {
+				return nil
+			}
+			return fn(event)
+		})
+	}
+
+	s := &Store{dir: path}
+	fn, err = withNotes(path, fn)
+	if err != nil {
+		return err
+	}
+	return s.Search(terms, fn)
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// notesFile holds the analyst notes of a store, one JSON record per line, so
+// several analysts can annotate a shared collection without rewriting segments
+const notesFile = "notes.jsonl"
+
+// noteRecord is a line of the notes file: a note on the event with the stable ID UID
+type noteRecord struct {
+	UID string `json:"uid"`
+	eventlog.Note
+}
+
+// Notes are the analyst notes of a store by event UID, oldest first
+type Notes map[string][]eventlog.Note
+
+// AddNote attaches labels and free text to the event with the stable ID uid. The
+// time is set to now when zero.
+func (s *Store) AddNote(uid string, note eventlog.Note) error {
+	if uid == "" {
+		return fmt.Errorf("a note needs the UID of an event")
+	}
+	note.Labels = normalizeLabels(note.Labels)
+	note.Text = strings.TrimSpace(note.Text)
+	if len(note.Labels) == 0 && note.Text == "" {
+		return fmt.Errorf("a note needs labels or text")
+	}
+	if note.Time.IsZero() {
+		note.Time = s.now().UTC()
+	}
+	line, err := json.Marshal(noteRecord{UID: uid, Note: note})
+	if err != nil {
+		return fmt.Errorf("failed to encode note: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := filepath.Join(s.dir, notesFile)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open notes file %s: %v", path, err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write notes file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Notes returns the notes of the store; a store without notes has none
+func (s *Store) Notes() (Notes, error) {
+	return loadNotes(s.dir)
+}
+
+// loadNotes reads the notes file of the store in dir
+func loadNotes(dir string) (Notes, error) {
+	path := filepath.Join(dir, notesFile)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return Notes{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open notes file %s: %v", path, err)
+	}
+	defer file.Close()
+
+	notes := Notes{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var record noteRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid note: %v", path, lineNumber, err)
+		}
+		notes[record.UID] = append(notes[record.UID], record.Note)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return notes, nil
+}
+
+// Attach adds the notes of an event to it
+func (n Notes) Attach(event *eventlog.EventLogData) {
+	if event.UID == "" {
+		return
+	}
+	if notes := n[event.UID]; len(notes) > 0 {
+		event.Notes = append(event.Notes, notes...)
+	}
+}
+
+// withNotes wraps a scan callback of the store in dir so every event carries its notes
+func withNotes(dir string, fn func(eventlog.EventLogData) error) (func(eventlog.EventLogData) error, error) {
+	notes, err := loadNotes(dir)
+	if err != nil || len(notes) == 0 {
+		return fn, err
+	}
+	return func(event eventlog.EventLogData) error {
+		notes.Attach(&event)
+		return fn(event)
+	}, nil
+}
+
+// normalizeLabels lowercases and trims labels, dropping empty ones and duplicates
+func normalizeLabels(labels []string) []string {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, label := range labels {
+		label = strings.ToLower(strings.TrimSpace(label))
+		if label != "" && !seen[label] {
+			seen[label] = true
+			normalized = append(normalized, label)
+		}
+	}
+	return normalized
+}
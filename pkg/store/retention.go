@@ -0,0 +1,245 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Retention bounds the store's footprint. Whole daily segments are removed, so
+// limits are applied with a granularity of one day.
+type Retention struct {
+	MaxAge   time.Duration // Segments older than this are removed (0 = keep forever)
+	MaxBytes int64         // Oldest segments are removed until the store fits (0 = unlimited)
+}
+
+// Enabled reports whether any retention limit is set
+func (r Retention) Enabled() bool {
+	return r.MaxAge > 0 || r.MaxBytes > 0
+}
+
+// PruneResult describes what a prune or vacuum pass removed
+type PruneResult struct {
+	Removed       []string // Segment files removed
+	FreedBytes    int64
+	RemainingSize int64
+	DroppedLines  int // Unreadable lines dropped by vacuum
+}
+
+// segmentDate returns the day a segment was written, from its file name
+func segmentDate(segment string) (time.Time, bool) {
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(segment), segmentPrefix), segmentExtension)
+	day, err := time.ParseInLocation("20060102", name, time.Local)
+	return day, err == nil
+}
+
+// Prune removes segments outside the retention policy, oldest first. The current
+// day's segment is never removed, even when it alone exceeds MaxBytes. With dryRun
+// set, nothing is deleted and the result describes what would be removed.
+func (s *Store) Prune(policy Retention, dryRun bool) (*PruneResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	segments, err := s.Segments()
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make([]int64, len(segments))
+	var total int64
+	for i, segment := range segments {
+		info, err := os.Stat(segment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %v", segment, err)
+		}
+		sizes[i] = info.Size()
+		if idxInfo, err := os.Stat(indexPath(segment)); err == nil {
+			sizes[i] += idxInfo.Size()
+		}
+		total += sizes[i]
+	}
+
+	now := s.now()
+	today := now.Format("20060102")
+	result := &PruneResult{}
+	for i, segment := range segments {
+		if strings.Contains(filepath.Base(segment), today) {
+			break
+		}
+
+		expired := false
+		if policy.MaxAge > 0 {
+			if day, ok := segmentDate(segment); ok && now.Sub(day.AddDate(0, 0, 1)) > policy.MaxAge {
+				expired = true
+			}
+		}
+		oversize := policy.MaxBytes > 0 && total > policy.MaxBytes
+		if !expired && !oversize {
+			break
+		}
+
+		if !dryRun {
+			if err := os.Remove(segment); err != nil {
+				return result, fmt.Errorf("failed to remove %s: %v", segment, err)
+			}
+			os.Remove(indexPath(segment))
+		}
+		result.Removed = append(result.Removed, segment)
+		result.FreedBytes += sizes[i]
+		total -= sizes[i]
+	}
+	result.RemainingSize = total
+
+	return result, nil
+}
+
+// Vacuum compacts the store: leftover temporary and orphaned index files are removed,
+// and segments are rewritten without unreadable lines (for example a record cut
+// short by a crash), after which their indexes are rebuilt on the next search.
+// Like Prune, it leaves the current day's segment alone, as a follow-mode run in
+// another process may be appending to it; a trailing line without its newline is
+// kept as it is.
+func (s *Store) Vacuum() (*PruneResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store directory %s: %v", s.dir, err)
+	}
+
+	today := s.now().Format("20060102")
+	result := &PruneResult{}
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(s.dir, name)
+		if entry.IsDir() || !strings.HasPrefix(name, segmentPrefix) {
+			continue
+		}
+
+		// A temporary file of the current day may be another process's index build
+		orphanIndex := strings.HasSuffix(name, indexExtension) && !fileExists(strings.TrimSuffix(path, indexExtension)+segmentExtension)
+		if (strings.HasSuffix(name, ".tmp") && !strings.Contains(name, today)) || orphanIndex {
+			if info, err := entry.Info(); err == nil {
+				result.FreedBytes += info.Size()
+			}
+			if err := os.Remove(path); err != nil {
+				return result, fmt.Errorf("failed to remove %s: %v", path, err)
+			}
+			result.Removed = append(result.Removed, path)
+		}
+	}
+
+	segments, err := s.Segments()
+	if err != nil {
+		return result, err
+	}
+	for _, segment := range segments {
+		if !strings.Contains(filepath.Base(segment), today) {
+			dropped, freed, err := compactSegment(segment)
+			if err != nil {
+				return result, err
+			}
+			result.DroppedLines += dropped
+			result.FreedBytes += freed
+		}
+
+		info, err := os.Stat(segment)
+		if err == nil {
+			result.RemainingSize += info.Size()
+		}
+	}
+
+	return result, nil
+}
+
+// compactSegment rewrites a segment without its unreadable lines, streaming it
+// through a temporary file that then replaces it
+func compactSegment(segment string) (dropped int, freed int64, err error) {
+	// A first pass finds out whether there is anything to drop at all
+	dropped, _, err = copyReadable(segment, io.Discard)
+	if err != nil || dropped == 0 {
+		return 0, 0, err
+	}
+	info, err := os.Stat(segment)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to stat %s: %v", segment, err)
+	}
+
+	tmpPath := segment + ".tmp"
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to write %s: %v", tmpPath, err)
+	}
+	w := bufio.NewWriterSize(out, 64*1024)
+	dropped, written, err := copyReadable(segment, w)
+	if err == nil {
+		if err = w.Flush(); err != nil {
+			err = fmt.Errorf("failed to write %s: %v", tmpPath, err)
+		}
+	}
+	if closeErr := out.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write %s: %v", tmpPath, closeErr)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return 0, 0, err
+	}
+
+	if err := os.Rename(tmpPath, segment); err != nil {
+		os.Remove(tmpPath)
+		return 0, 0, fmt.Errorf("failed to replace %s: %v", segment, err)
+	}
+	// Offsets changed, so the index has to be rebuilt from scratch
+	os.Remove(indexPath(segment))
+
+	return dropped, max(info.Size()-written, 0), nil
+}
+
+// copyReadable copies the lines of a segment that decode as events to w and
+// returns how many lines it dropped and how many bytes it wrote. A trailing line
+// without its newline is copied as it is, since it may still be being written.
+func copyReadable(segment string, w io.Writer) (dropped int, written int64, err error) {
+	file, err := os.Open(segment)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open %s: %v", segment, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return 0, 0, fmt.Errorf("failed to read %s: %v", segment, readErr)
+		}
+		partial := readErr == io.EOF
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var event eventlog.EventLogData
+			if partial || json.Unmarshal(line, &event) == nil {
+				n, err := w.Write(line)
+				written += int64(n)
+				if err != nil {
+					return 0, 0, fmt.Errorf("failed to copy %s: %v", segment, err)
+				}
+			} else {
+				dropped++
+			}
+		}
+		if partial {
+			return dropped, written, nil
+		}
+	}
+}
+
+// fileExists reports whether path exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
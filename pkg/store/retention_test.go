@@ -0,0 +1,54 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVacuum(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return time.Date(2024, 5, 2, 12, 0, 0, 0, time.Local) }
+
+	const event = `{"channel":"Security","record_number":1}` + "\n"
+	segments := map[string]string{
+		// A past segment with a line cut short by a crash and another one at its end
+		"events-20240501.jsonl": event + `{"channel":"Secu` + "\n" + event + `{"channel":`,
+		// Today's segment, still being appended to by a follow-mode run
+		"events-20240502.jsonl": event + `{"channel":"Secu` + "\n" + `{"chan`,
+	}
+	for name, data := range segments {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := s.Vacuum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.DroppedLines != 1 {
+		t.Errorf("dropped %d lines, want 1", result.DroppedLines)
+	}
+	want := map[string]string{
+		"events-20240501.jsonl": event + event + `{"channel":`,
+		"events-20240502.jsonl": segments["events-20240502.jsonl"],
+	}
+	for name, data := range want {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Errorf("%s = %q, want %q", name, got, data)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "events-20240501.jsonl.tmp")); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// segmentPrefix and segmentExtension name the daily JSONL files of a store
+const (
+	segmentPrefix    = "events-"
+	segmentExtension = ".jsonl"
+)
+
+// maxLineSize bounds a single JSONL record when reading (large script blocks)
+const maxLineSize = 16 << 20
+
+// Store is the local event store: a directory of daily JSONL segment files
+// (events-YYYYMMDD.jsonl), one event per line
+type Store struct {
+	dir string
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+// Open opens (creating if needed) the store in dir
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create store directory %s: %v", dir, err)
+	}
+	return &Store{dir: dir, now: time.Now}, nil
+}
+
+// Dir returns the store directory
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Append writes events to the current day's segment
+func (s *Store) Append(events []eventlog.EventLogData) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := filepath.Join(s.dir, segmentPrefix+s.now().Format("20060102")+segmentExtension)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open store segment %s: %v", path, err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return fmt.Errorf("failed to encode event %d: %v", event.RecordNumber, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write store segment %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// Segments returns the segment files of the store, oldest first
+func (s *Store) Segments() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store directory %s: %v", s.dir, err)
+	}
+
+	var segments []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentExtension) {
+			continue
+		}
+		segments = append(segments, filepath.Join(s.dir, name))
+	}
+	sort.Strings(segments)
+
+	return segments, nil
+}
+
+// Scan calls fn for every event in the store, oldest segment first
+func (s *Store) Scan(fn func(eventlog.EventLogData) error) error {
+	return ScanPath(s.dir, fn)
+}
+
+// ScanFile calls fn for every event in a JSONL file; returning ErrStop from fn ends the scan early
+func ScanFile(path string, fn func(eventlog.EventLogData) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		var event eventlog.EventLogData
+		if err := json.Unmarshal(line, &event); err != nil {
+			return fmt.Errorf("%s:%d: invalid event: %v", path, lineNumber, err)
+		}
+		if err := fn(event); err != nil {
+			if err == ErrStop {
+				return nil
+			}
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// ErrStop can be returned by a scan callback to stop scanning without an error
+var ErrStop = errors.New("stop scan")
+
+// ScanPath scans either a single JSONL file or a store directory, whose events
+// carry their analyst notes
+func ScanPath(path string, fn func(eventlog.EventLogData) error) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	if !info.IsDir() {
+		return ScanFile(path, fn)
+	}
+
+	s := &Store{dir: path, now: time.Now}
+	segments, err := s.Segments()
+	if err != nil {
+		return err
+	}
+	if fn, err = withNotes(path, fn); err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		stopped := false
+		err := ScanFile(segment, func(event eventlog.EventLogData) error {
+			err := fn(event)
+			if err == ErrStop {
+				stopped = true
+			}
+			return err
+		})
+		if err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
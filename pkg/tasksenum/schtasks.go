@@ -0,0 +1,86 @@
+package tasksenum
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// schtasksTimeout bounds a schtasks query, which can hang on unreachable hosts
+const schtasksTimeout = 2 * time.Minute
+
+// listSchtasks asks the Task Scheduler service for the task definitions with
+// schtasks /query /xml ONE, which works where the Tasks folder can't be read, e.g.
+// on remote hosts without admin share access
+func listSchtasks(server string) ([]Task, error) {
+	args := []string{"/query", "/xml", "ONE"}
+	if server != "" {
+		args = append(args, "/s", strings.TrimPrefix(server, `\\`))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), schtasksTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "schtasks.exe", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("query timed out")
+		}
+		return nil, fmt.Errorf("query failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseSchtasks(stdout.Bytes(), server)
+}
+
+// parseSchtasks reads the output of schtasks /query /xml ONE: a <Tasks> document
+// with every <Task> definition preceded by a comment holding the task's name
+func parseSchtasks(data []byte, server string) ([]Task, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(toUTF8(data)))
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	var tasks []Task
+	hashes := map[string]string{}
+	name := ""
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return tasks, fmt.Errorf("failed to parse schtasks output: %v", err)
+		}
+		switch token := token.(type) {
+		case xml.Comment:
+			name = strings.TrimSpace(string(token))
+		case xml.StartElement:
+			if token.Name.Local != "Task" {
+				continue
+			}
+			var definition taskXML
+			if err := decoder.DecodeElement(&definition, &token); err != nil {
+				return tasks, fmt.Errorf("failed to parse task %s: %v", name, err)
+			}
+			task := newTask(definition, server, hashes)
+			if task.Name == "" {
+				task.Name = name
+			}
+			task.XML = taskDocument(definition.Inner)
+			tasks = append(tasks, task)
+			name = ""
+		}
+	}
+	return tasks, nil
+}
+
+// taskDocument rebuilds a standalone definition, like the files of TasksFolder,
+// from the content of a Task element
+func taskDocument(inner string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<Task version="1.2" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">` + inner + "</Task>\n"
+}
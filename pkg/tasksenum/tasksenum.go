@@ -0,0 +1,323 @@
+// Package tasksenum enumerates the scheduled tasks of a computer with what they
+// run, when they run and who registered them, a common persistence mechanism
+package tasksenum
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"lemita/datn/pkg/filesenum"
+)
+
+// TasksFolder holds the XML definitions of the registered scheduled tasks
+const TasksFolder = `C:\Windows\System32\Tasks`
+
+// Sources a task list was read from
+const (
+	SourceFolder   = "folder"   // The XML files of TasksFolder
+	SourceSchtasks = "schtasks" // schtasks /query /xml, which goes through the Task Scheduler service
+)
+
+// Task is a registered scheduled task
+type Task struct {
+	Name        string    `json:"name"` // Task path, e.g. \Microsoft\Windows\Defrag\ScheduledDefrag
+	Author      string    `json:"author,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Registered  string    `json:"registered,omitempty"` // Registration date as written in the definition
+	RunAs       string    `json:"run_as,omitempty"`     // User or group the task runs as
+	RunLevel    string    `json:"run_level,omitempty"`  // HighestAvailable for elevated tasks
+	Enabled     bool      `json:"enabled"`
+	Hidden      bool      `json:"hidden,omitempty"`
+	Actions     []Action  `json:"actions"`
+	Triggers    []Trigger `json:"triggers,omitempty"`
+	XML         string    `json:"xml,omitempty"` // Full definition, as UTF-8
+}
+
+// Action is something a task does: run a program, or call a COM handler
+type Action struct {
+	Command    string `json:"command,omitempty"` // Program as written in the definition
+	Arguments  string `json:"arguments,omitempty"`
+	WorkingDir string `json:"working_dir,omitempty"`
+	Binary     string `json:"binary,omitempty"` // Command with environment variables expanded and bare names found in System32
+	Hash       string `json:"sha256,omitempty"` // SHA-256 of Binary, or filesenum.UnavailableHash
+	ClassID    string `json:"class_id,omitempty"`
+}
+
+// Trigger is a condition that starts a task
+type Trigger struct {
+	Type    string `json:"type"` // Boot, Logon, Time, Calendar, Idle, Event, Registration, SessionStateChange, ...
+	Enabled bool   `json:"enabled"`
+	Start   string `json:"start,omitempty"`   // StartBoundary of time based triggers
+	Detail  string `json:"detail,omitempty"`  // Schedule, user or event query of the trigger
+	Repeats string `json:"repeats,omitempty"` // Repetition interval, e.g. PT5M
+}
+
+// taskXML is the part of a task definition kept in Task
+type taskXML struct {
+	URI         string `xml:"RegistrationInfo>URI"`
+	Author      string `xml:"RegistrationInfo>Author"`
+	Description string `xml:"RegistrationInfo>Description"`
+	Date        string `xml:"RegistrationInfo>Date"`
+	Principals  []struct {
+		UserID   string `xml:"UserId"`
+		GroupID  string `xml:"GroupId"`
+		RunLevel string `xml:"RunLevel"`
+	} `xml:"Principals>Principal"`
+	Enabled string `xml:"Settings>Enabled"`
+	Hidden  string `xml:"Settings>Hidden"`
+	Exec    []struct {
+		Command    string `xml:"Command"`
+		Arguments  string `xml:"Arguments"`
+		WorkingDir string `xml:"WorkingDirectory"`
+	} `xml:"Actions>Exec"`
+	ComHandler []struct {
+		ClassID string `xml:"ClassId"`
+	} `xml:"Actions>ComHandler"`
+	Triggers struct {
+		Any []triggerXML `xml:",any"`
+	} `xml:"Triggers"`
+	Inner string `xml:",innerxml"` // Content of the Task element, for definitions read from schtasks
+}
+
+// triggerXML is any trigger element; the element name is the trigger type
+type triggerXML struct {
+	XMLName       xml.Name
+	Enabled       string `xml:"Enabled"`
+	StartBoundary string `xml:"StartBoundary"`
+	UserID        string `xml:"UserId"`
+	Delay         string `xml:"Delay"`
+	Subscription  string `xml:"Subscription"`
+	StateChange   string `xml:"StateChange"`
+	Interval      string `xml:"Repetition>Interval"`
+	ScheduleByDay *struct {
+		DaysInterval string `xml:"DaysInterval"`
+	} `xml:"ScheduleByDay"`
+	ScheduleByWeek *struct {
+		WeeksInterval string `xml:"WeeksInterval"`
+		DaysOfWeek    struct {
+			Days []struct {
+				XMLName xml.Name
+			} `xml:",any"`
+		} `xml:"DaysOfWeek"`
+	} `xml:"ScheduleByWeek"`
+	ScheduleByMonth *struct{} `xml:"ScheduleByMonth"`
+}
+
+// ListOn lists the scheduled tasks of a computer (empty = local) and the SHA-256
+// of the programs they run. Definitions are read from TasksFolder, through the
+// admin share when remote; when the folder can't be read, schtasks asks the Task
+// Scheduler service instead. The source used is returned with the tasks.
+func ListOn(server string) ([]Task, string, error) {
+	tasks, err := listFolder(server)
+	if err == nil {
+		return tasks, SourceFolder, nil
+	}
+	tasks, schtasksErr := listSchtasks(server)
+	if schtasksErr != nil {
+		return nil, "", fmt.Errorf("%v; schtasks: %v", err, schtasksErr)
+	}
+	return tasks, SourceSchtasks, nil
+}
+
+// ListProgramsOn lists the programs started by the scheduled tasks of a computer
+// (empty = local) with their SHA-256, one entry per Exec action, for inventories
+// alongside services and autoruns. COM handler actions have no program file and
+// are skipped.
+func ListProgramsOn(server string) ([]filesenum.PEInfo, error) {
+	list, _, err := ListOn(server)
+	var programs []filesenum.PEInfo
+	for _, task := range list {
+		for _, action := range task.Actions {
+			if action.Binary == "" {
+				continue
+			}
+			programs = append(programs, filesenum.PEInfo{
+				FilePath: action.Binary,
+				Hash:     action.Hash,
+				Name:     task.Name,
+				Kind:     filesenum.KindTask,
+				Location: TasksFolder,
+				TaskXML:  task.XML,
+			})
+		}
+	}
+	return programs, err
+}
+
+// listFolder reads the task definitions of TasksFolder
+func listFolder(server string) ([]Task, error) {
+	root := filesenum.AdminSharePath(server, TasksFolder)
+	if _, err := os.Stat(root); err != nil {
+		return nil, fmt.Errorf("failed to open tasks folder: %v", err)
+	}
+
+	var tasks []Task
+	hashes := map[string]string{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Folders of other users' tasks may be unreadable
+			if d != nil && d.IsDir() && path != root {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Warning: Could not read task %s: %v\n", path, err)
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		task, err := parseTask(data, `\`+rel, server, hashes)
+		if err != nil {
+			fmt.Printf("Warning: Could not parse task %s: %v\n", path, err)
+			return nil
+		}
+		tasks = append(tasks, task)
+		return nil
+	})
+	if err != nil {
+		return tasks, fmt.Errorf("failed to list scheduled tasks: %v", err)
+	}
+	return tasks, nil
+}
+
+// parseTask decodes a task definition; name is used when the definition has no
+// URI. Task files are usually UTF-16 with a byte order mark, which encoding/xml
+// doesn't read, so they are converted to UTF-8 first.
+func parseTask(data []byte, name, server string, hashes map[string]string) (Task, error) {
+	data = toUTF8(data)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// The declaration may still say UTF-16, but the content is UTF-8 by now
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	var definition taskXML
+	if err := decoder.Decode(&definition); err != nil {
+		return Task{}, err
+	}
+	task := newTask(definition, server, hashes)
+	if task.Name == "" {
+		task.Name = name
+	}
+	task.XML = string(data)
+	return task, nil
+}
+
+// toUTF8 converts a UTF-16 little endian document with a byte order mark to UTF-8
+// and drops a UTF-8 byte order mark
+func toUTF8(data []byte) []byte {
+	if len(data) >= 2 && data[0] == 0xFF && data[1] == 0xFE {
+		units := make([]uint16, (len(data)-2)/2)
+		for i := range units {
+			units[i] = uint16(data[2+2*i]) | uint16(data[3+2*i])<<8
+		}
+		data = []byte(string(utf16.Decode(units)))
+	}
+	return bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+}
+
+// newTask converts a decoded definition, hashing the programs of its Exec actions
+func newTask(definition taskXML, server string, hashes map[string]string) Task {
+	task := Task{
+		Name:        definition.URI,
+		Author:      strings.TrimSpace(definition.Author),
+		Description: strings.TrimSpace(definition.Description),
+		Registered:  definition.Date,
+		Enabled:     !strings.EqualFold(definition.Enabled, "false"),
+		Hidden:      strings.EqualFold(definition.Hidden, "true"),
+		Actions:     []Action{},
+	}
+	if len(definition.Principals) > 0 {
+		principal := definition.Principals[0]
+		task.RunAs = principal.UserID
+		if task.RunAs == "" {
+			task.RunAs = principal.GroupID
+		}
+		task.RunLevel = principal.RunLevel
+	}
+	for _, exec := range definition.Exec {
+		command := strings.Trim(strings.TrimSpace(exec.Command), `"`)
+		if command == "" {
+			continue
+		}
+		binary := filesenum.ResolveCommand(`"` + command + `"`)
+		task.Actions = append(task.Actions, Action{
+			Command:    command,
+			Arguments:  strings.TrimSpace(exec.Arguments),
+			WorkingDir: exec.WorkingDir,
+			Binary:     binary,
+			Hash:       filesenum.HashProgram(server, hashes, binary),
+		})
+	}
+	for _, handler := range definition.ComHandler {
+		task.Actions = append(task.Actions, Action{ClassID: handler.ClassID})
+	}
+	for _, trigger := range definition.Triggers.Any {
+		task.Triggers = append(task.Triggers, newTrigger(trigger))
+	}
+	return task
+}
+
+// newTrigger summarizes a trigger element
+func newTrigger(t triggerXML) Trigger {
+	trigger := Trigger{
+		Type:    strings.TrimSuffix(t.XMLName.Local, "Trigger"),
+		Enabled: !strings.EqualFold(t.Enabled, "false"),
+		Start:   t.StartBoundary,
+		Repeats: t.Interval,
+	}
+	var details []string
+	switch {
+	case t.ScheduleByDay != nil:
+		details = append(details, "every "+orOne(t.ScheduleByDay.DaysInterval)+" day(s)")
+	case t.ScheduleByWeek != nil:
+		var days []string
+		for _, day := range t.ScheduleByWeek.DaysOfWeek.Days {
+			days = append(days, day.XMLName.Local)
+		}
+		details = append(details, fmt.Sprintf("every %s week(s) on %s", orOne(t.ScheduleByWeek.WeeksInterval), strings.Join(days, ", ")))
+	case t.ScheduleByMonth != nil:
+		details = append(details, "monthly")
+	}
+	if t.UserID != "" {
+		details = append(details, "user "+t.UserID)
+	}
+	if t.StateChange != "" {
+		details = append(details, t.StateChange)
+	}
+	if t.Delay != "" {
+		details = append(details, "delay "+t.Delay)
+	}
+	if t.Subscription != "" {
+		details = append(details, strings.Join(strings.Fields(t.Subscription), " "))
+	}
+	trigger.Detail = strings.Join(details, "; ")
+	return trigger
+}
+
+// orOne returns an interval of a schedule, which is 1 when left out
+func orOne(interval string) string {
+	if interval == "" {
+		return "1"
+	}
+	return interval
+}
+
+// Sort orders tasks by name, case-insensitively, as Task Scheduler lists them
+func Sort(tasks []Task) {
+	sort.Slice(tasks, func(i, j int) bool {
+		return strings.ToLower(tasks[i].Name) < strings.ToLower(tasks[j].Name)
+	})
+}
@@ -0,0 +1,435 @@
+// Package telemetry instruments the collector with OpenTelemetry spans and
+// counters and exports them to an OTLP/HTTP endpoint (the /v1/traces and
+// /v1/metrics JSON encoding), so a fleet of collectors can be watched in an
+// existing telemetry stack without linking the OpenTelemetry SDK.
+package telemetry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the counters recorded by the collector
+const (
+	EventsCollected = "datn.events.collected" // Events read, by channel
+	Detections      = "datn.detections"       // Detection rule matches, by rule
+	SinkErrors      = "datn.sink.errors"      // Failed sink writes, by channel
+	ChannelErrors   = "datn.channel.errors"   // Failed channel reads, by channel
+)
+
+// counterUnits are the units of the counters, in UCUM annotation syntax
+var counterUnits = map[string]string{
+	EventsCollected: "{event}",
+	Detections:      "{match}",
+	SinkErrors:      "{error}",
+	ChannelErrors:   "{error}",
+}
+
+// scopeName identifies the instrumentation in exported data
+const scopeName = "lemita/datn"
+
+// DefaultInterval is how often buffered spans and counters are exported
+const DefaultInterval = 30 * time.Second
+
+// maxSpans bounds the spans buffered between exports while the endpoint is
+// unreachable; older spans are dropped first
+const maxSpans = 10000
+
+// Options configures the exporter
+type Options struct {
+	Endpoint string            // Base URL of the OTLP/HTTP receiver, e.g. http://otel-collector:4318
+	Headers  map[string]string // Extra request headers, such as an API key
+	Interval time.Duration     // Export interval (0 = DefaultInterval)
+	Timeout  time.Duration     // Per-request timeout (0 = 10s)
+	Resource map[string]string // Resource attributes: service.name, host.name, ...
+}
+
+// Telemetry buffers spans and accumulates counters until they are exported
+type Telemetry struct {
+	opts    Options
+	client  *http.Client
+	started time.Time // Start of the cumulative counters
+
+	mu       sync.Mutex
+	spans    []*Span
+	dropped  int
+	counters map[counterKey]int64
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// counterKey identifies a counter series: a name with one attribute
+type counterKey struct {
+	name, attrKey, attrValue string
+}
+
+// New starts an exporter that sends the buffered telemetry every interval
+func New(opts Options) (*Telemetry, error) {
+	if !strings.HasPrefix(opts.Endpoint, "http://") && !strings.HasPrefix(opts.Endpoint, "https://") {
+		return nil, fmt.Errorf("OTLP endpoint %q must be an http:// or https:// URL", opts.Endpoint)
+	}
+	opts.Endpoint = strings.TrimSuffix(opts.Endpoint, "/")
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	t := &Telemetry{
+		opts:     opts,
+		client:   &http.Client{Timeout: opts.Timeout},
+		started:  time.Now(),
+		counters: map[counterKey]int64{},
+		stop:     make(chan struct{}),
+	}
+	t.stopped.Add(1)
+	go func() {
+		defer t.stopped.Done()
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.Flush()
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+	return t, nil
+}
+
+// Add increments a counter of the series with one attribute, e.g.
+// Add(EventsCollected, 12, "channel", "Security")
+func (t *Telemetry) Add(name string, n int, attrKey, attrValue string) {
+	if t == nil || n == 0 {
+		return
+	}
+	t.mu.Lock()
+	t.counters[counterKey{name, attrKey, attrValue}] += int64(n)
+	t.mu.Unlock()
+}
+
+// Span is a timed operation, such as the collection of one channel
+type Span struct {
+	t        *Telemetry
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    map[string]any
+	err      error
+}
+
+// StartSpan starts a span, in a new trace unless parent is set
+func (t *Telemetry) StartSpan(name string, parent *Span) *Span {
+	if t == nil {
+		return nil
+	}
+	s := &Span{t: t, spanID: randomID(8), name: name, start: time.Now(), attrs: map[string]any{}}
+	if parent != nil {
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	} else {
+		s.traceID = randomID(16)
+	}
+	return s
+}
+
+// SetAttribute records a string, int or bool attribute of the span
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.attrs[key] = value
+}
+
+// SetError marks the span as failed; the last error is kept
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.err = err
+}
+
+// End ends the span and queues it for export
+func (s *Span) End() {
+	if s == nil || !s.end.IsZero() {
+		return
+	}
+	s.end = time.Now()
+	t := s.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.spans) >= maxSpans {
+		t.spans = t.spans[1:]
+		t.dropped++
+	}
+	t.spans = append(t.spans, s)
+}
+
+// Flush exports the buffered spans and the current counter values. Spans that
+// could not be sent are kept for the next export.
+func (t *Telemetry) Flush() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	counters := make(map[counterKey]int64, len(t.counters))
+	for key, n := range t.counters {
+		counters[key] = n
+	}
+	t.mu.Unlock()
+
+	var errs []string
+	if len(spans) > 0 {
+		if err := t.post("/v1/traces", t.traces(spans)); err != nil {
+			errs = append(errs, err.Error())
+			t.mu.Lock()
+			t.spans = append(spans, t.spans...)
+			if extra := len(t.spans) - maxSpans; extra > 0 {
+				t.spans = t.spans[extra:]
+				t.dropped += extra
+			}
+			t.mu.Unlock()
+		}
+	}
+	if len(counters) > 0 {
+		if err := t.post("/v1/metrics", t.metrics(counters)); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to export telemetry: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Dropped returns the number of spans dropped because the buffer was full
+func (t *Telemetry) Dropped() int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
+
+// Close stops the periodic export and exports what is left
+func (t *Telemetry) Close() error {
+	if t == nil {
+		return nil
+	}
+	close(t.stop)
+	t.stopped.Wait()
+	return t.Flush()
+}
+
+// post sends an OTLP/HTTP JSON request
+func (t *Telemetry) post(path string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %v", path, err)
+	}
+	req, err := http.NewRequest(http.MethodPost, t.opts.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.opts.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %v", req.URL, err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("request to %s returned %s", req.URL, resp.Status)
+	}
+	return nil
+}
+
+// randomID returns a random trace or span ID of n bytes in hex
+func randomID(n int) string {
+	id := make([]byte, n)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// The subset of the OTLP JSON encoding written by Telemetry. 64-bit integers are
+// strings, as the protobuf JSON mapping requires.
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID      string     `json:"traceId"`
+	SpanID       string     `json:"spanId"`
+	ParentSpanID string     `json:"parentSpanId,omitempty"`
+	Name         string     `json:"name"`
+	Kind         int        `json:"kind"`
+	Start        string     `json:"startTimeUnixNano"`
+	End          string     `json:"endTimeUnixNano"`
+	Attributes   []keyValue `json:"attributes,omitempty"`
+	Status       spanStatus `json:"status"`
+}
+
+type spanStatus struct {
+	Code    int    `json:"code"` // 0 unset, 1 ok, 2 error
+	Message string `json:"message,omitempty"`
+}
+
+type dataPoint struct {
+	Attributes []keyValue `json:"attributes,omitempty"`
+	Start      string     `json:"startTimeUnixNano"`
+	Time       string     `json:"timeUnixNano"`
+	AsInt      string     `json:"asInt"`
+}
+
+type otlpMetric struct {
+	Name string `json:"name"`
+	Unit string `json:"unit,omitempty"`
+	Sum  struct {
+		DataPoints  []dataPoint `json:"dataPoints"`
+		Temporality int         `json:"aggregationTemporality"` // 2 is cumulative
+		Monotonic   bool        `json:"isMonotonic"`
+	} `json:"sum"`
+}
+
+// attribute converts a string, int or bool to an OTLP attribute
+func attribute(key string, value any) keyValue {
+	var v anyValue
+	switch value := value.(type) {
+	case int:
+		s := strconv.Itoa(value)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	case bool:
+		v.BoolValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+	return keyValue{Key: key, Value: v}
+}
+
+// resource returns the resource attributes in a stable order
+func (t *Telemetry) resource() resource {
+	keys := make([]string, 0, len(t.opts.Resource))
+	for key := range t.opts.Resource {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	r := resource{Attributes: []keyValue{}}
+	for _, key := range keys {
+		r.Attributes = append(r.Attributes, attribute(key, t.opts.Resource[key]))
+	}
+	return r
+}
+
+// unixNano renders a time in the OTLP encoding
+func unixNano(at time.Time) string {
+	return strconv.FormatInt(at.UnixNano(), 10)
+}
+
+// traces builds an ExportTraceServiceRequest
+func (t *Telemetry) traces(spans []*Span) any {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:      s.traceID,
+			SpanID:       s.spanID,
+			ParentSpanID: s.parentID,
+			Name:         s.name,
+			Kind:         1, // Internal
+			Start:        unixNano(s.start),
+			End:          unixNano(s.end),
+			Status:       spanStatus{Code: 1},
+		}
+		keys := make([]string, 0, len(s.attrs))
+		for key := range s.attrs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			span.Attributes = append(span.Attributes, attribute(key, s.attrs[key]))
+		}
+		if s.err != nil {
+			span.Status = spanStatus{Code: 2, Message: s.err.Error()}
+		}
+		encoded = append(encoded, span)
+	}
+	return map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource":   t.resource(),
+			"scopeSpans": []any{map[string]any{"scope": scope{Name: scopeName}, "spans": encoded}},
+		}},
+	}
+}
+
+// metrics builds an ExportMetricsServiceRequest with the cumulative counters
+func (t *Telemetry) metrics(counters map[counterKey]int64) any {
+	now := time.Now()
+	byName := map[string]*otlpMetric{}
+	var names []string
+	for key, n := range counters {
+		metric, ok := byName[key.name]
+		if !ok {
+			metric = &otlpMetric{Name: key.name, Unit: counterUnits[key.name]}
+			metric.Sum.Temporality = 2
+			metric.Sum.Monotonic = true
+			byName[key.name] = metric
+			names = append(names, key.name)
+		}
+		point := dataPoint{Start: unixNano(t.started), Time: unixNano(now), AsInt: strconv.FormatInt(n, 10)}
+		if key.attrKey != "" {
+			point.Attributes = []keyValue{attribute(key.attrKey, key.attrValue)}
+		}
+		metric.Sum.DataPoints = append(metric.Sum.DataPoints, point)
+	}
+	sort.Strings(names)
+	metrics := make([]*otlpMetric, 0, len(names))
+	for _, name := range names {
+		metrics = append(metrics, byName[name])
+	}
+	return map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource":     t.resource(),
+			"scopeMetrics": []any{map[string]any{"scope": scope{Name: scopeName}, "metrics": metrics}},
+		}},
+	}
+}
@@ -0,0 +1,132 @@
+package triage
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// ManifestFile is the archive entry listing every other entry and its SHA-256
+const ManifestFile = "manifest.json"
+
+// Manifest describes the contents of a triage archive
+type Manifest struct {
+	Host     HostInfo               `json:"host"`
+	Case     *eventlog.Case         `json:"case,omitempty"`
+	Started  time.Time              `json:"started"`
+	Duration time.Duration          `json:"duration"`
+	Files    map[string]string      `json:"files"`             // SHA-256 by entry name
+	Exports  []eventlog.ExportCheck `json:"exports,omitempty"` // Verification of the .evtx exports
+	Errors   []string               `json:"errors,omitempty"`  // Parts that could not be collected
+}
+
+// Archive writes a triage ZIP, hashing every entry for the manifest
+type Archive struct {
+	file     *os.File
+	zip      *zip.Writer
+	manifest Manifest
+	current  string    // Entry being written
+	hash     hash.Hash // Hash of the current entry
+}
+
+// Create starts an archive at path
+func Create(path string, host HostInfo) (*Archive, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	return &Archive{
+		file:     file,
+		zip:      zip.NewWriter(file),
+		manifest: Manifest{Host: host, Started: time.Now(), Files: make(map[string]string)},
+	}, nil
+}
+
+// Create starts a new entry; the previous entry is complete once this is called
+func (a *Archive) Create(name string) (io.Writer, error) {
+	a.finishEntry()
+	w, err := a.zip.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add %s: %v", name, err)
+	}
+	a.current, a.hash = name, sha256.New()
+	return io.MultiWriter(w, a.hash), nil
+}
+
+// AddJSON adds an entry holding v as indented JSON
+func (a *Archive) AddJSON(name string, v any) error {
+	w, err := a.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	return nil
+}
+
+// AddFile adds an entry holding the contents of the file at path
+func (a *Archive) AddFile(name, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+	w, err := a.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, file); err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	return nil
+}
+
+// AddExport records the verification of an .evtx export in the manifest
+func (a *Archive) AddExport(check eventlog.ExportCheck) {
+	a.manifest.Exports = append(a.manifest.Exports, check)
+}
+
+// SetCase records the incident the triage belongs to in the manifest
+func (a *Archive) SetCase(c *eventlog.Case) {
+	a.manifest.Case = c
+}
+
+// Fail records a part of the triage that could not be collected
+func (a *Archive) Fail(format string, args ...any) {
+	a.manifest.Errors = append(a.manifest.Errors, fmt.Sprintf(format, args...))
+}
+
+// finishEntry records the hash of the entry being written
+func (a *Archive) finishEntry() {
+	if a.current != "" {
+		a.manifest.Files[a.current] = hex.EncodeToString(a.hash.Sum(nil))
+		a.current = ""
+	}
+}
+
+// Close writes the manifest and closes the archive
+func (a *Archive) Close() (Manifest, error) {
+	a.finishEntry()
+	a.manifest.Duration = time.Since(a.manifest.Started)
+	manifest := a.manifest
+	err := a.AddJSON(ManifestFile, manifest)
+	a.current = ""
+	if closeErr := a.zip.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to finish archive: %v", closeErr)
+	}
+	if closeErr := a.file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to close archive: %v", closeErr)
+	}
+	return manifest, err
+}
@@ -0,0 +1,126 @@
+package triage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	iphlpapi            = syscall.NewLazyDLL("iphlpapi.dll")
+	getExtendedTcpTable = iphlpapi.NewProc("GetExtendedTcpTable")
+)
+
+const (
+	AF_INET                 = 2
+	AF_INET6                = 23
+	TCP_TABLE_OWNER_PID_ALL = 5
+)
+
+// MIB_TCPROW_OWNER_PID is one IPv4 row of TCP_TABLE_OWNER_PID_ALL
+type MIB_TCPROW_OWNER_PID struct {
+	State      uint32
+	LocalAddr  [4]byte
+	LocalPort  uint32
+	RemoteAddr [4]byte
+	RemotePort uint32
+	OwningPid  uint32
+}
+
+// MIB_TCP6ROW_OWNER_PID is one IPv6 row of TCP_TABLE_OWNER_PID_ALL
+type MIB_TCP6ROW_OWNER_PID struct {
+	LocalAddr     [16]byte
+	LocalScopeId  uint32
+	LocalPort     uint32
+	RemoteAddr    [16]byte
+	RemoteScopeId uint32
+	RemotePort    uint32
+	State         uint32
+	OwningPid     uint32
+}
+
+// tcpStates names the MIB_TCP_STATE values
+var tcpStates = map[uint32]string{
+	1: "CLOSED", 2: "LISTEN", 3: "SYN_SENT", 4: "SYN_RCVD", 5: "ESTABLISHED", 6: "FIN_WAIT1",
+	7: "FIN_WAIT2", 8: "CLOSE_WAIT", 9: "CLOSING", 10: "LAST_ACK", 11: "TIME_WAIT", 12: "DELETE_TCB",
+}
+
+// Connection is a TCP endpoint and the process that owns it
+type Connection struct {
+	Local  string `json:"local"`
+	Remote string `json:"remote,omitempty"` // Empty for listening sockets
+	State  string `json:"state"`
+	PID    uint32 `json:"pid"`
+}
+
+// ListConnections returns the IPv4 and IPv6 TCP connections and listeners
+func ListConnections() ([]Connection, error) {
+	var connections []Connection
+	for _, family := range []uintptr{AF_INET, AF_INET6} {
+		table, err := tcpTable(family)
+		if err != nil {
+			return connections, err
+		}
+		if len(table) < 4 {
+			continue
+		}
+
+		count := int(binary.LittleEndian.Uint32(table))
+		rows := unsafe.Pointer(&table[4])
+		for i := 0; i < count; i++ {
+			var connection Connection
+			if family == AF_INET {
+				row := (*MIB_TCPROW_OWNER_PID)(unsafe.Add(rows, i*int(unsafe.Sizeof(MIB_TCPROW_OWNER_PID{}))))
+				connection = newConnection(row.LocalAddr[:], row.LocalPort, row.RemoteAddr[:], row.RemotePort, row.State, row.OwningPid)
+			} else {
+				row := (*MIB_TCP6ROW_OWNER_PID)(unsafe.Add(rows, i*int(unsafe.Sizeof(MIB_TCP6ROW_OWNER_PID{}))))
+				connection = newConnection(row.LocalAddr[:], row.LocalPort, row.RemoteAddr[:], row.RemotePort, row.State, row.OwningPid)
+			}
+			connections = append(connections, connection)
+		}
+	}
+	return connections, nil
+}
+
+// tcpTable returns the raw TCP_TABLE_OWNER_PID_ALL table of an address family
+func tcpTable(family uintptr) ([]byte, error) {
+	var size uint32
+	getExtendedTcpTable.Call(0, uintptr(unsafe.Pointer(&size)), 0, family, TCP_TABLE_OWNER_PID_ALL, 0)
+	for {
+		table := make([]byte, size)
+		var first uintptr
+		if size > 0 {
+			first = uintptr(unsafe.Pointer(&table[0]))
+		}
+		ret, _, _ := getExtendedTcpTable.Call(first, uintptr(unsafe.Pointer(&size)), 0, family, TCP_TABLE_OWNER_PID_ALL, 0)
+		switch syscall.Errno(ret) {
+		case 0:
+			return table, nil
+		case syscall.ERROR_INSUFFICIENT_BUFFER:
+			continue // The table grew between the calls
+		default:
+			return nil, fmt.Errorf("failed to read the TCP table: %v", syscall.Errno(ret))
+		}
+	}
+}
+
+// newConnection converts a table row; ports are in network byte order in the low 16 bits
+func newConnection(local []byte, localPort uint32, remote []byte, remotePort uint32, state, pid uint32) Connection {
+	connection := Connection{
+		Local: endpoint(local, localPort),
+		State: tcpStates[state],
+		PID:   pid,
+	}
+	if state != 2 { // LISTEN
+		connection.Remote = endpoint(remote, remotePort)
+	}
+	return connection
+}
+
+// endpoint formats an address and a network byte order port
+func endpoint(addr []byte, port uint32) string {
+	p := uint16(port&0xff)<<8 | uint16(port>>8&0xff)
+	return net.JoinHostPort(net.IP(append([]byte(nil), addr...)).String(), fmt.Sprint(p))
+}
@@ -0,0 +1,69 @@
+package triage
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// HostInfo identifies the computer a triage archive was taken from
+type HostInfo struct {
+	Computer  string    `json:"computer"`
+	DNSName   string    `json:"dns_name,omitempty"`
+	OSVersion string    `json:"os_version"` // e.g. 10.0.19045
+	BootTime  time.Time `json:"boot_time"`
+	Time      time.Time `json:"time"`     // Local clock when the archive was taken
+	TimeZone  string    `json:"timezone"` // e.g. SE Asia Standard Time (UTC+07:00)
+	User      string    `json:"user"`     // Account the collector ran as
+	Admin     bool      `json:"admin"`    // Whether the collector ran elevated
+	Collector string    `json:"collector_version"`
+}
+
+// GetHostInfo describes the local computer
+func GetHostInfo() HostInfo {
+	now := time.Now()
+	version := windows.RtlGetVersion()
+	info := HostInfo{
+		Computer:  eventlog.GetLocalComputerName(),
+		OSVersion: fmt.Sprintf("%d.%d.%d", version.MajorVersion, version.MinorVersion, version.BuildNumber),
+		BootTime:  now.Add(-time.Duration(windows.DurationSinceBoot())).Truncate(time.Second),
+		Time:      now,
+		Admin:     windows.GetCurrentProcessToken().IsElevated(),
+		Collector: eventlog.CollectorVersion,
+	}
+
+	buffer := make([]uint16, 256)
+	size := uint32(len(buffer))
+	if windows.GetComputerNameEx(windows.ComputerNameDnsFullyQualified, &buffer[0], &size) == nil {
+		info.DNSName = windows.UTF16ToString(buffer[:size])
+	}
+
+	name, offset := now.Zone()
+	var tzi windows.Timezoneinformation
+	if _, err := windows.GetTimeZoneInformation(&tzi); err == nil {
+		name = windows.UTF16ToString(tzi.StandardName[:])
+	}
+	info.TimeZone = fmt.Sprintf("%s (UTC%+03d:%02d)", name, offset/3600, abs(offset%3600)/60)
+
+	if user, err := windows.GetCurrentProcessToken().GetTokenUser(); err == nil {
+		if account, domain, _, err := user.User.Sid.LookupAccount(""); err == nil {
+			info.User = domain + `\` + account
+		}
+	}
+	if info.User == "" {
+		info.User = os.Getenv("USERNAME")
+	}
+	return info
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
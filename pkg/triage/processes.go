@@ -0,0 +1,94 @@
+package triage
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+
+	"lemita/datn/pkg/filesenum"
+)
+
+// Process is a running process of the computer
+type Process struct {
+	PID       uint32 `json:"pid"`
+	ParentPID uint32 `json:"parent_pid"`
+	Name      string `json:"name"`
+	Path      string `json:"path,omitempty"` // Empty when the process can't be opened (protected processes)
+	Hash      string `json:"sha256,omitempty"`
+	User      string `json:"user,omitempty"`
+	SessionID uint32 `json:"session_id"`
+	Threads   uint32 `json:"threads"`
+}
+
+// ListProcesses returns the running processes with the path, SHA-256 and account
+// of every process that can be opened
+func ListProcesses() ([]Process, error) {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot processes: %v", err)
+	}
+	defer windows.CloseHandle(snapshot)
+
+	var entry windows.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	if err := windows.Process32First(snapshot, &entry); err != nil {
+		return nil, fmt.Errorf("failed to read the first process: %v", err)
+	}
+
+	var processes []Process
+	hashes := make(map[string]string)
+	for {
+		process := Process{
+			PID:       entry.ProcessID,
+			ParentPID: entry.ParentProcessID,
+			Name:      windows.UTF16ToString(entry.ExeFile[:]),
+			Threads:   entry.Threads,
+		}
+		windows.ProcessIdToSessionId(process.PID, &process.SessionID)
+		describeProcess(&process)
+		if process.Path != "" {
+			if _, ok := hashes[process.Path]; !ok {
+				_, hashes[process.Path], _ = filesenum.HashFile("", process.Path)
+			}
+			process.Hash = hashes[process.Path]
+		}
+		processes = append(processes, process)
+
+		if err := windows.Process32Next(snapshot, &entry); err != nil {
+			if err == syscall.ERROR_NO_MORE_FILES {
+				return processes, nil
+			}
+			return processes, fmt.Errorf("failed to read the next process: %v", err)
+		}
+	}
+}
+
+// describeProcess fills in the image path and account of a process
+func describeProcess(process *Process) {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, process.PID)
+	if err != nil {
+		return
+	}
+	defer windows.CloseHandle(handle)
+
+	buffer := make([]uint16, windows.MAX_LONG_PATH)
+	size := uint32(len(buffer))
+	if windows.QueryFullProcessImageName(handle, 0, &buffer[0], &size) == nil {
+		process.Path = windows.UTF16ToString(buffer[:size])
+	}
+
+	var token windows.Token
+	if windows.OpenProcessToken(handle, windows.TOKEN_QUERY, &token) != nil {
+		return
+	}
+	defer token.Close()
+	if user, err := token.GetTokenUser(); err == nil {
+		if account, domain, _, err := user.User.Sid.LookupAccount(""); err == nil {
+			process.User = domain + `\` + account
+		} else {
+			process.User = user.User.Sid.String()
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package trigger
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/autoruns"
+	"lemita/datn/pkg/eventlog"
+	"lemita/datn/pkg/filesenum"
+	"lemita/datn/pkg/filter"
+	"lemita/datn/pkg/tasksenum"
+)
+
+// Actions a trigger can run. Snapshot actions take no argument; file actions
+// name the event field holding the path, as in "hash:ImagePath".
+const (
+	ActionServices = "services" // Snapshot services and their binary hashes
+	ActionTasks    = "tasks"    // Snapshot scheduled tasks
+	ActionAutoruns = "autoruns" // Snapshot Run keys and startup folders
+	ActionCOM      = "com"      // Snapshot COM servers in user-writable folders
+	ActionIFEO     = "ifeo"     // Snapshot IFEO debuggers
+	ActionHash     = "hash"     // SHA-256 of the file named by a field
+	ActionStreams  = "streams"  // Alternate data streams of the file named by a field
+)
+
+// snapshots maps the snapshot actions to their filesenum collectors
+var snapshots = map[string]func(string) ([]filesenum.PEInfo, error){
+	ActionServices: filesenum.ListServicesOn,
+	ActionTasks:    tasksenum.ListProgramsOn,
+	ActionAutoruns: autoruns.ListInventoryOn,
+	ActionCOM:      filesenum.ListCOMHijacksOn,
+	ActionIFEO:     filesenum.ListIFEODebuggersOn,
+}
+
+// DefaultOutput is the JSONL file trigger results are appended to
+const DefaultOutput = "datn-triggers.jsonl"
+
+// Action is one step of a trigger
+type Action struct {
+	Kind  string // One of the Action constants
+	Field string // Event field holding a path, for ActionHash and ActionStreams
+}
+
+// String returns the action as written in the triggers file
+func (a Action) String() string {
+	if a.Field == "" {
+		return a.Kind
+	}
+	return a.Kind + ":" + a.Field
+}
+
+// Trigger runs its actions for every event matching its expression
+type Trigger struct {
+	Name    string
+	Expr    *filter.Expression
+	Actions []Action
+}
+
+// parseAction parses "kind" or "kind:Field"
+func parseAction(source string) (Action, error) {
+	kind, field, _ := strings.Cut(strings.TrimSpace(source), ":")
+	action := Action{Kind: strings.ToLower(strings.TrimSpace(kind)), Field: strings.TrimSpace(field)}
+	switch {
+	case snapshots[action.Kind] != nil:
+		if action.Field != "" {
+			return action, fmt.Errorf("action %s takes no field", action.Kind)
+		}
+	case action.Kind == ActionHash, action.Kind == ActionStreams:
+		if action.Field == "" {
+			return action, fmt.Errorf("action %s needs a field, e.g. %s:ImagePath", action.Kind, action.Kind)
+		}
+	default:
+		return action, fmt.Errorf("unknown action %q", source)
+	}
+	return action, nil
+}
+
+// Load reads triggers from a file with one "name: expression => action, action"
+// per line, for example
+//
+//	new-service: event.channel == "System" && event.id == 7045 => services, hash:ImagePath
+//
+// Blank lines and lines starting with # are ignored.
+func Load(path string) ([]Trigger, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open triggers file %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var triggers []Trigger
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, rest, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		split := strings.LastIndex(rest, "=>")
+		if !ok || name == "" || split < 0 {
+			return nil, fmt.Errorf("%s:%d: expected \"name: expression => actions\"", path, lineNumber)
+		}
+
+		expr, err := filter.Compile(strings.TrimSpace(rest[:split]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNumber, err)
+		}
+		trigger := Trigger{Name: name, Expr: expr}
+		for _, source := range strings.Split(rest[split+2:], ",") {
+			action, err := parseAction(source)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, lineNumber, err)
+			}
+			trigger.Actions = append(trigger.Actions, action)
+		}
+		triggers = append(triggers, trigger)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read triggers file %s: %v", path, err)
+	}
+
+	return triggers, nil
+}
+
+// Result is what one action collected, written as a line of the output file
+type Result struct {
+	Time         time.Time          `json:"time"`
+	Trigger      string             `json:"trigger"`
+	Action       string             `json:"action"`
+	Host         string             `json:"host,omitempty"` // Empty for the local computer
+	Channel      string             `json:"channel"`
+	EventID      uint32             `json:"event_id"`
+	RecordNumber uint32             `json:"record_number"`
+	Path         string             `json:"path,omitempty"`
+	SHA256       string             `json:"sha256,omitempty"`
+	Streams      []filesenum.Stream `json:"streams,omitempty"`
+	Items        []filesenum.PEInfo `json:"items,omitempty"` // Snapshot entries
+	Error        string             `json:"error,omitempty"`
+}
+
+// String summarizes a result for the report
+func (r Result) String() string {
+	var detail string
+	switch {
+	case r.Error != "":
+		detail = "failed: " + r.Error
+	case r.Items != nil:
+		detail = fmt.Sprintf("%d entries", len(r.Items))
+	case r.Action == ActionStreams || strings.HasPrefix(r.Action, ActionStreams+":"):
+		detail = fmt.Sprintf("%s has %d alternate data streams", r.Path, len(r.Streams))
+	default:
+		detail = fmt.Sprintf("%s sha256 %s", r.Path, r.SHA256)
+	}
+	return fmt.Sprintf("Trigger %s on %s %d (record %d): %s %s", r.Trigger, r.Channel, r.EventID, r.RecordNumber, r.Action, detail)
+}
+
+// Runner runs triggers against collected events and appends the results to a file
+type Runner struct {
+	triggers []Trigger
+	file     *os.File
+	enc      *json.Encoder
+}
+
+// NewRunner opens the output file, appending to any results already there
+func NewRunner(triggers []Trigger, output string) (*Runner, error) {
+	file, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trigger output %s: %v", output, err)
+	}
+	return &Runner{triggers: triggers, file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// Run executes the actions of the triggers matching events of channel on server
+// (empty = local computer). Within one call each snapshot runs at most once and
+// each file is examined once per action, so a burst of events costs one pass.
+func (r *Runner) Run(server, channel string, events []eventlog.EventLogData) ([]Result, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	var results []Result
+	done := make(map[string]bool)
+	for _, event := range events {
+		for _, trigger := range r.triggers {
+			if !trigger.Expr.Match(event) {
+				continue
+			}
+			for _, action := range trigger.Actions {
+				for _, result := range r.run(server, action, event, done) {
+					result.Trigger = trigger.Name
+					result.Host = server
+					result.Channel = channel
+					result.EventID = event.EventID
+					result.RecordNumber = event.RecordNumber
+					results = append(results, result)
+				}
+			}
+		}
+	}
+
+	for _, result := range results {
+		if err := r.enc.Encode(result); err != nil {
+			return results, fmt.Errorf("failed to write trigger result: %v", err)
+		}
+	}
+	return results, nil
+}
+
+// run executes one action for an event, skipping work already done in this pass
+func (r *Runner) run(server string, action Action, event eventlog.EventLogData, done map[string]bool) []Result {
+	if list := snapshots[action.Kind]; list != nil {
+		if done[action.Kind] {
+			return nil
+		}
+		done[action.Kind] = true
+
+		result := Result{Time: time.Now(), Action: action.String()}
+		items, err := list(server)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Items = append([]filesenum.PEInfo{}, items...)
+		}
+		return []Result{result}
+	}
+
+	var results []Result
+	for _, path := range eventPaths(eventlog.NamedData(event.Channel, event)[action.Field]) {
+		key := action.Kind + "\x00" + strings.ToLower(path)
+		if done[key] {
+			continue
+		}
+		done[key] = true
+
+		result := Result{Time: time.Now(), Action: action.String(), Path: path}
+		var err error
+		if action.Kind == ActionHash {
+			result.Path, result.SHA256, err = filesenum.HashFile(server, path)
+		} else {
+			result.Streams, err = filesenum.ListStreams(server, path)
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// eventPaths splits a path field into file paths. Defender lists the resources of
+// a detection separated by semicolons, each with a type prefix such as "file:_".
+func eventPaths(value string) []string {
+	var paths []string
+	for _, part := range strings.Split(value, ";") {
+		if _, path, ok := strings.Cut(part, ":_"); ok {
+			part = path
+		}
+		if part = strings.TrimSpace(part); part != "" {
+			paths = append(paths, part)
+		}
+	}
+	return paths
+}
+
+// Close closes the output file
+func (r *Runner) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,160 @@
+package usb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	usbstorKey       = `SYSTEM\CurrentControlSet\Enum\USBSTOR`
+	mountedDevices   = `SYSTEM\MountedDevices`
+	devicePropsKey   = `Properties\{83da6326-97a6-4088-9453-a1923f573b29}`
+	propInstallDate  = "0064" // DEVPKEY_Device_InstallDate
+	propLastArrival  = "0066" // DEVPKEY_Device_LastArrivalDate
+	propLastRemoval  = "0067" // DEVPKEY_Device_LastRemovalDate
+	dosDevicesPrefix = `\DosDevices\`
+)
+
+// ListDevicesOn returns the USB mass storage devices ever connected to a computer
+// (empty = local), from the USBSTOR and MountedDevices registry keys. The device
+// property timestamps are only readable by SYSTEM; otherwise the last write time of
+// the device key stands in for the last connection.
+func ListDevicesOn(server string) ([]Device, error) {
+	root := registry.LOCAL_MACHINE
+	if server != "" {
+		var err error
+		root, err = registry.OpenRemoteKey(`\\`+strings.TrimPrefix(server, `\\`), registry.LOCAL_MACHINE)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to the registry of %s: %v", server, err)
+		}
+		defer root.Close()
+	}
+
+	usbstor, err := registry.OpenKey(root, usbstorKey, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		if err == registry.ErrNotExist {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open USBSTOR: %v", err)
+	}
+	defer usbstor.Close()
+	classes, err := usbstor.ReadSubKeyNames(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read USBSTOR: %v", err)
+	}
+
+	letters := driveLetters(root)
+	var devices []Device
+	for _, class := range classes {
+		classKey, err := registry.OpenKey(usbstor, class, registry.ENUMERATE_SUB_KEYS)
+		if err != nil {
+			continue
+		}
+		instances, _ := classKey.ReadSubKeyNames(0)
+		classKey.Close()
+
+		for _, instance := range instances {
+			device := newDevice(class, instance)
+			device.Host = server
+			readInstance(usbstor, class+`\`+instance, &device)
+			for letter, target := range letters {
+				if strings.Contains(target, strings.ToLower(`#`+class+`#`+instance+`#`)) {
+					device.DriveLetters = append(device.DriveLetters, letter)
+				}
+			}
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
+// readInstance fills in the friendly name and timestamps of a device instance
+func readInstance(usbstor registry.Key, path string, device *Device) {
+	key, err := registry.OpenKey(usbstor, path, registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return
+	}
+	defer key.Close()
+
+	device.FriendlyName, _, _ = key.GetStringValue("FriendlyName")
+	if info, err := key.Stat(); err == nil {
+		device.LastConnected = info.ModTime().UTC()
+	}
+
+	props, err := registry.OpenKey(key, devicePropsKey, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return
+	}
+	defer props.Close()
+	if t := fileTimeProperty(props, propInstallDate); !t.IsZero() {
+		device.FirstConnected = t
+	}
+	if t := fileTimeProperty(props, propLastArrival); !t.IsZero() {
+		device.LastConnected = t
+	}
+	device.LastRemoved = fileTimeProperty(props, propLastRemoval)
+}
+
+// fileTimeProperty reads a DEVPROP_TYPE_FILETIME device property. Properties are
+// stored with their device property type as the registry value type, which the
+// typed getters reject, so the raw value is decoded.
+func fileTimeProperty(props registry.Key, name string) time.Time {
+	key, err := registry.OpenKey(props, name, registry.QUERY_VALUE)
+	if err != nil {
+		return time.Time{}
+	}
+	defer key.Close()
+
+	buf := make([]byte, 8)
+	n, _, err := key.GetValue("", buf)
+	if err != nil || n != 8 {
+		return time.Time{}
+	}
+	ft := windows.Filetime{
+		LowDateTime:  binary.LittleEndian.Uint32(buf[0:4]),
+		HighDateTime: binary.LittleEndian.Uint32(buf[4:8]),
+	}
+	return time.Unix(0, ft.Nanoseconds()).UTC()
+}
+
+// driveLetters maps the drive letters in MountedDevices to the lowercase device
+// path they were last assigned to, e.g. \??\usbstor#disk&ven_x&prod_y&rev_1.00#serial&0#{guid}
+func driveLetters(root registry.Key) map[string]string {
+	letters := map[string]string{}
+	key, err := registry.OpenKey(root, mountedDevices, registry.QUERY_VALUE)
+	if err != nil {
+		return letters
+	}
+	defer key.Close()
+
+	names, err := key.ReadValueNames(0)
+	if err != nil {
+		return letters
+	}
+	for _, name := range names {
+		if !strings.HasPrefix(name, dosDevicesPrefix) {
+			continue
+		}
+		buf := make([]byte, 1024)
+		n, _, err := key.GetValue(name, buf)
+		if err != nil || n < 2 || n > len(buf) {
+			continue
+		}
+		// Devices without a partition table store a disk signature instead of a path
+		units := make([]uint16, n/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(buf[2*i:])
+		}
+		target := strings.ToLower(syscall.UTF16ToString(units))
+		if strings.Contains(target, "usbstor#") {
+			letters[strings.TrimPrefix(name, dosDevicesPrefix)] = target
+		}
+	}
+	return letters
+}
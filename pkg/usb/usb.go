@@ -0,0 +1,176 @@
+package usb
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// PartitionChannel logs event 1006 whenever a disk arrives or is removed; removals
+// are logged with a capacity of 0
+const (
+	PartitionChannel = "Microsoft-Windows-Partition/Diagnostic"
+	PartitionEventID = 1006
+	busTypeUSB       = "7" // STORAGE_BUS_TYPE BusTypeUsb
+)
+
+// Device is a removable storage device seen on a computer
+type Device struct {
+	Host           string    `json:"host,omitempty"`
+	ID             string    `json:"id"` // USBSTOR class and instance, or the event's model and serial
+	Vendor         string    `json:"vendor,omitempty"`
+	Product        string    `json:"product,omitempty"`
+	Revision       string    `json:"revision,omitempty"`
+	Serial         string    `json:"serial,omitempty"`
+	FriendlyName   string    `json:"friendly_name,omitempty"`
+	FirstConnected time.Time `json:"first_connected,omitempty"`
+	LastConnected  time.Time `json:"last_connected,omitempty"`
+	LastRemoved    time.Time `json:"last_removed,omitempty"`
+	Connections    int       `json:"connections,omitempty"` // Arrivals logged by the Partition channel
+	DriveLetters   []string  `json:"drive_letters,omitempty"`
+}
+
+// newDevice parses a USBSTOR class (Disk&Ven_X&Prod_Y&Rev_Z) and instance ID
+func newDevice(class, instance string) Device {
+	device := Device{ID: class + `\` + instance, Serial: serialOf(instance)}
+	for _, part := range strings.Split(class, "&") {
+		switch {
+		case strings.HasPrefix(part, "Ven_"):
+			device.Vendor = strings.TrimPrefix(part, "Ven_")
+		case strings.HasPrefix(part, "Prod_"):
+			device.Product = strings.TrimPrefix(part, "Prod_")
+		case strings.HasPrefix(part, "Rev_"):
+			device.Revision = strings.TrimPrefix(part, "Rev_")
+		}
+	}
+	return device
+}
+
+// serialOf strips the &N suffix Windows appends to device instance IDs. An
+// instance whose second character is & has no serial number of its own.
+func serialOf(instance string) string {
+	if len(instance) > 1 && instance[1] == '&' {
+		return ""
+	}
+	if i := strings.LastIndex(instance, "&"); i > 0 {
+		return instance[:i]
+	}
+	return instance
+}
+
+// Report merges registry artifacts and Partition events into one list of devices
+// per host
+type Report struct {
+	devices map[string]*Device
+}
+
+// NewReport returns an empty report
+func NewReport() *Report {
+	return &Report{devices: map[string]*Device{}}
+}
+
+// key identifies a device by host and serial, falling back to its ID
+func key(host, serial, id string) string {
+	if serial != "" {
+		return strings.ToLower(host + "|" + serial)
+	}
+	return strings.ToLower(host + "|" + id)
+}
+
+// AddDevices adds devices read from the registry
+func (r *Report) AddDevices(devices []Device) {
+	for _, device := range devices {
+		k := key(device.Host, device.Serial, device.ID)
+		if existing, ok := r.devices[k]; ok {
+			existing.DriveLetters = append(existing.DriveLetters, device.DriveLetters...)
+			existing.merge(device.FirstConnected)
+			existing.merge(device.LastConnected)
+			continue
+		}
+		d := device
+		r.devices[k] = &d
+	}
+}
+
+// AddEvents adds the USB disk arrivals and removals among events; host names the
+// computer they were read from (empty = local)
+func (r *Report) AddEvents(host string, events []eventlog.EventLogData) {
+	for _, event := range events {
+		if !strings.EqualFold(event.Channel, PartitionChannel) || event.EventID != PartitionEventID {
+			continue
+		}
+		data := eventlog.NamedData(event.Channel, event)
+		if bus := data["BusType"]; bus != "" && bus != busTypeUSB {
+			continue
+		}
+		serial := strings.TrimSpace(data["SerialNumber"])
+		model := strings.TrimSpace(data["Manufacturer"] + " " + data["Model"])
+		k := key(host, serial, model)
+		device, ok := r.devices[k]
+		if !ok {
+			device = &Device{
+				Host:     host,
+				ID:       strings.TrimSpace(model + " " + serial),
+				Vendor:   data["Manufacturer"],
+				Product:  data["Model"],
+				Revision: data["Revision"],
+				Serial:   serial,
+			}
+			r.devices[k] = device
+		}
+
+		when := eventlog.EventTime(event.TimeGenerated)
+		if data["Capacity"] == "0" {
+			if when.After(device.LastRemoved) {
+				device.LastRemoved = when
+			}
+			continue
+		}
+		device.Connections++
+		device.merge(when)
+	}
+}
+
+// merge widens the connection window of a device to include t
+func (d *Device) merge(t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	if d.FirstConnected.IsZero() || t.Before(d.FirstConnected) {
+		d.FirstConnected = t
+	}
+	if t.After(d.LastConnected) {
+		d.LastConnected = t
+	}
+}
+
+// Devices returns the devices, most recently connected first
+func (r *Report) Devices() []Device {
+	list := make([]Device, 0, len(r.devices))
+	for _, device := range r.devices {
+		d := *device
+		sort.Strings(d.DriveLetters)
+		d.DriveLetters = compact(d.DriveLetters)
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].LastConnected.Equal(list[j].LastConnected) {
+			return list[i].LastConnected.After(list[j].LastConnected)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// compact removes adjacent duplicates from a sorted list
+func compact(list []string) []string {
+	var out []string
+	for i, s := range list {
+		if i == 0 || s != list[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
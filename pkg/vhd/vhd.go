@@ -0,0 +1,462 @@
+package vhd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	virtdisk                   = syscall.NewLazyDLL("virtdisk.dll")
+	CreateVirtualDisk          = virtdisk.NewProc("CreateVirtualDisk")
+	AttachVirtualDisk          = virtdisk.NewProc("AttachVirtualDisk")
+	DetachVirtualDisk          = virtdisk.NewProc("DetachVirtualDisk")
+	GetVirtualDiskPhysicalPath = virtdisk.NewProc("GetVirtualDiskPhysicalPath")
+	FormatEx                   = syscall.NewLazyDLL("fmifs.dll").NewProc("FormatEx")
+)
+
+// Virtual disk API constants
+const (
+	VIRTUAL_STORAGE_TYPE_DEVICE_VHD                   = 2
+	VIRTUAL_DISK_ACCESS_ALL                           = 0x003f0000
+	CREATE_VIRTUAL_DISK_VERSION_1                     = 1
+	CREATE_VIRTUAL_DISK_FLAG_FULL_PHYSICAL_ALLOCATION = 0x1 // A fixed-size VHD
+	ATTACH_VIRTUAL_DISK_VERSION_1                     = 1
+	ATTACH_VIRTUAL_DISK_FLAG_NO_DRIVE_LETTER          = 0x2
+	DETACH_VIRTUAL_DISK_FLAG_NONE                     = 0
+)
+
+// Disk and volume control codes
+const (
+	IOCTL_DISK_CREATE_DISK               = 0x0007c058
+	IOCTL_DISK_SET_DRIVE_LAYOUT_EX       = 0x0007c054
+	IOCTL_DISK_UPDATE_PROPERTIES         = 0x00070140
+	IOCTL_VOLUME_GET_VOLUME_DISK_EXTENTS = 0x00560000
+	PARTITION_STYLE_MBR                  = 0
+	PARTITION_IFS                        = 0x07 // NTFS
+	FMIFS_HARDDISK                       = 0x0c
+	FCC_DONE                             = 0x0b // FormatEx callback: the format finished
+)
+
+// VIRTUAL_STORAGE_TYPE_VENDOR_MICROSOFT is the vendor of VHD and VHDX disks
+var VIRTUAL_STORAGE_TYPE_VENDOR_MICROSOFT = windows.GUID{Data1: 0xec984aec, Data2: 0xa0f9, Data3: 0x47e9, Data4: [8]byte{0x90, 0x1f, 0x71, 0x41, 0x5a, 0x66, 0x34, 0x5b}}
+
+// Sizing of the disk: room for the file system and the per-file overhead on top of
+// the data, aligned to whole megabytes
+const (
+	megabyte        = 1 << 20
+	minimumSize     = 32 * megabyte
+	partitionOffset = megabyte
+	fileOverhead    = 8 << 10 // A cluster and an MFT record per file
+	sectorSize      = 512
+)
+
+// volumeTimeout bounds the wait for Windows to mount the new partition
+const volumeTimeout = 30 * time.Second
+
+// VolumeLabel is the label of the container's file system
+const VolumeLabel = "DATN"
+
+type virtualStorageType struct {
+	DeviceId uint32
+	VendorId windows.GUID
+}
+
+type createVirtualDiskParameters struct {
+	Version           uint32
+	UniqueId          windows.GUID
+	_                 uint32 // MaximumSize is 8-byte aligned on every architecture
+	MaximumSize       uint64
+	BlockSizeInBytes  uint32
+	SectorSizeInBytes uint32
+	ParentPath        *uint16
+	SourcePath        *uint16
+}
+
+type attachVirtualDiskParameters struct {
+	Version  uint32
+	Reserved uint32
+}
+
+// createDisk is CREATE_DISK for an MBR disk
+type createDisk struct {
+	PartitionStyle uint32
+	Signature      uint32
+	_              [16]byte // Rest of the union with CREATE_DISK_GPT
+}
+
+// partitionInformationEx is PARTITION_INFORMATION_EX of an MBR partition, padded
+// to the size of the GPT variant
+type partitionInformationEx struct {
+	PartitionStyle      uint32
+	_                   uint32
+	StartingOffset      int64
+	PartitionLength     int64
+	PartitionNumber     uint32
+	RewritePartition    byte
+	IsServicePartition  byte
+	_                   [2]byte
+	PartitionType       byte
+	BootIndicator       byte
+	RecognizedPartition byte
+	_                   byte
+	HiddenSectors       uint32
+	PartitionId         windows.GUID
+	_                   [88]byte
+}
+
+// driveLayoutInformationEx is DRIVE_LAYOUT_INFORMATION_EX of an MBR disk, whose
+// partition table always has four entries
+type driveLayoutInformationEx struct {
+	PartitionStyle uint32
+	PartitionCount uint32
+	Signature      uint32
+	CheckSum       uint32
+	_              [32]byte // Rest of the union with DRIVE_LAYOUT_INFORMATION_GPT
+	PartitionEntry [4]partitionInformationEx
+}
+
+// volumeDiskExtents is VOLUME_DISK_EXTENTS of a volume on a single disk
+type volumeDiskExtents struct {
+	NumberOfDiskExtents uint32
+	_                   uint32
+	DiskNumber          uint32
+	_                   uint32
+	StartingOffset      int64
+	ExtentLength        int64
+}
+
+// Container describes a VHD written by Create
+type Container struct {
+	Path   string
+	Size   int64  // Bytes of the virtual disk
+	Files  int    // Files copied into it
+	SHA256 string // Of the VHD file, for the chain of custody
+}
+
+// Create packages the files below dir into a new fixed-size VHD at path: the disk
+// is created through the virtual disk API, partitioned and formatted as NTFS,
+// filled with the files under their relative paths, and detached. A fixed VHD is a
+// raw disk image followed by a footer, so it can be mounted by forensic tools and
+// Windows alike. Creating and attaching disks requires administrator rights.
+func Create(path, dir string) (*Container, error) {
+	var files []string
+	var total int64
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, p)
+		total += info.Size() + fileOverhead
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", dir, err)
+	}
+	// Packaging the run directory into a container inside it would copy a partial VHD
+	if abs, err := filepath.Abs(path); err == nil {
+		if absDir, err := filepath.Abs(dir); err == nil && strings.HasPrefix(strings.ToLower(abs), strings.ToLower(absDir)+`\`) {
+			return nil, fmt.Errorf("the VHD must not be inside %s", dir)
+		}
+	}
+
+	size := max(total+total/8+partitionOffset+16*megabyte, minimumSize)
+	size = (size + megabyte - 1) / megabyte * megabyte
+
+	disk, err := create(path, size)
+	if err != nil {
+		return nil, err
+	}
+	detached := false
+	defer func() {
+		if !detached {
+			DetachVirtualDisk.Call(uintptr(disk), DETACH_VIRTUAL_DISK_FLAG_NONE, 0)
+		}
+		windows.CloseHandle(disk)
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	var diskNumber uint32
+	if diskNumber, err = attach(disk); err != nil {
+		return nil, err
+	}
+	if err = partition(diskNumber, size); err != nil {
+		return nil, err
+	}
+	var volume string
+	if volume, err = findVolume(diskNumber); err != nil {
+		return nil, err
+	}
+	if err = format(volume); err != nil {
+		return nil, err
+	}
+	if err = fill(volume, dir, files); err != nil {
+		return nil, err
+	}
+
+	if ret, _, _ := DetachVirtualDisk.Call(uintptr(disk), DETACH_VIRTUAL_DISK_FLAG_NONE, 0); ret != 0 {
+		err = fmt.Errorf("failed to detach %s: %v", path, syscall.Errno(ret))
+		return nil, err
+	}
+	detached = true
+
+	// The VHD is complete, so a failed hash must not remove it
+	hash, hashErr := hashFile(path)
+	if hashErr != nil {
+		return nil, hashErr
+	}
+	return &Container{Path: path, Size: size, Files: len(files), SHA256: hash}, nil
+}
+
+// create creates the fixed-size VHD file and returns its handle
+func create(path string, size int64) (windows.Handle, error) {
+	pathUTF16, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, fmt.Errorf("invalid VHD path %s: %v", path, err)
+	}
+	storageType := virtualStorageType{DeviceId: VIRTUAL_STORAGE_TYPE_DEVICE_VHD, VendorId: VIRTUAL_STORAGE_TYPE_VENDOR_MICROSOFT}
+	parameters := createVirtualDiskParameters{
+		Version:           CREATE_VIRTUAL_DISK_VERSION_1,
+		MaximumSize:       uint64(size),
+		SectorSizeInBytes: sectorSize,
+	}
+	var disk windows.Handle
+	ret, _, _ := CreateVirtualDisk.Call(
+		uintptr(unsafe.Pointer(&storageType)),
+		uintptr(unsafe.Pointer(pathUTF16)),
+		VIRTUAL_DISK_ACCESS_ALL,
+		0,
+		CREATE_VIRTUAL_DISK_FLAG_FULL_PHYSICAL_ALLOCATION,
+		0,
+		uintptr(unsafe.Pointer(&parameters)),
+		0,
+		uintptr(unsafe.Pointer(&disk)),
+	)
+	if ret != 0 {
+		return 0, fmt.Errorf("failed to create %s: %v", path, syscall.Errno(ret))
+	}
+	return disk, nil
+}
+
+// attach attaches the disk without a drive letter, for the lifetime of its handle,
+// and returns its disk number
+func attach(disk windows.Handle) (uint32, error) {
+	parameters := attachVirtualDiskParameters{Version: ATTACH_VIRTUAL_DISK_VERSION_1}
+	ret, _, _ := AttachVirtualDisk.Call(uintptr(disk), 0, ATTACH_VIRTUAL_DISK_FLAG_NO_DRIVE_LETTER, 0, uintptr(unsafe.Pointer(&parameters)), 0)
+	if ret != 0 {
+		return 0, fmt.Errorf("failed to attach the VHD: %v", syscall.Errno(ret))
+	}
+
+	buffer := make([]uint16, windows.MAX_PATH)
+	size := uint32(len(buffer) * 2)
+	ret, _, _ = GetVirtualDiskPhysicalPath.Call(uintptr(disk), uintptr(unsafe.Pointer(&size)), uintptr(unsafe.Pointer(&buffer[0])))
+	if ret != 0 {
+		return 0, fmt.Errorf("failed to get the disk of the VHD: %v", syscall.Errno(ret))
+	}
+	// \\.\PhysicalDriveN
+	physical := syscall.UTF16ToString(buffer)
+	number, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(physical), `\\.\physicaldrive`), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected disk path %s", physical)
+	}
+	return uint32(number), nil
+}
+
+// partition writes an MBR with a single partition spanning the disk
+func partition(diskNumber uint32, size int64) error {
+	name, _ := syscall.UTF16PtrFromString(fmt.Sprintf(`\\.\PhysicalDrive%d`, diskNumber))
+	disk, err := windows.CreateFile(name, windows.GENERIC_READ|windows.GENERIC_WRITE, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open disk %d: %v", diskNumber, err)
+	}
+	defer windows.CloseHandle(disk)
+
+	var returned uint32
+	signature := uint32(time.Now().UnixNano())
+	create := createDisk{PartitionStyle: PARTITION_STYLE_MBR, Signature: signature}
+	if err := windows.DeviceIoControl(disk, IOCTL_DISK_CREATE_DISK, (*byte)(unsafe.Pointer(&create)), uint32(unsafe.Sizeof(create)), nil, 0, &returned, nil); err != nil {
+		return fmt.Errorf("failed to initialize disk %d: %v", diskNumber, err)
+	}
+
+	layout := driveLayoutInformationEx{PartitionStyle: PARTITION_STYLE_MBR, PartitionCount: 4, Signature: signature}
+	layout.PartitionEntry[0] = partitionInformationEx{
+		PartitionStyle:      PARTITION_STYLE_MBR,
+		StartingOffset:      partitionOffset,
+		PartitionLength:     size - partitionOffset,
+		PartitionNumber:     1,
+		RewritePartition:    1,
+		PartitionType:       PARTITION_IFS,
+		RecognizedPartition: 1,
+		HiddenSectors:       partitionOffset / sectorSize,
+	}
+	for i := 1; i < len(layout.PartitionEntry); i++ {
+		layout.PartitionEntry[i] = partitionInformationEx{PartitionStyle: PARTITION_STYLE_MBR, RewritePartition: 1}
+	}
+	if err := windows.DeviceIoControl(disk, IOCTL_DISK_SET_DRIVE_LAYOUT_EX, (*byte)(unsafe.Pointer(&layout)), uint32(unsafe.Sizeof(layout)), nil, 0, &returned, nil); err != nil {
+		return fmt.Errorf("failed to partition disk %d: %v", diskNumber, err)
+	}
+	if err := windows.DeviceIoControl(disk, IOCTL_DISK_UPDATE_PROPERTIES, nil, 0, nil, 0, &returned, nil); err != nil {
+		return fmt.Errorf("failed to update disk %d: %v", diskNumber, err)
+	}
+	return nil
+}
+
+// findVolume waits for the volume of the new partition to arrive and returns its
+// \\?\Volume{GUID}\ name
+func findVolume(diskNumber uint32) (string, error) {
+	deadline := time.Now().Add(volumeTimeout)
+	for {
+		if volume, ok := volumeOnDisk(diskNumber); ok {
+			return volume, nil
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("no volume appeared on disk %d within %v", diskNumber, volumeTimeout)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// volumeOnDisk returns the volume on a disk, if Windows has mounted one
+func volumeOnDisk(diskNumber uint32) (string, bool) {
+	buffer := make([]uint16, windows.MAX_PATH)
+	find, err := windows.FindFirstVolume(&buffer[0], uint32(len(buffer)))
+	if err != nil {
+		return "", false
+	}
+	defer windows.FindVolumeClose(find)
+	for {
+		volume := syscall.UTF16ToString(buffer)
+		if volumeDisk(volume) == int64(diskNumber) {
+			return volume, true
+		}
+		if err := windows.FindNextVolume(find, &buffer[0], uint32(len(buffer))); err != nil {
+			return "", false
+		}
+	}
+}
+
+// volumeDisk returns the number of the disk a volume lies on; -1 for volumes
+// spanning several disks or that can't be queried
+func volumeDisk(volume string) int64 {
+	name, _ := syscall.UTF16PtrFromString(strings.TrimSuffix(volume, `\`))
+	handle, err := windows.CreateFile(name, 0, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return -1
+	}
+	defer windows.CloseHandle(handle)
+	var extents volumeDiskExtents
+	var returned uint32
+	if err := windows.DeviceIoControl(handle, IOCTL_VOLUME_GET_VOLUME_DISK_EXTENTS, nil, 0, (*byte)(unsafe.Pointer(&extents)), uint32(unsafe.Sizeof(extents)), &returned, nil); err != nil || extents.NumberOfDiskExtents != 1 {
+		return -1
+	}
+	return int64(extents.DiskNumber)
+}
+
+// formatResult receives the outcome of FormatEx from its callback, which has no
+// context parameter; formatLock serializes formats
+var (
+	formatLock     sync.Mutex
+	formatResult   bool
+	formatCallback = syscall.NewCallback(func(command uintptr, subAction uintptr, actionInfo *byte) uintptr {
+		if command == FCC_DONE && actionInfo != nil {
+			formatResult = *actionInfo != 0
+		}
+		return 1 // Continue
+	})
+)
+
+// format quick-formats a volume as NTFS
+func format(volume string) error {
+	formatLock.Lock()
+	defer formatLock.Unlock()
+	root, _ := syscall.UTF16PtrFromString(volume)
+	fileSystem, _ := syscall.UTF16PtrFromString("NTFS")
+	label, _ := syscall.UTF16PtrFromString(VolumeLabel)
+	formatResult = false
+	FormatEx.Call(uintptr(unsafe.Pointer(root)), FMIFS_HARDDISK, uintptr(unsafe.Pointer(fileSystem)), uintptr(unsafe.Pointer(label)), 1, 0, formatCallback)
+	if !formatResult {
+		return fmt.Errorf("failed to format %s", volume)
+	}
+	return nil
+}
+
+// fill mounts the volume in a temporary folder and copies the files into it
+func fill(volume, dir string, files []string) error {
+	mountPoint, err := os.MkdirTemp("", "datn-vhd-")
+	if err != nil {
+		return fmt.Errorf("failed to create mount point: %v", err)
+	}
+	defer os.Remove(mountPoint)
+	mountName, _ := syscall.UTF16PtrFromString(mountPoint + `\`)
+	volumeName, _ := syscall.UTF16PtrFromString(volume)
+	if err := windows.SetVolumeMountPoint(mountName, volumeName); err != nil {
+		return fmt.Errorf("failed to mount %s: %v", volume, err)
+	}
+	defer windows.DeleteVolumeMountPoint(mountName)
+
+	for _, file := range files {
+		relative, err := filepath.Rel(dir, file)
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %v", file, err)
+		}
+		if err := copyFile(file, filepath.Join(mountPoint, relative)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies a file, creating its folder, and flushes it to the disk
+func copyFile(from, to string) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %v", from, err)
+	}
+	defer source.Close()
+	if err := os.MkdirAll(filepath.Dir(to), 0700); err != nil {
+		return fmt.Errorf("failed to copy %s: %v", from, err)
+	}
+	target, err := os.Create(to)
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %v", from, err)
+	}
+	_, err = io.Copy(target, source)
+	err = errors.Join(err, target.Sync(), target.Close())
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %v", from, err)
+	}
+	return nil
+}
+
+// hashFile returns the SHA-256 of a file in hex
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash %s: %v", path, err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %v", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
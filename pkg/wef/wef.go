@@ -0,0 +1,248 @@
+package wef
+
+import (
+	"encoding/xml"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"lemita/datn/pkg/config"
+	"lemita/datn/pkg/eventlog"
+)
+
+var (
+	wecapi                    = syscall.NewLazyDLL("wecapi.dll")
+	ecOpenSubscription        = wecapi.NewProc("EcOpenSubscription")
+	ecSetSubscriptionProperty = wecapi.NewProc("EcSetSubscriptionProperty")
+	ecSaveSubscription        = wecapi.NewProc("EcSaveSubscription")
+	ecClose                   = wecapi.NewProc("EcClose")
+)
+
+const (
+	EC_READ_ACCESS  = 1
+	EC_WRITE_ACCESS = 2
+
+	EC_CREATE_NEW    = 1
+	EC_OPEN_EXISTING = 2
+
+	// EC_SUBSCRIPTION_PROPERTY_ID values
+	EcSubscriptionEnabled                      = 0
+	EcSubscriptionDescription                  = 6
+	EcSubscriptionConfigurationMode            = 8
+	EcSubscriptionQuery                        = 10
+	EcSubscriptionContentFormat                = 18
+	EcSubscriptionLogFile                      = 19
+	EcSubscriptionReadExistingEvents           = 25
+	EcSubscriptionType                         = 27
+	EcSubscriptionAllowedSourceDomainComputers = 31
+
+	// EC_VARIANT_TYPE values
+	EcVarTypeBoolean = 1
+	EcVarTypeUInt32  = 2
+	EcVarTypeString  = 4
+
+	EcSubscriptionTypeSourceInitiated = 0
+	EcContentFormatRenderedText       = 2
+)
+
+// Delivery optimizations of a subscription (EC_SUBSCRIPTION_CONFIGURATION_MODE)
+const (
+	ModeNormal       = "normal"        // Batches of 5 events or every 15 minutes
+	ModeMinLatency   = "min-latency"   // Every event within 30 seconds
+	ModeMinBandwidth = "min-bandwidth" // Every 6 hours
+)
+
+// configurationModes maps the mode names to EC_SUBSCRIPTION_CONFIGURATION_MODE
+var configurationModes = map[string]uint32{
+	ModeNormal:       0,
+	ModeMinLatency:   2,
+	ModeMinBandwidth: 3,
+}
+
+// DomainComputers is the SDDL that lets every domain computer and domain controller
+// forward to a source-initiated subscription
+const DomainComputers = "O:NSG:BAD:P(A;;GA;;;DC)(A;;GA;;;DD)S:"
+
+// DefaultLogFile is the channel forwarded events are written to on the collector
+const DefaultLogFile = "ForwardedEvents"
+
+// EC_VARIANT holds one subscription property value
+type EC_VARIANT struct {
+	Value uint64 // BOOL, DWORD or LPCWSTR, depending on Type
+	Count uint32
+	Type  uint32
+}
+
+// Subscription describes a source-initiated event forwarding subscription
+type Subscription struct {
+	Name           string
+	Description    string
+	Channels       []config.ChannelConfig // Channels forwarded, limited to their EventIDs when set
+	LogFile        string                 // Destination channel on the collector
+	Mode           string                 // ModeNormal, ModeMinLatency or ModeMinBandwidth
+	AllowedSources string                 // SDDL of the computers allowed to forward
+	ReadExisting   bool                   // Also forward the events logged before the subscription reached a source
+	Disabled       bool
+}
+
+// ValidMode reports whether mode is a supported delivery optimization
+func ValidMode(mode string) bool {
+	_, ok := configurationModes[mode]
+	return ok
+}
+
+// xmlSelect is one <Select> element of a query list
+type xmlSelect struct {
+	Path  string `xml:"Path,attr"`
+	XPath string `xml:",chardata"`
+}
+
+// QueryList builds the subscription query, one Select per channel
+func QueryList(channels []config.ChannelConfig) (string, error) {
+	type query struct {
+		ID      int         `xml:"Id,attr"`
+		Selects []xmlSelect `xml:"Select"`
+	}
+	type queryList struct {
+		XMLName xml.Name `xml:"QueryList"`
+		Query   query    `xml:"Query"`
+	}
+
+	list := queryList{}
+	for _, channel := range channels {
+		list.Query.Selects = append(list.Query.Selects, xmlSelect{
+			Path:  channel.Name,
+			XPath: eventlog.XPathQuery(eventlog.CollectOptions{EventIDs: channel.EventIDs}),
+		})
+	}
+	data, err := xml.Marshal(list)
+	if err != nil {
+		return "", fmt.Errorf("failed to build query list: %v", err)
+	}
+	return string(data), nil
+}
+
+// Save creates the subscription on the local Windows Event Collector, or replaces
+// the settings of an existing subscription of the same name. created reports which.
+// The Windows Event Collector service (Wecsvc) must be running.
+func Save(sub Subscription) (created bool, err error) {
+	mode, ok := configurationModes[sub.Mode]
+	if !ok {
+		return false, fmt.Errorf("unknown delivery mode %q", sub.Mode)
+	}
+	query, err := QueryList(sub.Channels)
+	if err != nil {
+		return false, err
+	}
+
+	nameUTF16, err := syscall.UTF16PtrFromString(sub.Name)
+	if err != nil {
+		return false, fmt.Errorf("failed to convert subscription name to UTF16: %v", err)
+	}
+	handle, _, err := ecOpenSubscription.Call(uintptr(unsafe.Pointer(nameUTF16)), EC_READ_ACCESS|EC_WRITE_ACCESS, EC_OPEN_EXISTING)
+	if handle == 0 {
+		if err.(syscall.Errno) != syscall.ERROR_FILE_NOT_FOUND {
+			return false, fmt.Errorf("failed to open subscription %s: %v", sub.Name, err)
+		}
+		handle, _, err = ecOpenSubscription.Call(uintptr(unsafe.Pointer(nameUTF16)), EC_READ_ACCESS|EC_WRITE_ACCESS, EC_CREATE_NEW)
+		if handle == 0 {
+			return false, fmt.Errorf("failed to create subscription %s: %v", sub.Name, err)
+		}
+		created = true
+	}
+	defer ecClose.Call(handle)
+
+	properties := []struct {
+		id    uintptr
+		name  string
+		value any
+	}{
+		{EcSubscriptionType, "type", uint32(EcSubscriptionTypeSourceInitiated)},
+		{EcSubscriptionDescription, "description", sub.Description},
+		{EcSubscriptionEnabled, "enabled", !sub.Disabled},
+		{EcSubscriptionQuery, "query", query},
+		{EcSubscriptionLogFile, "log file", sub.LogFile},
+		{EcSubscriptionConfigurationMode, "configuration mode", mode},
+		{EcSubscriptionContentFormat, "content format", uint32(EcContentFormatRenderedText)},
+		{EcSubscriptionReadExistingEvents, "read existing events", sub.ReadExisting},
+		{EcSubscriptionAllowedSourceDomainComputers, "allowed sources", sub.AllowedSources},
+	}
+	for _, property := range properties {
+		if err := setProperty(handle, property.id, property.value); err != nil {
+			return created, fmt.Errorf("failed to set %s of subscription %s: %v", property.name, sub.Name, err)
+		}
+	}
+
+	if ret, _, err := ecSaveSubscription.Call(handle, 0); ret == 0 {
+		return created, fmt.Errorf("failed to save subscription %s: %v", sub.Name, err)
+	}
+	return created, nil
+}
+
+// setProperty sets one subscription property from a bool, uint32 or string
+func setProperty(handle, id uintptr, value any) error {
+	var variant EC_VARIANT
+	var text *uint16
+	switch v := value.(type) {
+	case bool:
+		variant.Type = EcVarTypeBoolean
+		if v {
+			variant.Value = 1
+		}
+	case uint32:
+		variant.Type = EcVarTypeUInt32
+		variant.Value = uint64(v)
+	case string:
+		var err error
+		if text, err = syscall.UTF16PtrFromString(v); err != nil {
+			return err
+		}
+		variant.Type = EcVarTypeString
+		variant.Value = uint64(uintptr(unsafe.Pointer(text)))
+	default:
+		return fmt.Errorf("unsupported property type %T", value)
+	}
+
+	ret, _, err := ecSetSubscriptionProperty.Call(handle, id, 0, uintptr(unsafe.Pointer(&variant)))
+	runtime.KeepAlive(text) // Only referenced through variant.Value during the call
+	if ret == 0 {
+		return err
+	}
+	return nil
+}
+
+// ParseChannels converts "Name" or "Name:id,id" arguments into channel configs.
+// A name without IDs takes the event IDs of the catalogued channel of that name,
+// or forwards every event when the channel isn't catalogued.
+func ParseChannels(args []string, catalog []config.ChannelConfig) ([]config.ChannelConfig, error) {
+	var channels []config.ChannelConfig
+	for _, arg := range args {
+		name, list, hasIDs := strings.Cut(arg, ":")
+		channel := config.ChannelConfig{Name: strings.TrimSpace(name)}
+		if channel.Name == "" {
+			return nil, fmt.Errorf("empty channel name in %q", arg)
+		}
+
+		if hasIDs {
+			for _, field := range strings.Split(list, ",") {
+				id, err := strconv.ParseUint(strings.TrimSpace(field), 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("invalid event ID %q for %s", field, channel.Name)
+				}
+				channel.EventIDs = append(channel.EventIDs, uint32(id))
+			}
+		} else {
+			for _, known := range catalog {
+				if strings.EqualFold(known.Name, channel.Name) {
+					channel.EventIDs = known.EventIDs
+					break
+				}
+			}
+		}
+		channels = append(channels, channel)
+	}
+	return channels, nil
+}
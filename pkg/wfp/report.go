@@ -0,0 +1,102 @@
+package wfp
+
+import (
+	"sort"
+	"strconv"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+// Block aggregates the drops attributed to one filter
+type Block struct {
+	FilterID     uint64         `json:"filter_id"`
+	Name         string         `json:"name"` // Empty when the filter couldn't be resolved
+	Count        int            `json:"count"`
+	Applications map[string]int `json:"applications"`
+	Destinations map[string]int `json:"destinations"` // Remote address:port of the blocked traffic
+}
+
+// Report counts WFP drop events by the filter that blocked them
+type Report struct {
+	blocks map[string]*Block
+}
+
+// NewReport returns an empty report
+func NewReport() *Report {
+	return &Report{blocks: map[string]*Block{}}
+}
+
+// Add counts the WFP drop events among events; call it after Annotate so drops
+// are grouped by rule name
+func (r *Report) Add(events []eventlog.EventLogData) {
+	if r == nil {
+		return
+	}
+	for _, event := range events {
+		if !IsDrop(event) {
+			continue
+		}
+		data := eventlog.NamedData(event.Channel, event)
+		id, _ := strconv.ParseUint(data["FilterRTID"], 10, 64)
+		name := event.Annotations["FilterName"]
+
+		// Filters of the same rule on different layers or hosts share a name
+		key := name
+		if key == "" {
+			key = "#" + data["FilterRTID"]
+		}
+		block, ok := r.blocks[key]
+		if !ok {
+			block = &Block{FilterID: id, Name: name, Applications: map[string]int{}, Destinations: map[string]int{}}
+			r.blocks[key] = block
+		}
+		block.Count++
+		if app := data["Application"]; app != "" {
+			block.Applications[app]++
+		}
+		if dest := data["DestAddress"]; dest != "" {
+			block.Destinations[dest+":"+data["DestPort"]]++
+		}
+	}
+}
+
+// Len returns the number of distinct filters seen
+func (r *Report) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.blocks)
+}
+
+// Blocks returns the filters, most drops first
+func (r *Report) Blocks() []Block {
+	list := make([]Block, 0, len(r.blocks))
+	for _, block := range r.blocks {
+		list = append(list, *block)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Top returns the most frequent keys of counts, at most n
+func Top(counts map[string]int, n int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
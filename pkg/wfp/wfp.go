@@ -0,0 +1,223 @@
+package wfp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"lemita/datn/pkg/eventlog"
+)
+
+var (
+	fwpuclnt           = syscall.NewLazyDLL("fwpuclnt.dll")
+	FwpmEngineOpen0    = fwpuclnt.NewProc("FwpmEngineOpen0")
+	FwpmEngineClose0   = fwpuclnt.NewProc("FwpmEngineClose0")
+	FwpmFilterGetById0 = fwpuclnt.NewProc("FwpmFilterGetById0")
+	FwpmFreeMemory0    = fwpuclnt.NewProc("FwpmFreeMemory0")
+)
+
+const (
+	RPC_C_AUTHN_DEFAULT    = 0xFFFFFFFF
+	FWP_E_FILTER_NOT_FOUND = 0x80320003
+)
+
+// FWPM_DISPLAY_DATA0 structure
+type FWPM_DISPLAY_DATA0 struct {
+	Name        *uint16
+	Description *uint16
+}
+
+// FWPM_FILTER0 structure, truncated to the leading fields that are read; the
+// structure is always allocated by the filter engine
+type FWPM_FILTER0 struct {
+	FilterKey   [16]byte
+	DisplayData FWPM_DISPLAY_DATA0
+	Flags       uint32
+	ProviderKey uintptr
+}
+
+// dropEvents are the Security events reporting a packet or connection blocked by
+// a WFP filter
+var dropEvents = map[uint32]bool{
+	5152: true, // The Windows Filtering Platform blocked a packet
+	5157: true, // The Windows Filtering Platform has blocked a connection
+}
+
+// IsDrop reports whether an event is a WFP packet drop or blocked connection
+func IsDrop(event eventlog.EventLogData) bool {
+	return strings.EqualFold(event.Channel, "Security") && dropEvents[event.EventID]
+}
+
+// errUnavailable is returned for a server whose engine failed to open before, so
+// the failure is only reported once
+var errUnavailable = errors.New("filter engine unavailable")
+
+// filterKey identifies a filter; run-time filter IDs are only unique per computer
+type filterKey struct {
+	Server string
+	ID     uint64
+}
+
+// Resolver turns the run-time filter IDs of WFP events into filter names. Filter
+// IDs are reassigned when the firewall policy is reloaded or the computer restarts,
+// so events should be resolved soon after they are collected.
+type Resolver struct {
+	engines map[string]uintptr // Engine handle per server ("" = local)
+	names   map[filterKey]string
+}
+
+// NewResolver returns a resolver; filter engines are opened on first use
+func NewResolver() *Resolver {
+	return &Resolver{
+		engines: map[string]uintptr{},
+		names:   map[filterKey]string{},
+	}
+}
+
+// engine returns an engine handle for server, opening the session if needed
+func (r *Resolver) engine(server string) (uintptr, error) {
+	if handle, ok := r.engines[server]; ok {
+		if handle == 0 {
+			return 0, errUnavailable
+		}
+		return handle, nil
+	}
+
+	var serverPtr *uint16
+	if server != "" {
+		var err error
+		if serverPtr, err = syscall.UTF16PtrFromString(server); err != nil {
+			return 0, fmt.Errorf("invalid server name: %v", err)
+		}
+	}
+	var handle uintptr
+	ret, _, _ := FwpmEngineOpen0.Call(
+		uintptr(unsafe.Pointer(serverPtr)),
+		RPC_C_AUTHN_DEFAULT,
+		0,
+		0,
+		uintptr(unsafe.Pointer(&handle)),
+	)
+	if ret != 0 {
+		// Don't retry for every event of an unreachable host
+		r.engines[server] = 0
+		return 0, fmt.Errorf("FwpmEngineOpen0 failed on %s: %v", serverName(server), syscall.Errno(ret))
+	}
+	r.engines[server] = handle
+	return handle, nil
+}
+
+// FilterName returns the display name of a filter, which for Windows Firewall
+// filters is the name of the firewall rule
+func (r *Resolver) FilterName(server string, id uint64) (string, error) {
+	key := filterKey{strings.ToLower(server), id}
+	if name, ok := r.names[key]; ok {
+		return name, nil
+	}
+
+	handle, err := r.engine(key.Server)
+	if err != nil {
+		return "", err
+	}
+
+	var filter *FWPM_FILTER0
+	var ret uintptr
+	if unsafe.Sizeof(uintptr(0)) == 4 {
+		// The 64-bit ID takes two argument slots on 32-bit platforms
+		ret, _, _ = FwpmFilterGetById0.Call(handle, uintptr(id), uintptr(id>>32), uintptr(unsafe.Pointer(&filter)))
+	} else {
+		ret, _, _ = FwpmFilterGetById0.Call(handle, uintptr(id), uintptr(unsafe.Pointer(&filter)))
+	}
+	if ret == FWP_E_FILTER_NOT_FOUND {
+		// The filter has been removed or renumbered since the event was logged
+		r.names[key] = ""
+		return "", nil
+	}
+	if ret != 0 {
+		return "", fmt.Errorf("FwpmFilterGetById0 failed for filter %d: %v", id, syscall.Errno(ret))
+	}
+	defer FwpmFreeMemory0.Call(uintptr(unsafe.Pointer(&filter)))
+
+	var name string
+	if filter.DisplayData.Name != nil {
+		name = windowsString(filter.DisplayData.Name)
+	}
+	r.names[key] = name
+	return name, nil
+}
+
+// Annotate sets the FilterName annotation of the WFP drop events among events.
+// Events whose filter can't be resolved are left unchanged; the first new error
+// is returned.
+func (r *Resolver) Annotate(events []eventlog.EventLogData) error {
+	if r == nil {
+		return nil
+	}
+
+	var firstErr error
+	for i := range events {
+		if !IsDrop(events[i]) {
+			continue
+		}
+		id, err := strconv.ParseUint(eventlog.NamedData(events[i].Channel, events[i])["FilterRTID"], 10, 64)
+		if err != nil || id == 0 {
+			continue
+		}
+		name, err := r.FilterName(eventServer(events[i]), id)
+		if err != nil {
+			if firstErr == nil && err != errUnavailable {
+				firstErr = err
+			}
+			continue
+		}
+		if name == "" {
+			continue
+		}
+		if events[i].Annotations == nil {
+			events[i].Annotations = map[string]string{}
+		}
+		events[i].Annotations["FilterName"] = name
+	}
+	return firstErr
+}
+
+// Close closes the filter engine sessions
+func (r *Resolver) Close() {
+	if r == nil {
+		return
+	}
+	for server, handle := range r.engines {
+		if handle != 0 {
+			FwpmEngineClose0.Call(handle)
+		}
+		delete(r.engines, server)
+	}
+}
+
+// eventServer returns the computer whose filter engine logged an event ("" = local)
+func eventServer(event eventlog.EventLogData) string {
+	if event.Provenance != nil && event.Provenance.Remote {
+		return event.Provenance.Host
+	}
+	return ""
+}
+
+// serverName names a server in messages
+func serverName(server string) string {
+	if server == "" {
+		return "the local computer"
+	}
+	return server
+}
+
+// windowsString converts a NUL-terminated UTF-16 string owned by Windows
+func windowsString(p *uint16) string {
+	var chars []uint16
+	for ptr := unsafe.Pointer(p); *(*uint16)(ptr) != 0; ptr = unsafe.Add(ptr, 2) {
+		chars = append(chars, *(*uint16)(ptr))
+	}
+	return syscall.UTF16ToString(chars)
+}